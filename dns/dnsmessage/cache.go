@@ -0,0 +1,189 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errCacheNotResponse = errors.New("message is not a response")
+	errCacheTruncated   = errors.New("message is truncated")
+	errCacheQuestions   = errors.New("message does not have a single question")
+)
+
+// maxTTL is the largest TTL; as RFC 2181, Section 8 specifies, TTLs with
+// the most significant bit set are treated as zero.
+const maxTTL = 1<<31 - 1
+
+// DecayTTL returns what is left of the TTL ttl, in seconds, once elapsed,
+// rounded down to whole seconds, has passed, or zero once it expired. A
+// TTL with the most significant bit set is zero, as RFC 2181, Section 8
+// specifies.
+func DecayTTL(ttl uint32, elapsed time.Duration) uint32 {
+	if ttl > maxTTL {
+		return 0
+	}
+	if elapsed <= 0 {
+		return ttl
+	}
+	s := elapsed / time.Second
+	if s >= time.Duration(ttl) {
+		return 0
+	}
+	return ttl - uint32(s)
+}
+
+// A CacheKey is the key of the responses of a cache: the name, ignoring
+// case, type and class of their question.
+type CacheKey struct {
+	Name  Name // with its ASCII letters lowercased
+	Type  Type
+	Class Class
+}
+
+// NewCacheKey returns the CacheKey of the question q.
+func NewCacheKey(q Question) CacheKey {
+	return CacheKey{Name: lowerName(q.Name), Type: q.Type, Class: q.Class}
+}
+
+// A CacheEntry holds a response of a caching resolver, parsed once when
+// stored. The responses to the hits are serialized again from the
+// message received, patching its ID and its TTLs, decayed by the time
+// elapsed, without parsing nor building it again.
+type CacheEntry struct {
+	key    CacheKey
+	msg    []byte
+	stored time.Time
+	ttls   []cacheTTL
+	ttl    uint32
+}
+
+// A cacheTTL is a TTL of the message of a CacheEntry.
+type cacheTTL struct {
+	off int    // offset of the TTL in the message
+	ttl uint32 // as received
+}
+
+// NewCacheEntry returns the CacheEntry of the response msg, received at
+// now, which has a single question and is not truncated. The entry holds
+// a copy of msg.
+//
+// The TTL of the entry is the least TTL of its resources, but the OPT
+// resource, whose TTL field holds the extended RCode and flags, and is
+// kept. That of a negative response, NXDOMAIN or without answers, is at
+// most the MINIMUM field of the SOA resource of its authority section,
+// as RFC 2308, Section 5 specifies. A response without resources has a
+// TTL of zero, as it cannot be cached.
+func NewCacheEntry(msg []byte, now time.Time) (*CacheEntry, error) {
+	var p Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !h.Response {
+		return nil, errCacheNotResponse
+	}
+	if h.Truncated {
+		return nil, errCacheTruncated
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	if len(qs) != 1 {
+		return nil, errCacheQuestions
+	}
+	e := &CacheEntry{
+		key:    NewCacheKey(qs[0]),
+		msg:    append([]byte(nil), msg...),
+		stored: now,
+	}
+	answers := 0
+	var soaMin uint32
+	soa := false
+	for sec := sectionAnswers; sec <= sectionAdditionals; sec++ {
+		for {
+			rh, err := p.resourceHeader(sec)
+			if err == ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if rh.Type != TypeOPT {
+				// The TTL precedes the length of the body, which
+				// ends the header.
+				ttl := uint32(msg[p.off-6])<<24 | uint32(msg[p.off-5])<<16 | uint32(msg[p.off-4])<<8 | uint32(msg[p.off-3])
+				e.ttls = append(e.ttls, cacheTTL{off: p.off - 6, ttl: ttl})
+			}
+			if sec == sectionAnswers {
+				answers++
+			}
+			if sec == sectionAuthorities && rh.Type == TypeSOA && !soa {
+				r, err := p.SOAResource()
+				if err != nil {
+					return nil, err
+				}
+				soa, soaMin = true, r.MinTTL
+				continue
+			}
+			if err := p.skipResource(sec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, t := range e.ttls {
+		if ttl := DecayTTL(t.ttl, 0); i == 0 || ttl < e.ttl {
+			e.ttl = ttl
+		}
+	}
+	negative := h.RCode == RCodeNameError || (h.RCode == RCodeSuccess && answers == 0)
+	if negative && soa && soaMin < e.ttl {
+		e.ttl = soaMin
+	}
+	return e, nil
+}
+
+// Key returns the key of the question of e.
+func (e *CacheEntry) Key() CacheKey {
+	return e.key
+}
+
+// Stored returns the time at which the message of e was received.
+func (e *CacheEntry) Stored() time.Time {
+	return e.stored
+}
+
+// TTL returns the TTL of e left at now, in seconds, or zero once e
+// expired.
+func (e *CacheEntry) TTL(now time.Time) uint32 {
+	return DecayTTL(e.ttl, now.Sub(e.stored))
+}
+
+// Expired reports whether e expired at now.
+func (e *CacheEntry) Expired(now time.Time) bool {
+	return e.TTL(now) == 0
+}
+
+// AppendPack appends the message of e, as a response to the query of ID
+// id sent at now, to b: its TTLs are decayed by the time elapsed since
+// it was stored, with a floor of zero for an expired entry served stale.
+func (e *CacheEntry) AppendPack(b []byte, id uint16, now time.Time) []byte {
+	start := len(b)
+	b = append(b, e.msg...)
+	msg := b[start:]
+	msg[0], msg[1] = byte(id>>8), byte(id)
+	elapsed := now.Sub(e.stored)
+	for _, t := range e.ttls {
+		ttl := DecayTTL(t.ttl, elapsed)
+		msg[t.off] = byte(ttl >> 24)
+		msg[t.off+1] = byte(ttl >> 16)
+		msg[t.off+2] = byte(ttl >> 8)
+		msg[t.off+3] = byte(ttl)
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecayTTL(t *testing.T) {
+	for _, tt := range []struct {
+		ttl     uint32
+		elapsed time.Duration
+		want    uint32
+	}{
+		{300, 0, 300},
+		{300, -time.Second, 300},
+		{300, 1500 * time.Millisecond, 299},
+		{300, 300 * time.Second, 0},
+		{300, time.Hour, 0},
+		{1 << 31, 0, 0},
+	} {
+		if got := DecayTTL(tt.ttl, tt.elapsed); got != tt.want {
+			t.Errorf("DecayTTL(%d, %v) = %d; want %d", tt.ttl, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestCacheEntry(t *testing.T) {
+	name := MustNewName("WWW.Example.com.")
+	m := Message{
+		Header:    Header{ID: 1, Response: true, RecursionAvailable: true},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassINET}},
+		Answers: []Resource{
+			{ResourceHeader{Name: name, Type: TypeA, Class: ClassINET, TTL: 300}, &AResource{[4]byte{192, 0, 2, 1}}},
+			{ResourceHeader{Name: name, Type: TypeA, Class: ClassINET, TTL: 60}, &AResource{[4]byte{192, 0, 2, 2}}},
+		},
+		Additionals: []Resource{
+			{mustEDNS0ResourceHeader(1232, RCodeSuccess, true), &OPTResource{}},
+		},
+	}
+	msg, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1e9, 0)
+	e, err := NewCacheEntry(msg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := NewCacheKey(Question{Name: MustNewName("www.example.COM."), Type: TypeA, Class: ClassINET}); e.Key() != want {
+		t.Errorf("Key() = %v; want %v", e.Key(), want)
+	}
+	if got := e.TTL(now.Add(10 * time.Second)); got != 50 {
+		t.Errorf("TTL after 10s = %d; want 50", got)
+	}
+	if !e.Expired(now.Add(time.Minute)) {
+		t.Errorf("not Expired after a minute")
+	}
+
+	packed := e.AppendPack([]byte("xx"), 0xabcd, now.Add(10*time.Second))
+	if string(packed[:2]) != "xx" {
+		t.Fatalf("AppendPack overwrote its buffer")
+	}
+	var got Message
+	if err := got.Unpack(packed[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.ID != 0xabcd {
+		t.Errorf("ID = %#x; want 0xabcd", got.Header.ID)
+	}
+	if got.Answers[0].Header.TTL != 290 || got.Answers[1].Header.TTL != 50 {
+		t.Errorf("answer TTLs = %d, %d; want 290, 50", got.Answers[0].Header.TTL, got.Answers[1].Header.TTL)
+	}
+	if got.Additionals[0].Header.TTL != m.Additionals[0].Header.TTL {
+		t.Errorf("OPT TTL = %#x; want %#x", got.Additionals[0].Header.TTL, m.Additionals[0].Header.TTL)
+	}
+	if msg[0] != 0 || msg[1] != 1 {
+		t.Errorf("AppendPack modified the message of the entry")
+	}
+}
+
+func TestCacheEntryNegative(t *testing.T) {
+	name := MustNewName("nx.example.com.")
+	zone := MustNewName("example.com.")
+	m := Message{
+		Header:    Header{Response: true, RCode: RCodeNameError},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassINET}},
+		Authorities: []Resource{
+			{
+				ResourceHeader{Name: zone, Type: TypeSOA, Class: ClassINET, TTL: 3600},
+				&SOAResource{NS: zone, MBox: zone, Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinTTL: 120},
+			},
+		},
+	}
+	msg, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1e9, 0)
+	e, err := NewCacheEntry(msg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.TTL(now); got != 120 {
+		t.Errorf("TTL = %d; want the SOA MINIMUM, 120", got)
+	}
+
+	m.Header.Truncated = true
+	if msg, err = m.Pack(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCacheEntry(msg, now); err == nil {
+		t.Errorf("NewCacheEntry of a truncated response succeeded")
+	}
+}
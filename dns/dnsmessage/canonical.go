@@ -0,0 +1,148 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// ErrNotRRSet indicates that resources expected to form an RRset differ
+// in name, type or class.
+var ErrNotRRSet = errors.New("resources are not an RRset")
+
+// CanonicalResource returns the canonical form of r, as defined by
+// RFC 4034, Section 6.2: its name, and the names in the bodies of the
+// types which have some, are lowercased. The body of r is not modified.
+//
+// The canonical form is used to sign and verify RRsets with DNSSEC, and
+// to compare them.
+func CanonicalResource(r Resource) Resource {
+	r.Header.Name = lowerName(r.Header.Name)
+	switch b := r.Body.(type) {
+	case *CNAMEResource:
+		r.Body = &CNAMEResource{CNAME: lowerName(b.CNAME)}
+	case *MXResource:
+		r.Body = &MXResource{Pref: b.Pref, MX: lowerName(b.MX)}
+	case *NSResource:
+		r.Body = &NSResource{NS: lowerName(b.NS)}
+	case *PTRResource:
+		r.Body = &PTRResource{PTR: lowerName(b.PTR)}
+	case *SOAResource:
+		c := *b
+		c.NS, c.MBox = lowerName(b.NS), lowerName(b.MBox)
+		r.Body = &c
+	case *SRVResource:
+		c := *b
+		c.Target = lowerName(b.Target)
+		r.Body = &c
+	}
+	return r
+}
+
+// SortRRSet puts the resources of the RRset rs in canonical form, and
+// sorts them in the canonical order of RFC 4034, Section 6.3: by their
+// bodies, in wire format, as sequences of unsigned bytes. Duplicate
+// resources are removed. SortRRSet reuses the storage of rs. It returns
+// ErrNotRRSet if the resources differ in name, ignoring case, type or
+// class.
+func SortRRSet(rs []Resource) ([]Resource, error) {
+	keyed, err := canonicalRRSet(rs)
+	if err != nil {
+		return nil, err
+	}
+	out := rs[:0]
+	for i, k := range keyed {
+		if i > 0 && bytes.Equal(k.data, keyed[i-1].data) {
+			continue
+		}
+		out = append(out, k.r)
+	}
+	return out, nil
+}
+
+// EqualRRSets reports whether the RRsets a and b hold the same
+// resources, in canonical form: their order, duplicates and TTLs, and
+// the case of their names, are ignored. It returns ErrNotRRSet if the
+// resources of a, or of b, differ in name, type or class.
+func EqualRRSets(a, b []Resource) (bool, error) {
+	ka, err := canonicalRRSet(a)
+	if err != nil {
+		return false, err
+	}
+	kb, err := canonicalRRSet(b)
+	if err != nil {
+		return false, err
+	}
+	if len(ka) == 0 || len(kb) == 0 {
+		return len(ka) == len(kb), nil
+	}
+	ha, hb := &ka[0].r.Header, &kb[0].r.Header
+	if !sameName(ha.Name, hb.Name) || ha.Type != hb.Type || ha.Class != hb.Class {
+		return false, nil
+	}
+	i, j := 0, 0
+	for i < len(ka) && j < len(kb) {
+		if !bytes.Equal(ka[i].data, kb[j].data) {
+			return false, nil
+		}
+		// Skip the duplicates.
+		for i++; i < len(ka) && bytes.Equal(ka[i].data, ka[i-1].data); i++ {
+		}
+		for j++; j < len(kb) && bytes.Equal(kb[j].data, kb[j-1].data); j++ {
+		}
+	}
+	return i == len(ka) && j == len(kb), nil
+}
+
+// A canonicalResource is a resource in canonical form, with the wire
+// format of its body.
+type canonicalResource struct {
+	r    Resource
+	data []byte
+}
+
+// canonicalRRSet returns the resources of the RRset rs in canonical form
+// and order, with their bodies in wire format.
+func canonicalRRSet(rs []Resource) ([]canonicalResource, error) {
+	keyed := make([]canonicalResource, 0, len(rs))
+	for i := range rs {
+		if rs[i].Body == nil {
+			return nil, errNilResouceBody
+		}
+		r := CanonicalResource(rs[i])
+		r.Header.Type = r.Body.realType()
+		if i > 0 {
+			h := &keyed[0].r.Header
+			if !sameName(r.Header.Name, h.Name) || r.Header.Type != h.Type || r.Header.Class != h.Class {
+				return nil, ErrNotRRSet
+			}
+		}
+		data, err := r.Body.pack(nil, nil, 0)
+		if err != nil {
+			return nil, &nestedError{r.Header.Type.String() + " body", err}
+		}
+		keyed = append(keyed, canonicalResource{r, data})
+	}
+	sort.Slice(keyed, func(i, j int) bool {
+		return bytes.Compare(keyed[i].data, keyed[j].data) < 0
+	})
+	return keyed, nil
+}
+
+func sameName(a, b Name) bool {
+	return bytes.Equal(a.Data[:a.Length], b.Data[:b.Length])
+}
+
+// lowerName returns n with its ASCII letters lowercased.
+func lowerName(n Name) Name {
+	for i := 0; i < int(n.Length); i++ {
+		if c := n.Data[i]; 'A' <= c && c <= 'Z' {
+			n.Data[i] = c + 'a' - 'A'
+		}
+	}
+	return n
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalResource(t *testing.T) {
+	r := Resource{
+		Header: ResourceHeader{Name: MustNewName("WWW.Example.com."), Type: TypeMX, Class: ClassINET, TTL: 300},
+		Body:   &MXResource{Pref: 10, MX: MustNewName("Mail.EXAMPLE.com.")},
+	}
+	c := CanonicalResource(r)
+	want := Resource{
+		Header: ResourceHeader{Name: MustNewName("www.example.com."), Type: TypeMX, Class: ClassINET, TTL: 300},
+		Body:   &MXResource{Pref: 10, MX: MustNewName("mail.example.com.")},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("CanonicalResource = %#v; want %#v", c, want)
+	}
+	if r.Body.(*MXResource).MX.String() != "Mail.EXAMPLE.com." {
+		t.Errorf("CanonicalResource modified the body of its argument: %v", r.Body.(*MXResource).MX)
+	}
+
+	// The case of TXT data is preserved.
+	txt := &TXTResource{TXT: []string{"Hello"}}
+	if c := CanonicalResource(Resource{Header: r.Header, Body: txt}); c.Body != txt {
+		t.Errorf("CanonicalResource changed the body %#v to %#v", txt, c.Body)
+	}
+}
+
+func TestSortRRSet(t *testing.T) {
+	hdr := func(name string) ResourceHeader {
+		return ResourceHeader{Name: MustNewName(name), Type: TypeNS, Class: ClassINET, TTL: 3600}
+	}
+	rs := []Resource{
+		{hdr("example.com."), &NSResource{MustNewName("ns2.example.com.")}},
+		{hdr("EXAMPLE.com."), &NSResource{MustNewName("NS1.example.com.")}},
+		{hdr("example.com."), &NSResource{MustNewName("b.example.")}},
+		{hdr("Example.com."), &NSResource{MustNewName("ns1.example.com.")}},
+	}
+	got, err := SortRRSet(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range got {
+		if r.Header.Name.String() != "example.com." {
+			t.Errorf("resource name %v not in canonical form", r.Header.Name)
+		}
+		names = append(names, r.Body.(*NSResource).NS.String())
+	}
+	// The wire format of "b.example." starts with a shorter label.
+	if want := []string{"b.example.", "ns1.example.com.", "ns2.example.com."}; !reflect.DeepEqual(names, want) {
+		t.Errorf("sorted RRset = %v; want %v", names, want)
+	}
+
+	rs = append(rs, Resource{hdr("example.com."), &AResource{[4]byte{192, 0, 2, 1}}})
+	if _, err := SortRRSet(rs); err != ErrNotRRSet {
+		t.Errorf("SortRRSet of mixed types: got %v; want %v", err, ErrNotRRSet)
+	}
+}
+
+func TestEqualRRSets(t *testing.T) {
+	a := func(name string, ttl uint32, ip byte) Resource {
+		return Resource{
+			ResourceHeader{Name: MustNewName(name), Type: TypeA, Class: ClassINET, TTL: ttl},
+			&AResource{[4]byte{192, 0, 2, ip}},
+		}
+	}
+	for _, tt := range []struct {
+		x, y []Resource
+		want bool
+	}{
+		{nil, nil, true},
+		{nil, []Resource{a("a.example.", 60, 1)}, false},
+		{
+			[]Resource{a("a.example.", 60, 1), a("a.example.", 60, 2)},
+			[]Resource{a("A.EXAMPLE.", 300, 2), a("a.example.", 300, 1), a("a.example.", 300, 2)},
+			true,
+		},
+		{
+			[]Resource{a("a.example.", 60, 1), a("a.example.", 60, 2)},
+			[]Resource{a("a.example.", 60, 1), a("a.example.", 60, 3)},
+			false,
+		},
+		{
+			[]Resource{a("a.example.", 60, 1)},
+			[]Resource{a("b.example.", 60, 1)},
+			false,
+		},
+	} {
+		got, err := EqualRRSets(tt.x, tt.y)
+		if err != nil {
+			t.Errorf("EqualRRSets(%v, %v): %v", tt.x, tt.y, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EqualRRSets(%v, %v) = %v; want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
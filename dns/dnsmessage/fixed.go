@@ -0,0 +1,58 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+// NewFixedBuilder is like NewBuilder, but the message is built in the
+// capacity of buf, which never grows: the records which do not fit fail
+// with ErrBufTooSmall, leaving the Builder as it was, so that the caller
+// may stop there, such as to set the truncated bit of a response, or
+// provide a larger buffer with Grow and add the record again. It returns
+// ErrBufTooSmall if buf has no room for the header.
+//
+// Reusing a buffer, such as one per connection, avoids the allocations of
+// a growing message in servers.
+func NewFixedBuilder(buf []byte, h Header) (Builder, error) {
+	if cap(buf)-len(buf) < headerLen {
+		return Builder{}, ErrBufTooSmall
+	}
+	b := NewBuilder(buf, h)
+	b.fixed = true
+	return b, nil
+}
+
+// Grow moves the message being built by a Builder created by
+// NewFixedBuilder to buf, in which the building continues, copying the
+// bytes the message was appended to before it. The capacity of buf must
+// be at least len(buf) plus the length of those bytes and of the message
+// built so far. For other Builders, it only copies the bytes.
+func (b *Builder) Grow(buf []byte) error {
+	if b.section <= sectionNotStarted {
+		return ErrNotStarted
+	}
+	if cap(buf)-len(buf) < len(b.msg) {
+		return ErrBufTooSmall
+	}
+	// The compression offsets are relative to the start of the message,
+	// which keeps its offset in the bytes copied.
+	b.start += len(buf)
+	b.msg = append(buf, b.msg...)
+	return nil
+}
+
+// checkFits returns ErrBufTooSmall if msg, the message with a new
+// record, has grown beyond the buffer of b, removing the compression
+// entries of the record.
+func (b *Builder) checkFits(msg []byte) error {
+	if !b.fixed || len(msg) <= cap(b.msg) {
+		return nil
+	}
+	end := len(b.msg) - b.start
+	for suffix, off := range b.compression {
+		if off >= end {
+			delete(b.compression, suffix)
+		}
+	}
+	return ErrBufTooSmall
+}
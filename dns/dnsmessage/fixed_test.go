@@ -0,0 +1,111 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFixedBuilder(t *testing.T) {
+	h := Header{ID: 0x1234, Response: true, Authoritative: true}
+	q := Question{Name: MustNewName("www.example.com."), Type: TypeA, Class: ClassINET}
+	var answers []AResource
+	for i := 0; i < 20; i++ {
+		answers = append(answers, AResource{[4]byte{192, 0, 2, byte(i)}})
+	}
+	build := func(b *Builder, grow func() error) []byte {
+		t.Helper()
+		b.EnableCompression()
+		if err := b.StartQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Question(q); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.StartAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range answers {
+			rh := ResourceHeader{Name: MustNewName("WWW.example.com."), Class: ClassINET, TTL: 60}
+			err := b.AResource(rh, a)
+			if err == ErrBufTooSmall && grow != nil {
+				if err = grow(); err == nil {
+					err = b.AResource(rh, a)
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	nb := NewBuilder([]byte("prefix"), h)
+	want := build(&nb, nil)
+
+	fb, err := NewFixedBuilder(append(make([]byte, 0, 64), "prefix"...), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grows := 0
+	got := build(&fb, func() error {
+		grows++
+		return fb.Grow(make([]byte, 0, 2*cap(fb.msg)))
+	})
+	if !bytes.Equal(got, want) {
+		t.Errorf("fixed builder message:\n%x\nwant:\n%x", got, want)
+	}
+	if grows == 0 {
+		t.Error("ErrBufTooSmall never returned")
+	}
+	var p Parser
+	if _, err := p.Start(got[len("prefix"):]); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	all, err := p.AllAnswers()
+	if err != nil || len(all) != len(answers) {
+		t.Fatalf("AllAnswers = %d answers, %v; want %d", len(all), err, len(answers))
+	}
+}
+
+func TestFixedBuilderTooSmall(t *testing.T) {
+	if _, err := NewFixedBuilder(make([]byte, 0, headerLen-1), Header{}); err != ErrBufTooSmall {
+		t.Errorf("NewFixedBuilder with no room for the header = %v; want %v", err, ErrBufTooSmall)
+	}
+	buf := make([]byte, 0, headerLen+20)
+	b, err := NewFixedBuilder(buf, Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	q := Question{Name: MustNewName("a-long-name.example.com."), Type: TypeA, Class: ClassINET}
+	if err := b.Question(q); err != ErrBufTooSmall {
+		t.Fatalf("Question over the buffer = %v; want %v", err, ErrBufTooSmall)
+	}
+	if len(b.compression) != 0 || b.header.questions != 0 {
+		t.Errorf("Builder changed by a failed Question: %d compression entries, %d questions", len(b.compression), b.header.questions)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg) != headerLen || &msg[:1][0] != &buf[:1][0] {
+		t.Errorf("Finish = %d bytes, in buffer %t; want the header in the buffer", len(msg), &msg[:1][0] == &buf[:1][0])
+	}
+	if err := b.Grow(make([]byte, 0, headerLen-1)); err != ErrBufTooSmall {
+		t.Errorf("Grow to a smaller buffer = %v; want %v", err, ErrBufTooSmall)
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	errJSONNoRData = errors.New("resource has no RDATAHEX, nor rdata presentation of its type")
+	errJSONRData   = errors.New("invalid rdata presentation")
+)
+
+// jsonMessage is the representation of a Message in the JSON format of
+// RFC 8427, Section 2.1.
+type jsonMessage struct {
+	ID      uint16   `json:"ID"`
+	QR      jsonBool `json:"QR"`
+	Opcode  uint16   `json:"Opcode"`
+	AA      jsonBool `json:"AA"`
+	TC      jsonBool `json:"TC"`
+	RD      jsonBool `json:"RD"`
+	RA      jsonBool `json:"RA"`
+	AD      jsonBool `json:"AD"`
+	CD      jsonBool `json:"CD"`
+	RCODE   uint16   `json:"RCODE"`
+	QDCOUNT int      `json:"QDCOUNT"`
+	ANCOUNT int      `json:"ANCOUNT"`
+	NSCOUNT int      `json:"NSCOUNT"`
+	ARCOUNT int      `json:"ARCOUNT"`
+
+	// The question of a message of a single one may be given directly.
+	QNAME  string  `json:"QNAME,omitempty"`
+	QTYPE  *uint16 `json:"QTYPE,omitempty"`
+	QCLASS *uint16 `json:"QCLASS,omitempty"`
+
+	QuestionRRs   []jsonQuestion `json:"questionRRs"`
+	AnswerRRs     []jsonResource `json:"answerRRs"`
+	AuthorityRRs  []jsonResource `json:"authorityRRs"`
+	AdditionalRRs []jsonResource `json:"additionalRRs"`
+
+	MessageOctetsHEX string `json:"messageOctetsHEX,omitempty"`
+}
+
+// A jsonBool is a flag of a header, a boolean which may also be given as
+// 1 or 0, as the examples of RFC 8427 do.
+type jsonBool bool
+
+func (b *jsonBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "1":
+		*b = true
+		return nil
+	case "0":
+		*b = false
+		return nil
+	}
+	return json.Unmarshal(data, (*bool)(b))
+}
+
+// jsonQuestion is the representation of a Question of RFC 8427, Section
+// 2.2.
+type jsonQuestion struct {
+	NAME      string `json:"NAME"`
+	TYPE      uint16 `json:"TYPE"`
+	TYPEname  string `json:"TYPEname,omitempty"`
+	CLASS     uint16 `json:"CLASS"`
+	CLASSname string `json:"CLASSname,omitempty"`
+}
+
+// jsonResource is the representation of a Resource of RFC 8427, Section
+// 2.2, with the presentation format of the data of the common types.
+type jsonResource struct {
+	NAME      string `json:"NAME"`
+	TYPE      uint16 `json:"TYPE"`
+	TYPEname  string `json:"TYPEname,omitempty"`
+	CLASS     uint16 `json:"CLASS"`
+	CLASSname string `json:"CLASSname,omitempty"`
+	TTL       uint32 `json:"TTL"`
+	RDLENGTH  int    `json:"RDLENGTH"`
+	RDATAHEX  string `json:"RDATAHEX,omitempty"`
+
+	RdataA     string `json:"rdataA,omitempty"`
+	RdataAAAA  string `json:"rdataAAAA,omitempty"`
+	RdataNS    string `json:"rdataNS,omitempty"`
+	RdataCNAME string `json:"rdataCNAME,omitempty"`
+	RdataPTR   string `json:"rdataPTR,omitempty"`
+	RdataMX    string `json:"rdataMX,omitempty"`
+	RdataSOA   string `json:"rdataSOA,omitempty"`
+	RdataTXT   string `json:"rdataTXT,omitempty"`
+	RdataSRV   string `json:"rdataSRV,omitempty"`
+}
+
+var jsonClassNames = map[Class]string{
+	ClassINET:   "IN",
+	ClassCSNET:  "CS",
+	ClassCHAOS:  "CH",
+	ClassHESIOD: "HS",
+	ClassANY:    "ANY",
+}
+
+// jsonTypeName returns the mnemonic of t, such as "AAAA", or "" if
+// unknown.
+func jsonTypeName(t Type) string {
+	if n, ok := typeNames[t]; ok {
+		return strings.TrimPrefix(n, "Type")
+	}
+	return ""
+}
+
+// AppendJSON appends the full Message to b in the DNS-in-JSON format of
+// RFC 8427, such as for the JSON endpoints of DNS over HTTPS, and returns
+// the extended buffer. The resources have their data in wire format in
+// RDATAHEX, and in presentation format for the types A, AAAA, NS, CNAME,
+// PTR, MX, SOA, TXT and SRV, such as in rdataA.
+func (m *Message) AppendJSON(b []byte) ([]byte, error) {
+	jm := jsonMessage{
+		ID:            m.Header.ID,
+		QR:            jsonBool(m.Header.Response),
+		Opcode:        uint16(m.Header.OpCode),
+		AA:            jsonBool(m.Header.Authoritative),
+		TC:            jsonBool(m.Header.Truncated),
+		RD:            jsonBool(m.Header.RecursionDesired),
+		RA:            jsonBool(m.Header.RecursionAvailable),
+		AD:            jsonBool(m.Header.AuthenticData),
+		CD:            jsonBool(m.Header.CheckingDisabled),
+		RCODE:         uint16(m.Header.RCode),
+		QDCOUNT:       len(m.Questions),
+		ANCOUNT:       len(m.Answers),
+		NSCOUNT:       len(m.Authorities),
+		ARCOUNT:       len(m.Additionals),
+		QuestionRRs:   make([]jsonQuestion, 0, len(m.Questions)),
+		AnswerRRs:     make([]jsonResource, 0, len(m.Answers)),
+		AuthorityRRs:  make([]jsonResource, 0, len(m.Authorities)),
+		AdditionalRRs: make([]jsonResource, 0, len(m.Additionals)),
+	}
+	for _, q := range m.Questions {
+		jm.QuestionRRs = append(jm.QuestionRRs, jsonQuestion{
+			NAME:      q.Name.String(),
+			TYPE:      uint16(q.Type),
+			TYPEname:  jsonTypeName(q.Type),
+			CLASS:     uint16(q.Class),
+			CLASSname: jsonClassNames[q.Class],
+		})
+	}
+	for _, s := range []struct {
+		rs  []Resource
+		jrs *[]jsonResource
+	}{
+		{m.Answers, &jm.AnswerRRs},
+		{m.Authorities, &jm.AuthorityRRs},
+		{m.Additionals, &jm.AdditionalRRs},
+	} {
+		for _, r := range s.rs {
+			jr, err := makeJSONResource(r)
+			if err != nil {
+				return nil, err
+			}
+			*s.jrs = append(*s.jrs, jr)
+		}
+	}
+	js, err := json.Marshal(jm)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, js...), nil
+}
+
+func makeJSONResource(r Resource) (jsonResource, error) {
+	if r.Body == nil {
+		return jsonResource{}, errNilResouceBody
+	}
+	rdata, err := r.Body.pack(nil, nil, 0)
+	if err != nil {
+		return jsonResource{}, &nestedError{r.Header.Type.String() + " record", err}
+	}
+	typ := r.Body.realType()
+	jr := jsonResource{
+		NAME:      r.Header.Name.String(),
+		TYPE:      uint16(typ),
+		TYPEname:  jsonTypeName(typ),
+		CLASS:     uint16(r.Header.Class),
+		CLASSname: jsonClassNames[r.Header.Class],
+		TTL:       r.Header.TTL,
+		RDLENGTH:  len(rdata),
+		RDATAHEX:  strings.ToUpper(hex.EncodeToString(rdata)),
+	}
+	u16 := func(v uint16) string { return strconv.FormatUint(uint64(v), 10) }
+	u32 := func(v uint32) string { return strconv.FormatUint(uint64(v), 10) }
+	switch b := r.Body.(type) {
+	case *AResource:
+		jr.RdataA = formatIPv4(b.A)
+	case *AAAAResource:
+		jr.RdataAAAA = formatIPv6(b.AAAA)
+	case *NSResource:
+		jr.RdataNS = b.NS.String()
+	case *CNAMEResource:
+		jr.RdataCNAME = b.CNAME.String()
+	case *PTRResource:
+		jr.RdataPTR = b.PTR.String()
+	case *MXResource:
+		jr.RdataMX = u16(b.Pref) + " " + b.MX.String()
+	case *SOAResource:
+		jr.RdataSOA = strings.Join([]string{
+			b.NS.String(), b.MBox.String(), u32(b.Serial), u32(b.Refresh),
+			u32(b.Retry), u32(b.Expire), u32(b.MinTTL),
+		}, " ")
+	case *TXTResource:
+		txt := make([]string, len(b.TXT))
+		for i, s := range b.TXT {
+			txt[i] = quoteCharacterString(s)
+		}
+		jr.RdataTXT = strings.Join(txt, " ")
+	case *SRVResource:
+		jr.RdataSRV = u16(b.Priority) + " " + u16(b.Weight) + " " + u16(b.Port) + " " + b.Target.String()
+	}
+	return jr, nil
+}
+
+// UnpackJSON parses a full Message in the DNS-in-JSON format of RFC
+// 8427, as written by AppendJSON. A message given in messageOctetsHEX is
+// unpacked from it,
+// and the other members are ignored. Otherwise, the question of a
+// message may be given with QNAME, QTYPE and QCLASS, instead of
+// questionRRs. The data of a resource are taken from its RDATAHEX,
+// or, without it, from its presentation format for the types A, NS,
+// CNAME, PTR and MX.
+func (m *Message) UnpackJSON(b []byte) error {
+	var jm jsonMessage
+	if err := json.Unmarshal(b, &jm); err != nil {
+		return err
+	}
+	if jm.MessageOctetsHEX != "" {
+		msg, err := hex.DecodeString(jm.MessageOctetsHEX)
+		if err != nil {
+			return err
+		}
+		return m.Unpack(msg)
+	}
+	nm := Message{Header: Header{
+		ID:                 jm.ID,
+		Response:           bool(jm.QR),
+		OpCode:             OpCode(jm.Opcode),
+		Authoritative:      bool(jm.AA),
+		Truncated:          bool(jm.TC),
+		RecursionDesired:   bool(jm.RD),
+		RecursionAvailable: bool(jm.RA),
+		AuthenticData:      bool(jm.AD),
+		CheckingDisabled:   bool(jm.CD),
+		RCode:              RCode(jm.RCODE),
+	}}
+	if len(jm.QuestionRRs) == 0 && jm.QNAME != "" {
+		q := jsonQuestion{NAME: jm.QNAME, TYPE: uint16(TypeA), CLASS: uint16(ClassINET)}
+		if jm.QTYPE != nil {
+			q.TYPE = *jm.QTYPE
+		}
+		if jm.QCLASS != nil {
+			q.CLASS = *jm.QCLASS
+		}
+		jm.QuestionRRs = []jsonQuestion{q}
+	}
+	for _, jq := range jm.QuestionRRs {
+		n, err := jsonName(jq.NAME)
+		if err != nil {
+			return err
+		}
+		nm.Questions = append(nm.Questions, Question{Name: n, Type: Type(jq.TYPE), Class: Class(jq.CLASS)})
+	}
+	for _, s := range []struct {
+		jrs []jsonResource
+		rs  *[]Resource
+	}{
+		{jm.AnswerRRs, &nm.Answers},
+		{jm.AuthorityRRs, &nm.Authorities},
+		{jm.AdditionalRRs, &nm.Additionals},
+	} {
+		for _, jr := range s.jrs {
+			r, err := jr.resource()
+			if err != nil {
+				return err
+			}
+			*s.rs = append(*s.rs, r)
+		}
+	}
+	*m = nm
+	return nil
+}
+
+func (jr *jsonResource) resource() (Resource, error) {
+	n, err := jsonName(jr.NAME)
+	if err != nil {
+		return Resource{}, err
+	}
+	r := Resource{Header: ResourceHeader{
+		Name:  n,
+		Type:  Type(jr.TYPE),
+		Class: Class(jr.CLASS),
+		TTL:   jr.TTL,
+	}}
+	if jr.RDATAHEX != "" || jr.RDLENGTH == 0 && jr.rdataPresentation() == "" {
+		rdata, err := hex.DecodeString(jr.RDATAHEX)
+		if err != nil {
+			return Resource{}, err
+		}
+		if len(rdata) > 0xffff {
+			return Resource{}, errResTooLong
+		}
+		h := r.Header
+		h.Length = uint16(len(rdata))
+		if r.Body, _, err = unpackResourceBody(rdata, 0, h); err != nil {
+			return Resource{}, err
+		}
+		return r, nil
+	}
+	switch r.Header.Type {
+	case TypeA:
+		a, ok := parseIPv4(jr.RdataA)
+		if !ok {
+			return Resource{}, errJSONRData
+		}
+		r.Body = &AResource{a}
+	case TypeNS:
+		n, err := jsonName(jr.RdataNS)
+		if err != nil {
+			return Resource{}, err
+		}
+		r.Body = &NSResource{n}
+	case TypeCNAME:
+		n, err := jsonName(jr.RdataCNAME)
+		if err != nil {
+			return Resource{}, err
+		}
+		r.Body = &CNAMEResource{n}
+	case TypePTR:
+		n, err := jsonName(jr.RdataPTR)
+		if err != nil {
+			return Resource{}, err
+		}
+		r.Body = &PTRResource{n}
+	case TypeMX:
+		f := strings.Fields(jr.RdataMX)
+		if len(f) != 2 {
+			return Resource{}, errJSONRData
+		}
+		pref, err := strconv.ParseUint(f[0], 10, 16)
+		if err != nil {
+			return Resource{}, errJSONRData
+		}
+		n, err := jsonName(f[1])
+		if err != nil {
+			return Resource{}, err
+		}
+		r.Body = &MXResource{uint16(pref), n}
+	default:
+		return Resource{}, errJSONNoRData
+	}
+	return r, nil
+}
+
+// rdataPresentation returns the presentation format of the data of jr, if
+// any.
+func (jr *jsonResource) rdataPresentation() string {
+	return jr.RdataA + jr.RdataAAAA + jr.RdataNS + jr.RdataCNAME + jr.RdataPTR +
+		jr.RdataMX + jr.RdataSOA + jr.RdataTXT + jr.RdataSRV
+}
+
+// jsonName returns the Name of s, fully qualified.
+func jsonName(s string) (Name, error) {
+	if !strings.HasSuffix(s, ".") {
+		s += "."
+	}
+	return NewName(s)
+}
+
+func formatIPv4(a [4]byte) string {
+	return strconv.Itoa(int(a[0])) + "." + strconv.Itoa(int(a[1])) + "." +
+		strconv.Itoa(int(a[2])) + "." + strconv.Itoa(int(a[3]))
+}
+
+func parseIPv4(s string) ([4]byte, bool) {
+	var a [4]byte
+	f := strings.Split(s, ".")
+	if len(f) != 4 {
+		return a, false
+	}
+	for i, v := range f {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return a, false
+		}
+		a[i] = byte(n)
+	}
+	return a, true
+}
+
+// formatIPv6 formats a as RFC 5952 recommends: the longest run of two
+// zero fields or more, the first if several, is replaced by "::".
+func formatIPv6(a [16]byte) string {
+	var f [8]uint16
+	for i := range f {
+		f[i] = uint16(a[2*i])<<8 | uint16(a[2*i+1])
+	}
+	start, n := -1, 1
+	for i := 0; i < 8; {
+		if f[i] != 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < 8 && f[j] == 0 {
+			j++
+		}
+		if j-i > n {
+			start, n = i, j-i
+		}
+		i = j
+	}
+	var b strings.Builder
+	for i := 0; i < 8; i++ {
+		if i == start {
+			b.WriteString("::")
+			i += n - 1
+			continue
+		}
+		if i > 0 && i != start+n {
+			b.WriteByte(':')
+		}
+		b.WriteString(strconv.FormatUint(uint64(f[i]), 16))
+	}
+	return b.String()
+}
+
+// quoteCharacterString returns s as a quoted character string of the
+// presentation format of RFC 1035, Section 5.1.
+func quoteCharacterString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			b.WriteByte('\\')
+			b.WriteByte('0' + c/100)
+			b.WriteByte('0' + c/10%10)
+			b.WriteByte('0' + c%10)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
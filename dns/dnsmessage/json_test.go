@@ -0,0 +1,129 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageJSON(t *testing.T) {
+	name := MustNewName("example.com.")
+	m := Message{
+		Header:    Header{ID: 0xabcd, Response: true, RecursionDesired: true, RecursionAvailable: true},
+		Questions: []Question{{Name: name, Type: TypeA, Class: ClassINET}},
+		Answers: []Resource{
+			{ResourceHeader{Name: name, Type: TypeA, Class: ClassINET, TTL: 300}, &AResource{[4]byte{192, 0, 2, 1}}},
+			{ResourceHeader{Name: name, Type: TypeAAAA, Class: ClassINET, TTL: 300}, &AAAAResource{[16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}},
+			{ResourceHeader{Name: name, Type: TypeMX, Class: ClassINET, TTL: 60}, &MXResource{10, MustNewName("mx.example.com.")}},
+			{ResourceHeader{Name: name, Type: TypeTXT, Class: ClassINET, TTL: 60}, &TXTResource{[]string{`say "hi"`, "\x00"}}},
+		},
+		Authorities: []Resource{
+			{
+				ResourceHeader{Name: name, Type: TypeSOA, Class: ClassINET, TTL: 3600},
+				&SOAResource{NS: name, MBox: name, Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinTTL: 5},
+			},
+		},
+		Additionals: []Resource{
+			{mustEDNS0ResourceHeader(1232, RCodeSuccess, true), &OPTResource{}},
+		},
+	}
+	b, err := m.AppendJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"ID":43981`,
+		`"QR":true`,
+		`"ANCOUNT":4`,
+		`"TYPEname":"AAAA"`,
+		`"CLASSname":"IN"`,
+		`"RDATAHEX":"C0000201"`,
+		`"rdataA":"192.0.2.1"`,
+		`"rdataAAAA":"2001:db8::1"`,
+		`"rdataMX":"10 mx.example.com."`,
+		`"rdataTXT":"\"say \\\"hi\\\"\" \"\\000\""`,
+		`"rdataSOA":"example.com. example.com. 1 2 3 4 5"`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("m.AppendJSON(nil) = %s; want it to contain %s", b, want)
+		}
+	}
+
+	var got Message
+	if err := got.UnpackJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	// The types of the headers are set by packing.
+	want, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotPacked, err := got.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotPacked, want) {
+		t.Errorf("round trip of %s:\ngot  %#v\nwant %#v", b, got, m)
+	}
+
+	var octets Message
+	if err := octets.UnpackJSON([]byte(`{"messageOctetsHEX":"` + hex.EncodeToString(want) + `"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(octets.Answers) != 4 || octets.Header.ID != 0xabcd {
+		t.Errorf("messageOctetsHEX unpacked to %#v", octets)
+	}
+
+	prefix := []byte("prefix")
+	if b, err := m.AppendJSON(prefix); err != nil || !strings.HasPrefix(string(b), "prefix{") {
+		t.Errorf("m.AppendJSON(%q) = %s, %v; want it appended to the prefix", prefix, b, err)
+	}
+}
+
+func TestMessageUnpackJSONPresentation(t *testing.T) {
+	// RFC 8427, Section 5.1, with the presentation format of the answer.
+	const js = `{
+		"ID": 32784, "QR": 1, "Opcode": 0, "AA": 1, "TC": 0, "RD": 0,
+		"RA": 0, "AD": 0, "CD": 0, "RCODE": 0,
+		"QDCOUNT": 1, "ANCOUNT": 1, "NSCOUNT": 0, "ARCOUNT": 0,
+		"QNAME": "example.com", "QTYPE": 1, "QCLASS": 1,
+		"answerRRs": [{"NAME": "example.com.", "TYPE": 1, "CLASS": 1,
+			"TTL": 3600, "rdataA": "192.0.2.1"}]
+	}`
+	var m Message
+	if err := m.UnpackJSON([]byte(js)); err != nil {
+		t.Fatal(err)
+	}
+	if m.Header.ID != 32784 || !m.Header.Authoritative {
+		t.Errorf("Header = %#v", m.Header)
+	}
+	if want := (Question{Name: MustNewName("example.com."), Type: TypeA, Class: ClassINET}); len(m.Questions) != 1 || m.Questions[0] != want {
+		t.Errorf("Questions = %#v; want %#v", m.Questions, want)
+	}
+	if len(m.Answers) != 1 || !reflect.DeepEqual(m.Answers[0].Body, &AResource{[4]byte{192, 0, 2, 1}}) {
+		t.Errorf("Answers = %#v", m.Answers)
+	}
+}
+
+func TestFormatIPv6(t *testing.T) {
+	for _, tt := range []struct {
+		a    [16]byte
+		want string
+	}{
+		{[16]byte{}, "::"},
+		{[16]byte{15: 1}, "::1"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}, "2001:db8::1"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1}, "2001:db8:0:1:1:1:1:1"},
+		{[16]byte{0x20, 0x01, 0x0d, 0xb8, 7: 1, 15: 1}, "2001:db8:0:1::1"},
+		{[16]byte{0: 0xfe, 1: 0x80}, "fe80::"},
+	} {
+		if got := formatIPv6(tt.a); got != tt.want {
+			t.Errorf("formatIPv6(%v) = %q; want %q", tt.a, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+// Limits bounds the resources spent by a Parser on a message, for
+// servers parsing untrusted messages. The zero value of each field means
+// no limit beyond those always enforced.
+type Limits struct {
+	// MaxQuestions, MaxAnswers, MaxAuthorities and MaxAdditionals
+	// limit the number of records of each section.
+	MaxQuestions   int
+	MaxAnswers     int
+	MaxAuthorities int
+	MaxAdditionals int
+
+	// MaxPointers limits the number of compression pointers followed
+	// to parse a name, which is never more than 10.
+	MaxPointers int
+
+	// MaxWork limits the total number of bytes parsed, counting the
+	// bytes of names reached through compression pointers each time
+	// they are read.
+	MaxWork int
+}
+
+// A LimitError is returned when a message exceeds the Limits of a
+// Parser.
+type LimitError struct {
+	Limit string // name of the Limits field, such as "MaxAnswers"
+}
+
+func (e *LimitError) Error() string {
+	return "message exceeds parser limit " + e.Limit
+}
+
+// StartWithLimits is like Start, but it makes the Parser enforce l on
+// the message, and parse it strictly: compression pointers must point
+// backwards, and the names of resource bodies must end within the
+// body. Limits are checked as the message is parsed, except those on the
+// number of records, checked by StartWithLimits. A later call to Start
+// removes the limits.
+func (p *Parser) StartWithLimits(msg []byte, l Limits) (Header, error) {
+	h, err := p.Start(msg)
+	if err != nil {
+		return h, err
+	}
+	for _, c := range []struct {
+		count uint16
+		max   int
+		limit string
+	}{
+		{p.header.questions, l.MaxQuestions, "MaxQuestions"},
+		{p.header.answers, l.MaxAnswers, "MaxAnswers"},
+		{p.header.authorities, l.MaxAuthorities, "MaxAuthorities"},
+		{p.header.additionals, l.MaxAdditionals, "MaxAdditionals"},
+	} {
+		if c.max > 0 && int(c.count) > c.max {
+			*p = Parser{}
+			return Header{}, &LimitError{c.limit}
+		}
+	}
+	p.limits = &l
+	p.work = headerLen
+	if err := p.spend(0); err != nil {
+		*p = Parser{}
+		return Header{}, err
+	}
+	return h, nil
+}
+
+// spend accounts for n more bytes parsed.
+func (p *Parser) spend(n int) error {
+	p.work += n
+	if p.limits.MaxWork > 0 && p.work > p.limits.MaxWork {
+		return &LimitError{"MaxWork"}
+	}
+	return nil
+}
+
+// checkQuestion checks the Question at p.off against p.limits.
+func (p *Parser) checkQuestion() error {
+	if _, err := p.checkName(p.off, len(p.msg), false); err != nil {
+		return nestLimitCheck("checking Question.Name", err)
+	}
+	return p.spend(uint16Len + uint16Len)
+}
+
+// checkResource checks the resource at p.off against p.limits,
+// including the names of its body.
+func (p *Parser) checkResource() error {
+	off, err := p.checkName(p.off, len(p.msg), false)
+	if err != nil {
+		return nestLimitCheck("checking ResourceHeader.Name", err)
+	}
+	typ, _, err := unpackType(p.msg, off)
+	if err != nil {
+		return nil // Reported by ResourceHeader.unpack.
+	}
+	length, body, err := unpackUint16(p.msg, off+uint16Len+uint16Len+uint32Len)
+	if err != nil {
+		return nil
+	}
+	end := body + int(length)
+	if end > len(p.msg) {
+		return errResourceLen
+	}
+	if err := p.spend(uint16Len + uint16Len + uint32Len + uint16Len + int(length)); err != nil {
+		return err
+	}
+	switch typ {
+	case TypeNS, TypeCNAME, TypePTR:
+		_, err = p.checkName(body, end, true)
+	case TypeMX:
+		_, err = p.checkName(body+uint16Len, end, true)
+	case TypeSRV:
+		_, err = p.checkName(body+3*uint16Len, end, true)
+	case TypeSOA:
+		if off, err = p.checkName(body, end, true); err == nil {
+			_, err = p.checkName(off, end, true)
+		}
+	}
+	if err != nil {
+		return nestLimitCheck("checking "+typ.String()+" resource name", err)
+	}
+	return nil
+}
+
+// nestLimitCheck wraps the error of a check, unless it is a LimitError,
+// which is returned as is.
+func nestLimitCheck(s string, err error) error {
+	if _, ok := err.(*LimitError); ok {
+		return err
+	}
+	return &nestedError{s, err}
+}
+
+// checkName checks the name at off, which must end by end, against
+// p.limits, and returns the offset after it. The work spent on the name
+// is accounted for, except for the bytes at off of a name in a resource
+// body, accounted for with the body.
+func (p *Parser) checkName(off, end int, inBody bool) (int, error) {
+	maxPtr := p.limits.MaxPointers
+	if maxPtr <= 0 || maxPtr > 10 {
+		maxPtr = 10
+	}
+	// start is the offset of the labels being read, which pointers
+	// must point before.
+	start := off
+	curr := off
+	newOff := -1
+	var ptr, work int
+	defer func() { p.work += work }()
+	for {
+		if curr >= end || curr >= len(p.msg) {
+			return off, errBaseLen
+		}
+		c := int(p.msg[curr])
+		curr++
+		work++
+		switch c & 0xC0 {
+		case 0x00:
+			if c == 0x00 {
+				if newOff < 0 {
+					newOff = curr
+				}
+				if inBody {
+					work -= newOff - off
+				}
+				if p.limits.MaxWork > 0 && p.work+work > p.limits.MaxWork {
+					return off, &LimitError{"MaxWork"}
+				}
+				return newOff, nil
+			}
+			curr += c
+			work += c
+		case 0xC0:
+			if curr >= end || curr >= len(p.msg) {
+				return off, errInvalidPtr
+			}
+			target := (c^0xC0)<<8 | int(p.msg[curr])
+			curr++
+			work++
+			if newOff < 0 {
+				newOff = curr
+				// Labels reached through pointers may lie outside
+				// the resource body.
+				end = len(p.msg)
+			}
+			if ptr++; ptr > maxPtr {
+				return off, &LimitError{"MaxPointers"}
+			}
+			if target >= start {
+				return off, errInvalidPtr
+			}
+			start, curr = target, target
+		default:
+			return off, errReserved
+		}
+	}
+}
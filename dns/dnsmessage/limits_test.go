@@ -0,0 +1,119 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import "testing"
+
+func limitsTestMessage(t *testing.T) []byte {
+	t.Helper()
+	m := Message{
+		Header: Header{Response: true},
+		Questions: []Question{
+			{Name: MustNewName("example.com."), Type: TypeCNAME, Class: ClassINET},
+		},
+		Answers: []Resource{
+			{
+				Header: ResourceHeader{Name: MustNewName("example.com."), Type: TypeCNAME, Class: ClassINET},
+				Body:   &CNAMEResource{MustNewName("www.example.com.")},
+			},
+			{
+				Header: ResourceHeader{Name: MustNewName("www.example.com."), Type: TypeCNAME, Class: ClassINET},
+				Body:   &CNAMEResource{MustNewName("x.www.example.com.")},
+			},
+		},
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compress the last name to "x" and a pointer to the name of the
+	// last resource, itself a pointer to the body of the first one.
+	body := len(b) - len("x.www.example.com.") - 1
+	if b[body+1] != 'x' || b[body-12] != 0xc0 {
+		t.Fatalf("unexpected packing: % x", b)
+	}
+	b = append(b[:body], 1, 'x', 0xc0, byte(body-12))
+	b[body-1] = 4
+	return b
+}
+
+// parseAll parses all the records of msg, with the limits l if non-nil.
+func parseAll(msg []byte, l *Limits) error {
+	var p Parser
+	var err error
+	if l != nil {
+		_, err = p.StartWithLimits(msg, *l)
+	} else {
+		_, err = p.Start(msg)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := p.AllQuestions(); err != nil {
+		return err
+	}
+	if _, err := p.AllAnswers(); err != nil {
+		return err
+	}
+	if _, err := p.AllAuthorities(); err != nil {
+		return err
+	}
+	_, err = p.AllAdditionals()
+	return err
+}
+
+func TestParserLimits(t *testing.T) {
+	msg := limitsTestMessage(t)
+	if err := parseAll(msg, &Limits{MaxQuestions: 1, MaxAnswers: 2, MaxPointers: 2, MaxWork: 2 * len(msg)}); err != nil {
+		t.Fatalf("within the limits: %v", err)
+	}
+	for _, tt := range []struct {
+		l     Limits
+		limit string
+	}{
+		{Limits{MaxAnswers: 1}, "MaxAnswers"},
+		{Limits{MaxPointers: 1}, "MaxPointers"},
+		{Limits{MaxWork: len(msg)}, "MaxWork"},
+		{Limits{MaxWork: headerLen + 4}, "MaxWork"},
+	} {
+		err := parseAll(msg, &tt.l)
+		if le, ok := err.(*LimitError); !ok || le.Limit != tt.limit {
+			t.Errorf("%+v: got %v; want LimitError for %s", tt.l, err, tt.limit)
+		}
+	}
+}
+
+func TestParserLimitsStrict(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		msg  []byte
+	}{
+		{
+			"forward pointer",
+			[]byte{
+				0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+				0xc0, 18, // name at 18
+				0, 1, 0, 1,
+				1, 'a', 0,
+			},
+		},
+		{
+			"name beyond the body",
+			[]byte{
+				0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0,
+				0,                            // root
+				0, 5, 0, 1, 0, 0, 0, 0, 0, 1, // CNAME of length 1
+				1, 'a', 0,
+			},
+		},
+	} {
+		if err := parseAll(tt.msg, nil); err != nil {
+			t.Errorf("%s: parsing without limits: %v", tt.name, err)
+		}
+		if err := parseAll(tt.msg, &Limits{}); err == nil {
+			t.Errorf("%s: parsing with limits succeeded", tt.name)
+		}
+	}
+}
@@ -255,6 +255,11 @@ var (
 	// parsed or finished.
 	ErrSectionDone = errors.New("parsing/packing of this section has completed")
 
+	// ErrBufTooSmall indicates that the buffer of a Builder created by
+	// NewFixedBuilder is too small for the next record, which was not
+	// added.
+	ErrBufTooSmall = errors.New("insufficient space in the builder buffer")
+
 	errBaseLen            = errors.New("insufficient data for base length type")
 	errCalcLen            = errors.New("insufficient data for calculated length type")
 	errReserved           = errors.New("segment prefix is reserved")
@@ -542,6 +547,9 @@ type Parser struct {
 	index          int
 	resHeaderValid bool
 	resHeader      ResourceHeader
+
+	limits *Limits // set by StartWithLimits
+	work   int     // bytes parsed, if limits is set
 }
 
 // Start parses the header and enables the parsing of Questions.
@@ -597,6 +605,11 @@ func (p *Parser) resourceHeader(sec section) (ResourceHeader, error) {
 	if err := p.checkAdvance(sec); err != nil {
 		return ResourceHeader{}, err
 	}
+	if p.limits != nil {
+		if err := p.checkResource(); err != nil {
+			return ResourceHeader{}, err
+		}
+	}
 	var hdr ResourceHeader
 	off, err := hdr.unpack(p.msg, p.off)
 	if err != nil {
@@ -622,6 +635,11 @@ func (p *Parser) skipResource(sec section) error {
 	if err := p.checkAdvance(sec); err != nil {
 		return err
 	}
+	if p.limits != nil {
+		if err := p.checkResource(); err != nil {
+			return err
+		}
+	}
 	var err error
 	p.off, err = skipResource(p.msg, p.off)
 	if err != nil {
@@ -636,6 +654,11 @@ func (p *Parser) Question() (Question, error) {
 	if err := p.checkAdvance(sectionQuestions); err != nil {
 		return Question{}, err
 	}
+	if p.limits != nil {
+		if err := p.checkQuestion(); err != nil {
+			return Question{}, err
+		}
+	}
 	var name Name
 	off, err := name.unpack(p.msg, p.off)
 	if err != nil {
@@ -680,6 +703,11 @@ func (p *Parser) SkipQuestion() error {
 	if err := p.checkAdvance(sectionQuestions); err != nil {
 		return err
 	}
+	if p.limits != nil {
+		if err := p.checkQuestion(); err != nil {
+			return err
+		}
+	}
 	off, err := skipName(p.msg, p.off)
 	if err != nil {
 		return &nestedError{"skipping Question Name", err}
@@ -1211,6 +1239,9 @@ type Builder struct {
 	// compression is a mapping from name suffixes to their starting index
 	// in msg.
 	compression map[string]int
+
+	// fixed is whether msg must not grow beyond its capacity.
+	fixed bool
 }
 
 // NewBuilder creates a new builder with compression disabled.
@@ -1332,6 +1363,9 @@ func (b *Builder) Question(q Question) error {
 	if err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1366,6 +1400,9 @@ func (b *Builder) CNAMEResource(h ResourceHeader, r CNAMEResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1390,6 +1427,9 @@ func (b *Builder) MXResource(h ResourceHeader, r MXResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1414,6 +1454,9 @@ func (b *Builder) NSResource(h ResourceHeader, r NSResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1438,6 +1481,9 @@ func (b *Builder) PTRResource(h ResourceHeader, r PTRResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1462,6 +1508,9 @@ func (b *Builder) SOAResource(h ResourceHeader, r SOAResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1486,6 +1535,9 @@ func (b *Builder) TXTResource(h ResourceHeader, r TXTResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1510,6 +1562,9 @@ func (b *Builder) SRVResource(h ResourceHeader, r SRVResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1534,6 +1589,9 @@ func (b *Builder) AResource(h ResourceHeader, r AResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1558,6 +1616,9 @@ func (b *Builder) AAAAResource(h ResourceHeader, r AAAAResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1582,6 +1643,9 @@ func (b *Builder) OPTResource(h ResourceHeader, r OPTResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -1606,6 +1670,9 @@ func (b *Builder) UnknownResource(h ResourceHeader, r UnknownResource) error {
 	if err := h.fixLen(msg, lenOff, preLen); err != nil {
 		return err
 	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
 	if err := b.incrementSectionCount(); err != nil {
 		return err
 	}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+// OptionCodePadding is the code of the EDNS(0) Padding option of RFC 7830,
+// whose data are zero bytes padding the message.
+const OptionCodePadding uint16 = 12
+
+// The block lengths of the padding of queries and responses recommended
+// by RFC 8467 section 4.1 for the encrypted transports of DNS, such as
+// DNS over TLS (RFC 7858) and DNS over HTTPS (RFC 8484), hiding the
+// length of messages from observers.
+const (
+	QueryPaddingBlockLen    = 128
+	ResponsePaddingBlockLen = 468
+)
+
+// paddingOptionHeaderLen is the length of the code and length of a
+// Padding option.
+const paddingOptionHeaderLen = 4
+
+// PaddingLen returns the length of the data of the Padding option which,
+// added to a message of msgLen bytes, makes it a multiple of blockLen
+// bytes, the Block-Length Padding strategy of RFC 8467. It returns 0 if
+// blockLen is not positive.
+func PaddingLen(msgLen, blockLen int) int {
+	if blockLen <= 0 {
+		return 0
+	}
+	return (blockLen - (msgLen+paddingOptionHeaderLen)%blockLen) % blockLen
+}
+
+// PaddedOPTResource is like OPTResource, but it adds a Padding option to
+// the options of r, replacing any, so that the message is a multiple of
+// blockLen bytes, which is QueryPaddingBlockLen for queries and
+// ResponsePaddingBlockLen for responses as RFC 8467 recommends. As RFC
+// 7830 requires, a response should be padded only if its query is.
+//
+// The OPT record must be the last record of the message for the padding
+// to account for all of it.
+func (b *Builder) PaddedOPTResource(h ResourceHeader, r OPTResource, blockLen int) error {
+	if err := b.checkResourceSection(); err != nil {
+		return err
+	}
+	opts := make([]Option, 0, len(r.Options))
+	for _, o := range r.Options {
+		if o.Code != OptionCodePadding {
+			opts = append(opts, o)
+		}
+	}
+	r.Options = opts
+	h.Type = r.realType()
+	msg, lenOff, err := h.pack(b.msg, b.compression, b.start)
+	if err != nil {
+		return &nestedError{"ResourceHeader", err}
+	}
+	preLen := len(msg)
+	if msg, err = r.pack(msg, b.compression, b.start); err != nil {
+		return &nestedError{"OPTResource body", err}
+	}
+	n := PaddingLen(len(msg)-b.start, blockLen)
+	msg = packUint16(msg, OptionCodePadding)
+	msg = packUint16(msg, uint16(n))
+	for i := 0; i < n; i++ {
+		msg = append(msg, 0)
+	}
+	if err := h.fixLen(msg, lenOff, preLen); err != nil {
+		return err
+	}
+	if err := b.checkFits(msg); err != nil {
+		return err
+	}
+	if err := b.incrementSectionCount(); err != nil {
+		return err
+	}
+	b.msg = msg
+	return nil
+}
+
+// Padded reports whether r has a Padding option, such as to pad the
+// response to a query only if the query is padded.
+func (r *OPTResource) Padded() bool {
+	for _, o := range r.Options {
+		if o.Code == OptionCodePadding {
+			return true
+		}
+	}
+	return false
+}
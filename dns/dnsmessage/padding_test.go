@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import "testing"
+
+func TestPaddingLen(t *testing.T) {
+	for _, tt := range []struct {
+		msgLen, blockLen, want int
+	}{
+		{0, 128, 124},
+		{124, 128, 0},
+		{125, 128, 127},
+		{40, 468, 424},
+		{40, 0, 0},
+		{40, -1, 0},
+	} {
+		if got := PaddingLen(tt.msgLen, tt.blockLen); got != tt.want {
+			t.Errorf("PaddingLen(%d, %d) = %d; want %d", tt.msgLen, tt.blockLen, got, tt.want)
+		}
+	}
+}
+
+func TestPaddedOPTResource(t *testing.T) {
+	for _, prefix := range []string{"", "xx"} {
+		b := NewBuilder([]byte(prefix), Header{ID: 1, RecursionDesired: true})
+		b.EnableCompression()
+		if err := b.StartQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Question(Question{Name: MustNewName("www.example.com."), Type: TypeAAAA, Class: ClassINET}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.StartAdditionals(); err != nil {
+			t.Fatal(err)
+		}
+		var rh ResourceHeader
+		if err := rh.SetEDNS0(1232, RCodeSuccess, false); err != nil {
+			t.Fatal(err)
+		}
+		r := OPTResource{Options: []Option{
+			{Code: OptionCodePadding, Data: make([]byte, 1000)},
+			{Code: 10, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}, // COOKIE
+		}}
+		if err := b.PaddedOPTResource(rh, r, QueryPaddingBlockLen); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg = msg[len(prefix):]
+		if len(msg)%QueryPaddingBlockLen != 0 {
+			t.Errorf("message of %d bytes; want a multiple of %d", len(msg), QueryPaddingBlockLen)
+		}
+
+		var p Parser
+		if _, err := p.Start(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SkipAllAuthorities(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.AdditionalHeader(); err != nil {
+			t.Fatal(err)
+		}
+		opt, err := p.OPTResource()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(opt.Options) != 2 || opt.Options[0].Code != 10 || opt.Options[1].Code != OptionCodePadding {
+			t.Fatalf("options = %#v; want the COOKIE option then the Padding option", opt.Options)
+		}
+		for _, c := range opt.Options[1].Data {
+			if c != 0 {
+				t.Fatalf("padding data %x; want zeros", opt.Options[1].Data)
+			}
+		}
+		if !opt.Padded() {
+			t.Error("Padded() = false; want true")
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// The limits of the iterations of QNAME minimization, as recommended by
+// RFC 9156, Section 2.3.
+const (
+	maxMinimiseCount = 10 // MAX_MINIMISE_COUNT
+	minimiseOneLab   = 4  // MINIMISE_ONE_LAB
+)
+
+var errNotAncestor = errors.New("zone is not an ancestor of the name")
+
+// A Minimizer holds the state of the QNAME minimization of a question,
+// defined by RFC 9156: instead of the full question, the servers of a
+// zone are asked about its child on the path to the name, adding labels
+// until the name is reached, so that they do not learn more than they
+// need to answer.
+//
+// Before the full name, the minimized questions have type A, as
+// recommended by RFC 9156, Section 2.1, and the class of the question.
+// The caller sends Question to the servers of Zone, and calls Delegate
+// on a referral, then Next on any answer but NXDOMAIN, which means that
+// the name does not exist, as RFC 8020 specifies. Once Full, the
+// response answers the question.
+type Minimizer struct {
+	q      Question
+	labels []int // offsets of the labels of q.Name
+	zone   int   // labels of the zone
+	cur    int   // labels of the current question
+	count  int   // questions asked
+}
+
+// NewMinimizer returns a Minimizer for the question q, starting from
+// zone, the closest enclosing zone of q.Name with known servers, such as
+// the root zone ".". Names are compared ignoring case.
+func NewMinimizer(q Question, zone Name) (*Minimizer, error) {
+	labels, err := nameLabels(q.Name)
+	if err != nil {
+		return nil, err
+	}
+	m := &Minimizer{q: q, labels: labels}
+	if m.zone, err = m.ancestorLabels(zone); err != nil {
+		return nil, err
+	}
+	m.cur = m.zone
+	m.step()
+	return m, nil
+}
+
+// Question returns the question to ask next.
+func (m *Minimizer) Question() Question {
+	if m.Full() {
+		return m.q
+	}
+	return Question{Name: m.suffix(m.cur), Type: TypeA, Class: m.q.Class}
+}
+
+// Full reports whether Question returns the full question.
+func (m *Minimizer) Full() bool {
+	return m.cur == len(m.labels)
+}
+
+// Zone returns the closest enclosing zone known.
+func (m *Minimizer) Zone() Name {
+	return m.suffix(m.zone)
+}
+
+// Delegate records the delegation to zone found in the response to
+// Question, whose servers are to be asked next. zone must be the name of
+// Question or one of its ancestors, below Zone.
+func (m *Minimizer) Delegate(zone Name) error {
+	n, err := m.ancestorLabels(zone)
+	if err != nil {
+		return err
+	}
+	if n < m.zone || n > m.cur {
+		return errNotAncestor
+	}
+	m.zone = n
+	return nil
+}
+
+// Next moves to the next question, adding one or more labels to the name
+// of the last one. It reports false if the last question was full.
+func (m *Minimizer) Next() bool {
+	if m.Full() {
+		return false
+	}
+	m.step()
+	return true
+}
+
+// step adds labels to the name of the current question. The first
+// MINIMISE_ONE_LAB questions add one label each, and the following ones
+// share the remaining labels so that at most MAX_MINIMISE_COUNT
+// questions are asked.
+func (m *Minimizer) step() {
+	remaining := len(m.labels) - m.cur
+	n := 1
+	if m.count >= minimiseOneLab {
+		if left := maxMinimiseCount - m.count; left > 1 {
+			if n = remaining / left; n < 1 {
+				n = 1
+			}
+		} else {
+			n = remaining
+		}
+	}
+	if n > remaining {
+		n = remaining
+	}
+	m.cur += n
+	m.count++
+}
+
+// suffix returns the ancestor of the name of the question with n labels.
+func (m *Minimizer) suffix(n int) Name {
+	if n == 0 {
+		return Name{Data: [255]byte{'.'}, Length: 1}
+	}
+	off := m.labels[len(m.labels)-n]
+	var s Name
+	s.Length = uint8(copy(s.Data[:], m.q.Name.Data[off:m.q.Name.Length]))
+	return s
+}
+
+// ancestorLabels returns the number of labels of zone, which must be the
+// name of the question or one of its ancestors.
+func (m *Minimizer) ancestorLabels(zone Name) (int, error) {
+	zl, err := nameLabels(zone)
+	if err != nil {
+		return 0, err
+	}
+	n := len(zl)
+	if n > len(m.labels) || !sameName(lowerName(zone), lowerName(m.suffix(n))) {
+		return 0, errNotAncestor
+	}
+	return n, nil
+}
+
+// nameLabels returns the offsets of the labels of the fully qualified
+// name n.
+func nameLabels(n Name) ([]int, error) {
+	if n.Length == 0 || n.Data[n.Length-1] != '.' {
+		return nil, errNonCanonicalName
+	}
+	if n.Length == 1 {
+		return nil, nil
+	}
+	var labels []int
+	start := 0
+	for i := 0; i < int(n.Length); i++ {
+		if n.Data[i] != '.' {
+			continue
+		}
+		switch {
+		case i == start:
+			return nil, errZeroSegLen
+		case i-start > 63:
+			return nil, errSegTooLong
+		}
+		labels = append(labels, start)
+		start = i + 1
+	}
+	return labels, nil
+}
+
+// RandomizeCase returns n with the case of its ASCII letters chosen at
+// random, using the random bits read from r, or crypto/rand.Reader if r
+// is nil, for the 0x20 encoding of questions: a resolver accepts only
+// the responses which repeat the name of the question with the same
+// case, which an attacker cannot guess. See VerifyCase.
+func RandomizeCase(n Name, r io.Reader) (Name, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	var bits [32]byte
+	if _, err := io.ReadFull(r, bits[:(int(n.Length)+7)/8]); err != nil {
+		return Name{}, err
+	}
+	for i := 0; i < int(n.Length); i++ {
+		c := n.Data[i] | 0x20
+		if c < 'a' || c > 'z' {
+			continue
+		}
+		if bits[i/8]&(1<<(i%8)) != 0 {
+			c &^= 0x20
+		}
+		n.Data[i] = c
+	}
+	return n, nil
+}
+
+// VerifyCase reports whether the name got, from the question of a
+// response, is the name sent, with the same case.
+func VerifyCase(sent, got Name) bool {
+	return sameName(sent, got)
+}
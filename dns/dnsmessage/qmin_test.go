@@ -0,0 +1,161 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMinimizer(t *testing.T) {
+	q := Question{Name: MustNewName("a.b.c.d.e.f.g.h.i.j.k.l.m.n.Example.COM."), Type: TypeMX, Class: ClassINET}
+	m, err := NewMinimizer(q, MustNewName("example.com."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		mq := m.Question()
+		if m.Full() {
+			if mq != q {
+				t.Errorf("full Question = %v; want %v", mq, q)
+			}
+		} else if mq.Type != TypeA || mq.Class != ClassINET {
+			t.Errorf("minimized Question = %v; want type A and class INET", mq)
+		}
+		got = append(got, mq.Name.String())
+		if !m.Next() {
+			break
+		}
+	}
+	want := []string{
+		"n.Example.COM.",
+		"m.n.Example.COM.",
+		"l.m.n.Example.COM.",
+		"k.l.m.n.Example.COM.",
+		"j.k.l.m.n.Example.COM.",
+		"i.j.k.l.m.n.Example.COM.",
+		"g.h.i.j.k.l.m.n.Example.COM.",
+		"e.f.g.h.i.j.k.l.m.n.Example.COM.",
+		"c.d.e.f.g.h.i.j.k.l.m.n.Example.COM.",
+		"a.b.c.d.e.f.g.h.i.j.k.l.m.n.Example.COM.",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("questions:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if m.Next() {
+		t.Error("Next after the full question = true")
+	}
+}
+
+func TestMinimizerDelegate(t *testing.T) {
+	q := Question{Name: MustNewName("www.example.com."), Type: TypeAAAA, Class: ClassINET}
+	m, err := NewMinimizer(q, MustNewName("."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Question().Name.String(); got != "com." {
+		t.Fatalf("Question = %s; want com.", got)
+	}
+	if err := m.Delegate(MustNewName("COM.")); err != nil {
+		t.Fatalf("Delegate(COM.) = %v", err)
+	}
+	if got := m.Zone().String(); got != "com." {
+		t.Errorf("Zone = %s; want com.", got)
+	}
+	// A delegation must be on the path of the current question.
+	for _, zone := range []string{"www.example.com.", "example.org.", "."} {
+		if err := m.Delegate(MustNewName(zone)); err == nil {
+			t.Errorf("Delegate(%s) = nil; want error", zone)
+		}
+	}
+	if !m.Next() || m.Question().Name.String() != "example.com." {
+		t.Fatalf("Question = %v; want example.com.", m.Question())
+	}
+	if !m.Next() || !m.Full() || m.Question() != q {
+		t.Fatalf("Question = %v; want %v", m.Question(), q)
+	}
+	if err := m.Delegate(MustNewName("www.example.com.")); err != nil {
+		t.Fatalf("Delegate(www.example.com.) = %v", err)
+	}
+	if got := m.Zone().String(); got != "www.example.com." {
+		t.Errorf("Zone = %s; want www.example.com.", got)
+	}
+}
+
+func TestNewMinimizerErrors(t *testing.T) {
+	tests := []struct {
+		name, zone string
+		err        error
+	}{
+		{"www.example.com", ".", errNonCanonicalName},
+		{"www.example.com.", "example.com", errNonCanonicalName},
+		{"www..com.", ".", errZeroSegLen},
+		{"www.example.com.", "example.org.", errNotAncestor},
+		{"example.com.", "www.example.com.", errNotAncestor},
+		{"www.example.com.", "ample.com.", errNotAncestor},
+	}
+	for _, tt := range tests {
+		q := Question{Name: MustNewName(tt.name), Type: TypeA, Class: ClassINET}
+		if _, err := NewMinimizer(q, MustNewName(tt.zone)); err != tt.err {
+			t.Errorf("NewMinimizer(%s, %s) = %v; want %v", tt.name, tt.zone, err, tt.err)
+		}
+	}
+
+	// The question for the zone itself is not minimized.
+	q := Question{Name: MustNewName("example.com."), Type: TypeNS, Class: ClassINET}
+	m, err := NewMinimizer(q, MustNewName("example.com."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Full() || m.Question() != q {
+		t.Errorf("Question = %v; want %v", m.Question(), q)
+	}
+}
+
+func TestRandomizeCase(t *testing.T) {
+	n := MustNewName("www.example-1.com.")
+	got, err := RandomizeCase(n, bytes.NewReader([]byte{0x55, 0x55, 0x55}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "WwW.ExAmPlE-1.CoM."; got.String() != want {
+		t.Errorf("RandomizeCase = %s; want %s", got, want)
+	}
+	if !VerifyCase(got, got) {
+		t.Errorf("VerifyCase(%s, %s) = false", got, got)
+	}
+	if VerifyCase(got, n) {
+		t.Errorf("VerifyCase(%s, %s) = true", got, n)
+	}
+	if !sameName(lowerName(got), n) {
+		t.Errorf("RandomizeCase changed %s to %s", n, got)
+	}
+
+	if _, err := RandomizeCase(n, bytes.NewReader(nil)); err == nil {
+		t.Error("RandomizeCase with no random bits succeeded")
+	}
+	if got, err := RandomizeCase(n, nil); err != nil || !sameName(lowerName(got), n) {
+		t.Errorf("RandomizeCase(%s, nil) = %s, %v", n, got, err)
+	}
+
+	// A name of the maximum length takes 32 bytes of random bits.
+	label := strings.Repeat("a", 63)
+	long := MustNewName(label + "." + label + "." + label + "." + label[:62] + ".")
+	if long.Length != 255 {
+		t.Fatalf("long name of %d bytes; want 255", long.Length)
+	}
+	if _, err := RandomizeCase(long, bytes.NewReader(make([]byte, 31))); err == nil {
+		t.Error("RandomizeCase of a 255-byte name with 31 bytes of random bits succeeded")
+	}
+	got, err = RandomizeCase(long, bytes.NewReader(bytes.Repeat([]byte{0xff}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ToUpper(long.String()); got.String() != want {
+		t.Errorf("RandomizeCase = %s; want %s", got, want)
+	}
+}
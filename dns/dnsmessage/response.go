@@ -0,0 +1,133 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+// A ZoneLookup is the result of the lookup of the questions of a query in
+// the zones of an authoritative server, from which NewResponse builds the
+// response.
+type ZoneLookup struct {
+	// InZone reports whether the questions are in a zone of the server.
+	// If not, the response is REFUSED.
+	InZone bool
+
+	// NXDomain reports that the name of the questions, or the target
+	// of the last CNAME of Answers, does not exist in the zone. The
+	// response is then NXDOMAIN.
+	NXDomain bool
+
+	// Answers are the resources of the answer section: those of the
+	// type of the questions, and the CNAME resources leading to them.
+	Answers []Resource
+
+	// SOA is the SOA resource of the zone, added to the authority
+	// section of the negative responses, NXDOMAIN or without answers,
+	// with a TTL of at most its MINIMUM field, as RFC 2308, Section 3
+	// specifies.
+	SOA Resource
+
+	// Referral lists the NS resources of the child zone the questions
+	// are delegated to, for the authority section of a referral, which
+	// is not authoritative. Its glue goes in Additionals.
+	Referral []Resource
+
+	// Additionals are the resources of the additional section.
+	Additionals []Resource
+}
+
+// NewResponse returns the response of an authoritative server to the
+// query, with the resources of the lookup l of its questions:
+//
+//   - REFUSED, as RefusedResponse, if the questions are not InZone;
+//   - a referral to a child zone if l has a Referral and no Answers;
+//   - NXDOMAIN, with SOA in the authority section, if NXDomain, after
+//     the CNAME resources of Answers, if any;
+//   - NOERROR with Answers, if any;
+//   - NOERROR without answers, with SOA in the authority section,
+//     otherwise: the name exists but has no resource of the type of
+//     the questions.
+//
+// The responses are minimal: apart from the SOA of the negative
+// responses, they only have the resources of l. The answers and the
+// negative responses are Authoritative, the referrals and REFUSED
+// responses are not. As NewResponseHeader, NewResponse copies the
+// questions of the query, however many, its ID, OpCode and its
+// RecursionDesired and CheckingDisabled bits, and does not set
+// RecursionAvailable; a server which also recurses sets it in the
+// header of the response.
+func NewResponse(query *Message, l ZoneLookup) Message {
+	if !l.InZone {
+		return RefusedResponse(query)
+	}
+	m := Message{
+		Header:      NewResponseHeader(query.Header),
+		Questions:   copyQuestions(query.Questions),
+		Answers:     l.Answers,
+		Additionals: l.Additionals,
+	}
+	if len(l.Answers) == 0 && len(l.Referral) > 0 {
+		m.Authorities = l.Referral
+		return m
+	}
+	m.Authoritative = true
+	if l.NXDomain {
+		m.RCode = RCodeNameError
+	}
+	if (l.NXDomain || len(l.Answers) == 0) && l.SOA.Body != nil {
+		m.Authorities = []Resource{negativeSOA(l.SOA)}
+	}
+	return m
+}
+
+// NewResponseHeader returns the header of a response to the query of
+// header h, with its ID, OpCode, RecursionDesired and CheckingDisabled
+// bits, as RFC 1035, Section 4.1.1 and RFC 4035, Section 3.1.6 specify,
+// and an RCode of RCodeSuccess.
+func NewResponseHeader(h Header) Header {
+	return Header{
+		ID:               h.ID,
+		Response:         true,
+		OpCode:           h.OpCode,
+		RecursionDesired: h.RecursionDesired,
+		CheckingDisabled: h.CheckingDisabled,
+	}
+}
+
+// RefusedResponse returns a REFUSED response to the query, which a server
+// sends to the queries for names for which it is not authoritative.
+func RefusedResponse(query *Message) Message {
+	return errorResponse(query, RCodeRefused)
+}
+
+// FormatErrorResponse returns a FORMERR response to the query, which a
+// server sends to the queries it cannot parse or does not support, such
+// as those with several questions.
+func FormatErrorResponse(query *Message) Message {
+	return errorResponse(query, RCodeFormatError)
+}
+
+func errorResponse(query *Message, rcode RCode) Message {
+	m := Message{
+		Header:    NewResponseHeader(query.Header),
+		Questions: copyQuestions(query.Questions),
+	}
+	m.RCode = rcode
+	return m
+}
+
+func copyQuestions(qs []Question) []Question {
+	if len(qs) == 0 {
+		return nil
+	}
+	return append([]Question(nil), qs...)
+}
+
+// negativeSOA returns the SOA resource of a negative response, whose TTL is
+// at most the MINIMUM field of the SOA, as RFC 2308, Section 3 specifies.
+func negativeSOA(soa Resource) Resource {
+	if b, ok := soa.Body.(*SOAResource); ok && b.MinTTL < soa.Header.TTL {
+		soa.Header.TTL = b.MinTTL
+	}
+	return soa
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewResponse(t *testing.T) {
+	q := Question{Name: MustNewName("www.example.com."), Type: TypeA, Class: ClassINET}
+	query := &Message{
+		Header:    Header{ID: 0x1234, RecursionDesired: true, CheckingDisabled: true},
+		Questions: []Question{q},
+	}
+	answer := Resource{
+		Header: ResourceHeader{Name: q.Name, Type: TypeA, Class: ClassINET, TTL: 300},
+		Body:   &AResource{A: [4]byte{192, 0, 2, 1}},
+	}
+	soaBody := &SOAResource{NS: MustNewName("ns.example.com."), MBox: MustNewName("admin.example.com."), MinTTL: 60}
+	soa := Resource{
+		Header: ResourceHeader{Name: MustNewName("example.com."), Type: TypeSOA, Class: ClassINET, TTL: 3600},
+		Body:   soaBody,
+	}
+	negSOA := soa
+	negSOA.Header.TTL = 60
+	ns := Resource{
+		Header: ResourceHeader{Name: MustNewName("www.example.com."), Type: TypeNS, Class: ClassINET, TTL: 3600},
+		Body:   &NSResource{NS: MustNewName("ns.www.example.com.")},
+	}
+	respHeader := func(aa bool, rcode RCode) Header {
+		return Header{ID: 0x1234, Response: true, Authoritative: aa, RecursionDesired: true, CheckingDisabled: true, RCode: rcode}
+	}
+
+	tests := []struct {
+		name string
+		l    ZoneLookup
+		want Message
+	}{{
+		name: "answer",
+		l:    ZoneLookup{InZone: true, Answers: []Resource{answer}, SOA: soa},
+		want: Message{Header: respHeader(true, RCodeSuccess), Questions: []Question{q}, Answers: []Resource{answer}},
+	}, {
+		name: "nxdomain",
+		l:    ZoneLookup{InZone: true, NXDomain: true, SOA: soa},
+		want: Message{Header: respHeader(true, RCodeNameError), Questions: []Question{q}, Authorities: []Resource{negSOA}},
+	}, {
+		name: "nodata",
+		l:    ZoneLookup{InZone: true, SOA: soa},
+		want: Message{Header: respHeader(true, RCodeSuccess), Questions: []Question{q}, Authorities: []Resource{negSOA}},
+	}, {
+		name: "referral",
+		l:    ZoneLookup{InZone: true, Referral: []Resource{ns}, SOA: soa},
+		want: Message{Header: respHeader(false, RCodeSuccess), Questions: []Question{q}, Authorities: []Resource{ns}},
+	}, {
+		name: "refused",
+		l:    ZoneLookup{Answers: []Resource{answer}},
+		want: Message{Header: respHeader(false, RCodeRefused), Questions: []Question{q}},
+	}}
+	for _, tt := range tests {
+		got := NewResponse(query, tt.l)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%#v\nwant\n%#v", tt.name, &got, &tt.want)
+		}
+		if _, err := got.Pack(); err != nil {
+			t.Errorf("%s: Pack: %v", tt.name, err)
+		}
+	}
+	if soa.Header.TTL != 3600 {
+		t.Errorf("NewResponse modified the TTL of the SOA of the lookup")
+	}
+}
+
+func TestFormatErrorResponse(t *testing.T) {
+	qs := []Question{
+		{Name: MustNewName("a.example."), Type: TypeA, Class: ClassINET},
+		{Name: MustNewName("b.example."), Type: TypeAAAA, Class: ClassINET},
+	}
+	query := &Message{Header: Header{ID: 7, OpCode: 0}, Questions: qs}
+	got := FormatErrorResponse(query)
+	want := Message{Header: Header{ID: 7, Response: true, RCode: RCodeFormatError}, Questions: qs}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", &got, &want)
+	}
+	got.Questions[0].Type = TypeMX
+	if query.Questions[0].Type != TypeA {
+		t.Errorf("the questions of the response alias those of the query")
+	}
+}
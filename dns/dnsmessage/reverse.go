@@ -0,0 +1,191 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	reverseSuffix4 = "in-addr.arpa."
+	reverseSuffix6 = "ip6.arpa."
+)
+
+var (
+	errBadIP          = errors.New("invalid IP address")
+	errBadPrefix      = errors.New("invalid IP prefix")
+	errNotReverseName = errors.New("name is not the reverse name of an address")
+)
+
+// ReverseName returns the name of the PTR records of ip: in
+// "in-addr.arpa." for IPv4 addresses, including IPv4-mapped IPv6
+// addresses, with the four octets in decimal as RFC 1035, Section 3.5
+// specifies, or in "ip6.arpa." with the 32 nibbles in hexadecimal, as RFC
+// 3596, Section 2.5 specifies, in both cases from the least significant.
+func ReverseName(ip net.IP) (Name, error) {
+	labels, err := reverseLabels(ip)
+	if err != nil {
+		return Name{}, err
+	}
+	return reverseZone(labels, len(labels) != net.IPv4len), nil
+}
+
+// ReverseIP returns the address whose reverse name is n, as returned by
+// ReverseName, ignoring case. The names of the reverse zones, with fewer
+// labels, are not the names of addresses.
+func ReverseIP(n Name) (net.IP, error) {
+	s := strings.ToLower(n.String())
+	switch {
+	case strings.HasSuffix(s, "."+reverseSuffix4):
+		labels := strings.Split(strings.TrimSuffix(s, "."+reverseSuffix4), ".")
+		if len(labels) != net.IPv4len {
+			return nil, errNotReverseName
+		}
+		ip := make(net.IP, net.IPv4len)
+		for i, l := range labels {
+			// Leading zeros would give several names to an address.
+			v, err := strconv.ParseUint(l, 10, 8)
+			if err != nil || len(l) > 1 && l[0] == '0' {
+				return nil, errNotReverseName
+			}
+			ip[len(ip)-1-i] = byte(v)
+		}
+		return ip, nil
+	case strings.HasSuffix(s, "."+reverseSuffix6):
+		labels := strings.Split(strings.TrimSuffix(s, "."+reverseSuffix6), ".")
+		if len(labels) != 2*net.IPv6len {
+			return nil, errNotReverseName
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, l := range labels {
+			v, err := strconv.ParseUint(l, 16, 4)
+			if err != nil || len(l) != 1 {
+				return nil, errNotReverseName
+			}
+			ip[len(ip)-1-i/2] |= byte(v) << (4 * (i % 2))
+		}
+		return ip, nil
+	}
+	return nil, errNotReverseName
+}
+
+// ReverseZones returns the reverse zones, in the order of their
+// addresses, which hold the names of the addresses of prefix and only
+// those. As the labels of the names of IPv4 addresses are octets and those
+// of IPv6 addresses are nibbles, they are the reverse zones of the
+// prefixes of the next length which is a multiple of 8 or 4 respectively,
+// such as the four zones of the /24 prefixes of an IPv4 /22 prefix.
+//
+// For the IPv4 prefixes longer than /24, whose addresses are in a zone
+// with others, see ClasslessReverseZone.
+func ReverseZones(prefix *net.IPNet) ([]Name, error) {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP.Mask(prefix.Mask)
+	if bits == 0 || len(ip) != bits/8 && len(ip) != net.IPv6len {
+		return nil, errBadPrefix
+	}
+	v6 := bits == 8*net.IPv6len
+	var labels []int
+	unit := 8
+	if v6 {
+		labels, unit = nibbleLabels(ip), 4
+	} else if ip = ip.To4(); ip != nil {
+		labels, _ = reverseLabels(ip)
+	} else {
+		return nil, errBadPrefix
+	}
+	n := (ones + unit - 1) / unit
+	if n == 0 {
+		return []Name{reverseZone(nil, v6)}, nil
+	}
+	// The labels are from the least significant: the zones share those
+	// after the last one of the prefix, which varies in its host bits.
+	labels = labels[len(labels)-n:]
+	zones := make([]Name, 1<<(n*unit-ones))
+	first := labels[0]
+	for i := range zones {
+		labels[0] = first + i
+		zones[i] = reverseZone(labels, v6)
+	}
+	return zones, nil
+}
+
+// ClasslessReverseZone returns the name of the zone to which the names of
+// the addresses of prefix, an IPv4 prefix from /25 to /31, are delegated
+// by the zone of the enclosing /24 prefix, as RFC 2317 describes: the
+// first address and the length of prefix, as in
+// "64/26.2.0.192.in-addr.arpa." for 192.0.2.64/26. The enclosing zone
+// holds, for each address, a CNAME record from its reverse name to the
+// name of the same first label in the classless zone.
+func ClasslessReverseZone(prefix *net.IPNet) (Name, error) {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP.Mask(prefix.Mask).To4()
+	if bits != 8*net.IPv4len || ip == nil || ones <= 24 || ones >= 32 {
+		return Name{}, errBadPrefix
+	}
+	labels, err := reverseLabels(ip)
+	if err != nil {
+		return Name{}, err
+	}
+	zone := reverseZone(labels[1:], false)
+	first := strconv.Itoa(labels[0]) + "/" + strconv.Itoa(ones) + "."
+	var n Name
+	n.Length = uint8(copy(n.Data[:], first))
+	n.Length += uint8(copy(n.Data[n.Length:], zone.Data[:zone.Length]))
+	return n, nil
+}
+
+// reverseLabels returns the values of the labels of the reverse name of
+// ip, from the least significant: the four octets of an IPv4 address, or
+// the 32 nibbles of an IPv6 address.
+func reverseLabels(ip net.IP) ([]int, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		labels := make([]int, net.IPv4len)
+		for i, b := range ip4 {
+			labels[len(labels)-1-i] = int(b)
+		}
+		return labels, nil
+	}
+	if len(ip) != net.IPv6len {
+		return nil, errBadIP
+	}
+	return nibbleLabels(ip), nil
+}
+
+// nibbleLabels returns the values of the labels of the reverse name of
+// the IPv6 address ip, from the least significant nibble.
+func nibbleLabels(ip []byte) []int {
+	labels := make([]int, 2*len(ip))
+	for i, b := range ip {
+		labels[len(labels)-1-2*i] = int(b >> 4)
+		labels[len(labels)-2-2*i] = int(b & 0xf)
+	}
+	return labels
+}
+
+// reverseZone returns the name made of labels, from the least
+// significant, in "ip6.arpa." if v6, or else in "in-addr.arpa.".
+func reverseZone(labels []int, v6 bool) Name {
+	var n Name
+	b := n.Data[:0]
+	for _, l := range labels {
+		if v6 {
+			b = strconv.AppendInt(b, int64(l), 16)
+		} else {
+			b = strconv.AppendInt(b, int64(l), 10)
+		}
+		b = append(b, '.')
+	}
+	if v6 {
+		b = append(b, reverseSuffix6...)
+	} else {
+		b = append(b, reverseSuffix4...)
+	}
+	n.Length = uint8(len(b))
+	return n
+}
@@ -0,0 +1,35 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package dnsmessage
+
+import "net/netip"
+
+// ReverseAddrName returns the name of the PTR records of addr, as
+// ReverseName does, except that IPv4-mapped IPv6 addresses are in
+// "ip6.arpa.", as they are IPv6 addresses for netip.
+func ReverseAddrName(addr netip.Addr) (Name, error) {
+	if !addr.IsValid() {
+		return Name{}, errBadIP
+	}
+	if addr.Is4() {
+		return ReverseName(addr.AsSlice())
+	}
+	a := addr.As16()
+	return reverseZone(nibbleLabels(a[:]), true), nil
+}
+
+// ReverseAddr returns the address whose reverse name is n, as ReverseIP
+// does.
+func ReverseAddr(n Name) (netip.Addr, error) {
+	ip, err := ReverseIP(n)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr, nil
+}
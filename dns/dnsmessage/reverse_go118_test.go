@@ -0,0 +1,37 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package dnsmessage
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestReverseAddrName(t *testing.T) {
+	for _, tt := range []struct {
+		addr string
+		name string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa."},
+		{"::ffff:192.0.2.1", "1.0.2.0.0.0.0.c.f.f.f.f.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa."},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	} {
+		addr := netip.MustParseAddr(tt.addr)
+		n, err := ReverseAddrName(addr)
+		if err != nil || n.String() != tt.name {
+			t.Errorf("ReverseAddrName(%v) = %v, %v; want %s", addr, n, err, tt.name)
+			continue
+		}
+		if got, err := ReverseAddr(n); err != nil || got != addr {
+			t.Errorf("ReverseAddr(%v) = %v, %v; want %v", n, got, err, addr)
+		}
+	}
+	if _, err := ReverseAddrName(netip.Addr{}); err != errBadIP {
+		t.Errorf("ReverseAddrName of the zero Addr = %v; want %v", err, errBadIP)
+	}
+}
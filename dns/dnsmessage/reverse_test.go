@@ -0,0 +1,135 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	for _, tt := range []struct {
+		ip   string
+		name string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa."},
+		{"::ffff:10.0.0.255", "255.0.0.10.in-addr.arpa."},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{"::", strings.Repeat("0.", 32) + "ip6.arpa."},
+	} {
+		n, err := ReverseName(net.ParseIP(tt.ip))
+		if err != nil || n.String() != tt.name {
+			t.Errorf("ReverseName(%s) = %v, %v; want %s", tt.ip, n, err, tt.name)
+			continue
+		}
+		ip, err := ReverseIP(n)
+		if err != nil || !ip.Equal(net.ParseIP(tt.ip)) {
+			t.Errorf("ReverseIP(%v) = %v, %v; want %s", n, ip, err, tt.ip)
+		}
+	}
+	if _, err := ReverseName(net.IP{1, 2, 3}); err != errBadIP {
+		t.Errorf("ReverseName of a 3-byte address = %v; want %v", err, errBadIP)
+	}
+}
+
+func TestReverseIP(t *testing.T) {
+	if ip, err := ReverseIP(MustNewName("1.2.0.192.IN-ADDR.Arpa.")); err != nil || !ip.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("ReverseIP of an uppercase name = %v, %v; want 192.0.2.1", ip, err)
+	}
+	for _, name := range []string{
+		"2.0.192.in-addr.arpa.",
+		"0.1.2.0.192.in-addr.arpa.",
+		"01.2.0.192.in-addr.arpa.",
+		"256.2.0.192.in-addr.arpa.",
+		"-1.2.0.192.in-addr.arpa.",
+		"1..0.192.in-addr.arpa.",
+		"1.2.0.192.in-addr.arpa",
+		"in-addr.arpa.",
+		strings.Repeat("0.", 31) + "ip6.arpa.",
+		strings.Repeat("0.", 31) + "10.ip6.arpa.",
+		strings.Repeat("0.", 31) + "g.ip6.arpa.",
+		"1.2.0.192.example.",
+	} {
+		if ip, err := ReverseIP(MustNewName(name)); err != errNotReverseName {
+			t.Errorf("ReverseIP(%s) = %v, %v; want %v", name, ip, err, errNotReverseName)
+		}
+	}
+}
+
+func TestReverseZones(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		zones  []string
+	}{
+		{"0.0.0.0/0", []string{"in-addr.arpa."}},
+		{"10.0.0.0/8", []string{"10.in-addr.arpa."}},
+		{"192.0.2.0/24", []string{"2.0.192.in-addr.arpa."}},
+		{"198.51.100.1/22", []string{
+			"100.51.198.in-addr.arpa.",
+			"101.51.198.in-addr.arpa.",
+			"102.51.198.in-addr.arpa.",
+			"103.51.198.in-addr.arpa.",
+		}},
+		{"192.0.2.64/31", []string{"64.2.0.192.in-addr.arpa.", "65.2.0.192.in-addr.arpa."}},
+		{"2001:db8::/32", []string{"8.b.d.0.1.0.0.2.ip6.arpa."}},
+		{"2001:db8::/30", []string{
+			"8.b.d.0.1.0.0.2.ip6.arpa.",
+			"9.b.d.0.1.0.0.2.ip6.arpa.",
+			"a.b.d.0.1.0.0.2.ip6.arpa.",
+			"b.b.d.0.1.0.0.2.ip6.arpa.",
+		}},
+		{"2001:db8:ab00::/39", []string{"a.a.8.b.d.0.1.0.0.2.ip6.arpa.", "b.a.8.b.d.0.1.0.0.2.ip6.arpa."}},
+		{"::/0", []string{"ip6.arpa."}},
+	} {
+		_, prefix, err := net.ParseCIDR(tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zones, err := ReverseZones(prefix)
+		if err != nil {
+			t.Errorf("ReverseZones(%s) = %v", tt.prefix, err)
+			continue
+		}
+		var got []string
+		for _, z := range zones {
+			got = append(got, z.String())
+		}
+		if strings.Join(got, " ") != strings.Join(tt.zones, " ") {
+			t.Errorf("ReverseZones(%s) = %v; want %v", tt.prefix, got, tt.zones)
+		}
+	}
+	if _, err := ReverseZones(&net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.IPMask{255, 0, 255, 0}}); err != errBadPrefix {
+		t.Errorf("ReverseZones of a non-canonical mask = %v; want %v", err, errBadPrefix)
+	}
+}
+
+func TestClasslessReverseZone(t *testing.T) {
+	for _, tt := range []struct {
+		prefix string
+		zone   string
+	}{
+		{"192.0.2.64/26", "64/26.2.0.192.in-addr.arpa."},
+		{"192.0.2.200/25", "128/25.2.0.192.in-addr.arpa."},
+		{"192.0.2.7/31", "6/31.2.0.192.in-addr.arpa."},
+	} {
+		_, prefix, err := net.ParseCIDR(tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z, err := ClasslessReverseZone(prefix); err != nil || z.String() != tt.zone {
+			t.Errorf("ClasslessReverseZone(%s) = %v, %v; want %s", tt.prefix, z, err, tt.zone)
+		}
+	}
+	for _, s := range []string{"192.0.2.0/24", "192.0.2.1/32", "2001:db8::/120"} {
+		_, prefix, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z, err := ClasslessReverseZone(prefix); err != errBadPrefix {
+			t.Errorf("ClasslessReverseZone(%s) = %v, %v; want %v", s, z, err, errBadPrefix)
+		}
+	}
+}
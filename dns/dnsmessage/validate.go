@@ -0,0 +1,155 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	// ErrNotResponse indicates that a message checked as a response
+	// does not have the response bit set.
+	ErrNotResponse = errors.New("message is not a response")
+
+	// ErrHeaderMismatch indicates that the ID or the opcode of a
+	// response differ from those of its query.
+	ErrHeaderMismatch = errors.New("response ID or opcode does not match the query")
+
+	// ErrQuestionMismatch indicates that the Question section of a
+	// response differs from that of its query.
+	ErrQuestionMismatch = errors.New("response question does not match the query")
+
+	// ErrCNAMELoop indicates that a chain of CNAME records loops.
+	ErrCNAMELoop = errors.New("CNAME chain loops")
+)
+
+// CheckResponse checks that the response with header h and questions
+// answers the query. The names of the questions are compared ignoring
+// case unless exactCase is set, which checks that a server echoed the
+// case of the names, as needed if the query randomized it ("0x20"
+// encoding).
+//
+// A resolver should drop the responses which fail the check, since they
+// may be spoofed: they do not complete the exchange with the server.
+func CheckResponse(query *Message, h Header, questions []Question, exactCase bool) error {
+	if !h.Response {
+		return ErrNotResponse
+	}
+	if h.ID != query.ID || h.OpCode != query.OpCode {
+		return ErrHeaderMismatch
+	}
+	if len(questions) != len(query.Questions) {
+		return ErrQuestionMismatch
+	}
+	for i := range questions {
+		q, r := &query.Questions[i], &questions[i]
+		if q.Type != r.Type || q.Class != r.Class {
+			return ErrQuestionMismatch
+		}
+		qn, rn := q.Name.Data[:q.Name.Length], r.Name.Data[:r.Name.Length]
+		if exactCase && !bytes.Equal(qn, rn) || !exactCase && !equalFold(qn, rn) {
+			return ErrQuestionMismatch
+		}
+	}
+	return nil
+}
+
+// InBailiwick reports whether name is zone or a subdomain of zone,
+// ignoring case. Both names must be in canonical format.
+//
+// A resolver should only accept the records about names in the
+// bailiwick of the zone of the server queried.
+func InBailiwick(name, zone Name) bool {
+	n, z := name.Data[:name.Length], zone.Data[:zone.Length]
+	if len(z) == 1 && z[0] == '.' {
+		return len(n) > 0
+	}
+	if len(n) < len(z) {
+		return false
+	}
+	if len(n) > len(z) && n[len(n)-len(z)-1] != '.' {
+		return false
+	}
+	return equalFold(n[len(n)-len(z):], z)
+}
+
+// FilterBailiwick returns the resources of rs whose name is in the
+// bailiwick of zone. It reuses the storage of rs.
+func FilterBailiwick(rs []Resource, zone Name) []Resource {
+	out := rs[:0]
+	for _, r := range rs {
+		if InBailiwick(r.Header.Name, zone) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// FollowCNAME follows the chain of CNAME records of answers starting at
+// name, and returns the name at the end of the chain and the answers of
+// type typ for it. Names are compared ignoring case. It returns
+// ErrCNAMELoop if the chain loops.
+//
+// If typ is TypeCNAME, the chain is not followed: FollowCNAME returns
+// name and its CNAME records.
+func FollowCNAME(name Name, typ Type, answers []Resource) (Name, []Resource, error) {
+	if typ != TypeCNAME {
+		var seen []Name
+	follow:
+		for {
+			for _, r := range answers {
+				if r.Header.Type != TypeCNAME || !equalNames(r.Header.Name, name) {
+					continue
+				}
+				cname, ok := r.Body.(*CNAMEResource)
+				if !ok {
+					continue
+				}
+				seen = append(seen, name)
+				for _, n := range seen {
+					if equalNames(n, cname.CNAME) {
+						return Name{}, nil, ErrCNAMELoop
+					}
+				}
+				name = cname.CNAME
+				continue follow
+			}
+			break
+		}
+	}
+	var rs []Resource
+	for _, r := range answers {
+		if r.Header.Type == typ && equalNames(r.Header.Name, name) {
+			rs = append(rs, r)
+		}
+	}
+	return name, rs, nil
+}
+
+// equalNames reports whether a and b are the same name, ignoring case.
+func equalNames(a, b Name) bool {
+	return a.Length == b.Length && equalFold(a.Data[:a.Length], b.Data[:b.Length])
+}
+
+// equalFold reports whether a and b are equal under ASCII case folding.
+func equalFold(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if 'A' <= x && x <= 'Z' {
+			x += 'a' - 'A'
+		}
+		if 'A' <= y && y <= 'Z' {
+			y += 'a' - 'A'
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsmessage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckResponse(t *testing.T) {
+	query := &Message{
+		Header: Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []Question{
+			{Name: MustNewName("wWw.ExAmple.CoM."), Type: TypeA, Class: ClassINET},
+		},
+	}
+	resp := Header{ID: 0x1234, Response: true, RecursionAvailable: true}
+	lower := []Question{{Name: MustNewName("www.example.com."), Type: TypeA, Class: ClassINET}}
+	for _, tt := range []struct {
+		name      string
+		h         Header
+		questions []Question
+		exactCase bool
+		want      error
+	}{
+		{"echoed", resp, query.Questions, true, nil},
+		{"case ignored", resp, lower, false, nil},
+		{"case changed", resp, lower, true, ErrQuestionMismatch},
+		{"query", Header{ID: 0x1234}, query.Questions, false, ErrNotResponse},
+		{"ID", Header{ID: 0x4321, Response: true}, query.Questions, false, ErrHeaderMismatch},
+		{"opcode", Header{ID: 0x1234, Response: true, OpCode: 4}, query.Questions, false, ErrHeaderMismatch},
+		{"no question", resp, nil, false, ErrQuestionMismatch},
+		{"type", resp, []Question{{Name: lower[0].Name, Type: TypeAAAA, Class: ClassINET}}, false, ErrQuestionMismatch},
+		{"name", resp, []Question{{Name: MustNewName("www.example.org."), Type: TypeA, Class: ClassINET}}, false, ErrQuestionMismatch},
+	} {
+		if err := CheckResponse(query, tt.h, tt.questions, tt.exactCase); err != tt.want {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestInBailiwick(t *testing.T) {
+	for _, tt := range []struct {
+		name, zone string
+		want       bool
+	}{
+		{"example.com.", "example.com.", true},
+		{"www.EXAMPLE.com.", "example.com.", true},
+		{"example.com.", ".", true},
+		{"com.", "example.com.", false},
+		{"badexample.com.", "example.com.", false},
+		{"example.org.", "example.com.", false},
+	} {
+		if got := InBailiwick(MustNewName(tt.name), MustNewName(tt.zone)); got != tt.want {
+			t.Errorf("InBailiwick(%q, %q) = %t; want %t", tt.name, tt.zone, got, tt.want)
+		}
+	}
+
+	rs := []Resource{
+		{Header: ResourceHeader{Name: MustNewName("ns1.example.com."), Type: TypeA, Class: ClassINET}, Body: &AResource{[4]byte{192, 0, 2, 1}}},
+		{Header: ResourceHeader{Name: MustNewName("www.victim.org."), Type: TypeA, Class: ClassINET}, Body: &AResource{[4]byte{192, 0, 2, 2}}},
+	}
+	want := rs[:1:1]
+	if got := FilterBailiwick(rs, MustNewName("example.com.")); !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterBailiwick = %#v; want %#v", got, want)
+	}
+}
+
+func TestFollowCNAME(t *testing.T) {
+	cname := func(name, target string) Resource {
+		return Resource{
+			Header: ResourceHeader{Name: MustNewName(name), Type: TypeCNAME, Class: ClassINET},
+			Body:   &CNAMEResource{MustNewName(target)},
+		}
+	}
+	a := Resource{
+		Header: ResourceHeader{Name: MustNewName("c.example.com."), Type: TypeA, Class: ClassINET},
+		Body:   &AResource{[4]byte{192, 0, 2, 1}},
+	}
+	answers := []Resource{a, cname("b.example.com.", "C.example.com."), cname("a.example.com.", "b.example.com.")}
+
+	name, rs, err := FollowCNAME(MustNewName("A.example.com."), TypeA, answers)
+	if err != nil || name.String() != "C.example.com." || !reflect.DeepEqual(rs, []Resource{a}) {
+		t.Errorf("FollowCNAME = %v, %#v, %v; want C.example.com., the A record, nil", name, rs, err)
+	}
+
+	name, rs, err = FollowCNAME(MustNewName("a.example.com."), TypeCNAME, answers)
+	if err != nil || name.String() != "a.example.com." || !reflect.DeepEqual(rs, answers[2:]) {
+		t.Errorf("FollowCNAME of TypeCNAME = %v, %#v, %v; want the CNAME record of a.example.com.", name, rs, err)
+	}
+
+	loop := []Resource{cname("a.example.com.", "b.example.com."), cname("b.example.com.", "A.example.com.")}
+	if _, _, err := FollowCNAME(MustNewName("a.example.com."), TypeA, loop); err != ErrCNAMELoop {
+		t.Errorf("FollowCNAME of a loop: got %v; want %v", err, ErrCNAMELoop)
+	}
+}
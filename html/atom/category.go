@@ -0,0 +1,80 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atom
+
+// The element categories below are those of the HTML standard, for the
+// elements of the HTML namespace, as used by the tokenizer, parser and
+// renderer of golang.org/x/net/html.
+
+// IsVoid reports whether a is a void element, such as img, which has
+// neither content nor end tag.
+// https://html.spec.whatwg.org/multipage/syntax.html#void-elements
+func IsVoid(a Atom) bool {
+	switch a {
+	case Area, Base, Br, Col, Embed, Hr, Img, Input, Keygen, Link, Meta, Param, Source, Track, Wbr:
+		// "keygen" has been removed from the spec, but is kept here for
+		// backwards compatibility.
+		return true
+	}
+	return false
+}
+
+// IsRawText reports whether the content of the element a is text which
+// is neither escaped nor parsed for elements, such as that of script. It
+// includes plaintext, whose content extends to the end of the document,
+// noscript, whose content is raw text when scripting is enabled, and the
+// elements whose content the parser of golang.org/x/net/html treats as
+// raw text, iframe, noembed and noframes.
+// https://html.spec.whatwg.org/multipage/syntax.html#raw-text-elements
+func IsRawText(a Atom) bool {
+	switch a {
+	case Iframe, Noembed, Noframes, Noscript, Plaintext, Script, Style, Xmp:
+		return true
+	}
+	return false
+}
+
+// IsEscapableRawText reports whether the content of the element a is
+// text which may contain character references but not elements: that of
+// textarea and title.
+// https://html.spec.whatwg.org/multipage/syntax.html#escapable-raw-text-elements
+func IsEscapableRawText(a Atom) bool {
+	return a == Textarea || a == Title
+}
+
+// IsFormatting reports whether a is in the formatting category of the
+// HTML parser, such as b, whose elements are reconstructed when
+// misnested.
+// https://html.spec.whatwg.org/multipage/parsing.html#formatting
+func IsFormatting(a Atom) bool {
+	switch a {
+	case A, B, Big, Code, Em, Font, I, Nobr, S, Small, Strike, Strong, Tt, U:
+		return true
+	}
+	return false
+}
+
+// IsSpecial reports whether a is in the special category of the HTML
+// parser, whose elements, such as div, have varying levels of special
+// parsing rules. The special elements of the MathML and SVG namespaces
+// are not reported.
+// https://html.spec.whatwg.org/multipage/parsing.html#special
+func IsSpecial(a Atom) bool {
+	switch a {
+	case Address, Applet, Area, Article, Aside, Base, Basefont, Bgsound,
+		Blockquote, Body, Br, Button, Caption, Center, Col, Colgroup, Dd,
+		Details, Dir, Div, Dl, Dt, Embed, Fieldset, Figcaption, Figure,
+		Footer, Form, Frame, Frameset, H1, H2, H3, H4, H5, H6, Head,
+		Header, Hgroup, Hr, Html, Iframe, Img, Input, Keygen, Li, Link,
+		Listing, Main, Marquee, Menu, Meta, Nav, Noembed, Noframes,
+		Noscript, Object, Ol, P, Param, Plaintext, Pre, Script, Section,
+		Select, Source, Style, Summary, Table, Tbody, Td, Template,
+		Textarea, Tfoot, Th, Thead, Title, Tr, Track, Ul, Wbr, Xmp:
+		// "keygen" has been removed from the spec, but is kept here for
+		// backwards compatibility.
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atom
+
+import "testing"
+
+func TestCategories(t *testing.T) {
+	testCases := []struct {
+		a                                                    Atom
+		void, rawText, escapableRawText, formatting, special bool
+	}{
+		{Br, true, false, false, false, true},
+		{Img, true, false, false, false, true},
+		{Script, false, true, false, false, true},
+		{Plaintext, false, true, false, false, true},
+		{Title, false, false, true, false, true},
+		{Textarea, false, false, true, false, true},
+		{B, false, false, false, true, false},
+		{Nobr, false, false, false, true, false},
+		{Div, false, false, false, false, true},
+		{Span, false, false, false, false, false},
+		{Href, false, false, false, false, false},
+		{0, false, false, false, false, false},
+	}
+	for _, tc := range testCases {
+		for _, c := range []struct {
+			name string
+			f    func(Atom) bool
+			want bool
+		}{
+			{"IsVoid", IsVoid, tc.void},
+			{"IsRawText", IsRawText, tc.rawText},
+			{"IsEscapableRawText", IsEscapableRawText, tc.escapableRawText},
+			{"IsFormatting", IsFormatting, tc.formatting},
+			{"IsSpecial", IsSpecial, tc.special},
+		} {
+			if got := c.f(tc.a); got != c.want {
+				t.Errorf("%s(%q) = %t, want %t", c.name, tc.a, got, c.want)
+			}
+		}
+	}
+}
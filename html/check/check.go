@@ -0,0 +1,221 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package check reports the nonconforming uses of HTML in a parsed
+// document: obsolete elements and attributes, invalid values of
+// enumerated attributes, and elements nested where the content models of
+// their ancestors do not allow them.
+//
+// The rules checked are a subset of the conformance requirements of
+// https://html.spec.whatwg.org/multipage/, for the elements of the HTML
+// namespace. Each problem reported has the Rule it violates, a stable
+// identifier for tools to filter or count them.
+package check // import "golang.org/x/net/html/check"
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// A Rule identifies a conformance requirement checked.
+type Rule string
+
+const (
+	// ObsoleteElement is violated by an element which is obsolete, such
+	// as center.
+	// https://html.spec.whatwg.org/multipage/obsolete.html#non-conforming-features
+	ObsoleteElement Rule = "obsolete-element"
+
+	// ObsoleteAttribute is violated by an attribute which is obsolete
+	// on its element, such as the bgcolor attribute of body.
+	ObsoleteAttribute Rule = "obsolete-attribute"
+
+	// InvalidAttributeValue is violated by an enumerated attribute,
+	// such as dir, whose value is none of its keywords.
+	// https://html.spec.whatwg.org/multipage/common-microsyntaxes.html#keywords-and-enumerated-attributes
+	InvalidAttributeValue Rule = "invalid-attribute-value"
+
+	// PhrasingContent is violated by an element which is not phrasing
+	// content, such as div, in an element which only accepts phrasing
+	// content, such as p or button.
+	// https://html.spec.whatwg.org/multipage/dom.html#phrasing-content
+	PhrasingContent Rule = "phrasing-content"
+
+	// InteractiveContent is violated by interactive content, such as a
+	// button, in an a or button element.
+	// https://html.spec.whatwg.org/multipage/dom.html#interactive-content
+	InteractiveContent Rule = "interactive-content"
+
+	// NestedForm is violated by a form element in another.
+	NestedForm Rule = "nested-form"
+
+	// ListItemParent is violated by an li element whose parent is neither
+	// ul, ol nor menu.
+	ListItemParent Rule = "list-item-parent"
+)
+
+// A Problem is a violation of a Rule by a node.
+type Problem struct {
+	Rule Rule
+	Node *html.Node
+
+	// Attr is the key of the attribute at fault, for ObsoleteAttribute
+	// and InvalidAttributeValue.
+	Attr string
+
+	// Message describes the problem for humans, such as
+	// "<center> is obsolete: use CSS instead".
+	Message string
+}
+
+func (p Problem) String() string {
+	return string(p.Rule) + ": " + p.Message
+}
+
+// Check returns the problems of n and its descendants, in document order.
+func Check(n *html.Node) []Problem {
+	c := &checker{}
+	c.walk(n, scope{})
+	return c.problems
+}
+
+type checker struct {
+	problems []Problem
+}
+
+// scope holds the ancestors of a node which constrain its content.
+type scope struct {
+	phrasing    *html.Node // which only accepts phrasing content
+	interactive *html.Node // a or button, not accepting interactive content
+	form        *html.Node
+}
+
+func (c *checker) report(rule Rule, n *html.Node, attr, msg string) {
+	c.problems = append(c.problems, Problem{Rule: rule, Node: n, Attr: attr, Message: msg})
+}
+
+func (c *checker) walk(n *html.Node, s scope) {
+	if n.Type == html.ElementNode {
+		if n.Namespace != "" {
+			// The content of svg and math elements is not checked.
+			return
+		}
+		s = c.element(n, s)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child, s)
+	}
+}
+
+// element checks the element n, in s, and returns the scope of its
+// children.
+func (c *checker) element(n *html.Node, s scope) scope {
+	tag := "<" + n.Data + ">"
+	if advice, ok := obsoleteElements[n.DataAtom]; ok {
+		c.report(ObsoleteElement, n, "", tag+" is obsolete: "+advice)
+	}
+	for _, a := range n.Attr {
+		if a.Namespace != "" {
+			continue
+		}
+		c.attr(n, tag, a)
+	}
+
+	if s.phrasing != nil && !isPhrasing(n) {
+		c.report(PhrasingContent, n, "", tag+" in <"+s.phrasing.Data+">, which only accepts phrasing content")
+		// Do not report the descendants of n again.
+		s.phrasing = nil
+	}
+	if s.interactive != nil && isInteractive(n) {
+		c.report(InteractiveContent, n, "", "interactive "+tag+" in <"+s.interactive.Data+">")
+	}
+	switch n.DataAtom {
+	case atom.Form:
+		if s.form != nil {
+			c.report(NestedForm, n, "", tag+" in another <form>")
+		}
+		s.form = n
+	case atom.Li:
+		if p := n.Parent; p != nil && p.Type == html.ElementNode && !(p.Namespace == "" && (p.DataAtom == atom.Ul || p.DataAtom == atom.Ol || p.DataAtom == atom.Menu)) {
+			c.report(ListItemParent, n, "", tag+" in <"+p.Data+">, not in <ul>, <ol> or <menu>")
+		}
+	case atom.A, atom.Button:
+		s.interactive = n
+	}
+	if phrasingOnly[n.DataAtom] {
+		s.phrasing = n
+	}
+	return s
+}
+
+func (c *checker) attr(n *html.Node, tag string, a html.Attribute) {
+	for _, key := range obsoleteAttrs[n.DataAtom] {
+		if a.Key == key {
+			advice, ok := obsoleteAttrAdvice[key]
+			if !ok {
+				advice = "use CSS instead"
+			}
+			c.report(ObsoleteAttribute, n, a.Key, "attribute "+a.Key+" of "+tag+" is obsolete: "+advice)
+			return
+		}
+	}
+	for _, e := range enumAttrs[a.Key] {
+		if !e.appliesTo(n.DataAtom) {
+			continue
+		}
+		if !e.valid(a.Val) {
+			c.report(InvalidAttributeValue, n, a.Key, "invalid value "+quote(a.Val)+" of attribute "+a.Key+" of "+tag+": want one of "+e.keywords())
+		}
+		return
+	}
+}
+
+// isPhrasing reports whether the element n is phrasing content.
+func isPhrasing(n *html.Node) bool {
+	if n.Namespace != "" {
+		return true
+	}
+	if n.DataAtom == 0 && strings.Contains(n.Data, "-") {
+		// An autonomous custom element.
+		return true
+	}
+	return phrasing[n.DataAtom]
+}
+
+// isInteractive reports whether the element n is interactive content.
+func isInteractive(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Button, atom.Details, atom.Embed, atom.Iframe, atom.Label, atom.Select, atom.Textarea:
+		return true
+	case atom.A:
+		return hasAttr(n, "href")
+	case atom.Audio, atom.Video:
+		return hasAttr(n, "controls")
+	case atom.Img:
+		return hasAttr(n, "usemap")
+	case atom.Input:
+		for _, a := range n.Attr {
+			if a.Namespace == "" && a.Key == "type" {
+				return !asciiEqualFold(a.Val, "hidden")
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package check
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		html string
+		want []string // rule: attr
+	}{
+		{`<p>Hello, <em>world</em>. <my-element>custom</my-element></p>`, nil},
+		{`<center>x</center><font color=red>y</font>`, []string{"obsolete-element", "obsolete-element"}},
+		{`<body bgcolor=white><table cellpadding=2><tr><td nowrap>x</td></tr></table>`, []string{
+			"obsolete-attribute: bgcolor", "obsolete-attribute: cellpadding", "obsolete-attribute: nowrap",
+		}},
+		{`<p dir=ltr>a</p><p dir=sideways>b</p><p DIR=RTL>c</p>`, []string{"invalid-attribute-value: dir"}},
+		{`<input type=text><input type=txt><button type=submit>x</button>`, []string{"invalid-attribute-value: type"}},
+		{`<ol type=A></ol><ol type=b></ol>`, []string{"invalid-attribute-value: type"}},
+		{`<button><p>x</p></button>`, []string{"phrasing-content"}},
+		{`<button><div><div>x</div></div></button>`, []string{"phrasing-content"}},
+		{`<span><svg><g></g></svg></span>`, nil},
+		{`<a href="/"><button>x</button></a><a><input type=hidden></a>`, []string{"interactive-content"}},
+		{`<div><li>x</li></div><ul><li>y</li></ul>`, []string{"list-item-parent"}},
+	} {
+		doc, err := html.Parse(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range Check(doc) {
+			s := string(p.Rule)
+			if p.Attr != "" {
+				s += ": " + p.Attr
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Check(%q):\ngot  %q\nwant %q", tt.html, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNestedForm(t *testing.T) {
+	// The parser ignores a form start tag in a form: build the tree.
+	outer := &html.Node{Type: html.ElementNode, Data: "form", DataAtom: atom.Form}
+	inner := &html.Node{Type: html.ElementNode, Data: "form", DataAtom: atom.Form}
+	outer.AppendChild(inner)
+	ps := Check(outer)
+	if len(ps) != 1 || ps[0].Rule != NestedForm || ps[0].Node != inner {
+		t.Errorf("Check = %v; want a single %s problem of the inner form", ps, NestedForm)
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<center>x</center>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := Check(doc)
+	if len(ps) != 1 {
+		t.Fatalf("Check = %v; want one problem", ps)
+	}
+	if got, want := ps[0].String(), "obsolete-element: <center> is obsolete: use CSS instead"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package check
+
+import (
+	"strings"
+
+	a "golang.org/x/net/html/atom"
+)
+
+// obsoleteElements maps the obsolete elements to the advice of the
+// standard on what to use instead.
+// https://html.spec.whatwg.org/multipage/obsolete.html#non-conforming-features
+var obsoleteElements = map[a.Atom]string{
+	a.Acronym:   "use abbr instead",
+	a.Applet:    "use embed or object instead",
+	a.Basefont:  "use CSS instead",
+	a.Bgsound:   "use audio instead",
+	a.Big:       "use CSS instead",
+	a.Blink:     "use CSS instead",
+	a.Center:    "use CSS instead",
+	a.Dir:       "use ul instead",
+	a.Font:      "use CSS instead",
+	a.Frame:     "use iframe and CSS instead",
+	a.Frameset:  "use iframe and CSS instead",
+	a.Isindex:   "use an explicit form and text control instead",
+	a.Keygen:    "use a Web API such as Web Cryptography instead",
+	a.Listing:   "use pre and code instead",
+	a.Marquee:   "use CSS or script instead",
+	a.Menuitem:  "use script to handle contextmenu events instead",
+	a.Nobr:      "use CSS instead",
+	a.Noembed:   "use object instead of embed for fallback content",
+	a.Noframes:  "use iframe and CSS instead",
+	a.Param:     "use the data attribute of object instead",
+	a.Plaintext: "use the text/plain MIME type instead",
+	a.Rb:        "put the base text directly in ruby instead",
+	a.Rtc:       "use nested ruby elements instead",
+	a.Spacer:    "use CSS instead",
+	a.Strike:    "use del for edits, or s, instead",
+	a.Tt:        "use kbd, var, code, samp or CSS instead",
+	a.Xmp:       "use pre and code instead",
+}
+
+// obsoleteAttrs lists the obsolete attributes of the elements.
+var obsoleteAttrs = map[a.Atom][]string{
+	a.A:       {"charset", "coords", "shape", "methods", "name", "rev", "urn"},
+	a.Body:    {"alink", "background", "bgcolor", "bottommargin", "leftmargin", "link", "marginheight", "marginwidth", "rightmargin", "text", "topmargin", "vlink"},
+	a.Br:      {"clear"},
+	a.Caption: {"align"},
+	a.Col:     {"align", "char", "charoff", "valign", "width"},
+	a.Div:     {"align"},
+	a.Dl:      {"compact"},
+	a.Embed:   {"align", "hspace", "name", "vspace"},
+	a.H1:      {"align"},
+	a.H2:      {"align"},
+	a.H3:      {"align"},
+	a.H4:      {"align"},
+	a.H5:      {"align"},
+	a.H6:      {"align"},
+	a.Hr:      {"align", "color", "noshade", "size", "width"},
+	a.Iframe:  {"align", "allowtransparency", "frameborder", "framespacing", "hspace", "longdesc", "marginheight", "marginwidth", "scrolling", "vspace"},
+	a.Img:     {"align", "border", "hspace", "longdesc", "lowsrc", "name", "vspace"},
+	a.Input:   {"align", "hspace", "ismap", "usemap", "vspace"},
+	a.Legend:  {"align"},
+	a.Li:      {"type"},
+	a.Link:    {"charset", "rev", "target"},
+	a.Meta:    {"scheme"},
+	a.Object:  {"align", "archive", "border", "classid", "code", "codebase", "codetype", "declare", "hspace", "standby", "typemustmatch", "vspace"},
+	a.Ol:      {"compact"},
+	a.P:       {"align"},
+	a.Pre:     {"width"},
+	a.Script:  {"charset", "event", "for", "language"},
+	a.Table:   {"align", "bgcolor", "bordercolor", "cellpadding", "cellspacing", "datapagesize", "frame", "height", "rules", "summary", "width"},
+	a.Tbody:   {"align", "char", "charoff", "height", "valign"},
+	a.Td:      {"abbr", "align", "axis", "bgcolor", "char", "charoff", "height", "nowrap", "scope", "valign", "width"},
+	a.Tfoot:   {"align", "char", "charoff", "height", "valign"},
+	a.Th:      {"align", "axis", "bgcolor", "char", "charoff", "height", "nowrap", "valign", "width"},
+	a.Thead:   {"align", "char", "charoff", "height", "valign"},
+	a.Tr:      {"align", "bgcolor", "char", "charoff", "height", "valign"},
+	a.Ul:      {"compact", "type"},
+}
+
+// obsoleteAttrAdvice maps the obsolete attributes which are not replaced
+// by CSS to the advice of the standard on what to use instead.
+var obsoleteAttrAdvice = map[string]string{
+	"abbr":          "use th, or the title attribute, instead",
+	"archive":       "use the data and type attributes instead",
+	"axis":          "use the scope attribute of th instead",
+	"charset":       "use the Content-Type header of the resource instead",
+	"classid":       "use the data and type attributes instead",
+	"code":          "use the data and type attributes instead",
+	"codebase":      "use the data and type attributes instead",
+	"codetype":      "use the data and type attributes instead",
+	"coords":        "use area in a map instead",
+	"declare":       "repeat the object element instead",
+	"event":         "use DOM events instead",
+	"for":           "use DOM events instead",
+	"ismap":         "use img instead of input for image maps",
+	"language":      "omit it for JavaScript, or use the type attribute",
+	"longdesc":      "use a link to the description instead",
+	"lowsrc":        "use a progressive image format instead",
+	"methods":       "use the HTTP OPTIONS method instead",
+	"name":          "use the id attribute instead",
+	"rev":           "use the rel attribute with an opposite term instead",
+	"scheme":        "use a scheme in the value of the content attribute instead",
+	"scope":         "use th for header cells instead",
+	"shape":         "use area in a map instead",
+	"standby":       "optimize the resource to load quickly instead",
+	"summary":       "use caption, or a description in the text, instead",
+	"target":        "omit it",
+	"typemustmatch": "avoid untrusted resources instead",
+	"urn":           "specify the type of the resource with the type attribute instead",
+	"usemap":        "use img instead of input for image maps",
+}
+
+// An enumAttr is an enumerated attribute, of some elements.
+type enumAttr struct {
+	elems         []a.Atom // of the attribute, or nil for all the elements
+	values        []string // the keywords, "" for the empty value
+	caseSensitive bool
+}
+
+func (e *enumAttr) appliesTo(elem a.Atom) bool {
+	if e.elems == nil {
+		return true
+	}
+	for _, x := range e.elems {
+		if x == elem {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *enumAttr) valid(v string) bool {
+	for _, k := range e.values {
+		if v == k || !e.caseSensitive && asciiEqualFold(v, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *enumAttr) keywords() string {
+	q := make([]string, len(e.values))
+	for i, k := range e.values {
+		q[i] = quote(k)
+	}
+	return strings.Join(q, ", ")
+}
+
+// asciiEqualFold reports whether s and t are equal, ignoring the case of
+// ASCII letters, as the keywords of enumerated attributes are.
+func asciiEqualFold(s, t string) bool {
+	if len(s) != len(t) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if lower(s[i]) != lower(t[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
+
+var (
+	crossOrigin    = []string{"", "anonymous", "use-credentials"}
+	formMethod     = []string{"get", "post", "dialog"}
+	formEnctype    = []string{"application/x-www-form-urlencoded", "multipart/form-data", "text/plain"}
+	referrerPolicy = []string{"", "no-referrer", "no-referrer-when-downgrade", "same-origin", "origin", "strict-origin", "origin-when-cross-origin", "strict-origin-when-cross-origin", "unsafe-url"}
+)
+
+// enumAttrs maps the keys of the enumerated attributes to their
+// definitions, of disjoint elements.
+var enumAttrs = map[string][]enumAttr{
+	"autocapitalize":  {{values: []string{"off", "none", "on", "sentences", "words", "characters"}}},
+	"autocomplete":    {{elems: []a.Atom{a.Form}, values: []string{"on", "off"}}},
+	"contenteditable": {{values: []string{"", "true", "false", "plaintext-only"}}},
+	"crossorigin":     {{elems: []a.Atom{a.Audio, a.Img, a.Link, a.Script, a.Video}, values: crossOrigin}},
+	"decoding":        {{elems: []a.Atom{a.Img}, values: []string{"sync", "async", "auto"}}},
+	"dir":             {{values: []string{"ltr", "rtl", "auto"}}},
+	"draggable":       {{values: []string{"true", "false"}}},
+	"enctype":         {{elems: []a.Atom{a.Form}, values: formEnctype}},
+	"enterkeyhint":    {{values: []string{"enter", "done", "go", "next", "previous", "search", "send"}}},
+	"formenctype":     {{elems: []a.Atom{a.Button, a.Input}, values: formEnctype}},
+	"formmethod":      {{elems: []a.Atom{a.Button, a.Input}, values: formMethod}},
+	"hidden":          {{values: []string{"", "hidden", "until-found"}}},
+	"http-equiv":      {{elems: []a.Atom{a.Meta}, values: []string{"content-language", "content-type", "default-style", "refresh", "set-cookie", "x-ua-compatible", "content-security-policy"}}},
+	"inputmode":       {{values: []string{"none", "text", "tel", "url", "email", "numeric", "decimal", "search"}}},
+	"kind":            {{elems: []a.Atom{a.Track}, values: []string{"subtitles", "captions", "descriptions", "chapters", "metadata"}}},
+	"loading":         {{elems: []a.Atom{a.Iframe, a.Img}, values: []string{"lazy", "eager"}}},
+	"method":          {{elems: []a.Atom{a.Form}, values: formMethod}},
+	"preload":         {{elems: []a.Atom{a.Audio, a.Video}, values: []string{"", "none", "metadata", "auto"}}},
+	"referrerpolicy":  {{elems: []a.Atom{a.A, a.Area, a.Iframe, a.Img, a.Link, a.Script}, values: referrerPolicy}},
+	"scope":           {{elems: []a.Atom{a.Th}, values: []string{"row", "col", "rowgroup", "colgroup"}}},
+	"shape":           {{elems: []a.Atom{a.Area}, values: []string{"circle", "default", "poly", "rect"}}},
+	"spellcheck":      {{values: []string{"", "true", "false"}}},
+	"translate":       {{values: []string{"", "yes", "no"}}},
+	"type": {
+		{elems: []a.Atom{a.Button}, values: []string{"submit", "reset", "button"}},
+		{elems: []a.Atom{a.Input}, values: []string{
+			"hidden", "text", "search", "tel", "url", "email", "password", "date", "month", "week", "time",
+			"datetime-local", "number", "range", "color", "checkbox", "radio", "file", "submit", "image", "reset", "button",
+		}},
+		// The type of ol is case-sensitive: "a" and "A" differ.
+		{elems: []a.Atom{a.Ol}, values: []string{"1", "a", "A", "i", "I"}, caseSensitive: true},
+	},
+	"wrap": {{elems: []a.Atom{a.Textarea}, values: []string{"soft", "hard"}}},
+}
+
+// phrasingOnly is the set of the elements which only accept phrasing
+// content.
+var phrasingOnly = map[a.Atom]bool{
+	a.Abbr: true, a.B: true, a.Bdi: true, a.Bdo: true, a.Button: true,
+	a.Cite: true, a.Code: true, a.Data: true, a.Dfn: true, a.Em: true,
+	a.H1: true, a.H2: true, a.H3: true, a.H4: true, a.H5: true, a.H6: true,
+	a.I: true, a.Kbd: true, a.Label: true, a.Legend: true, a.Mark: true,
+	a.Meter: true, a.Output: true, a.P: true, a.Pre: true, a.Progress: true,
+	a.Q: true, a.S: true, a.Samp: true, a.Small: true, a.Span: true,
+	a.Strong: true, a.Sub: true, a.Sup: true, a.Time: true, a.U: true,
+	a.Var: true,
+}
+
+// phrasing is the set of the elements which are phrasing content, or
+// transparent, such as a, whose content then has to be phrasing content.
+// It includes the obsolete elements which were inline, not to report them
+// twice.
+// https://html.spec.whatwg.org/multipage/dom.html#phrasing-content
+var phrasing = map[a.Atom]bool{
+	a.A: true, a.Abbr: true, a.Area: true, a.Audio: true, a.B: true,
+	a.Bdi: true, a.Bdo: true, a.Br: true, a.Button: true, a.Canvas: true,
+	a.Cite: true, a.Code: true, a.Data: true, a.Datalist: true, a.Del: true,
+	a.Dfn: true, a.Em: true, a.Embed: true, a.I: true, a.Iframe: true,
+	a.Img: true, a.Input: true, a.Ins: true, a.Kbd: true, a.Label: true,
+	a.Link: true, a.Map: true, a.Mark: true, a.Math: true, a.Meta: true,
+	a.Meter: true, a.Noscript: true, a.Object: true, a.Output: true,
+	a.Picture: true, a.Progress: true, a.Q: true, a.Ruby: true, a.S: true,
+	a.Samp: true, a.Script: true, a.Select: true, a.Slot: true,
+	a.Small: true, a.Span: true, a.Strong: true, a.Sub: true, a.Sup: true,
+	a.Svg: true, a.Template: true, a.Textarea: true, a.Time: true, a.U: true,
+	a.Var: true, a.Video: true, a.Wbr: true,
+
+	// The phrasing content of ruby, in it.
+	a.Rp: true, a.Rt: true,
+
+	a.Acronym: true, a.Applet: true, a.Basefont: true, a.Big: true,
+	a.Blink: true, a.Font: true, a.Nobr: true, a.Rb: true, a.Rtc: true,
+	a.Spacer: true, a.Strike: true, a.Tt: true,
+}
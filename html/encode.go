@@ -0,0 +1,243 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// An EscapeContext is the context in which an Escaper writes text, which
+// determines the characters to escape.
+type EscapeContext int
+
+const (
+	// TextContext is the text of an element: '&', '<', '>', U+00A0
+	// NO-BREAK SPACE and '\r', which the parser would turn into '\n',
+	// are escaped.
+	TextContext EscapeContext = iota
+
+	// AttributeContext is a quoted attribute value: '&', '"', '\'',
+	// U+00A0 NO-BREAK SPACE and '\r' are escaped, whichever the quotes.
+	AttributeContext
+
+	// RawTextContext is the text of a raw text element, such as script
+	// or style, in which character references are not decoded: nothing
+	// is escaped, and the text which would end the element is an error.
+	RawTextContext
+)
+
+// A NamedEntityPolicy selects the character references an Escaper writes
+// for the characters it escapes.
+type NamedEntityPolicy int
+
+const (
+	// NamedEntitiesBasic writes "&amp;", "&lt;", "&gt;" and "&nbsp;",
+	// and numeric references for the other characters, which is the
+	// shortest form of each.
+	NamedEntitiesBasic NamedEntityPolicy = iota
+
+	// NamedEntitiesNone only writes numeric references, such as "&#38;",
+	// for consumers which know no named entities, such as XML parsers.
+	NamedEntitiesNone
+
+	// NamedEntitiesAll writes the named references of the HTML standard,
+	// such as "&quot;" or "&eacute;", for the characters which have one,
+	// and numeric references for the others.
+	NamedEntitiesAll
+)
+
+var errRawTextEnd = errors.New("html: raw text contains the end tag of its element")
+
+// An Escaper escapes text according to its context and policies, as a
+// configurable successor to EscapeString and UnescapeString.
+//
+// The zero value escapes the text of elements, as the HTML standard
+// serializes it.
+type Escaper struct {
+	// Context is the context of the text.
+	Context EscapeContext
+
+	// RawTextElement is the name of the element of the text in a
+	// RawTextContext, such as "script". If empty, any "</" is an error.
+	RawTextElement string
+
+	// NamedEntities selects the character references written.
+	NamedEntities NamedEntityPolicy
+
+	// PreserveEntities leaves as they are the character references of
+	// the text ending with a semicolon, such as "&eacute;" or "&#233;",
+	// instead of escaping their '&', for text which is partly escaped.
+	PreserveEntities bool
+
+	// ASCII also escapes the non-ASCII characters, for documents whose
+	// encoding cannot represent them.
+	ASCII bool
+}
+
+// Escape returns s escaped for the context of e. In a RawTextContext, it
+// returns s itself, or an error if s contains the end tag of the element.
+func (e *Escaper) Escape(s string) (string, error) {
+	if e.Context == RawTextContext {
+		if rawTextEnd(s, e.RawTextElement) {
+			return "", errRawTextEnd
+		}
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c, size := rune(s[i]), 1
+		if c >= utf8.RuneSelf {
+			c, size = utf8.DecodeRuneInString(s[i:])
+		}
+		if c == '&' && e.PreserveEntities {
+			if n := referenceLen(s[i:]); n > 0 {
+				b.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+		}
+		if !e.escapes(c) {
+			b.WriteString(s[i : i+size])
+		} else if c == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 has no character to reference.
+			b.WriteString("&#65533;")
+		} else {
+			b.WriteString(e.reference(c))
+		}
+		i += size
+	}
+	return b.String(), nil
+}
+
+// Unescape returns s with its character references decoded as the parser
+// decodes those of the context of e. The text of a RawTextContext is
+// returned unchanged.
+func (e *Escaper) Unescape(s string) string {
+	if e.Context == RawTextContext || !strings.Contains(s, "&") {
+		return s
+	}
+	return string(unescape([]byte(s), e.Context == AttributeContext))
+}
+
+// escapes reports whether e escapes c.
+func (e *Escaper) escapes(c rune) bool {
+	switch c {
+	case '&', '\u00a0', '\r':
+		return true
+	case '<', '>':
+		return e.Context == TextContext
+	case '"', '\'':
+		return e.Context == AttributeContext
+	}
+	return e.ASCII && c >= utf8.RuneSelf
+}
+
+// reference returns the character reference e writes for c.
+func (e *Escaper) reference(c rune) string {
+	switch e.NamedEntities {
+	case NamedEntitiesBasic:
+		switch c {
+		case '&':
+			return "&amp;"
+		case '<':
+			return "&lt;"
+		case '>':
+			return "&gt;"
+		case '\u00a0':
+			return "&nbsp;"
+		}
+	case NamedEntitiesAll:
+		if name := entityNames()[c]; name != "" {
+			return "&" + name
+		}
+	}
+	return "&#" + strconv.Itoa(int(c)) + ";"
+}
+
+var (
+	entityNamesOnce sync.Once
+	entityNamesMap  map[rune]string
+)
+
+// entityNames returns the shortest name ending with a semicolon of the
+// characters with a named reference, the last in lexical order among
+// those of the same length, so that "amp;" is preferred to "AMP;".
+func entityNames() map[rune]string {
+	entityNamesOnce.Do(func() {
+		entityNamesMap = make(map[rune]string)
+		for name, c := range entity {
+			if !strings.HasSuffix(name, ";") {
+				continue
+			}
+			if old, ok := entityNamesMap[c]; ok && (len(old) < len(name) || len(old) == len(name) && old > name) {
+				continue
+			}
+			entityNamesMap[c] = name
+		}
+	})
+	return entityNamesMap
+}
+
+// referenceLen returns the length of the character reference ending with
+// a semicolon at the start of s, or zero if there is none.
+func referenceLen(s string) int {
+	i := 1
+	if strings.HasPrefix(s, "&#x") || strings.HasPrefix(s, "&#X") {
+		i = 3
+		for i < len(s) && isHexDigit(s[i]) {
+			i++
+		}
+		if i == 3 {
+			return 0
+		}
+	} else if strings.HasPrefix(s, "&#") {
+		i = 2
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i++
+		}
+		if i == 2 {
+			return 0
+		}
+	} else {
+		for i < len(s) && isAlnum(s[i]) {
+			i++
+		}
+		name := s[1:i] + ";"
+		if entity[name] == 0 && entity2[name][0] == 0 {
+			return 0
+		}
+	}
+	if i == len(s) || s[i] != ';' {
+		return 0
+	}
+	return i + 1
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// rawTextEnd reports whether the raw text s of the element tag would be
+// ended by an end tag, which is any "</" if tag is empty.
+func rawTextEnd(s, tag string) bool {
+	for {
+		i := strings.Index(s, "</")
+		if i < 0 {
+			return false
+		}
+		s = s[i+2:]
+		if tag == "" || len(s) >= len(tag) && strings.EqualFold(s[:len(tag)], tag) {
+			return true
+		}
+	}
+}
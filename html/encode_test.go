@@ -0,0 +1,77 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import "testing"
+
+func TestEscaper(t *testing.T) {
+	testCases := []struct {
+		desc string
+		e    Escaper
+		in   string
+		want string
+	}{
+		{"text", Escaper{}, `a<b & "c" 'd'` + " \r", `a&lt;b &amp; "c" 'd'&nbsp;&#13;`},
+		{"attribute", Escaper{Context: AttributeContext}, `a<b & "c" 'd'`, `a<b &amp; &#34;c&#34; &#39;d&#39;`},
+		{"numeric", Escaper{NamedEntities: NamedEntitiesNone}, "<&> ", "&#60;&#38;&#62;&#160;"},
+		{"named", Escaper{Context: AttributeContext, NamedEntities: NamedEntitiesAll}, `"&'`, "&quot;&amp;&apos;"},
+		{"ascii", Escaper{ASCII: true}, "café 世", "caf&#233; &#19990;"},
+		{"ascii named", Escaper{ASCII: true, NamedEntities: NamedEntitiesAll}, "café →", "caf&eacute; &rarr;"},
+		{"preserve", Escaper{PreserveEntities: true}, "&amp; &eacute; &#233; &#xE9; &NotEqualTilde; & &amp &#; &bogus; &#x;", "&amp; &eacute; &#233; &#xE9; &NotEqualTilde; &amp; &amp;amp &amp;#; &amp;bogus; &amp;#x;"},
+		{"no preserve", Escaper{}, "&amp;", "&amp;amp;"},
+		{"invalid UTF-8", Escaper{ASCII: true}, "a\xffb", "a&#65533;b"},
+	}
+	for _, tc := range testCases {
+		got, err := tc.e.Escape(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: Escape(%q) = %q, %v; want %q", tc.desc, tc.in, got, err, tc.want)
+			continue
+		}
+		if tc.e.PreserveEntities {
+			continue
+		}
+		if u := tc.e.Unescape(got); u != tc.in && tc.desc != "invalid UTF-8" {
+			t.Errorf("%s: Unescape(%q) = %q; want %q", tc.desc, got, u, tc.in)
+		}
+	}
+}
+
+func TestEscaperRawText(t *testing.T) {
+	testCases := []struct {
+		tag, in string
+		ok      bool
+	}{
+		{"script", "if (a < b && c) {}", true},
+		{"script", "'</style>'", true},
+		{"script", "'</SCRIPT>'", false},
+		{"style", "a::after{content:'</style'}", false},
+		{"", "a</b", false},
+		{"", "a<b", true},
+	}
+	for _, tc := range testCases {
+		e := Escaper{Context: RawTextContext, RawTextElement: tc.tag}
+		got, err := e.Escape(tc.in)
+		if tc.ok && (err != nil || got != tc.in) {
+			t.Errorf("%s: Escape(%q) = %q, %v; want it unchanged", tc.tag, tc.in, got, err)
+		} else if !tc.ok && err != errRawTextEnd {
+			t.Errorf("%s: Escape(%q) = %q, %v; want %v", tc.tag, tc.in, got, err, errRawTextEnd)
+		}
+		if u := e.Unescape("&amp;"); u != "&amp;" {
+			t.Errorf("%s: Unescape decoded %q", tc.tag, u)
+		}
+	}
+}
+
+func TestEscaperUnescapeAttribute(t *testing.T) {
+	// Legacy references without a semicolon are not decoded before '='
+	// in attributes.
+	in := "?a=1&copy=2&amp;b"
+	if got, want := (&Escaper{Context: AttributeContext}).Unescape(in), "?a=1&copy=2&b"; got != want {
+		t.Errorf("attribute Unescape(%q) = %q; want %q", in, got, want)
+	}
+	if got, want := (&Escaper{}).Unescape(in), "?a=1©=2&b"; got != want {
+		t.Errorf("text Unescape(%q) = %q; want %q", in, got, want)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	a "golang.org/x/net/html/atom"
+)
+
+// FormOwners holds the form owners of the form-associated elements of a
+// parsed document: the button, fieldset, img, input, object, output,
+// select and textarea elements. See ParseOptionFormOwners.
+//
+// https://html.spec.whatwg.org/multipage/form-control-infrastructure.html#form-owner
+type FormOwners struct {
+	// parsed maps the elements to the form element pointer of the parser
+	// when they were created, for those it associates with it.
+	parsed map[*Node]*Node
+	owner  map[*Node]*Node
+	forms  map[*Node][]*Node
+}
+
+// ParseOptionFormOwners configures the parser to record in f the form
+// owners of the form-associated elements, as the parser associates them
+// with the form element it last opened, and according to their form
+// attributes. For malformed markup, such as a form opened in a table,
+// the owner of an element may not be one of its ancestors.
+//
+// The nodes returned by ParseFragmentWithOptions are not in a document,
+// so their form attributes are ignored, and their owners are the forms
+// among the nodes.
+func ParseOptionFormOwners(f *FormOwners) ParseOption {
+	return func(p *parser) {
+		*f = FormOwners{parsed: make(map[*Node]*Node)}
+		p.formOwners = f
+	}
+}
+
+// Owner returns the form owner of the form-associated element n, or nil
+// if it has none or is not a form-associated element of the document.
+func (f *FormOwners) Owner(n *Node) *Node {
+	return f.owner[n]
+}
+
+// Elements returns the form-associated elements whose owner is form, in
+// tree order. As the elements of an HTMLFormElement, they are the
+// controls submitted with the form, in addition to the img elements.
+func (f *FormOwners) Elements(form *Node) []*Node {
+	return f.forms[form]
+}
+
+// isFormAssociated reports whether n is a form-associated element, and
+// listed if it is also a listed element, which may have a form attribute.
+func isFormAssociated(n *Node) (ok, listed bool) {
+	if n.Type != ElementNode || n.Namespace != "" {
+		return false, false
+	}
+	switch n.DataAtom {
+	case a.Button, a.Fieldset, a.Input, a.Object, a.Output, a.Select, a.Textarea:
+		return true, true
+	case a.Img:
+		return true, false
+	}
+	return false, false
+}
+
+// noteElement records the association of the element n created by the
+// parser with its form element pointer, following the steps of creating
+// an element for a token.
+//
+// https://html.spec.whatwg.org/multipage/parsing.html#create-an-element-for-the-token
+func (p *parser) noteElement(n *Node) {
+	if p.formOwners == nil || p.form == nil || p.oe.contains(a.Template) {
+		return
+	}
+	ok, listed := isFormAssociated(n)
+	if _, has := htmlAttr(n, "form"); !ok || listed && has {
+		return
+	}
+	// The form of the context of a fragment is in another tree.
+	root := p.form
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	if root == p.doc {
+		p.formOwners.parsed[n] = p.form
+	}
+}
+
+// resolve sets the form owners of the form-associated elements in the
+// tree rooted at root, once parsed, connected to a document if connected.
+//
+// https://html.spec.whatwg.org/multipage/form-control-infrastructure.html#reset-the-form-owner
+func (f *FormOwners) resolve(root *Node, connected bool) {
+	f.owner = make(map[*Node]*Node)
+	f.forms = make(map[*Node][]*Node)
+	ids := make(map[string]*Node)
+	if connected {
+		collectIDs(root, ids)
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if ok, listed := isFormAssociated(n); ok {
+			owner := f.parsed[n]
+			if owner == nil {
+				// The contents of a template are not in the document.
+				if id, has := htmlAttr(n, "form"); listed && has && connected && !inTemplate(n) {
+					if e := ids[id]; e != nil && isHTMLElement(e, a.Form) {
+						owner = e
+					}
+				} else {
+					owner = ancestorForm(n)
+				}
+			}
+			if owner != nil {
+				f.owner[n] = owner
+				f.forms[owner] = append(f.forms[owner], n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	f.parsed = nil
+}
+
+// collectIDs maps the IDs of the elements in the tree rooted at n, but
+// not in the contents of templates, to the first element with each.
+func collectIDs(n *Node, ids map[string]*Node) {
+	if n.Type == ElementNode {
+		if id, _ := htmlAttr(n, "id"); id != "" && ids[id] == nil {
+			ids[id] = n
+		}
+		if isHTMLElement(n, a.Template) {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectIDs(c, ids)
+	}
+}
+
+// ancestorForm returns the nearest form element ancestor of n, in the
+// same template contents if any, or nil.
+func ancestorForm(n *Node) *Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type != ElementNode || p.Namespace != "" {
+			continue
+		}
+		switch p.DataAtom {
+		case a.Form:
+			return p
+		case a.Template:
+			return nil
+		}
+	}
+	return nil
+}
+
+// inTemplate reports whether n is in the contents of a template.
+func inTemplate(n *Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if isHTMLElement(p, a.Template) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormOwners(t *testing.T) {
+	tests := []struct {
+		html string
+		// owners maps the names of form-associated elements to the ids of
+		// their owners, or "" for those without an owner.
+		owners map[string]string
+	}{
+		{
+			`<form id=f><input name=a><fieldset name=b><select name=c></select></fieldset></form><input name=d form=f><input name=e>`,
+			map[string]string{"a": "f", "b": "f", "c": "f", "d": "f", "e": ""},
+		},
+		{
+			// A form opened in a table is empty, but it owns the
+			// controls in the table.
+			`<table><form id=f><tr><td><input name=a></td></tr></form></table><input name=b>`,
+			map[string]string{"a": "f", "b": ""},
+		},
+		{
+			// A form closed by its parent owns the controls after it,
+			// until its end tag.
+			`<div><form id=f></div><input name=a><button name=b></button></form><input name=c>`,
+			map[string]string{"a": "f", "b": "f", "c": ""},
+		},
+		{
+			// The form attribute takes precedence over the ancestors,
+			// even when it does not name a form.
+			`<form id=f><input name=a form=g><input name=b form=d><input name=c form=""></form><form id=g></form><div id=d></div>`,
+			map[string]string{"a": "g", "b": "", "c": ""},
+		},
+		{
+			// The first element with an ID is used.
+			`<div id=f></div><form id=f><input name=a form=f></form>`,
+			map[string]string{"a": ""},
+		},
+		{
+			// An img, which is not a listed element, ignores its form
+			// attribute.
+			`<form id=f><img name=a form=g></form><form id=g></form>`,
+			map[string]string{"a": "f"},
+		},
+		{
+			// The contents of a template are not in the document.
+			`<form id=f><template><input name=a form=f><form id=g><input name=b></form></template></form>`,
+			map[string]string{"a": "", "b": "g"},
+		},
+		{
+			// Foreign elements are not form-associated.
+			`<form id=f><svg><input name=a></input></svg></form>`,
+			map[string]string{"a": ""},
+		},
+	}
+	for _, tt := range tests {
+		var owners FormOwners
+		doc, err := ParseWithOptions(strings.NewReader(tt.html), ParseOptionFormOwners(&owners))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFormOwners(t, tt.html, doc, &owners, tt.owners)
+	}
+}
+
+func TestFormOwnersFragment(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<div></div><form id=f><div></div></form>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := doc.FirstChild.LastChild
+	tests := []struct {
+		context *Node
+		html    string
+		owners  map[string]string
+	}{
+		{
+			body.FirstChild,
+			`<input name=a form=g><div><form id=g></div><input name=b>`,
+			map[string]string{"a": "", "b": "g"},
+		},
+		{
+			// The form of the context is in another tree.
+			body.LastChild.FirstChild,
+			`<input name=a form=f><form id=g><input name=b>`,
+			map[string]string{"a": "", "b": ""},
+		},
+	}
+	for _, tt := range tests {
+		var owners FormOwners
+		nodes, err := ParseFragmentWithOptions(strings.NewReader(tt.html), tt.context, ParseOptionFormOwners(&owners))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := &Node{Type: DocumentNode}
+		for _, n := range nodes {
+			root.AppendChild(n)
+		}
+		checkFormOwners(t, tt.html, root, &owners, tt.owners)
+	}
+}
+
+func checkFormOwners(t *testing.T, src string, root *Node, owners *FormOwners, want map[string]string) {
+	t.Helper()
+	elements := make(map[*Node][]string)
+	var walk func(*Node)
+	walk = func(n *Node) {
+		if name, ok := htmlAttr(n, "name"); ok {
+			id := ""
+			if o := owners.Owner(n); o != nil {
+				id, _ = htmlAttr(o, "id")
+				elements[o] = append(elements[o], name)
+			}
+			if id != want[name] {
+				t.Errorf("%s: owner of %s is %q; want %q", src, name, id, want[name])
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	for form, names := range elements {
+		var got []string
+		for _, n := range owners.Elements(form) {
+			name, _ := htmlAttr(n, "name")
+			got = append(got, name)
+		}
+		if strings.Join(got, " ") != strings.Join(names, " ") {
+			t.Errorf("%s: elements %v; want %v", src, got, names)
+		}
+	}
+}
@@ -49,6 +49,10 @@ type Node struct {
 	Data      string
 	Namespace string
 	Attr      []Attribute
+
+	// src is the source of the node, if it was parsed with
+	// ParseOptionPreserveSource.
+	src *nodeSource
 }
 
 // InsertBefore inserts newChild as a child of n, immediately before oldChild
@@ -146,6 +150,10 @@ func (n *Node) clone() *Node {
 		Attr:     make([]Attribute, len(n.Attr)),
 	}
 	copy(m.Attr, n.Attr)
+	if n.src != nil {
+		// A clone has no source of its own, and is rendered as usual.
+		m.src = &nodeSource{}
+	}
 	return m
 }
 
@@ -49,6 +49,23 @@ type parser struct {
 	// context is the context element when parsing an HTML fragment
 	// (section 12.4).
 	context *Node
+	// preserve is whether to record the source of the nodes.
+	preserve bool
+	// src is the source of the current token, until a node takes it.
+	src *nodeSource
+	// pendingSrc is source which the parser ignored, to be recorded on
+	// the next node which takes the source of its token.
+	pendingSrc string
+	// rawText holds the names of the custom raw text elements.
+	rawText []string
+	// handlers maps the names of HTML elements to the functions called
+	// when they are closed, and handled holds the elements with a
+	// handler which are open.
+	handlers map[string]func(*Node)
+	handled  []*Node
+	// formOwners, if non-nil, records the form owners of the
+	// form-associated elements.
+	formOwners *FormOwners
 }
 
 func (p *parser) top() *Node {
@@ -232,6 +249,29 @@ func (p *parser) addChild(n *Node) {
 
 	if n.Type == ElementNode {
 		p.oe = append(p.oe, n)
+		if p.handlers != nil && n.Namespace == "" && p.handlers[n.Data] != nil {
+			p.handled = append(p.handled, n)
+		}
+	}
+}
+
+// runHandlers calls the handlers of the elements which are no longer
+// open, or of all the elements if done.
+func (p *parser) runHandlers(done bool) {
+	var closed []*Node
+	i := 0
+	for _, n := range p.handled {
+		if !done && p.oe.index(n) >= 0 {
+			p.handled[i] = n
+			i++
+		} else {
+			closed = append(closed, n)
+		}
+	}
+	p.handled = p.handled[:i]
+	// Handle the inner elements first.
+	for j := len(closed) - 1; j >= 0; j-- {
+		p.handlers[closed[j].Data](closed[j])
 	}
 }
 
@@ -302,33 +342,52 @@ func (p *parser) addText(text string) {
 		return
 	}
 
+	var src *nodeSource
+	if p.preserve {
+		src = p.textSource(text)
+	}
+
 	if p.shouldFosterParent() {
-		p.fosterParent(&Node{
+		n := &Node{
 			Type: TextNode,
 			Data: text,
-		})
+		}
+		p.fosterParent(n)
+		if p.preserve {
+			p.addTextSource(n, "", src)
+		}
 		return
 	}
 
 	t := p.top()
 	if n := t.LastChild; n != nil && n.Type == TextNode {
+		if p.preserve {
+			p.addTextSource(n, n.Data, src)
+		}
 		n.Data += text
 		return
 	}
-	p.addChild(&Node{
+	n := &Node{
 		Type: TextNode,
 		Data: text,
-	})
+	}
+	p.addChild(n)
+	if p.preserve {
+		p.addTextSource(n, "", src)
+	}
 }
 
 // addElement adds a child element based on the current token.
 func (p *parser) addElement() {
-	p.addChild(&Node{
+	n := &Node{
 		Type:     ElementNode,
 		DataAtom: p.tok.DataAtom,
 		Data:     p.tok.Data,
 		Attr:     p.tok.Attr,
-	})
+	}
+	n.src = p.elementSource(n)
+	p.noteElement(n)
+	p.addChild(n)
 }
 
 // Section 12.2.4.3.
@@ -2274,15 +2333,15 @@ func (p *parser) inForeignContent() bool {
 // parseImpliedToken parses a token as though it had appeared in the parser's
 // input.
 func (p *parser) parseImpliedToken(t TokenType, dataAtom a.Atom, data string) {
-	realToken, selfClosing := p.tok, p.hasSelfClosingToken
+	realToken, selfClosing, src := p.tok, p.hasSelfClosingToken, p.src
 	p.tok = Token{
 		Type:     t,
 		DataAtom: dataAtom,
 		Data:     data,
 	}
-	p.hasSelfClosingToken = false
+	p.hasSelfClosingToken, p.src = false, nil
 	p.parseCurrentToken()
-	p.tok, p.hasSelfClosingToken = realToken, selfClosing
+	p.tok, p.hasSelfClosingToken, p.src = realToken, selfClosing, src
 }
 
 // parseCurrentToken runs the current token through the parsing routines
@@ -2316,15 +2375,30 @@ func (p *parser) parse() error {
 		n := p.oe.top()
 		p.tokenizer.AllowCDATA(n != nil && n.Namespace != "")
 		// Read and parse the next token.
-		p.tokenizer.Next()
-		p.tok = p.tokenizer.Token()
-		if p.tok.Type == ErrorToken {
+		if p.tokenizer.Next() == ErrorToken {
 			err = p.tokenizer.Err()
 			if err != nil && err != io.EOF {
 				return err
 			}
 		}
-		p.parseCurrentToken()
+		if p.preserve {
+			p.parseSourceToken()
+		} else {
+			p.tok = p.tokenizer.Token()
+			p.parseCurrentToken()
+		}
+		if len(p.handled) > 0 {
+			p.runHandlers(false)
+		}
+	}
+	if len(p.handled) > 0 {
+		p.runHandlers(true)
+	}
+	if p.preserve {
+		finishSource(p.doc)
+		if p.pendingSrc != "" {
+			p.doc.src = &nodeSource{endRaw: p.pendingSrc}
+		}
 	}
 	return nil
 }
@@ -2366,6 +2440,34 @@ func ParseOptionEnableScripting(enable bool) ParseOption {
 	}
 }
 
+// ParseOptionRawTextElements registers additional element names whose
+// content is raw text, like that of a script element, as with
+// Tokenizer.SetRawTextElements. The text is the only child of such an
+// element. Render escapes it like any text; RenderWithOptions writes it
+// as it is with RenderOptionRawTextElements of the same names.
+func ParseOptionRawTextElements(names ...string) ParseOption {
+	return func(p *parser) {
+		p.rawText = names
+		p.tokenizer.SetRawTextElements(names...)
+	}
+}
+
+// ParseOptionElementHandler registers a function called with each HTML
+// element named name (such as "div" or a custom element name, in lower
+// case) during tree construction, once the element is closed and its
+// children are parsed. The function may modify the attributes and the
+// children of the element, but must not remove it from the tree.
+//
+// Elements closed by the end of the input are handled after it.
+func ParseOptionElementHandler(name string, f func(n *Node)) ParseOption {
+	return func(p *parser) {
+		if p.handlers == nil {
+			p.handlers = make(map[string]func(*Node))
+		}
+		p.handlers[name] = f
+	}
+}
+
 // ParseWithOptions is like Parse, with options.
 func ParseWithOptions(r io.Reader, opts ...ParseOption) (*Node, error) {
 	p := &parser{
@@ -2385,6 +2487,15 @@ func ParseWithOptions(r io.Reader, opts ...ParseOption) (*Node, error) {
 	if err := p.parse(); err != nil {
 		return nil, err
 	}
+	if p.formOwners != nil {
+		p.formOwners.resolve(p.doc, true)
+	}
+	if p.preserve {
+		checkSource([]*Node{p.doc}, func(r io.Reader) ([]*Node, error) {
+			doc, err := ParseWithOptions(r, ParseOptionEnableScripting(p.scripting), ParseOptionRawTextElements(p.rawText...))
+			return []*Node{doc}, err
+		})
+	}
 	return p.doc, nil
 }
 
@@ -2420,6 +2531,11 @@ func ParseFragmentWithOptions(r io.Reader, context *Node, opts ...ParseOption) (
 	for _, f := range opts {
 		f(p)
 	}
+	if context != nil && context.Namespace == "" && p.tokenizer.rawTag == "" {
+		if s := strings.ToLower(context.Data); p.tokenizer.rawTextElements[s] {
+			p.tokenizer.rawTag = s
+		}
+	}
 
 	root := &Node{
 		Type:     ElementNode,
@@ -2444,6 +2560,10 @@ func ParseFragmentWithOptions(r io.Reader, context *Node, opts ...ParseOption) (
 		return nil, err
 	}
 
+	if p.formOwners != nil {
+		p.formOwners.resolve(p.doc, false)
+	}
+
 	parent := p.doc
 	if context != nil {
 		parent = root
@@ -2456,5 +2576,10 @@ func ParseFragmentWithOptions(r io.Reader, context *Node, opts ...ParseOption) (
 		result = append(result, c)
 		c = next
 	}
+	if p.preserve {
+		checkSource(result, func(r io.Reader) ([]*Node, error) {
+			return ParseFragmentWithOptions(r, context, ParseOptionEnableScripting(p.scripting), ParseOptionRawTextElements(p.rawText...))
+		})
+	}
 	return result, nil
 }
@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"strings"
@@ -448,6 +449,47 @@ var renderTestBlacklist = map[string]bool{
 	`<!doctype html><svg><plaintext>a</plaintext>b`:           true,
 }
 
+func TestParseOptionElementHandler(t *testing.T) {
+	const src = `<x-tpl><b>{{.}}</b></x-tpl><p><x-tpl>a</x-tpl><x-tpl>b`
+	var texts []string
+	handler := func(n *Node) {
+		var b strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			Render(&b, c)
+		}
+		texts = append(texts, b.String())
+		n.Attr = append(n.Attr, Attribute{Key: "data-handled", Val: "1"})
+	}
+	doc, err := ParseWithOptions(strings.NewReader(src),
+		ParseOptionRawTextElements("x-tpl"),
+		ParseOptionElementHandler("x-tpl", handler),
+		ParseOptionElementHandler("p", func(n *Node) { texts = append(texts, "p") }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"&lt;b&gt;{{.}}&lt;/b&gt;", "a", "b", "p"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("handled %q, want %q", texts, want)
+	}
+	var b strings.Builder
+	if err := Render(&b, doc); err != nil {
+		t.Fatal(err)
+	}
+	wantHTML := `<html><head></head><body><x-tpl data-handled="1">&lt;b&gt;{{.}}&lt;/b&gt;</x-tpl><p><x-tpl data-handled="1">a</x-tpl><x-tpl data-handled="1">b</x-tpl></p></body></html>`
+	if got := b.String(); got != wantHTML {
+		t.Errorf("got %s\nwant %s", got, wantHTML)
+	}
+
+	nodes, err := ParseFragmentWithOptions(strings.NewReader("<b>x</b>"), &Node{Type: ElementNode, Data: "x-tpl"}, ParseOptionRawTextElements("x-tpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Type != TextNode || nodes[0].Data != "<b>x</b>" {
+		t.Errorf("fragment in a raw text element: got %v", nodes)
+	}
+}
+
 func TestNodeConsistency(t *testing.T) {
 	// inconsistentNode is a Node whose DataAtom and Data do not agree.
 	inconsistentNode := &Node{
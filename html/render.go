@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"golang.org/x/net/html/atom"
 )
 
 type writer interface {
@@ -42,6 +44,9 @@ type writer interface {
 // text node would become a tree containing <html>, <head> and <body> elements.
 // Another example is that the programmatic equivalent of "a<head>b</head>c"
 // becomes "<html><head><head/><body>abc</body></html>".
+//
+// Nodes parsed with ParseOptionPreserveSource are rendered from their
+// source for as long as they are unmodified.
 func Render(w io.Writer, n *Node) error {
 	if x, ok := w.(writer); ok {
 		return render(x, n)
@@ -53,6 +58,57 @@ func Render(w io.Writer, n *Node) error {
 	return buf.Flush()
 }
 
+// A RenderOption configures how a tree is rendered.
+type RenderOption func(w *rawTextWriter)
+
+// RenderOptionRawTextElements registers additional element names whose
+// text children are written unescaped, like those of a script element,
+// for trees parsed with the same names given to
+// ParseOptionRawTextElements. Rendering fails if such a text contains the
+// end tag of its element.
+func RenderOptionRawTextElements(names ...string) RenderOption {
+	return func(w *rawTextWriter) {
+		for _, name := range names {
+			w.elements[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// RenderWithOptions is like Render, with options.
+func RenderWithOptions(w io.Writer, n *Node, opts ...RenderOption) error {
+	if len(opts) == 0 {
+		return Render(w, n)
+	}
+	rw := &rawTextWriter{elements: make(map[string]bool)}
+	for _, f := range opts {
+		f(rw)
+	}
+	if x, ok := w.(writer); ok {
+		rw.writer = x
+		return render(rw, n)
+	}
+	buf := bufio.NewWriter(w)
+	rw.writer = buf
+	if err := render(rw, n); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// A rawTextWriter is a writer rendering the text children of the custom
+// raw text elements unescaped.
+type rawTextWriter struct {
+	writer
+	elements map[string]bool
+}
+
+// customRawText reports whether the children of the element n are raw
+// text by the options of w.
+func customRawText(w writer, n *Node) bool {
+	rw, ok := w.(*rawTextWriter)
+	return ok && rw.elements[n.Data]
+}
+
 // plaintextAbort is returned from render1 when a <plaintext> element
 // has been rendered. No more end tags should be rendered after that.
 var plaintextAbort = errors.New("html: internal error (plaintext abort)")
@@ -71,6 +127,11 @@ func render1(w writer, n *Node) error {
 	case ErrorNode:
 		return errors.New("html: cannot render an ErrorNode node")
 	case TextNode:
+		if n.src != nil {
+			if ok, err := writeSource(w, n); ok || err != nil {
+				return err
+			}
+		}
 		return escape(w, n.Data)
 	case DocumentNode:
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
@@ -78,10 +139,26 @@ func render1(w writer, n *Node) error {
 				return err
 			}
 		}
+		if n.src != nil {
+			_, err := w.WriteString(n.src.endRaw)
+			return err
+		}
 		return nil
 	case ElementNode:
-		// No-op.
+		if n.src != nil {
+			if n.src.implied || n.Data == n.src.data {
+				return renderSourceElement(w, n)
+			}
+			if _, err := w.WriteString(n.src.before); err != nil {
+				return err
+			}
+		}
 	case CommentNode:
+		if n.src != nil {
+			if ok, err := writeSource(w, n); ok || err != nil {
+				return err
+			}
+		}
 		if _, err := w.WriteString("<!--"); err != nil {
 			return err
 		}
@@ -93,6 +170,11 @@ func render1(w writer, n *Node) error {
 		}
 		return nil
 	case DoctypeNode:
+		if n.src != nil {
+			if ok, err := writeSource(w, n); ok || err != nil {
+				return err
+			}
+		}
 		if _, err := w.WriteString("<!DOCTYPE "); err != nil {
 			return err
 		}
@@ -149,31 +231,11 @@ func render1(w writer, n *Node) error {
 		return err
 	}
 	for _, a := range n.Attr {
-		if err := w.WriteByte(' '); err != nil {
-			return err
-		}
-		if a.Namespace != "" {
-			if _, err := w.WriteString(a.Namespace); err != nil {
-				return err
-			}
-			if err := w.WriteByte(':'); err != nil {
-				return err
-			}
-		}
-		if _, err := w.WriteString(a.Key); err != nil {
-			return err
-		}
-		if _, err := w.WriteString(`="`); err != nil {
-			return err
-		}
-		if err := escape(w, a.Val); err != nil {
-			return err
-		}
-		if err := w.WriteByte('"'); err != nil {
+		if err := writeAttr(w, a); err != nil {
 			return err
 		}
 	}
-	if voidElements[n.Data] {
+	if isVoidElement(n.Data) {
 		if n.FirstChild != nil {
 			return fmt.Errorf("html: void element <%s> has child nodes", n.Data)
 		}
@@ -195,10 +257,36 @@ func render1(w writer, n *Node) error {
 	}
 
 	// Render any child nodes.
-	switch n.Data {
-	case "iframe", "noembed", "noframes", "noscript", "plaintext", "script", "style", "xmp":
+	if err := renderChildren(w, n); err != nil {
+		return err
+	}
+
+	// Render the </xxx> closing tag.
+	if _, err := w.WriteString("</"); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(n.Data); err != nil {
+		return err
+	}
+	return w.WriteByte('>')
+}
+
+// renderChildren renders the child nodes of the element n.
+func renderChildren(w writer, n *Node) error {
+	if custom := customRawText(w, n); custom || atom.IsRawText(atom.Lookup([]byte(n.Data))) {
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			if c.Type == TextNode {
+				if c.src != nil {
+					if ok, err := writeSource(w, c); ok || err != nil {
+						if err != nil {
+							return err
+						}
+						continue
+					}
+				}
+				if custom && rawTextEnd(c.Data, n.Data) {
+					return errRawTextEnd
+				}
 				if _, err := w.WriteString(c.Data); err != nil {
 					return err
 				}
@@ -213,22 +301,39 @@ func render1(w writer, n *Node) error {
 			// last element in the file, with no closing tag.
 			return plaintextAbort
 		}
-	default:
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err := render1(w, c); err != nil {
-				return err
-			}
+		return nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := render1(w, c); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Render the </xxx> closing tag.
-	if _, err := w.WriteString("</"); err != nil {
+// writeAttr writes the attribute a of a start tag, preceded by a space.
+func writeAttr(w writer, a Attribute) error {
+	if err := w.WriteByte(' '); err != nil {
 		return err
 	}
-	if _, err := w.WriteString(n.Data); err != nil {
+	if a.Namespace != "" {
+		if _, err := w.WriteString(a.Namespace); err != nil {
+			return err
+		}
+		if err := w.WriteByte(':'); err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteString(a.Key); err != nil {
 		return err
 	}
-	return w.WriteByte('>')
+	if _, err := w.WriteString(`="`); err != nil {
+		return err
+	}
+	if err := escape(w, a.Val); err != nil {
+		return err
+	}
+	return w.WriteByte('"')
 }
 
 // writeQuoted writes s to w surrounded by quotes. Normally it will use double
@@ -252,22 +357,8 @@ func writeQuoted(w writer, s string) error {
 	return nil
 }
 
-// Section 12.1.2, "Elements", gives this list of void elements. Void elements
-// are those that can't have any contents.
-var voidElements = map[string]bool{
-	"area":   true,
-	"base":   true,
-	"br":     true,
-	"col":    true,
-	"embed":  true,
-	"hr":     true,
-	"img":    true,
-	"input":  true,
-	"keygen": true, // "keygen" has been removed from the spec, but are kept here for backwards compatibility.
-	"link":   true,
-	"meta":   true,
-	"param":  true,
-	"source": true,
-	"track":  true,
-	"wbr":    true,
+// isVoidElement reports whether the element name is void: it can't have any
+// contents.
+func isVoidElement(name string) bool {
+	return atom.IsVoid(atom.Lookup([]byte(name)))
 }
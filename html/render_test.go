@@ -6,6 +6,7 @@ package html
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -169,3 +170,24 @@ func TestRenderer(t *testing.T) {
 		t.Errorf("got vs want:\n%s\n%s\n", got, want)
 	}
 }
+
+func TestRenderRawTextElements(t *testing.T) {
+	doc, err := ParseWithOptions(strings.NewReader(`<x-tpl><b>{{.}}</b></x-tpl>`), ParseOptionRawTextElements("x-tpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := RenderWithOptions(&b, doc, RenderOptionRawTextElements("X-TPL")); err != nil {
+		t.Fatal(err)
+	}
+	want := `<html><head></head><body><x-tpl><b>{{.}}</b></x-tpl></body></html>`
+	if got := b.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+
+	n := &Node{Type: ElementNode, Data: "x-tpl"}
+	n.AppendChild(&Node{Type: TextNode, Data: "a</X-TPL>b"})
+	if err := RenderWithOptions(new(bytes.Buffer), n, RenderOptionRawTextElements("x-tpl")); err != errRawTextEnd {
+		t.Errorf("rendering the end tag in raw text: got %v, want %v", err, errRawTextEnd)
+	}
+}
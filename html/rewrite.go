@@ -0,0 +1,582 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"io"
+	"strings"
+)
+
+// A Rewriter copies an HTML document token by token, letting handlers
+// change the elements and text it contains, without building a tree. The
+// tokens that are not changed are copied as they are in the source.
+//
+// A Rewriter tracks the elements open as the parser would, closing those
+// whose end tags are implied, such as a p element by the start of a div
+// element, or a head element by the first content of the body, and
+// inferring the head and body elements when their tags are omitted, so
+// that content appended to an element, such as a script appended to the
+// head, is written where the parser puts the end of that element. It does
+// not move the content which the parser would, such as text
+// foster-parented out of tables.
+//
+// The zero value is a Rewriter without handlers, which copies documents.
+type Rewriter struct {
+	elements []elementHandler
+	text     []func(*RewriteText) error
+}
+
+type elementHandler struct {
+	tag string
+	f   func(*RewriteElement) error
+}
+
+// OnElement registers f to be called for the elements named tag, in lower
+// case, or for all the elements if tag is "*", in the order of their
+// start tags. Handlers registered for the same element are called in the
+// order of their registration.
+func (rw *Rewriter) OnElement(tag string, f func(*RewriteElement) error) {
+	rw.elements = append(rw.elements, elementHandler{tag, f})
+}
+
+// OnText registers f to be called for the text of the document.
+func (rw *Rewriter) OnText(f func(*RewriteText) error) {
+	rw.text = append(rw.text, f)
+}
+
+// A RewriteElement is an element passed to the handlers of a Rewriter,
+// which may change it. The content given to its methods is HTML, written
+// as it is: text must be escaped, for instance with EscapeString.
+type RewriteElement struct {
+	tok      Token
+	implied  bool
+	modified bool
+	void     bool
+
+	before, prepend, append, after []string
+
+	removed, unwrapped bool
+}
+
+// TagName returns the name of the element, in lower case.
+func (e *RewriteElement) TagName() string { return e.tok.Data }
+
+// Implied reports whether the start tag of the element is omitted in the
+// document, as those of head and body elements may be. The attributes of
+// such an element cannot be changed.
+func (e *RewriteElement) Implied() bool { return e.implied }
+
+// Attr returns the value of the attribute key of the element, and
+// whether it is present.
+func (e *RewriteElement) Attr(key string) (string, bool) {
+	for _, a := range e.tok.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// Attrs returns the attributes of the element, which must not be
+// modified.
+func (e *RewriteElement) Attrs() []Attribute { return e.tok.Attr }
+
+// SetAttr sets the attribute key of the element to the unescaped value
+// val, adding it if it is not present.
+func (e *RewriteElement) SetAttr(key, val string) {
+	attr := make([]Attribute, 0, len(e.tok.Attr)+1)
+	found := false
+	for _, a := range e.tok.Attr {
+		if a.Key == key {
+			if found {
+				continue
+			}
+			a.Val, found = val, true
+		}
+		attr = append(attr, a)
+	}
+	if !found {
+		attr = append(attr, Attribute{Key: key, Val: val})
+	}
+	e.tok.Attr = attr
+	e.modified = true
+}
+
+// RemoveAttr removes the attribute key of the element.
+func (e *RewriteElement) RemoveAttr(key string) {
+	attr := make([]Attribute, 0, len(e.tok.Attr))
+	for _, a := range e.tok.Attr {
+		if a.Key != key {
+			attr = append(attr, a)
+		}
+	}
+	if len(attr) != len(e.tok.Attr) {
+		e.tok.Attr = attr
+		e.modified = true
+	}
+}
+
+// Before inserts content before the start tag of the element.
+func (e *RewriteElement) Before(content string) { e.before = append(e.before, content) }
+
+// After inserts content after the end of the element.
+func (e *RewriteElement) After(content string) { e.after = append(e.after, content) }
+
+// Prepend inserts content at the start of the content of the element. It
+// has no effect on void elements, such as img.
+func (e *RewriteElement) Prepend(content string) { e.prepend = append(e.prepend, content) }
+
+// Append inserts content at the end of the content of the element. It has
+// no effect on void elements, such as img.
+func (e *RewriteElement) Append(content string) { e.append = append(e.append, content) }
+
+// Remove removes the element and its content. The content inserted
+// before and after it is still written.
+func (e *RewriteElement) Remove() { e.removed = true }
+
+// Unwrap removes the tags of the element, keeping its content.
+func (e *RewriteElement) Unwrap() { e.unwrapped = true }
+
+// A RewriteText is a text token passed to the handlers of a Rewriter, a
+// part of the content of an element, or all of it.
+type RewriteText struct {
+	text    string
+	raw     bool
+	parent  string
+	content *string // the replacement, if non-nil
+}
+
+// Text returns the text, unescaped, or as it is in the document for the
+// content of raw text elements, such as script and style.
+func (t *RewriteText) Text() string { return t.text }
+
+// Parent returns the name of the element containing the text, in lower
+// case, or "" for the text outside of the elements.
+func (t *RewriteText) Parent() string { return t.parent }
+
+// SetText replaces the text by text, which is escaped unless it is the
+// content of a raw text element.
+func (t *RewriteText) SetText(text string) {
+	if !t.raw {
+		text = EscapeString(text)
+	}
+	t.content = &text
+}
+
+// Replace replaces the text by content, HTML written as it is.
+func (t *RewriteText) Replace(content string) { t.content = &content }
+
+// Remove removes the text.
+func (t *RewriteText) Remove() { t.Replace("") }
+
+// Insertion modes of a rewriting, before the content of the body.
+const (
+	rewriteBeforeHead = iota
+	rewriteInHead
+	rewriteAfterHead
+	rewriteInBody
+)
+
+// A rewriteEntry is an element open in a rewriting.
+type rewriteEntry struct {
+	name    string
+	el      *RewriteElement // if the element has handlers
+	foreign bool            // in the SVG or MathML namespace
+}
+
+// A rewriting is the state of a Rewrite.
+type rewriting struct {
+	rw       *Rewriter
+	w        io.Writer
+	err      error
+	mode     int
+	stack    []rewriteEntry
+	suppress int // number of removed elements open
+}
+
+// Rewrite copies the document read from r to w, calling the handlers of
+// rw. It returns the first error of a handler, of r or of w.
+func (rw *Rewriter) Rewrite(w io.Writer, r io.Reader) error {
+	s := &rewriting{rw: rw, w: w}
+	z := NewTokenizer(r)
+	for s.err == nil {
+		tt := z.Next()
+		if tt == ErrorToken {
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			s.finish()
+			break
+		}
+		s.token(z, tt)
+	}
+	return s.err
+}
+
+// write writes content to the output, unless it is removed.
+func (s *rewriting) write(content ...string) {
+	if s.suppress > 0 || s.err != nil {
+		return
+	}
+	for _, c := range content {
+		if _, err := io.WriteString(s.w, c); err != nil {
+			s.err = err
+			return
+		}
+	}
+}
+
+// writeRaw writes the raw source of the current token.
+func (s *rewriting) writeRaw(z *Tokenizer) {
+	if s.suppress > 0 || s.err != nil {
+		return
+	}
+	if _, err := s.w.Write(z.Raw()); err != nil {
+		s.err = err
+	}
+}
+
+// headContent lists the elements which the parser keeps in the head.
+var headContent = map[string]bool{
+	"base": true, "basefont": true, "bgsound": true, "link": true, "meta": true,
+	"noframes": true, "noscript": true, "script": true, "style": true,
+	"template": true, "title": true,
+}
+
+func (s *rewriting) token(z *Tokenizer, tt TokenType) {
+	switch tt {
+	case TextToken:
+		if s.mode != rewriteInBody && !headContent[s.current()] &&
+			strings.Trim(string(z.Raw()), whitespace) != "" {
+			s.startBody()
+			s.mode = rewriteInBody
+			s.impliedElement("body")
+		}
+		s.text(z)
+	case StartTagToken, SelfClosingTagToken:
+		tok := z.Token()
+		s.beforeStartTag(tok.Data)
+		s.startTag(z, tok, false)
+	case EndTagToken:
+		name, _ := z.TagName()
+		s.endTag(z, string(name))
+	default:
+		s.writeRaw(z)
+	}
+}
+
+// beforeStartTag updates the insertion mode for the start tag name,
+// ending the head and implying the body when name starts the content of
+// the body.
+func (s *rewriting) beforeStartTag(name string) {
+	if s.mode == rewriteInBody {
+		return
+	}
+	switch {
+	case name == "html":
+		return
+	case name == "head" && s.mode == rewriteBeforeHead:
+		s.mode = rewriteInHead
+		return
+	case headContent[name]:
+		if s.mode == rewriteBeforeHead {
+			s.impliedElement("head")
+			s.mode = rewriteInHead
+		}
+		return
+	}
+	s.startBody()
+	s.mode = rewriteInBody
+	if name != "body" && name != "frameset" {
+		s.impliedElement("body")
+	}
+}
+
+// startBody ends the head, implying it if needed, and leaves the mode
+// after the head.
+func (s *rewriting) startBody() {
+	switch s.mode {
+	case rewriteBeforeHead:
+		s.impliedElement("head")
+		fallthrough
+	case rewriteInHead:
+		s.popUntil("head", nil)
+	}
+	s.mode = rewriteAfterHead
+}
+
+// text processes a text token.
+func (s *rewriting) text(z *Tokenizer) {
+	if len(s.rw.text) == 0 {
+		s.writeRaw(z)
+		return
+	}
+	t := &RewriteText{}
+	if len(s.stack) > 0 {
+		t.parent = s.stack[len(s.stack)-1].name
+	}
+	switch t.parent {
+	case "script", "style", "xmp", "iframe", "noembed", "noframes", "plaintext":
+		t.raw = true
+		t.text = string(z.Raw())
+	default:
+		t.text = string(z.Text())
+	}
+	for _, f := range s.rw.text {
+		if err := f(t); err != nil {
+			s.err = err
+			return
+		}
+	}
+	if t.content != nil {
+		s.write(*t.content)
+	} else {
+		s.writeRaw(z)
+	}
+}
+
+// impliedElement opens the element name, whose start tag is omitted.
+func (s *rewriting) impliedElement(name string) {
+	s.startTag(nil, Token{Type: StartTagToken, Data: name}, true)
+}
+
+// elementHandlers calls the handlers of the element of tok, returning nil
+// if there are none.
+func (s *rewriting) elementHandlers(tok Token, implied bool) *RewriteElement {
+	var el *RewriteElement
+	for _, h := range s.rw.elements {
+		if h.tag != tok.Data && h.tag != "*" {
+			continue
+		}
+		if el == nil {
+			el = &RewriteElement{tok: tok, implied: implied}
+		}
+		if err := h.f(el); err != nil {
+			s.err = err
+			return nil
+		}
+	}
+	return el
+}
+
+// startTag processes the start tag tok, read by z unless it is implied.
+func (s *rewriting) startTag(z *Tokenizer, tok Token, implied bool) {
+	name := tok.Data
+	foreign := name == "svg" || name == "math" || len(s.stack) > 0 && s.stack[len(s.stack)-1].foreign
+	if !foreign {
+		s.closeImplied(name)
+	}
+	el := s.elementHandlers(tok, implied)
+	if s.err != nil {
+		return
+	}
+	void := isVoidElement(name) && !foreign || foreign && tok.Type == SelfClosingTagToken
+	if el == nil {
+		if z != nil {
+			s.writeRaw(z)
+		}
+		if !void {
+			s.stack = append(s.stack, rewriteEntry{name: name, foreign: foreign})
+		}
+		return
+	}
+	el.void = void
+	s.write(el.before...)
+	if el.removed {
+		s.suppress++
+	}
+	if z != nil && !el.unwrapped {
+		if el.modified {
+			s.write(el.tok.String())
+		} else {
+			s.writeRaw(z)
+		}
+	}
+	if void {
+		if el.removed {
+			s.suppress--
+		}
+		s.write(el.after...)
+		return
+	}
+	s.write(el.prepend...)
+	s.stack = append(s.stack, rewriteEntry{name: name, el: el, foreign: foreign})
+}
+
+// endTag processes the end tag name read by z.
+func (s *rewriting) endTag(z *Tokenizer, name string) {
+	switch s.mode {
+	case rewriteBeforeHead, rewriteInHead:
+		if name == "head" {
+			if s.mode == rewriteBeforeHead {
+				s.impliedElement("head")
+			}
+			s.mode = rewriteAfterHead
+			s.popUntil("head", z)
+			return
+		}
+		if name != "body" && name != "html" && name != "br" {
+			break
+		}
+		s.startBody()
+		fallthrough
+	case rewriteAfterHead:
+		if name == "body" || name == "html" || name == "br" {
+			s.impliedElement("body")
+			s.mode = rewriteInBody
+		}
+	}
+	if !s.popUntil(name, z) {
+		// The end tag closes no open element: it is copied.
+		s.writeRaw(z)
+	}
+}
+
+// rewriteScope lists the elements which bound the search of the open
+// elements implicitly closed, as the default scope of the HTML standard.
+var rewriteScope = map[string]bool{
+	"applet": true, "caption": true, "html": true, "table": true, "td": true,
+	"th": true, "marquee": true, "object": true, "template": true,
+}
+
+// closesP lists the elements whose start tag closes an open p element.
+var closesP = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"center": true, "details": true, "dialog": true, "dir": true, "div": true,
+	"dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hgroup": true,
+	"hr": true, "li": true, "listing": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"summary": true, "table": true, "ul": true, "dd": true, "dt": true,
+	"plaintext": true, "xmp": true,
+}
+
+// closeImplied closes the open elements whose end tags are implied by the
+// start tag name.
+func (s *rewriting) closeImplied(name string) {
+	switch name {
+	case "li":
+		s.closeInScope(map[string]bool{"li": true}, "ol", "ul")
+	case "dd", "dt":
+		s.closeInScope(map[string]bool{"dd": true, "dt": true})
+	case "option":
+		s.closeCurrent("option")
+	case "optgroup":
+		s.closeCurrent("option")
+		s.closeCurrent("optgroup")
+	case "tr":
+		s.closeInScope(map[string]bool{"tr": true}, "tbody", "thead", "tfoot")
+	case "td", "th":
+		s.closeInScope(map[string]bool{"td": true, "th": true}, "tr")
+	case "tbody", "thead", "tfoot":
+		s.closeInScope(map[string]bool{"tbody": true, "thead": true, "tfoot": true})
+	}
+	if closesP[name] {
+		s.closeInScope(map[string]bool{"p": true}, "button")
+	}
+	switch name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		switch s.current() {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			s.pop(len(s.stack) - 1)
+		}
+	}
+}
+
+// current returns the name of the innermost open element.
+func (s *rewriting) current() string {
+	if len(s.stack) == 0 {
+		return ""
+	}
+	return s.stack[len(s.stack)-1].name
+}
+
+// closeCurrent closes the innermost open element if it is named name.
+func (s *rewriting) closeCurrent(name string) {
+	if s.current() == name {
+		s.pop(len(s.stack) - 1)
+	}
+}
+
+// closeInScope closes the innermost open element of names, and those
+// open in it, unless an element of the scope, or of stop, is open in it.
+func (s *rewriting) closeInScope(names map[string]bool, stop ...string) {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		e := s.stack[i]
+		if names[e.name] {
+			s.pop(i)
+			return
+		}
+		if rewriteScope[e.name] || e.foreign {
+			return
+		}
+		for _, n := range stop {
+			if e.name == n {
+				return
+			}
+		}
+	}
+}
+
+// popUntil closes the innermost open element name, and those open in it,
+// writing the end tag read by z, if non-nil. It reports whether the
+// element was open.
+func (s *rewriting) popUntil(name string, z *Tokenizer) bool {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		e := s.stack[i]
+		if e.name == name {
+			s.pop(i + 1)
+			s.close(e, z)
+			s.stack = s.stack[:i]
+			return true
+		}
+		if rewriteScope[e.name] {
+			return false
+		}
+	}
+	return false
+}
+
+// pop closes the open elements from the index i, whose end tags are
+// implied.
+func (s *rewriting) pop(i int) {
+	for j := len(s.stack) - 1; j >= i; j-- {
+		s.close(s.stack[j], nil)
+	}
+	s.stack = s.stack[:i]
+}
+
+// close writes the end of the element of e, with the end tag read by z,
+// if non-nil.
+func (s *rewriting) close(e rewriteEntry, z *Tokenizer) {
+	el := e.el
+	if el == nil {
+		if z != nil {
+			s.writeRaw(z)
+		}
+		return
+	}
+	s.write(el.append...)
+	if z != nil && !el.unwrapped {
+		s.writeRaw(z)
+	}
+	if el.removed {
+		s.suppress--
+	}
+	s.write(el.after...)
+}
+
+// finish closes the elements open at the end of the document, implying
+// the head and the body if they are missing.
+func (s *rewriting) finish() {
+	if s.mode == rewriteBeforeHead || s.mode == rewriteInHead {
+		s.startBody()
+	}
+	if s.mode == rewriteAfterHead {
+		s.impliedElement("body")
+	}
+	s.pop(0)
+}
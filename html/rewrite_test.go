@@ -0,0 +1,208 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRewriteCopy(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"<!DOCTYPE html><html><head><title>x</title></head><body><p>a<p>b</body></html>",
+		"<p class=a   id='b'>x &amp; y<br/><svg><path/></svg><!-- c --></p></div>",
+		"<script>if (a < b) {}</script><table><tr><td>1<td>2</table>",
+	} {
+		var rw Rewriter
+		var b strings.Builder
+		if err := rw.Rewrite(&b, strings.NewReader(src)); err != nil {
+			t.Fatalf("Rewrite(%q): %v", src, err)
+		}
+		if got := b.String(); got != src {
+			t.Errorf("Rewrite(%q) = %q", src, got)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		desc string
+		init func(rw *Rewriter)
+		src  string
+		want string
+	}{
+		{
+			"append to explicit head",
+			func(rw *Rewriter) {
+				rw.OnElement("head", func(e *RewriteElement) error {
+					e.Append("<script src=a.js></script>")
+					return nil
+				})
+			},
+			"<html><head><title>t</title></head><body>x</body></html>",
+			"<html><head><title>t</title><script src=a.js></script></head><body>x</body></html>",
+		},
+		{
+			"append to implied head",
+			func(rw *Rewriter) {
+				rw.OnElement("head", func(e *RewriteElement) error {
+					if !e.Implied() {
+						return errors.New("head not implied")
+					}
+					e.Append("<meta charset=utf-8>")
+					return nil
+				})
+			},
+			"<!DOCTYPE html><title>t</title><p>x",
+			"<!DOCTYPE html><title>t</title><meta charset=utf-8><p>x",
+		},
+		{
+			"append to implied head without content",
+			func(rw *Rewriter) {
+				rw.OnElement("head", func(e *RewriteElement) error {
+					e.Append("<base href=/>")
+					return nil
+				})
+			},
+			"hello",
+			"<base href=/>hello",
+		},
+		{
+			"append to implied body",
+			func(rw *Rewriter) {
+				rw.OnElement("body", func(e *RewriteElement) error {
+					e.Prepend("[")
+					e.Append("]")
+					return nil
+				})
+			},
+			"<title>t</title>\n<div>x</div>\n",
+			"<title>t</title>\n[<div>x</div>\n]",
+		},
+		{
+			"rewrite attributes",
+			func(rw *Rewriter) {
+				rw.OnElement("img", func(e *RewriteElement) error {
+					if src, ok := e.Attr("src"); ok {
+						e.SetAttr("src", "/cdn/"+src)
+					}
+					e.RemoveAttr("width")
+					return nil
+				})
+			},
+			`<p><img src="a.png" width=10><img alt="b"></p>`,
+			`<p><img src="/cdn/a.png"><img alt="b"></p>`,
+		},
+		{
+			"implied end of p",
+			func(rw *Rewriter) {
+				rw.OnElement("p", func(e *RewriteElement) error {
+					e.Append("!")
+					return nil
+				})
+			},
+			"<p>a<p>b<div>c</div><p>d</p>",
+			"<p>a!<p>b!<div>c</div><p>d!</p>",
+		},
+		{
+			"implied end of li",
+			func(rw *Rewriter) {
+				rw.OnElement("li", func(e *RewriteElement) error {
+					e.After("\n")
+					return nil
+				})
+			},
+			"<ul><li>a<li>b<ol><li>c</ol></ul>",
+			"<ul><li>a\n<li>b<ol><li>c\n</ol>\n</ul>",
+		},
+		{
+			"remove",
+			func(rw *Rewriter) {
+				rw.OnElement("script", func(e *RewriteElement) error {
+					e.Before("<!-- removed -->")
+					e.Remove()
+					return nil
+				})
+			},
+			"<p>a<script>b()</script>c</p>",
+			"<p>a<!-- removed -->c</p>",
+		},
+		{
+			"unwrap",
+			func(rw *Rewriter) {
+				rw.OnElement("span", func(e *RewriteElement) error {
+					e.Unwrap()
+					return nil
+				})
+			},
+			"<p><span class=x>a<b>b</b></span></p>",
+			"<p>a<b>b</b></p>",
+		},
+		{
+			"text",
+			func(rw *Rewriter) {
+				rw.OnText(func(t *RewriteText) error {
+					switch t.Parent() {
+					case "b":
+						t.SetText(strings.ToUpper(t.Text()) + " & co")
+					case "script":
+						t.SetText(t.Text() + "<1")
+					case "i":
+						t.Remove()
+					}
+					return nil
+				})
+			},
+			"<b>a&lt;b</b><i>x</i><script>if (a<2) {}</script>",
+			"<b>A&lt;B &amp; co</b><i></i><script>if (a<2) {}<1</script>",
+		},
+		{
+			"unmatched end tag",
+			func(rw *Rewriter) {
+				rw.OnElement("div", func(e *RewriteElement) error {
+					e.Append("!")
+					return nil
+				})
+			},
+			"<div><table><tr><td></div></td></tr></table></div>",
+			"<div><table><tr><td></div></td></tr></table>!</div>",
+		},
+		{
+			"end of document",
+			func(rw *Rewriter) {
+				rw.OnElement("*", func(e *RewriteElement) error {
+					e.Append("</" + e.TagName() + ">")
+					return nil
+				})
+			},
+			"<div><p>a",
+			"</head><div><p>a</p></div></body>",
+		},
+	}
+	for _, tc := range tests {
+		var rw Rewriter
+		tc.init(&rw)
+		var b strings.Builder
+		if err := rw.Rewrite(&b, strings.NewReader(tc.src)); err != nil {
+			t.Errorf("%s: %v", tc.desc, err)
+			continue
+		}
+		if got := b.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestRewriteHandlerError(t *testing.T) {
+	errStop := errors.New("stop")
+	var rw Rewriter
+	rw.OnElement("b", func(e *RewriteElement) error { return errStop })
+	var b strings.Builder
+	if err := rw.Rewrite(&b, strings.NewReader("<p>a<b>b</b>")); err != errStop {
+		t.Errorf("Rewrite: got %v, want %v", err, errStop)
+	}
+}
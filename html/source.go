@@ -0,0 +1,453 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	a "golang.org/x/net/html/atom"
+)
+
+// ParseOptionPreserveSource configures the parser to record the source of
+// the nodes it creates, so that Render writes the original bytes of the
+// nodes that have not been modified since: entity and character
+// references, the case of tag names, the quoting of attribute values, and
+// the whitespace within tags and between the nodes of the tree. Omitted
+// end tags and implied elements such as tbody stay omitted. Editing a
+// node, for example by setting one attribute, only changes the rendering
+// of that node (or that attribute), which lets tools rewrite documents
+// with minimal differences.
+//
+// A node is unmodified if its Data, and the Attr of an element, are
+// unchanged. Elements created by the program, or whose Data has changed,
+// are rendered as usual. Attributes are matched by value, so reordering
+// them reorders their source too.
+//
+// The source is not preserved exactly where the parser does not keep it
+// in the tree: tags and text that the parser ignores are dropped, text and
+// elements that it moves (such as text foster parented out of a table, or
+// formatting elements reopened after a misnested end tag) are rendered at
+// their new place, and text that it normalizes (such as NUL characters or
+// line breaks) is rendered as usual. The parser checks that the tree
+// rendered from the source parses to the same tree, which takes a second
+// parse, and if it does not, for example because of misnested tags, the
+// tags of all the elements are rendered, or else the source is dropped.
+func ParseOptionPreserveSource(enable bool) ParseOption {
+	return func(p *parser) {
+		p.preserve = enable
+	}
+}
+
+// nodeSource is the source of a node, recorded by the parser.
+type nodeSource struct {
+	// data is the Data of the node as parsed. The node is rendered from
+	// its source only while its Data is unchanged.
+	data string
+	// raw is the source of the token which created the node. For
+	// elements, it is the start tag, split into head (the '<' and the
+	// tag name), the segments of each attribute including the whitespace
+	// before it, and the tail up to and including the closing '>'.
+	raw     string
+	head    string
+	attrSrc []string
+	attr    []Attribute
+	tail    string
+	// endRaw is the source of the end tag of an element, if any, followed
+	// by whitespace which the parser added inside the element after it
+	// was closed. For the document node, it is the whitespace left over
+	// at the end of the input.
+	endRaw string
+	// before is source preceding the node which the parser did not keep,
+	// such as ignored whitespace.
+	before string
+	// implied is whether the node is an element without a start tag in the
+	// source, such as an implied body or tbody.
+	implied bool
+	// explicit is whether to render the start tag of an implied element,
+	// and the end tag of an element without one in the source.
+	explicit bool
+}
+
+// source returns the source of the current token.
+func (z *Tokenizer) source() *nodeSource {
+	s := &nodeSource{raw: string(z.buf[z.raw.start:z.raw.end])}
+	if z.tt != StartTagToken && z.tt != SelfClosingTagToken {
+		return s
+	}
+	prev := z.data.end - z.raw.start
+	s.head = s.raw[:prev]
+	for _, kv := range z.attr {
+		key, val := kv[0], kv[1]
+		// The attribute ends after its value, including the closing
+		// quote of a quoted value, or else after its key.
+		end := key.end
+		if val.start > key.end && val.end < z.raw.end {
+			if q := z.buf[val.start-1]; (q == '"' || q == '\'') && z.buf[val.end] == q {
+				end = val.end + 1
+			}
+		}
+		if val.end > val.start && val.end > end {
+			end = val.end
+		}
+		if end -= z.raw.start; end < prev {
+			end = prev
+		}
+		s.attrSrc = append(s.attrSrc, s.raw[prev:end])
+		prev = end
+	}
+	s.tail = s.raw[prev:]
+	return s
+}
+
+// takeSource returns the source of the current token, if it has not been
+// used yet, with the pending source which precedes it.
+func (p *parser) takeSource() *nodeSource {
+	s := p.src
+	p.src = nil
+	if s != nil {
+		s.before = p.pendingSrc + s.before
+		p.pendingSrc = ""
+	}
+	return s
+}
+
+// elementSource returns the source of the element n being added for the
+// current token, if any.
+func (p *parser) elementSource(n *Node) *nodeSource {
+	if p.src == nil {
+		return nil
+	}
+	s := p.takeSource()
+	s.data = n.Data
+	s.attr = append([]Attribute(nil), n.Attr...)
+	return s
+}
+
+// textSource returns the source of text being added to the tree for the
+// current token, if any. The parser may add the text of a token in parts,
+// or drop its leading whitespace.
+func (p *parser) textSource(text string) *nodeSource {
+	s := p.src
+	if s == nil || p.tok.Type != TextToken {
+		return nil
+	}
+	switch {
+	case text == s.data:
+		return p.takeSource()
+	case strings.HasSuffix(s.data, text):
+		skip := s.data[:len(s.data)-len(text)]
+		if strings.Trim(skip, whitespace) != "" || !strings.HasPrefix(s.raw, skip) {
+			return nil
+		}
+		s = p.takeSource()
+		s.before += skip
+		s.data, s.raw = text, s.raw[len(skip):]
+		return s
+	case strings.HasPrefix(s.data, text):
+		if strings.Trim(text, whitespace) != "" || !strings.HasPrefix(s.raw, text) {
+			return nil
+		}
+		s.data, s.raw = s.data[len(text):], s.raw[len(text):]
+		before := p.pendingSrc
+		p.pendingSrc = ""
+		return &nodeSource{data: text, raw: text, before: before}
+	}
+	return nil
+}
+
+// addTextSource records the source s of the text added to the text node
+// n, which was empty or had the Data old.
+func (p *parser) addTextSource(n *Node, old string, s *nodeSource) {
+	if s == nil {
+		if n.src != nil {
+			n.src.data = ""
+		}
+		return
+	}
+	// Whitespace added inside an element after its end tag, such as
+	// whitespace following </body>, belongs after the outermost closed
+	// element.
+	var closed *Node
+	for e := n.Parent; e != nil; e = e.Parent {
+		if e.src != nil && e.src.endRaw != "" {
+			closed = e
+		}
+	}
+	if closed != nil {
+		closed.src.endRaw += s.before + s.raw
+		s.before, s.raw = "", ""
+	}
+	switch {
+	case old == "":
+		n.src = s
+	case n.src == nil:
+	case n.src.data == old && s.before == "":
+		n.src.data += s.data
+		n.src.raw += s.raw
+	default:
+		n.src.data = ""
+	}
+}
+
+// parseSourceToken parses the current token, recording the source of the
+// nodes it creates.
+func (p *parser) parseSourceToken() {
+	p.src = p.tokenizer.source()
+	p.tok = p.tokenizer.Token()
+	p.src.data = p.tok.Data
+	tt := p.tok.Type
+	var oe nodeStack
+	if tt == EndTagToken {
+		oe = append(oe, p.oe...)
+	}
+	p.parseCurrentToken()
+	if p.src == nil {
+		return
+	}
+	switch tt {
+	case TextToken:
+		if strings.Trim(p.src.raw, whitespace) == "" {
+			p.pendingSrc += p.src.raw
+		}
+	case CommentToken, DoctypeToken:
+		nt := CommentNode
+		if tt == DoctypeToken {
+			nt = DoctypeNode
+		}
+		candidates := []*Node{p.doc}
+		if len(p.oe) > 0 {
+			candidates = append(candidates, p.oe[0], p.oe.top())
+		}
+		for _, c := range candidates {
+			if n := c.LastChild; n != nil && n.Type == nt && n.src == nil {
+				n.src = p.takeSource()
+				n.src.data = n.Data
+				break
+			}
+		}
+	case EndTagToken:
+		p.endTagSource(oe)
+	}
+	p.src = nil
+}
+
+// endTagSource records the source of the current end tag on the element
+// it closed. oe is the stack of open elements before the end tag.
+func (p *parser) endTagSource(oe nodeStack) {
+	name := p.src.data
+	var closed *Node
+	for i := len(oe) - 1; i >= 0; i-- {
+		n := oe[i]
+		if p.oe.index(n) < 0 && strings.EqualFold(n.Data, name) && (n.src == nil || n.src.endRaw == "") {
+			closed = n
+			break
+		}
+	}
+	if closed == nil {
+		// The parser keeps the html and body elements open after their
+		// end tags.
+		switch a.Lookup([]byte(name)) {
+		case a.Body, a.Html:
+			for i := len(oe) - 1; i >= 0; i-- {
+				if n := oe[i]; n.Data == name && n.Namespace == "" && (n.src == nil || n.src.endRaw == "") {
+					closed = n
+					break
+				}
+			}
+		case a.P:
+			// A </p> without an open p element closes a new, empty one.
+			if n := p.top().LastChild; n != nil && n.Type == ElementNode && n.DataAtom == a.P && n.src == nil {
+				closed = n
+			}
+		}
+	}
+	if closed == nil {
+		return
+	}
+	if closed.src == nil {
+		closed.src = &nodeSource{implied: true}
+	}
+	s := p.takeSource()
+	closed.src.endRaw = s.before + s.raw
+}
+
+// finishSource marks the elements of the tree rooted at n which have no
+// source as implied.
+func finishSource(n *Node) {
+	if n.Type == ElementNode && n.src == nil {
+		n.src = &nodeSource{implied: true}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		finishSource(c)
+	}
+}
+
+// writeSource writes the source of the text, comment or doctype node n if
+// it is unchanged, and reports whether it did. It writes the source
+// preceding n in any case.
+func writeSource(w writer, n *Node) (bool, error) {
+	if _, err := w.WriteString(n.src.before); err != nil {
+		return false, err
+	}
+	if n.Data != n.src.data {
+		return false, nil
+	}
+	_, err := w.WriteString(n.src.raw)
+	return true, err
+}
+
+// renderSourceElement renders the element n, parsed with
+// ParseOptionPreserveSource, from its source.
+func renderSourceElement(w writer, n *Node) error {
+	s := n.src
+	if _, err := w.WriteString(s.before); err != nil {
+		return err
+	}
+	switch {
+	case !s.implied:
+		if _, err := w.WriteString(s.head); err != nil {
+			return err
+		}
+		used := make([]bool, len(s.attr))
+	attrs:
+		for _, attr := range n.Attr {
+			for i, sa := range s.attr {
+				if !used[i] && i < len(s.attrSrc) && sa == attr {
+					used[i] = true
+					if _, err := w.WriteString(s.attrSrc[i]); err != nil {
+						return err
+					}
+					continue attrs
+				}
+			}
+			if err := writeAttr(w, attr); err != nil {
+				return err
+			}
+		}
+		if _, err := w.WriteString(s.tail); err != nil {
+			return err
+		}
+	case len(n.Attr) > 0 || s.explicit:
+		// The parser may have added the attributes of a later start tag
+		// to an implied html or body element.
+		if err := w.WriteByte('<'); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(n.Data); err != nil {
+			return err
+		}
+		for _, attr := range n.Attr {
+			if err := writeAttr(w, attr); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteByte('>'); err != nil {
+			return err
+		}
+	}
+	if isVoidElement(n.Data) {
+		if n.FirstChild != nil {
+			return fmt.Errorf("html: void element <%s> has child nodes", n.Data)
+		}
+		return nil
+	}
+	if err := renderChildren(w, n); err != nil {
+		return err
+	}
+	if s.endRaw == "" && s.explicit {
+		if _, err := w.WriteString("</"); err != nil {
+			return err
+		}
+		if _, err := w.WriteString(n.Data); err != nil {
+			return err
+		}
+		return w.WriteByte('>')
+	}
+	_, err := w.WriteString(s.endRaw)
+	return err
+}
+
+// checkSource checks that the nodes, rendered from their source and
+// parsed again with reparse, result in the same nodes. Misnested tags may
+// not survive the omission of end tags, or the source of the nodes may
+// not describe the tree at all, so if they do not, it renders the tags of
+// all elements, and then, if that is not enough, drops the source.
+func checkSource(nodes []*Node, reparse func(io.Reader) ([]*Node, error)) {
+	if sourceRendersAs(nodes, reparse) {
+		return
+	}
+	for _, n := range nodes {
+		walkSource(n, func(s *nodeSource) { s.explicit = true })
+	}
+	if sourceRendersAs(nodes, reparse) {
+		return
+	}
+	for _, n := range nodes {
+		dropSource(n)
+	}
+}
+
+// sourceRendersAs reports whether rendering the nodes and parsing the
+// result with reparse gives the same nodes.
+func sourceRendersAs(nodes []*Node, reparse func(io.Reader) ([]*Node, error)) bool {
+	var b bytes.Buffer
+	for _, n := range nodes {
+		if err := render(&b, n); err != nil {
+			return false
+		}
+	}
+	got, err := reparse(&b)
+	if err != nil || len(got) != len(nodes) {
+		return false
+	}
+	for i, n := range nodes {
+		if !sameTree(n, got[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTree reports whether the trees rooted at m and n have the same
+// nodes.
+func sameTree(m, n *Node) bool {
+	if m.Type != n.Type || m.DataAtom != n.DataAtom || m.Data != n.Data || m.Namespace != n.Namespace || len(m.Attr) != len(n.Attr) {
+		return false
+	}
+	for i := range m.Attr {
+		if m.Attr[i] != n.Attr[i] {
+			return false
+		}
+	}
+	mc, nc := m.FirstChild, n.FirstChild
+	for ; mc != nil && nc != nil; mc, nc = mc.NextSibling, nc.NextSibling {
+		if !sameTree(mc, nc) {
+			return false
+		}
+	}
+	return mc == nil && nc == nil
+}
+
+// walkSource calls f with the source of the elements of the tree rooted
+// at n.
+func walkSource(n *Node, f func(*nodeSource)) {
+	if n.Type == ElementNode && n.src != nil {
+		f(n.src)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkSource(c, f)
+	}
+}
+
+// dropSource drops the source of the nodes of the tree rooted at n.
+func dropSource(n *Node) {
+	n.src = nil
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		dropSource(c)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html/atom"
+)
+
+func parsePreserved(t *testing.T, s string) *Node {
+	t.Helper()
+	doc, err := ParseWithOptions(strings.NewReader(s), ParseOptionPreserveSource(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func renderString(t *testing.T, n *Node) string {
+	t.Helper()
+	var b strings.Builder
+	if err := Render(&b, n); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+const preserveDoc = "<!DOCTYPE html>\n" +
+	"<html lang=en>\n" +
+	"<head>\n" +
+	"  <meta charset='utf-8'>\n" +
+	"  <title>A &amp; B</title>\n" +
+	"</head>\n" +
+	"<BODY class=x>\n" +
+	"<P ID=\"a\"  data-x='1'>caf&eacute; &#169;&nbsp;<br/>\n" +
+	"<A HREF=/x>link</A></P>\n" +
+	"<!-- comment -->\n" +
+	"<table><tr><td>1<td>2</table>\n" +
+	"<ul><li>a<li>b</ul>\n" +
+	"<script>if (a < b && c) {}</script>\n" +
+	"<input disabled value=\"\">\n" +
+	"</BODY>\n" +
+	"</html>\n"
+
+func TestPreserveSourceRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		preserveDoc,
+		"",
+		"<p>Hello, <b>world</b>",
+		"  <title>x</title>\n<p>a",
+		"<pre>\nfoo</pre>",
+		"<textarea>\n\nx</textarea>",
+		"<html> <head> </head> <body> x </body> </html> ",
+		"<svg viewBox='0 0 1 1'><use xlink:href='#a'/></svg>",
+		"<p>a</p></p>",
+		"<table><tr><td>a</table>",
+		"<!doctype html PUBLIC \"-//W3C//DTD HTML 4.01//EN\"><p>x",
+	} {
+		if got := renderString(t, parsePreserved(t, s)); got != s {
+			t.Errorf("round trip of %q\ngot  %q", s, got)
+		}
+	}
+}
+
+func TestPreserveSourceMisnested(t *testing.T) {
+	// The source of misnested tags does not describe the tree, which is
+	// rendered so that it parses the same.
+	const s = "<b>1<p>2</b>3</p>"
+	got := renderString(t, parsePreserved(t, s))
+	doc, err := Parse(strings.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTree(doc, want) {
+		t.Errorf("rendering of %q is %q, which parses to a different tree", s, got)
+	}
+}
+
+func TestPreserveSourceEdit(t *testing.T) {
+	doc := parsePreserved(t, preserveDoc)
+	var walk func(*Node)
+	walk = func(n *Node) {
+		switch {
+		case n.Type == ElementNode && n.DataAtom == atom.A:
+			n.Attr[0].Val = "/y?a=1&b=2"
+		case n.Type == ElementNode && n.DataAtom == atom.Ul:
+			n.Attr = append(n.Attr, Attribute{Key: "id", Val: "list"})
+		case n.Type == TextNode && n.Data == "link":
+			n.Data = "<link>"
+		case n.Type == ElementNode && n.DataAtom == atom.Li && n.PrevSibling == nil:
+			n.AppendChild(&Node{Type: ElementNode, DataAtom: atom.Em, Data: "em"})
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	want := strings.NewReplacer(
+		"<A HREF=/x>link</A>", `<A href="/y?a=1&amp;b=2">&lt;link&gt;</A>`,
+		"<ul><li>a<li>", `<ul id="list"><li>a<em></em><li>`,
+	).Replace(preserveDoc)
+	if got := renderString(t, doc); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestPreserveSourceFragment(t *testing.T) {
+	const s = "<td class=a>x &lt; y</td>\n<td>z"
+	context := &Node{Type: ElementNode, DataAtom: atom.Tr, Data: "tr"}
+	nodes, err := ParseFragmentWithOptions(strings.NewReader(s), context, ParseOptionPreserveSource(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	for _, n := range nodes {
+		got.WriteString(renderString(t, n))
+	}
+	if got.String() != s {
+		t.Errorf("got %q; want %q", got.String(), s)
+	}
+}
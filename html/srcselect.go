@@ -0,0 +1,650 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
+
+// A Viewport describes the display and the capabilities of a browser, for
+// SelectSource.
+type Viewport struct {
+	// Width and Height are the size of the viewport, in CSS pixels.
+	Width, Height float64
+
+	// DevicePixelRatio is the number of device pixels per CSS pixel. Zero
+	// means 1.
+	DevicePixelRatio float64
+
+	// SupportsType optionally reports whether the browser supports the
+	// MIME type of the type attribute of a source element, such as
+	// "image/avif" or `video/mp4; codecs="avc1.42E01E"`. If nil, all
+	// types are supported.
+	SupportsType func(mimeType string) bool
+
+	// MatchMedia optionally reports whether a media query list, or the
+	// media condition of a sizes attribute, matches. If nil, the queries
+	// are evaluated by SelectSource, which knows the media types all and
+	// screen and the features width, height, aspect-ratio, orientation,
+	// resolution and -webkit-device-pixel-ratio, with their min- and
+	// max- prefixes and in range syntax. Queries using anything else do
+	// not match.
+	MatchMedia func(query string) bool
+}
+
+// A SelectedSource is the source of an element chosen by SelectSource.
+type SelectedSource struct {
+	// Node is the element holding the URL, such as a source element of a
+	// picture or video element.
+	Node *Node
+
+	// URL is the URL as found in the attribute of Node, which may be
+	// relative. See URLResolver.
+	URL string
+
+	// Density is the pixel density of an image, in image pixels per CSS
+	// pixel, or 0 for a media element.
+	Density float64
+}
+
+// SelectSource returns the source which a browser with the viewport v
+// would fetch for the element n, following the selection algorithms of
+// the HTML standard. For an img element, the srcset and sizes attributes
+// of n and of the source elements of a picture parent are taken into
+// account, subject to their media and type attributes, and the image
+// candidate of the lowest density at least v.DevicePixelRatio is chosen,
+// or else that of the highest density. For a video or audio element, it
+// is its src attribute or the first source child whose media and type
+// attributes match. It reports false if n is not such an element, or has
+// no source.
+//
+// See https://html.spec.whatwg.org/multipage/images.html#update-the-source-set
+// and https://html.spec.whatwg.org/multipage/media.html#concept-media-load-algorithm
+func SelectSource(n *Node, v Viewport) (SelectedSource, bool) {
+	if n.Type != ElementNode || n.Namespace != "" {
+		return SelectedSource{}, false
+	}
+	switch n.DataAtom {
+	case atom.Img:
+		return selectImageSource(n, &v)
+	case atom.Video, atom.Audio:
+		if src, ok := htmlAttr(n, "src"); ok {
+			return SelectedSource{Node: n, URL: src}, src != ""
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !isHTMLElement(c, atom.Source) || !v.match(c) {
+				continue
+			}
+			if src, _ := htmlAttr(c, "src"); src != "" {
+				return SelectedSource{Node: c, URL: src}, true
+			}
+		}
+	}
+	return SelectedSource{}, false
+}
+
+func selectImageSource(img *Node, v *Viewport) (SelectedSource, bool) {
+	if p := img.Parent; p != nil && isHTMLElement(p, atom.Picture) {
+		for c := p.FirstChild; c != nil && c != img; c = c.NextSibling {
+			if !isHTMLElement(c, atom.Source) {
+				continue
+			}
+			srcset, _ := htmlAttr(c, "srcset")
+			if srcset == "" || !v.match(c) {
+				continue
+			}
+			if s, ok := v.choose(c, imageSourceSet(c, srcset, "", v)); ok {
+				return s, true
+			}
+		}
+	}
+	srcset, _ := htmlAttr(img, "srcset")
+	src, _ := htmlAttr(img, "src")
+	return v.choose(img, imageSourceSet(img, srcset, src, v))
+}
+
+type imageSource struct {
+	url     string
+	density float64
+}
+
+// imageSourceSet returns the image sources of the element n, parsed from
+// its srcset and sizes attributes, with src as a 1x candidate if there
+// is no such candidate nor any width descriptor.
+func imageSourceSet(n *Node, srcset, src string, v *Viewport) []imageSource {
+	var set []imageSource
+	var size float64
+	hasWidth, has1x := false, false
+	seen := make(map[float64]bool)
+	for _, c := range parseSrcset(srcset) {
+		density := 1.0
+		switch fields := strings.Fields(c.descriptor); len(fields) {
+		case 0:
+		case 1:
+			d := fields[0]
+			if len(d) < 2 {
+				continue
+			}
+			f, ok := parseNumber(d[:len(d)-1])
+			if !ok || f <= 0 {
+				continue
+			}
+			switch d[len(d)-1] {
+			case 'x':
+				density = f
+			case 'w':
+				if size == 0 {
+					sizes, _ := htmlAttr(n, "sizes")
+					size = v.sourceSize(sizes)
+				}
+				density = f / size
+				hasWidth = true
+			default:
+				continue
+			}
+		default:
+			// Height descriptors, and several descriptors, are not
+			// supported.
+			continue
+		}
+		if seen[density] {
+			continue
+		}
+		seen[density] = true
+		has1x = has1x || density == 1
+		set = append(set, imageSource{c.url, density})
+	}
+	if src != "" && !has1x && !hasWidth {
+		set = append(set, imageSource{src, 1})
+	}
+	return set
+}
+
+// choose returns the image source of set of the lowest density which is
+// at least the device pixel ratio, or else that of the highest density.
+func (v *Viewport) choose(n *Node, set []imageSource) (SelectedSource, bool) {
+	if len(set) == 0 {
+		return SelectedSource{}, false
+	}
+	dpr := v.DevicePixelRatio
+	if dpr <= 0 {
+		dpr = 1
+	}
+	best := set[0]
+	for _, s := range set[1:] {
+		switch {
+		case best.density < dpr && s.density > best.density:
+			best = s
+		case best.density >= dpr && s.density >= dpr && s.density < best.density:
+			best = s
+		}
+	}
+	return SelectedSource{Node: n, URL: best.url, Density: best.density}, true
+}
+
+// sourceSize returns the size, in CSS pixels, of the first entry of the
+// sizes attribute whose media condition matches, or the viewport width.
+func (v *Viewport) sourceSize(sizes string) float64 {
+	for _, entry := range strings.Split(sizes, ",") {
+		entry = strings.Trim(entry, asciiWhitespace)
+		// The length follows the condition, if any. Lengths such as
+		// calc() are not supported.
+		cond, length := "", entry
+		if i := strings.LastIndexByte(entry, ')'); i >= 0 {
+			cond, length = entry[:i+1], strings.Trim(entry[i+1:], asciiWhitespace)
+		}
+		size, ok := v.length(length)
+		if !ok || size < 0 {
+			continue
+		}
+		if cond == "" || v.matchMedia(cond, true) {
+			return nonZeroSize(size)
+		}
+	}
+	return nonZeroSize(v.Width)
+}
+
+// nonZeroSize returns size, or 1 for a zero size, which would give
+// infinite densities.
+func nonZeroSize(size float64) float64 {
+	if size <= 0 {
+		return 1
+	}
+	return size
+}
+
+// match reports whether the media and type attributes of the source
+// element n match.
+func (v *Viewport) match(n *Node) bool {
+	if media, ok := htmlAttr(n, "media"); ok && !v.matchMedia(media, false) {
+		return false
+	}
+	if typ, ok := htmlAttr(n, "type"); ok && v.SupportsType != nil && !v.SupportsType(strings.Trim(typ, asciiWhitespace)) {
+		return false
+	}
+	return true
+}
+
+// matchMedia reports whether the media query list q matches, or the
+// media condition q if cond.
+func (v *Viewport) matchMedia(q string, cond bool) bool {
+	q = strings.Trim(q, asciiWhitespace)
+	if q == "" {
+		return true
+	}
+	if v.MatchMedia != nil {
+		return v.MatchMedia(q)
+	}
+	if cond {
+		p := mediaParser{s: strings.ToLower(q), v: v}
+		m, ok := p.condition(true)
+		return ok && p.done() && m
+	}
+	for _, query := range splitTopLevel(strings.ToLower(q)) {
+		p := mediaParser{s: query, v: v}
+		if m, ok := p.query(); ok && p.done() && m {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTopLevel splits s at the commas outside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// A mediaParser evaluates a lower-case media query against a Viewport.
+type mediaParser struct {
+	s string
+	v *Viewport
+}
+
+func (p *mediaParser) skipSpace() {
+	p.s = strings.TrimLeft(p.s, asciiWhitespace)
+}
+
+func (p *mediaParser) done() bool {
+	p.skipSpace()
+	return p.s == ""
+}
+
+// keyword consumes the identifier w.
+func (p *mediaParser) keyword(w string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.s, w) {
+		return false
+	}
+	if rest := p.s[len(w):]; rest != "" && !strings.ContainsAny(rest[:1], asciiWhitespace+"(") {
+		return false
+	}
+	p.s = p.s[len(w):]
+	return true
+}
+
+// query evaluates a media query: a media condition, or a media type
+// optionally followed by "and" and a media condition without "or".
+func (p *mediaParser) query() (match, ok bool) {
+	p.skipSpace()
+	if strings.HasPrefix(p.s, "(") || strings.HasPrefix(p.s, "not (") || strings.HasPrefix(p.s, "not(") {
+		return p.condition(true)
+	}
+	not := p.keyword("not")
+	if !not {
+		p.keyword("only")
+	}
+	p.skipSpace()
+	i := 0
+	for i < len(p.s) && (isASCIILetter(p.s[i]) || p.s[i] == '-') {
+		i++
+	}
+	typ := p.s[:i]
+	p.s = p.s[i:]
+	switch typ {
+	case "all", "screen":
+		match = true
+	case "print", "speech", "tty", "tv", "projection", "handheld", "braille", "embossed", "aural":
+	default:
+		return false, false
+	}
+	if p.keyword("and") {
+		m, ok := p.condition(false)
+		if !ok {
+			return false, false
+		}
+		match = match && m
+	}
+	return match != not, true
+}
+
+// condition evaluates a media condition, with "or" if allowOr.
+func (p *mediaParser) condition(allowOr bool) (match, ok bool) {
+	if p.keyword("not") {
+		m, ok := p.inParens()
+		return !m, ok
+	}
+	match, ok = p.inParens()
+	if !ok {
+		return false, false
+	}
+	op := ""
+	for {
+		switch {
+		case p.keyword("and") && op != "or":
+			op = "and"
+		case allowOr && p.keyword("or") && op != "and":
+			op = "or"
+		default:
+			return match, true
+		}
+		m, ok := p.inParens()
+		if !ok {
+			return false, false
+		}
+		if op == "and" {
+			match = match && m
+		} else {
+			match = match || m
+		}
+	}
+}
+
+// inParens evaluates a parenthesized media condition or media feature.
+func (p *mediaParser) inParens() (match, ok bool) {
+	p.skipSpace()
+	if !strings.HasPrefix(p.s, "(") {
+		return false, false
+	}
+	depth, end := 0, -1
+	for i := 0; i < len(p.s) && end < 0; i++ {
+		switch p.s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return false, false
+	}
+	inner := strings.Trim(p.s[1:end], asciiWhitespace)
+	p.s = p.s[end+1:]
+	if strings.HasPrefix(inner, "(") || strings.HasPrefix(inner, "not") {
+		q := mediaParser{s: inner, v: p.v}
+		m, ok := q.condition(true)
+		return m, ok && q.done()
+	}
+	return p.v.feature(inner), true
+}
+
+// feature evaluates a media feature, such as "min-width: 600px" or
+// "width >= 600px". Unknown features do not match.
+func (v *Viewport) feature(f string) bool {
+	if i := strings.IndexByte(f, ':'); i >= 0 {
+		name := strings.Trim(f[:i], asciiWhitespace)
+		val := strings.Trim(f[i+1:], asciiWhitespace)
+		op := "="
+		switch {
+		case strings.HasPrefix(name, "min-"):
+			name, op = name[len("min-"):], ">="
+		case strings.HasPrefix(name, "max-"):
+			name, op = name[len("max-"):], "<="
+		case strings.HasPrefix(name, "-webkit-min-"):
+			name, op = "-webkit-"+name[len("-webkit-min-"):], ">="
+		case strings.HasPrefix(name, "-webkit-max-"):
+			name, op = "-webkit-"+name[len("-webkit-max-"):], "<="
+		}
+		return v.compare(name, op, val)
+	}
+	if i := strings.IndexAny(f, "<>="); i >= 0 {
+		// Range syntax: "name op value", "value op name" or
+		// "value op name op value".
+		var parts, ops []string
+		for {
+			i := strings.IndexAny(f, "<>=")
+			if i < 0 {
+				parts = append(parts, strings.Trim(f, asciiWhitespace))
+				break
+			}
+			j := i + 1
+			if j < len(f) && f[j] == '=' {
+				j++
+			}
+			parts = append(parts, strings.Trim(f[:i], asciiWhitespace))
+			ops = append(ops, f[i:j])
+			f = f[j:]
+		}
+		switch len(parts) {
+		case 2:
+			if _, ok := v.featureValue(parts[0]); ok {
+				return v.compare(parts[0], ops[0], parts[1])
+			}
+			return v.compare(parts[1], reverseOp(ops[0]), parts[0])
+		case 3:
+			return v.compare(parts[1], reverseOp(ops[0]), parts[0]) && v.compare(parts[1], ops[1], parts[2])
+		}
+		return false
+	}
+	// In a boolean context, a feature matches if it is not zero.
+	if f == "orientation" {
+		return true
+	}
+	x, _ := v.featureValue(f)
+	return x != 0
+}
+
+func reverseOp(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// featureValue returns the value of the numeric feature name.
+func (v *Viewport) featureValue(name string) (float64, bool) {
+	switch name {
+	case "width", "device-width":
+		return v.Width, true
+	case "height", "device-height":
+		return v.Height, true
+	case "aspect-ratio", "device-aspect-ratio":
+		if v.Height == 0 {
+			return 0, true
+		}
+		return v.Width / v.Height, true
+	case "resolution", "-webkit-device-pixel-ratio":
+		if v.DevicePixelRatio <= 0 {
+			return 1, true
+		}
+		return v.DevicePixelRatio, true
+	}
+	return 0, false
+}
+
+// compare reports whether the feature name compares to val with op.
+func (v *Viewport) compare(name, op, val string) bool {
+	if name == "orientation" {
+		landscape := v.Width > v.Height
+		return op == "=" && (val == "landscape") == landscape && (val == "portrait" || val == "landscape")
+	}
+	x, ok := v.featureValue(name)
+	if !ok {
+		return false
+	}
+	var y float64
+	switch name {
+	case "resolution":
+		y, ok = parseResolution(val)
+	case "-webkit-device-pixel-ratio":
+		y, ok = parseNumber(val)
+	case "aspect-ratio", "device-aspect-ratio":
+		y, ok = parseRatio(val)
+	default:
+		y, ok = v.length(val)
+	}
+	if !ok {
+		return false
+	}
+	switch op {
+	case "=":
+		return x == y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+// length returns the value in CSS pixels of the CSS length s.
+func (v *Viewport) length(s string) (float64, bool) {
+	s = strings.ToLower(s)
+	i := len(s)
+	for i > 0 && isASCIILetter(s[i-1]) {
+		i--
+	}
+	f, ok := parseNumber(s[:i])
+	if !ok {
+		return 0, false
+	}
+	switch s[i:] {
+	case "px":
+		return f, true
+	case "em", "rem":
+		return f * 16, true
+	case "vw":
+		return f * v.Width / 100, true
+	case "vh":
+		return f * v.Height / 100, true
+	case "vmin":
+		if v.Height < v.Width {
+			return f * v.Height / 100, true
+		}
+		return f * v.Width / 100, true
+	case "vmax":
+		if v.Height > v.Width {
+			return f * v.Height / 100, true
+		}
+		return f * v.Width / 100, true
+	case "cm":
+		return f * 96 / 2.54, true
+	case "mm":
+		return f * 96 / 25.4, true
+	case "in":
+		return f * 96, true
+	case "pt":
+		return f * 96 / 72, true
+	case "":
+		// Only zero may be unitless.
+		return 0, f == 0
+	}
+	return 0, false
+}
+
+// parseResolution returns the value in dppx of the CSS resolution s.
+func parseResolution(s string) (float64, bool) {
+	i := len(s)
+	for i > 0 && isASCIILetter(s[i-1]) {
+		i--
+	}
+	f, ok := parseNumber(s[:i])
+	if !ok {
+		return 0, false
+	}
+	switch s[i:] {
+	case "x", "dppx":
+		return f, true
+	case "dpi":
+		return f / 96, true
+	case "dpcm":
+		return f * 2.54 / 96, true
+	}
+	return 0, false
+}
+
+// parseRatio parses a CSS ratio, such as "16/9".
+func parseRatio(s string) (float64, bool) {
+	num, den := s, "1"
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		num, den = s[:i], s[i+1:]
+	}
+	n, ok1 := parseNumber(strings.Trim(num, asciiWhitespace))
+	d, ok2 := parseNumber(strings.Trim(den, asciiWhitespace))
+	if !ok1 || !ok2 || d == 0 {
+		return 0, false
+	}
+	return n / d, true
+}
+
+// parseNumber parses a CSS number without an exponent, such as "-1.5".
+func parseNumber(s string) (float64, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 || digits == "" || digits == "." {
+		return 0, false
+	}
+	dot := false
+	for i := 0; i < len(digits); i++ {
+		switch c := digits[i]; {
+		case c == '.' && !dot:
+			dot = true
+		case c < '0' || c > '9':
+			return 0, false
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHTMLElement(n *Node, a atom.Atom) bool {
+	return n.Type == ElementNode && n.Namespace == "" && n.DataAtom == a
+}
+
+// htmlAttr returns the value of the attribute key of n, without a
+// namespace.
+func htmlAttr(n *Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
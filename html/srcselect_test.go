@@ -0,0 +1,109 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html/atom"
+)
+
+func TestSelectSource(t *testing.T) {
+	const picture = `<picture>
+<source media="(min-width: 1000px)" srcset="wide.avif" type="image/avif">
+<source media="(min-width: 1000px)" srcset="wide.jpg">
+<source media="print" srcset="print.jpg">
+<source srcset="narrow-1x.jpg, narrow-2x.jpg 2x">
+<img src="fallback.jpg">
+<source srcset="after.jpg">
+</picture>`
+	avif := func(typ string) bool { return typ == "image/avif" }
+	testCases := []struct {
+		doc  string
+		v    Viewport
+		want string
+	}{
+		{picture, Viewport{Width: 1200, SupportsType: avif}, "wide.avif"},
+		{picture, Viewport{Width: 1200, SupportsType: func(string) bool { return false }}, "wide.jpg"},
+		{picture, Viewport{Width: 400}, "narrow-1x.jpg"},
+		{picture, Viewport{Width: 400, DevicePixelRatio: 2}, "narrow-2x.jpg"},
+		{picture, Viewport{Width: 400, DevicePixelRatio: 3}, "narrow-2x.jpg"},
+		{`<picture><source media="(max-width: 10px)" srcset="a.jpg"><img src="b.jpg"></picture>`, Viewport{Width: 400}, "b.jpg"},
+		{`<img src="a.jpg" srcset="a2.jpg 2x, a3.jpg 3x">`, Viewport{DevicePixelRatio: 1.5}, "a2.jpg"},
+		{`<img src="a.jpg" srcset="a2.jpg 2x">`, Viewport{}, "a.jpg"},
+		{`<img src="a.jpg" srcset="s.jpg 400w, m.jpg 800w, l.jpg 1600w" sizes="(max-width: 600px) 100vw, 50vw">`, Viewport{Width: 500}, "m.jpg"},
+		{`<img src="a.jpg" srcset="s.jpg 400w, m.jpg 800w, l.jpg 1600w" sizes="(max-width: 600px) 100vw, 50vw">`, Viewport{Width: 1000}, "m.jpg"},
+		{`<img src="a.jpg" srcset="s.jpg 400w, m.jpg 800w, l.jpg 1600w" sizes="(max-width: 600px) 100vw, 50vw">`, Viewport{Width: 1000, DevicePixelRatio: 2}, "l.jpg"},
+		{`<img srcset="s.jpg 400w, m.jpg 800w" sizes="300px">`, Viewport{Width: 1000}, "s.jpg"},
+		{`<img src="a.jpg" srcset="b.jpg 1x, c.jpg bogus">`, Viewport{DevicePixelRatio: 2}, "b.jpg"},
+		{`<img>`, Viewport{}, ""},
+		{`<video src="v.mp4"><source src="ignored.webm"></video>`, Viewport{}, "v.mp4"},
+		{`<video><source src="v.webm" type="video/webm"><source src="v.mp4" type="video/mp4"></video>`, Viewport{SupportsType: func(typ string) bool { return typ == "video/mp4" }}, "v.mp4"},
+		{`<video><source src="big.mp4" media="(min-width: 800px)"><source src="small.mp4"></video>`, Viewport{Width: 400}, "small.mp4"},
+		{`<audio><source src="a.ogg" type="audio/ogg"></audio>`, Viewport{SupportsType: func(string) bool { return false }}, ""},
+	}
+	for _, tc := range testCases {
+		doc, err := Parse(strings.NewReader(tc.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := SelectSource(findMediaElement(doc), tc.v)
+		if got.URL != tc.want || ok != (tc.want != "") {
+			t.Errorf("SelectSource(%q, %+v) = %q, %t; want %q", tc.doc, tc.v, got.URL, ok, tc.want)
+		}
+	}
+}
+
+// findMediaElement returns the first img, video or audio element of the
+// tree rooted at n.
+func findMediaElement(n *Node) *Node {
+	if n.Type == ElementNode && (n.DataAtom == atom.Img || n.DataAtom == atom.Video || n.DataAtom == atom.Audio) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if m := findMediaElement(c); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestMatchMedia(t *testing.T) {
+	v := &Viewport{Width: 800, Height: 600, DevicePixelRatio: 2}
+	testCases := []struct {
+		q    string
+		want bool
+	}{
+		{"", true},
+		{"all", true},
+		{"screen and (min-width: 600px)", true},
+		{"only screen and (max-width: 600px)", false},
+		{"print", false},
+		{"not print", true},
+		{"not screen and (min-width: 600px)", false},
+		{"print, (orientation: landscape)", true},
+		{"(orientation: portrait)", false},
+		{"(min-resolution: 2dppx)", true},
+		{"(min-resolution: 192dpi) and (max-resolution: 2x)", true},
+		{"(-webkit-min-device-pixel-ratio: 1.5)", true},
+		{"(width >= 800px)", true},
+		{"(400px < width < 800px)", false},
+		{"(50em <= width)", true},
+		{"(min-aspect-ratio: 4/3)", true},
+		{"(min-width: 600px) or (max-width: 100px)", true},
+		{"not ((min-width: 600px) and (max-height: 500px))", true},
+		{"(min-width: 40vw)", true},
+		{"(hover: hover)", false},
+		{"(min-width: 600)", false},
+		{"(min-width: 1e2px)", false},
+		{"screen and", false},
+	}
+	for _, tc := range testCases {
+		if got := v.matchMedia(tc.q, false); got != tc.want {
+			t.Errorf("matchMedia(%q) = %t, want %t", tc.q, got, tc.want)
+		}
+	}
+}
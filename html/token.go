@@ -169,6 +169,9 @@ type Tokenizer struct {
 	convertNUL bool
 	// allowCDATA is whether CDATA sections are allowed in the current context.
 	allowCDATA bool
+	// rawTextElements holds the lower-cased names of the elements,
+	// besides the standard ones, whose content is raw text.
+	rawTextElements map[string]bool
 }
 
 // AllowCDATA sets whether or not the tokenizer recognizes <![CDATA[foo]]> as
@@ -189,6 +192,23 @@ func (z *Tokenizer) AllowCDATA(allowCDATA bool) {
 	z.allowCDATA = allowCDATA
 }
 
+// SetRawTextElements registers additional element names, such as those
+// of a template language embedded in HTML, whose content is raw text like
+// that of a script element: the text up to the matching end tag is
+// returned as a single text token, with no child elements and without
+// unescaping character references. Names are matched case-insensitively.
+// Calling SetRawTextElements replaces the names previously registered.
+func (z *Tokenizer) SetRawTextElements(names ...string) {
+	z.rawTextElements = nil
+	if len(names) == 0 {
+		return
+	}
+	z.rawTextElements = make(map[string]bool, len(names))
+	for _, name := range names {
+		z.rawTextElements[strings.ToLower(name)] = true
+	}
+}
+
 // NextIsNotRawText instructs the tokenizer that the next token should not be
 // considered as 'raw text'. Some elements, such as script and title elements,
 // normally require the next token after the opening tag to be 'raw text' that
@@ -369,7 +389,10 @@ func (z *Tokenizer) readRawEndTag() bool {
 		if z.err != nil {
 			return false
 		}
-		if c != z.rawTag[i] && c != z.rawTag[i]-('a'-'A') {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != z.rawTag[i] {
 			z.raw.end--
 			return false
 		}
@@ -838,6 +861,10 @@ func (z *Tokenizer) readStartTag() TokenType {
 	}
 	if raw {
 		z.rawTag = strings.ToLower(string(z.buf[z.data.start:z.data.end]))
+	} else if z.rawTextElements != nil {
+		if name := strings.ToLower(string(z.buf[z.data.start:z.data.end])); z.rawTextElements[name] {
+			z.rawTag = name
+		}
 	}
 	// Look for a self-closing token like "<br/>".
 	if z.err == nil && z.buf[z.raw.end-2] == '/' {
@@ -1252,8 +1279,8 @@ func NewTokenizerFragment(r io.Reader, contextTag string) *Tokenizer {
 		buf: make([]byte, 0, 4096),
 	}
 	if contextTag != "" {
-		switch s := strings.ToLower(contextTag); s {
-		case "iframe", "noembed", "noframes", "noscript", "plaintext", "script", "style", "title", "textarea", "xmp":
+		s := strings.ToLower(contextTag)
+		if a := atom.Lookup([]byte(s)); atom.IsRawText(a) || atom.IsEscapableRawText(a) {
 			z.rawTag = s
 		}
 	}
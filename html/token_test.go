@@ -617,6 +617,28 @@ func TestTokenizer(t *testing.T) {
 	}
 }
 
+func TestRawTextElements(t *testing.T) {
+	const html = `<x-tpl id=a>{{if a<b}}<p>&amp;</X-TPL ><x-tpl-not>&amp;</x-tpl-not>`
+	z := NewTokenizer(strings.NewReader(html))
+	z.SetRawTextElements("X-TPL")
+	want := []string{
+		`<x-tpl id="a">`,
+		`{{if a&lt;b}}&lt;p&gt;&amp;amp;`,
+		`</x-tpl>`,
+		`<x-tpl-not>`,
+		`&amp;`,
+		`</x-tpl-not>`,
+	}
+	for i, s := range want {
+		if z.Next() == ErrorToken {
+			t.Fatalf("token %d: want %q got error %v", i, s, z.Err())
+		}
+		if got := z.Token().String(); got != s {
+			t.Errorf("token %d: want %q got %q", i, s, got)
+		}
+	}
+}
+
 func TestMaxBuffer(t *testing.T) {
 	// Exceeding the maximum buffer size generates ErrBufferExceeded.
 	z := NewTokenizer(strings.NewReader("<" + strings.Repeat("t", 10)))
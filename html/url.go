@@ -0,0 +1,249 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
+
+// BaseURL returns the base URL of the document doc, retrieved from
+// docURL, as defined by the HTML standard: the href of the first base
+// element that has one, resolved against docURL, or else docURL itself.
+// A base href that cannot be parsed is ignored. Base elements inside
+// template contents or foreign content are not part of the document and
+// are ignored too. docURL may be nil if the document URL is unknown.
+//
+// See https://html.spec.whatwg.org/multipage/urls-and-fetching.html#document-base-url
+func BaseURL(doc *Node, docURL *url.URL) *url.URL {
+	fallback := docURL
+	if fallback == nil {
+		fallback = new(url.URL)
+	}
+	if href, ok := findBaseHref(doc); ok {
+		if u, err := ResolveURL(fallback, href); err == nil {
+			return u
+		}
+	}
+	return fallback
+}
+
+// findBaseHref returns the href of the first base element with one in
+// the tree rooted at n.
+func findBaseHref(n *Node) (string, bool) {
+	if n.Type == ElementNode {
+		if n.Namespace != "" || n.DataAtom == atom.Template {
+			return "", false
+		}
+		if n.DataAtom == atom.Base {
+			for _, a := range n.Attr {
+				if a.Namespace == "" && a.Key == "href" {
+					return a.Val, true
+				}
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href, ok := findBaseHref(c); ok {
+			return href, true
+		}
+	}
+	return "", false
+}
+
+// ResolveURL resolves the value of a URL attribute against base. As in
+// browsers, leading and trailing ASCII whitespace is ignored, and so are
+// tabs and newlines within the value.
+func ResolveURL(base *url.URL, val string) (*url.URL, error) {
+	val = strings.Trim(val, asciiWhitespace)
+	if strings.ContainsAny(val, "\t\n\r") {
+		val = strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, val)
+	}
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return u, nil
+	}
+	return base.ResolveReference(u), nil
+}
+
+const asciiWhitespace = "\t\n\f\r "
+
+// An AttrURL is an absolute URL found in an attribute of an element.
+type AttrURL struct {
+	// Attr is the attribute holding the URL.
+	Attr Attribute
+	// URL is the value, or one of the values, of Attr resolved against
+	// the document base URL.
+	URL *url.URL
+	// Descriptor is the width or pixel density descriptor, such as
+	// "100w" or "2x", of a srcset image candidate, if any.
+	Descriptor string
+}
+
+// A URLResolver resolves the URL attributes of the elements of a
+// document against its base URL.
+type URLResolver struct {
+	base *url.URL
+}
+
+// NewURLResolver returns a URLResolver for the document doc, retrieved
+// from docURL. See BaseURL.
+func NewURLResolver(doc *Node, docURL *url.URL) *URLResolver {
+	return &URLResolver{base: BaseURL(doc, docURL)}
+}
+
+// Base returns the base URL of the document.
+func (r *URLResolver) Base() *url.URL {
+	u := *r.base
+	return &u
+}
+
+// Resolve resolves the value of a URL attribute against the base URL of
+// the document.
+func (r *URLResolver) Resolve(val string) (*url.URL, error) {
+	return ResolveURL(r.base, val)
+}
+
+// URLs returns the URLs in the attributes of the element n, resolved
+// against the base URL of the document. The URLs of a srcset attribute
+// are returned one per image candidate. In SVG content, it returns the
+// targets of href and xlink:href attributes and of the url() references
+// of presentation attributes such as fill. Values that cannot be parsed
+// as URLs are skipped. URLs returns nil if n is not an element.
+func (r *URLResolver) URLs(n *Node) []AttrURL {
+	if n.Type != ElementNode {
+		return nil
+	}
+	var urls []AttrURL
+	add := func(a Attribute, val, descriptor string) {
+		if u, err := r.Resolve(val); err == nil {
+			urls = append(urls, AttrURL{Attr: a, URL: u, Descriptor: descriptor})
+		}
+	}
+	for _, a := range n.Attr {
+		switch {
+		case n.Namespace == "" && a.Namespace == "" && a.Key == "srcset" && (n.DataAtom == atom.Img || n.DataAtom == atom.Source):
+			for _, c := range parseSrcset(a.Val) {
+				add(a, c.url, c.descriptor)
+			}
+		case n.Namespace == "" && a.Namespace == "" && isURLAttr(n.DataAtom, a.Key):
+			add(a, a.Val, "")
+		case n.Namespace == "svg" && a.Key == "href" && (a.Namespace == "" || a.Namespace == "xlink"):
+			add(a, a.Val, "")
+		case n.Namespace == "svg" && a.Namespace == "" && svgFuncIRIAttrs[a.Key]:
+			if ref, ok := funcIRI(a.Val); ok {
+				add(a, ref, "")
+			}
+		}
+	}
+	return urls
+}
+
+// urlAttrs lists the attributes of HTML elements whose value is a URL.
+var urlAttrs = map[string][]atom.Atom{
+	"action":     {atom.Form},
+	"background": {atom.Body},
+	"cite":       {atom.Blockquote, atom.Del, atom.Ins, atom.Q},
+	"data":       {atom.Object},
+	"formaction": {atom.Button, atom.Input},
+	"href":       {atom.A, atom.Area, atom.Base, atom.Link},
+	"longdesc":   {atom.Img},
+	"manifest":   {atom.Html},
+	"poster":     {atom.Video},
+	"src":        {atom.Audio, atom.Embed, atom.Iframe, atom.Img, atom.Input, atom.Script, atom.Source, atom.Track, atom.Video},
+}
+
+func isURLAttr(a atom.Atom, key string) bool {
+	for _, e := range urlAttrs[key] {
+		if e == a {
+			return true
+		}
+	}
+	return false
+}
+
+// svgFuncIRIAttrs lists the SVG presentation attributes which may
+// reference another element with url().
+var svgFuncIRIAttrs = map[string]bool{
+	"clip-path":    true,
+	"fill":         true,
+	"filter":       true,
+	"marker-end":   true,
+	"marker-mid":   true,
+	"marker-start": true,
+	"mask":         true,
+	"stroke":       true,
+}
+
+// funcIRI returns the reference of a value of the form url(ref), as
+// used by SVG presentation attributes. The reference may be quoted.
+func funcIRI(val string) (string, bool) {
+	val = strings.Trim(val, asciiWhitespace)
+	if len(val) < len("url()") || !strings.EqualFold(val[:4], "url(") {
+		return "", false
+	}
+	i := strings.IndexByte(val, ')')
+	if i < 0 {
+		return "", false
+	}
+	ref := strings.Trim(val[4:i], asciiWhitespace)
+	if len(ref) >= 2 && (ref[0] == '"' || ref[0] == '\'') && ref[len(ref)-1] == ref[0] {
+		ref = ref[1 : len(ref)-1]
+	}
+	return ref, ref != ""
+}
+
+type srcsetCandidate struct {
+	url, descriptor string
+}
+
+// parseSrcset splits the value of a srcset attribute into its image
+// candidates, following the parsing algorithm of the HTML standard but
+// without validating the descriptors.
+//
+// See https://html.spec.whatwg.org/multipage/images.html#parse-a-srcset-attribute
+func parseSrcset(s string) []srcsetCandidate {
+	var cs []srcsetCandidate
+	for {
+		s = strings.TrimLeft(s, asciiWhitespace+",")
+		if s == "" {
+			return cs
+		}
+		i := strings.IndexAny(s, asciiWhitespace)
+		if i < 0 {
+			i = len(s)
+		}
+		u := s[:i]
+		s = s[i:]
+		if strings.HasSuffix(u, ",") {
+			// A URL ending with commas has no descriptors.
+			cs = append(cs, srcsetCandidate{url: strings.TrimRight(u, ",")})
+			continue
+		}
+		// The descriptors run until a comma outside parentheses.
+		depth, j := 0, 0
+		for ; j < len(s); j++ {
+			if c := s[j]; c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+			} else if c == ',' && depth == 0 {
+				break
+			}
+		}
+		cs = append(cs, srcsetCandidate{url: u, descriptor: strings.Join(strings.Fields(s[:j]), " ")})
+		s = s[j:]
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package html
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	testCases := []struct {
+		doc, want string
+	}{
+		{`<p>no base`, "http://example.com/dir/page.html"},
+		{`<base href="/other/">`, "http://example.com/other/"},
+		{`<base target="_blank"><base href="sub/"><base href="/ignored/">`, "http://example.com/dir/sub/"},
+		{`<base href=" https://cdn.example.net/a/ ">`, "https://cdn.example.net/a/"},
+		{`<base href="http://[::1">`, "http://example.com/dir/page.html"},
+		{`<template><base href="/template/"></template><base href="/real/">`, "http://example.com/real/"},
+		{`<svg><base href="/svg/"></base></svg>`, "http://example.com/dir/page.html"},
+	}
+	docURL, _ := url.Parse("http://example.com/dir/page.html")
+	for _, tc := range testCases {
+		doc, err := Parse(strings.NewReader(tc.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := BaseURL(doc, docURL).String(); got != tc.want {
+			t.Errorf("BaseURL(%q) = %q, want %q", tc.doc, got, tc.want)
+		}
+	}
+
+	doc, _ := Parse(strings.NewReader(`<base href="/x/">`))
+	if got, want := BaseURL(doc, nil).String(), "/x/"; got != want {
+		t.Errorf("BaseURL with no document URL = %q, want %q", got, want)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want []srcsetCandidate
+	}{
+		{"", nil},
+		{"a.png", []srcsetCandidate{{"a.png", ""}}},
+		{" a.png 1x , b.png  2x", []srcsetCandidate{{"a.png", "1x"}, {"b.png", "2x"}}},
+		{"a.png, b.png 100w", []srcsetCandidate{{"a.png", ""}, {"b.png", "100w"}}},
+		{"a,b.png 100w", []srcsetCandidate{{"a,b.png", "100w"}}},
+		{"data:image/png;base64,AAAA 1x, c.png (max 2) 2x, d.png", []srcsetCandidate{
+			{"data:image/png;base64,AAAA", "1x"},
+			{"c.png", "(max 2) 2x"},
+			{"d.png", ""},
+		}},
+	}
+	for _, tc := range testCases {
+		if got := parseSrcset(tc.s); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseSrcset(%q) = %q, want %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestURLResolver(t *testing.T) {
+	const src = `<head><base href="/base/"></head><body>
+<a href=" page.html#frag ">x</a>
+<img src="i.png" srcset="i-1x.png 1x, /abs/i-2x.png 2x" alt="not a url">
+<form action="?q=1"><button formaction="go">b</button></form>
+<svg><use xlink:href="icons.svg#star"/><image href="//cdn.example.net/p.png"/>
+<rect fill="url('#grad')" stroke="red"/></svg>
+<p title="t.html">no urls</p>`
+	doc, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docURL, _ := url.Parse("https://example.com/dir/doc.html")
+	r := NewURLResolver(doc, docURL)
+	if got, want := r.Base().String(), "https://example.com/base/"; got != want {
+		t.Errorf("Base() = %q, want %q", got, want)
+	}
+
+	var got []string
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for _, u := range r.URLs(n) {
+			s := n.Data + " " + u.Attr.Key + " " + u.URL.String()
+			if u.Attr.Namespace != "" {
+				s = n.Data + " " + u.Attr.Namespace + ":" + u.Attr.Key + " " + u.URL.String()
+			}
+			if u.Descriptor != "" {
+				s += " " + u.Descriptor
+			}
+			got = append(got, s)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	want := []string{
+		"base href https://example.com/base/",
+		"a href https://example.com/base/page.html#frag",
+		"img src https://example.com/base/i.png",
+		"img srcset https://example.com/base/i-1x.png 1x",
+		"img srcset https://example.com/abs/i-2x.png 2x",
+		"form action https://example.com/base/?q=1",
+		"button formaction https://example.com/base/go",
+		"use xlink:href https://example.com/base/icons.svg#star",
+		"image href https://cdn.example.net/p.png",
+		"rect fill https://example.com/base/#grad",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs:\ngot  %q\nwant %q", got, want)
+	}
+}
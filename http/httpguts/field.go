@@ -0,0 +1,166 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpguts
+
+import (
+	"net/textproto"
+	"strings"
+)
+
+// A Strictness selects how closely field validation follows RFC 9110.
+// Intermediaries that forward messages should prefer Strict, since
+// any difference in how two hops parse a field can be exploited to
+// smuggle requests.
+type Strictness int
+
+const (
+	// Lenient accepts any field value that ValidHeaderFieldValue
+	// accepts, and replaces each obs-fold in a field line with a
+	// single space as permitted by RFC 9112, Section 5.2.
+	Lenient Strictness = iota
+
+	// RFC9110 accepts exactly the field values permitted by the
+	// grammar of RFC 9110, Section 5.5: field values must not begin
+	// or end with whitespace, and obs-fold is rejected.
+	RFC9110
+
+	// Strict is like RFC9110, but additionally rejects obs-text
+	// (octets 0x80 to 0xFF), whose interpretation differs between
+	// implementations.
+	Strict
+)
+
+// ValidFieldValue reports whether v is a valid field value at the
+// given strictness level. RFC 9110 says:
+//
+//	field-value    = *field-content
+//	field-content  = field-vchar
+//	                 [ 1*( SP / HTAB / field-vchar ) field-vchar ]
+//	field-vchar    = VCHAR / obs-text
+//	obs-text       = %x80-FF
+func ValidFieldValue(v string, s Strictness) bool {
+	if s == Lenient {
+		return ValidHeaderFieldValue(v)
+	}
+	if len(v) > 0 && (isLWS(v[0]) || isLWS(v[len(v)-1])) {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		b := v[i]
+		switch {
+		case isLWS(b):
+		case isCTL(b):
+			return false
+		case b >= 0x80 && s >= Strict:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidFieldLine parses line as an HTTP/1.x field line, without the
+// terminating CRLF, and reports whether it is valid at the given
+// strictness level. It returns the field name and the field value
+// with surrounding whitespace removed. At the Lenient level, each
+// obs-fold in the value is replaced with a single space. RFC 9112
+// says:
+//
+//	field-line   = field-name ":" OWS field-value OWS
+//	obs-fold     = OWS CRLF RWS
+//
+// No whitespace is allowed between the field name and the colon, at
+// any strictness level, since such lines have been used to smuggle
+// requests.
+func ValidFieldLine(line string, s Strictness) (name, value string, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", "", false
+	}
+	name, value = line[:colon], line[colon+1:]
+	if !ValidHeaderFieldName(name) {
+		return "", "", false
+	}
+	if strings.IndexByte(value, '\r') >= 0 || strings.IndexByte(value, '\n') >= 0 {
+		if s != Lenient {
+			return "", "", false
+		}
+		var ok bool
+		if value, ok = unfold(value); !ok {
+			return "", "", false
+		}
+	}
+	value = trimOWS(value)
+	if !ValidFieldValue(value, s) {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+// unfold replaces each obs-fold in v with a single space. It reports
+// false if v contains a CR or LF that is not part of an obs-fold.
+func unfold(v string) (string, bool) {
+	var b strings.Builder
+	for {
+		i := strings.IndexAny(v, "\r\n")
+		if i < 0 {
+			b.WriteString(v)
+			return b.String(), true
+		}
+		if !strings.HasPrefix(v[i:], "\r\n") || len(v) < i+3 || !isLWS(v[i+2]) {
+			return "", false
+		}
+		b.WriteString(trimOWS(v[:i]))
+		b.WriteByte(' ')
+		v = v[i+2:]
+		for len(v) > 0 && isLWS(v[0]) {
+			v = v[1:]
+		}
+	}
+}
+
+// ValidToken68 reports whether v is a valid token68, the form of
+// credentials used by authentication schemes such as Basic and Bearer.
+// RFC 9110 says:
+//
+//	token68        = 1*( ALPHA / DIGIT /
+//	                     "-" / "." / "_" / "~" / "+" / "/" ) *"="
+func ValidToken68(v string) bool {
+	i := 0
+	for i < len(v) && isToken68Byte(v[i]) {
+		i++
+	}
+	if i == 0 {
+		return false
+	}
+	for ; i < len(v); i++ {
+		if v[i] != '=' {
+			return false
+		}
+	}
+	return true
+}
+
+func isToken68Byte(b byte) bool {
+	switch {
+	case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		return true
+	}
+	switch b {
+	case '-', '.', '_', '~', '+', '/':
+		return true
+	}
+	return false
+}
+
+// CanonicalFieldName returns the canonical format of the field name,
+// as textproto.CanonicalMIMEHeaderKey does, and reports whether name
+// is a valid field name. Unlike CanonicalMIMEHeaderKey, it never
+// returns an invalid name unchanged as if it were canonical.
+func CanonicalFieldName(name string) (string, bool) {
+	if !ValidHeaderFieldName(name) {
+		return "", false
+	}
+	return textproto.CanonicalMIMEHeaderKey(name), true
+}
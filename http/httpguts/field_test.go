@@ -0,0 +1,102 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpguts
+
+import "testing"
+
+func TestValidFieldValue(t *testing.T) {
+	tests := []struct {
+		v                        string
+		lenient, rfc9110, strict bool
+	}{
+		{"", true, true, true},
+		{"text/html; charset=utf-8", true, true, true},
+		{"a\tb", true, true, true},
+		{" leading", true, false, false},
+		{"trailing\t", true, false, false},
+		{"caf\xc3\xa9", true, true, false},
+		{"nul\x00", false, false, false},
+		{"cr\rlf", false, false, false},
+		{"del\x7f", false, false, false},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			s    Strictness
+			want bool
+		}{{Lenient, tt.lenient}, {RFC9110, tt.rfc9110}, {Strict, tt.strict}} {
+			if got := ValidFieldValue(tt.v, c.s); got != c.want {
+				t.Errorf("ValidFieldValue(%q, %d) = %v; want %v", tt.v, c.s, got, c.want)
+			}
+		}
+	}
+}
+
+func TestValidFieldLine(t *testing.T) {
+	tests := []struct {
+		line        string
+		s           Strictness
+		name, value string
+		ok          bool
+	}{
+		{"Content-Type: text/plain", Strict, "Content-Type", "text/plain", true},
+		{"X-Empty:", Strict, "X-Empty", "", true},
+		{"X-Spaces: \t value \t", Strict, "X-Spaces", "value", true},
+		{"Transfer-Encoding : chunked", Lenient, "", "", false},
+		{" Host: example.com", Lenient, "", "", false},
+		{"no colon", Lenient, "", "", false},
+		{"X-Folded: a\r\n  b", Lenient, "X-Folded", "a b", true},
+		{"X-Folded: a \r\n\tb\r\n c", Lenient, "X-Folded", "a b c", true},
+		{"X-Folded: a\r\n b", RFC9110, "", "", false},
+		{"X-Bare-LF: a\n b", Lenient, "", "", false},
+		{"X-Bad-Fold: a\r\nb", Lenient, "", "", false},
+		{"X-Obs-Text: \xff", RFC9110, "X-Obs-Text", "\xff", true},
+		{"X-Obs-Text: \xff", Strict, "", "", false},
+	}
+	for _, tt := range tests {
+		name, value, ok := ValidFieldLine(tt.line, tt.s)
+		if name != tt.name || value != tt.value || ok != tt.ok {
+			t.Errorf("ValidFieldLine(%q, %d) = %q, %q, %v; want %q, %q, %v", tt.line, tt.s, name, value, ok, tt.name, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestValidToken68(t *testing.T) {
+	tests := []struct {
+		v    string
+		want bool
+	}{
+		{"dXNlcjpwYXNz", true},
+		{"dXNlcjpwYXM=", true},
+		{"abc-._~+/==", true},
+		{"", false},
+		{"==", false},
+		{"ab=c", false},
+		{"a b", false},
+		{"a,b", false},
+	}
+	for _, tt := range tests {
+		if got := ValidToken68(tt.v); got != tt.want {
+			t.Errorf("ValidToken68(%q) = %v; want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalFieldName(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"content-type", "Content-Type", true},
+		{"X-FORWARDED-FOR", "X-Forwarded-For", true},
+		{"bad name", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := CanonicalFieldName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("CanonicalFieldName(%q) = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
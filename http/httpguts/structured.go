@@ -0,0 +1,640 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpguts
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file implements Structured Field Values for HTTP, RFC 8941.
+//
+// The bare items of structured fields are represented by the Go types
+// int64 (Integer), float64 (Decimal), string (String), SFToken (Token),
+// []byte (Byte Sequence) and bool (Boolean). The serializers also
+// accept int for Integers.
+
+// An SFToken is a structured field Token, a short textual word such as
+// a media type.
+type SFToken string
+
+// An SFParam is a single structured field parameter. A parameter
+// without a value has the value true.
+type SFParam struct {
+	Key   string
+	Value interface{}
+}
+
+// SFParams are the ordered parameters of a structured field item or
+// inner list.
+type SFParams []SFParam
+
+// Get returns the value of the parameter with the given key and
+// reports whether it is present.
+func (ps SFParams) Get(key string) (interface{}, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// An SFMember is a member of a structured field List or Dictionary.
+// It is either an SFItem or an SFInnerList.
+type SFMember interface {
+	sfMember()
+}
+
+// An SFItem is a structured field Item: a bare item with parameters.
+type SFItem struct {
+	Value  interface{}
+	Params SFParams
+}
+
+// An SFInnerList is a structured field Inner List: a list of items
+// with parameters of its own.
+type SFInnerList struct {
+	Items  []SFItem
+	Params SFParams
+}
+
+func (SFItem) sfMember()      {}
+func (SFInnerList) sfMember() {}
+
+// An SFList is a structured field List.
+type SFList []SFMember
+
+// An SFDictMember is a single member of a structured field Dictionary.
+type SFDictMember struct {
+	Key   string
+	Value SFMember
+}
+
+// An SFDictionary is a structured field Dictionary, an ordered map
+// from keys to members.
+type SFDictionary []SFDictMember
+
+// Get returns the member with the given key and reports whether it is
+// present.
+func (d SFDictionary) Get(key string) (SFMember, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// errSFSyntax is wrapped by all errors returned by the parsers.
+var errSFSyntax = errors.New("httpguts: invalid structured field")
+
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d: %s", errSFSyntax, p.i, fmt.Sprintf(format, args...))
+}
+
+func (p *sfParser) eof() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skipSP() {
+	for !p.eof() && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for !p.eof() && isOWS(p.s[p.i]) {
+		p.i++
+	}
+}
+
+// finish checks that only trailing spaces remain.
+func (p *sfParser) finish() error {
+	p.skipSP()
+	if !p.eof() {
+		return p.errorf("unexpected %q", p.s[p.i])
+	}
+	return nil
+}
+
+// ParseSFItem parses a field value as a structured field Item.
+// Field lines of the same field should be combined with ", " first.
+func ParseSFItem(v string) (SFItem, error) {
+	p := &sfParser{s: v}
+	p.skipSP()
+	item, err := p.parseItem()
+	if err != nil {
+		return SFItem{}, err
+	}
+	if err := p.finish(); err != nil {
+		return SFItem{}, err
+	}
+	return item, nil
+}
+
+// ParseSFList parses a field value as a structured field List.
+// Field lines of the same field should be combined with ", " first.
+func ParseSFList(v string) (SFList, error) {
+	p := &sfParser{s: v}
+	p.skipSP()
+	var l SFList
+	for !p.eof() {
+		m, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, m)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// ParseSFDictionary parses a field value as a structured field
+// Dictionary. Field lines of the same field should be combined with
+// ", " first. When a key is repeated, the last value wins but the
+// member keeps the position of the first occurrence.
+func ParseSFDictionary(v string) (SFDictionary, error) {
+	p := &sfParser{s: v}
+	p.skipSP()
+	var d SFDictionary
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var m SFMember
+		if p.peek() == '=' {
+			p.i++
+			if m, err = p.parseMember(); err != nil {
+				return nil, err
+			}
+		} else {
+			params, err := p.parseParams()
+			if err != nil {
+				return nil, err
+			}
+			m = SFItem{Value: true, Params: params}
+		}
+		d = d.set(key, m)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (d SFDictionary) set(key string, m SFMember) SFDictionary {
+	for i := range d {
+		if d[i].Key == key {
+			d[i].Value = m
+			return d
+		}
+	}
+	return append(d, SFDictMember{Key: key, Value: m})
+}
+
+// next consumes the separator between members of a List or
+// Dictionary.
+func (p *sfParser) next() error {
+	p.skipOWS()
+	if p.eof() {
+		return nil
+	}
+	if p.s[p.i] != ',' {
+		return p.errorf("expected ',' but found %q", p.s[p.i])
+	}
+	p.i++
+	p.skipOWS()
+	if p.eof() {
+		return p.errorf("trailing ','")
+	}
+	return nil
+}
+
+func (p *sfParser) parseMember() (SFMember, error) {
+	if p.peek() == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *sfParser) parseInnerList() (SFInnerList, error) {
+	p.i++ // '('
+	var l SFInnerList
+	for {
+		p.skipSP()
+		if p.eof() {
+			return SFInnerList{}, p.errorf("unterminated inner list")
+		}
+		if p.s[p.i] == ')' {
+			p.i++
+			params, err := p.parseParams()
+			if err != nil {
+				return SFInnerList{}, err
+			}
+			l.Params = params
+			return l, nil
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return SFInnerList{}, err
+		}
+		l.Items = append(l.Items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return SFInnerList{}, p.errorf("expected ' ' or ')' in inner list")
+		}
+	}
+}
+
+func (p *sfParser) parseItem() (SFItem, error) {
+	v, err := p.parseBareItem()
+	if err != nil {
+		return SFItem{}, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return SFItem{}, err
+	}
+	return SFItem{Value: v, Params: params}, nil
+}
+
+func (p *sfParser) parseParams() (SFParams, error) {
+	var ps SFParams
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{} = true
+		if p.peek() == '=' {
+			p.i++
+			if v, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		ps = ps.set(key, v)
+	}
+	return ps, nil
+}
+
+func (ps SFParams) set(key string, v interface{}) SFParams {
+	for i := range ps {
+		if ps[i].Key == key {
+			ps[i].Value = v
+			return ps
+		}
+	}
+	return append(ps, SFParam{Key: key, Value: v})
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	start := p.i
+	if c := p.peek(); !isLCAlpha(c) && c != '*' {
+		return "", p.errorf("invalid key")
+	}
+	for p.i++; !p.eof() && isKeyByte(p.s[p.i]); p.i++ {
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) parseBareItem() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	}
+	return nil, p.errorf("invalid bare item")
+}
+
+func (p *sfParser) parseNumber() (interface{}, error) {
+	start := p.i
+	if p.peek() == '-' {
+		p.i++
+	}
+	if !isDigit(p.peek()) {
+		return nil, p.errorf("expected digit")
+	}
+	digits, dot := 0, -1
+	for ; !p.eof(); p.i++ {
+		c := p.s[p.i]
+		if isDigit(c) {
+			digits++
+		} else if c == '.' && dot < 0 {
+			if digits > 12 {
+				return nil, p.errorf("decimal has too many integer digits")
+			}
+			dot = digits
+		} else {
+			break
+		}
+		if digits > 15 {
+			return nil, p.errorf("number has too many digits")
+		}
+	}
+	num := p.s[start:p.i]
+	if dot < 0 {
+		v, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return v, nil
+	}
+	switch frac := digits - dot; {
+	case frac == 0:
+		return nil, p.errorf("decimal ends with '.'")
+	case frac > 3:
+		return nil, p.errorf("decimal has too many fractional digits")
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+func (p *sfParser) parseString() (string, error) {
+	p.i++ // '"'
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated escape")
+			}
+			c = p.s[p.i]
+			if c != '"' && c != '\\' {
+				return "", p.errorf("invalid escape %q", c)
+			}
+			p.i++
+			b.WriteByte(c)
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid string character %q", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *sfParser) parseToken() SFToken {
+	start := p.i
+	for p.i++; !p.eof(); p.i++ {
+		if c := p.s[p.i]; !IsTokenRune(rune(c)) && c != ':' && c != '/' {
+			break
+		}
+	}
+	return SFToken(p.s[start:p.i])
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.i++ // ':'
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end < 0 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	enc := p.s[p.i : p.i+end]
+	p.i += end + 1
+	// Padding is optional for parsers; see RFC 8941, Section 4.2.7.
+	enc = strings.TrimRight(enc, "=")
+	b, err := base64.RawStdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, p.errorf("invalid byte sequence: %v", err)
+	}
+	return b, nil
+}
+
+func (p *sfParser) parseBoolean() (bool, error) {
+	p.i++ // '?'
+	switch p.peek() {
+	case '1':
+		p.i++
+		return true, nil
+	case '0':
+		p.i++
+		return false, nil
+	}
+	return false, p.errorf("invalid boolean")
+}
+
+func isDigit(c byte) bool   { return '0' <= c && c <= '9' }
+func isLCAlpha(c byte) bool { return 'a' <= c && c <= 'z' }
+func isAlpha(c byte) bool   { return isLCAlpha(c) || 'A' <= c && c <= 'Z' }
+
+func isKeyByte(c byte) bool {
+	return isLCAlpha(c) || isDigit(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// SerializeSFItem returns the field value representing item.
+func SerializeSFItem(item SFItem) (string, error) {
+	var b strings.Builder
+	if err := writeSFItem(&b, item); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SerializeSFList returns the field value representing l.
+// It returns an error if l is empty, since an empty list is
+// represented by omitting the field.
+func SerializeSFList(l SFList) (string, error) {
+	if len(l) == 0 {
+		return "", errors.New("httpguts: empty structured field list")
+	}
+	var b strings.Builder
+	for i, m := range l {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeSFMember(&b, m); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// SerializeSFDictionary returns the field value representing d.
+// It returns an error if d is empty, since an empty dictionary is
+// represented by omitting the field.
+func SerializeSFDictionary(d SFDictionary) (string, error) {
+	if len(d) == 0 {
+		return "", errors.New("httpguts: empty structured field dictionary")
+	}
+	var b strings.Builder
+	for i, m := range d {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeSFKey(&b, m.Key); err != nil {
+			return "", err
+		}
+		if item, ok := m.Value.(SFItem); ok && item.Value == true {
+			if err := writeSFParams(&b, item.Params); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeSFMember(&b, m.Value); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func writeSFMember(b *strings.Builder, m SFMember) error {
+	switch m := m.(type) {
+	case SFItem:
+		return writeSFItem(b, m)
+	case SFInnerList:
+		b.WriteByte('(')
+		for i, item := range m.Items {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if err := writeSFItem(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+		return writeSFParams(b, m.Params)
+	}
+	return fmt.Errorf("httpguts: invalid structured field member type %T", m)
+}
+
+func writeSFItem(b *strings.Builder, item SFItem) error {
+	if err := writeSFBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return writeSFParams(b, item.Params)
+}
+
+func writeSFParams(b *strings.Builder, ps SFParams) error {
+	for _, p := range ps {
+		b.WriteByte(';')
+		if err := writeSFKey(b, p.Key); err != nil {
+			return err
+		}
+		if p.Value == true {
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeSFBareItem(b, p.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSFKey(b *strings.Builder, key string) error {
+	if key == "" || !isLCAlpha(key[0]) && key[0] != '*' {
+		return fmt.Errorf("httpguts: invalid structured field key %q", key)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isKeyByte(key[i]) {
+			return fmt.Errorf("httpguts: invalid structured field key %q", key)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+func writeSFBareItem(b *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		return writeSFInteger(b, int64(v))
+	case int64:
+		return writeSFInteger(b, v)
+	case float64:
+		return writeSFDecimal(b, v)
+	case string:
+		b.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("httpguts: invalid structured field string character %q", c)
+			}
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('"')
+	case SFToken:
+		if v == "" || v[0] != '*' && !isAlpha(v[0]) {
+			return fmt.Errorf("httpguts: invalid structured field token %q", v)
+		}
+		for i := 1; i < len(v); i++ {
+			if c := v[i]; !IsTokenRune(rune(c)) && c != ':' && c != '/' {
+				return fmt.Errorf("httpguts: invalid structured field token %q", v)
+			}
+		}
+		b.WriteString(string(v))
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+	default:
+		return fmt.Errorf("httpguts: invalid structured field bare item type %T", v)
+	}
+	return nil
+}
+
+func writeSFInteger(b *strings.Builder, v int64) error {
+	const max = 999999999999999
+	if v < -max || v > max {
+		return fmt.Errorf("httpguts: structured field integer %d out of range", v)
+	}
+	b.WriteString(strconv.FormatInt(v, 10))
+	return nil
+}
+
+func writeSFDecimal(b *strings.Builder, v float64) error {
+	v = math.RoundToEven(v*1000) / 1000
+	if math.IsNaN(v) || math.Abs(v) >= 1e12 {
+		return fmt.Errorf("httpguts: structured field decimal %v out of range", v)
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if strings.IndexByte(s, '.') < 0 {
+		s += ".0"
+	}
+	b.WriteString(s)
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpguts
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSFItem(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SFItem
+		ser  string // canonical serialization, if different from in
+	}{
+		{in: "42", want: SFItem{Value: int64(42)}},
+		{in: "-42", want: SFItem{Value: int64(-42)}},
+		{in: "4.5", want: SFItem{Value: 4.5}},
+		{in: "  1.250 ", want: SFItem{Value: 1.25}, ser: "1.25"},
+		{in: `"hello \"world\""`, want: SFItem{Value: `hello "world"`}},
+		{in: "foo123/456", want: SFItem{Value: SFToken("foo123/456")}},
+		{in: "*", want: SFItem{Value: SFToken("*")}},
+		{in: ":cHJldGVuZCB0aGlzIGlzIGJpbmFyeSBjb250ZW50Lg==:", want: SFItem{Value: []byte("pretend this is binary content.")}},
+		{in: "?0", want: SFItem{Value: false}},
+		{in: "text/html;charset=utf-8;q", want: SFItem{
+			Value:  SFToken("text/html"),
+			Params: SFParams{{"charset", SFToken("utf-8")}, {"q", true}},
+		}},
+		{in: "1;a=1;b=2;a=3", want: SFItem{
+			Value:  int64(1),
+			Params: SFParams{{"a", int64(3)}, {"b", int64(2)}},
+		}, ser: "1;a=3;b=2"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSFItem(tt.in)
+		if err != nil {
+			t.Errorf("ParseSFItem(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSFItem(%q) = %#v; want %#v", tt.in, got, tt.want)
+		}
+		want := tt.ser
+		if want == "" {
+			want = tt.in
+		}
+		if s, err := SerializeSFItem(got); err != nil || s != want {
+			t.Errorf("SerializeSFItem(%#v) = %q, %v; want %q", got, s, err, want)
+		}
+	}
+}
+
+func TestParseSFItemErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"1234567890123456",
+		"1234567890123.0",
+		"1.2345",
+		"1.",
+		"--1",
+		`"unterminated`,
+		`"bad \x"`,
+		"\"tab\t\"",
+		":abc",
+		"?2",
+		"1;A=1",
+		"1 2",
+		"é",
+	} {
+		if item, err := ParseSFItem(in); err == nil {
+			t.Errorf("ParseSFItem(%q) = %#v; want error", in, item)
+		}
+	}
+}
+
+func TestParseSFList(t *testing.T) {
+	in := `sugar, tea;q=0.5, ("foo" "bar");lvl=5, ()`
+	want := SFList{
+		SFItem{Value: SFToken("sugar")},
+		SFItem{Value: SFToken("tea"), Params: SFParams{{"q", 0.5}}},
+		SFInnerList{
+			Items:  []SFItem{{Value: "foo"}, {Value: "bar"}},
+			Params: SFParams{{"lvl", int64(5)}},
+		},
+		SFInnerList{},
+	}
+	got, err := ParseSFList(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseSFList(%q) = %#v; want %#v", in, got, want)
+	}
+	if s, err := SerializeSFList(got); err != nil || s != in {
+		t.Errorf("SerializeSFList = %q, %v; want %q", s, err, in)
+	}
+
+	if l, err := ParseSFList(""); err != nil || len(l) != 0 {
+		t.Errorf(`ParseSFList("") = %#v, %v; want empty list`, l, err)
+	}
+	for _, in := range []string{"a,", "a,,b", "(a b", "(a,b)", "a b"} {
+		if l, err := ParseSFList(in); err == nil {
+			t.Errorf("ParseSFList(%q) = %#v; want error", in, l)
+		}
+	}
+}
+
+func TestParseSFDictionary(t *testing.T) {
+	in := "u=2, i, a=?0;x, b=(1 2);y=\"z\", u=3"
+	want := SFDictionary{
+		{"u", SFItem{Value: int64(3)}},
+		{"i", SFItem{Value: true}},
+		{"a", SFItem{Value: false, Params: SFParams{{"x", true}}}},
+		{"b", SFInnerList{Items: []SFItem{{Value: int64(1)}, {Value: int64(2)}}, Params: SFParams{{"y", "z"}}}},
+	}
+	got, err := ParseSFDictionary(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseSFDictionary(%q) = %#v; want %#v", in, got, want)
+	}
+	if m, ok := got.Get("i"); !ok || m.(SFItem).Value != true {
+		t.Errorf("Get(%q) = %#v, %v", "i", m, ok)
+	}
+	const ser = "u=3, i, a=?0;x, b=(1 2);y=\"z\""
+	if s, err := SerializeSFDictionary(got); err != nil || s != ser {
+		t.Errorf("SerializeSFDictionary = %q, %v; want %q", s, err, ser)
+	}
+	for _, in := range []string{"A=1", "a=", "a=1,", "a=1;"} {
+		if d, err := ParseSFDictionary(in); err == nil {
+			t.Errorf("ParseSFDictionary(%q) = %#v; want error", in, d)
+		}
+	}
+}
+
+func TestSerializeSFErrors(t *testing.T) {
+	for _, item := range []SFItem{
+		{Value: int64(1e15)},
+		{Value: 1e12},
+		{Value: "caf\xc3\xa9"},
+		{Value: SFToken("1abc")},
+		{Value: SFToken("a b")},
+		{Value: uint8(1)},
+		{Value: true, Params: SFParams{{"Bad", true}}},
+	} {
+		if s, err := SerializeSFItem(item); err == nil {
+			t.Errorf("SerializeSFItem(%#v) = %q; want error", item, s)
+		}
+	}
+	if s, err := SerializeSFItem(SFItem{Value: 1.0005}); err != nil || s != "1.0" {
+		t.Errorf("SerializeSFItem(1.0005) = %q, %v; want %q", s, err, "1.0")
+	}
+	if s, err := SerializeSFItem(SFItem{Value: 7}); err != nil || s != "7" {
+		t.Errorf("SerializeSFItem(7) = %q, %v; want %q", s, err, "7")
+	}
+}
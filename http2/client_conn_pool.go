@@ -195,7 +195,7 @@ type addConnCall struct {
 }
 
 func (c *addConnCall) run(t *Transport, key string, tc *tls.Conn) {
-	cc, err := t.NewClientConn(tc)
+	cc, err := t.newClientConn(tc, key, t.disableKeepAlives())
 
 	p := c.p
 	p.mu.Lock()
@@ -261,6 +261,24 @@ func (p *clientConnPool) closeIdleConnections() {
 	}
 }
 
+// closeIfTooManyIdle closes cc, which has become idle, if p holds at
+// least max other idle connections to its addresses.
+func (p *clientConnPool) closeIfTooManyIdle(cc *ClientConn, max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, key := range p.keys[cc] {
+		for _, c := range p.conns[key] {
+			if c != cc && c.isIdle() {
+				n++
+			}
+		}
+	}
+	if n >= max {
+		cc.closeIfIdle()
+	}
+}
+
 func filterOutClientConn(in []*ClientConn, exclude *ClientConn) []*ClientConn {
 	out := in[:0]
 	for _, v := range in {
@@ -0,0 +1,57 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"net/http"
+)
+
+// A ClientCertRequiredError reports that a request to a resource which
+// requires a client certificate, according to Server.RequireClientCert,
+// was made on a connection whose client did not present one. As RFC 8740
+// and RFC 9113, Section 9.2 forbid TLS renegotiation and post-handshake
+// authentication on HTTP/2 connections, the server cannot request one.
+// See ClientCertError.
+type ClientCertRequiredError struct{}
+
+func (*ClientCertRequiredError) Error() string {
+	return "http2: client certificate required; HTTP/2 forbids requesting one after the handshake"
+}
+
+type clientCertErrorKey struct{}
+
+// ClientCertError returns the *ClientCertRequiredError of r if it was
+// received by a Server whose RequireClientCert reports that it requires a
+// client certificate which the connection lacks, or nil. The Handler may
+// then respond with an error, or redirect the client to a host which
+// requests certificates during the handshake.
+func ClientCertError(r *http.Request) error {
+	if err, ok := r.Context().Value(clientCertErrorKey{}).(*ClientCertRequiredError); ok {
+		return err
+	}
+	return nil
+}
+
+// checkClientCert checks that the connection of the request req of the
+// stream st, whose ResponseWriter is rw, has the client certificate that
+// Server.RequireClientCert requires, if any. Otherwise, it returns a
+// stream error asking the client to retry over HTTP/1.1, or the request
+// with a ClientCertRequiredError for the Handler.
+func (sc *serverConn) checkClientCert(st *stream, rw *responseWriter, req *http.Request) (*http.Request, error) {
+	sc.serveG.check()
+	if sc.srv.RequireClientCert == nil || req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return req, nil
+	}
+	if !sc.srv.RequireClientCert(req) {
+		return req, nil
+	}
+	if sc.srv.ClientCertHTTP11Fallback {
+		return nil, sc.countError("client_cert_http11", streamError(st.id, ErrCodeHTTP11Required))
+	}
+	req = req.WithContext(context.WithValue(req.Context(), clientCertErrorKey{}, &ClientCertRequiredError{}))
+	rw.rws.req = req
+	return req, nil
+}
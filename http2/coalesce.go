@@ -0,0 +1,383 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// coalescer coalesces the identical requests in flight of a Transport.
+// See Transport.CoalesceRequests.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// A coalescedCall is a round trip shared by identical requests.
+type coalescedCall struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed once res and err are set
+
+	// waiters is the number of requests waiting for the response,
+	// guarded by coalescer.mu. The round trip is canceled if all of them
+	// are.
+	waiters int
+
+	res  *http.Response
+	err  error
+	body *sharedBody // of res, if shared
+}
+
+// coalesceKey returns the key of the requests identical to req, and
+// whether req may be coalesced: a GET or HEAD request without body,
+// which does not ask for a response from the origin server with its
+// Cache-Control or Pragma header.
+func coalesceKey(req *http.Request) (string, bool) {
+	if req.Method != "GET" && req.Method != "HEAD" && req.Method != "" {
+		return "", false
+	}
+	if req.Body != nil && req.Body != http.NoBody || req.Close {
+		return "", false
+	}
+	for _, v := range req.Header["Cache-Control"] {
+		if hasToken(v, "no-cache") || hasToken(v, "no-store") {
+			return "", false
+		}
+	}
+	for _, v := range req.Header["Pragma"] {
+		if hasToken(v, "no-cache") {
+			return "", false
+		}
+	}
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+	b.WriteByte(' ')
+	b.WriteString(req.Host)
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			b.WriteString("\r\n")
+			b.WriteString(k)
+			b.WriteString(": ")
+			b.WriteString(v)
+		}
+	}
+	return b.String(), true
+}
+
+// hasToken reports whether the comma-separated list v holds token,
+// ignoring case and any value such as that of "max-age=0".
+func hasToken(v, token string) bool {
+	for _, t := range strings.Split(v, ",") {
+		t = textproto.TrimString(t)
+		if i := strings.IndexByte(t, '='); i >= 0 {
+			t = t[:i]
+		}
+		if asciiEqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedResponse reports whether res may be shared by the requests
+// coalesced: it is neither private nor carries cookies.
+func sharedResponse(res *http.Response) bool {
+	for _, v := range res.Header["Cache-Control"] {
+		if hasToken(v, "private") || hasToken(v, "no-store") {
+			return false
+		}
+	}
+	return len(res.Header["Set-Cookie"]) == 0
+}
+
+// roundTrip sends req, whose key is key, with roundTrip, unless an
+// identical request is in flight, whose response it then shares.
+func (c *coalescer) roundTrip(key string, req *http.Request, roundTrip func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[string]*coalescedCall)
+	}
+	call, ok := c.calls[key]
+	if !ok {
+		// The round trip outlives the request which starts it, if
+		// the others sharing it are not canceled.
+		ctx, cancel := context.WithCancel(context.Background())
+		call = &coalescedCall{cancel: cancel, done: make(chan struct{})}
+		c.calls[key] = call
+		go c.do(key, call, req.WithContext(ctx), roundTrip)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-req.Context().Done():
+		c.mu.Lock()
+		select {
+		case <-call.done:
+			// The response arrived meanwhile, counting req.
+			c.release(call)
+		default:
+			call.waiters--
+			if call.waiters == 0 {
+				call.cancel()
+				if c.calls[key] == call {
+					delete(c.calls, key)
+				}
+			}
+		}
+		c.mu.Unlock()
+		return nil, req.Context().Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	if call.body == nil {
+		// The response cannot be shared: the first request gets it,
+		// and the others are sent on their own.
+		c.mu.Lock()
+		first := call.res != nil
+		res := call.res
+		call.res = nil
+		c.mu.Unlock()
+		if first {
+			res.Request = req
+			return res, nil
+		}
+		return roundTrip(req)
+	}
+	res := new(http.Response)
+	*res = *call.res
+	res.Header = call.res.Header.Clone()
+	res.Trailer = call.res.Trailer.Clone()
+	res.Request = req
+	res.Body = call.body.newReader(req.Context())
+	return res, nil
+}
+
+// do executes the round trip of call, once for the requests sharing it.
+func (c *coalescer) do(key string, call *coalescedCall, req *http.Request, roundTrip func(*http.Request) (*http.Response, error)) {
+	res, err := roundTrip(req)
+	c.mu.Lock()
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	if err != nil {
+		call.cancel()
+	} else if sharedResponse(res) {
+		call.body = newSharedBody(res.Body, call.waiters, call.cancel)
+	}
+	call.res, call.err = res, err
+	if err == nil && call.waiters == 0 {
+		// All the requests were canceled.
+		res.Body.Close()
+		call.cancel()
+	}
+	// The requests canceled from now on are counted by the response.
+	close(call.done)
+	c.mu.Unlock()
+}
+
+// release releases the share of the response of call of a request
+// canceled once it arrived. c.mu must be held.
+func (c *coalescer) release(call *coalescedCall) {
+	switch {
+	case call.err != nil:
+	case call.body != nil:
+		call.body.newReader(context.Background()).Close()
+	case call.res != nil:
+		call.res.Body.Close()
+		call.res = nil
+		call.cancel()
+	}
+}
+
+// maxSharedBodyBuffered is the number of bytes of a shared body buffered
+// for the requests which read it more slowly than the others. Those
+// which fall behind by more are sent errSharedBodyTooSlow.
+const maxSharedBodyBuffered = 1 << 20
+
+var errSharedBodyTooSlow = errors.New("http2: coalesced response body read too slowly")
+
+// A sharedBody is the body of a response shared by coalesced requests,
+// buffered from the offset of the slowest of them.
+type sharedBody struct {
+	src    io.ReadCloser
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced when buf or err change
+	buf     []byte
+	start   int   // offset in the body of buf
+	err     error // of src, io.EOF at its end
+	reading bool  // src is being read
+	closed  bool  // src is closed
+
+	// pending is the number of readers not yet created, which read
+	// from offset 0, and readers are those created, not closed nor
+	// detached for being too slow.
+	pending int
+	readers map[*sharedBodyReader]bool
+}
+
+func newSharedBody(src io.ReadCloser, readers int, cancel context.CancelFunc) *sharedBody {
+	return &sharedBody{
+		src:     src,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+		pending: readers,
+		readers: make(map[*sharedBodyReader]bool),
+	}
+}
+
+// newReader returns the reader of one of the requests counted by
+// newSharedBody, which stops waiting for the body once ctx is done.
+func (b *sharedBody) newReader(ctx context.Context) *sharedBodyReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := &sharedBodyReader{b: b, ctx: ctx}
+	b.pending--
+	if b.start > 0 {
+		r.err = errSharedBodyTooSlow
+	} else {
+		b.readers[r] = true
+	}
+	return r
+}
+
+// fill reads the next chunk of src, off the readers, which wait for it
+// with their contexts.
+func (b *sharedBody) fill() {
+	chunk := make([]byte, 32<<10)
+	n, err := b.src.Read(chunk)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reading = false
+	b.buf = append(b.buf, chunk[:n]...)
+	if err != nil {
+		b.err = err
+	}
+	b.trim()
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// trim detaches the readers which fell behind the others by more than
+// maxSharedBodyBuffered, and drops the bytes read by all the readers
+// left, closing src once there are none. b.mu must be held.
+func (b *sharedBody) trim() {
+	end := b.start + len(b.buf)
+	limit := end - maxSharedBodyBuffered
+	low := end
+	if b.pending > 0 {
+		low = 0
+	}
+	for r := range b.readers {
+		if r.off < limit {
+			r.err = errSharedBodyTooSlow
+			delete(b.readers, r)
+			continue
+		}
+		if r.off < low {
+			low = r.off
+		}
+	}
+	if len(b.readers) == 0 && b.pending == 0 {
+		if !b.closed {
+			b.closed = true
+			b.src.Close()
+			b.cancel()
+		}
+		b.buf = nil
+		return
+	}
+	if low < limit {
+		// The readers not yet created are too slow.
+		low = limit
+	}
+	if low > b.start {
+		b.buf = append(b.buf[:0:0], b.buf[low-b.start:]...)
+		b.start = low
+	}
+}
+
+// release releases the share of r of b. b.mu must be held.
+func (b *sharedBody) release(r *sharedBodyReader) {
+	if !b.readers[r] {
+		return
+	}
+	delete(b.readers, r)
+	b.trim()
+}
+
+// A sharedBodyReader is the Body of a response of a coalesced request.
+type sharedBodyReader struct {
+	b      *sharedBody
+	ctx    context.Context
+	off    int   // in the body
+	err    error // set when detached from b
+	closed bool
+}
+
+func (r *sharedBodyReader) Read(p []byte) (int, error) {
+	b := r.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if r.closed {
+			return 0, errClosedResponseBody
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.off < b.start+len(b.buf) {
+			n := copy(p, b.buf[r.off-b.start:])
+			r.off += n
+			return n, nil
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+		if !b.reading {
+			b.reading = true
+			go b.fill()
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.ctx.Done():
+			b.mu.Lock()
+			return 0, r.ctx.Err()
+		}
+		b.mu.Lock()
+	}
+}
+
+func (r *sharedBodyReader) Close() error {
+	b := r.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	b.release(r)
+	return nil
+}
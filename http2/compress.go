@@ -0,0 +1,251 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minEncodedResponseSize is the size of the response bodies, when known,
+// below which they are not compressed.
+const minEncodedResponseSize = 1024
+
+// A ResponseEncoder compresses the response bodies of a Server with a
+// content-coding. See Server.ResponseEncoders.
+type ResponseEncoder struct {
+	// Coding is the name of the content-coding, such as "gzip" or
+	// "zstd", as it appears in the Accept-Encoding and Content-Encoding
+	// header fields.
+	Coding string
+
+	// NewWriter returns an EncodingWriter compressing a response body
+	// to w. It may be called concurrently.
+	NewWriter func(w io.Writer) EncodingWriter
+}
+
+// An EncodingWriter compresses a response body. Flush is called when the
+// Handler flushes the response, and must write the compressed form of
+// all the data written so far; Close is called at the end of the
+// response.
+//
+// The Writers of compress/gzip and compress/flate are EncodingWriters,
+// as are the Encoders of common zstd packages.
+type EncodingWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// GzipEncoder returns a ResponseEncoder of the gzip content-coding,
+// compressing at level, as gzip.NewWriterLevel does, or at
+// gzip.DefaultCompression if level is invalid. Its writers are reused
+// across responses.
+func GzipEncoder(level int) ResponseEncoder {
+	if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+		level = gzip.DefaultCompression
+	}
+	pool := &sync.Pool{New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(nil, level)
+		return zw
+	}}
+	return ResponseEncoder{
+		Coding: "gzip",
+		NewWriter: func(w io.Writer) EncodingWriter {
+			zw := pool.Get().(*gzip.Writer)
+			zw.Reset(w)
+			return &pooledGzipWriter{Writer: zw, pool: pool}
+		},
+	}
+}
+
+// A pooledGzipWriter returns its gzip.Writer to its pool when closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	w.Writer.Reset(nil)
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// selectResponseEncoder returns the encoder of encs whose content-coding
+// the Accept-Encoding header field values accept prefers, the first of
+// them on ties, or nil if none is acceptable.
+func selectResponseEncoder(encs []ResponseEncoder, accept []string) *ResponseEncoder {
+	if len(accept) == 0 {
+		return nil
+	}
+	qs := make([]float64, len(encs))
+	listed := make([]bool, len(encs))
+	starQ := 0.0
+	for _, v := range accept {
+		foreachHeaderElement(v, func(e string) {
+			coding, q := parseAcceptCoding(e)
+			if coding == "*" {
+				starQ = q
+				return
+			}
+			for i := range encs {
+				if asciiEqualFold(coding, encs[i].Coding) {
+					qs[i], listed[i] = q, true
+				}
+			}
+		})
+	}
+	var best *ResponseEncoder
+	bestQ := 0.0
+	for i := range encs {
+		q := qs[i]
+		if !listed[i] {
+			q = starQ
+		}
+		if q > bestQ {
+			best, bestQ = &encs[i], q
+		}
+	}
+	return best
+}
+
+// parseAcceptCoding returns the content-coding and the qvalue of the
+// element e of an Accept-Encoding header field, such as "gzip;q=0.5".
+func parseAcceptCoding(e string) (coding string, q float64) {
+	q = 1
+	params := strings.Split(e, ";")
+	coding = textproto.TrimString(params[0])
+	for _, p := range params[1:] {
+		p = textproto.TrimString(p)
+		if len(p) < 2 || (p[0] != 'q' && p[0] != 'Q') || p[1] != '=' {
+			continue
+		}
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil || v < 0 || v > 1 {
+			return coding, 0
+		}
+		q = v
+	}
+	return coding, q
+}
+
+// hasHeaderToken reports whether one of the comma-separated elements of
+// the header field values vv is token, ignoring case.
+func hasHeaderToken(vv []string, token string) bool {
+	found := false
+	for _, v := range vv {
+		foreachHeaderElement(v, func(e string) {
+			if asciiEqualFold(e, token) {
+				found = true
+			}
+		})
+	}
+	return found
+}
+
+// isCompressibleType reports whether the responses of media type ct,
+// the value of a Content-Type header field, are worth compressing.
+func isCompressibleType(ct string) bool {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	ct, ok := asciiToLower(textproto.TrimString(ct))
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(ct, "text/") || strings.HasSuffix(ct, "+json") || strings.HasSuffix(ct, "+xml") {
+		return true
+	}
+	switch ct {
+	case "application/json", "application/javascript", "application/ecmascript",
+		"application/xml", "application/wasm", "image/svg+xml", "image/x-icon",
+		"font/ttf", "font/otf":
+		return true
+	}
+	return false
+}
+
+// startEncoding decides, when the response header is sent, whether the
+// response body is compressed, updating its header fields if so. ctype
+// is the sniffed Content-Type, if the Handler set none, and clen the
+// Content-Length to send, if known.
+func (rws *responseWriterState) startEncoding(ctype, clen string) bool {
+	if !bodyAllowedForStatus(rws.status) || rws.status == http.StatusPartialContent {
+		return false
+	}
+	h := rws.snapHeader
+	if _, ok := h["Content-Encoding"]; ok {
+		return false
+	}
+	if _, ok := h["Content-Range"]; ok || hasHeaderToken(h["Cache-Control"], "no-transform") {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = ctype
+	}
+	if !isCompressibleType(ct) {
+		return false
+	}
+
+	// The response could be compressed, so caches must tell apart the
+	// requests by their Accept-Encoding whether it is or not.
+	if h == nil {
+		h = make(http.Header)
+		rws.snapHeader = h
+	}
+	if !hasHeaderToken(h["Vary"], "Accept-Encoding") && !hasHeaderToken(h["Vary"], "*") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if clen != "" {
+		if n, err := strconv.ParseInt(clen, 10, 63); err == nil && n < minEncodedResponseSize {
+			return false
+		}
+	}
+	enc := selectResponseEncoder(rws.conn.srv.ResponseEncoders, rws.req.Header["Accept-Encoding"])
+	if enc == nil {
+		return false
+	}
+
+	h.Set("Content-Encoding", enc.Coding)
+	// The compressed representation is not byte-for-byte that of a
+	// strong ETag.
+	if etag := h.Get("Etag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("Etag", "W/"+etag)
+	}
+	if rws.req.Method != "HEAD" {
+		rws.encoder = enc.NewWriter(&rws.encodedBuf)
+	}
+	return true
+}
+
+// encode returns the compressed form of p, to send in DATA frames, and
+// with it that of all the data written before when the Handler is
+// flushing the response or is done.
+func (rws *responseWriterState) encode(p []byte) ([]byte, error) {
+	rws.encodedBuf.Reset()
+	if len(p) > 0 {
+		if _, err := rws.encoder.Write(p); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	switch {
+	case rws.handlerDone:
+		err = rws.encoder.Close()
+	case rws.flushing:
+		err = rws.encoder.Flush()
+	}
+	return rws.encodedBuf.Bytes(), err
+}
@@ -74,6 +74,13 @@ type StreamError struct {
 	Cause    error // optional additional detail
 }
 
+// Retryable reports whether the peer refused the stream with
+// ErrCodeRefusedStream, which means that it did not process it, so that a
+// request refused may be sent again, as RFC 9113, Section 8.7 allows.
+func (e StreamError) Retryable() bool {
+	return e.Code == ErrCodeRefusedStream
+}
+
 // errFromPeer is a sentinel error value for StreamError.Cause to
 // indicate that the StreamError was sent from the peer over the wire
 // and wasn't locally generated in the Transport.
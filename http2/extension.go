@@ -0,0 +1,103 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "errors"
+
+var (
+	errNotExtensionFrame      = errors.New("http2: frame type is not an extension type")
+	errExtensionFrameTooLarge = errors.New("http2: extension frame payload too large")
+)
+
+// An ExtensionFrameParser parses the frames of an extension type, whose
+// payload is owned by the Framer and must be copied to be retained by the
+// Frame returned. The Frame can embed its FrameHeader to implement Frame.
+// See Framer.ExtensionFrameParsers.
+type ExtensionFrameParser func(fh FrameHeader, payload []byte) (Frame, error)
+
+// An ExtensionFrameWriter sends frames of extension types, unknown to
+// this package, on an HTTP/2 connection, as RFC 9113, Section 5.5
+// allows. Peers ignore the frames of the types they do not know, such as
+// the reserved types of the GREASE mechanism.
+//
+// A ClientConn is an ExtensionFrameWriter, and so are the
+// http.ResponseWriters of the Server, for their connection.
+type ExtensionFrameWriter interface {
+	// WriteExtensionFrame sends a frame of type t, which must not be a
+	// type defined by RFC 9113, with a payload of at most 16384 bytes,
+	// the maximum frame size all peers accept. The payload may be
+	// modified once WriteExtensionFrame returns.
+	WriteExtensionFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error
+}
+
+// checkExtensionFrame returns an error if a frame of type t with
+// the payload p cannot be sent as an extension frame.
+func checkExtensionFrame(t FrameType, p []byte) error {
+	if frameParsers[t] != nil {
+		return errNotExtensionFrame
+	}
+	if len(p) > minMaxFrameSize {
+		return errExtensionFrameTooLarge
+	}
+	return nil
+}
+
+// writeExtensionFrame is a writeFramer for an extension frame.
+type writeExtensionFrame struct {
+	typ      FrameType
+	flags    Flags
+	streamID uint32
+	payload  []byte
+}
+
+func (w writeExtensionFrame) writeFrame(ctx writeContext) error {
+	return ctx.Framer().WriteRawFrame(w.typ, w.flags, w.streamID, w.payload)
+}
+
+func (w writeExtensionFrame) staysWithinBuffer(max int) bool {
+	return frameHeaderLen+len(w.payload) <= max
+}
+
+// serverExtensionFrameWriter writes the extension frames of the
+// Server.OnExtensionFrame hook, from the serve goroutine.
+type serverExtensionFrameWriter struct{ sc *serverConn }
+
+func (w serverExtensionFrameWriter) WriteExtensionFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error {
+	w.sc.serveG.check()
+	if err := checkExtensionFrame(t, payload); err != nil {
+		return err
+	}
+	p := append([]byte(nil), payload...)
+	w.sc.writeFrame(FrameWriteRequest{write: writeExtensionFrame{t, flags, streamID, p}})
+	return nil
+}
+
+// WriteExtensionFrame sends an extension frame on the connection of the
+// stream of w. See ExtensionFrameWriter.
+func (w *responseWriter) WriteExtensionFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error {
+	rws := w.rws
+	if rws == nil {
+		panic("WriteExtensionFrame called after Handler finished")
+	}
+	if err := checkExtensionFrame(t, payload); err != nil {
+		return err
+	}
+	p := append([]byte(nil), payload...)
+	return rws.conn.writeFrameFromHandler(FrameWriteRequest{write: writeExtensionFrame{t, flags, streamID, p}})
+}
+
+// WriteExtensionFrame sends an extension frame on the connection.
+// See ExtensionFrameWriter.
+func (cc *ClientConn) WriteExtensionFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error {
+	if err := checkExtensionFrame(t, payload); err != nil {
+		return err
+	}
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	if err := cc.fr.WriteRawFrame(t, flags, streamID, payload); err != nil {
+		return err
+	}
+	return cc.bw.Flush()
+}
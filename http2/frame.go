@@ -152,7 +152,8 @@ type FrameHeader struct {
 
 	// Type is the 1 byte frame type. There are ten standard frame
 	// types, but extension frame types may be written by WriteRawFrame
-	// and will be returned by ReadFrame (as UnknownFrame).
+	// and will be returned by ReadFrame (as UnknownFrame, unless
+	// parsed by Framer.ExtensionFrameParsers).
 	Type FrameType
 
 	// Flags are the 1 byte of 8 potential bit flags per frame.
@@ -238,13 +239,17 @@ func readFrameHeader(buf []byte, r io.Reader) (FrameHeader, error) {
 	if err != nil {
 		return FrameHeader{}, err
 	}
+	return parseFrameHeader(buf), nil
+}
+
+func parseFrameHeader(buf []byte) FrameHeader {
 	return FrameHeader{
 		Length:   (uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2])),
 		Type:     FrameType(buf[3]),
 		Flags:    Flags(buf[4]),
 		StreamID: binary.BigEndian.Uint32(buf[5:]) & (1<<31 - 1),
 		valid:    true,
-	}, nil
+	}
 }
 
 // A Frame is the base interface implemented by all frame types.
@@ -279,6 +284,11 @@ type Framer struct {
 	maxReadSize uint32
 	headerBuf   [frameHeaderLen]byte
 
+	// interrupted holds the bytes of the frame that the last ReadFrame
+	// call consumed before failing with a read error, so that they can
+	// be replayed when a connection is handed off.
+	interrupted []byte
+
 	// TODO: let getReadBuf be configurable, and use a less memory-pinning
 	// allocator in server.go to minimize memory pinned for many idle conns.
 	// Will probably also need to make frame invalidation have a hook too.
@@ -316,6 +326,12 @@ type Framer struct {
 	// If the limit is hit, MetaHeadersFrame.Truncated is set true.
 	MaxHeaderListSize uint32
 
+	// ExtensionFrameParsers optionally maps the frame types unknown to
+	// this package to the parsers of their frames, which ReadFrame then
+	// returns instead of an UnknownFrame. The parsers of the types
+	// defined by RFC 9113 are ignored.
+	ExtensionFrameParsers map[FrameType]ExtensionFrameParser
+
 	// TODO: track which type of frame & with which flags was sent
 	// last. Then return an error (unless AllowIllegalWrites) if
 	// we're in the middle of a header block and a
@@ -495,18 +511,27 @@ func (fr *Framer) ReadFrame() (Frame, error) {
 	if fr.lastFrame != nil {
 		fr.lastFrame.invalidate()
 	}
-	fh, err := readFrameHeader(fr.headerBuf[:], fr.r)
-	if err != nil {
+	fr.interrupted = nil
+	if n, err := io.ReadFull(fr.r, fr.headerBuf[:]); err != nil {
+		fr.interrupted = append([]byte(nil), fr.headerBuf[:n]...)
 		return nil, err
 	}
+	fh := parseFrameHeader(fr.headerBuf[:])
 	if fh.Length > fr.maxReadSize {
 		return nil, ErrFrameTooLarge
 	}
 	payload := fr.getReadBuf(fh.Length)
-	if _, err := io.ReadFull(fr.r, payload); err != nil {
+	if n, err := io.ReadFull(fr.r, payload); err != nil {
+		fr.interrupted = append(append([]byte(nil), fr.headerBuf[:]...), payload[:n]...)
 		return nil, err
 	}
-	f, err := typeFrameParser(fh.Type)(fr.frameCache, fh, fr.countError, payload)
+	var f Frame
+	var err error
+	if p := fr.ExtensionFrameParsers[fh.Type]; p != nil && frameParsers[fh.Type] == nil {
+		f, err = p(fh, payload)
+	} else {
+		f, err = typeFrameParser(fh.Type)(fr.frameCache, fh, fr.countError, payload)
+	}
 	if err != nil {
 		if ce, ok := err.(connError); ok {
 			return nil, fr.connError(ce.Code, ce.Reason)
@@ -1416,6 +1441,7 @@ type headersEnder interface {
 
 type headersOrContinuation interface {
 	headersEnder
+	Header() FrameHeader
 	HeaderBlockFragment() []byte
 }
 
@@ -1444,6 +1470,12 @@ type MetaHeadersFrame struct {
 	// and Fields is incomplete. The hpack decoder state is still
 	// valid, however.
 	Truncated bool
+
+	// wireSize is the size of the HEADERS and CONTINUATION frames,
+	// including their frame headers, blockSize the size of the
+	// header block they carry, and fieldSize the total length of the
+	// names and values in Fields.
+	wireSize, blockSize, fieldSize int64
 }
 
 // PseudoValue returns the given pseudo header field's value.
@@ -1487,7 +1519,7 @@ func (mh *MetaHeadersFrame) checkPseudos() error {
 	pf := mh.PseudoFields()
 	for i, hf := range pf {
 		switch hf.Name {
-		case ":method", ":path", ":scheme", ":authority":
+		case ":method", ":path", ":scheme", ":authority", ":protocol":
 			isRequest = true
 		case ":status":
 			isResponse = true
@@ -1570,6 +1602,7 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 		remainSize -= size
 
 		mh.Fields = append(mh.Fields, hf)
+		mh.fieldSize += int64(len(hf.Name) + len(hf.Value))
 	})
 	// Lose reference to MetaHeadersFrame:
 	defer hdec.SetEmitFunc(func(hf hpack.HeaderField) {})
@@ -1577,6 +1610,8 @@ func (fr *Framer) readMetaFrame(hf *HeadersFrame) (*MetaHeadersFrame, error) {
 	var hc headersOrContinuation = hf
 	for {
 		frag := hc.HeaderBlockFragment()
+		mh.wireSize += frameHeaderLen + int64(hc.Header().Length)
+		mh.blockSize += int64(len(frag))
 		if _, err := hdec.Write(frag); err != nil {
 			return nil, ConnectionError(ErrCodeCompression)
 		}
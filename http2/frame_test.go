@@ -1096,6 +1096,13 @@ func TestMetaFrameHeader(t *testing.T) {
 				got = se
 			}
 		}
+		// The size counters are checked by TestServerStreamStats.
+		if mh, ok := got.(*MetaHeadersFrame); ok {
+			if mh.wireSize < frameHeaderLen+mh.blockSize {
+				t.Errorf("%s: wireSize = %d for a %d byte header block", name, mh.wireSize, mh.blockSize)
+			}
+			mh.wireSize, mh.blockSize, mh.fieldSize = 0, 0, 0
+		}
 		if !reflect.DeepEqual(got, tt.want) {
 			if mhg, ok := got.(*MetaHeadersFrame); ok {
 				if mhw, ok := tt.want.(*MetaHeadersFrame); ok {
@@ -1258,3 +1265,46 @@ func TestSettingsDuplicates(t *testing.T) {
 	}
 
 }
+
+type testExtensionFrame struct {
+	FrameHeader
+	data string
+}
+
+func TestExtensionFrameParsers(t *testing.T) {
+	fr, _ := testFramer()
+	fr.ExtensionFrameParsers = map[FrameType]ExtensionFrameParser{
+		0xfa: func(fh FrameHeader, p []byte) (Frame, error) {
+			return &testExtensionFrame{fh, string(p)}, nil
+		},
+		FramePing: func(fh FrameHeader, p []byte) (Frame, error) {
+			t.Error("parser of a PING frame called")
+			return nil, nil
+		},
+	}
+	fr.WriteRawFrame(0xfa, 0x1, 3, []byte("foo"))
+	fr.WriteRawFrame(0xfb, 0, 0, []byte("bar"))
+	fr.WritePing(false, [8]byte{})
+
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ef, ok := f.(*testExtensionFrame)
+	if !ok {
+		t.Fatalf("got %T; want *testExtensionFrame", f)
+	}
+	if ef.Type != 0xfa || ef.Flags != 0x1 || ef.StreamID != 3 || ef.data != "foo" {
+		t.Errorf("got %v %q; want type 0xfa, flags 0x1, stream 3 and %q", ef.FrameHeader, ef.data, "foo")
+	}
+	if f, err := fr.ReadFrame(); err != nil {
+		t.Fatal(err)
+	} else if uf, ok := f.(*UnknownFrame); !ok || string(uf.Payload()) != "bar" {
+		t.Errorf("got %v; want an UnknownFrame with payload %q", f, "bar")
+	}
+	if f, err := fr.ReadFrame(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := f.(*PingFrame); !ok {
+		t.Errorf("got %T; want *PingFrame", f)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/textproto"
 	"os"
 	"strings"
+	"time"
 
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2"
@@ -48,6 +49,51 @@ func init() {
 type h2cHandler struct {
 	Handler http.Handler
 	s       *http2.Server
+	opts    options
+}
+
+// An Option configures a Handler returned by NewHandler.
+type Option func(*options)
+
+type options struct {
+	readIdleTimeout  time.Duration
+	writeIdleTimeout time.Duration
+	handshakeTimeout time.Duration
+	maxConnAge       time.Duration
+	maxConnAgeGrace  time.Duration
+	allowUpgrade     func(*http.Request) bool // nil means preferH2C
+}
+
+// UpgradePolicy returns an Option which calls allow for each HTTP/1
+// request asking to upgrade to h2c. The request is upgraded only if
+// allow returns true. Otherwise it is passed to the wrapped Handler
+// like any other HTTP/1 request, which can serve it or switch the
+// connection to another protocol, such as WebSocket.
+//
+// By default, a request is upgraded only if h2c is the first protocol,
+// the one the client prefers, of its Upgrade header.
+func UpgradePolicy(allow func(r *http.Request) bool) Option {
+	return func(o *options) { o.allowUpgrade = allow }
+}
+
+func (o *options) upgradeAllowed(r *http.Request) bool {
+	if o.allowUpgrade != nil {
+		return o.allowUpgrade(r)
+	}
+	return preferH2C(r)
+}
+
+// preferH2C reports whether h2c is the first protocol of the Upgrade
+// header of r.
+func preferH2C(r *http.Request) bool {
+	for _, v := range r.Header[textproto.CanonicalMIMEHeaderKey("Upgrade")] {
+		for _, p := range strings.Split(v, ",") {
+			if p = textproto.TrimString(p); p != "" {
+				return strings.EqualFold(p, "h2c")
+			}
+		}
+	}
+	return false
 }
 
 // NewHandler returns an http.Handler that wraps h, intercepting any h2c
@@ -63,11 +109,21 @@ type h2cHandler struct {
 // The first request on an h2c connection is read entirely into memory before
 // the Handler is called. To limit the memory consumed by this request, wrap
 // the result of NewHandler in an http.MaxBytesHandler.
-func NewHandler(h http.Handler, s *http2.Server) http.Handler {
-	return &h2cHandler{
+//
+// Requests upgrading to protocols other than h2c, such as WebSocket,
+// are passed to h; see UpgradePolicy. To also accept WebSocket over the
+// h2c connections (RFC 8441), set s.EnableConnectProtocol.
+//
+// The opts configure the h2c connections and upgrades; see Option.
+func NewHandler(h http.Handler, s *http2.Server, opts ...Option) http.Handler {
+	hd := &h2cHandler{
 		Handler: h,
 		s:       s,
 	}
+	for _, opt := range opts {
+		opt(&hd.opts)
+	}
+	return hd
 }
 
 // extractServer extracts existing http.Server instance from http.Request or create an empty http.Server
@@ -81,12 +137,16 @@ func extractServer(r *http.Request) *http.Server {
 
 // ServeHTTP implement the h2c support that is enabled by h2c.GetH2CHandler.
 func (s h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handshakeDeadline time.Time
+	if s.opts.handshakeTimeout > 0 {
+		handshakeDeadline = time.Now().Add(s.opts.handshakeTimeout)
+	}
 	// Handle h2c with prior knowledge (RFC 7540 Section 3.4)
 	if r.Method == "PRI" && len(r.Header) == 0 && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
 		if http2VerboseLogs {
 			log.Print("h2c: attempting h2c with prior knowledge.")
 		}
-		conn, err := initH2CWithPriorKnowledge(w)
+		conn, err := initH2CWithPriorKnowledge(w, handshakeDeadline)
 		if err != nil {
 			if http2VerboseLogs {
 				log.Printf("h2c: error h2c with prior knowledge: %v", err)
@@ -94,16 +154,18 @@ func (s h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		defer conn.Close()
-		s.s.ServeConn(conn, &http2.ServeConnOpts{
-			Context:          r.Context(),
-			BaseConfig:       extractServer(r),
-			Handler:          s.Handler,
-			SawClientPreface: true,
+		s.s.ServeConn(s.opts.wrapConn(conn, handshakeDeadline, true), &http2.ServeConnOpts{
+			Context:               r.Context(),
+			BaseConfig:            extractServer(r),
+			Handler:               s.Handler,
+			SawClientPreface:      true,
+			MaxConnectionAge:      s.opts.maxConnAge,
+			MaxConnectionAgeGrace: s.opts.maxConnAgeGrace,
 		})
 		return
 	}
 	// Handle Upgrade to h2c (RFC 7540 Section 3.2)
-	if isH2CUpgrade(r.Header) {
+	if isH2CUpgrade(r.Header) && s.opts.upgradeAllowed(r) {
 		conn, settings, err := h2cUpgrade(w, r)
 		if err != nil {
 			if http2VerboseLogs {
@@ -113,12 +175,14 @@ func (s h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		defer conn.Close()
-		s.s.ServeConn(conn, &http2.ServeConnOpts{
-			Context:        r.Context(),
-			BaseConfig:     extractServer(r),
-			Handler:        s.Handler,
-			UpgradeRequest: r,
-			Settings:       settings,
+		s.s.ServeConn(s.opts.wrapConn(conn, handshakeDeadline, false), &http2.ServeConnOpts{
+			Context:               r.Context(),
+			BaseConfig:            extractServer(r),
+			Handler:               s.Handler,
+			UpgradeRequest:        r,
+			Settings:              settings,
+			MaxConnectionAge:      s.opts.maxConnAge,
+			MaxConnectionAgeGrace: s.opts.maxConnAgeGrace,
 		})
 		return
 	}
@@ -130,8 +194,9 @@ func (s h2cHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // knowledge (Section 3.4) and creates a net.Conn suitable for http2.ServeConn.
 // All we have to do is look for the client preface that is suppose to be part
 // of the body, and reforward the client preface on the net.Conn this function
-// creates.
-func initH2CWithPriorKnowledge(w http.ResponseWriter) (net.Conn, error) {
+// creates. If handshakeDeadline is non-zero, it bounds the read of the
+// client preface.
+func initH2CWithPriorKnowledge(w http.ResponseWriter, handshakeDeadline time.Time) (net.Conn, error) {
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
 		return nil, errors.New("h2c: connection does not support Hijack")
@@ -141,6 +206,10 @@ func initH2CWithPriorKnowledge(w http.ResponseWriter) (net.Conn, error) {
 		return nil, err
 	}
 
+	if !handshakeDeadline.IsZero() {
+		conn.SetReadDeadline(handshakeDeadline)
+	}
+
 	const expectedBody = "SM\r\n\r\n"
 
 	buf := make([]byte, len(expectedBody))
@@ -5,6 +5,7 @@
 package h2c
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/http2"
 )
@@ -170,3 +172,101 @@ func TestMaxBytesHandler(t *testing.T) {
 		t.Errorf("resp.StatusCode = %v, want %v", got, want)
 	}
 }
+
+func TestUpgradePassThrough(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Upgrade"))
+	})
+	for _, tt := range []struct {
+		name    string
+		upgrade string
+		opts    []Option
+		want    bool // upgraded to h2c
+	}{{
+		name:    "other protocol preferred",
+		upgrade: "websocket, h2c",
+		want:    false,
+	}, {
+		name:    "policy refuses",
+		upgrade: "h2c",
+		opts:    []Option{UpgradePolicy(func(*http.Request) bool { return false })},
+		want:    false,
+	}, {
+		name:    "policy allows",
+		upgrade: "websocket, h2c",
+		opts:    []Option{UpgradePolicy(func(*http.Request) bool { return true })},
+		want:    true,
+	}, {
+		name:    "default",
+		upgrade: "h2c, websocket",
+		want:    true,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			h1s := httptest.NewServer(NewHandler(handler, &http2.Server{}, tt.opts...))
+			defer h1s.Close()
+
+			req, err := http.NewRequest("GET", h1s.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Http2-Settings", "")
+			req.Header.Set("Upgrade", tt.upgrade)
+			req.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+			c, err := net.Dial("tcp", h1s.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if err := req.Write(c); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(c)
+			resp, err := http.ReadResponse(br, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			upgraded := resp.StatusCode == http.StatusSwitchingProtocols
+			if upgraded != tt.want {
+				t.Errorf("upgraded = %v; want %v", upgraded, tt.want)
+			}
+			var body string
+			if upgraded {
+				body = readUpgradeResponse(t, c, br)
+			} else {
+				b, err := ioutil.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if body != tt.upgrade {
+				t.Errorf("body = %q; want %q", body, tt.upgrade)
+			}
+		})
+	}
+}
+
+// readUpgradeResponse completes the HTTP/2 handshake of an upgraded
+// connection and returns the response body sent on stream 1.
+func readUpgradeResponse(t *testing.T, c net.Conn, br *bufio.Reader) string {
+	t.Helper()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(c, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	fr := http2.NewFramer(c, br)
+	fr.WriteSettings()
+	var body []byte
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if df, ok := f.(*http2.DataFrame); ok && df.StreamID == 1 {
+			body = append(body, df.Data()...)
+			if df.StreamEnded() {
+				return string(body)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package h2c
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// ReadIdleTimeout closes a connection when no data is received on it
+// for d. Unlike http2.Server.IdleTimeout, it applies even when requests
+// are in flight, and the connection is closed without sending a GOAWAY
+// frame. Clients are expected to keep such connections busy, for
+// example with PING frames.
+func ReadIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.readIdleTimeout = d }
+}
+
+// WriteIdleTimeout closes a connection when a write to it makes no
+// progress for d, such as when the client stops reading.
+func WriteIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.writeIdleTimeout = d }
+}
+
+// HandshakeTimeout closes a connection if the client has not sent the
+// HTTP/2 connection preface and its first frame within d of the
+// hijack of the HTTP/1 connection.
+func HandshakeTimeout(d time.Duration) Option {
+	return func(o *options) { o.handshakeTimeout = d }
+}
+
+// MaxConnectionAge gracefully shuts down a connection with a GOAWAY
+// frame once it has been served for age, and closes it if the requests
+// in flight have not completed after a further grace. A zero grace
+// lets them run to completion.
+//
+// See http2.ServeConnOpts.MaxConnectionAge.
+func MaxConnectionAge(age, grace time.Duration) Option {
+	return func(o *options) {
+		o.maxConnAge = age
+		o.maxConnAgeGrace = grace
+	}
+}
+
+// wrapConn returns conn wrapped to enforce the idle and handshake
+// timeouts of o, if any. sawPreface reports whether the client
+// connection preface has already been read from conn.
+func (o *options) wrapConn(conn net.Conn, handshakeDeadline time.Time, sawPreface bool) net.Conn {
+	if o.readIdleTimeout <= 0 && o.writeIdleTimeout <= 0 && handshakeDeadline.IsZero() {
+		return conn
+	}
+	c := &timeoutConn{
+		Conn:              conn,
+		readIdle:          o.readIdleTimeout,
+		writeIdle:         o.writeIdleTimeout,
+		handshakeDeadline: handshakeDeadline,
+		handshakeLeft:     -1,
+	}
+	if !sawPreface {
+		c.prefaceLeft = len(http2.ClientPreface)
+	}
+	return c
+}
+
+// timeoutConn is a net.Conn which sets the read and write deadlines of
+// the underlying connection before each Read and Write, combining the
+// deadlines set by the http2 server with the idle and handshake
+// timeouts.
+type timeoutConn struct {
+	net.Conn
+	readIdle  time.Duration
+	writeIdle time.Duration
+
+	mu            sync.Mutex
+	readDeadline  time.Time // set by SetReadDeadline
+	writeDeadline time.Time // set by SetWriteDeadline
+	readLimit     time.Time // idle or handshake deadline of the last Read
+	writeLimit    time.Time // idle deadline of the last Write
+
+	// Owned by the Read caller.
+	handshakeDeadline time.Time // zero once the handshake is complete
+	prefaceLeft       int       // bytes of the client preface still to read
+	frameHeader       []byte    // bytes read of the first frame header
+	handshakeLeft     int       // payload bytes of the first frame still to read, -1 if unknown
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	c.readLimit = c.handshakeDeadline
+	if c.readIdle > 0 {
+		c.readLimit = earliest(c.readLimit, time.Now().Add(c.readIdle))
+	}
+	c.Conn.SetReadDeadline(earliest(c.readDeadline, c.readLimit))
+	c.mu.Unlock()
+	n, err := c.Conn.Read(p)
+	if !c.handshakeDeadline.IsZero() {
+		c.noteHandshake(p[:n])
+	}
+	return n, err
+}
+
+// noteHandshake consumes the bytes p read from the client and clears
+// the handshake deadline once the client preface and the first frame
+// have been received.
+func (c *timeoutConn) noteHandshake(p []byte) {
+	if c.prefaceLeft > 0 {
+		n := c.prefaceLeft
+		if n > len(p) {
+			n = len(p)
+		}
+		c.prefaceLeft -= n
+		p = p[n:]
+	}
+	const frameHeaderLen = 9
+	for len(p) > 0 && c.handshakeLeft < 0 {
+		c.frameHeader = append(c.frameHeader, p[0])
+		p = p[1:]
+		if len(c.frameHeader) == frameHeaderLen {
+			h := c.frameHeader
+			c.handshakeLeft = int(h[0])<<16 | int(h[1])<<8 | int(h[2])
+		}
+	}
+	if c.handshakeLeft < 0 {
+		return
+	}
+	c.handshakeLeft -= len(p)
+	if c.handshakeLeft <= 0 {
+		c.handshakeDeadline = time.Time{}
+		c.frameHeader = nil
+	}
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.writeIdle > 0 {
+		c.writeLimit = time.Now().Add(c.writeIdle)
+	}
+	c.Conn.SetWriteDeadline(earliest(c.writeDeadline, c.writeLimit))
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// The deadline setters keep the limits of a Read or Write in progress,
+// so that the http2 server clearing its own deadline does not disarm
+// the timeouts.
+
+func (c *timeoutConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *timeoutConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(earliest(t, c.readLimit))
+}
+
+func (c *timeoutConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(earliest(t, c.writeLimit))
+}
+
+// earliest returns the earlier of the deadlines a and b, where the zero
+// time means no deadline.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package h2c
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// dialPriorKnowledge opens an h2c connection with prior knowledge to
+// the server at url. If handshake is set, it also sends the first
+// SETTINGS frame and acknowledges the settings of the server.
+func dialPriorKnowledge(t *testing.T, url string, handshake bool) (net.Conn, *http2.Framer) {
+	t.Helper()
+	c, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(c, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	fr := http2.NewFramer(c, c)
+	if !handshake {
+		return c, fr
+	}
+	fr.WriteSettings()
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sf, ok := f.(*http2.SettingsFrame); ok && !sf.IsAck() {
+			fr.WriteSettingsAck()
+			return c, fr
+		}
+	}
+}
+
+// waitClosed reads frames from fr until the server closes the
+// connection, and returns the frames read.
+func waitClosed(t *testing.T, fr *http2.Framer) []http2.Frame {
+	t.Helper()
+	var frames []http2.Frame
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("connection not closed by the server")
+			}
+			return frames
+		}
+		frames = append(frames, f)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	h1s := httptest.NewServer(NewHandler(http.NotFoundHandler(), &http2.Server{}, HandshakeTimeout(50*time.Millisecond)))
+	defer h1s.Close()
+
+	_, fr := dialPriorKnowledge(t, h1s.URL, false)
+	start := time.Now()
+	waitClosed(t, fr)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("connection closed after %v; want about 50ms", d)
+	}
+
+	// A connection which completed its handshake is not closed.
+	_, fr = dialPriorKnowledge(t, h1s.URL, true)
+	time.Sleep(100 * time.Millisecond)
+	data := [8]byte{1}
+	fr.WritePing(false, data)
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatalf("after the handshake: %v", err)
+		}
+		if pf, ok := f.(*http2.PingFrame); ok && pf.IsAck() {
+			break
+		}
+	}
+}
+
+func TestReadIdleTimeout(t *testing.T) {
+	inHandler := make(chan struct{})
+	unblock := make(chan struct{})
+	defer close(unblock)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inHandler)
+		<-unblock
+	})
+	h1s := httptest.NewServer(NewHandler(handler, &http2.Server{}, ReadIdleTimeout(100*time.Millisecond)))
+	defer h1s.Close()
+
+	_, fr := dialPriorKnowledge(t, h1s.URL, true)
+	writeGet(fr, 1)
+	<-inHandler
+	for _, f := range waitClosed(t, fr) {
+		if _, ok := f.(*http2.GoAwayFrame); ok {
+			t.Errorf("got GOAWAY frame; want the connection closed without one")
+		}
+	}
+}
+
+func TestWriteIdleTimeout(t *testing.T) {
+	werr := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1<<20)
+		for {
+			if _, err := w.Write(buf); err != nil {
+				werr <- err
+				return
+			}
+		}
+	})
+	h1s := httptest.NewServer(NewHandler(handler, &http2.Server{}, WriteIdleTimeout(100*time.Millisecond)))
+	defer h1s.Close()
+
+	// Open the flow control windows, then stop reading.
+	c, fr := dialPriorKnowledge(t, h1s.URL, false)
+	defer c.Close()
+	fr.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 1<<31 - 1})
+	fr.WriteWindowUpdate(0, 1<<31-1-65535)
+	writeGet(fr, 1)
+	select {
+	case <-werr:
+	case <-time.After(10 * time.Second):
+		t.Fatal("response write did not fail with a client not reading")
+	}
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	})
+	h1s := httptest.NewServer(NewHandler(handler, &http2.Server{}, MaxConnectionAge(50*time.Millisecond, 100*time.Millisecond)))
+	defer h1s.Close()
+
+	_, fr := dialPriorKnowledge(t, h1s.URL, true)
+	writeGet(fr, 1)
+	start := time.Now()
+	var goAway *http2.GoAwayFrame
+	for _, f := range waitClosed(t, fr) {
+		if f, ok := f.(*http2.GoAwayFrame); ok {
+			goAway = f
+		}
+	}
+	if goAway == nil || goAway.ErrCode != http2.ErrCodeNo {
+		t.Fatalf("GOAWAY = %v; want GOAWAY with NO_ERROR", goAway)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("connection closed after %v; want after the grace period", d)
+	}
+}
+
+// writeGet writes the HEADERS of a GET request on stream id.
+func writeGet(fr *http2.Framer, id uint32) {
+	var buf strings.Builder
+	enc := hpack.NewEncoder(&buf)
+	for _, kv := range [][2]string{
+		{":method", "GET"},
+		{":scheme", "http"},
+		{":authority", "example.com"},
+		{":path", "/"},
+	} {
+		enc.WriteField(hpack.HeaderField{Name: kv[0], Value: kv[1]})
+	}
+	fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      id,
+		BlockFragment: []byte(buf.String()),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+}
@@ -0,0 +1,415 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+var (
+	errHandoffBusy      = errors.New("http2: connection is not idle")
+	errHandoffGoAway    = errors.New("http2: connection is shutting down")
+	errHandoffTLS       = errors.New("http2: TLS connections cannot be handed off")
+	errHandoffMidHeader = errors.New("http2: connection read interrupted in a header block")
+	errConnStateInvalid = errors.New("http2: invalid connection state")
+	errConnStateConfig  = errors.New("http2: connection state was exported by a Server with different settings")
+)
+
+// serverConnStateVersion is the version of the ServerConnState
+// encoding produced by MarshalBinary.
+const serverConnStateVersion = 1
+
+// A ServerConnState is the HTTP/2 state of a server connection that
+// was exported by Server.ExportIdleConns: the settings exchanged with
+// the client, the flow control windows, the last stream identifiers,
+// the contents of the HPACK decoding table and any bytes of a frame
+// that were read but not yet processed.
+//
+// A ServerConnState can be encoded with MarshalBinary to be sent to
+// another process along with the connection, and resumed there by
+// Server.ResumeConn.
+type ServerConnState struct {
+	settings        []Setting // advertised by the server
+	peerSettings    []Setting // received from the client
+	unackedSettings uint64
+
+	sendWindow int32 // conn-level outbound flow control
+	recvAvail  int32 // conn-level inbound flow control
+	recvUnsent int32
+
+	maxClientStreamID uint32
+	maxPushPromiseID  uint32
+
+	decoderTableSize uint32
+	decoderTable     []hpack.HeaderField
+
+	partialFrame []byte
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (st *ServerConnState) MarshalBinary() ([]byte, error) {
+	b := []byte{serverConnStateVersion}
+	b = appendStateSettings(b, st.settings)
+	b = appendStateSettings(b, st.peerSettings)
+	b = appendStateUint(b, st.unackedSettings)
+	b = appendStateInt(b, st.sendWindow)
+	b = appendStateInt(b, st.recvAvail)
+	b = appendStateInt(b, st.recvUnsent)
+	b = appendStateUint(b, uint64(st.maxClientStreamID))
+	b = appendStateUint(b, uint64(st.maxPushPromiseID))
+	b = appendStateUint(b, uint64(st.decoderTableSize))
+	b = appendStateUint(b, uint64(len(st.decoderTable)))
+	for _, f := range st.decoderTable {
+		b = appendStateBytes(b, []byte(f.Name))
+		b = appendStateBytes(b, []byte(f.Value))
+	}
+	b = appendStateBytes(b, st.partialFrame)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (st *ServerConnState) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != serverConnStateVersion {
+		return errConnStateInvalid
+	}
+	r := stateReader{b: data[1:]}
+	var s ServerConnState
+	s.settings = r.settings()
+	s.peerSettings = r.settings()
+	s.unackedSettings = r.uint(1<<31 - 1)
+	s.sendWindow = r.int()
+	s.recvAvail = r.int()
+	s.recvUnsent = r.int()
+	s.maxClientStreamID = uint32(r.uint(1<<31 - 1))
+	s.maxPushPromiseID = uint32(r.uint(1<<31 - 1))
+	s.decoderTableSize = uint32(r.uint(1<<32 - 1))
+	// Each entry takes at least 32 bytes of the table.
+	n := r.uint(uint64(s.decoderTableSize / 32))
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		s.decoderTable = append(s.decoderTable, hpack.HeaderField{
+			Name:  string(r.bytes()),
+			Value: string(r.bytes()),
+		})
+	}
+	s.partialFrame = r.bytes()
+	if r.err != nil || len(r.b) > 0 {
+		return errConnStateInvalid
+	}
+	if (s.maxClientStreamID != 0 && s.maxClientStreamID%2 == 0) || s.maxPushPromiseID%2 != 0 {
+		return errConnStateInvalid
+	}
+	*st = s
+	return nil
+}
+
+func appendStateUint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendStateInt(b []byte, v int32) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], int64(v))]...)
+}
+
+func appendStateBytes(b, v []byte) []byte {
+	b = appendStateUint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendStateSettings(b []byte, settings []Setting) []byte {
+	b = appendStateUint(b, uint64(len(settings)))
+	for _, s := range settings {
+		b = appendStateUint(b, uint64(s.ID))
+		b = appendStateUint(b, uint64(s.Val))
+	}
+	return b
+}
+
+// stateReader decodes the fields written by ServerConnState.MarshalBinary.
+// After the first error, all methods return zero values.
+type stateReader struct {
+	b   []byte
+	err error
+}
+
+// uint reads an unsigned varint no larger than max.
+func (r *stateReader) uint(max uint64) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 || v > max {
+		r.err = errConnStateInvalid
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *stateReader) int() int32 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 || v > 1<<31-1 || v < -1<<31 {
+		r.err = errConnStateInvalid
+		return 0
+	}
+	r.b = r.b[n:]
+	return int32(v)
+}
+
+func (r *stateReader) bytes() []byte {
+	n := r.uint(uint64(len(r.b)))
+	if r.err != nil {
+		return nil
+	}
+	v := append([]byte(nil), r.b[:n]...)
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *stateReader) settings() []Setting {
+	n := r.uint(uint64(len(r.b) / 2))
+	var settings []Setting
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		s := Setting{
+			ID:  SettingID(r.uint(1<<16 - 1)),
+			Val: uint32(r.uint(1<<32 - 1)),
+		}
+		if s.Valid() != nil {
+			r.err = errConnStateInvalid
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// An ExportedConn is a connection that a Server stopped serving in
+// ExportIdleConns.
+type ExportedConn struct {
+	// Conn is the connection, as passed to ServeConn. The Server no
+	// longer reads from, writes to or closes it.
+	Conn net.Conn
+
+	// State is the HTTP/2 state of the connection, to be passed to
+	// ResumeConn.
+	State *ServerConnState
+}
+
+// ExportIdleConns stops serving the connections of s that have no
+// open streams and returns them along with their HTTP/2 state, so
+// that they can be handed off to another process, for example by
+// sending their file descriptors over a Unix domain socket, and
+// resumed there with ResumeConn. This lets a server restart without
+// dropping its long-lived client connections.
+//
+// Connections that are busy, or that are shutting down, keep being
+// served; callers typically shut them down gracefully afterwards.
+// TLS connections are never exported, since their encryption state
+// cannot be transferred. Connections served through ConfigureServer
+// are closed by the net/http package once exported, so only
+// connections passed directly to ServeConn can be handed off.
+//
+// ServeConn returns once its connection has been exported. If ctx is
+// done before all connections have been examined, ExportIdleConns
+// returns the connections exported so far along with ctx.Err().
+func (s *Server) ExportIdleConns(ctx context.Context) ([]ExportedConn, error) {
+	conns := s.connTracker()
+	conns.mu.Lock()
+	scs := make([]*serverConn, 0, len(conns.activeConns))
+	for sc := range conns.activeConns {
+		scs = append(scs, sc)
+	}
+	conns.mu.Unlock()
+
+	var exported []ExportedConn
+	for _, sc := range scs {
+		req := &handoffRequest{res: make(chan handoffResult, 1)}
+		select {
+		case sc.serveMsgCh <- req:
+		case <-sc.doneServing:
+			continue
+		case <-ctx.Done():
+			return exported, ctx.Err()
+		}
+		// The serve loop answers promptly, since it interrupts any
+		// pending read; don't abandon a connection it may export.
+		var res handoffResult
+		select {
+		case res = <-req.res:
+		case <-sc.doneServing:
+			select {
+			case res = <-req.res:
+			default:
+				continue
+			}
+		}
+		if res.err != nil {
+			sc.vlogf("http2: not exporting conn from %v: %v", sc.conn.RemoteAddr(), res.err)
+			continue
+		}
+		exported = append(exported, ExportedConn{Conn: sc.conn, State: res.state})
+	}
+	return exported, nil
+}
+
+// ResumeConn serves HTTP/2 requests on a connection exported by
+// ExportIdleConns, possibly in another process, continuing from its
+// state. Like ServeConn, it blocks until the connection is closed or
+// exported again, and opts is optional.
+//
+// The Server must advertise the same settings as the one that
+// exported the connection. If it does not, or if the state cannot be
+// applied, ResumeConn returns an error without serving c, and the
+// caller should close c.
+func (s *Server) ResumeConn(c net.Conn, state *ServerConnState, opts *ServeConnOpts) error {
+	if state == nil {
+		return errConnStateInvalid
+	}
+	return s.serveConn(c, opts, state)
+}
+
+// handoffRequest is sent to the serve loop by ExportIdleConns.
+type handoffRequest struct {
+	res chan handoffResult // buffered
+}
+
+type handoffResult struct {
+	state *ServerConnState
+	err   error
+}
+
+// handoffErr reports why the connection cannot be exported now, if
+// it cannot.
+func (sc *serverConn) handoffErr() error {
+	sc.serveG.check()
+	switch {
+	case sc.tlsState != nil:
+		return errHandoffTLS
+	case sc.inGoAway:
+		return errHandoffGoAway
+	case !sc.sawFirstSettings || len(sc.streams) > 0 || sc.writingFrame || sc.needsFrameFlush || sc.needToSendSettingsAck || sc.queuedControlFrames > 0:
+		return errHandoffBusy
+	}
+	return nil
+}
+
+// handoff stops reading from the connection and reports its state to
+// req, if the connection is idle. It reports whether the serve loop
+// should keep running; sc.handedOff is set if the connection was
+// exported.
+func (sc *serverConn) handoff(req *handoffRequest) bool {
+	sc.serveG.check()
+	if err := sc.handoffErr(); err != nil {
+		req.res <- handoffResult{err: err}
+		return true
+	}
+	// Interrupt the frame reader, which is waiting for the next frame.
+	if err := sc.conn.SetReadDeadline(time.Unix(1, 0)); err != nil {
+		req.res <- handoffResult{err: err}
+		return true
+	}
+	res := <-sc.readFrameCh
+	sc.conn.SetReadDeadline(time.Time{})
+	if ne, ok := res.err.(net.Error); !ok || !ne.Timeout() {
+		// A frame, or an error, arrived before the read was
+		// interrupted. The connection is no longer idle.
+		req.res <- handoffResult{err: errHandoffBusy}
+		if !sc.processFrameFromReader(res) {
+			return false
+		}
+		res.readMore()
+		return true
+	}
+	if sc.framer.lastHeaderStream != 0 {
+		// Part of the header block was already decoded, so the
+		// connection can neither be exported nor served any longer.
+		req.res <- handoffResult{err: errHandoffMidHeader}
+		return false
+	}
+
+	tableSize, table := sc.framer.ReadMetaHeaders.TableState()
+	sc.handedOff = true
+	req.res <- handoffResult{state: &ServerConnState{
+		settings: sc.initialSettings(),
+		peerSettings: []Setting{
+			{SettingHeaderTableSize, sc.peerHeaderTableSize},
+			{SettingEnablePush, boolToUint32(sc.pushEnabled)},
+			{SettingMaxConcurrentStreams, sc.clientMaxStreams},
+			{SettingInitialWindowSize, uint32(sc.initialStreamSendWindowSize)},
+			{SettingMaxFrameSize, uint32(sc.maxFrameSize)},
+			{SettingMaxHeaderListSize, sc.peerMaxHeaderListSize},
+			{SettingNoRFC7540Priorities, sc.peerNoRFC7540Priorities},
+		},
+		unackedSettings:   uint64(sc.unackedSettings),
+		sendWindow:        sc.flow.n,
+		recvAvail:         sc.inflow.avail,
+		recvUnsent:        sc.inflow.unsent,
+		maxClientStreamID: sc.maxClientStreamID,
+		maxPushPromiseID:  sc.maxPushPromiseID,
+		decoderTableSize:  tableSize,
+		decoderTable:      table,
+		partialFrame:      sc.framer.interrupted,
+	}}
+	return false
+}
+
+// resume applies the state of an exported connection to sc, before it
+// starts serving.
+func (sc *serverConn) resume(st *ServerConnState) error {
+	sc.serveG.check()
+	if _, ok := sc.conn.(connectionStater); ok {
+		return errHandoffTLS
+	}
+	settings := sc.initialSettings()
+	if len(st.settings) != len(settings) {
+		return errConnStateConfig
+	}
+	for i, s := range settings {
+		if st.settings[i] != s {
+			return errConnStateConfig
+		}
+	}
+	if err := sc.framer.ReadMetaHeaders.SetTableState(st.decoderTableSize, st.decoderTable); err != nil {
+		return err
+	}
+
+	// Start with an empty encoding table. The size update at the start
+	// of the next header block makes the client empty its table too.
+	sc.hpackEncoder.SetMaxDynamicTableSize(0)
+	for _, s := range st.peerSettings {
+		if err := sc.processSetting(s); err != nil {
+			return err
+		}
+	}
+	sc.sawClientPreface = true
+	sc.sawFirstSettings = true
+	sc.unackedSettings = int(st.unackedSettings)
+	sc.flow.n = st.sendWindow
+	sc.inflow = inflow{avail: st.recvAvail, unsent: st.recvUnsent}
+	sc.maxClientStreamID = st.maxClientStreamID
+	sc.maxPushPromiseID = st.maxPushPromiseID
+	if len(st.partialFrame) > 0 {
+		sc.framer.r = io.MultiReader(bytes.NewReader(st.partialFrame), sc.conn)
+	}
+	return nil
+}
+
+func boolToUint32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,311 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveFirstConn serves the first connection accepted by ln with s, and
+// returns a channel closed when ServeConn returns.
+func serveFirstConn(t *testing.T, ln net.Listener, s *Server, h http.Handler) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		s.ServeConn(c, &ServeConnOpts{Handler: h})
+	}()
+	return done
+}
+
+// exportIdleConn waits for the single connection of s to become idle
+// and exports it.
+func exportIdleConn(t *testing.T, s *Server) ExportedConn {
+	t.Helper()
+	for i := 0; ; i++ {
+		exported, err := s.ExportIdleConns(context.Background())
+		if err != nil {
+			t.Fatalf("ExportIdleConns: %v", err)
+		}
+		if len(exported) == 1 {
+			return exported[0]
+		}
+		if len(exported) > 1 || i == 100 {
+			t.Fatalf("ExportIdleConns returned %d conns; want 1", len(exported))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// transferState round-trips state through its binary encoding, as would
+// be done to hand it to another process.
+func transferState(t *testing.T, state *ServerConnState) *ServerConnState {
+	t.Helper()
+	b, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	got := new(ServerConnState)
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if b2, _ := got.MarshalBinary(); !bytes.Equal(b2, b) {
+		t.Fatalf("UnmarshalBinary = %+v; want %+v", got, state)
+	}
+	return got
+}
+
+func TestServerExportResumeConn(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Server", name)
+			w.Write([]byte(name + " " + r.Header.Get("X-Client")))
+		}
+	}
+	s1 := new(Server)
+	served := serveFirstConn(t, ln, s1, handler("one"))
+
+	var dials int32
+	tr := &Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return net.Dial(network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+	get := func(want string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+		// The headers are indexed in the HPACK tables by the first
+		// request and referenced by the following ones.
+		req.Header.Set("X-Client", "client-header-value")
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(body); got != want+" client-header-value" {
+			t.Errorf("body = %q; want %q", got, want+" client-header-value")
+		}
+		if got := res.Header.Get("X-Server"); got != want {
+			t.Errorf("X-Server = %q; want %q", got, want)
+		}
+	}
+	get("one")
+	get("one")
+
+	exported := exportIdleConn(t, s1)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeConn did not return after exporting its connection")
+	}
+	found := false
+	for _, s := range exported.State.peerSettings {
+		if s.ID == SettingNoRFC7540Priorities {
+			found = s.Val == 0
+		}
+	}
+	if !found {
+		t.Errorf("peer settings %v; want %v=0, left by the client", exported.State.peerSettings, SettingNoRFC7540Priorities)
+	}
+
+	s2 := new(Server)
+	resumed := make(chan error, 1)
+	go func() {
+		resumed <- s2.ResumeConn(exported.Conn, transferState(t, exported.State), &ServeConnOpts{Handler: handler("two")})
+	}()
+	get("two")
+	get("two")
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("client dialed %d times; want 1", n)
+	}
+
+	exported.Conn.Close()
+	if err := <-resumed; err != nil {
+		t.Errorf("ResumeConn: %v", err)
+	}
+}
+
+func TestServerExportIdleConnsBusy(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	inHandler := make(chan struct{})
+	unblock := make(chan struct{})
+	s := new(Server)
+	served := serveFirstConn(t, ln, s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inHandler)
+		<-unblock
+	}))
+
+	tr := &Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+	errc := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+		res, err := tr.RoundTrip(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}()
+	<-inHandler
+
+	exported, err := s.ExportIdleConns(context.Background())
+	if err != nil || len(exported) != 0 {
+		t.Fatalf("ExportIdleConns = %v, %v; want no conns", exported, err)
+	}
+	close(unblock)
+	if err := <-errc; err != nil {
+		t.Fatalf("request failed after ExportIdleConns: %v", err)
+	}
+	select {
+	case <-served:
+		t.Fatal("ServeConn returned for a busy connection")
+	default:
+	}
+}
+
+func TestServerResumeConnPartialFrame(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	s1 := new(Server)
+	serveFirstConn(t, ln, s1, http.NotFoundHandler())
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.Write([]byte(ClientPreface)); err != nil {
+		t.Fatal(err)
+	}
+	fr := NewFramer(c, c)
+	fr.WriteSettings()
+	for gotSettings, gotAck := false, false; !gotSettings || !gotAck; {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sf, ok := f.(*SettingsFrame); ok {
+			if sf.IsAck() {
+				gotAck = true
+			} else {
+				gotSettings = true
+				fr.WriteSettingsAck()
+			}
+		}
+	}
+
+	// Send the first bytes of a PING frame, which the server may
+	// consume before the connection is exported.
+	data := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	var buf bytes.Buffer
+	NewFramer(&buf, nil).WritePing(false, data)
+	ping := buf.Bytes()
+	if _, err := c.Write(ping[:frameHeaderLen+2]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	exported := exportIdleConn(t, s1)
+	go new(Server).ResumeConn(exported.Conn, transferState(t, exported.State), nil)
+	if _, err := c.Write(ping[frameHeaderLen+2:]); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf, ok := f.(*PingFrame); ok {
+			if !pf.IsAck() || pf.Data != data {
+				t.Fatalf("got %v; want PING ack with data %v", summarizeFrame(f), data)
+			}
+			break
+		}
+	}
+}
+
+func TestServerResumeConnSettingsMismatch(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	s1 := new(Server)
+	serveFirstConn(t, ln, s1, http.NotFoundHandler())
+	tr := &Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	exported := exportIdleConn(t, s1)
+	defer exported.Conn.Close()
+	s2 := &Server{MaxConcurrentStreams: 7}
+	if err := s2.ResumeConn(exported.Conn, exported.State, nil); err != errConnStateConfig {
+		t.Errorf("ResumeConn = %v; want %v", err, errConnStateConfig)
+	}
+}
+
+func TestServerConnStateUnmarshalInvalid(t *testing.T) {
+	state := &ServerConnState{
+		settings:          []Setting{{SettingMaxFrameSize, 1 << 20}},
+		peerSettings:      []Setting{{SettingEnablePush, 0}},
+		sendWindow:        -10,
+		recvAvail:         1 << 20,
+		maxClientStreamID: 7,
+		decoderTableSize:  4096,
+	}
+	b, err := state.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(b); i++ {
+		if err := new(ServerConnState).UnmarshalBinary(b[:i]); err == nil {
+			t.Errorf("UnmarshalBinary succeeded on %d of %d bytes", i, len(b))
+		}
+	}
+	if err := new(ServerConnState).UnmarshalBinary(append(b, 0)); err == nil {
+		t.Error("UnmarshalBinary succeeded with trailing data")
+	}
+
+	state.maxClientStreamID = 8
+	b, _ = state.MarshalBinary()
+	if err := new(ServerConnState).UnmarshalBinary(b); err == nil {
+		t.Error("UnmarshalBinary succeeded with an even client stream ID")
+	}
+}
@@ -157,6 +157,42 @@ func (d *Decoder) SetAllowedMaxDynamicTableSize(v uint32) {
 	d.dynTab.allowedMaxSize = v
 }
 
+// TableState returns the current maximum size of the dynamic table
+// and a copy of its entries, oldest first. Together with
+// SetTableState, it lets a connection's decoding context be moved to
+// another Decoder, possibly in another process. It should only be
+// called between header blocks.
+func (d *Decoder) TableState() (maxSize uint32, fields []HeaderField) {
+	fields = make([]HeaderField, len(d.dynTab.table.ents))
+	copy(fields, d.dynTab.table.ents)
+	return d.dynTab.maxSize, fields
+}
+
+// SetTableState replaces the dynamic table with fields, oldest first,
+// and sets its maximum size, as reported by TableState. It returns an
+// error if maxSize exceeds the allowed maximum or if the fields do not
+// fit in maxSize.
+func (d *Decoder) SetTableState(maxSize uint32, fields []HeaderField) error {
+	if maxSize > d.dynTab.allowedMaxSize {
+		return DecodingError{errors.New("dynamic table size update too large")}
+	}
+	var size uint64
+	for _, f := range fields {
+		size += uint64(f.Size())
+	}
+	if size > uint64(maxSize) {
+		return DecodingError{errors.New("dynamic table entries exceed its maximum size")}
+	}
+	d.dynTab = dynamicTable{allowedMaxSize: d.dynTab.allowedMaxSize}
+	d.dynTab.table.init()
+	d.dynTab.setMaxSize(maxSize)
+	for _, f := range fields {
+		f.Sensitive = false
+		d.dynTab.add(f)
+	}
+	return nil
+}
+
 type dynamicTable struct {
 	// https://httpwg.org/specs/rfc7541.html#rfc.section.2.3.2
 	table          headerFieldTable
@@ -817,3 +817,46 @@ func TestDynamicSizeUpdate(t *testing.T) {
 		t.Fatalf("dynamic table size update not at the beginning of a header block")
 	}
 }
+
+func TestDecoderTableState(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.WriteField(HeaderField{Name: "foo", Value: "bar"})
+	enc.WriteField(HeaderField{Name: "custom-key", Value: "custom-value"})
+	d := NewDecoder(4096, nil)
+	if _, err := d.DecodeFull(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize, fields := d.TableState()
+	d2 := NewDecoder(4096, nil)
+	if err := d2.SetTableState(maxSize, fields); err != nil {
+		t.Fatalf("SetTableState: %v", err)
+	}
+	if got, want := d2.dynTab.size, d.dynTab.size; got != want {
+		t.Errorf("table size = %d; want %d", got, want)
+	}
+
+	// The copied table decodes references to existing entries.
+	buf.Reset()
+	enc.WriteField(HeaderField{Name: "foo", Value: "bar"})
+	enc.WriteField(HeaderField{Name: "custom-key", Value: "custom-value"})
+	got, err := d2.DecodeFull(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{
+		{Name: "foo", Value: "bar"},
+		{Name: "custom-key", Value: "custom-value"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v; want %v", got, want)
+	}
+
+	if err := NewDecoder(100, nil).SetTableState(4096, nil); err == nil {
+		t.Error("SetTableState succeeded with a size above the allowed maximum")
+	}
+	if err := NewDecoder(4096, nil).SetTableState(40, fields); err == nil {
+		t.Error("SetTableState succeeded with fields exceeding the maximum size")
+	}
+}
@@ -126,7 +126,7 @@ func (s Setting) String() string {
 func (s Setting) Valid() error {
 	// Limits and error codes from 6.5.2 Defined SETTINGS Parameters
 	switch s.ID {
-	case SettingEnablePush:
+	case SettingEnablePush, SettingEnableConnectProtocol, SettingNoRFC7540Priorities:
 		if s.Val != 1 && s.Val != 0 {
 			return ConnectionError(ErrCodeProtocol)
 		}
@@ -153,6 +153,14 @@ const (
 	SettingInitialWindowSize    SettingID = 0x4
 	SettingMaxFrameSize         SettingID = 0x5
 	SettingMaxHeaderListSize    SettingID = 0x6
+
+	// SettingEnableConnectProtocol enables the extended CONNECT
+	// method of RFC 8441.
+	SettingEnableConnectProtocol SettingID = 0x8
+
+	// SettingNoRFC7540Priorities signals that the sender does not use
+	// the priority signals of RFC 7540, as defined by RFC 9218.
+	SettingNoRFC7540Priorities SettingID = 0x9
 )
 
 var settingName = map[SettingID]string{
@@ -162,6 +170,9 @@ var settingName = map[SettingID]string{
 	SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
 	SettingMaxFrameSize:         "MAX_FRAME_SIZE",
 	SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+
+	SettingEnableConnectProtocol: "ENABLE_CONNECT_PROTOCOL",
+	SettingNoRFC7540Priorities:   "NO_RFC7540_PRIORITIES",
 }
 
 func (s SettingID) String() string {
@@ -271,6 +282,13 @@ func (w *bufferedWriter) Available() int {
 	return w.bw.Available()
 }
 
+func (w *bufferedWriter) Buffered() int {
+	if w.bw == nil {
+		return 0
+	}
+	return w.bw.Buffered()
+}
+
 func (w *bufferedWriter) Write(p []byte) (n int, err error) {
 	if w.bw == nil {
 		bw := bufWriterPool.Get().(*bufio.Writer)
@@ -325,6 +343,8 @@ func (e *httpError) Temporary() bool { return true }
 
 var errTimeout error = &httpError{msg: "http2: timeout awaiting response headers", timeout: true}
 
+var errStreamTimeout error = &httpError{msg: "http2: stream exceeded MaxStreamDuration", timeout: true}
+
 type connectionStater interface {
 	ConnectionState() tls.ConnectionState
 }
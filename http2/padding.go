@@ -0,0 +1,71 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import "crypto/rand"
+
+// A PaddingFunc returns the number of bytes of padding, from 0 to 255,
+// to add to a frame of type t, either FrameData or FrameHeaders, which
+// carries n bytes of data or of header block fragment. Zero means no
+// padding. Padding, permitted by RFC 9113, Section 6.1, hides the size
+// of the messages exchanged from traffic analysis.
+//
+// The padding added may be less than requested, when limited by the
+// maximum frame size or, for DATA frames, by flow control, which
+// counts the padding and its Pad Length field. A PaddingFunc may be
+// called concurrently.
+type PaddingFunc func(t FrameType, n int) int
+
+// PadToMultiple returns a PaddingFunc padding the payloads of the frames,
+// including their Pad Length field, to a multiple of size bytes, which
+// must be between 1 and 255.
+func PadToMultiple(size int) PaddingFunc {
+	return func(t FrameType, n int) int {
+		if n%size == 0 {
+			return 0
+		}
+		return size - (n+1)%size
+	}
+}
+
+// PadRandom returns a PaddingFunc padding the frames with a random number
+// of bytes, from 0 to max, which must be at most 255. The numbers are
+// read from crypto/rand, so that the padding cannot be predicted.
+func PadRandom(max int) PaddingFunc {
+	// Bytes from limit up would make the smaller numbers likelier.
+	limit := 256 - 256%(max+1)
+	return func(t FrameType, n int) int {
+		var b [1]byte
+		for {
+			if _, err := rand.Read(b[:]); err != nil {
+				// Without randomness, the most padding hides the
+				// size best.
+				return max
+			}
+			if int(b[0]) < limit {
+				return int(b[0]) % (max + 1)
+			}
+		}
+	}
+}
+
+// framePadding returns the padding which f requests for a frame of type t
+// carrying n bytes, limited to limit bytes, or 0 for no padding.
+func framePadding(f PaddingFunc, t FrameType, n, limit int) int {
+	if f == nil {
+		return 0
+	}
+	pad := f(t, n)
+	if pad > 255 {
+		pad = 255
+	}
+	if pad > limit {
+		pad = limit
+	}
+	if pad < 0 {
+		return 0
+	}
+	return pad
+}
@@ -42,6 +42,7 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -149,12 +150,115 @@ type Server struct {
 	// The errType consists of only ASCII word characters.
 	CountError func(errType string)
 
+	// EnableConnectProtocol advertises SETTINGS_ENABLE_CONNECT_PROTOCOL
+	// and accepts the extended CONNECT requests of RFC 8441, which
+	// bootstrap other protocols such as WebSockets on a stream.
+	// The protocol requested by such a request is in its ":protocol"
+	// header; the Handler reads from the request body and writes to
+	// the response after a 2xx status to use the stream.
+	EnableConnectProtocol bool
+
+	// DisableRFC7540Priorities advertises SETTINGS_NO_RFC7540_PRIORITIES
+	// (RFC 9218) and ignores the priority signals of RFC 7540: the
+	// stream dependencies and weights of HEADERS and PRIORITY frames
+	// are not passed to the WriteScheduler. The priority signals of a
+	// client which sends SETTINGS_NO_RFC7540_PRIORITIES are ignored
+	// too, whatever the value of DisableRFC7540Priorities.
+	DisableRFC7540Priorities bool
+
+	// StrictValidation makes the server reject, with a 400 status, the
+	// requests whose header fields an HTTP/1 server could interpret
+	// differently, as matters when forwarding them to one: those with
+	// several or invalid Content-Length values, a non-zero Content-Length
+	// without a body, a Host header field not matching :authority, or a
+	// field value with leading or trailing white space.
+	// It also removes the connection-specific header fields of the
+	// responses, including those listed by their Connection header field.
+	StrictValidation bool
+
+	// ValidationErrorHook, if non-nil, is called with each error found by
+	// StrictValidation, for instance to log or count them.
+	ValidationErrorHook func(*ValidationError)
+
+	// FramePadding, if non-nil, selects the padding of the DATA and
+	// HEADERS frames written. See PadToMultiple and PadRandom.
+	FramePadding PaddingFunc
+
+	// OnExtensionFrame, if non-nil, is called with the frames of the
+	// extension types received, which the server otherwise ignores, and
+	// w to send extension frames on the same connection. It is called by
+	// the goroutine serving the connection and must not block; neither w
+	// nor the payload of f may be used once it returns.
+	OnExtensionFrame func(w ExtensionFrameWriter, f *UnknownFrame)
+
+	// WriteCoalesceDelay, if positive, delays by up to this duration the
+	// flush of the DATA and HEADERS frames written, including those sent
+	// by the Flush method of a ResponseWriter, so that those of chatty
+	// responses written in the meantime are coalesced into fewer TCP
+	// segments, as Nagle's algorithm does. The frames are flushed without
+	// delay once WriteCoalesceBytes are buffered, if positive, or the
+	// write buffer is full, when another frame type is written, and when
+	// a Handler calls FlushConn. See ConnFlusher.
+	WriteCoalesceDelay time.Duration
+	WriteCoalesceBytes int
+
+	// RequireClientCert, if non-nil, reports whether the resource of a
+	// request requires a client certificate, for the requests made on
+	// connections without one. As HTTP/2 forbids TLS renegotiation, the
+	// Handler is then called with a request for which ClientCertError
+	// reports a *ClientCertRequiredError, unless ClientCertHTTP11Fallback
+	// is set, in which case the stream is reset with HTTP_1_1_REQUIRED
+	// for the client to retry over HTTP/1.1, as RFC 8740 recommends.
+	RequireClientCert        func(r *http.Request) bool
+	ClientCertHTTP11Fallback bool
+
+	// MaxConnBufferedBytes, if positive, limits the memory buffered by
+	// each connection: the header fields of its open streams, the bytes
+	// of the request bodies not yet read by their Handlers, and the
+	// frames queued for writing. When a connection exceeds it, the
+	// streams buffering the most are reset with ENHANCE_YOUR_CALM until
+	// it is back within the limit, or the connection is closed with a
+	// GOAWAY if resetting its streams is not enough, such as when its
+	// control frames are not read by the client.
+	MaxConnBufferedBytes int64
+
+	// MemoryBudgetHook, if non-nil, is called each time a connection
+	// exceeds MaxConnBufferedBytes, for instance to count them.
+	MemoryBudgetHook func(MemoryBudgetEvent)
+
+	// ResponseEncoders, if non-empty, makes the server compress the
+	// response bodies written by the Handlers with the content-coding of
+	// one of them, such as GzipEncoder(gzip.DefaultCompression): the one
+	// the Accept-Encoding header field of the request prefers, the first
+	// on ties. Unlike a Handler compressing its own responses, the server
+	// frames the compressed bytes as they are produced, counting them
+	// against flow control, and the Flush method of the ResponseWriter
+	// flushes the compressor.
+	//
+	// The responses which already have a Content-Encoding, those with a
+	// Content-Range or a Cache-Control no-transform directive, those
+	// whose Content-Type is not a textual one, and those known to be of
+	// fewer than 1024 bytes are sent as written. The compressed responses
+	// are sent without a Content-Length, and with their strong ETag made
+	// weak. "Accept-Encoding" is added to the Vary header field of the
+	// responses which could be compressed.
+	ResponseEncoders []ResponseEncoder
+
 	// Internal state. This is a pointer (rather than embedded directly)
 	// so that we don't embed a Mutex in this struct, which will make the
 	// struct non-copyable, which might break some callers.
 	state *serverInternalState
 }
 
+func (s *Server) reportValidationError(err *ValidationError) {
+	if s.CountError != nil {
+		s.CountError("strict_validation")
+	}
+	if s.ValidationErrorHook != nil {
+		s.ValidationErrorHook(err)
+	}
+}
+
 func (s *Server) initialConnRecvWindowSize() int32 {
 	if s.MaxUploadBufferPerConnection >= initialWindowSize {
 		return s.MaxUploadBufferPerConnection
@@ -211,19 +315,28 @@ type serverInternalState struct {
 	activeConns map[*serverConn]struct{}
 }
 
-func (s *serverInternalState) registerConn(sc *serverConn) {
-	if s == nil {
-		return // if the Server was used without calling ConfigureServer
+// serverStateMu guards the lazy initialization of Server.state by
+// connTracker.
+var serverStateMu sync.Mutex
+
+// connTracker returns the state used to track the connections of s,
+// creating it if the Server was used without calling ConfigureServer.
+func (s *Server) connTracker() *serverInternalState {
+	serverStateMu.Lock()
+	defer serverStateMu.Unlock()
+	if s.state == nil {
+		s.state = &serverInternalState{activeConns: make(map[*serverConn]struct{})}
 	}
+	return s.state
+}
+
+func (s *serverInternalState) registerConn(sc *serverConn) {
 	s.mu.Lock()
 	s.activeConns[sc] = struct{}{}
 	s.mu.Unlock()
 }
 
 func (s *serverInternalState) unregisterConn(sc *serverConn) {
-	if s == nil {
-		return // if the Server was used without calling ConfigureServer
-	}
 	s.mu.Lock()
 	delete(s.activeConns, sc)
 	s.mu.Unlock()
@@ -264,23 +377,11 @@ func ConfigureServer(s *http.Server, conf *Server) error {
 
 	if s.TLSConfig == nil {
 		s.TLSConfig = new(tls.Config)
-	} else if s.TLSConfig.CipherSuites != nil && s.TLSConfig.MinVersion < tls.VersionTLS13 {
+	} else if err := validateCipherSuites(s.TLSConfig); err != nil {
 		// If they already provided a TLS 1.0–1.2 CipherSuite list, return an
 		// error if it is missing ECDHE_RSA_WITH_AES_128_GCM_SHA256 or
 		// ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
-		haveRequired := false
-		for _, cs := range s.TLSConfig.CipherSuites {
-			switch cs {
-			case tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				// Alternative MTI cipher to not discourage ECDSA-only servers.
-				// See http://golang.org/cl/30721 for further information.
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:
-				haveRequired = true
-			}
-		}
-		if !haveRequired {
-			return fmt.Errorf("http2: TLSConfig.CipherSuites is missing an HTTP/2-required AES_128_GCM_SHA256 cipher (need at least one of TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)")
-		}
+		return err
 	}
 
 	// Note: not setting MinVersion to tls.VersionTLS12,
@@ -356,6 +457,17 @@ type ServeConnOpts struct {
 	// SawClientPreface is set if the HTTP/2 connection preface
 	// has already been read from the connection.
 	SawClientPreface bool
+
+	// MaxConnectionAge, if non-zero, is the duration after which
+	// the connection is gracefully shut down with a GOAWAY frame,
+	// as by Server.Shutdown. Requests already in flight are allowed
+	// to complete.
+	MaxConnectionAge time.Duration
+
+	// MaxConnectionAgeGrace, if non-zero, limits how long requests
+	// in flight may take to complete once MaxConnectionAge is
+	// reached. The connection is closed when it elapses.
+	MaxConnectionAgeGrace time.Duration
 }
 
 func (o *ServeConnOpts) context() context.Context {
@@ -399,6 +511,15 @@ func (o *ServeConnOpts) handler() http.Handler {
 //
 // The opts parameter is optional. If nil, default values are used.
 func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
+	s.serveConn(c, opts, nil)
+}
+
+// serveConn serves c, resuming the connection from state if it is
+// non-nil. It returns an error only if state cannot be applied.
+func (s *Server) serveConn(c net.Conn, opts *ServeConnOpts, state *ServerConnState) error {
+	if opts == nil {
+		opts = new(ServeConnOpts)
+	}
 	baseCtx, cancel := serverConnBaseContext(c, opts)
 	defer cancel()
 
@@ -421,13 +542,19 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 		advMaxStreams:               s.maxConcurrentStreams(),
 		initialStreamSendWindowSize: initialWindowSize,
 		maxFrameSize:                initialMaxFrameSize,
+		peerHeaderTableSize:         initialHeaderTableSize,
 		serveG:                      newGoroutineLock(),
 		pushEnabled:                 true,
+		noRFC7540Priorities:         s.DisableRFC7540Priorities,
+		peerNoRFC7540Priorities:     math.MaxUint32,
 		sawClientPreface:            opts.SawClientPreface,
+		maxConnAge:                  opts.MaxConnectionAge,
+		maxConnAgeGrace:             opts.MaxConnectionAgeGrace,
 	}
 
-	s.state.registerConn(sc)
-	defer s.state.unregisterConn(sc)
+	conns := s.connTracker()
+	conns.registerConn(sc)
+	defer conns.unregisterConn(sc)
 
 	// The net/http package sets the write deadline from the
 	// http.Server.WriteTimeout during the TLS handshake, but then
@@ -461,6 +588,12 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 	fr.SetMaxReadFrameSize(s.maxReadFrameSize())
 	sc.framer = fr
 
+	if state != nil {
+		if err := sc.resume(state); err != nil {
+			return err
+		}
+	}
+
 	if tc, ok := c.(connectionStater); ok {
 		sc.tlsState = new(tls.ConnectionState)
 		*sc.tlsState = tc.ConnectionState()
@@ -476,7 +609,7 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 		// 5.4.1) of type INADEQUATE_SECURITY.
 		if sc.tlsState.Version < tls.VersionTLS12 {
 			sc.rejectConn(ErrCodeInadequateSecurity, "TLS version too low")
-			return
+			return nil
 		}
 
 		if sc.tlsState.ServerName == "" {
@@ -503,7 +636,7 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 			// "AllowInsecureWeakCiphers" option on the server later.
 			// Let's see how it plays out first.
 			sc.rejectConn(ErrCodeInadequateSecurity, fmt.Sprintf("Prohibited TLS 1.2 Cipher Suite: %x", sc.tlsState.CipherSuite))
-			return
+			return nil
 		}
 	}
 
@@ -514,7 +647,7 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 		}
 		if err := fr.ForeachSetting(sc.processSetting); err != nil {
 			sc.rejectConn(ErrCodeProtocol, "invalid settings")
-			return
+			return nil
 		}
 		opts.Settings = nil
 	}
@@ -529,6 +662,7 @@ func (s *Server) ServeConn(c net.Conn, opts *ServeConnOpts) {
 	}
 
 	sc.serve()
+	return nil
 }
 
 func serverConnBaseContext(c net.Conn, opts *ServeConnOpts) (ctx context.Context, cancel func()) {
@@ -572,8 +706,10 @@ type serverConn struct {
 	// Everything following is owned by the serve loop; use serveG.check():
 	serveG                      goroutineLock // used to verify funcs are on serve()
 	pushEnabled                 bool
-	sawClientPreface            bool // preface has already been read, used in h2c upgrade
-	sawFirstSettings            bool // got the initial SETTINGS frame after the preface
+	noRFC7540Priorities         bool   // ignore RFC 7540 priority signals
+	peerNoRFC7540Priorities     uint32 // SETTINGS_NO_RFC7540_PRIORITIES from client, or math.MaxUint32 before its first SETTINGS
+	sawClientPreface            bool   // preface has already been read, used in h2c upgrade
+	sawFirstSettings            bool   // got the initial SETTINGS frame after the preface
 	needToSendSettingsAck       bool
 	unackedSettings             int    // how many SETTINGS have we sent without ACKs?
 	queuedControlFrames         int    // control frames in the writeSched queue
@@ -587,17 +723,24 @@ type serverConn struct {
 	initialStreamSendWindowSize int32
 	maxFrameSize                int32
 	peerMaxHeaderListSize       uint32            // zero means unknown (default)
+	peerHeaderTableSize         uint32            // SETTINGS_HEADER_TABLE_SIZE from client
 	canonHeader                 map[string]string // http2-lower-case -> Go-Canonical-Case
 	canonHeaderKeysSize         int               // canonHeader keys size in bytes
 	writingFrame                bool              // started writing a frame (on serve goroutine or separate)
 	writingFrameAsync           bool              // started a frame on its own goroutine but haven't heard back on wroteFrameCh
 	needsFrameFlush             bool              // last frame write wasn't a flush
+	flushNow                    bool              // don't delay the next flush; see Server.WriteCoalesceDelay
+	flushTimer                  *time.Timer       // nil if no flush is delayed
 	inGoAway                    bool              // we've started to or sent GOAWAY
 	inFrameScheduleLoop         bool              // whether we're in the scheduleFrameWrite loop
 	needToSendGoAway            bool              // we need to schedule a GOAWAY frame write
+	handedOff                   bool              // conn was exported by ExportIdleConns; don't close it
 	goAwayCode                  ErrCode
 	shutdownTimer               *time.Timer // nil until used
 	idleTimer                   *time.Timer // nil if unused
+	maxConnAge                  time.Duration
+	maxConnAgeGrace             time.Duration
+	maxAgeTimer                 *time.Timer // nil if unused; then the grace timer once fired
 
 	// Owned by the writeFrameAsync goroutine:
 	headerWriteBuf bytes.Buffer
@@ -607,6 +750,25 @@ type serverConn struct {
 	shutdownOnce sync.Once
 }
 
+// initialSettings returns the settings the server advertises when the
+// connection starts.
+func (sc *serverConn) initialSettings() writeSettings {
+	settings := writeSettings{
+		{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
+		{SettingMaxConcurrentStreams, sc.advMaxStreams},
+		{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
+		{SettingHeaderTableSize, sc.srv.maxDecoderHeaderTableSize()},
+		{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
+	}
+	if sc.srv.EnableConnectProtocol {
+		settings = append(settings, Setting{SettingEnableConnectProtocol, 1})
+	}
+	if sc.srv.DisableRFC7540Priorities {
+		settings = append(settings, Setting{SettingNoRFC7540Priorities, 1})
+	}
+	return settings
+}
+
 func (sc *serverConn) maxHeaderListSize() uint32 {
 	n := sc.hs.MaxHeaderBytes
 	if n <= 0 {
@@ -639,9 +801,12 @@ type stream struct {
 	cw        closeWaiter // closed wait stream transitions to closed state
 	ctx       context.Context
 	cancelCtx func()
+	stats     *StreamStats // updated atomically; read via StreamStatsFromContext
 
 	// owned by serverConn's serve loop:
 	bodyBytes        int64   // body bytes seen so far
+	headerBytes      int64   // size of the header fields received
+	queuedBytes      int64   // DATA bytes in the writeSched queue
 	declBodyBytes    int64   // or -1 if undeclared
 	flow             outflow // limits writing from Handler to client
 	inflow           inflow  // what the client is allowed to POST/etc to us
@@ -885,30 +1050,33 @@ func (sc *serverConn) notePanic() {
 func (sc *serverConn) serve() {
 	sc.serveG.check()
 	defer sc.notePanic()
-	defer sc.conn.Close()
+	defer func() {
+		if !sc.handedOff {
+			sc.conn.Close()
+		}
+	}()
 	defer sc.closeAllStreamsOnConnClose()
 	defer sc.stopShutdownTimer()
+	defer sc.stopFlushTimer()
 	defer close(sc.doneServing) // unblocks handlers trying to send
 
 	if VerboseLogs {
 		sc.vlogf("http2: server connection from %v on %p", sc.conn.RemoteAddr(), sc.hs)
 	}
 
-	sc.writeFrame(FrameWriteRequest{
-		write: writeSettings{
-			{SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
-			{SettingMaxConcurrentStreams, sc.advMaxStreams},
-			{SettingMaxHeaderListSize, sc.maxHeaderListSize()},
-			{SettingHeaderTableSize, sc.srv.maxDecoderHeaderTableSize()},
-			{SettingInitialWindowSize, uint32(sc.srv.initialStreamRecvWindowSize())},
-		},
-	})
-	sc.unackedSettings++
+	// A resumed connection has already exchanged its settings and
+	// preface with the exporting Server.
+	if !sc.sawFirstSettings {
+		sc.writeFrame(FrameWriteRequest{
+			write: sc.initialSettings(),
+		})
+		sc.unackedSettings++
 
-	// Each connection starts with initialWindowSize inflow tokens.
-	// If a higher value is configured, we add more tokens.
-	if diff := sc.srv.initialConnRecvWindowSize() - initialWindowSize; diff > 0 {
-		sc.sendWindowUpdate(nil, int(diff))
+		// Each connection starts with initialWindowSize inflow tokens.
+		// If a higher value is configured, we add more tokens.
+		if diff := sc.srv.initialConnRecvWindowSize() - initialWindowSize; diff > 0 {
+			sc.sendWindowUpdate(nil, int(diff))
+		}
 	}
 
 	if err := sc.readPreface(); err != nil {
@@ -927,10 +1095,18 @@ func (sc *serverConn) serve() {
 		defer sc.idleTimer.Stop()
 	}
 
+	if sc.maxConnAge != 0 {
+		sc.maxAgeTimer = time.AfterFunc(sc.maxConnAge, sc.onMaxAgeTimer)
+		defer func() { sc.maxAgeTimer.Stop() }()
+	}
+
 	go sc.readFrames() // closed by defer sc.conn.Close above
 
-	settingsTimer := time.AfterFunc(firstSettingsTimeout, sc.onSettingsTimer)
-	defer settingsTimer.Stop()
+	var settingsTimer *time.Timer
+	if !sc.sawFirstSettings {
+		settingsTimer = time.AfterFunc(firstSettingsTimeout, sc.onSettingsTimer)
+		defer settingsTimer.Stop()
+	}
 
 	loopNum := 0
 	for {
@@ -976,16 +1152,28 @@ func (sc *serverConn) serve() {
 				case idleTimerMsg:
 					sc.vlogf("connection is idle")
 					sc.goAway(ErrCodeNo)
+				case maxAgeTimerMsg:
+					sc.vlogf("connection reached its maximum age")
+					sc.startGracefulShutdownInternal()
+					if sc.maxConnAgeGrace != 0 {
+						sc.maxAgeTimer = time.AfterFunc(sc.maxConnAgeGrace, sc.onShutdownTimer)
+					}
 				case shutdownTimerMsg:
 					sc.vlogf("GOAWAY close timer fired; closing conn from %v", sc.conn.RemoteAddr())
 					return
 				case gracefulShutdownMsg:
 					sc.startGracefulShutdownInternal()
+				case flushTimerMsg:
+					sc.flushSoon()
 				default:
 					panic("unknown timer")
 				}
 			case *startPushRequest:
 				sc.startPush(v)
+			case *handoffRequest:
+				if !sc.handoff(v) {
+					return
+				}
 			case func(*serverConn):
 				v(sc)
 			default:
@@ -1026,13 +1214,17 @@ type serverMessage int
 var (
 	settingsTimerMsg    = new(serverMessage)
 	idleTimerMsg        = new(serverMessage)
+	maxAgeTimerMsg      = new(serverMessage)
 	shutdownTimerMsg    = new(serverMessage)
 	gracefulShutdownMsg = new(serverMessage)
+	flushTimerMsg       = new(serverMessage)
 )
 
 func (sc *serverConn) onSettingsTimer() { sc.sendServeMsg(settingsTimerMsg) }
 func (sc *serverConn) onIdleTimer()     { sc.sendServeMsg(idleTimerMsg) }
+func (sc *serverConn) onMaxAgeTimer()   { sc.sendServeMsg(maxAgeTimerMsg) }
 func (sc *serverConn) onShutdownTimer() { sc.sendServeMsg(shutdownTimerMsg) }
+func (sc *serverConn) onFlushTimer()    { sc.sendServeMsg(flushTimerMsg) }
 
 func (sc *serverConn) sendServeMsg(msg interface{}) {
 	sc.serveG.checkNotOn() // NOT
@@ -1091,7 +1283,7 @@ var writeDataPool = sync.Pool{
 func (sc *serverConn) writeDataFromHandler(stream *stream, data []byte, endStream bool) error {
 	ch := errChanPool.Get().(chan error)
 	writeArg := writeDataPool.Get().(*writeData)
-	*writeArg = writeData{stream.id, data, endStream}
+	*writeArg = writeData{stream.id, data, endStream, nil}
 	err := sc.writeFrameFromHandler(FrameWriteRequest{
 		write:  writeArg,
 		stream: stream,
@@ -1202,6 +1394,9 @@ func (sc *serverConn) writeFrame(wr FrameWriteRequest) {
 		}
 	}
 
+	// The size is read before the write is scheduled: once it is, the
+	// writeData of wr may be written and reused by writeDataFromHandler.
+	n := wr.DataSize()
 	if !ignoreWrite {
 		if wr.isControl() {
 			sc.queuedControlFrames++
@@ -1211,9 +1406,15 @@ func (sc *serverConn) writeFrame(wr FrameWriteRequest) {
 				sc.conn.Close()
 			}
 		}
+		if wr.stream != nil {
+			wr.stream.queuedBytes += int64(n)
+		}
 		sc.writeSched.Push(wr)
 	}
 	sc.scheduleFrameWrite()
+	if !ignoreWrite && n > 0 {
+		sc.checkMemoryBudget()
+	}
 }
 
 // startFrameWrite starts a goroutine to write wr (in a separate
@@ -1252,6 +1453,11 @@ func (sc *serverConn) startFrameWrite(wr FrameWriteRequest) {
 
 	sc.writingFrame = true
 	sc.needsFrameFlush = true
+	switch wr.write.(type) {
+	case *writeData, *writeResHeaders:
+	default:
+		sc.flushNow = true
+	}
 	if wr.write.staysWithinBuffer(sc.bw.Available()) {
 		sc.writingFrameAsync = false
 		err := wr.write.writeFrame(sc)
@@ -1285,6 +1491,9 @@ func (sc *serverConn) wroteFrame(res frameWriteResult) {
 	sc.writingFrameAsync = false
 
 	wr := res.wr
+	if res.err == nil && wr.stream != nil {
+		sc.noteFrameWritten(wr)
+	}
 
 	if writeEndsStream(wr.write) {
 		st := wr.stream
@@ -1367,13 +1576,20 @@ func (sc *serverConn) scheduleFrameWrite() {
 				if wr.isControl() {
 					sc.queuedControlFrames--
 				}
+				if wr.stream != nil {
+					wr.stream.queuedBytes -= int64(wr.DataSize())
+				}
 				sc.startFrameWrite(wr)
 				continue
 			}
 		}
 		if sc.needsFrameFlush {
+			if sc.delayFlush() {
+				break
+			}
 			sc.startFrameWrite(FrameWriteRequest{write: flushFrameWriter{}})
 			sc.needsFrameFlush = false // after startFrameWrite, since it sets this true
+			sc.flushNow = false
 			continue
 		}
 		break
@@ -1381,6 +1597,39 @@ func (sc *serverConn) scheduleFrameWrite() {
 	sc.inFrameScheduleLoop = false
 }
 
+// delayFlush reports whether to delay the flush of the frames written,
+// as Server.WriteCoalesceDelay configures, in which case it makes sure a
+// timer ends the delay.
+func (sc *serverConn) delayFlush() bool {
+	sc.serveG.check()
+	d := sc.srv.WriteCoalesceDelay
+	if n := sc.srv.WriteCoalesceBytes; d <= 0 || sc.flushNow || n > 0 && sc.bw.Buffered() >= n {
+		sc.stopFlushTimer()
+		return false
+	}
+	if sc.flushTimer == nil {
+		sc.flushTimer = time.AfterFunc(d, sc.onFlushTimer)
+	}
+	return true
+}
+
+func (sc *serverConn) stopFlushTimer() {
+	sc.serveG.check()
+	if sc.flushTimer != nil {
+		sc.flushTimer.Stop()
+		sc.flushTimer = nil
+	}
+}
+
+// flushSoon ends the delay of the flush of the frames written, if any,
+// or makes the next flush immediate.
+func (sc *serverConn) flushSoon() {
+	sc.serveG.check()
+	sc.flushTimer = nil
+	sc.flushNow = true
+	sc.scheduleFrameWrite()
+}
+
 // startGracefulShutdown gracefully shuts down a connection. This
 // sends GOAWAY with ErrCodeNo to tell the client we're gracefully
 // shutting down. The connection isn't closed until all current
@@ -1442,6 +1691,122 @@ func (sc *serverConn) resetStream(se StreamError) {
 	}
 }
 
+// A MemoryBudgetEvent describes a connection exceeding the
+// MaxConnBufferedBytes of its Server.
+type MemoryBudgetEvent struct {
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+
+	// Buffered is the number of bytes buffered by the connection, and
+	// Budget its limit.
+	Buffered, Budget int64
+
+	// StreamsReset is the number of streams reset to release their
+	// buffers.
+	StreamsReset int
+
+	// ConnClosed reports whether the connection is closed, resetting
+	// its streams not being enough.
+	ConnClosed bool
+}
+
+// queuedControlFrameBytes is the memory accounted for each control frame
+// queued, which is an estimate: those which the server queues have a
+// payload of at most a few dozen bytes.
+const queuedControlFrameBytes = 64
+
+// headerFieldsSize returns the size of fields, as that of the
+// SETTINGS_MAX_HEADER_LIST_SIZE setting.
+func headerFieldsSize(fields []hpack.HeaderField) int64 {
+	var n int64
+	for _, hf := range fields {
+		n += int64(hf.Size())
+	}
+	return n
+}
+
+// bufferedBytes returns the memory buffered for st. The streams whose
+// reset is queued are releasing it, and are not accounted.
+func (st *stream) bufferedBytes() int64 {
+	if st.resetQueued {
+		return 0
+	}
+	n := st.headerBytes + st.queuedBytes
+	if st.body != nil {
+		n += int64(st.body.Len())
+	}
+	return n
+}
+
+// bufferedBytes returns the memory buffered for the connection.
+func (sc *serverConn) bufferedBytes() int64 {
+	n := int64(sc.queuedControlFrames) * queuedControlFrameBytes
+	for _, st := range sc.streams {
+		n += st.bufferedBytes()
+	}
+	return n
+}
+
+// checkMemoryBudget enforces the MaxConnBufferedBytes of the server,
+// resetting the streams buffering the most, or closing the connection,
+// when the connection exceeds it.
+func (sc *serverConn) checkMemoryBudget() {
+	sc.serveG.check()
+	budget := sc.srv.MaxConnBufferedBytes
+	if budget <= 0 || sc.inGoAway && sc.goAwayCode != ErrCodeNo {
+		return
+	}
+	buffered := sc.bufferedBytes()
+	if buffered <= budget {
+		return
+	}
+	ev := MemoryBudgetEvent{
+		RemoteAddr: sc.remoteAddrStr,
+		Buffered:   buffered,
+		Budget:     budget,
+	}
+	type streamBytes struct {
+		st *stream
+		n  int64
+	}
+	var streams []streamBytes
+	for _, st := range sc.streams {
+		if n := st.bufferedBytes(); n > 0 {
+			streams = append(streams, streamBytes{st, n})
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].n > streams[j].n
+	})
+	for _, sb := range streams {
+		if buffered <= budget {
+			break
+		}
+		st := sb.st
+		buffered -= sb.n
+		se := streamError(st.id, ErrCodeEnhanceYourCalm)
+		sc.countError("memory_budget", se)
+		sc.resetStream(se)
+		if p := st.body; p != nil {
+			// Drop the unread bytes rather than waiting for the
+			// Handler. closeStream returns their conn-level flow
+			// control once the RST_STREAM is written.
+			p.BreakWithError(errMemoryBudget)
+		}
+		ev.StreamsReset++
+	}
+	if buffered > budget {
+		sc.countError("memory_budget", ConnectionError(ErrCodeEnhanceYourCalm))
+		sc.goAway(ErrCodeEnhanceYourCalm)
+		ev.ConnClosed = true
+	}
+	if sc.srv.MemoryBudgetHook != nil {
+		sc.srv.MemoryBudgetHook(ev)
+	}
+}
+
+var errMemoryBudget = errors.New("http2: stream reset as its connection exceeds MaxConnBufferedBytes")
+
 // processFrameFromReader processes the serve loop's read from readFrameCh from the
 // frame-reading goroutine.
 // processFrameFromReader returns whether the connection should be kept open.
@@ -1523,6 +1888,12 @@ func (sc *serverConn) processFrame(f Frame) error {
 		return nil
 	}
 
+	if id := f.Header().StreamID; id != 0 {
+		if st := sc.streams[id]; st != nil {
+			st.noteFrameRead(f)
+		}
+	}
+
 	switch f := f.(type) {
 	case *SettingsFrame:
 		return sc.processSettings(f)
@@ -1544,6 +1915,13 @@ func (sc *serverConn) processFrame(f Frame) error {
 		// A client cannot push. Thus, servers MUST treat the receipt of a PUSH_PROMISE
 		// frame as a connection error (Section 5.4.1) of type PROTOCOL_ERROR.
 		return sc.countError("push_promise", ConnectionError(ErrCodeProtocol))
+	case *UnknownFrame:
+		if sc.srv.OnExtensionFrame != nil {
+			sc.srv.OnExtensionFrame(serverExtensionFrameWriter{sc}, f)
+			return nil
+		}
+		sc.vlogf("http2: server ignoring frame: %v", f.Header())
+		return nil
 	default:
 		sc.vlogf("http2: server ignoring frame: %v", f.Header())
 		return nil
@@ -1687,6 +2065,10 @@ func (sc *serverConn) processSettings(f *SettingsFrame) error {
 	if err := f.ForeachSetting(sc.processSetting); err != nil {
 		return err
 	}
+	if sc.peerNoRFC7540Priorities == math.MaxUint32 {
+		// The first SETTINGS frame left it at its default.
+		sc.peerNoRFC7540Priorities = 0
+	}
 	// TODO: judging by RFC 7540, Section 6.5.3 each SETTINGS frame should be
 	// acknowledged individually, even if multiple are received before the ACK.
 	sc.needToSendSettingsAck = true
@@ -1704,6 +2086,7 @@ func (sc *serverConn) processSetting(s Setting) error {
 	}
 	switch s.ID {
 	case SettingHeaderTableSize:
+		sc.peerHeaderTableSize = s.Val
 		sc.hpackEncoder.SetMaxDynamicTableSize(s.Val)
 	case SettingEnablePush:
 		sc.pushEnabled = s.Val != 0
@@ -1715,6 +2098,18 @@ func (sc *serverConn) processSetting(s Setting) error {
 		sc.maxFrameSize = int32(s.Val) // the maximum valid s.Val is < 2^31
 	case SettingMaxHeaderListSize:
 		sc.peerMaxHeaderListSize = s.Val
+	case SettingNoRFC7540Priorities:
+		// RFC 9218, Section 2.1: "Senders MUST NOT change the
+		// SETTINGS_NO_RFC7540_PRIORITIES value after the first
+		// SETTINGS frame. Receivers that detect a change MAY treat
+		// it as a connection error of type PROTOCOL_ERROR."
+		if sc.peerNoRFC7540Priorities != math.MaxUint32 && s.Val != sc.peerNoRFC7540Priorities {
+			return sc.countError("settings_no_rfc7540_priorities", ConnectionError(ErrCodeProtocol))
+		}
+		sc.peerNoRFC7540Priorities = s.Val
+		if s.Val == 1 {
+			sc.noRFC7540Priorities = true
+		}
 	default:
 		// Unknown setting: "An endpoint that receives a SETTINGS
 		// frame with any unknown or unsupported identifier MUST
@@ -1834,6 +2229,7 @@ func (sc *serverConn) processData(f *DataFrame) error {
 			if wrote != len(data) {
 				panic("internal error: bad Writer")
 			}
+			sc.checkMemoryBudget()
 		}
 
 		// Return any padded flow control now, since we won't
@@ -1984,8 +2380,10 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 		initialState = stateHalfClosedRemote
 	}
 	st := sc.newStream(id, 0, initialState)
+	st.noteFrameRead(f)
+	st.headerBytes = headerFieldsSize(f.Fields)
 
-	if f.HasPriority() {
+	if f.HasPriority() && !sc.noRFC7540Priorities {
 		if err := sc.checkPriority(f.StreamID, f.Priority); err != nil {
 			return err
 		}
@@ -2003,12 +2401,22 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 	st.body = req.Body.(*requestBody).pipe // may be nil
 	st.declBodyBytes = req.ContentLength
 
+	req, err = sc.checkClientCert(st, rw, req)
+	if err != nil {
+		return err
+	}
+
 	handler := sc.handler.ServeHTTP
 	if f.Truncated {
 		// Their header list was too long. Send a 431 error.
 		handler = handleHeaderListTooLong
 	} else if err := checkValidHTTP2RequestHeaders(req.Header); err != nil {
 		handler = new400Handler(err)
+	} else if sc.srv.StrictValidation {
+		if err := strictCheckRequest(id, req, f.StreamEnded()); err != nil {
+			sc.srv.reportValidationError(err)
+			handler = new400Handler(err)
+		}
 	}
 
 	// The net/http package sets the read deadline from the
@@ -2025,6 +2433,7 @@ func (sc *serverConn) processHeaders(f *MetaHeadersFrame) error {
 		}
 	}
 
+	sc.checkMemoryBudget()
 	go sc.runHandler(rw, req, handler)
 	return nil
 }
@@ -2056,6 +2465,7 @@ func (st *stream) processTrailerHeaders(f *MetaHeadersFrame) error {
 		return sc.countError("dup_trailers", ConnectionError(ErrCodeProtocol))
 	}
 	st.gotTrailerHeader = true
+	st.headerBytes += headerFieldsSize(f.Fields)
 	if !f.StreamEnded() {
 		return sc.countError("trailers_not_ended", streamError(st.id, ErrCodeProtocol))
 	}
@@ -2091,6 +2501,10 @@ func (sc *serverConn) checkPriority(streamID uint32, p PriorityParam) error {
 }
 
 func (sc *serverConn) processPriority(f *PriorityFrame) error {
+	if sc.noRFC7540Priorities {
+		// The Framer has checked the frame; its signal is ignored.
+		return nil
+	}
 	if err := sc.checkPriority(f.StreamID, f.PriorityParam); err != nil {
 		return err
 	}
@@ -2104,13 +2518,15 @@ func (sc *serverConn) newStream(id, pusherID uint32, state streamState) *stream
 		panic("internal error: cannot create stream with id 0")
 	}
 
-	ctx, cancelCtx := context.WithCancel(sc.baseCtx)
+	stats := new(StreamStats)
+	ctx, cancelCtx := context.WithCancel(context.WithValue(sc.baseCtx, streamStatsContextKey{}, stats))
 	st := &stream{
 		sc:        sc,
 		id:        id,
 		state:     state,
 		ctx:       ctx,
 		cancelCtx: cancelCtx,
+		stats:     stats,
 	}
 	st.cw.Init()
 	st.flow.conn = &sc.flow // link to conn-level counter
@@ -2142,10 +2558,17 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 		scheme:    f.PseudoValue("scheme"),
 		authority: f.PseudoValue("authority"),
 		path:      f.PseudoValue("path"),
+		protocol:  f.PseudoValue("protocol"),
 	}
 
 	isConnect := rp.method == "CONNECT"
-	if isConnect {
+	if rp.protocol != "" {
+		// RFC 8441, Section 4: an extended CONNECT request carries
+		// all of the usual pseudo-header fields.
+		if !isConnect || !sc.srv.EnableConnectProtocol || rp.path == "" || rp.authority == "" || (rp.scheme != "https" && rp.scheme != "http") {
+			return nil, nil, sc.countError("bad_extended_connect", streamError(f.StreamID, ErrCodeProtocol))
+		}
+	} else if isConnect {
 		if rp.path != "" || rp.scheme != "" || rp.authority == "" {
 			return nil, nil, sc.countError("bad_connect", streamError(f.StreamID, ErrCodeProtocol))
 		}
@@ -2170,6 +2593,9 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 	if rp.authority == "" {
 		rp.authority = rp.header.Get("Host")
 	}
+	if rp.protocol != "" {
+		rp.header.Set(":protocol", rp.protocol)
+	}
 
 	rw, req, err := sc.newWriterAndRequestNoBody(st, rp)
 	if err != nil {
@@ -2196,6 +2622,7 @@ func (sc *serverConn) newWriterAndRequest(st *stream, f *MetaHeadersFrame) (*res
 type requestParam struct {
 	method                  string
 	scheme, authority, path string
+	protocol                string // extended CONNECT only
 	header                  http.Header
 }
 
@@ -2237,7 +2664,7 @@ func (sc *serverConn) newWriterAndRequestNoBody(st *stream, rp requestParam) (*r
 
 	var url_ *url.URL
 	var requestURI string
-	if rp.method == "CONNECT" {
+	if rp.method == "CONNECT" && rp.protocol == "" {
 		url_ = &url.URL{Host: rp.authority}
 		requestURI = rp.authority // mimic HTTP/1 server behavior
 	} else {
@@ -2329,6 +2756,7 @@ func handleHeaderListTooLong(w http.ResponseWriter, r *http.Request) {
 // h may be nil.
 func (sc *serverConn) writeHeaders(st *stream, headerData *writeResHeaders) error {
 	sc.serveG.checkNotOn() // NOT on
+	headerData.padding = sc.srv.FramePadding
 	var errc chan error
 	if headerData.h != nil {
 		// If there's a header map (which we don't own), so we have to block on
@@ -2471,11 +2899,22 @@ type responseWriter struct {
 	rws *responseWriterState
 }
 
+// A ConnFlusher is implemented by the ResponseWriters of a Server. Its
+// FlushConn method flushes the response like the Flush method, and then
+// the frames written to the connection, without waiting for the end of
+// Server.WriteCoalesceDelay.
+type ConnFlusher interface {
+	FlushConn() error
+}
+
 // Optional http.ResponseWriter interfaces implemented.
 var (
 	_ http.CloseNotifier = (*responseWriter)(nil)
 	_ http.Flusher       = (*responseWriter)(nil)
 	_ stringWriter       = (*responseWriter)(nil)
+
+	_ ExtensionFrameWriter = (*responseWriter)(nil)
+	_ ConnFlusher          = (*responseWriter)(nil)
 )
 
 type responseWriterState struct {
@@ -2500,6 +2939,10 @@ type responseWriterState struct {
 	sentContentLen int64 // non-zero if handler set a Content-Length header
 	wroteBytes     int64
 
+	encoder    EncodingWriter // compressing the body, if Server.ResponseEncoders
+	encodedBuf bytes.Buffer   // output of encoder
+	flushing   bool           // in FlushError, for encoder to flush
+
 	closeNotifierMu sync.Mutex // guards closeNotifierCh
 	closeNotifierCh chan bool  // nil until first used
 }
@@ -2581,6 +3024,9 @@ func (rws *responseWriterState) writeChunk(p []byte) (n int, err error) {
 		if !hasCE && !hasContentType && bodyAllowedForStatus(rws.status) && len(p) > 0 {
 			ctype = http.DetectContentType(p)
 		}
+		if len(rws.conn.srv.ResponseEncoders) > 0 && !hasCE && rws.startEncoding(ctype, clen) {
+			clen = ""
+		}
 		var date string
 		if _, ok := rws.snapHeader["Date"]; !ok {
 			// TODO(bradfitz): be faster here, like net/http? measure.
@@ -2595,7 +3041,17 @@ func (rws *responseWriterState) writeChunk(p []byte) (n int, err error) {
 		// but respect "Connection" == "close" to mean sending a GOAWAY and tearing
 		// down the TCP connection when idle, like we do for HTTP/1.
 		// TODO: remove more Connection-specific header fields here, in addition
-		// to "Connection".
+		// to "Connection", unless StrictValidation does.
+		if rws.conn.srv.StrictValidation {
+			for _, k := range strictSanitize(rws.snapHeader) {
+				rws.conn.srv.reportValidationError(&ValidationError{
+					StreamID:  rws.stream.id,
+					Field:     k,
+					Reason:    "connection-specific header field",
+					Sanitized: true,
+				})
+			}
+		}
 		if _, ok := rws.snapHeader["Connection"]; ok {
 			v := rws.snapHeader.Get("Connection")
 			delete(rws.snapHeader, "Connection")
@@ -2625,17 +3081,24 @@ func (rws *responseWriterState) writeChunk(p []byte) (n int, err error) {
 	if isHeadResp {
 		return len(p), nil
 	}
-	if len(p) == 0 && !rws.handlerDone {
-		return 0, nil
+	data := p
+	if rws.encoder != nil {
+		if data, err = rws.encode(p); err != nil {
+			rws.dirty = true
+			return 0, err
+		}
+	}
+	if len(data) == 0 && !rws.handlerDone {
+		return len(p), nil
 	}
 
 	// only send trailers if they have actually been defined by the
 	// server handler.
 	hasNonemptyTrailers := rws.hasNonemptyTrailers()
 	endStream := rws.handlerDone && !hasNonemptyTrailers
-	if len(p) > 0 || endStream {
+	if len(data) > 0 || endStream {
 		// only send a 0 byte DATA frame if we're ending the stream.
-		if err := rws.conn.writeDataFromHandler(rws.stream, p, endStream); err != nil {
+		if err := rws.conn.writeDataFromHandler(rws.stream, data, endStream); err != nil {
 			rws.dirty = true
 			return 0, err
 		}
@@ -2770,6 +3233,8 @@ func (w *responseWriter) FlushError() error {
 	if rws == nil {
 		panic("Header called after Handler finished")
 	}
+	rws.flushing = true
+	defer func() { rws.flushing = false }()
 	var err error
 	if rws.bw.Buffered() > 0 {
 		err = rws.bw.Flush()
@@ -2790,6 +3255,21 @@ func (w *responseWriter) FlushError() error {
 	return err
 }
 
+// FlushConn implements ConnFlusher.
+func (w *responseWriter) FlushConn() error {
+	rws := w.rws
+	if rws == nil {
+		panic("FlushConn called after Handler finished")
+	}
+	if err := w.FlushError(); err != nil {
+		return err
+	}
+	if rws.conn.srv.WriteCoalesceDelay > 0 {
+		rws.conn.sendServeMsg(func(sc *serverConn) { sc.flushSoon() })
+	}
+	return nil
+}
+
 func (w *responseWriter) CloseNotify() <-chan bool {
 	rws := w.rws
 	if rws == nil {
@@ -1178,6 +1178,69 @@ func TestServer_Request_Connect_InvalidScheme(t *testing.T) {
 	})
 }
 
+func TestServer_Request_ExtendedConnect(t *testing.T) {
+	gotReq := make(chan *http.Request, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		gotReq <- r
+	}, func(s *Server) {
+		s.EnableConnectProtocol = true
+	})
+	defer st.Close()
+	var advertised bool
+	st.greetAndCheckSettings(func(s Setting) error {
+		if s.ID == SettingEnableConnectProtocol {
+			advertised = s.Val == 1
+		}
+		return nil
+	})
+	if !advertised {
+		t.Errorf("server did not advertise %v", SettingEnableConnectProtocol)
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID: 1,
+		BlockFragment: st.encodeHeaderRaw(
+			":method", "CONNECT",
+			":protocol", "websocket",
+			":scheme", "https",
+			":authority", "example.com",
+			":path", "/chat",
+		),
+		EndHeaders: true,
+	})
+	r := <-gotReq
+	if g, w := r.Method, "CONNECT"; g != w {
+		t.Errorf("Method = %q; want %q", g, w)
+	}
+	if g, w := r.Header.Get(":protocol"), "websocket"; g != w {
+		t.Errorf(":protocol = %q; want %q", g, w)
+	}
+	if g, w := r.RequestURI, "/chat"; g != w {
+		t.Errorf("RequestURI = %q; want %q", g, w)
+	}
+	if g, w := r.URL.Path, "/chat"; g != w {
+		t.Errorf("URL.Path = %q; want %q", g, w)
+	}
+	if g, w := r.Host, "example.com"; g != w {
+		t.Errorf("Host = %q; want %q", g, w)
+	}
+}
+
+func TestServer_Request_ExtendedConnect_NotEnabled(t *testing.T) {
+	testServerRejectsStream(t, ErrCodeProtocol, func(st *serverTester) {
+		st.writeHeaders(HeadersFrameParam{
+			StreamID: 1,
+			BlockFragment: st.encodeHeaderRaw(
+				":method", "CONNECT",
+				":protocol", "websocket",
+				":scheme", "https",
+				":authority", "example.com",
+				":path", "/chat",
+			),
+			EndHeaders: true,
+		})
+	})
+}
+
 func TestServer_Ping(t *testing.T) {
 	st := newServerTester(t, nil)
 	defer st.Close()
@@ -1712,6 +1775,94 @@ func TestServer_Rejects_PrioritySelfDependence(t *testing.T) {
 	})
 }
 
+// adjustCountingWriteScheduler counts the calls to AdjustStream.
+type adjustCountingWriteScheduler struct {
+	WriteScheduler
+	adjusts int32
+}
+
+func (ws *adjustCountingWriteScheduler) AdjustStream(streamID uint32, priority PriorityParam) {
+	atomic.AddInt32(&ws.adjusts, 1)
+	ws.WriteScheduler.AdjustStream(streamID, priority)
+}
+
+func TestServer_NoRFC7540Priorities(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		server, client bool
+	}{
+		{"server", true, false},
+		{"client", false, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ws := &adjustCountingWriteScheduler{WriteScheduler: NewPriorityWriteScheduler(nil)}
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, func(s *Server) {
+				s.DisableRFC7540Priorities = test.server
+				s.NewWriteScheduler = func() WriteScheduler { return ws }
+			})
+			defer st.Close()
+			st.writePreface()
+			var settings []Setting
+			if test.client {
+				settings = append(settings, Setting{SettingNoRFC7540Priorities, 1})
+			}
+			if err := st.fr.WriteSettings(settings...); err != nil {
+				t.Fatal(err)
+			}
+			var advertised bool
+			st.wantSettings().ForeachSetting(func(s Setting) error {
+				if s.ID == SettingNoRFC7540Priorities {
+					advertised = s.Val == 1
+				}
+				return nil
+			})
+			if advertised != test.server {
+				t.Errorf("server advertised SETTINGS_NO_RFC7540_PRIORITIES = %v; want %v", advertised, test.server)
+			}
+			st.writeSettingsAck()
+
+			// Priority signals are ignored, even invalid ones.
+			st.fr.AllowIllegalWrites = true
+			st.writePriority(3, PriorityParam{StreamDep: 1, Weight: 20})
+			st.writePriority(1, PriorityParam{StreamDep: 1})
+			st.writeHeaders(HeadersFrameParam{
+				StreamID:      1,
+				BlockFragment: st.encodeHeader(),
+				EndStream:     true,
+				EndHeaders:    true,
+				Priority:      PriorityParam{StreamDep: 1, Weight: 10},
+			})
+			for {
+				f, err := st.readFrame()
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch f := f.(type) {
+				case *RSTStreamFrame, *GoAwayFrame:
+					t.Fatalf("got %v; want the priority signals ignored", f)
+				case *HeadersFrame:
+					if f.StreamID != 1 {
+						t.Fatalf("got HEADERS for stream %v; want stream 1", f.StreamID)
+					}
+					if n := atomic.LoadInt32(&ws.adjusts); n != 0 {
+						t.Errorf("WriteScheduler.AdjustStream called %v times; want 0", n)
+					}
+					return
+				}
+			}
+		})
+	}
+}
+
+// SETTINGS_NO_RFC7540_PRIORITIES may not change after the first SETTINGS.
+func TestServer_Rejects_NoRFC7540PrioritiesChange(t *testing.T) {
+	testServerRejectsConn(t, func(st *serverTester) {
+		if err := st.fr.WriteSettings(Setting{SettingNoRFC7540Priorities, 1}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
 func TestServer_Rejects_PushPromise(t *testing.T) {
 	testServerRejectsConn(t, func(st *serverTester) {
 		pp := PushPromiseParam{
@@ -3743,6 +3894,65 @@ func TestServer_Rejects_ConnHeaders(t *testing.T) {
 	}
 }
 
+func TestServer_StrictValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		field   string // rejected field, if any
+	}{
+		{"valid", []string{"host", "example.com", ":authority", "example.com", "content-length", "0"}, ""},
+		{"content-length without body", []string{"content-length", "5"}, "Content-Length"},
+		{"invalid content-length", []string{"content-length", "+0"}, "Content-Length"},
+		{"host differs from authority", []string{":authority", "example.com", "host", "other.example.com"}, "Host"},
+		{"white space", []string{"x-foo", " bar"}, "X-Foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []*ValidationError
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Connection", "x-hop")
+				w.Header().Set("X-Hop", "1")
+				w.Header().Set("Keep-Alive", "timeout=5")
+			}, func(s *Server) {
+				s.StrictValidation = true
+				s.ValidationErrorHook = func(err *ValidationError) { errs = append(errs, err) }
+			})
+			defer st.Close()
+			st.greet()
+			st.bodylessReq1(tt.headers...)
+			hf := st.wantHeaders()
+			goth := st.decodeHeader(hf.HeaderBlockFragment())
+			st.Close()
+			if tt.field != "" {
+				if goth[0][1] != "400" {
+					t.Errorf("got status %v; want 400", goth[0][1])
+				}
+				if len(errs) != 1 || errs[0].Field != tt.field || errs[0].Sanitized || errs[0].StreamID != 1 {
+					t.Errorf("got errors %v; want one rejecting %v", errs, tt.field)
+				}
+				return
+			}
+			wanth := [][2]string{
+				{":status", "200"},
+				{"content-length", "0"},
+			}
+			if !reflect.DeepEqual(goth, wanth) {
+				t.Errorf("got headers %v; want %v", goth, wanth)
+			}
+			var removed []string
+			for _, err := range errs {
+				if !err.Sanitized {
+					t.Errorf("unexpected error %v", err)
+				}
+				removed = append(removed, err.Field)
+			}
+			if want := []string{"X-Hop", "Keep-Alive"}; !reflect.DeepEqual(removed, want) {
+				t.Errorf("removed %v; want %v", removed, want)
+			}
+		})
+	}
+}
+
 type hpackEncoder struct {
 	enc *hpack.Encoder
 	buf bytes.Buffer
@@ -4756,3 +4966,516 @@ func TestServerWriteDoesNotRetainBufferAfterServerClose(t *testing.T) {
 	st.ts.Config.Close()
 	<-donec
 }
+
+func TestServer_FramePadding(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}, func(s *Server) {
+		s.FramePadding = PadToMultiple(64)
+	})
+	defer st.Close()
+	st.greet()
+	st.bodylessReq1()
+	hf := st.wantHeaders()
+	if n := hf.Header().Length; n%64 != 0 {
+		t.Errorf("HEADERS frame payload of %d bytes; want a multiple of 64", n)
+	}
+	var got []byte
+	for {
+		df := st.wantData()
+		if n := df.Header().Length; n%64 != 0 {
+			t.Errorf("DATA frame payload of %d bytes; want a multiple of 64", n)
+		}
+		got = append(got, df.Data()...)
+		if df.StreamEnded() {
+			break
+		}
+	}
+	if string(got) != body {
+		t.Errorf("got body %q; want %q", got, body)
+	}
+}
+
+func TestServer_ExtensionFrames(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := w.(ExtensionFrameWriter).WriteExtensionFrame(FramePing, 0, 0, nil); err != errNotExtensionFrame {
+			t.Errorf("WriteExtensionFrame(PING) = %v; want %v", err, errNotExtensionFrame)
+		}
+		if err := w.(ExtensionFrameWriter).WriteExtensionFrame(0xfb, 0, 1, []byte("from handler")); err != nil {
+			t.Errorf("WriteExtensionFrame = %v", err)
+		}
+	}, func(s *Server) {
+		s.OnExtensionFrame = func(w ExtensionFrameWriter, f *UnknownFrame) {
+			if err := w.WriteExtensionFrame(0xfa, f.Flags, f.StreamID, append([]byte("echo "), f.Payload()...)); err != nil {
+				t.Errorf("WriteExtensionFrame = %v", err)
+			}
+		}
+	})
+	defer st.Close()
+	st.greet()
+	st.fr.WriteRawFrame(0xfa, 0x2, 0, []byte("grease"))
+	wantExtensionFrame(t, st.readFrame, 0xfa, 0x2, 0, "echo grease")
+	st.bodylessReq1()
+	wantExtensionFrame(t, st.readFrame, 0xfb, 0, 1, "from handler")
+}
+
+// wantExtensionFrame reads frames with readFrame until an UnknownFrame,
+// which it checks.
+func wantExtensionFrame(t *testing.T, readFrame func() (Frame, error), typ FrameType, flags Flags, streamID uint32, payload string) {
+	t.Helper()
+	for {
+		f, err := readFrame()
+		if err != nil {
+			t.Fatalf("reading extension frame: %v", err)
+		}
+		uf, ok := f.(*UnknownFrame)
+		if !ok {
+			continue
+		}
+		if uf.Type != typ || uf.Flags != flags || uf.StreamID != streamID || string(uf.Payload()) != payload {
+			t.Errorf("got %v %q; want type %v, flags %v, stream %d and %q", uf.FrameHeader, uf.Payload(), typ, flags, streamID, payload)
+		}
+		return
+	}
+}
+
+func TestServer_RequireClientCert(t *testing.T) {
+	var gotErr error
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		gotErr = ClientCertError(r)
+		if gotErr != nil {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}, func(s *Server) {
+		s.RequireClientCert = func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, "/private/")
+		}
+	})
+	defer st.Close()
+	st.greet()
+
+	for _, tt := range []struct {
+		id     uint32
+		path   string
+		status string
+	}{
+		{1, "/public", "200"},
+		{3, "/private/a", "403"},
+	} {
+		st.writeHeaders(HeadersFrameParam{
+			StreamID:      tt.id,
+			BlockFragment: st.encodeHeader(":path", tt.path),
+			EndStream:     true,
+			EndHeaders:    true,
+		})
+		hf := st.wantHeaders()
+		if got := st.decodeHeader(hf.HeaderBlockFragment()); got[0][1] != tt.status {
+			t.Errorf("%s: status = %s; want %s", tt.path, got[0][1], tt.status)
+		}
+		if _, ok := gotErr.(*ClientCertRequiredError); ok != (tt.status == "403") {
+			t.Errorf("%s: ClientCertError = %v", tt.path, gotErr)
+		}
+	}
+}
+
+func TestServer_RequireClientCertHTTP11Fallback(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/public" {
+			t.Errorf("handler called for %s", r.URL.Path)
+		}
+	}, func(s *Server) {
+		s.RequireClientCert = func(r *http.Request) bool {
+			return r.URL.Path != "/public"
+		}
+		s.ClientCertHTTP11Fallback = true
+	})
+	defer st.Close()
+	st.greet()
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":path", "/private"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	st.wantRSTStream(1, ErrCodeHTTP11Required)
+
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      3,
+		BlockFragment: st.encodeHeader(":path", "/public"),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	st.wantHeaders()
+}
+
+func TestServer_WriteCoalesceDelay(t *testing.T) {
+	resume := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "delayed")
+		w.(http.Flusher).Flush()
+		<-resume
+		io.WriteString(w, "flushed")
+		if err := w.(ConnFlusher).FlushConn(); err != nil {
+			t.Errorf("FlushConn = %v", err)
+		}
+		<-resume
+	}, func(s *Server) {
+		s.WriteCoalesceDelay = time.Minute
+	})
+	defer st.Close()
+	defer close(resume)
+	st.greet()
+	st.bodylessReq1()
+
+	// The frames wait for the delay, or a frame of another type.
+	st.cc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if f, err := st.readFrame(); err == nil {
+		t.Fatalf("got %v before the end of the delay", summarizeFrame(f))
+	}
+	st.cc.SetReadDeadline(time.Time{})
+	pingData := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	if err := st.fr.WritePing(false, pingData); err != nil {
+		t.Fatal(err)
+	}
+	st.wantHeaders()
+	if df := st.wantData(); string(df.Data()) != "delayed" {
+		t.Fatalf("got DATA %q; want %q", df.Data(), "delayed")
+	}
+	if pf := st.wantPing(); pf.Data != pingData {
+		t.Fatalf("got PING data %x; want %x", pf.Data, pingData)
+	}
+
+	resume <- struct{}{}
+	if df := st.wantData(); string(df.Data()) != "flushed" {
+		t.Fatalf("got DATA %q; want %q", df.Data(), "flushed")
+	}
+}
+
+func TestServer_MaxConnBufferedBytes(t *testing.T) {
+	unblock := make(chan struct{})
+	events := make(chan MemoryBudgetEvent, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}, func(s *Server) {
+		s.MaxConnBufferedBytes = 4 << 10
+		s.MemoryBudgetHook = func(ev MemoryBudgetEvent) { events <- ev }
+	})
+	defer st.Close()
+	defer close(unblock)
+	st.greet()
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(":method", "POST"),
+		EndStream:     false,
+		EndHeaders:    true,
+	})
+	st.writeData(1, false, make([]byte, 8<<10))
+	// The conn-level flow control of the dropped bytes is returned
+	// once, however many frames follow the RST_STREAM.
+	var connWindow uint32
+	gotRST := false
+	pingData := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for {
+		f, err := st.readFrame()
+		if err != nil {
+			t.Fatalf("reading the frames: %v", err)
+		}
+		switch f := f.(type) {
+		case *WindowUpdateFrame:
+			if f.StreamID == 0 {
+				connWindow += f.Increment
+			}
+			continue
+		case *RSTStreamFrame:
+			if gotRST || f.StreamID != 1 || f.ErrCode != ErrCodeEnhanceYourCalm {
+				t.Fatalf("got %v; want RST_STREAM of stream 1 with ENHANCE_YOUR_CALM", summarizeFrame(f))
+			}
+			gotRST = true
+			if err := st.fr.WritePing(false, pingData); err != nil {
+				t.Fatalf("Error writing PING: %v", err)
+			}
+			continue
+		case *PingFrame:
+			if gotRST && f.IsAck() && f.Data == pingData {
+				break
+			}
+			t.Fatalf("got %v; want a PING ACK after the RST_STREAM", summarizeFrame(f))
+		default:
+			t.Fatalf("got %v; want RST_STREAM of stream 1 with ENHANCE_YOUR_CALM", summarizeFrame(f))
+		}
+		break
+	}
+	if connWindow != 8<<10 {
+		t.Errorf("conn-level WINDOW_UPDATE increments = %d; want %d", connWindow, 8<<10)
+	}
+	ev := <-events
+	if ev.StreamsReset != 1 || ev.ConnClosed || ev.Budget != 4<<10 || ev.Buffered <= 8<<10 {
+		t.Errorf("MemoryBudgetHook called with %+v", ev)
+	}
+}
+
+// The handler reuses the writeData of its stream once it is written,
+// which the budget must not read after scheduling it. Run with -race.
+func TestServer_MaxConnBufferedBytesFlushedWrites(t *testing.T) {
+	const chunks = 100
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < chunks; i++ {
+			w.Write([]byte("chunk"))
+			w.(http.Flusher).Flush()
+		}
+	}, func(s *Server) {
+		s.MaxConnBufferedBytes = 64 << 10
+	})
+	defer st.Close()
+	st.greet()
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: st.encodeHeader(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	st.wantHeaders()
+	n := 0
+	for {
+		df := st.wantData()
+		n += len(df.Data())
+		if df.StreamEnded() {
+			break
+		}
+	}
+	if want := chunks * len("chunk"); n != want {
+		t.Errorf("read %d bytes of DATA; want %d", n, want)
+	}
+}
+
+func TestPadToMultiple(t *testing.T) {
+	pad := PadToMultiple(16)
+	for n := 0; n < 40; n++ {
+		p := pad(FrameData, n)
+		if p < 0 || p > 16 {
+			t.Fatalf("padding of %d bytes = %d; want between 0 and 16", n, p)
+		}
+		total := n
+		if p > 0 {
+			total += 1 + p
+		}
+		if total%16 != 0 {
+			t.Errorf("padding of %d bytes = %d; payload of %d bytes", n, p, total)
+		}
+	}
+}
+
+func TestPadRandom(t *testing.T) {
+	for _, max := range []int{0, 1, 100, 255} {
+		pad := PadRandom(max)
+		seen := map[int]bool{}
+		for i := 0; i < 1000; i++ {
+			p := pad(FrameData, 10)
+			if p < 0 || p > max {
+				t.Fatalf("PadRandom(%d) padding = %d; want between 0 and %d", max, p, max)
+			}
+			seen[p] = true
+		}
+		if max > 0 && len(seen) < 2 {
+			t.Errorf("PadRandom(%d) always padded with %v", max, seen)
+		}
+	}
+}
+
+func TestServer_ResponseEncoders(t *testing.T) {
+	body := strings.Repeat("hello, compressed world\n", 200)
+	tests := []struct {
+		name    string
+		accept  string
+		handler func(w http.ResponseWriter)
+		wantCE  string
+		wantVar bool
+	}{{
+		name:   "gzip",
+		accept: "br;q=1, gzip;q=0.8",
+		handler: func(w http.ResponseWriter) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, body)
+		},
+		wantCE:  "gzip",
+		wantVar: true,
+	}, {
+		name:   "sniffed",
+		accept: "*",
+		handler: func(w http.ResponseWriter) {
+			io.WriteString(w, body)
+		},
+		wantCE:  "gzip",
+		wantVar: true,
+	}, {
+		name: "not_accepted",
+		handler: func(w http.ResponseWriter) {
+			io.WriteString(w, body)
+		},
+		wantVar: true,
+	}, {
+		name:   "refused",
+		accept: "gzip;q=0, identity",
+		handler: func(w http.ResponseWriter) {
+			io.WriteString(w, body)
+		},
+		wantVar: true,
+	}, {
+		name:   "small",
+		accept: "gzip",
+		handler: func(w http.ResponseWriter) {
+			io.WriteString(w, body[:100])
+		},
+		wantVar: true,
+	}, {
+		name:   "image",
+		accept: "gzip",
+		handler: func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, body)
+		},
+	}, {
+		name:   "handler_encoded",
+		accept: "gzip",
+		handler: func(w http.ResponseWriter) {
+			w.Header().Set("Content-Encoding", "identity-ish")
+			io.WriteString(w, body)
+		},
+		wantCE: "identity-ish",
+	}, {
+		name:   "no_transform",
+		accept: "gzip",
+		handler: func(w http.ResponseWriter) {
+			w.Header().Set("Cache-Control", "public, no-transform")
+			io.WriteString(w, body)
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(w)
+			}, func(s *Server) {
+				s.ResponseEncoders = []ResponseEncoder{GzipEncoder(gzip.BestSpeed)}
+			})
+			defer st.Close()
+			st.greet()
+			var headers []string
+			if tt.accept != "" {
+				headers = []string{"accept-encoding", tt.accept}
+			}
+			st.bodylessReq1(headers...)
+			hf := st.wantHeaders()
+			h := http.Header{}
+			for _, kv := range st.decodeHeader(hf.HeaderBlockFragment()) {
+				h.Add(kv[0], kv[1])
+			}
+			var got []byte
+			for {
+				df := st.wantData()
+				got = append(got, df.Data()...)
+				if df.StreamEnded() {
+					break
+				}
+			}
+			if ce := h.Get("Content-Encoding"); ce != tt.wantCE {
+				t.Fatalf("Content-Encoding = %q; want %q", ce, tt.wantCE)
+			}
+			if gotVary := h.Get("Vary") == "Accept-Encoding"; gotVary != tt.wantVar {
+				t.Errorf("Vary = %q; want Accept-Encoding: %v", h.Get("Vary"), tt.wantVar)
+			}
+			if tt.wantCE != "gzip" {
+				if len(got) == 0 || !strings.HasPrefix(body, string(got)) {
+					t.Errorf("got a body of %d bytes, not as written", len(got))
+				}
+				return
+			}
+			if cl := h.Get("Content-Length"); cl != "" {
+				t.Errorf("Content-Length = %q; want none", cl)
+			}
+			if etag := h.Get("Etag"); etag != "" && etag != `W/"v1"` {
+				t.Errorf("ETag = %q; want %q", etag, `W/"v1"`)
+			}
+			if len(got) >= len(body) {
+				t.Errorf("got %d bytes of DATA; want fewer than the %d of the body", len(got), len(body))
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != body {
+				t.Errorf("decompressed body of %d bytes; want %d", len(b), len(body))
+			}
+		})
+	}
+}
+
+func TestServer_ResponseEncodersFlush(t *testing.T) {
+	first := strings.Repeat("a", 2000)
+	unblock := make(chan bool)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, first)
+		w.(http.Flusher).Flush()
+		<-unblock
+		io.WriteString(w, "b")
+	}, func(s *Server) {
+		s.ResponseEncoders = []ResponseEncoder{GzipEncoder(gzip.DefaultCompression)}
+	})
+	defer st.Close()
+	defer close(unblock)
+	st.greet()
+	st.bodylessReq1("accept-encoding", "gzip")
+	st.wantHeaders()
+
+	// The DATA sent at the Flush decompress to all of the body written
+	// before it.
+	var got []byte
+	for {
+		got = append(got, st.wantData().Data()...)
+		zr, err := gzip.NewReader(bytes.NewReader(got))
+		if err != nil {
+			continue
+		}
+		b := make([]byte, len(first))
+		if _, err := io.ReadFull(zr, b); err == nil {
+			if string(b) != first {
+				t.Errorf("decompressed %q...; want %q...", b[:10], first[:10])
+			}
+			break
+		}
+	}
+}
+
+func TestSelectResponseEncoder(t *testing.T) {
+	encs := []ResponseEncoder{{Coding: "zstd"}, {Coding: "gzip"}}
+	tests := []struct {
+		accept []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"gzip"}, "gzip"},
+		{[]string{"GZIP, zstd"}, "zstd"},
+		{[]string{"gzip;q=1", "zstd;q=0.5"}, "gzip"},
+		{[]string{"zstd;q=0, *"}, "gzip"},
+		{[]string{"*;q=0.1, gzip;q=0.2"}, "gzip"},
+		{[]string{"br, identity"}, ""},
+		{[]string{"gzip;q=0"}, ""},
+		{[]string{"gzip;q=bogus"}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if enc := selectResponseEncoder(encs, tt.accept); enc != nil {
+			got = enc.Coding
+		}
+		if got != tt.want {
+			t.Errorf("selectResponseEncoder(%q) = %q; want %q", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrStreamQueueTimeout is returned by RoundTrip when a request waited
+// longer than Transport.StreamQueueTimeout for the peer to allow a new
+// stream.
+var ErrStreamQueueTimeout = errors.New("http2: timeout awaiting a stream below the peer's SETTINGS_MAX_CONCURRENT_STREAMS")
+
+// A StreamQueueOrder is the order in which requests waiting in the
+// stream queue of a connection are sent. See Transport.StreamQueueOrder.
+type StreamQueueOrder uint8
+
+const (
+	// StreamQueueFIFO sends the requests in the order they were queued.
+	StreamQueueFIFO StreamQueueOrder = iota
+
+	// StreamQueueDeadline sends the request whose context has the
+	// earliest deadline first, then the requests without a deadline,
+	// each group in the order they were queued.
+	StreamQueueDeadline
+)
+
+func (o StreamQueueOrder) String() string {
+	switch o {
+	case StreamQueueFIFO:
+		return "FIFO"
+	case StreamQueueDeadline:
+		return "Deadline"
+	}
+	return "unknown"
+}
+
+// streamWaiter is a request in the stream queue of a ClientConn.
+type streamWaiter struct {
+	cs       *clientStream
+	seq      uint64
+	deadline time.Time     // zero if the request has no deadline
+	ready    chan struct{} // closed when the request is granted a slot
+}
+
+// before reports whether w should be sent before v.
+func (w *streamWaiter) before(v *streamWaiter, order StreamQueueOrder) bool {
+	if order == StreamQueueDeadline && !w.deadline.Equal(v.deadline) {
+		switch {
+		case w.deadline.IsZero():
+			return false
+		case v.deadline.IsZero():
+			return true
+		}
+		return w.deadline.Before(v.deadline)
+	}
+	return w.seq < v.seq
+}
+
+// awaitQueuedSlot waits in the stream queue of cc until cs is granted a
+// slot below the peer's SETTINGS_MAX_CONCURRENT_STREAMS, for at most
+// Transport.StreamQueueTimeout. The slot is held until the stream is
+// added, or until releaseQueuedSlot.
+func (cc *ClientConn) awaitQueuedSlot(cs *clientStream) error {
+	cc.mu.Lock()
+	w := &streamWaiter{
+		cs:    cs,
+		seq:   cc.streamQueueSeq,
+		ready: make(chan struct{}),
+	}
+	cc.streamQueueSeq++
+	if d, ok := cs.ctx.Deadline(); ok {
+		w.deadline = d
+	}
+	cc.streamQueue = append(cc.streamQueue, w)
+	cc.pendingRequests++
+	if len(cc.streamQueue) > cc.streamQueueMax {
+		cc.streamQueueMax = len(cc.streamQueue)
+	}
+	cc.grantQueuedSlotsLocked()
+	cc.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(cc.t.StreamQueueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = ErrStreamQueueTimeout
+	case <-cs.abort:
+		err = cs.abortErr
+	case <-cs.reqCancel:
+		err = errRequestCanceled
+	case <-cs.ctx.Done():
+		err = cs.ctx.Err()
+	}
+
+	if f := cc.t.CountError; f != nil && err == ErrStreamQueueTimeout {
+		f("stream_queue_timeout")
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if err == ErrStreamQueueTimeout {
+		cc.streamQueueTimeouts++
+	}
+	for i, v := range cc.streamQueue {
+		if v == w {
+			cc.streamQueue = append(cc.streamQueue[:i], cc.streamQueue[i+1:]...)
+			cc.pendingRequests--
+			return err
+		}
+	}
+	// The slot was granted as the wait ended: give it to the next
+	// request in the queue.
+	cs.queuedSlot = false
+	cc.streamsGranted--
+	cc.grantQueuedSlotsLocked()
+	return err
+}
+
+// releaseQueuedSlot releases the slot granted to cs by awaitQueuedSlot if
+// the stream was not added.
+func (cc *ClientConn) releaseQueuedSlot(cs *clientStream) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cs.queuedSlot {
+		cs.queuedSlot = false
+		cc.streamsGranted--
+		cc.grantQueuedSlotsLocked()
+	}
+}
+
+// grantQueuedSlotsLocked grants the slots available below the peer's
+// SETTINGS_MAX_CONCURRENT_STREAMS to the requests in the stream queue.
+// If cc cannot take new requests, it releases them all, to fail in
+// awaitOpenSlotForStreamLocked.
+// Must hold cc.mu.
+func (cc *ClientConn) grantQueuedSlotsLocked() {
+	if len(cc.streamQueue) == 0 {
+		return
+	}
+	release := cc.closed || !cc.canTakeNewRequestLocked()
+	for len(cc.streamQueue) > 0 {
+		if !release && int64(len(cc.streams)+cc.streamsGranted) >= int64(cc.maxConcurrentStreams) {
+			return
+		}
+		next := 0
+		for i, w := range cc.streamQueue {
+			if w.before(cc.streamQueue[next], cc.t.StreamQueueOrder) {
+				next = i
+			}
+		}
+		w := cc.streamQueue[next]
+		cc.streamQueue = append(cc.streamQueue[:next], cc.streamQueue[next+1:]...)
+		cc.pendingRequests--
+		if !release {
+			w.cs.queuedSlot = true
+			cc.streamsGranted++
+		}
+		close(w.ready)
+	}
+}
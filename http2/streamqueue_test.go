@@ -0,0 +1,163 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStreamQueueTest starts a server allowing one stream at a time,
+// whose handler reports the path of each request on the returned
+// channel. Requests for /block wait until unblock is closed.
+func newStreamQueueTest(t *testing.T, tr *Transport) (cc *ClientConn, paths chan string, unblock chan struct{}) {
+	paths = make(chan string, 10)
+	unblock = make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		if r.URL.Path == "/block" {
+			<-unblock
+		}
+	}, optOnlyServer, func(s *Server) {
+		s.MaxConcurrentStreams = 1
+	})
+	t.Cleanup(st.Close)
+	tr.TLSClientConfig = tlsConfigInsecure
+	tr.StrictMaxConcurrentStreams = true
+	c, err := tls.Dial("tcp", st.ts.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{NextProtoTLS},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err = tr.NewClientConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	// Make sure the client has seen the server's SETTINGS.
+	if err := cc.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return cc, paths, unblock
+}
+
+func streamQueueGet(ctx context.Context, cc *ClientConn, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://dummy.tld"+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := cc.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// waitStreamsPending waits until n requests are queued on cc.
+func waitStreamsPending(t *testing.T, cc *ClientConn, n int) {
+	t.Helper()
+	for start := time.Now(); cc.State().StreamsPending != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("%v requests queued; want %v", cc.State().StreamsPending, n)
+		}
+	}
+}
+
+func TestTransportStreamQueueTimeout(t *testing.T) {
+	cc, paths, unblock := newStreamQueueTest(t, &Transport{StreamQueueTimeout: 50 * time.Millisecond})
+	blocked := make(chan error, 1)
+	go func() { blocked <- streamQueueGet(context.Background(), cc, "/block") }()
+	<-paths
+
+	if err := streamQueueGet(context.Background(), cc, "/queued"); !errors.Is(err, ErrStreamQueueTimeout) {
+		t.Fatalf("RoundTrip at the server limit: %v; want ErrStreamQueueTimeout", err)
+	}
+	st := cc.State()
+	if st.StreamQueueTimeouts != 1 || st.StreamsPending != 0 || st.StreamsPendingMax != 1 {
+		t.Errorf("State() = %+v; want one timeout, none pending, one pending at most", st)
+	}
+
+	// A request canceled while queued leaves the queue.
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() { canceled <- streamQueueGet(ctx, cc, "/canceled") }()
+	waitStreamsPending(t, cc, 1)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled RoundTrip: %v; want context.Canceled", err)
+	}
+	waitStreamsPending(t, cc, 0)
+
+	close(unblock)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	if err := streamQueueGet(context.Background(), cc, "/after"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-paths; got != "/after" {
+		t.Errorf("server got request for %v; want /after", got)
+	}
+}
+
+func TestTransportStreamQueueOrder(t *testing.T) {
+	for _, test := range []struct {
+		order StreamQueueOrder
+		want  []string
+	}{
+		{StreamQueueFIFO, []string{"/none", "/late", "/early"}},
+		{StreamQueueDeadline, []string{"/early", "/late", "/none"}},
+	} {
+		t.Run(test.order.String(), func(t *testing.T) {
+			cc, paths, unblock := newStreamQueueTest(t, &Transport{
+				StreamQueueTimeout: time.Minute,
+				StreamQueueOrder:   test.order,
+			})
+			errc := make(chan error, 4)
+			go func() { errc <- streamQueueGet(context.Background(), cc, "/block") }()
+			<-paths
+
+			for i, path := range []string{"/none", "/late", "/early"} {
+				ctx := context.Background()
+				if path != "/none" {
+					d := time.Hour
+					if path == "/early" {
+						d = time.Minute
+					}
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, d)
+					defer cancel()
+				}
+				go func(ctx context.Context, path string) { errc <- streamQueueGet(ctx, cc, path) }(ctx, path)
+				waitStreamsPending(t, cc, i+1)
+			}
+			close(unblock)
+
+			var got []string
+			for i := 0; i < 4; i++ {
+				if err := <-errc; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 3; i++ {
+				got = append(got, <-paths)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("requests sent in order %v; want %v", strings.Join(got, " "), strings.Join(test.want, " "))
+			}
+			if max := cc.State().StreamsPendingMax; max != 3 {
+				t.Errorf("StreamsPendingMax = %v; want 3", max)
+			}
+		})
+	}
+}
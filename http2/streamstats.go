@@ -0,0 +1,113 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// StreamStats reports the bytes transferred on an HTTP/2 stream.
+type StreamStats struct {
+	// BytesReceived and BytesSent count the frames of the stream as
+	// they were read from and written to the connection, including
+	// frame headers and padding.
+	BytesReceived int64
+	BytesSent     int64
+
+	// DataBytesReceived and DataBytesSent count the request and
+	// response body bytes of the DATA frames, excluding padding.
+	DataBytesReceived int64
+	DataBytesSent     int64
+
+	// HeaderBytesReceived and HeaderBytesSent count the HPACK-encoded
+	// header blocks of the HEADERS, CONTINUATION and PUSH_PROMISE
+	// frames.
+	HeaderBytesReceived int64
+	HeaderBytesSent     int64
+
+	// FieldBytesReceived and FieldBytesSent count the lengths of the
+	// names and values of the header fields carried by those header
+	// blocks. The difference with HeaderBytesReceived and
+	// HeaderBytesSent is the saving due to header compression.
+	FieldBytesReceived int64
+	FieldBytesSent     int64
+}
+
+type streamStatsContextKey struct{}
+
+// StreamStatsFromContext returns the bytes transferred so far on the
+// HTTP/2 stream of the server request whose context is ctx, such as
+// the value of Request.Context in a Handler. It reports false if ctx
+// does not belong to an HTTP/2 server request.
+//
+// Response bytes are only counted once they are written to the
+// connection, which may happen after the Handler returns.
+func StreamStatsFromContext(ctx context.Context) (StreamStats, bool) {
+	s, ok := ctx.Value(streamStatsContextKey{}).(*StreamStats)
+	if !ok {
+		return StreamStats{}, false
+	}
+	return StreamStats{
+		BytesReceived:       atomic.LoadInt64(&s.BytesReceived),
+		BytesSent:           atomic.LoadInt64(&s.BytesSent),
+		DataBytesReceived:   atomic.LoadInt64(&s.DataBytesReceived),
+		DataBytesSent:       atomic.LoadInt64(&s.DataBytesSent),
+		HeaderBytesReceived: atomic.LoadInt64(&s.HeaderBytesReceived),
+		HeaderBytesSent:     atomic.LoadInt64(&s.HeaderBytesSent),
+		FieldBytesReceived:  atomic.LoadInt64(&s.FieldBytesReceived),
+		FieldBytesSent:      atomic.LoadInt64(&s.FieldBytesSent),
+	}, true
+}
+
+// noteFrameRead counts a frame received on st.
+func (st *stream) noteFrameRead(f Frame) {
+	st.sc.serveG.check()
+	s := st.stats
+	switch f := f.(type) {
+	case *MetaHeadersFrame:
+		atomic.AddInt64(&s.BytesReceived, f.wireSize)
+		atomic.AddInt64(&s.HeaderBytesReceived, f.blockSize)
+		atomic.AddInt64(&s.FieldBytesReceived, f.fieldSize)
+		return
+	case *DataFrame:
+		atomic.AddInt64(&s.DataBytesReceived, int64(len(f.Data())))
+	}
+	atomic.AddInt64(&s.BytesReceived, frameHeaderLen+int64(f.Header().Length))
+}
+
+// noteFrameWritten counts a frame written on the stream of wr.
+func (sc *serverConn) noteFrameWritten(wr FrameWriteRequest) {
+	sc.serveG.check()
+	s := wr.stream.stats
+	switch w := wr.write.(type) {
+	case *writeData:
+		atomic.AddInt64(&s.BytesSent, frameHeaderLen+int64(len(w.p)))
+		atomic.AddInt64(&s.DataBytesSent, int64(len(w.p)))
+	case *writeResHeaders:
+		sc.noteHeadersWritten(s, 0, w.fieldBytes)
+	case *writePushPromise:
+		sc.noteHeadersWritten(s, 4, w.fieldBytes) // promised stream ID
+	case write100ContinueHeadersFrame:
+		sc.noteHeadersWritten(s, 0, len(":status")+len("100"))
+	case StreamError, writeWindowUpdate:
+		atomic.AddInt64(&s.BytesSent, frameHeaderLen+4)
+	}
+}
+
+// noteHeadersWritten counts the header block that was just written
+// from sc.headerWriteBuf, split by splitHeaderBlock, with extra bytes
+// in the first frame.
+func (sc *serverConn) noteHeadersWritten(s *StreamStats, extra, fieldBytes int) {
+	const maxFrameSize = 16384 // as in splitHeaderBlock
+	n := sc.headerWriteBuf.Len()
+	frames := (n + maxFrameSize - 1) / maxFrameSize
+	if frames == 0 {
+		frames = 1
+	}
+	atomic.AddInt64(&s.BytesSent, int64(n+extra+frames*frameHeaderLen))
+	atomic.AddInt64(&s.HeaderBytesSent, int64(n))
+	atomic.AddInt64(&s.FieldBytesSent, int64(fieldBytes))
+}
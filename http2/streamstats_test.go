@@ -0,0 +1,95 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestServerStreamStats(t *testing.T) {
+	const body = "request body"
+	const resBody = "response body"
+	ctxc := make(chan context.Context, 1)
+	gotStats := make(chan StreamStats, 1)
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		stats, ok := StreamStatsFromContext(r.Context())
+		if !ok {
+			t.Error("StreamStatsFromContext reported false in a handler")
+		}
+		gotStats <- stats
+		ctxc <- r.Context()
+		w.Header().Set("X-Response", "value")
+		w.Write([]byte(resBody))
+	})
+	defer st.Close()
+	st.greet()
+
+	block := st.encodeHeader(":method", "POST", "x-request", "some value")
+	wantFields := int64(0)
+	for _, kv := range [][2]string{
+		{":method", "POST"},
+		{":scheme", "https"},
+		{":authority", st.ts.Listener.Addr().String()},
+		{":path", "/"},
+		{"x-request", "some value"},
+	} {
+		wantFields += int64(len(kv[0]) + len(kv[1]))
+	}
+	st.writeHeaders(HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block,
+		EndHeaders:    true,
+	})
+	st.writeDataPadded(1, false, []byte(body[:4]), make([]byte, 10))
+	st.writeData(1, true, []byte(body[4:]))
+
+	want := StreamStats{
+		BytesReceived:       int64(3*frameHeaderLen + len(block) + len(body) + 1 + 10),
+		DataBytesReceived:   int64(len(body)),
+		HeaderBytesReceived: int64(len(block)),
+		FieldBytesReceived:  wantFields,
+	}
+	if got := <-gotStats; got != want {
+		t.Errorf("stats in handler = %+v; want %+v", got, want)
+	}
+
+	resBlock := st.wantHeaders().HeaderBlockFragment()
+	var sentFields int64
+	st.hpackDec.SetEmitFunc(func(f hpack.HeaderField) {
+		sentFields += int64(len(f.Name) + len(f.Value))
+	})
+	st.decodeHeader(resBlock)
+	st.hpackDec.SetEmitFunc(st.onHeaderField)
+	df := st.wantData()
+	if !df.StreamEnded() {
+		t.Fatal("expected END_STREAM on DATA frame")
+	}
+	// The PING ACK is written after the serve loop has accounted
+	// for the previous frames.
+	st.writeReadPing()
+
+	want.BytesSent = int64(2*frameHeaderLen + len(resBlock) + len(resBody))
+	want.DataBytesSent = int64(len(resBody))
+	want.HeaderBytesSent = int64(len(resBlock))
+	want.FieldBytesSent = sentFields
+	if got, _ := StreamStatsFromContext(<-ctxc); got != want {
+		t.Errorf("stats after response = %+v; want %+v", got, want)
+	}
+	if want.FieldBytesReceived <= want.HeaderBytesReceived {
+		t.Errorf("no header compression saving: %d encoded bytes for %d bytes of fields", want.HeaderBytesReceived, want.FieldBytesReceived)
+	}
+}
+
+func TestStreamStatsFromContextNotHTTP2(t *testing.T) {
+	if _, ok := StreamStatsFromContext(context.Background()); ok {
+		t.Error("StreamStatsFromContext reported true for a background context")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A ValidationError describes a header field of a message which breaks
+// the rules of HTTP/2 in a way that an HTTP/1 peer could interpret
+// differently, as found by the strict validation of a Server or a
+// Transport. See Server.StrictValidation and Transport.StrictValidation.
+type ValidationError struct {
+	StreamID uint32
+	Field    string // canonical name of the header field, such as "Content-Length"
+	Reason   string
+
+	// Sanitized reports whether the field was removed from the message,
+	// rather than the message rejected.
+	Sanitized bool
+}
+
+func (e *ValidationError) Error() string {
+	action := "rejected"
+	if e.Sanitized {
+		action = "removed"
+	}
+	return fmt.Sprintf("http2: stream %d: header field %q %s: %s", e.StreamID, e.Field, action, e.Reason)
+}
+
+// strictCheckFields returns the first header field of h which is
+// connection-specific or has a value with leading or trailing white
+// space, or nil.
+func strictCheckFields(streamID uint32, h http.Header) *ValidationError {
+	for _, k := range connHeaders {
+		if _, ok := h[k]; ok {
+			return &ValidationError{StreamID: streamID, Field: k, Reason: "connection-specific header field"}
+		}
+	}
+	for k, vv := range h {
+		for _, v := range vv {
+			if v != strings.Trim(v, " \t") {
+				return &ValidationError{StreamID: streamID, Field: k, Reason: "leading or trailing white space"}
+			}
+		}
+	}
+	return nil
+}
+
+// strictCheckContentLength checks the Content-Length header field of h,
+// for a message whose stream ended with its headers if ended.
+func strictCheckContentLength(streamID uint32, h http.Header, ended bool) *ValidationError {
+	vv, ok := h["Content-Length"]
+	if !ok {
+		return nil
+	}
+	reason := ""
+	if len(vv) > 1 {
+		reason = "several values"
+	} else if n, err := strconv.ParseUint(vv[0], 10, 63); err != nil {
+		reason = "invalid value"
+	} else if ended && n > 0 {
+		reason = "non-zero length without a body"
+	} else {
+		return nil
+	}
+	return &ValidationError{StreamID: streamID, Field: "Content-Length", Reason: reason}
+}
+
+// strictCheckRequest checks the header fields of a request, whose stream
+// ended with its headers if ended.
+func strictCheckRequest(streamID uint32, req *http.Request, ended bool) *ValidationError {
+	if err := strictCheckFields(streamID, req.Header); err != nil {
+		return err
+	}
+	if vv, ok := req.Header["Host"]; ok && (len(vv) > 1 || !asciiEqualFold(vv[0], req.Host)) {
+		return &ValidationError{StreamID: streamID, Field: "Host", Reason: "does not match :authority"}
+	}
+	return strictCheckContentLength(streamID, req.Header, ended)
+}
+
+// strictCheckResponse checks the header fields of a response, whose stream
+// ended with its headers if ended. 1xx responses are not checked for
+// their Content-Length.
+func strictCheckResponse(streamID uint32, res *http.Response, ended bool) *ValidationError {
+	if err := strictCheckFields(streamID, res.Header); err != nil {
+		return err
+	}
+	if res.StatusCode < 200 {
+		return nil
+	}
+	return strictCheckContentLength(streamID, res.Header, ended && res.StatusCode != http.StatusNotModified)
+}
+
+// strictSanitize removes the connection-specific header fields of h,
+// including those listed by its Connection header field, and returns
+// their names.
+func strictSanitize(h http.Header) []string {
+	var removed []string
+	for _, v := range h["Connection"] {
+		foreachHeaderElement(v, func(f string) {
+			k := http.CanonicalHeaderKey(f)
+			if _, ok := h[k]; ok {
+				delete(h, k)
+				removed = append(removed, k)
+			}
+		})
+	}
+	for _, k := range connHeaders {
+		if _, ok := h[k]; ok && k != "Connection" {
+			delete(h, k)
+			removed = append(removed, k)
+		}
+	}
+	return removed
+}
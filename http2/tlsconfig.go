@@ -0,0 +1,128 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"crypto/tls"
+)
+
+// A FallbackPolicy selects what ConfigureTLSConfig does with a TLS
+// configuration which does not permit HTTP/2.
+type FallbackPolicy int
+
+const (
+	// FallbackHTTP1 stops advertising HTTP/2, so that the connections
+	// use HTTP/1.1.
+	FallbackHTTP1 FallbackPolicy = iota
+
+	// RequireHTTP2 fails closed: a configuration which permits HTTP/2
+	// only advertises HTTP/2, so that the handshakes with peers which
+	// do not support it fail, and for one which does not,
+	// ConfigureTLSConfig returns the violation and leaves it unchanged.
+	RequireHTTP2
+)
+
+// A TLSConfigError describes how a tls.Config violates the requirements
+// of HTTP/2 on TLS, of Section 9.2 of RFC 9113.
+type TLSConfigError struct {
+	// Field is the field of the tls.Config at fault, such as
+	// "CipherSuites".
+	Field string
+
+	// CipherSuites lists the cipher suites at fault, if any.
+	CipherSuites []uint16
+
+	// Reason describes the violation.
+	Reason string
+}
+
+func (e *TLSConfigError) Error() string {
+	return "http2: TLSConfig." + e.Field + " " + e.Reason
+}
+
+// ValidateTLSConfig reports, as a *TLSConfigError, whether the TLS
+// configuration c does not permit HTTP/2: if it only enables versions
+// older than TLS 1.2, or if the cipher suites it enables for TLS 1.2 are
+// all prohibited by Appendix A of RFC 9113, or miss those which Section
+// 9.2.2 requires. The cipher suites of TLS 1.3 are all permitted.
+func ValidateTLSConfig(c *tls.Config) error {
+	if c.MaxVersion != 0 && c.MaxVersion < tls.VersionTLS12 {
+		return &TLSConfigError{
+			Field:  "MaxVersion",
+			Reason: "is older than TLS 1.2, as HTTP/2 requires",
+		}
+	}
+	return validateCipherSuites(c)
+}
+
+// validateCipherSuites checks the TLS 1.0–1.2 cipher suites of c, if
+// configured, for HTTP/2.
+func validateCipherSuites(c *tls.Config) error {
+	if c.CipherSuites == nil || c.MinVersion >= tls.VersionTLS13 {
+		return nil
+	}
+	permitted := false
+	for _, cs := range c.CipherSuites {
+		if !isBadCipher(cs) {
+			permitted = true
+			break
+		}
+	}
+	if !permitted && c.MaxVersion == tls.VersionTLS12 {
+		return &TLSConfigError{
+			Field:        "CipherSuites",
+			CipherSuites: c.CipherSuites,
+			Reason:       "only has cipher suites prohibited by RFC 9113, Appendix A",
+		}
+	}
+	// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 is an alternative to the
+	// one required, so as not to discourage ECDSA-only servers. See
+	// http://golang.org/cl/30721 for further information.
+	for _, cs := range c.CipherSuites {
+		switch cs {
+		case tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:
+			return nil
+		}
+	}
+	return &TLSConfigError{
+		Field:  "CipherSuites",
+		Reason: "is missing an HTTP/2-required AES_128_GCM_SHA256 cipher (need at least one of TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)",
+	}
+}
+
+// ConfigureTLSConfig prepares the TLS configuration c of a client or a
+// server for HTTP/2. If c permits HTTP/2, as checked by
+// ValidateTLSConfig, its NextProtos advertises "h2" before "http/1.1",
+// or without "http/1.1" with the RequireHTTP2 policy; the other
+// protocols are kept, after them. Otherwise, with the FallbackHTTP1
+// policy, its NextProtos advertises "http/1.1" without "h2", and with the
+// RequireHTTP2 policy, ConfigureTLSConfig leaves c unchanged and returns
+// the violation.
+//
+// ConfigureServer and ConfigureTransports add "h2" to the NextProtos of
+// their TLS configuration themselves, after those already configured;
+// ConfigureTLSConfig may be called after them to apply a policy.
+func ConfigureTLSConfig(c *tls.Config, policy FallbackPolicy) error {
+	err := ValidateTLSConfig(c)
+	if err != nil && policy == RequireHTTP2 {
+		return err
+	}
+	var protos []string
+	switch {
+	case err != nil:
+		protos = []string{"http/1.1"}
+	case policy == RequireHTTP2:
+		protos = []string{NextProtoTLS}
+	default:
+		protos = []string{NextProtoTLS, "http/1.1"}
+	}
+	for _, p := range c.NextProtos {
+		if p != NextProtoTLS && p != "http/1.1" {
+			protos = append(protos, p)
+		}
+	}
+	c.NextProtos = protos
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http2
+
+import (
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTLSConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      *tls.Config
+		wantField string
+	}{
+		{"zero", &tls.Config{}, ""},
+		{"tls12", &tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12}, ""},
+		{"tls11", &tls.Config{MaxVersion: tls.VersionTLS11}, "MaxVersion"},
+		{
+			"required cipher",
+			&tls.Config{CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}},
+			"",
+		},
+		{
+			"missing required cipher",
+			&tls.Config{CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}},
+			"CipherSuites",
+		},
+		{
+			"prohibited ciphers",
+			&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA}},
+			"CipherSuites",
+		},
+		{
+			"tls13 ignores ciphers",
+			&tls.Config{MinVersion: tls.VersionTLS13, CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA}},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		err := ValidateTLSConfig(tt.conf)
+		var ce *TLSConfigError
+		if err != nil && !errors.As(err, &ce) {
+			t.Errorf("%s: error %v is not a *TLSConfigError", tt.name, err)
+			continue
+		}
+		got := ""
+		if ce != nil {
+			got = ce.Field
+		}
+		if got != tt.wantField {
+			t.Errorf("%s: error %v, want one of field %q", tt.name, err, tt.wantField)
+		}
+	}
+}
+
+func TestConfigureTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *tls.Config
+		policy  FallbackPolicy
+		want    []string
+		wantErr bool
+	}{
+		{"empty", &tls.Config{}, FallbackHTTP1, []string{"h2", "http/1.1"}, false},
+		{
+			"reorder",
+			&tls.Config{NextProtos: []string{"http/1.1", "acme-tls/1", "h2"}},
+			FallbackHTTP1,
+			[]string{"h2", "http/1.1", "acme-tls/1"},
+			false,
+		},
+		{
+			"require",
+			&tls.Config{NextProtos: []string{"http/1.1"}},
+			RequireHTTP2,
+			[]string{"h2"},
+			false,
+		},
+		{
+			"fallback",
+			&tls.Config{MaxVersion: tls.VersionTLS11, NextProtos: []string{"h2", "http/1.1"}},
+			FallbackHTTP1,
+			[]string{"http/1.1"},
+			false,
+		},
+		{
+			"fail closed",
+			&tls.Config{MaxVersion: tls.VersionTLS11, NextProtos: []string{"h2", "http/1.1"}},
+			RequireHTTP2,
+			[]string{"h2", "http/1.1"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		err := ConfigureTLSConfig(tt.conf, tt.policy)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(tt.conf.NextProtos, tt.want) {
+			t.Errorf("%s: NextProtos = %q, want %q", tt.name, tt.conf.NextProtos, tt.want)
+		}
+	}
+}
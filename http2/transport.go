@@ -146,6 +146,19 @@ type Transport struct {
 	// waiting for their turn.
 	StrictMaxConcurrentStreams bool
 
+	// StreamQueueTimeout, if non-zero, is the maximum amount of time
+	// a request waits for its turn when StrictMaxConcurrentStreams is
+	// set and the server's SETTINGS_MAX_CONCURRENT_STREAMS is reached.
+	// Waiting requests are queued on their connection, and RoundTrip
+	// returns ErrStreamQueueTimeout for a request still queued after
+	// StreamQueueTimeout. If zero, requests wait until their context
+	// is done, in no particular order.
+	StreamQueueTimeout time.Duration
+
+	// StreamQueueOrder is the order in which queued requests are sent
+	// when StreamQueueTimeout is set. The default is StreamQueueFIFO.
+	StreamQueueOrder StreamQueueOrder
+
 	// ReadIdleTimeout is the timeout after which a health check using ping
 	// frame will be carried out if no frame is received on the connection.
 	// Note that a ping response will is considered a received frame, so if
@@ -164,12 +177,99 @@ type Transport struct {
 	// available to write, and is extended whenever any bytes are written.
 	WriteByteTimeout time.Duration
 
+	// ResponseHeaderTimeout, if non-zero, specifies the amount of time
+	// to wait for a server's response headers after fully writing the
+	// request (including its body, if any). The stream is reset with
+	// RST_STREAM when it expires. If zero, the ResponseHeaderTimeout of
+	// the http.Transport configured by ConfigureTransport is used.
+	ResponseHeaderTimeout time.Duration
+
+	// MaxStreamDuration, if non-zero, is the maximum amount of time a
+	// stream may stay open, from when its request headers are sent
+	// until the server ends the stream. A stream still open past it,
+	// such as one whose server stalls during the response body, is
+	// reset with RST_STREAM and the pending reads of the response body
+	// fail with a timeout error. Unlike the context of the request, it
+	// applies to every request made with the Transport.
+	MaxStreamDuration time.Duration
+
+	// HostConnPolicy, if non-nil, returns the policy of the connections
+	// of the connection pool to addr, of the form "host:port", such as a
+	// shorter idle timeout for some hosts. It is called once per
+	// connection.
+	HostConnPolicy func(addr string) ConnPolicy
+
+	// AllowConnReuse, if non-nil, reports whether a connection which has
+	// already sent requests may take another one. A connection it refuses
+	// takes no new requests, and is closed once its streams are done.
+	// It allows recycling connections after a number of requests or a
+	// length of time, since long-lived connections pin their load to a
+	// single backend behind a layer 4 load balancer. It is called with
+	// the connection locked, and must not call the methods of the
+	// connection.
+	AllowConnReuse func(ConnReuseInfo) bool
+
 	// CountError, if non-nil, is called on HTTP/2 transport errors.
 	// It's intended to increment a metric for monitoring, such
 	// as an expvar or Prometheus metric.
 	// The errType consists of only ASCII word characters.
 	CountError func(errType string)
 
+	// StrictValidation makes the transport reject, with a stream error,
+	// the responses whose header fields an HTTP/1 client could interpret
+	// differently, as matters when forwarding them to one: those with a
+	// connection-specific header field, several or invalid Content-Length
+	// values, a non-zero Content-Length without a body, or a field value
+	// with leading or trailing white space.
+	StrictValidation bool
+
+	// ValidationErrorHook, if non-nil, is called with each error found by
+	// StrictValidation, for instance to log or count them.
+	ValidationErrorHook func(*ValidationError)
+
+	// FramePadding, if non-nil, selects the padding of the DATA and
+	// HEADERS frames written. See PadToMultiple and PadRandom.
+	FramePadding PaddingFunc
+
+	// OnExtensionFrame, if non-nil, is called with the frames of the
+	// extension types received, which the transport otherwise ignores,
+	// and their connection, to send extension frames on it with
+	// WriteExtensionFrame. It is called by the goroutine reading the
+	// connection and must not block; the payload of f must not be used
+	// once it returns.
+	OnExtensionFrame func(cc *ClientConn, f *UnknownFrame)
+
+	// OnGoAway, if non-nil, is called with each GOAWAY frame received,
+	// with the address of its connection, of the form "host:port", its
+	// error code and its debug data, so that the server may be marked
+	// as draining, or unhealthy for a code other than ErrCodeNo, before
+	// the requests sent to it fail. The address is that dialed by the
+	// Transport, or the remote address of a connection created with
+	// NewClientConn, if any. It is called by the goroutine reading the
+	// connection, before the requests the server did not process are
+	// failed, and must not block.
+	OnGoAway func(addr string, code ErrCode, debugData []byte)
+
+	// CoalesceRequests, if true, makes the concurrent identical GET and
+	// HEAD requests without body share one stream, so that a burst of
+	// them loads the server once. The requests whose Cache-Control or
+	// Pragma header asks for a response from the origin server, such as
+	// with no-cache, are not coalesced. The requests are identical if
+	// their URL, Host and headers are. The response is shared unless it
+	// is private, no-store, or sets cookies, in which case only one of
+	// the requests gets it, and the others are sent again, on their own.
+	//
+	// The body of a response shared is buffered from the offset of the
+	// slowest request reading it, and its trailers are not reported. The
+	// requests which fall behind the others by more than 1MB fail to
+	// read it further, and each stops reading it once its context is done. The
+	// stream is canceled once all the requests sharing it are, but it is
+	// not sent with the context of any: its values, such as an
+	// httptrace.ClientTrace, are not used.
+	CoalesceRequests bool
+
+	coalescer coalescer
+
 	// t1, if non-nil, is the standard library Transport using
 	// this transport. Its settings are used (but not its
 	// RoundTrip method, etc).
@@ -286,6 +386,37 @@ func (t *Transport) initConnPool() {
 	}
 }
 
+// A ConnPolicy holds the settings of the connections to a host. See
+// Transport.HostConnPolicy.
+type ConnPolicy struct {
+	// IdleConnTimeout, if non-zero, overrides the idle timeout of the
+	// connections, taken from the http.Transport configured by
+	// ConfigureTransport. A negative value means no timeout.
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns, if non-zero, is the maximum number of idle
+	// connections to the host kept by the default connection pool.
+	// Connections are closed when they become idle beyond it.
+	MaxIdleConns int
+}
+
+// ConnReuseInfo describes a connection for Transport.AllowConnReuse.
+type ConnReuseInfo struct {
+	// Addr is the address of the connection in the connection pool, of
+	// the form "host:port", or empty for a connection created by
+	// NewClientConn.
+	Addr string
+
+	// Created is when the connection was created.
+	Created time.Time
+
+	// Requests is how many requests the connection has sent.
+	Requests int
+
+	// StreamsActive is how many streams are active.
+	StreamsActive int
+}
+
 // ClientConn is the state of a single HTTP/2 client connection to an
 // HTTP/2 server.
 type ClientConn struct {
@@ -296,6 +427,9 @@ type ClientConn struct {
 	reused        uint32               // whether conn is being reused; atomic
 	singleUse     bool                 // whether being used for a single http.Request
 	getConnCalled bool                 // used by clientConnPool
+	addr          string               // dialed address, if any
+	policy        ConnPolicy           // from Transport.HostConnPolicy
+	created       time.Time
 
 	// readLoop goroutine fields:
 	readerDone chan struct{} // closed on error
@@ -304,25 +438,31 @@ type ClientConn struct {
 	idleTimeout time.Duration // or 0 for never
 	idleTimer   *time.Timer
 
-	mu              sync.Mutex // guards following
-	cond            *sync.Cond // hold mu; broadcast on flow/closed changes
-	flow            outflow    // our conn-level flow control quota (cs.outflow is per stream)
-	inflow          inflow     // peer's conn-level flow control
-	doNotReuse      bool       // whether conn is marked to not be reused for any future requests
-	closing         bool
-	closed          bool
-	seenSettings    bool                     // true if we've seen a settings frame, false otherwise
-	wantSettingsAck bool                     // we sent a SETTINGS frame and haven't heard back
-	goAway          *GoAwayFrame             // if non-nil, the GoAwayFrame we received
-	goAwayDebug     string                   // goAway frame's debug data, retained as a string
-	streams         map[uint32]*clientStream // client-initiated
-	streamsReserved int                      // incr by ReserveNewRequest; decr on RoundTrip
-	nextStreamID    uint32
-	pendingRequests int                       // requests blocked and waiting to be sent because len(streams) == maxConcurrentStreams
-	pings           map[[8]byte]chan struct{} // in flight ping data to notification channel
-	br              *bufio.Reader
-	lastActive      time.Time
-	lastIdle        time.Time // time last idle
+	mu                  sync.Mutex // guards following
+	cond                *sync.Cond // hold mu; broadcast on flow/closed changes
+	flow                outflow    // our conn-level flow control quota (cs.outflow is per stream)
+	inflow              inflow     // peer's conn-level flow control
+	doNotReuse          bool       // whether conn is marked to not be reused for any future requests
+	closing             bool
+	closed              bool
+	seenSettings        bool                     // true if we've seen a settings frame, false otherwise
+	wantSettingsAck     bool                     // we sent a SETTINGS frame and haven't heard back
+	goAway              *GoAwayFrame             // if non-nil, the GoAwayFrame we received
+	goAwayDebug         string                   // goAway frame's debug data, retained as a string
+	streams             map[uint32]*clientStream // client-initiated
+	streamsReserved     int                      // incr by ReserveNewRequest; decr on RoundTrip
+	nextStreamID        uint32
+	pendingRequests     int                       // requests blocked and waiting to be sent because len(streams) == maxConcurrentStreams
+	streamQueue         []*streamWaiter           // requests waiting for a stream slot, if Transport.StreamQueueTimeout is set
+	streamQueueSeq      uint64                    // sequence number of the next request queued
+	streamsGranted      int                       // slots granted to queued requests which have not added their stream yet
+	streamQueueMax      int                       // largest len(streamQueue) seen
+	streamQueueTimeouts uint64                    // requests which failed with ErrStreamQueueTimeout
+	pings               map[[8]byte]chan struct{} // in flight ping data to notification channel
+	br                  *bufio.Reader
+	lastActive          time.Time
+	lastIdle            time.Time // time last idle
+	requests            int       // streams created
 	// Settings from peer: (also guarded by wmu)
 	maxFrameSize           uint32
 	maxConcurrentStreams   uint32
@@ -384,6 +524,7 @@ type clientStream struct {
 	// owned by writeRequest:
 	sentEndStream bool // sent an END_STREAM flag to the peer
 	sentHeaders   bool
+	queuedSlot    bool // guarded by cc.mu; holds a slot granted by awaitQueuedSlot
 
 	// owned by clientConnReadLoop:
 	firstByte    bool  // got the first response byte
@@ -548,6 +689,17 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 	if !(req.URL.Scheme == "https" || (req.URL.Scheme == "http" && t.AllowHTTP)) {
 		return nil, errors.New("http2: unsupported scheme")
 	}
+	if t.CoalesceRequests {
+		if key, ok := coalesceKey(req); ok {
+			return t.coalescer.roundTrip(key, req, func(req *http.Request) (*http.Response, error) {
+				return t.roundTripOpt(req, opt)
+			})
+		}
+	}
+	return t.roundTripOpt(req, opt)
+}
+
+func (t *Transport) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
 
 	addr := authorityAddr(req.URL.Scheme, req.URL.Host)
 	for retry := 0; ; retry++ {
@@ -599,11 +751,48 @@ func (t *Transport) CloseIdleConnections() {
 }
 
 var (
-	errClientConnClosed    = errors.New("http2: client conn is closed")
-	errClientConnUnusable  = errors.New("http2: client conn not usable")
-	errClientConnGotGoAway = errors.New("http2: Transport received Server's graceful shutdown GOAWAY")
+	errClientConnClosed   = &ClientConnError{msg: "http2: client conn is closed"}
+	errClientConnUnusable = &ClientConnError{msg: "http2: client conn not usable", Retryable: true}
 )
 
+// A ClientConnError is returned by the Transport and ClientConn when a
+// request fails because of its connection: when it is unusable, closed
+// or lost to a PING timeout, or when the server refuses the request with
+// a GOAWAY frame. When the connection is lost while reading from it, the
+// requests fail with the read error instead, io.ErrUnexpectedEOF at its
+// end, or with a GoAwayError if the server sent a GOAWAY frame first.
+type ClientConnError struct {
+	// Retryable reports whether the server did not process the
+	// request, which may then be sent again on another connection,
+	// with a new body if it has one.
+	Retryable bool
+
+	// GoAway is the GOAWAY frame received, if the server refused the
+	// request with one.
+	GoAway *GoAwayError
+
+	// StreamID is the ID of the stream of the request, or 0 if the
+	// request was not sent on the connection.
+	StreamID uint32
+
+	msg string
+}
+
+func (e *ClientConnError) Error() string {
+	if e.GoAway != nil {
+		return fmt.Sprintf("%s; LastStreamID=%v, ErrCode=%v, debug=%q",
+			e.msg, e.GoAway.LastStreamID, e.GoAway.ErrCode, e.GoAway.DebugData)
+	}
+	return e.msg
+}
+
+// forStream returns a copy of e for the request of stream id.
+func (e *ClientConnError) forStream(id uint32) *ClientConnError {
+	e2 := *e
+	e2.StreamID = id
+	return &e2
+}
+
 // shouldRetryRequest is called by RoundTrip when a request fails to get
 // response headers. It is always called with a non-nil error.
 // It returns either a request to retry (either the same request, or a
@@ -637,19 +826,19 @@ func shouldRetryRequest(req *http.Request, err error) (*http.Request, error) {
 		return req, nil
 	}
 
-	return nil, fmt.Errorf("http2: Transport: cannot retry err [%v] after Request.Body was written; define Request.GetBody to avoid this error", err)
+	return nil, fmt.Errorf("http2: Transport: cannot retry err [%w] after Request.Body was written; define Request.GetBody to avoid this error", err)
 }
 
 func canRetryError(err error) bool {
-	if err == errClientConnUnusable || err == errClientConnGotGoAway {
-		return true
+	if e, ok := err.(*ClientConnError); ok {
+		return e.Retryable
 	}
 	if se, ok := err.(StreamError); ok {
 		if se.Code == ErrCodeProtocol && se.Cause == errFromPeer {
 			// See golang/go#47635, golang/go#42777
 			return true
 		}
-		return se.Code == ErrCodeRefusedStream
+		return se.Retryable()
 	}
 	return false
 }
@@ -663,7 +852,7 @@ func (t *Transport) dialClientConn(ctx context.Context, addr string, singleUse b
 	if err != nil {
 		return nil, err
 	}
-	return t.newClientConn(tconn, singleUse)
+	return t.newClientConn(tconn, addr, singleUse)
 }
 
 func (t *Transport) newTLSConfig(host string) *tls.Config {
@@ -677,6 +866,9 @@ func (t *Transport) newTLSConfig(host string) *tls.Config {
 	if cfg.ServerName == "" {
 		cfg.ServerName = host
 	}
+	// RFC 8740 and RFC 9113, Section 9.2.1 forbid renegotiation, which a
+	// configuration shared with HTTP/1.1 connections may allow.
+	cfg.Renegotiation = tls.RenegotiateNever
 	return cfg
 }
 
@@ -729,13 +921,17 @@ func (t *Transport) maxEncoderHeaderTableSize() uint32 {
 }
 
 func (t *Transport) NewClientConn(c net.Conn) (*ClientConn, error) {
-	return t.newClientConn(c, t.disableKeepAlives())
+	return t.newClientConn(c, "", t.disableKeepAlives())
 }
 
-func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, error) {
+// newClientConn returns a ClientConn on c, which is a connection to addr
+// of the connection pool if addr is not empty.
+func (t *Transport) newClientConn(c net.Conn, addr string, singleUse bool) (*ClientConn, error) {
 	cc := &ClientConn{
 		t:                     t,
 		tconn:                 c,
+		addr:                  addr,
+		created:               time.Now(),
 		readerDone:            make(chan struct{}),
 		nextStreamID:          1,
 		maxFrameSize:          16 << 10,                    // spec default
@@ -748,7 +944,14 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		pings:                 make(map[[8]byte]chan struct{}),
 		reqHeaderMu:           make(chan struct{}, 1),
 	}
-	if d := t.idleConnTimeout(); d != 0 {
+	if addr != "" && t.HostConnPolicy != nil {
+		cc.policy = t.HostConnPolicy(addr)
+	}
+	d := t.idleConnTimeout()
+	if cc.policy.IdleConnTimeout != 0 {
+		d = cc.policy.IdleConnTimeout
+	}
+	if d > 0 {
 		cc.idleTimeout = d
 		cc.idleTimer = time.AfterFunc(d, cc.onIdleTimeout)
 	}
@@ -857,11 +1060,21 @@ func (cc *ClientConn) setGoAway(f *GoAwayFrame) {
 		cc.goAway.ErrCode = old.ErrCode
 	}
 	last := f.LastStreamID
+	err := &ClientConnError{
+		msg:       "http2: Transport received Server's graceful shutdown GOAWAY",
+		Retryable: true,
+		GoAway: &GoAwayError{
+			LastStreamID: last,
+			ErrCode:      cc.goAway.ErrCode,
+			DebugData:    cc.goAwayDebug,
+		},
+	}
 	for streamID, cs := range cc.streams {
 		if streamID > last {
-			cs.abortStreamLocked(errClientConnGotGoAway)
+			cs.abortStreamLocked(err.forStream(streamID))
 		}
 	}
+	cc.grantQueuedSlotsLocked()
 }
 
 // CanTakeNewRequest reports whether the connection can take a new request,
@@ -911,6 +1124,15 @@ type ClientConnState struct {
 	// are waiting for other streams to complete.
 	StreamsPending int
 
+	// StreamsPendingMax is the largest number of requests which have
+	// waited in the stream queue at once. It is only tracked when
+	// Transport.StreamQueueTimeout is set.
+	StreamsPendingMax int
+
+	// StreamQueueTimeouts is how many requests have failed with
+	// ErrStreamQueueTimeout.
+	StreamQueueTimeouts uint64
+
 	// MaxConcurrentStreams is how many concurrent streams the
 	// peer advertised as acceptable. Zero means no SETTINGS
 	// frame has been received yet.
@@ -938,6 +1160,8 @@ func (cc *ClientConn) State() ClientConnState {
 		StreamsActive:        len(cc.streams),
 		StreamsReserved:      cc.streamsReserved,
 		StreamsPending:       cc.pendingRequests,
+		StreamsPendingMax:    cc.streamQueueMax,
+		StreamQueueTimeouts:  cc.streamQueueTimeouts,
 		LastIdle:             cc.lastIdle,
 		MaxConcurrentStreams: maxConcurrent,
 	}
@@ -974,9 +1198,29 @@ func (cc *ClientConn) idleStateLocked() (st clientConnIdleState) {
 		!cc.doNotReuse &&
 		int64(cc.nextStreamID)+2*int64(cc.pendingRequests) < math.MaxInt32 &&
 		!cc.tooIdleLocked()
+	if st.canTakeNewRequest && !cc.reuseAllowedLocked() {
+		st.canTakeNewRequest = false
+		cc.doNotReuse = true
+		// The connection may be idle already.
+		go cc.closeIfIdle()
+	}
 	return
 }
 
+// reuseAllowedLocked reports whether Transport.AllowConnReuse lets cc,
+// if it has sent requests, take another one.
+func (cc *ClientConn) reuseAllowedLocked() bool {
+	if cc.t.AllowConnReuse == nil || cc.requests == 0 {
+		return true
+	}
+	return cc.t.AllowConnReuse(ConnReuseInfo{
+		Addr:          cc.addr,
+		Created:       cc.created,
+		Requests:      cc.requests,
+		StreamsActive: len(cc.streams),
+	})
+}
+
 func (cc *ClientConn) canTakeNewRequestLocked() bool {
 	st := cc.idleStateLocked()
 	return st.canTakeNewRequest
@@ -1037,6 +1281,13 @@ func (cc *ClientConn) closeIfIdle() {
 	cc.closeConn()
 }
 
+// isIdle reports whether cc is open and has no streams nor reservations.
+func (cc *ClientConn) isIdle() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return !cc.closed && len(cc.streams) == 0 && cc.streamsReserved == 0
+}
+
 func (cc *ClientConn) isDoNotReuseAndIdle() bool {
 	cc.mu.Lock()
 	defer cc.mu.Unlock()
@@ -1109,11 +1360,11 @@ func (cc *ClientConn) sendGoAway() error {
 
 // closes the client connection immediately. In-flight requests are interrupted.
 // err is sent to streams.
-func (cc *ClientConn) closeForError(err error) {
+func (cc *ClientConn) closeForError(err *ClientConnError) {
 	cc.mu.Lock()
 	cc.closed = true
-	for _, cs := range cc.streams {
-		cs.abortStreamLocked(err)
+	for streamID, cs := range cc.streams {
+		cs.abortStreamLocked(err.forStream(streamID))
 	}
 	cc.cond.Broadcast()
 	cc.mu.Unlock()
@@ -1124,14 +1375,14 @@ func (cc *ClientConn) closeForError(err error) {
 //
 // In-flight requests are interrupted. For a graceful shutdown, use Shutdown instead.
 func (cc *ClientConn) Close() error {
-	err := errors.New("http2: client connection force closed via ClientConn.Close")
+	err := &ClientConnError{msg: "http2: client connection force closed via ClientConn.Close"}
 	cc.closeForError(err)
 	return nil
 }
 
 // closes the client connection immediately. In-flight requests are interrupted.
 func (cc *ClientConn) closeForLostPing() {
-	err := errors.New("http2: client connection lost")
+	err := &ClientConnError{msg: "http2: client connection lost"}
 	if f := cc.t.CountError; f != nil {
 		f("conn_close_lost_ping")
 	}
@@ -1160,6 +1411,9 @@ func commaSeparatedTrailers(req *http.Request) (string, error) {
 }
 
 func (cc *ClientConn) responseHeaderTimeout() time.Duration {
+	if cc.t.ResponseHeaderTimeout != 0 {
+		return cc.t.ResponseHeaderTimeout
+	}
 	if cc.t.t1 != nil {
 		return cc.t.t1.ResponseHeaderTimeout
 	}
@@ -1340,6 +1594,12 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 	if cc.reqHeaderMu == nil {
 		panic("RoundTrip on uninitialized ClientConn") // for tests
 	}
+	if cc.t != nil && cc.t.StrictMaxConcurrentStreams && cc.t.StreamQueueTimeout > 0 {
+		if err := cc.awaitQueuedSlot(cs); err != nil {
+			return err
+		}
+		defer cc.releaseQueuedSlot(cs)
+	}
 	select {
 	case cc.reqHeaderMu <- struct{}{}:
 	case <-cs.reqCancel:
@@ -1359,11 +1619,20 @@ func (cs *clientStream) writeRequest(req *http.Request) (err error) {
 		return err
 	}
 	cc.addStreamLocked(cs) // assigns stream ID
+	if cs.queuedSlot {
+		cs.queuedSlot = false
+		cc.streamsGranted--
+	}
 	if isConnectionCloseRequest(req) {
 		cc.doNotReuse = true
 	}
 	cc.mu.Unlock()
 
+	if d := cc.t.MaxStreamDuration; d > 0 {
+		timer := time.AfterFunc(d, func() { cs.abortStream(errStreamTimeout) })
+		defer timer.Stop()
+	}
+
 	// TODO(bradfitz): this is a copy of the logic in net/http. Unify somewhere?
 	if !cc.t.disableCompression() &&
 		req.Header.Get("Accept-Encoding") == "" &&
@@ -1622,11 +1891,13 @@ func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize
 		hdrs = hdrs[len(chunk):]
 		endHeaders := len(hdrs) == 0
 		if first {
+			pad := framePadding(cc.t.FramePadding, FrameHeaders, len(chunk), maxFrameSize-len(chunk)-1)
 			cc.fr.WriteHeaders(HeadersFrameParam{
 				StreamID:      streamID,
 				BlockFragment: chunk,
 				EndStream:     endStream,
 				EndHeaders:    endHeaders,
+				PadLength:     uint8(pad),
 			})
 			first = false
 		} else {
@@ -1743,11 +2014,12 @@ func (cs *clientStream) writeRequestBody(req *http.Request) (err error) {
 			if err != nil {
 				return err
 			}
+			pad := cs.takePadding(allowed)
 			cc.wmu.Lock()
 			data := remain[:allowed]
 			remain = remain[allowed:]
 			sentEnd = sawEOF && len(remain) == 0 && !hasTrailers
-			err = cc.fr.WriteData(cs.ID, sentEnd, data)
+			err = cc.fr.WriteDataPadded(cs.ID, sentEnd, data, pad)
 			if err == nil {
 				// TODO(bradfitz): this flush is for latency, not bandwidth.
 				// Most requests won't need this. Make this opt-in or
@@ -1846,6 +2118,27 @@ func (cs *clientStream) awaitFlowControl(maxBytes int) (taken int32, err error)
 	}
 }
 
+// takePadding returns the padding of a DATA frame carrying n bytes, as
+// selected by Transport.FramePadding, and takes its flow control tokens.
+func (cs *clientStream) takePadding(n int32) []byte {
+	cc := cs.cc
+	if cc.t.FramePadding == nil {
+		return nil
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	limit := cs.flow.available()
+	if max := int32(cc.maxFrameSize) - n; max < limit {
+		limit = max
+	}
+	pad := framePadding(cc.t.FramePadding, FrameData, int(n), int(limit)-1)
+	if pad == 0 {
+		return nil
+	}
+	cs.flow.take(int32(pad) + 1)
+	return make([]byte, pad)
+}
+
 var errNilRequestURL = errors.New("http2: Request.URI is nil")
 
 // requires cc.wmu be held.
@@ -2091,6 +2384,7 @@ func (cc *ClientConn) addStreamLocked(cs *clientStream) {
 	cs.inflow.init(transportDefaultStreamFlow)
 	cs.ID = cc.nextStreamID
 	cc.nextStreamID += 2
+	cc.requests++
 	cc.streams[cs.ID] = cs
 	if cs.ID == 0 {
 		panic("assigned stream ID 0")
@@ -2112,7 +2406,11 @@ func (cc *ClientConn) forgetStreamID(id uint32) {
 	// Wake up writeRequestBody via clientStream.awaitFlowControl and
 	// wake up RoundTrip if there is a pending request.
 	cc.cond.Broadcast()
+	cc.grantQueuedSlotsLocked()
 
+	if len(cc.streams) == 0 && !cc.doNotReuse && !cc.reuseAllowedLocked() {
+		cc.doNotReuse = true
+	}
 	closeOnIdle := cc.singleUse || cc.doNotReuse || cc.t.disableKeepAlives() || cc.goAway != nil
 	if closeOnIdle && cc.streamsReserved == 0 && len(cc.streams) == 0 {
 		if VerboseLogs {
@@ -2121,8 +2419,18 @@ func (cc *ClientConn) forgetStreamID(id uint32) {
 		cc.closed = true
 		defer cc.closeConn()
 	}
+	maxIdle := 0
+	if !cc.closed && len(cc.streams) == 0 {
+		maxIdle = cc.policy.MaxIdleConns
+	}
 
 	cc.mu.Unlock()
+
+	if maxIdle > 0 {
+		if p, ok := cc.t.connPool().(*clientConnPool); ok {
+			p.closeIfTooManyIdle(cc, maxIdle)
+		}
+	}
 }
 
 // clientConnReadLoop is the state owned by the clientConn's frame-reading readLoop.
@@ -2156,6 +2464,13 @@ func (e GoAwayError) Error() string {
 		e.LastStreamID, e.ErrCode, e.DebugData)
 }
 
+// Retryable reports whether a request which failed with e may be sent
+// again on another connection, as StreamError.Retryable does. It may
+// not: its stream is at most LastStreamID, so the server may have
+// processed it. The requests which the server refused with the GOAWAY
+// frame fail with a ClientConnError instead.
+func (e GoAwayError) Retryable() bool { return false }
+
 func isEOFOrNetReadError(err error) bool {
 	if err == io.EOF {
 		return true
@@ -2200,6 +2515,7 @@ func (rl *clientConnReadLoop) cleanup() {
 		}
 	}
 	cc.cond.Broadcast()
+	cc.grantQueuedSlotsLocked()
 	cc.mu.Unlock()
 }
 
@@ -2287,6 +2603,12 @@ func (rl *clientConnReadLoop) run() error {
 			err = rl.processWindowUpdate(f)
 		case *PingFrame:
 			err = rl.processPing(f)
+		case *UnknownFrame:
+			if cc.t.OnExtensionFrame == nil {
+				cc.logf("Transport: unhandled response frame type %T", f)
+				break
+			}
+			cc.t.OnExtensionFrame(cc, f)
 		default:
 			cc.logf("Transport: unhandled response frame type %T", f)
 		}
@@ -2414,6 +2736,18 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		}
 	}
 
+	if cs.cc.t.StrictValidation {
+		if err := strictCheckResponse(cs.ID, res, f.StreamEnded() && !cs.isHead); err != nil {
+			if f := cs.cc.t.CountError; f != nil {
+				f("strict_validation")
+			}
+			if f := cs.cc.t.ValidationErrorHook; f != nil {
+				f(err)
+			}
+			return nil, err
+		}
+	}
+
 	if statusCode >= 100 && statusCode <= 199 {
 		if f.StreamEnded() {
 			return nil, errors.New("1xx informational response with END_STREAM flag")
@@ -2775,6 +3109,13 @@ func (rl *clientConnReadLoop) processGoAway(f *GoAwayFrame) error {
 			fn("recv_goaway_" + f.ErrCode.stringToken())
 		}
 	}
+	if fn := cc.t.OnGoAway; fn != nil {
+		addr := cc.addr
+		if a := cc.tconn.RemoteAddr(); addr == "" && a != nil {
+			addr = a.String()
+		}
+		fn(addr, f.ErrCode, append([]byte(nil), f.DebugData()...))
+	}
 	cc.setGoAway(f)
 	return nil
 }
@@ -2860,6 +3201,7 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 		}
 		cc.seenSettings = true
 	}
+	cc.grantQueuedSlotsLocked()
 
 	return nil
 }
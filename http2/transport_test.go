@@ -270,6 +270,133 @@ func TestTransportReusesConns(t *testing.T) {
 	}
 }
 
+func TestTransportAllowConnReuse(t *testing.T) {
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}, optOnlyServer)
+	defer st.Close()
+	var infos []ConnReuseInfo
+	tr := &Transport{
+		TLSClientConfig: tlsConfigInsecure,
+		AllowConnReuse: func(ci ConnReuseInfo) bool {
+			infos = append(infos, ci)
+			return ci.Requests < 2
+		},
+	}
+	defer tr.CloseIdleConnections()
+	var addrs []string
+	for i := 0; i < 4; i++ {
+		res, err := tr.RoundTrip(httptest.NewRequest("GET", st.ts.URL, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slurp, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("Body read: %v", err)
+		}
+		addrs = append(addrs, string(slurp))
+	}
+	if addrs[0] != addrs[1] || addrs[1] == addrs[2] || addrs[2] != addrs[3] {
+		t.Errorf("requests sent from %q; want connections replaced after 2 requests", addrs)
+	}
+	for _, ci := range infos {
+		if ci.Addr == "" || ci.Created.IsZero() || ci.Requests == 0 {
+			t.Errorf("AllowConnReuse called with %+v; want its address, creation time and requests", ci)
+		}
+	}
+}
+
+func TestTransportHostConnPolicy(t *testing.T) {
+	t.Run("IdleConnTimeout", func(t *testing.T) {
+		st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {}, optOnlyServer)
+		defer st.Close()
+		var gotAddr string
+		tr := &Transport{
+			TLSClientConfig: tlsConfigInsecure,
+			HostConnPolicy: func(addr string) ConnPolicy {
+				gotAddr = addr
+				return ConnPolicy{IdleConnTimeout: 10 * time.Millisecond}
+			},
+		}
+		defer tr.CloseIdleConnections()
+		res, err := tr.RoundTrip(httptest.NewRequest("GET", st.ts.URL, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if want := st.ts.Listener.Addr().String(); gotAddr != want {
+			t.Errorf("HostConnPolicy called for %q; want %q", gotAddr, want)
+		}
+		if !waitCondition(5*time.Second, 10*time.Millisecond, func() bool {
+			return countClientConns(tr) == 0
+		}) {
+			t.Errorf("idle connection still open past its IdleConnTimeout")
+		}
+	})
+
+	t.Run("MaxIdleConns", func(t *testing.T) {
+		started := make(chan struct{}, 2)
+		release := make(chan struct{})
+		st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/wait" {
+				started <- struct{}{}
+				<-release
+			}
+		}, optOnlyServer, func(s *Server) {
+			s.MaxConcurrentStreams = 1
+		})
+		defer st.Close()
+		tr := &Transport{
+			TLSClientConfig: tlsConfigInsecure,
+			HostConnPolicy: func(addr string) ConnPolicy {
+				return ConnPolicy{MaxIdleConns: 1}
+			},
+		}
+		defer tr.CloseIdleConnections()
+		get := func(path string) error {
+			res, err := tr.RoundTrip(httptest.NewRequest("GET", st.ts.URL+path, nil))
+			if err != nil {
+				return err
+			}
+			return res.Body.Close()
+		}
+		// Learn the MaxConcurrentStreams of the server first, so that the
+		// concurrent requests use two connections.
+		if err := get("/"); err != nil {
+			t.Fatal(err)
+		}
+		errc := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errc <- get("/wait") }()
+			<-started
+		}
+		if n := countClientConns(tr); n != 2 {
+			t.Fatalf("%d connections for 2 concurrent requests; want 2", n)
+		}
+		close(release)
+		for i := 0; i < 2; i++ {
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !waitCondition(5*time.Second, 10*time.Millisecond, func() bool {
+			return countClientConns(tr) == 1
+		}) {
+			t.Errorf("%d idle connections kept; want 1", countClientConns(tr))
+		}
+	})
+}
+
+// countClientConns returns the number of connections of the default
+// connection pool of tr.
+func countClientConns(tr *Transport) int {
+	p := tr.connPool().(*clientConnPool)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
 func TestTransportGetGotConnHooks_HTTP2Transport(t *testing.T) {
 	testTransportGetGotConnHooks(t, false)
 }
@@ -2275,6 +2402,182 @@ func testTransportResponseHeaderTimeout(t *testing.T, body bool) {
 	ct.run()
 }
 
+// Issue the request with Transport.ResponseHeaderTimeout rather than the
+// ResponseHeaderTimeout of an http.Transport.
+func TestTransportResponseHeaderTimeout_Transport(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.ResponseHeaderTimeout = 5 * time.Millisecond
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		_, err := ct.tr.RoundTrip(req)
+		if !isTimeout(err) {
+			t.Errorf("client expected timeout error; got %#v", err)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				t.Logf("ReadFrame: %v", err)
+				return nil
+			}
+			if f, ok := f.(*RSTStreamFrame); ok && f.StreamID == 1 && f.ErrCode == ErrCodeCancel {
+				return nil
+			}
+		}
+	}
+	ct.run()
+}
+
+func TestTransportMaxStreamDuration(t *testing.T) {
+	ct := newClientTester(t)
+	ct.tr.MaxStreamDuration = 50 * time.Millisecond
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if _, err := io.ReadAll(res.Body); !isTimeout(err) {
+			t.Errorf("reading body: got %#v; want a timeout error", err)
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		var buf bytes.Buffer
+		enc := hpack.NewEncoder(&buf)
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				t.Logf("ReadFrame: %v", err)
+				return nil
+			}
+			switch f := f.(type) {
+			case *HeadersFrame:
+				// Send the response headers, then stall.
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      f.StreamID,
+					EndHeaders:    true,
+					EndStream:     false,
+					BlockFragment: buf.Bytes(),
+				})
+			case *RSTStreamFrame:
+				if f.StreamID == 1 && f.ErrCode == ErrCodeCancel {
+					return nil
+				}
+			}
+		}
+	}
+	ct.run()
+}
+
+func TestTransportFramePadding(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	ct := newClientTester(t)
+	ct.tr.FramePadding = PadToMultiple(64)
+	ct.client = func() error {
+		req, _ := http.NewRequest("POST", "https://dummy.tld/", strings.NewReader(body))
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		var got []byte
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			switch f := f.(type) {
+			case *HeadersFrame:
+				if n := f.Header().Length; n%64 != 0 {
+					t.Errorf("HEADERS frame payload of %d bytes; want a multiple of 64", n)
+				}
+			case *DataFrame:
+				if n := f.Header().Length; n%64 != 0 {
+					t.Errorf("DATA frame payload of %d bytes; want a multiple of 64", n)
+				}
+				got = append(got, f.Data()...)
+				if !f.StreamEnded() {
+					continue
+				}
+				if string(got) != body {
+					t.Errorf("got body %q; want %q", got, body)
+				}
+				var buf bytes.Buffer
+				enc := hpack.NewEncoder(&buf)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      f.StreamID,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: buf.Bytes(),
+				})
+				return nil
+			}
+		}
+	}
+	ct.run()
+}
+
+func TestTransportExtensionFrames(t *testing.T) {
+	ct := newClientTester(t)
+	got := make(chan string, 1)
+	ct.tr.OnExtensionFrame = func(cc *ClientConn, f *UnknownFrame) {
+		got <- string(f.Payload())
+		p := append([]byte("echo "), f.Payload()...)
+		go func() {
+			if err := cc.WriteExtensionFrame(0xfa, 0, 0, p); err != nil {
+				t.Errorf("WriteExtensionFrame = %v", err)
+			}
+		}()
+	}
+	ct.client = func() error {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := ct.tr.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		if p := <-got; p != "grease" {
+			t.Errorf("extension frame payload %q; want %q", p, "grease")
+		}
+		return res.Body.Close()
+	}
+	ct.server = func() error {
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return err
+			}
+			if f, ok := f.(*HeadersFrame); ok {
+				ct.fr.WriteRawFrame(0xfb, 0, 0, []byte("grease"))
+				var buf bytes.Buffer
+				enc := hpack.NewEncoder(&buf)
+				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				ct.fr.WriteHeaders(HeadersFrameParam{
+					StreamID:      f.StreamID,
+					EndHeaders:    true,
+					EndStream:     true,
+					BlockFragment: buf.Bytes(),
+				})
+				break
+			}
+		}
+		wantExtensionFrame(t, ct.fr.ReadFrame, 0xfa, 0, 0, "echo grease")
+		return nil
+	}
+	ct.run()
+}
+
 func TestTransportDisableCompression(t *testing.T) {
 	const body = "sup"
 	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
@@ -2422,6 +2725,58 @@ func TestTransportRejectsConnHeaders(t *testing.T) {
 
 // Reject content-length headers containing a sign.
 // See https://golang.org/issue/39017
+func TestTransportStrictValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		field string // rejected field, if any
+	}{
+		{"valid", "X-Foo", "bar", ""},
+		{"connection-specific", "Keep-Alive", "timeout=5", "Keep-Alive"},
+		{"white space", "X-Foo", "bar ", "X-Foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(tt.key, tt.value)
+			}, optOnlyServer)
+			defer st.Close()
+			var errs []*ValidationError
+			tr := &Transport{
+				TLSClientConfig:     tlsConfigInsecure,
+				StrictValidation:    true,
+				ValidationErrorHook: func(err *ValidationError) { errs = append(errs, err) },
+			}
+			defer tr.CloseIdleConnections()
+
+			req, _ := http.NewRequest("GET", st.ts.URL, nil)
+			res, err := tr.RoundTrip(req)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+				if len(errs) != 0 {
+					t.Errorf("got errors %v", errs)
+				}
+				return
+			}
+			if err == nil {
+				res.Body.Close()
+				t.Fatal("RoundTrip succeeded; want an error")
+			}
+			se, ok := err.(StreamError)
+			if verr, _ := se.Cause.(*ValidationError); !ok || verr == nil || verr.Field != tt.field {
+				t.Errorf("RoundTrip error %v; want a ValidationError for %v", err, tt.field)
+			}
+			if len(errs) != 1 || errs[0].Field != tt.field {
+				t.Errorf("got errors %v; want one for %v", errs, tt.field)
+			}
+		})
+	}
+}
+
 func TestTransportRejectsContentLengthWithSign(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -2635,6 +2990,18 @@ func TestTransportNewTLSConfig(t *testing.T) {
 				NextProtos: []string{"foo", "bar", NextProtoTLS},
 			},
 		},
+
+		// Renegotiation is never allowed:
+		4: {
+			conf: &tls.Config{
+				Renegotiation: tls.RenegotiateFreelyAsClient,
+			},
+			host: "example.com",
+			want: &tls.Config{
+				ServerName: "example.com",
+				NextProtos: []string{NextProtoTLS},
+			},
+		},
 	}
 	for i, tt := range tests {
 		// Ignore the session ticket keys part, which ends up populating
@@ -2958,6 +3325,85 @@ func testTransportUsesGoAwayDebugError(t *testing.T, failMidBody bool) {
 	ct.run()
 }
 
+func TestTransportOnGoAway(t *testing.T) {
+	ct := newClientTester(t)
+	type goAway struct {
+		addr      string
+		code      ErrCode
+		debugData string
+	}
+	got := make(chan goAway, 2)
+	ct.tr.OnGoAway = func(addr string, code ErrCode, debugData []byte) {
+		got <- goAway{addr, code, string(debugData)}
+	}
+	clientDone := make(chan struct{})
+	ct.client = func() error {
+		defer close(clientDone)
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		if _, err := ct.tr.RoundTrip(req); err == nil {
+			return errors.New("RoundTrip succeeded; want a GOAWAY error")
+		}
+		const addr = "dummy.tld:443" // dialed by the Transport
+		want := []goAway{
+			{addr, ErrCodeNo, "draining"},
+			{addr, ErrCodeEnhanceYourCalm, ""},
+		}
+		for _, w := range want {
+			if g := <-got; g != w {
+				t.Errorf("OnGoAway called with %+v; want %+v", g, w)
+			}
+		}
+		return nil
+	}
+	ct.server = func() error {
+		ct.greet()
+		for {
+			f, err := ct.fr.ReadFrame()
+			if err != nil {
+				return nil
+			}
+			if _, ok := f.(*HeadersFrame); !ok {
+				continue
+			}
+			ct.fr.WriteGoAway(0, ErrCodeNo, []byte("draining"))
+			ct.fr.WriteGoAway(0, ErrCodeEnhanceYourCalm, nil)
+			<-clientDone
+			return nil
+		}
+	}
+	ct.run()
+}
+
+// noAddrConn is a net.Conn without a remote address.
+type noAddrConn struct{ net.Conn }
+
+func (noAddrConn) RemoteAddr() net.Addr { return nil }
+
+func TestTransportOnGoAwayNoRemoteAddr(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+	got := make(chan string, 1)
+	tr := &Transport{OnGoAway: func(addr string, code ErrCode, debugData []byte) {
+		got <- addr
+	}}
+	go func() {
+		if _, err := io.ReadFull(s, make([]byte, len(ClientPreface))); err != nil {
+			return
+		}
+		go io.Copy(io.Discard, s)
+		fr := NewFramer(s, s)
+		fr.WriteSettings()
+		fr.WriteGoAway(0, ErrCodeNo, nil)
+	}()
+	cc, err := tr.NewClientConn(noAddrConn{c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	if addr := <-got; addr != "" {
+		t.Errorf("OnGoAway called with address %q; want none", addr)
+	}
+}
 func testTransportReturnsUnusedFlowControl(t *testing.T, oneDataFrame bool) {
 	ct := newClientTester(t)
 
@@ -3856,6 +4302,80 @@ func TestTransportRetryAfterGOAWAY(t *testing.T) {
 	testClientMultipleDials(t, client, server)
 }
 
+func TestTransportGOAWAYClientConnError(t *testing.T) {
+	client := func(tr *Transport) {
+		// The body cannot be sent again, so the request is not retried.
+		req, _ := http.NewRequest("POST", "https://dummy.tld/", ioutil.NopCloser(strings.NewReader("body")))
+		res, err := tr.RoundTrip(req)
+		if res != nil {
+			res.Body.Close()
+		}
+		var cce *ClientConnError
+		if !errors.As(err, &cce) {
+			t.Errorf("RoundTrip = %v; want a *ClientConnError", err)
+			return
+		}
+		want := GoAwayError{LastStreamID: 0, ErrCode: ErrCodeEnhanceYourCalm, DebugData: "bye"}
+		if !cce.Retryable || cce.GoAway == nil || *cce.GoAway != want {
+			t.Errorf("ClientConnError = %+v, GoAway %+v; want retryable with %+v", cce, cce.GoAway, want)
+		}
+	}
+	server := func(count int, ct *clientTester) {
+		if count != 1 {
+			t.Errorf("unexpected number of dials")
+			return
+		}
+		ct.greet()
+		if _, err := ct.firstHeaders(); err != nil {
+			t.Errorf("server failed reading HEADERS: %v", err)
+			return
+		}
+		if err := ct.fr.WriteGoAway(0, ErrCodeEnhanceYourCalm, []byte("bye")); err != nil {
+			t.Errorf("server failed writing GOAWAY: %v", err)
+		}
+	}
+	testClientMultipleDials(t, client, server)
+}
+
+func TestTransportLostConnError(t *testing.T) {
+	client := func(tr *Transport) {
+		req, _ := http.NewRequest("GET", "https://dummy.tld/", nil)
+		res, err := tr.RoundTrip(req)
+		if res != nil {
+			res.Body.Close()
+		}
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("RoundTrip = %v; want %v", err, io.ErrUnexpectedEOF)
+		}
+	}
+	server := func(count int, ct *clientTester) {
+		if count != 1 {
+			t.Errorf("unexpected number of dials")
+			return
+		}
+		ct.greet()
+		if _, err := ct.firstHeaders(); err != nil {
+			t.Errorf("server failed reading HEADERS: %v", err)
+			return
+		}
+		ct.sc.Close()
+	}
+	testClientMultipleDials(t, client, server)
+}
+
+func TestStreamErrorRetryable(t *testing.T) {
+	if se := streamError(1, ErrCodeRefusedStream); !se.Retryable() {
+		t.Errorf("%v: Retryable = false", se)
+	}
+	if se := streamError(1, ErrCodeCancel); se.Retryable() {
+		t.Errorf("%v: Retryable = true", se)
+	}
+	if canRetryError(errClientConnClosed) || !canRetryError(errClientConnUnusable) {
+		t.Errorf("canRetryError of errClientConnClosed, errClientConnUnusable = %v, %v; want false, true",
+			canRetryError(errClientConnClosed), canRetryError(errClientConnUnusable))
+	}
+}
+
 func TestTransportRetryAfterRefusedStream(t *testing.T) {
 	clientDone := make(chan struct{})
 	client := func(tr *Transport) {
@@ -5982,7 +6502,7 @@ func TestClientConnReservations(t *testing.T) {
 	tr := &Transport{TLSClientConfig: tlsConfigInsecure}
 	defer tr.CloseIdleConnections()
 
-	cc, err := tr.newClientConn(st.cc, false)
+	cc, err := tr.newClientConn(st.cc, "", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -6458,3 +6978,130 @@ func TestTransportReuseAfterError(t *testing.T) {
 	})
 	<-req1c
 }
+
+func TestTransportCoalesceRequests(t *testing.T) {
+	const n = 5
+	var hits int32
+	release := make(chan struct{})
+	st := newServerTester(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		io.WriteString(w, strings.Repeat("x", 100<<10))
+	}, optOnlyServer)
+	defer st.Close()
+
+	tr := &Transport{TLSClientConfig: tlsConfigInsecure, CoalesceRequests: true}
+	defer tr.CloseIdleConnections()
+
+	get := func(path string, errc chan<- error) {
+		req, _ := http.NewRequest("GET", st.ts.URL+path, nil)
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err == nil && len(b) != 100<<10 {
+			err = fmt.Errorf("read %d bytes; want %d", len(b), 100<<10)
+		}
+		errc <- err
+	}
+	// waitCoalesced waits for the requests of path to share a stream.
+	waitCoalesced := func(path string) {
+		req, _ := http.NewRequest("GET", st.ts.URL+path, nil)
+		key, _ := coalesceKey(req)
+		for {
+			tr.coalescer.mu.Lock()
+			call := tr.coalescer.calls[key]
+			waiting := call != nil && call.waiters == n
+			tr.coalescer.mu.Unlock()
+			if waiting && atomic.LoadInt32(&hits) > 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go get("/shared", errc)
+	}
+	waitCoalesced("/shared")
+	release <- struct{}{}
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("server got %d requests; want 1", got)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+	for i := 0; i < n; i++ {
+		go get("/private", errc)
+	}
+	waitCoalesced("/private")
+	close(release)
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != n {
+		t.Errorf("server got %d requests of a private response; want %d", got, n)
+	}
+}
+
+func TestSharedBodySlowReader(t *testing.T) {
+	const size = 3 * maxSharedBodyBuffered
+	canceled := false
+	b := newSharedBody(ioutil.NopCloser(bytes.NewReader(make([]byte, size))), 2, func() { canceled = true })
+	fast := b.newReader(context.Background())
+	slow := b.newReader(context.Background())
+	if _, err := io.ReadFull(slow, make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(ioutil.Discard, fast)
+	if err != nil || n != size {
+		t.Fatalf("fast reader: read %d bytes, %v; want %d bytes", n, err, size)
+	}
+	b.mu.Lock()
+	buffered := len(b.buf)
+	b.mu.Unlock()
+	if buffered > maxSharedBodyBuffered {
+		t.Errorf("%d bytes buffered; want at most %d", buffered, maxSharedBodyBuffered)
+	}
+	if _, err := slow.Read(make([]byte, 10)); err != errSharedBodyTooSlow {
+		t.Errorf("slow reader: got %v; want %v", err, errSharedBodyTooSlow)
+	}
+	fast.Close()
+	if !canceled {
+		t.Errorf("stream not canceled once the readers are closed or detached")
+	}
+	slow.Close()
+}
+
+func TestSharedBodyReaderContext(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	b := newSharedBody(pr, 2, func() {})
+	ctx, cancel := context.WithCancel(context.Background())
+	r := b.newReader(ctx)
+	other := b.newReader(context.Background())
+	defer other.Close()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		errc <- err
+	}()
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("Read = %v; want %v", err, context.Canceled)
+	}
+	r.Close()
+}
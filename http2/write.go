@@ -99,6 +99,7 @@ type writeData struct {
 	streamID  uint32
 	p         []byte
 	endStream bool
+	pad       []byte // padding, if non-nil
 }
 
 func (w *writeData) String() string {
@@ -106,11 +107,15 @@ func (w *writeData) String() string {
 }
 
 func (w *writeData) writeFrame(ctx writeContext) error {
-	return ctx.Framer().WriteData(w.streamID, w.endStream, w.p)
+	return ctx.Framer().WriteDataPadded(w.streamID, w.endStream, w.p, w.pad)
 }
 
 func (w *writeData) staysWithinBuffer(max int) bool {
-	return frameHeaderLen+len(w.p) <= max
+	n := frameHeaderLen + len(w.p)
+	if w.pad != nil {
+		n += 1 + len(w.pad)
+	}
+	return n <= max
 }
 
 // handlerPanicRST is the message sent from handler goroutines when
@@ -186,13 +191,20 @@ type writeResHeaders struct {
 	date          string
 	contentType   string
 	contentLength string
+
+	padding PaddingFunc // pads the HEADERS frame, if non-nil
+
+	fieldBytes int // set by writeFrame; see encKV
 }
 
-func encKV(enc *hpack.Encoder, k, v string) {
+// encKV encodes the field k: v and returns the length of its name and
+// value, which is what the field would take without compression.
+func encKV(enc *hpack.Encoder, k, v string) int {
 	if VerboseLogs {
 		log.Printf("http2: server encoding header %q = %q", k, v)
 	}
 	enc.WriteField(hpack.HeaderField{Name: k, Value: v})
+	return len(k) + len(v)
 }
 
 func (w *writeResHeaders) staysWithinBuffer(max int) bool {
@@ -210,21 +222,23 @@ func (w *writeResHeaders) writeFrame(ctx writeContext) error {
 	enc, buf := ctx.HeaderEncoder()
 	buf.Reset()
 
+	n := 0
 	if w.httpResCode != 0 {
-		encKV(enc, ":status", httpCodeString(w.httpResCode))
+		n += encKV(enc, ":status", httpCodeString(w.httpResCode))
 	}
 
-	encodeHeaders(enc, w.h, w.trailers)
+	n += encodeHeaders(enc, w.h, w.trailers)
 
 	if w.contentType != "" {
-		encKV(enc, "content-type", w.contentType)
+		n += encKV(enc, "content-type", w.contentType)
 	}
 	if w.contentLength != "" {
-		encKV(enc, "content-length", w.contentLength)
+		n += encKV(enc, "content-length", w.contentLength)
 	}
 	if w.date != "" {
-		encKV(enc, "date", w.date)
+		n += encKV(enc, "date", w.date)
 	}
+	w.fieldBytes = n
 
 	headerBlock := buf.Bytes()
 	if len(headerBlock) == 0 && w.trailers == nil {
@@ -236,11 +250,14 @@ func (w *writeResHeaders) writeFrame(ctx writeContext) error {
 
 func (w *writeResHeaders) writeHeaderBlock(ctx writeContext, frag []byte, firstFrag, lastFrag bool) error {
 	if firstFrag {
+		// splitHeaderBlock writes frames of at most 16384 bytes.
+		pad := framePadding(w.padding, FrameHeaders, len(frag), 16384-len(frag)-1)
 		return ctx.Framer().WriteHeaders(HeadersFrameParam{
 			StreamID:      w.streamID,
 			BlockFragment: frag,
 			EndStream:     w.endStream,
 			EndHeaders:    lastFrag,
+			PadLength:     uint8(pad),
 		})
 	} else {
 		return ctx.Framer().WriteContinuation(w.streamID, lastFrag, frag)
@@ -258,6 +275,8 @@ type writePushPromise struct {
 	// the frame is written. The returned ID is copied to promisedID.
 	allocatePromisedID func() (uint32, error)
 	promisedID         uint32
+
+	fieldBytes int // set by writeFrame; see encKV
 }
 
 func (w *writePushPromise) staysWithinBuffer(max int) bool {
@@ -269,11 +288,11 @@ func (w *writePushPromise) writeFrame(ctx writeContext) error {
 	enc, buf := ctx.HeaderEncoder()
 	buf.Reset()
 
-	encKV(enc, ":method", w.method)
-	encKV(enc, ":scheme", w.url.Scheme)
-	encKV(enc, ":authority", w.url.Host)
-	encKV(enc, ":path", w.url.RequestURI())
-	encodeHeaders(enc, w.h, nil)
+	w.fieldBytes = encKV(enc, ":method", w.method) +
+		encKV(enc, ":scheme", w.url.Scheme) +
+		encKV(enc, ":authority", w.url.Host) +
+		encKV(enc, ":path", w.url.RequestURI()) +
+		encodeHeaders(enc, w.h, nil)
 
 	headerBlock := buf.Bytes()
 	if len(headerBlock) == 0 {
@@ -330,7 +349,9 @@ func (wu writeWindowUpdate) writeFrame(ctx writeContext) error {
 
 // encodeHeaders encodes an http.Header. If keys is not nil, then (k, h[k])
 // is encoded only if k is in keys.
-func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) {
+// encodeHeaders encodes the fields of h with the given keys, or all of
+// them if keys is nil, and returns their total size as encKV does.
+func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) int {
 	if keys == nil {
 		sorter := sorterPool.Get().(*sorter)
 		// Using defer here, since the returned keys from the
@@ -339,6 +360,7 @@ func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) {
 		defer sorterPool.Put(sorter)
 		keys = sorter.Keys(h)
 	}
+	n := 0
 	for _, k := range keys {
 		vv := h[k]
 		k, ascii := lowerHeader(k)
@@ -364,7 +386,8 @@ func encodeHeaders(enc *hpack.Encoder, h http.Header, keys []string) {
 			if isTE && v != "trailers" {
 				continue
 			}
-			encKV(enc, k, v)
+			n += encKV(enc, k, v)
 		}
 	}
+	return n
 }
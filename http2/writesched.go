@@ -124,6 +124,7 @@ func (wr FrameWriteRequest) Consume(n int32) (FrameWriteRequest, FrameWriteReque
 		return empty, empty, 0
 	}
 	if len(wd.p) > int(allowed) {
+		pad := wr.takePadding(allowed)
 		wr.stream.flow.take(allowed)
 		consumed := FrameWriteRequest{
 			stream: wr.stream,
@@ -134,6 +135,7 @@ func (wr FrameWriteRequest) Consume(n int32) (FrameWriteRequest, FrameWriteReque
 				// are bytes remaining because len(wd.p) > allowed,
 				// so we know endStream is false.
 				endStream: false,
+				pad:       pad,
 			},
 			// Our caller is blocking on the final DATA frame, not
 			// this intermediate frame, so no need to wait.
@@ -153,10 +155,31 @@ func (wr FrameWriteRequest) Consume(n int32) (FrameWriteRequest, FrameWriteReque
 
 	// The frame is consumed whole.
 	// NB: This cast cannot overflow because allowed is <= math.MaxInt32.
+	wd.pad = wr.takePadding(int32(len(wd.p)))
 	wr.stream.flow.take(int32(len(wd.p)))
 	return wr, empty, 1
 }
 
+// takePadding returns the padding of the DATA frame of wr carrying n
+// bytes, as selected by Server.FramePadding, and takes its flow control
+// tokens.
+func (wr FrameWriteRequest) takePadding(n int32) []byte {
+	sc := wr.stream.sc
+	if sc.srv == nil || sc.srv.FramePadding == nil {
+		return nil
+	}
+	limit := wr.stream.flow.available() - n
+	if max := sc.maxFrameSize - n; max < limit {
+		limit = max
+	}
+	pad := framePadding(sc.srv.FramePadding, FrameData, int(n), int(limit)-1)
+	if pad == 0 {
+		return nil
+	}
+	wr.stream.flow.take(int32(pad) + 1)
+	return make([]byte, pad)
+}
+
 // String is for debugging only.
 func (wr FrameWriteRequest) String() string {
 	var des string
@@ -0,0 +1,440 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/net/http2/hpack"
+	"golang.org/x/net/http3/qpack"
+)
+
+// maxControlFrameSize limits the frames on control streams, which are
+// all small.
+const maxControlFrameSize = 16 << 10
+
+var (
+	errBodyLength  = errors.New("http3: body length does not match Content-Length")
+	errFieldsLimit = errors.New("http3: header field section too large")
+)
+
+// A conn holds the state that clients and servers share for an
+// HTTP/3 connection: the control streams and the peer's settings.
+type conn struct {
+	qc             QUICConn
+	isClient       bool
+	maxHeaderBytes int64 // limit on field sections received
+
+	// onGoAway is called with the ID carried by GOAWAY frames.
+	onGoAway func(id int64)
+
+	ctrlMu sync.Mutex
+	ctrl   QUICStream // the local control stream
+
+	// The QPACK state. The dynamic table is not used in either
+	// direction: a capacity of zero is advertised, and none is
+	// set for the peer's decoder.
+	qpackMu sync.Mutex
+	enc     *qpack.Encoder
+	dec     *qpack.Decoder
+
+	mu                      sync.Mutex
+	peerMaxFieldSectionSize int64
+	peerStreams             map[uint64]bool // critical stream types opened by the peer
+	lastGoAway              int64           // -1 until a GOAWAY frame is received
+	closeErr                error
+}
+
+func (c *conn) init(qc QUICConn, isClient bool, maxHeaderBytes int64) {
+	c.qc = qc
+	c.isClient = isClient
+	c.maxHeaderBytes = maxHeaderBytes
+	c.peerMaxFieldSectionSize = maxVarint
+	c.peerStreams = make(map[uint64]bool)
+	c.lastGoAway = -1
+	c.enc = qpack.NewEncoder(nil)
+	c.dec = qpack.NewDecoder(nil, 0, 0)
+	c.dec.SetMaxFieldSectionSize(uint64(maxHeaderBytes))
+}
+
+// start opens the control stream and sends SETTINGS,
+// RFC 9114, Section 6.2.1.
+func (c *conn) start(ctx context.Context) error {
+	st, err := c.qc.OpenUniStream(ctx)
+	if err != nil {
+		return err
+	}
+	b := appendVarint(nil, streamTypeControl)
+	b = appendSettingsFrame(b, []setting{
+		{settingQPACKMaxTableCapacity, 0},
+		{settingQPACKBlockedStreams, 0},
+		{settingMaxFieldSectionSize, uint64(c.maxHeaderBytes)},
+	})
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	c.ctrl = st
+	_, err = st.Write(b)
+	return err
+}
+
+// sendGoAway sends a GOAWAY frame on the control stream.
+func (c *conn) sendGoAway(id int64) error {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+	if c.ctrl == nil {
+		return nil
+	}
+	_, err := c.ctrl.Write(appendFrame(nil, FrameGoAway, appendVarint(nil, uint64(id))))
+	return err
+}
+
+// abort closes the connection because of err, which is reported
+// to the peer if it is a ConnectionError.
+func (c *conn) abort(err error) {
+	c.mu.Lock()
+	if c.closeErr == nil {
+		c.closeErr = err
+	}
+	c.mu.Unlock()
+	code := ErrCodeInternal
+	var ce ConnectionError
+	if errors.As(err, &ce) {
+		code = ErrCode(ce)
+	}
+	c.qc.CloseWithError(uint64(code), "")
+}
+
+// handleUniStream reads a unidirectional stream opened by the peer.
+func (c *conn) handleUniStream(st QUICStream) {
+	br := bufio.NewReader(st)
+	typ, err := readVarint(br)
+	if err != nil {
+		st.CancelRead(uint64(ErrCodeStreamCreation))
+		return
+	}
+	switch typ {
+	case streamTypeControl, streamTypeQPACKEncoder, streamTypeQPACKDecoder:
+		c.mu.Lock()
+		dup := c.peerStreams[typ]
+		c.peerStreams[typ] = true
+		c.mu.Unlock()
+		if dup {
+			c.abort(ConnectionError(ErrCodeStreamCreation))
+			return
+		}
+	case streamTypePush:
+		if c.isClient {
+			// MAX_PUSH_ID is never sent, so no push ID is valid.
+			c.abort(ConnectionError(ErrCodeID))
+		} else {
+			c.abort(ConnectionError(ErrCodeStreamCreation))
+		}
+		return
+	default:
+		// Unknown and reserved stream types, RFC 9114,
+		// Section 6.2.3.
+		st.CancelRead(uint64(ErrCodeStreamCreation))
+		return
+	}
+	if typ != streamTypeControl {
+		if err := c.readQPACKStream(typ, br); err != nil {
+			c.abort(err)
+		}
+		return
+	}
+	if err := c.readControlStream(br); err != nil {
+		c.abort(err)
+	}
+}
+
+// readQPACKStream passes the instructions of the peer's QPACK encoder
+// or decoder stream to the local decoder or encoder.
+func (c *conn) readQPACKStream(typ uint64, br *bufio.Reader) error {
+	buf := make([]byte, 512)
+	for {
+		n, err := br.Read(buf)
+		if n > 0 {
+			c.qpackMu.Lock()
+			var qerr error
+			if typ == streamTypeQPACKEncoder {
+				qerr = c.dec.HandleEncoderStream(buf[:n])
+			} else {
+				qerr = c.enc.HandleDecoderStream(buf[:n])
+			}
+			c.qpackMu.Unlock()
+			if qerr != nil {
+				return qpackError(qerr)
+			}
+		}
+		if err == io.EOF {
+			// RFC 9204, Section 4.2.
+			return ConnectionError(ErrCodeClosedCriticalStream)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// qpackError converts an error of package qpack.
+func qpackError(err error) error {
+	var qerr *qpack.Error
+	switch {
+	case errors.As(err, &qerr):
+		return ConnectionError(qerr.Code)
+	case err == qpack.ErrFieldSectionTooLarge:
+		return errFieldsLimit
+	}
+	return err
+}
+
+func (c *conn) readControlStream(br *bufio.Reader) error {
+	first := true
+	for {
+		typ, length, err := readFrameHeader(br)
+		if err == io.EOF {
+			return ConnectionError(ErrCodeClosedCriticalStream)
+		}
+		if err != nil {
+			return err
+		}
+		if first && typ != FrameSettings {
+			return ConnectionError(ErrCodeMissingSettings)
+		}
+		switch {
+		case typ == FrameSettings:
+			if !first {
+				return ConnectionError(ErrCodeFrameUnexpected)
+			}
+			first = false
+			b, err := readFramePayload(br, length, maxControlFrameSize)
+			if err != nil {
+				return err
+			}
+			settings, err := parseSettings(b)
+			if err != nil {
+				return err
+			}
+			var tableCapacity, blockedStreams uint64
+			c.mu.Lock()
+			for _, s := range settings {
+				switch s.id {
+				case settingMaxFieldSectionSize:
+					if s.value < maxVarint {
+						c.peerMaxFieldSectionSize = int64(s.value)
+					}
+				case settingQPACKMaxTableCapacity:
+					tableCapacity = s.value
+				case settingQPACKBlockedStreams:
+					blockedStreams = s.value
+				}
+			}
+			c.mu.Unlock()
+			c.qpackMu.Lock()
+			c.enc.SetPeerSettings(tableCapacity, blockedStreams)
+			c.qpackMu.Unlock()
+		case typ == FrameGoAway:
+			b, err := readFramePayload(br, length, maxControlFrameSize)
+			if err != nil {
+				return err
+			}
+			v, n := consumeVarint(b)
+			if n != len(b) {
+				return ConnectionError(ErrCodeFrame)
+			}
+			if err := c.handleGoAway(int64(v)); err != nil {
+				return err
+			}
+		case typ == FrameMaxPushID && !c.isClient, typ == FrameCancelPush:
+			// Server push is never used.
+			if err := discardFrame(br, length); err != nil {
+				return err
+			}
+		case typ == FrameData, typ == FrameHeaders, typ == FramePushPromise,
+			typ == FrameMaxPushID, isReservedFrameType(typ):
+			return ConnectionError(ErrCodeFrameUnexpected)
+		default:
+			if err := discardFrame(br, length); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handleGoAway handles a GOAWAY frame, RFC 9114, Section 5.2.
+func (c *conn) handleGoAway(id int64) error {
+	c.mu.Lock()
+	last := c.lastGoAway
+	c.mu.Unlock()
+	if c.isClient && id%4 != 0 {
+		// The ID of a client-initiated bidirectional stream.
+		return ConnectionError(ErrCodeID)
+	}
+	if last >= 0 && id > last {
+		return ConnectionError(ErrCodeID)
+	}
+	c.mu.Lock()
+	c.lastGoAway = id
+	c.mu.Unlock()
+	if c.onGoAway != nil {
+		c.onGoAway(id)
+	}
+	return nil
+}
+
+// peerFieldSectionLimit returns the peer's limit on the size of field
+// sections it receives.
+func (c *conn) peerFieldSectionLimit() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peerMaxFieldSectionSize
+}
+
+// fieldSectionSize returns the size of fields, computed as for
+// SETTINGS_MAX_FIELD_SECTION_SIZE.
+func fieldSectionSize(fields []hpack.HeaderField) int64 {
+	var n int64
+	for _, f := range fields {
+		n += int64(len(f.Name) + len(f.Value) + 32)
+	}
+	return n
+}
+
+// writeHeadersFrame writes fields as a HEADERS frame on a request
+// stream.
+func (c *conn) writeHeadersFrame(st QUICStream, fields []hpack.HeaderField) error {
+	c.qpackMu.Lock()
+	b, err := c.enc.EncodeFieldSection(uint64(st.StreamID()), fields)
+	c.qpackMu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = st.Write(appendFrame(nil, FrameHeaders, b))
+	return err
+}
+
+// decodeFieldSection decodes the field section of a HEADERS frame
+// received on a request stream. It returns errFieldsLimit if the
+// fields exceed maxHeaderBytes.
+func (c *conn) decodeFieldSection(id int64, b []byte) ([]hpack.HeaderField, error) {
+	c.qpackMu.Lock()
+	fields, err := c.dec.DecodeFieldSection(uint64(id), b)
+	c.qpackMu.Unlock()
+	if err != nil {
+		return nil, qpackError(err)
+	}
+	return fields, nil
+}
+
+// A bodyReader reads the content of a message from the DATA frames of
+// a request stream, and its trailer from a final HEADERS frame.
+type bodyReader struct {
+	c             *conn
+	id            int64
+	r             *bufio.Reader
+	contentLength int64 // -1 if unknown
+	trailer       func(fields []hpack.HeaderField)
+
+	remain int64 // bytes left in the current DATA frame
+	n      int64 // bytes read
+	err    error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	for b.remain == 0 {
+		if err := b.nextFrame(); err != nil {
+			b.err = err
+			return 0, err
+		}
+	}
+	if int64(len(p)) > b.remain {
+		p = p[:b.remain]
+	}
+	n, err := b.r.Read(p)
+	b.remain -= int64(n)
+	b.n += int64(n)
+	if b.contentLength >= 0 && b.n > b.contentLength {
+		err = streamError(b.id, ErrCodeMessage)
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// nextFrame reads frames up to the next DATA frame or the end of the
+// stream.
+func (b *bodyReader) nextFrame() error {
+	typ, length, err := readFrameHeader(b.r)
+	if err == io.EOF {
+		return b.eof()
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case typ == FrameData:
+		b.remain = length
+		return nil
+	case typ == FrameHeaders:
+		payload, err := readFramePayload(b.r, length, b.c.maxHeaderBytes)
+		if err != nil {
+			return b.connError(err)
+		}
+		fields, err := b.c.decodeFieldSection(b.id, payload)
+		if err != nil {
+			return b.connError(err)
+		}
+		for _, f := range fields {
+			if len(f.Name) > 0 && f.Name[0] == ':' {
+				return streamError(b.id, ErrCodeMessage)
+			}
+		}
+		if b.trailer != nil {
+			b.trailer(fields)
+		}
+		// Nothing may follow the trailer section.
+		if _, _, err := readFrameHeader(b.r); err != io.EOF {
+			if err == nil {
+				err = b.connError(ConnectionError(ErrCodeFrameUnexpected))
+			}
+			return err
+		}
+		return b.eof()
+	case typ == FramePushPromise && b.c.isClient:
+		return b.connError(ConnectionError(ErrCodeID))
+	case typ == FrameCancelPush, typ == FrameSettings, typ == FrameGoAway,
+		typ == FrameMaxPushID, typ == FramePushPromise, isReservedFrameType(typ):
+		return b.connError(ConnectionError(ErrCodeFrameUnexpected))
+	default:
+		return discardFrame(b.r, length)
+	}
+}
+
+func (b *bodyReader) eof() error {
+	if b.contentLength >= 0 && b.n != b.contentLength {
+		return errBodyLength
+	}
+	return io.EOF
+}
+
+// connError closes the connection because of a connection error.
+func (b *bodyReader) connError(err error) error {
+	if _, ok := err.(ConnectionError); ok {
+		b.c.abort(err)
+	} else if err == errFieldsLimit {
+		return streamError(b.id, ErrCodeExcessiveLoad)
+	}
+	return err
+}
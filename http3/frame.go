@@ -0,0 +1,199 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// A FrameType is an HTTP/3 frame type, RFC 9114, Section 7.2.
+type FrameType uint64
+
+const (
+	FrameData        FrameType = 0x0
+	FrameHeaders     FrameType = 0x1
+	FrameCancelPush  FrameType = 0x3
+	FrameSettings    FrameType = 0x4
+	FramePushPromise FrameType = 0x5
+	FrameGoAway      FrameType = 0x7
+	FrameMaxPushID   FrameType = 0xd
+)
+
+// Unidirectional stream types, RFC 9114, Section 6.2, and RFC 9204,
+// Section 4.2.
+const (
+	streamTypeControl      = 0x00
+	streamTypePush         = 0x01
+	streamTypeQPACKEncoder = 0x02
+	streamTypeQPACKDecoder = 0x03
+)
+
+// Settings, RFC 9114, Section 7.2.4.1, and RFC 9204, Section 5.
+const (
+	settingQPACKMaxTableCapacity = 0x01
+	settingMaxFieldSectionSize   = 0x06
+	settingQPACKBlockedStreams   = 0x07
+)
+
+const maxVarint = 1<<62 - 1
+
+var errVarint = errors.New("http3: invalid variable-length integer")
+
+// appendVarint appends v as a QUIC variable-length integer,
+// RFC 9000, Section 16.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// readVarint reads a variable-length integer. It returns io.EOF only
+// if no byte at all could be read.
+func readVarint(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1 << (b >> 6)
+	v := uint64(b & 0x3f)
+	for i := 1; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// consumeVarint parses a variable-length integer at the start of b,
+// returning its value and size, or a negative size if b is too short.
+func consumeVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// appendFrame appends a frame with the given type and payload.
+func appendFrame(b []byte, typ FrameType, payload []byte) []byte {
+	b = appendVarint(b, uint64(typ))
+	b = appendVarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// readFrameHeader reads the type and length of the next frame. It
+// returns io.EOF if the stream ended cleanly before the frame.
+func readFrameHeader(r io.ByteReader) (FrameType, int64, error) {
+	typ, err := readVarint(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := readVarint(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return FrameType(typ), int64(length), err
+}
+
+// readFramePayload reads a frame payload of the given length, which
+// must not exceed max.
+func readFramePayload(r *bufio.Reader, length, max int64) ([]byte, error) {
+	if length > max {
+		return nil, ConnectionError(ErrCodeExcessiveLoad)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// discardFrame skips the payload of a frame.
+func discardFrame(r *bufio.Reader, length int64) error {
+	_, err := io.CopyN(io.Discard, r, length)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// isReservedFrameType reports whether typ is one of the frame types
+// of HTTP/2 that are reserved in HTTP/3, RFC 9114, Section 7.2.8.
+func isReservedFrameType(typ FrameType) bool {
+	switch typ {
+	case 0x2, 0x6, 0x8, 0x9:
+		return true
+	}
+	return false
+}
+
+// A setting is a single setting of a SETTINGS frame.
+type setting struct {
+	id, value uint64
+}
+
+func appendSettingsFrame(b []byte, settings []setting) []byte {
+	var payload []byte
+	for _, s := range settings {
+		payload = appendVarint(payload, s.id)
+		payload = appendVarint(payload, s.value)
+	}
+	return appendFrame(b, FrameSettings, payload)
+}
+
+// parseSettings parses the payload of a SETTINGS frame.
+func parseSettings(b []byte) ([]setting, error) {
+	var settings []setting
+	seen := make(map[uint64]bool)
+	for len(b) > 0 {
+		id, n := consumeVarint(b)
+		if n < 0 {
+			return nil, ConnectionError(ErrCodeFrame)
+		}
+		b = b[n:]
+		value, n := consumeVarint(b)
+		if n < 0 {
+			return nil, ConnectionError(ErrCodeFrame)
+		}
+		b = b[n:]
+		switch id {
+		case 0x2, 0x3, 0x4, 0x5:
+			// HTTP/2 settings without an HTTP/3 equivalent,
+			// RFC 9114, Section 7.2.4.1.
+			return nil, ConnectionError(ErrCodeSettings)
+		}
+		if seen[id] {
+			return nil, ConnectionError(ErrCodeSettings)
+		}
+		seen[id] = true
+		settings = append(settings, setting{id, value})
+	}
+	return settings, nil
+}
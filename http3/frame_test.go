@@ -0,0 +1,85 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, maxVarint} {
+		b := appendVarint(nil, v)
+		got, n := consumeVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("consumeVarint(appendVarint(%d)) = %d, %d; want %d, %d", v, got, n, v, len(b))
+		}
+		got, err := readVarint(bytes.NewReader(b))
+		if got != v || err != nil {
+			t.Errorf("readVarint(appendVarint(%d)) = %d, %v; want %d, nil", v, got, err, v)
+		}
+		if _, n := consumeVarint(b[:len(b)-1]); n >= 0 {
+			t.Errorf("consumeVarint of truncated %d succeeded", v)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var b []byte
+	b = appendFrame(b, FrameData, []byte("hello"))
+	b = appendFrame(b, 0x1f*2+0x21, []byte("unknown"))
+	b = appendFrame(b, FrameHeaders, bytes.Repeat([]byte{1}, 100))
+	r := bufio.NewReader(bytes.NewReader(b))
+
+	typ, length, err := readFrameHeader(r)
+	if typ != FrameData || length != 5 || err != nil {
+		t.Fatalf("readFrameHeader = %v, %v, %v; want DATA, 5, nil", typ, length, err)
+	}
+	if p, err := readFramePayload(r, length, 16); string(p) != "hello" || err != nil {
+		t.Fatalf("readFramePayload = %q, %v; want \"hello\", nil", p, err)
+	}
+	typ, length, _ = readFrameHeader(r)
+	if isReservedFrameType(typ) {
+		t.Errorf("isReservedFrameType(%#x) = true; want false", typ)
+	}
+	if err := discardFrame(r, length); err != nil {
+		t.Fatalf("discardFrame: %v", err)
+	}
+	_, length, _ = readFrameHeader(r)
+	if _, err := readFramePayload(r, length, 16); err != ConnectionError(ErrCodeExcessiveLoad) {
+		t.Errorf("readFramePayload beyond limit: %v; want %v", err, ConnectionError(ErrCodeExcessiveLoad))
+	}
+}
+
+func TestSettings(t *testing.T) {
+	want := []setting{
+		{settingQPACKMaxTableCapacity, 0},
+		{0x1f*3 + 0x21, 1}, // reserved
+		{settingMaxFieldSectionSize, 1 << 20},
+	}
+	b := appendSettingsFrame(nil, want)
+	r := bufio.NewReader(bytes.NewReader(b))
+	typ, length, err := readFrameHeader(r)
+	if typ != FrameSettings || err != nil {
+		t.Fatalf("readFrameHeader = %v, %v; want SETTINGS, nil", typ, err)
+	}
+	p, _ := readFramePayload(r, length, 1<<10)
+	got, err := parseSettings(p)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSettings = %v, %v; want %v, nil", got, err, want)
+	}
+
+	dup := appendSettingsFrame(nil, []setting{{settingMaxFieldSectionSize, 1}, {settingMaxFieldSectionSize, 2}})
+	if _, err := parseSettings(dup[2:]); err != ConnectionError(ErrCodeSettings) {
+		t.Errorf("parseSettings with duplicate setting: %v; want %v", err, ConnectionError(ErrCodeSettings))
+	}
+	// HTTP/2 settings are forbidden, RFC 9114, Section 7.2.4.1.
+	h2 := appendSettingsFrame(nil, []setting{{0x02, 0}})
+	if _, err := parseSettings(h2[2:]); err != ConnectionError(ErrCodeSettings) {
+		t.Errorf("parseSettings with HTTP/2 setting: %v; want %v", err, ConnectionError(ErrCodeSettings))
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2/hpack"
+)
+
+// validWireHeaderFieldName reports whether v is a valid field name on
+// the wire: a token in lower case, RFC 9114, Section 4.2.
+func validWireHeaderFieldName(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		b := v[i]
+		if !httpguts.IsTokenRune(rune(b)) || 'A' <= b && b <= 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isConnectionHeader reports whether the lower-case field name k is
+// a connection-specific field, which HTTP/3 forbids,
+// RFC 9114, Section 4.2.
+func isConnectionHeader(k string) bool {
+	switch k {
+	case "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
+
+// lowerHeader returns the lower-case form of the field name v, and
+// reports whether v is ASCII.
+func lowerHeader(v string) (string, bool) {
+	for i := 0; i < len(v); i++ {
+		if v[i] >= 0x80 {
+			return "", false
+		}
+	}
+	return strings.ToLower(v), true
+}
+
+// appendHeaderFields appends the fields of h, skipping those named by
+// skip and the connection-specific ones.
+func appendHeaderFields(fields []hpack.HeaderField, h http.Header, skip func(k string) bool) []hpack.HeaderField {
+	for k, vv := range h {
+		k, ok := lowerHeader(k)
+		if !ok || !validWireHeaderFieldName(k) || isConnectionHeader(k) || skip != nil && skip(k) {
+			continue
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				continue
+			}
+			fields = append(fields, hpack.HeaderField{Name: k, Value: v})
+		}
+	}
+	return fields
+}
+
+// foreachHeaderElement splits v according to the "#rule" construction
+// in RFC 9110, Section 5.6.1, and calls fn for each non-empty element.
+func foreachHeaderElement(v string, fn func(string)) {
+	v = textproto.TrimString(v)
+	if v == "" {
+		return
+	}
+	if !strings.Contains(v, ",") {
+		fn(v)
+		return
+	}
+	for _, f := range strings.Split(v, ",") {
+		if f = textproto.TrimString(f); f != "" {
+			fn(f)
+		}
+	}
+}
+
+// addTrailer adds the trailer fields to t, keeping only those allowed
+// in a trailer section.
+func addTrailer(t http.Header, fields []hpack.HeaderField) {
+	for _, f := range fields {
+		k := http.CanonicalHeaderKey(f.Name)
+		if !httpguts.ValidTrailerHeader(k) {
+			continue
+		}
+		t[k] = append(t[k], f.Value)
+	}
+}
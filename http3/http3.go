@@ -0,0 +1,185 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package http3 implements HTTP/3, as defined in RFC 9114.
+//
+// The package does not depend on a particular QUIC implementation:
+// Transport and Server use connections through the QUICConn
+// interface. With Go 1.21 or later, NewQUICConn and NewQUICListener
+// adapt the connections and endpoints of golang.org/x/net/quic, which
+// Transport also uses by default.
+//
+// Header fields are compressed with QPACK (RFC 9204), implemented by
+// package golang.org/x/net/http3/qpack, using the static table only.
+// Server push is not supported.
+//
+// The API mirrors that of golang.org/x/net/http2, so that a program
+// can offer HTTP/2 and HTTP/3 with the same configuration style.
+package http3 // import "golang.org/x/net/http3"
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// NextProtoTLS is the NPN/ALPN protocol negotiated during HTTP/3's TLS
+// setup.
+const NextProtoTLS = "h3"
+
+// A QUICConn is a QUIC connection, as used by HTTP/3.
+type QUICConn interface {
+	// OpenStream opens a bidirectional stream.
+	OpenStream(ctx context.Context) (QUICStream, error)
+
+	// OpenUniStream opens a unidirectional stream, which can only
+	// be written to.
+	OpenUniStream(ctx context.Context) (QUICStream, error)
+
+	// AcceptStream returns the next stream opened by the peer,
+	// either bidirectional or unidirectional, which can only be
+	// read from.
+	AcceptStream(ctx context.Context) (QUICStream, error)
+
+	// CloseWithError closes the connection with an application
+	// error code and reason.
+	CloseWithError(code uint64, reason string) error
+
+	// ConnectionState returns the state of the TLS handshake.
+	ConnectionState() tls.ConnectionState
+
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// A QUICStream is a QUIC stream.
+//
+// When the peer resets the stream, Read returns an error that wraps a
+// *StreamError holding the peer's error code; so does Write when the
+// peer asks to stop sending.
+type QUICStream interface {
+	io.Reader
+	io.Writer
+
+	// StreamID returns the QUIC stream ID. Its second least
+	// significant bit is set for unidirectional streams.
+	StreamID() int64
+
+	// CloseWrite ends the sending part of the stream gracefully.
+	CloseWrite() error
+
+	// CancelRead abandons the receiving part of the stream, asking
+	// the peer to stop sending with the given error code. Pending
+	// and future calls to Read return an error.
+	CancelRead(code uint64)
+
+	// CancelWrite abandons the sending part of the stream, resetting
+	// it with the given error code.
+	CancelWrite(code uint64)
+}
+
+// A QUICListener accepts QUIC connections.
+type QUICListener interface {
+	Accept(ctx context.Context) (QUICConn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// An ErrCode is an HTTP/3 error code, RFC 9114, Section 8.1.
+type ErrCode uint64
+
+const (
+	ErrCodeNo                   ErrCode = 0x100
+	ErrCodeGeneralProtocol      ErrCode = 0x101
+	ErrCodeInternal             ErrCode = 0x102
+	ErrCodeStreamCreation       ErrCode = 0x103
+	ErrCodeClosedCriticalStream ErrCode = 0x104
+	ErrCodeFrameUnexpected      ErrCode = 0x105
+	ErrCodeFrame                ErrCode = 0x106
+	ErrCodeExcessiveLoad        ErrCode = 0x107
+	ErrCodeID                   ErrCode = 0x108
+	ErrCodeSettings             ErrCode = 0x109
+	ErrCodeMissingSettings      ErrCode = 0x10a
+	ErrCodeRequestRejected      ErrCode = 0x10b
+	ErrCodeRequestCancelled     ErrCode = 0x10c
+	ErrCodeRequestIncomplete    ErrCode = 0x10d
+	ErrCodeMessage              ErrCode = 0x10e
+	ErrCodeConnect              ErrCode = 0x10f
+	ErrCodeVersionFallback      ErrCode = 0x110
+
+	// QPACK error codes, RFC 9204, Section 6.
+	ErrCodeQPACKDecompressionFailed ErrCode = 0x200
+	ErrCodeQPACKEncoderStream       ErrCode = 0x201
+	ErrCodeQPACKDecoderStream       ErrCode = 0x202
+)
+
+var errCodeName = map[ErrCode]string{
+	ErrCodeNo:                       "H3_NO_ERROR",
+	ErrCodeGeneralProtocol:          "H3_GENERAL_PROTOCOL_ERROR",
+	ErrCodeInternal:                 "H3_INTERNAL_ERROR",
+	ErrCodeStreamCreation:           "H3_STREAM_CREATION_ERROR",
+	ErrCodeClosedCriticalStream:     "H3_CLOSED_CRITICAL_STREAM",
+	ErrCodeFrameUnexpected:          "H3_FRAME_UNEXPECTED",
+	ErrCodeFrame:                    "H3_FRAME_ERROR",
+	ErrCodeExcessiveLoad:            "H3_EXCESSIVE_LOAD",
+	ErrCodeID:                       "H3_ID_ERROR",
+	ErrCodeSettings:                 "H3_SETTINGS_ERROR",
+	ErrCodeMissingSettings:          "H3_MISSING_SETTINGS",
+	ErrCodeRequestRejected:          "H3_REQUEST_REJECTED",
+	ErrCodeRequestCancelled:         "H3_REQUEST_CANCELLED",
+	ErrCodeRequestIncomplete:        "H3_REQUEST_INCOMPLETE",
+	ErrCodeMessage:                  "H3_MESSAGE_ERROR",
+	ErrCodeConnect:                  "H3_CONNECT_ERROR",
+	ErrCodeVersionFallback:          "H3_VERSION_FALLBACK",
+	ErrCodeQPACKDecompressionFailed: "QPACK_DECOMPRESSION_FAILED",
+	ErrCodeQPACKEncoderStream:       "QPACK_ENCODER_STREAM_ERROR",
+	ErrCodeQPACKDecoderStream:       "QPACK_DECODER_STREAM_ERROR",
+}
+
+func (e ErrCode) String() string {
+	if s, ok := errCodeName[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint64(e))
+}
+
+// ConnectionError is an error that results in the termination of the
+// entire connection.
+type ConnectionError ErrCode
+
+func (e ConnectionError) Error() string { return fmt.Sprintf("connection error: %s", ErrCode(e)) }
+
+// StreamError is an error that only affects one stream within an
+// HTTP/3 connection.
+type StreamError struct {
+	StreamID int64
+	Code     ErrCode
+	Cause    error // optional additional detail
+}
+
+// ErrFromPeer is the Cause of a StreamError conveying an error code
+// received from the peer.
+var ErrFromPeer = errors.New("received from peer")
+
+func (e *StreamError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("stream error: stream ID %d; %v; %v", e.StreamID, e.Code, e.Cause)
+	}
+	return fmt.Sprintf("stream error: stream ID %d; %v", e.StreamID, e.Code)
+}
+
+func (e *StreamError) Unwrap() error { return e.Cause }
+
+func streamError(id int64, code ErrCode) *StreamError {
+	return &StreamError{StreamID: id, Code: code}
+}
+
+// isUniStream reports whether the stream ID is that of a
+// unidirectional stream.
+func isUniStream(id int64) bool {
+	return id&0x2 != 0
+}
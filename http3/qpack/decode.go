@@ -0,0 +1,402 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"io"
+	"sort"
+)
+
+// A Decoder decodes field sections. It maintains its dynamic table
+// from the instructions of the peer's encoder stream, and writes
+// acknowledgments to the decoder stream.
+type Decoder struct {
+	w   io.Writer // the decoder stream
+	buf []byte    // instructions not yet written to w
+	in  []byte    // partial instruction from the encoder stream
+
+	maxCapacity         uint64
+	maxBlocked          uint64
+	maxFieldSectionSize uint64
+	table               dynamicTable
+	acked               uint64            // insert count known to the peer's encoder
+	blocked             map[uint64]uint64 // Required Insert Count of blocked streams
+}
+
+// NewDecoder returns a Decoder that writes decoder stream
+// instructions to w. The maximum table capacity and number of blocked
+// streams are those sent to the peer in the
+// SETTINGS_QPACK_MAX_TABLE_CAPACITY and SETTINGS_QPACK_BLOCKED_STREAMS
+// settings. If maxTableCapacity is zero, the peer may only use the
+// static table and w may be nil.
+func NewDecoder(w io.Writer, maxTableCapacity, maxBlockedStreams uint64) *Decoder {
+	return &Decoder{
+		w:                   w,
+		maxCapacity:         maxTableCapacity,
+		maxBlocked:          maxBlockedStreams,
+		maxFieldSectionSize: ^uint64(0),
+	}
+}
+
+// SetMaxFieldSectionSize limits the size of decoded field sections,
+// computed as for the SETTINGS_MAX_FIELD_SECTION_SIZE setting of
+// HTTP/3: the sum of the lengths of the names and values of the
+// fields, plus 32 for each field.
+func (d *Decoder) SetMaxFieldSectionSize(n uint64) {
+	d.maxFieldSectionSize = n
+}
+
+// flush writes the buffered instructions to the decoder stream.
+func (d *Decoder) flush() error {
+	if len(d.buf) == 0 || d.w == nil {
+		return nil
+	}
+	_, err := d.w.Write(d.buf)
+	d.buf = d.buf[:0]
+	return err
+}
+
+// HandleEncoderStream processes data received on the peer's encoder
+// stream, RFC 9204, Section 4.3. Instructions may be split across
+// calls. It returns an *Error with the code EncoderStreamError if an
+// instruction is invalid.
+//
+// Entries inserted into the dynamic table may unblock field sections;
+// Unblocked reports the streams they belong to.
+func (d *Decoder) HandleEncoderStream(b []byte) error {
+	d.in = append(d.in, b...)
+	for len(d.in) > 0 {
+		n, err := d.handleEncoderInstruction(d.in)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		d.in = d.in[n:]
+	}
+	if count := d.table.insertCount(); count > d.acked {
+		// Insert Count Increment.
+		d.buf = appendInt(d.buf, 0x00, 6, count-d.acked)
+		d.acked = count
+	}
+	return d.flush()
+}
+
+// handleEncoderInstruction processes the instruction at the start of
+// b, and returns its length, or 0 if b ends before it.
+func (d *Decoder) handleEncoderInstruction(b []byte) (int, error) {
+	c := b[0]
+	var (
+		f   HeaderField
+		off int
+	)
+	switch {
+	case c&0x80 != 0:
+		// Insert with name reference.
+		i, n := consumeInt(b, 6)
+		if n <= 0 {
+			return 0, literalError(n, encoderStreamError)
+		}
+		off = n
+		var ok bool
+		if c&0x40 != 0 {
+			ok = i < uint64(len(staticTable))
+			if ok {
+				f.Name = staticTable[i].Name
+			}
+		} else if count := d.table.insertCount(); i < count {
+			var e HeaderField
+			e, ok = d.table.get(count - 1 - i)
+			f.Name = e.Name
+		}
+		if !ok {
+			return 0, encoderStreamError("invalid name reference")
+		}
+	case c&0x40 != 0:
+		// Insert with literal name.
+		name, n := consumeString(b, 5, d.table.capacity)
+		if n <= 0 {
+			return 0, literalError(n, encoderStreamError)
+		}
+		off = n
+		f.Name = name
+	case c&0x20 != 0:
+		// Set Dynamic Table Capacity.
+		capacity, n := consumeInt(b, 5)
+		if n <= 0 {
+			return 0, literalError(n, encoderStreamError)
+		}
+		if capacity > d.maxCapacity {
+			return 0, encoderStreamError("dynamic table capacity exceeds the limit")
+		}
+		d.table.setCapacity(capacity, ^uint64(0))
+		return n, nil
+	default:
+		// Duplicate.
+		i, n := consumeInt(b, 5)
+		if n <= 0 {
+			return 0, literalError(n, encoderStreamError)
+		}
+		count := d.table.insertCount()
+		if i >= count {
+			return 0, encoderStreamError("invalid duplicate index")
+		}
+		e, ok := d.table.get(count - 1 - i)
+		if !ok || !d.table.insert(e, ^uint64(0)) {
+			return 0, encoderStreamError("invalid duplicate")
+		}
+		return n, nil
+	}
+	v, n := consumeString(b[off:], 7, d.table.capacity)
+	if n <= 0 {
+		return 0, literalError(n, encoderStreamError)
+	}
+	f.Value = v
+	if !d.table.insert(f, ^uint64(0)) {
+		return 0, encoderStreamError("entry larger than the dynamic table capacity")
+	}
+	return off + n, nil
+}
+
+// literalError returns the error for the result n of consumeInt or
+// consumeString: none if the input ended early, and an error built
+// with mkErr if it is invalid.
+func literalError(n int, mkErr func(string) error) error {
+	if n == 0 {
+		return nil
+	}
+	return mkErr("invalid integer or string literal")
+}
+
+// DecodeFieldSection decodes a field section received on the given
+// stream, whose contents must be complete.
+//
+// If the field section refers to dynamic table entries that were not
+// received yet, DecodeFieldSection returns ErrBlocked and the stream
+// counts as blocked until the field section is decoded again, after
+// it is reported by Unblocked, or the stream is canceled with
+// CancelStream. It returns an *Error with the code
+// DecompressionFailed if the field section is invalid or too many
+// streams would be blocked.
+//
+// If the fields exceed the limit set with SetMaxFieldSectionSize,
+// DecodeFieldSection returns ErrFieldSectionTooLarge; the stream
+// should then be abandoned and canceled with CancelStream.
+func (d *Decoder) DecodeFieldSection(streamID uint64, b []byte) ([]HeaderField, error) {
+	encRIC, n := consumeInt(b, 8)
+	if n <= 0 {
+		return nil, decompressionError("invalid field section prefix")
+	}
+	b = b[n:]
+	ric, err := d.requiredInsertCount(encRIC)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, decompressionError("invalid field section prefix")
+	}
+	negative := b[0]&0x80 != 0
+	delta, n := consumeInt(b, 7)
+	if n <= 0 {
+		return nil, decompressionError("invalid field section prefix")
+	}
+	b = b[n:]
+	if ric > d.table.insertCount() {
+		if _, ok := d.blocked[streamID]; !ok {
+			if uint64(len(d.blocked)) >= d.maxBlocked {
+				return nil, decompressionError("too many blocked streams")
+			}
+			if d.blocked == nil {
+				d.blocked = make(map[uint64]uint64)
+			}
+		}
+		d.blocked[streamID] = ric
+		return nil, ErrBlocked
+	}
+	delete(d.blocked, streamID)
+	var base uint64
+	if !negative {
+		base = ric + delta
+	} else {
+		if delta >= ric {
+			return nil, decompressionError("invalid base")
+		}
+		base = ric - delta - 1
+	}
+
+	var (
+		fields []HeaderField
+		size   uint64
+	)
+	// dynamic returns the dynamic table entry with the absolute
+	// index i, which must be below the Required Insert Count.
+	dynamic := func(i uint64) (HeaderField, bool) {
+		if i >= ric {
+			return HeaderField{}, false
+		}
+		return d.table.get(i)
+	}
+	for len(b) > 0 {
+		var (
+			f  HeaderField
+			ok bool
+		)
+		max := d.maxFieldSectionSize
+		if max != ^uint64(0) {
+			max -= size
+		}
+		c := b[0]
+		switch {
+		case c&0x80 != 0:
+			// Indexed field line.
+			i, n := consumeInt(b, 6)
+			if n <= 0 {
+				return nil, decompressionError("invalid index")
+			}
+			b = b[n:]
+			if c&0x40 != 0 {
+				if ok = i < uint64(len(staticTable)); ok {
+					f = staticTable[i]
+				}
+			} else if i < base {
+				f, ok = dynamic(base - 1 - i)
+			}
+		case c&0xf0 == 0x10:
+			// Indexed field line with post-base index.
+			i, n := consumeInt(b, 4)
+			if n <= 0 {
+				return nil, decompressionError("invalid index")
+			}
+			b = b[n:]
+			f, ok = dynamic(base + i)
+		case c&0x40 != 0:
+			// Literal field line with name reference.
+			i, n := consumeInt(b, 4)
+			if n <= 0 {
+				return nil, decompressionError("invalid index")
+			}
+			b = b[n:]
+			var e HeaderField
+			if c&0x10 != 0 {
+				if ok = i < uint64(len(staticTable)); ok {
+					e = staticTable[i]
+				}
+			} else if i < base {
+				e, ok = dynamic(base - 1 - i)
+			}
+			f = HeaderField{Name: e.Name, Sensitive: c&0x20 != 0}
+		case c&0x20 != 0:
+			// Literal field line with literal name.
+			name, n := consumeString(b, 3, max)
+			if n <= 0 {
+				return nil, d.stringError(n)
+			}
+			b = b[n:]
+			f = HeaderField{Name: name, Sensitive: c&0x10 != 0}
+			ok = true
+		default:
+			// Literal field line with post-base name reference.
+			i, n := consumeInt(b, 3)
+			if n <= 0 {
+				return nil, decompressionError("invalid index")
+			}
+			b = b[n:]
+			var e HeaderField
+			e, ok = dynamic(base + i)
+			f = HeaderField{Name: e.Name, Sensitive: c&0x08 != 0}
+		}
+		if !ok {
+			return nil, decompressionError("invalid table reference")
+		}
+		if c&0xc0 == 0x40 || c&0xe0 == 0x20 || c&0xf0 == 0 {
+			// The field line carries a literal value.
+			v, n := consumeString(b, 7, max)
+			if n <= 0 {
+				return nil, d.stringError(n)
+			}
+			b = b[n:]
+			f.Value = v
+		}
+		size += fieldSize(f)
+		if size > d.maxFieldSectionSize {
+			return nil, ErrFieldSectionTooLarge
+		}
+		fields = append(fields, f)
+	}
+	if ric > 0 {
+		// Section Acknowledgment.
+		d.buf = appendInt(d.buf, 0x80, 7, streamID)
+		if ric > d.acked {
+			d.acked = ric
+		}
+		if err := d.flush(); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// stringError returns the error for a string literal of a field
+// section that consumeString rejected.
+func (d *Decoder) stringError(n int) error {
+	if n == lengthTooLong {
+		return ErrFieldSectionTooLarge
+	}
+	return decompressionError("invalid string literal")
+}
+
+// requiredInsertCount decodes the Required Insert Count of a field
+// section, RFC 9204, Section 4.5.1.1.
+func (d *Decoder) requiredInsertCount(encoded uint64) (uint64, error) {
+	if encoded == 0 {
+		return 0, nil
+	}
+	maxEntries := d.maxCapacity / entryOverhead
+	fullRange := 2 * maxEntries
+	if encoded > fullRange {
+		return 0, decompressionError("invalid required insert count")
+	}
+	maxValue := d.table.insertCount() + maxEntries
+	maxWrapped := maxValue / fullRange * fullRange
+	ric := maxWrapped + encoded - 1
+	if ric > maxValue {
+		if ric <= fullRange {
+			return 0, decompressionError("invalid required insert count")
+		}
+		ric -= fullRange
+	}
+	if ric == 0 {
+		return 0, decompressionError("invalid required insert count")
+	}
+	return ric, nil
+}
+
+// Unblocked returns the streams whose blocked field sections can now
+// be decoded, in increasing order.
+func (d *Decoder) Unblocked() []uint64 {
+	var ids []uint64
+	count := d.table.insertCount()
+	for id, ric := range d.blocked {
+		if ric <= count {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// CancelStream reports that the field sections of the stream will not
+// be decoded because the stream was reset or abandoned, RFC 9204,
+// Section 4.4.2.
+func (d *Decoder) CancelStream(streamID uint64) error {
+	delete(d.blocked, streamID)
+	if d.maxCapacity == 0 {
+		// The peer's encoder cannot refer to the dynamic table.
+		return nil
+	}
+	d.buf = appendInt(d.buf, 0x40, 6, streamID)
+	return d.flush()
+}
@@ -0,0 +1,353 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"errors"
+	"io"
+)
+
+// An Encoder encodes field sections. It inserts entries into its
+// dynamic table by writing instructions to the encoder stream, and
+// learns which of them the peer's decoder received from the decoder
+// stream.
+type Encoder struct {
+	w   io.Writer // the encoder stream
+	buf []byte    // instructions not yet written to w
+	in  []byte    // partial instruction from the decoder stream
+
+	maxCapacity   uint64 // of the peer's decoder
+	maxBlocked    uint64 // streams the peer's decoder allows to block
+	table         dynamicTable
+	knownReceived uint64               // Known Received Count, RFC 9204, Section 2.1.4
+	sections      map[uint64][]section // unacknowledged field sections, by stream
+}
+
+// A section is a field section referring to the dynamic table.
+type section struct {
+	requiredInsertCount uint64
+	minRef              uint64 // smallest absolute index referred to
+}
+
+// NewEncoder returns an Encoder that writes encoder stream
+// instructions to w. The dynamic table capacity is initially zero, so
+// that only the static table is used and w may be nil until
+// SetTableCapacity is called.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetPeerSettings records the settings of the peer's decoder: its
+// SETTINGS_QPACK_MAX_TABLE_CAPACITY and
+// SETTINGS_QPACK_BLOCKED_STREAMS. It must be called before
+// SetTableCapacity, and not once the dynamic table is in use.
+func (e *Encoder) SetPeerSettings(maxTableCapacity, maxBlockedStreams uint64) {
+	e.maxCapacity = maxTableCapacity
+	e.maxBlocked = maxBlockedStreams
+}
+
+var (
+	errCapacity      = errors.New("qpack: dynamic table capacity exceeds the peer's limit")
+	errEntriesInUse  = errors.New("qpack: cannot evict dynamic table entries still referred to")
+	errNoEncoderSink = errors.New("qpack: no encoder stream")
+)
+
+// SetTableCapacity sets the capacity of the dynamic table, which must
+// not exceed the limit set by the peer with SetPeerSettings, and
+// writes the instruction announcing it to the encoder stream. A
+// capacity of zero turns the dynamic table off once the entries
+// still referred to are acknowledged.
+func (e *Encoder) SetTableCapacity(capacity uint64) error {
+	if capacity > e.maxCapacity {
+		return errCapacity
+	}
+	if capacity > 0 && e.w == nil {
+		return errNoEncoderSink
+	}
+	if !e.table.setCapacity(capacity, e.evictionLimit()) {
+		return errEntriesInUse
+	}
+	if capacity > 0 && e.table.byField == nil {
+		e.table.byField = make(map[HeaderField]uint64)
+		e.table.byName = make(map[string]uint64)
+	}
+	e.buf = appendInt(e.buf, 0x20, 5, capacity)
+	return e.flush()
+}
+
+// flush writes the buffered instructions to the encoder stream.
+func (e *Encoder) flush() error {
+	if len(e.buf) == 0 || e.w == nil {
+		return nil
+	}
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+// evictionLimit returns the absolute index of the oldest entry
+// referred to by an unacknowledged field section. No entry from
+// there on may be evicted.
+func (e *Encoder) evictionLimit() uint64 {
+	limit := e.table.insertCount()
+	for _, secs := range e.sections {
+		for _, s := range secs {
+			if s.minRef < limit {
+				limit = s.minRef
+			}
+		}
+	}
+	return limit
+}
+
+// isBlocking reports whether the stream has a field section that the
+// peer's decoder may be unable to decode yet.
+func (e *Encoder) isBlocking(streamID uint64) bool {
+	for _, s := range e.sections[streamID] {
+		if s.requiredInsertCount > e.knownReceived {
+			return true
+		}
+	}
+	return false
+}
+
+// canBlock reports whether a field section on the stream may refer to
+// entries the peer's decoder has not acknowledged yet.
+func (e *Encoder) canBlock(streamID uint64) bool {
+	if e.isBlocking(streamID) {
+		return true
+	}
+	var n uint64
+	for id := range e.sections {
+		if e.isBlocking(id) {
+			n++
+		}
+	}
+	return n < e.maxBlocked
+}
+
+// Kinds of field line representations, RFC 9204, Section 4.5.
+const (
+	lineIndexedStatic = iota
+	lineIndexedDynamic
+	lineNameRefStatic
+	lineNameRefDynamic
+	lineLiteral
+)
+
+type fieldLine struct {
+	kind  int
+	index uint64 // static or absolute index
+	f     HeaderField
+}
+
+// EncodeFieldSection returns the encoding of a field section sent on
+// the given stream. Before returning, it writes the instructions for
+// any entries it inserted into the dynamic table to the encoder
+// stream.
+func (e *Encoder) EncodeFieldSection(streamID uint64, fields []HeaderField) ([]byte, error) {
+	if e.table.capacity == 0 {
+		return AppendStaticFieldSection(nil, fields), nil
+	}
+	var (
+		lines    []fieldLine
+		ric      uint64 // Required Insert Count
+		minRef   = ^uint64(0)
+		blocking = e.canBlock(streamID)
+	)
+	ref := func(abs uint64) bool {
+		if abs >= e.knownReceived && !blocking {
+			return false
+		}
+		if abs+1 > ric {
+			ric = abs + 1
+		}
+		if abs < minRef {
+			minRef = abs
+		}
+		return true
+	}
+	for _, f := range fields {
+		if i, ok := staticTableIndex[f]; ok && !f.Sensitive {
+			lines = append(lines, fieldLine{kind: lineIndexedStatic, index: i})
+			continue
+		}
+		if !f.Sensitive {
+			abs, ok := e.table.byField[f]
+			if !ok {
+				abs, ok = e.insert(f, minRef)
+			}
+			if ok && ref(abs) {
+				lines = append(lines, fieldLine{kind: lineIndexedDynamic, index: abs})
+				continue
+			}
+		}
+		if i, ok := staticNameIndex[f.Name]; ok {
+			lines = append(lines, fieldLine{kind: lineNameRefStatic, index: i, f: f})
+		} else if abs, ok := e.table.byName[f.Name]; ok && ref(abs) {
+			lines = append(lines, fieldLine{kind: lineNameRefDynamic, index: abs, f: f})
+		} else {
+			lines = append(lines, fieldLine{kind: lineLiteral, f: f})
+		}
+	}
+	if err := e.flush(); err != nil {
+		return nil, err
+	}
+	if ric > 0 {
+		if e.sections == nil {
+			e.sections = make(map[uint64][]section)
+		}
+		e.sections[streamID] = append(e.sections[streamID], section{ric, minRef})
+	}
+	return e.appendFieldLines(nil, ric, lines), nil
+}
+
+// insert inserts f into the dynamic table if it is worth it, without
+// evicting entries from limit on, and returns its absolute index.
+func (e *Encoder) insert(f HeaderField, limit uint64) (uint64, bool) {
+	size := fieldSize(f)
+	if size > e.table.capacity*3/4 {
+		// It would flush most of the table.
+		return 0, false
+	}
+	if l := e.evictionLimit(); l < limit {
+		limit = l
+	}
+	n, ok := e.table.evictable(size, e.table.capacity, limit)
+	if !ok {
+		return 0, false
+	}
+	if i, ok := staticNameIndex[f.Name]; ok {
+		// Insert with name reference, static table.
+		e.buf = appendInt(e.buf, 0xc0, 6, i)
+	} else if abs, ok := e.table.byName[f.Name]; ok && abs >= e.table.dropped+uint64(n) {
+		// Insert with name reference, dynamic table; the entry
+		// is not evicted by the insertion.
+		e.buf = appendInt(e.buf, 0x80, 6, e.table.insertCount()-1-abs)
+	} else {
+		// Insert with literal name.
+		e.buf = appendString(e.buf, 0x40, 5, f.Name)
+	}
+	e.buf = appendString(e.buf, 0, 7, f.Value)
+	e.table.insert(f, limit)
+	return e.table.insertCount() - 1, true
+}
+
+// appendFieldLines appends the encoded field section prefix and field
+// lines, RFC 9204, Section 4.5. Base is equal to the Required Insert
+// Count, so that all references to the dynamic table are relative.
+func (e *Encoder) appendFieldLines(b []byte, ric uint64, lines []fieldLine) []byte {
+	if ric == 0 {
+		b = append(b, 0, 0)
+	} else {
+		maxEntries := e.maxCapacity / entryOverhead
+		b = appendInt(b, 0, 8, ric%(2*maxEntries)+1)
+		b = append(b, 0) // Sign and Delta Base are zero.
+	}
+	for _, l := range lines {
+		var never byte
+		if l.f.Sensitive {
+			never = 0x20
+		}
+		switch l.kind {
+		case lineIndexedStatic:
+			b = appendInt(b, 0xc0, 6, l.index)
+		case lineIndexedDynamic:
+			b = appendInt(b, 0x80, 6, ric-1-l.index)
+		case lineNameRefStatic:
+			b = appendInt(b, 0x50|never, 4, l.index)
+			b = appendString(b, 0, 7, l.f.Value)
+		case lineNameRefDynamic:
+			b = appendInt(b, 0x40|never, 4, ric-1-l.index)
+			b = appendString(b, 0, 7, l.f.Value)
+		case lineLiteral:
+			b = appendString(b, 0x20|never>>1, 3, l.f.Name)
+			b = appendString(b, 0, 7, l.f.Value)
+		}
+	}
+	return b
+}
+
+// AppendStaticFieldSection appends the encoding of a field section
+// that only refers to the static table. It is what an Encoder with a
+// dynamic table capacity of zero produces, and needs no state.
+func AppendStaticFieldSection(b []byte, fields []HeaderField) []byte {
+	// Required Insert Count and Base are both zero.
+	b = append(b, 0, 0)
+	for _, f := range fields {
+		var never byte
+		if f.Sensitive {
+			never = 0x20
+		}
+		if i, ok := staticTableIndex[f]; ok && !f.Sensitive {
+			// Indexed field line, static table.
+			b = appendInt(b, 0xc0, 6, i)
+		} else if i, ok := staticNameIndex[f.Name]; ok {
+			// Literal field line with name reference, static
+			// table.
+			b = appendInt(b, 0x50|never, 4, i)
+			b = appendString(b, 0, 7, f.Value)
+		} else {
+			// Literal field line with literal name.
+			b = appendString(b, 0x20|never>>1, 3, f.Name)
+			b = appendString(b, 0, 7, f.Value)
+		}
+	}
+	return b
+}
+
+// HandleDecoderStream processes data received on the peer's decoder
+// stream, RFC 9204, Section 4.4. Instructions may be split across
+// calls. It returns an *Error with the code DecoderStreamError if an
+// instruction is invalid.
+func (e *Encoder) HandleDecoderStream(b []byte) error {
+	e.in = append(e.in, b...)
+	for len(e.in) > 0 {
+		var (
+			v uint64
+			n int
+		)
+		c := e.in[0]
+		switch {
+		case c&0x80 != 0:
+			v, n = consumeInt(e.in, 7)
+		default:
+			v, n = consumeInt(e.in, 6)
+		}
+		if n == 0 {
+			break
+		}
+		if n < 0 {
+			return decoderStreamError("invalid integer")
+		}
+		e.in = e.in[n:]
+		switch {
+		case c&0x80 != 0:
+			// Section Acknowledgment.
+			secs := e.sections[v]
+			if len(secs) == 0 {
+				return decoderStreamError("acknowledgment of unknown field section")
+			}
+			if secs[0].requiredInsertCount > e.knownReceived {
+				e.knownReceived = secs[0].requiredInsertCount
+			}
+			if len(secs) == 1 {
+				delete(e.sections, v)
+			} else {
+				e.sections[v] = secs[1:]
+			}
+		case c&0x40 != 0:
+			// Stream Cancellation.
+			delete(e.sections, v)
+		default:
+			// Insert Count Increment.
+			if v == 0 || v > e.table.insertCount()-e.knownReceived {
+				return decoderStreamError("invalid insert count increment")
+			}
+			e.knownReceived += v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qpack implements QPACK, the field compression format of
+// HTTP/3, as defined in RFC 9204.
+//
+// QPACK is the HTTP/3 counterpart of HPACK: field lines refer to
+// entries of a static table and of a dynamic table, but the dynamic
+// table is updated through separate encoder and decoder streams, so
+// that field sections on different request streams can be processed
+// in any order. A field section referring to dynamic table entries
+// that were not yet received is blocked until they are.
+//
+// An Encoder or Decoder whose dynamic table capacity is zero only
+// uses the static table. It keeps no state beyond its configuration,
+// needs no encoder or decoder stream, and never blocks.
+//
+// Encoders and Decoders are not safe for concurrent use.
+package qpack // import "golang.org/x/net/http3/qpack"
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// A HeaderField is a name-value pair. It is the same type as in
+// package hpack, so that fields can be shared by HTTP/2 and HTTP/3
+// code. Sensitive fields are never inserted into the dynamic table,
+// and are encoded so that intermediaries never do so either.
+type HeaderField = hpack.HeaderField
+
+// entryOverhead is added to the length of the name and value of an
+// entry to compute its size, RFC 9204, Section 3.2.1.
+const entryOverhead = 32
+
+func fieldSize(f HeaderField) uint64 {
+	return uint64(len(f.Name)+len(f.Value)) + entryOverhead
+}
+
+// An ErrorCode is a QPACK error code, RFC 9204, Section 6.
+type ErrorCode uint64
+
+const (
+	// DecompressionFailed indicates that a field section could
+	// not be interpreted.
+	DecompressionFailed ErrorCode = 0x200
+
+	// EncoderStreamError indicates that an instruction on the
+	// encoder stream could not be interpreted.
+	EncoderStreamError ErrorCode = 0x201
+
+	// DecoderStreamError indicates that an instruction on the
+	// decoder stream could not be interpreted.
+	DecoderStreamError ErrorCode = 0x202
+)
+
+var errorCodeName = map[ErrorCode]string{
+	DecompressionFailed: "QPACK_DECOMPRESSION_FAILED",
+	EncoderStreamError:  "QPACK_ENCODER_STREAM_ERROR",
+	DecoderStreamError:  "QPACK_DECODER_STREAM_ERROR",
+}
+
+func (e ErrorCode) String() string {
+	if s, ok := errorCodeName[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint64(e))
+}
+
+// An Error is a QPACK error. HTTP/3 treats each of them as a
+// connection error carrying Code.
+type Error struct {
+	Code   ErrorCode
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("qpack: %v: %s", e.Code, e.Reason)
+}
+
+func decompressionError(reason string) error {
+	return &Error{Code: DecompressionFailed, Reason: reason}
+}
+
+func encoderStreamError(reason string) error {
+	return &Error{Code: EncoderStreamError, Reason: reason}
+}
+
+func decoderStreamError(reason string) error {
+	return &Error{Code: DecoderStreamError, Reason: reason}
+}
+
+var (
+	// ErrBlocked is returned by Decoder.DecodeFieldSection for a
+	// field section that refers to dynamic table entries not yet
+	// received on the encoder stream.
+	ErrBlocked = errors.New("qpack: field section blocked on the encoder stream")
+
+	// ErrFieldSectionTooLarge is returned by
+	// Decoder.DecodeFieldSection when the decoded fields exceed
+	// the limit set with SetMaxFieldSectionSize.
+	ErrFieldSectionTooLarge = errors.New("qpack: field section too large")
+)
+
+// appendInt appends v as an integer with an n-bit prefix, whose first
+// byte also holds the bits of flags, RFC 9204, Section 4.1.1.
+func appendInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	v -= max
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// consumeInt parses an integer with an n-bit prefix. It returns a
+// length of 0 if b ends before the integer, and -1 if the integer
+// overflows 62 bits.
+func consumeInt(b []byte, n uint) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	if v < max {
+		return v, 1
+	}
+	var m uint
+	for i := 1; i < len(b); i++ {
+		if m > 56 {
+			return 0, -1
+		}
+		v += uint64(b[i]&0x7f) << m
+		if v >= 1<<62 {
+			return 0, -1
+		}
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+		m += 7
+	}
+	return 0, 0
+}
+
+// appendString appends a string literal with an n-bit length prefix,
+// Huffman-encoded if that is shorter, RFC 9204, Section 4.1.2. The
+// Huffman flag is the bit above the prefix.
+func appendString(b []byte, flags byte, n uint, s string) []byte {
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendInt(b, flags|1<<n, n, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendInt(b, flags, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// lengthTooLong is the length returned by consumeString for strings
+// that are too long.
+const lengthTooLong = -2
+
+// consumeString parses a string literal with an n-bit length prefix,
+// no longer than max once decoded. Like consumeInt, it returns a
+// length of 0 if b ends before the string and -1 if it is invalid,
+// and it returns lengthTooLong if it is longer than max.
+func consumeString(b []byte, n uint, max uint64) (string, int) {
+	if len(b) == 0 {
+		return "", 0
+	}
+	huffman := b[0]&(1<<n) != 0
+	l, m := consumeInt(b, n)
+	if m <= 0 {
+		return "", m
+	}
+	if huffman && l > max*8/5+1 || !huffman && l > max {
+		// Huffman codes are at least five bits long.
+		return "", lengthTooLong
+	}
+	if uint64(len(b)-m) < l {
+		return "", 0
+	}
+	v := b[m : m+int(l)]
+	if !huffman {
+		return string(v), m + int(l)
+	}
+	s, err := hpack.HuffmanDecodeToString(v)
+	if err != nil {
+		return "", -1
+	}
+	if uint64(len(s)) > max {
+		return "", lengthTooLong
+	}
+	return s, m + int(l)
+}
@@ -0,0 +1,346 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestInt(t *testing.T) {
+	for _, test := range []struct {
+		n uint
+		v uint64
+		b []byte
+	}{
+		{5, 10, []byte{10}},
+		{5, 1337, []byte{31, 154, 10}},
+		{8, 42, []byte{42}},
+		{6, 63, []byte{63, 0}},
+		{7, 1<<62 - 1, appendInt(nil, 0, 7, 1<<62-1)},
+	} {
+		if got := appendInt(nil, 0, test.n, test.v); !bytes.Equal(got, test.b) {
+			t.Errorf("appendInt(%d, %d) = %x; want %x", test.n, test.v, got, test.b)
+		}
+		v, n := consumeInt(test.b, test.n)
+		if v != test.v || n != len(test.b) {
+			t.Errorf("consumeInt(%x, %d) = %d, %d; want %d, %d", test.b, test.n, v, n, test.v, len(test.b))
+		}
+		if _, n := consumeInt(test.b[:len(test.b)-1], test.n); n != 0 {
+			t.Errorf("consumeInt(%x, %d) = _, %d; want 0 for truncated input", test.b[:len(test.b)-1], test.n, n)
+		}
+	}
+	overflow := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	if _, n := consumeInt(overflow, 8); n != -1 {
+		t.Errorf("consumeInt of overflowing integer = _, %d; want -1", n)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, s := range []string{"", "custom-key", "www.example.com", "\x00\xff"} {
+		b := appendString(nil, 0, 7, s)
+		got, n := consumeString(b, 7, 100)
+		if got != s || n != len(b) {
+			t.Errorf("consumeString(appendString(%q)) = %q, %d; want %q, %d", s, got, n, s, len(b))
+		}
+		if len(s) > 1 {
+			if _, n := consumeString(b, 7, uint64(len(s)-1)); n != lengthTooLong {
+				t.Errorf("consumeString(%q) with short limit = _, %d; want %d", s, n, lengthTooLong)
+			}
+		}
+	}
+}
+
+// TestDecoderRFCExamples decodes the examples of RFC 9204, Appendix B.
+func TestDecoderRFCExamples(t *testing.T) {
+	var decStream bytes.Buffer
+	d := NewDecoder(&decStream, 220, 10)
+
+	// B.1. Literal Field Line with Name Reference.
+	fields, err := d.DecodeFieldSection(0, mustHex("0000 510b 2f69 6e64 6578 2e68 746d 6c"))
+	want := []HeaderField{{Name: ":path", Value: "/index.html"}}
+	if err != nil || !reflect.DeepEqual(fields, want) {
+		t.Fatalf("B.1: DecodeFieldSection = %v, %v; want %v", fields, err, want)
+	}
+
+	// B.2. Dynamic Table. The field section arrives before the
+	// instructions it depends on.
+	section := mustHex("0381 10 11")
+	if _, err := d.DecodeFieldSection(4, section); err != ErrBlocked {
+		t.Fatalf("B.2: DecodeFieldSection before encoder instructions: %v; want ErrBlocked", err)
+	}
+	if err := d.HandleEncoderStream(mustHex("3fbd01 c00f 7777 772e 6578 616d 706c 652e 636f 6d c10c 2f73 616d 706c 652f 7061 7468")); err != nil {
+		t.Fatalf("B.2: HandleEncoderStream: %v", err)
+	}
+	if got := d.Unblocked(); !reflect.DeepEqual(got, []uint64{4}) {
+		t.Fatalf("Unblocked = %v; want [4]", got)
+	}
+	fields, err = d.DecodeFieldSection(4, section)
+	want = []HeaderField{
+		{Name: ":authority", Value: "www.example.com"},
+		{Name: ":path", Value: "/sample/path"},
+	}
+	if err != nil || !reflect.DeepEqual(fields, want) {
+		t.Fatalf("B.2: DecodeFieldSection = %v, %v; want %v", fields, err, want)
+	}
+	// Insert Count Increment (2), then Section Acknowledgment (4).
+	if got, want := decStream.Bytes(), mustHex("02 84"); !bytes.Equal(got, want) {
+		t.Errorf("B.2: decoder stream = %x; want %x", got, want)
+	}
+}
+
+// pair is an Encoder connected to a Decoder, with the streams
+// between them buffered.
+type pair struct {
+	enc                  *Encoder
+	dec                  *Decoder
+	encStream, decStream bytes.Buffer
+}
+
+func newPair(t *testing.T, capacity, blocked uint64) *pair {
+	p := &pair{}
+	p.enc = NewEncoder(&p.encStream)
+	p.dec = NewDecoder(&p.decStream, capacity, blocked)
+	p.enc.SetPeerSettings(capacity, blocked)
+	if err := p.enc.SetTableCapacity(capacity); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// deliverEncoderStream passes the encoder stream to the decoder.
+func (p *pair) deliverEncoderStream(t *testing.T) {
+	t.Helper()
+	if err := p.dec.HandleEncoderStream(p.encStream.Next(p.encStream.Len())); err != nil {
+		t.Fatalf("HandleEncoderStream: %v", err)
+	}
+}
+
+// deliverDecoderStream passes the decoder stream to the encoder.
+func (p *pair) deliverDecoderStream(t *testing.T) {
+	t.Helper()
+	if err := p.enc.HandleDecoderStream(p.decStream.Next(p.decStream.Len())); err != nil {
+		t.Fatalf("HandleDecoderStream: %v", err)
+	}
+}
+
+var testFields = []HeaderField{
+	{Name: ":method", Value: "GET"},
+	{Name: ":scheme", Value: "https"},
+	{Name: ":authority", Value: "www.example.com"},
+	{Name: ":path", Value: "/index.html"},
+	{Name: "user-agent", Value: "Go-http-client/3.0"},
+	{Name: "x-custom", Value: "custom value"},
+	{Name: "authorization", Value: "secret", Sensitive: true},
+}
+
+func TestRoundTripDynamic(t *testing.T) {
+	p := newPair(t, 4096, 0)
+	var sizes []int
+	for i := uint64(0); i < 3; i++ {
+		b, err := p.enc.EncodeFieldSection(4*i, testFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(b))
+		p.deliverEncoderStream(t)
+		fields, err := p.dec.DecodeFieldSection(4*i, b)
+		if err != nil {
+			t.Fatalf("DecodeFieldSection #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(fields, testFields) {
+			t.Fatalf("DecodeFieldSection #%d =\n%v\nwant\n%v", i, fields, testFields)
+		}
+		p.deliverDecoderStream(t)
+	}
+	// No stream may block, so the first field section cannot use
+	// the entries it inserts, but the following ones do.
+	if sizes[1] >= sizes[0] || sizes[2] != sizes[1] {
+		t.Errorf("field section sizes = %v; want the first larger than the others", sizes)
+	}
+	if sizes[1] > 16 {
+		t.Errorf("field section size once the table is populated = %d; want at most 16", sizes[1])
+	}
+}
+
+func TestRoundTripBlocking(t *testing.T) {
+	p := newPair(t, 4096, 1)
+	b0, _ := p.enc.EncodeFieldSection(0, testFields)
+	b4, _ := p.enc.EncodeFieldSection(4, []HeaderField{{Name: "x-other", Value: "v"}})
+
+	// The first stream refers to the new entries, which makes it
+	// blocking; the second one cannot.
+	if _, err := p.dec.DecodeFieldSection(0, b0); err != ErrBlocked {
+		t.Fatalf("DecodeFieldSection(0) = %v; want ErrBlocked", err)
+	}
+	if fields, err := p.dec.DecodeFieldSection(4, b4); err != nil || fields[0].Value != "v" {
+		t.Fatalf("DecodeFieldSection(4) = %v, %v; want non-blocking section", fields, err)
+	}
+	p.deliverEncoderStream(t)
+	fields, err := p.dec.DecodeFieldSection(0, b0)
+	if err != nil || !reflect.DeepEqual(fields, testFields) {
+		t.Fatalf("DecodeFieldSection(0) = %v, %v; want %v", fields, err, testFields)
+	}
+	p.deliverDecoderStream(t)
+	if len(p.enc.sections) != 0 || p.enc.knownReceived != p.enc.table.insertCount() {
+		t.Errorf("after acknowledgments: %d unacknowledged streams, known received count %d of %d",
+			len(p.enc.sections), p.enc.knownReceived, p.enc.table.insertCount())
+	}
+}
+
+func TestDecoderBlockedLimit(t *testing.T) {
+	p := newPair(t, 4096, 1)
+	b0, _ := p.enc.EncodeFieldSection(0, testFields[2:3])
+	if _, err := p.dec.DecodeFieldSection(0, b0); err != ErrBlocked {
+		t.Fatalf("DecodeFieldSection(0) = %v; want ErrBlocked", err)
+	}
+	// A second blocked stream exceeds the limit.
+	if _, err := p.dec.DecodeFieldSection(8, b0); !isCode(err, DecompressionFailed) {
+		t.Errorf("DecodeFieldSection of second blocked stream = %v; want %v", err, DecompressionFailed)
+	}
+	p.dec.CancelStream(0)
+	if got := p.decStream.Bytes(); !bytes.Equal(got, []byte{0x40}) {
+		t.Errorf("decoder stream after CancelStream = %x; want 40", got)
+	}
+	p.deliverDecoderStream(t)
+	if len(p.enc.sections) != 0 {
+		t.Errorf("encoder still tracks %d streams after cancellation", len(p.enc.sections))
+	}
+}
+
+func TestEncoderEviction(t *testing.T) {
+	// The table holds two of the fields below at most.
+	p := newPair(t, 2*(32+20), 0)
+	field := func(i int) HeaderField {
+		return HeaderField{Name: "x-field", Value: strings.Repeat(string(rune('a'+i)), 13)}
+	}
+	for i := 0; i < 6; i++ {
+		f := []HeaderField{field(i), field(i)}
+		b, err := p.enc.EncodeFieldSection(uint64(4*i), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.deliverEncoderStream(t)
+		got, err := p.dec.DecodeFieldSection(uint64(4*i), b)
+		if err != nil || !reflect.DeepEqual(got, f) {
+			t.Fatalf("field section %d: DecodeFieldSection = %v, %v; want %v", i, got, err, f)
+		}
+		p.deliverDecoderStream(t)
+	}
+	if got := len(p.dec.table.entries); got > 2 {
+		t.Errorf("decoder table holds %d entries; want at most 2", got)
+	}
+}
+
+func TestStaticOnly(t *testing.T) {
+	e := NewEncoder(nil)
+	d := NewDecoder(nil, 0, 0)
+	b, err := e.EncodeFieldSection(0, testFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, AppendStaticFieldSection(nil, testFields)) {
+		t.Errorf("EncodeFieldSection without dynamic table differs from AppendStaticFieldSection")
+	}
+	fields, err := d.DecodeFieldSection(0, b)
+	if err != nil || !reflect.DeepEqual(fields, testFields) {
+		t.Errorf("DecodeFieldSection = %v, %v; want %v", fields, err, testFields)
+	}
+	// ":method: GET" is index 17 and ":path: /" is index 1.
+	b = AppendStaticFieldSection(nil, []HeaderField{{Name: ":method", Value: "GET"}, {Name: ":path", Value: "/"}})
+	if want := []byte{0, 0, 0xc0 | 17, 0xc0 | 1}; !bytes.Equal(b, want) {
+		t.Errorf("AppendStaticFieldSection = %x; want %x", b, want)
+	}
+	if err := e.SetTableCapacity(100); err == nil {
+		t.Errorf("SetTableCapacity beyond the peer's limit succeeded")
+	}
+}
+
+func isCode(err error, code ErrorCode) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+func TestDecoderErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"truncated prefix", []byte{0}},
+		{"dynamic reference without table", []byte{2, 0, 0x80}},
+		{"static index out of range", []byte{0, 0, 0xc0 | 0x3f, 100}},
+		{"post-base index without table", []byte{0, 0, 0x10}},
+		{"truncated literal", []byte{0, 0, 0x27, 3, 'a'}},
+		{"bad huffman", []byte{0, 0, 0x5f, 0x1d, 0x81, 0xff}},
+	} {
+		d := NewDecoder(nil, 0, 0)
+		if _, err := d.DecodeFieldSection(0, test.b); !isCode(err, DecompressionFailed) {
+			t.Errorf("%s: DecodeFieldSection(%x) = %v; want %v", test.name, test.b, err, DecompressionFailed)
+		}
+	}
+
+	d := NewDecoder(nil, 0, 0)
+	d.SetMaxFieldSectionSize(100)
+	big := AppendStaticFieldSection(nil, []HeaderField{{Name: "x-big", Value: strings.Repeat("a", 100)}})
+	if _, err := d.DecodeFieldSection(0, big); err != ErrFieldSectionTooLarge {
+		t.Errorf("DecodeFieldSection beyond limit: %v; want ErrFieldSectionTooLarge", err)
+	}
+
+	for _, test := range []struct {
+		name string
+		b    []byte
+	}{
+		{"capacity too large", []byte{0x3f, 0xe2, 0x1f}},
+		{"insert without capacity", mustHex("c00f 7777 772e 6578 616d 706c 652e 636f 6d")},
+		{"invalid duplicate", []byte{0x00}},
+		{"invalid dynamic name reference", []byte{0x3f, 0x81, 0x07, 0x80, 0x00}},
+	} {
+		d := NewDecoder(nil, 4096, 0)
+		if err := d.HandleEncoderStream(test.b); !isCode(err, EncoderStreamError) {
+			t.Errorf("%s: HandleEncoderStream(%x) = %v; want %v", test.name, test.b, err, EncoderStreamError)
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		b    []byte
+	}{
+		{"unknown section", []byte{0x84}},
+		{"zero increment", []byte{0x00}},
+		{"increment beyond inserts", []byte{0x01}},
+	} {
+		e := NewEncoder(nil)
+		if err := e.HandleDecoderStream(test.b); !isCode(err, DecoderStreamError) {
+			t.Errorf("%s: HandleDecoderStream(%x) = %v; want %v", test.name, test.b, err, DecoderStreamError)
+		}
+	}
+}
+
+func TestEncoderStreamSplit(t *testing.T) {
+	// Instructions split at every byte are processed once complete.
+	ins := mustHex("3fbd01 c00f 7777 772e 6578 616d 706c 652e 636f 6d c10c 2f73 616d 706c 652f 7061 7468")
+	d := NewDecoder(nil, 220, 0)
+	for i := range ins {
+		if err := d.HandleEncoderStream(ins[i : i+1]); err != nil {
+			t.Fatalf("HandleEncoderStream at byte %d: %v", i, err)
+		}
+	}
+	if got := d.table.insertCount(); got != 2 {
+		t.Errorf("insert count = %d; want 2", got)
+	}
+}
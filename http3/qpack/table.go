@@ -0,0 +1,110 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qpack
+
+// A dynamicTable is the QPACK dynamic table, RFC 9204, Section 3.2.
+// Entries are identified by their absolute index: the number of
+// entries inserted before them.
+type dynamicTable struct {
+	entries  []HeaderField // oldest first
+	dropped  uint64        // number of evicted entries
+	size     uint64
+	capacity uint64
+
+	// Indexes of the newest entry with a given field or name,
+	// maintained by encoders only.
+	byField map[HeaderField]uint64
+	byName  map[string]uint64
+}
+
+// insertCount returns the number of entries ever inserted.
+func (t *dynamicTable) insertCount() uint64 {
+	return t.dropped + uint64(len(t.entries))
+}
+
+// get returns the entry with the absolute index i.
+func (t *dynamicTable) get(i uint64) (HeaderField, bool) {
+	if i < t.dropped || i >= t.insertCount() {
+		return HeaderField{}, false
+	}
+	return t.entries[i-t.dropped], true
+}
+
+// evictable returns the number of entries that must be evicted to
+// make room for size bytes within capacity, and reports whether they
+// all have an absolute index below limit.
+func (t *dynamicTable) evictable(size, capacity, limit uint64) (int, bool) {
+	if size > capacity {
+		return 0, false
+	}
+	free := capacity - t.size
+	n := 0
+	for free < size {
+		if t.dropped+uint64(n) >= limit {
+			return 0, false
+		}
+		free += fieldSize(t.entries[n])
+		n++
+	}
+	return n, true
+}
+
+// evict removes the n oldest entries.
+func (t *dynamicTable) evict(n int) {
+	for i := 0; i < n; i++ {
+		f := t.entries[i]
+		t.size -= fieldSize(f)
+		if t.byField != nil {
+			abs := t.dropped + uint64(i)
+			if t.byField[f] == abs {
+				delete(t.byField, f)
+			}
+			if t.byName[f.Name] == abs {
+				delete(t.byName, f.Name)
+			}
+		}
+		t.entries[i] = HeaderField{}
+	}
+	t.entries = t.entries[n:]
+	t.dropped += uint64(n)
+}
+
+// setCapacity sets the capacity of the table, evicting entries below
+// limit as needed. It reports false if entries at or above limit
+// would have to be evicted.
+func (t *dynamicTable) setCapacity(capacity, limit uint64) bool {
+	n := 0
+	size := t.size
+	for size > capacity {
+		if t.dropped+uint64(n) >= limit {
+			return false
+		}
+		size -= fieldSize(t.entries[n])
+		n++
+	}
+	t.evict(n)
+	t.capacity = capacity
+	return true
+}
+
+// insert adds f to the table, evicting entries below limit as
+// needed. It reports false if f does not fit.
+func (t *dynamicTable) insert(f HeaderField, limit uint64) bool {
+	size := fieldSize(f)
+	n, ok := t.evictable(size, t.capacity, limit)
+	if !ok {
+		return false
+	}
+	t.evict(n)
+	f.Sensitive = false
+	t.entries = append(t.entries, f)
+	t.size += size
+	if t.byField != nil {
+		abs := t.insertCount() - 1
+		t.byField[f] = abs
+		t.byName[f.Name] = abs
+	}
+	return true
+}
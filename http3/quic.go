@@ -0,0 +1,151 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+
+	"golang.org/x/net/quic"
+)
+
+func init() {
+	defaultDial = func(ctx context.Context, addr string, tlsConfig *tls.Config) (QUICConn, error) {
+		qc, err := quic.Dial(ctx, "udp", addr, &quic.Config{TLSConfig: tlsConfig})
+		if err != nil {
+			return nil, err
+		}
+		return NewQUICConn(qc), nil
+	}
+}
+
+// NewQUICConn returns a QUICConn using a connection of
+// golang.org/x/net/quic.
+//
+// That package cannot send an error code when abandoning the
+// receiving part of a stream, so CancelRead always sends the code 0
+// to the peer.
+func NewQUICConn(qc *quic.Conn) QUICConn {
+	return quicConn{qc}
+}
+
+type quicConn struct {
+	qc *quic.Conn
+}
+
+func (c quicConn) OpenStream(ctx context.Context) (QUICStream, error) {
+	s, err := c.qc.NewStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{s}, nil
+}
+
+func (c quicConn) OpenUniStream(ctx context.Context) (QUICStream, error) {
+	s, err := c.qc.NewSendOnlyStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{s}, nil
+}
+
+func (c quicConn) AcceptStream(ctx context.Context) (QUICStream, error) {
+	s, err := c.qc.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{s}, nil
+}
+
+func (c quicConn) CloseWithError(code uint64, reason string) error {
+	c.qc.Abort(&quic.ApplicationError{Code: code, Reason: reason})
+	return nil
+}
+
+func (c quicConn) ConnectionState() tls.ConnectionState { return c.qc.ConnectionState() }
+func (c quicConn) LocalAddr() net.Addr                  { return c.qc.LocalAddr() }
+func (c quicConn) RemoteAddr() net.Addr                 { return c.qc.RemoteAddr() }
+
+type quicStream struct {
+	s *quic.Stream
+}
+
+// streamErr translates the stream errors of package quic.
+func (s quicStream) streamErr(err error) error {
+	var se *quic.StreamError
+	if errors.As(err, &se) {
+		return &StreamError{StreamID: s.s.ID(), Code: ErrCode(se.Code), Cause: ErrFromPeer}
+	}
+	return err
+}
+
+func (s quicStream) Read(b []byte) (int, error) {
+	n, err := s.s.Read(b)
+	return n, s.streamErr(err)
+}
+
+func (s quicStream) Write(b []byte) (int, error) {
+	n, err := s.s.Write(b)
+	return n, s.streamErr(err)
+}
+
+func (s quicStream) StreamID() int64         { return s.s.ID() }
+func (s quicStream) CloseWrite() error       { return s.s.CloseWrite() }
+func (s quicStream) CancelRead(code uint64)  { s.s.CloseRead() }
+func (s quicStream) CancelWrite(code uint64) { s.s.Reset(code) }
+
+// NewQUICListener returns a QUICListener accepting the connections of
+// an endpoint of golang.org/x/net/quic.
+//
+// Closing the listener stops accepting connections but leaves the
+// endpoint and its connections open, so that Server.Shutdown can
+// complete the requests in progress. The endpoint must be closed
+// separately.
+func NewQUICListener(e *quic.Endpoint) QUICListener {
+	return &quicListener{e: e, closec: make(chan struct{})}
+}
+
+type quicListener struct {
+	e         *quic.Endpoint
+	closeOnce sync.Once
+	closec    chan struct{}
+}
+
+var errListenerClosed = errors.New("http3: listener closed")
+
+func (l *quicListener) Accept(ctx context.Context) (QUICConn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.closec:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	qc, err := l.e.Accept(ctx)
+	if err != nil {
+		select {
+		case <-l.closec:
+			return nil, errListenerClosed
+		default:
+		}
+		return nil, err
+	}
+	return NewQUICConn(qc), nil
+}
+
+func (l *quicListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closec) })
+	return nil
+}
+
+func (l *quicListener) Addr() net.Addr { return l.e.LocalAddr() }
@@ -0,0 +1,851 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2/hpack"
+)
+
+// responseBufferSize is the size of the buffer of response bodies.
+const responseBufferSize = 4 << 10
+
+// goAwayTimeout is how long a connection is kept after a GOAWAY frame
+// once its last request completed.
+var goAwayTimeout = 1 * time.Second
+
+// Server is an HTTP/3 server.
+type Server struct {
+	// IdleTimeout specifies how long until idle clients are sent a
+	// GOAWAY frame and disconnected. If zero, BaseConfig.IdleTimeout
+	// is used, and then BaseConfig.ReadTimeout. Connections are
+	// also subject to the idle timeout of the QUIC transport.
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes limits the size of the field sections of
+	// requests. If zero, BaseConfig.MaxHeaderBytes is used, and
+	// then http.DefaultMaxHeaderBytes.
+	MaxHeaderBytes int
+
+	mu           sync.Mutex
+	conns        map[*serverConn]struct{}
+	listeners    map[QUICListener]struct{}
+	shuttingDown bool
+}
+
+// ServeConnOpts are options for the Server.ServeConn and Server.Serve
+// methods.
+type ServeConnOpts struct {
+	// Context is the base context to use.
+	// If nil, context.Background is used.
+	Context context.Context
+
+	// BaseConfig optionally sets the base configuration
+	// for values. If nil, defaults are used.
+	BaseConfig *http.Server
+
+	// Handler specifies which handler to use for processing
+	// requests. If nil, BaseConfig.Handler is used. If BaseConfig
+	// or BaseConfig.Handler is nil, http.DefaultServeMux is used.
+	Handler http.Handler
+}
+
+func (o *ServeConnOpts) context() context.Context {
+	if o != nil && o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+func (o *ServeConnOpts) baseConfig() *http.Server {
+	if o != nil && o.BaseConfig != nil {
+		return o.BaseConfig
+	}
+	return new(http.Server)
+}
+
+func (o *ServeConnOpts) handler() http.Handler {
+	if o != nil {
+		if o.Handler != nil {
+			return o.Handler
+		}
+		if o.BaseConfig != nil && o.BaseConfig.Handler != nil {
+			return o.BaseConfig.Handler
+		}
+	}
+	return http.DefaultServeMux
+}
+
+func (s *Server) maxHeaderBytes(hs *http.Server) int64 {
+	if s.MaxHeaderBytes > 0 {
+		return int64(s.MaxHeaderBytes)
+	}
+	if hs.MaxHeaderBytes > 0 {
+		return int64(hs.MaxHeaderBytes)
+	}
+	return http.DefaultMaxHeaderBytes
+}
+
+func (s *Server) idleTimeout(hs *http.Server) time.Duration {
+	if s.IdleTimeout != 0 {
+		return s.IdleTimeout
+	}
+	if hs.IdleTimeout != 0 {
+		return hs.IdleTimeout
+	}
+	return hs.ReadTimeout
+}
+
+// Serve accepts connections from l and serves each of them with
+// ServeConn, until l fails or Shutdown is called, in which case it
+// returns http.ErrServerClosed.
+func (s *Server) Serve(l QUICListener, opts *ServeConnOpts) error {
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		l.Close()
+		return http.ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[QUICListener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+	ctx := opts.context()
+	for {
+		qc, err := l.Accept(ctx)
+		if err != nil {
+			s.mu.Lock()
+			shuttingDown := s.shuttingDown
+			s.mu.Unlock()
+			if shuttingDown {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(qc, opts)
+	}
+}
+
+// Shutdown gracefully shuts down the server: it closes the listeners
+// passed to Serve, sends a GOAWAY frame on every connection, and waits
+// for the requests in progress to complete, at which point each
+// connection is closed. If ctx is done first, Shutdown closes the
+// remaining connections and returns the context's error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	var conns []*serverConn
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.mu.Unlock()
+	for _, sc := range conns {
+		sc.goAway()
+	}
+	for _, sc := range conns {
+		select {
+		case <-sc.donec:
+		case <-ctx.Done():
+			for _, sc := range conns {
+				sc.qc.CloseWithError(uint64(ErrCodeNo), "")
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// ServeConn serves HTTP/3 requests on the provided connection and
+// blocks until the connection is no longer readable.
+//
+// ServeConn starts speaking HTTP/3 assuming that qc has already
+// negotiated the "h3" protocol through ALPN.
+func (s *Server) ServeConn(qc QUICConn, opts *ServeConnOpts) {
+	hs := opts.baseConfig()
+	ctx, cancel := context.WithCancel(opts.context())
+	defer cancel()
+	sc := &serverConn{
+		srv:         s,
+		hs:          hs,
+		handler:     opts.handler(),
+		ctx:         ctx,
+		idleTimeout: s.idleTimeout(hs),
+		maxStreamID: -1,
+		goAwayID:    -1,
+		donec:       make(chan struct{}),
+	}
+	sc.init(qc, false, s.maxHeaderBytes(hs))
+	defer close(sc.donec)
+
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		qc.CloseWithError(uint64(ErrCodeNo), "")
+		return
+	}
+	if s.conns == nil {
+		s.conns = make(map[*serverConn]struct{})
+	}
+	s.conns[sc] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sc)
+		s.mu.Unlock()
+	}()
+
+	if err := sc.start(ctx); err != nil {
+		sc.abort(err)
+		return
+	}
+	sc.mu.Lock()
+	sc.setIdleTimer()
+	sc.mu.Unlock()
+	sc.serve()
+	sc.wg.Wait()
+	sc.mu.Lock()
+	if sc.idleTimer != nil {
+		sc.idleTimer.Stop()
+	}
+	sc.mu.Unlock()
+}
+
+// A serverConn is the server end of an HTTP/3 connection.
+type serverConn struct {
+	conn
+	srv         *Server
+	hs          *http.Server
+	handler     http.Handler
+	ctx         context.Context
+	idleTimeout time.Duration
+	donec       chan struct{} // closed when ServeConn returns
+	wg          sync.WaitGroup
+
+	// Guarded by conn.mu.
+	active      int   // requests being handled
+	maxStreamID int64 // of the last request accepted
+	goAwayID    int64 // sent in GOAWAY, or -1
+	idleTimer   *time.Timer
+}
+
+func (sc *serverConn) serve() {
+	for {
+		st, err := sc.qc.AcceptStream(sc.ctx)
+		if err != nil {
+			return
+		}
+		id := st.StreamID()
+		if isUniStream(id) {
+			sc.wg.Add(1)
+			go func() {
+				defer sc.wg.Done()
+				sc.handleUniStream(st)
+			}()
+			continue
+		}
+		sc.mu.Lock()
+		if sc.goAwayID >= 0 && id >= sc.goAwayID {
+			sc.mu.Unlock()
+			// RFC 9114, Section 5.2.
+			st.CancelRead(uint64(ErrCodeRequestRejected))
+			st.CancelWrite(uint64(ErrCodeRequestRejected))
+			continue
+		}
+		sc.active++
+		if id > sc.maxStreamID {
+			sc.maxStreamID = id
+		}
+		if sc.idleTimer != nil {
+			sc.idleTimer.Stop()
+		}
+		sc.mu.Unlock()
+		sc.wg.Add(1)
+		go func() {
+			defer sc.wg.Done()
+			sc.serveStream(st)
+			sc.mu.Lock()
+			sc.active--
+			sc.setIdleTimer()
+			sc.mu.Unlock()
+		}()
+	}
+}
+
+// setIdleTimer closes the connection if it has become idle after a
+// GOAWAY, and otherwise arms the idle timer. It is called with sc.mu
+// held.
+func (sc *serverConn) setIdleTimer() {
+	if sc.active > 0 {
+		return
+	}
+	if sc.goAwayID >= 0 {
+		// Closing the connection right away could discard the
+		// end of the last responses, so give the client time to
+		// close it first.
+		if sc.idleTimer != nil {
+			sc.idleTimer.Stop()
+		}
+		sc.idleTimer = time.AfterFunc(goAwayTimeout, func() {
+			sc.qc.CloseWithError(uint64(ErrCodeNo), "")
+		})
+		return
+	}
+	if sc.idleTimeout <= 0 {
+		return
+	}
+	if sc.idleTimer == nil {
+		sc.idleTimer = time.AfterFunc(sc.idleTimeout, sc.goAway)
+	} else {
+		sc.idleTimer.Reset(sc.idleTimeout)
+	}
+}
+
+// goAway starts a graceful shutdown of the connection: requests
+// beyond the last one accepted are rejected, and the connection is
+// closed once the remaining ones complete.
+func (sc *serverConn) goAway() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.goAwayID >= 0 {
+		return
+	}
+	sc.goAwayID = sc.maxStreamID + 4
+	sc.sendGoAway(sc.goAwayID)
+	sc.setIdleTimer()
+}
+
+func (sc *serverConn) logf(format string, args ...interface{}) {
+	if lg := sc.hs.ErrorLog; lg != nil {
+		lg.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// resetStream abandons both parts of a request stream.
+func resetStream(st QUICStream, code ErrCode) {
+	st.CancelRead(uint64(code))
+	st.CancelWrite(uint64(code))
+}
+
+func (sc *serverConn) serveStream(st QUICStream) {
+	br := bufio.NewReader(st)
+	var fields []hpack.HeaderField
+	for fields == nil {
+		typ, length, err := readFrameHeader(br)
+		if err != nil {
+			resetStream(st, ErrCodeRequestIncomplete)
+			return
+		}
+		switch {
+		case typ == FrameHeaders:
+			if length > sc.maxHeaderBytes {
+				sc.rejectRequest(st, br, length, http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			payload, err := readFramePayload(br, length, sc.maxHeaderBytes)
+			if err != nil {
+				resetStream(st, ErrCodeRequestIncomplete)
+				return
+			}
+			fields, err = sc.decodeFieldSection(st.StreamID(), payload)
+			if err == errFieldsLimit {
+				sc.rejectRequest(st, br, 0, http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			if err != nil {
+				sc.abort(err)
+				return
+			}
+		case typ == FrameData || typ == FramePushPromise || typ == FrameCancelPush ||
+			typ == FrameSettings || typ == FrameGoAway || typ == FrameMaxPushID ||
+			isReservedFrameType(typ):
+			sc.abort(ConnectionError(ErrCodeFrameUnexpected))
+			return
+		default:
+			if err := discardFrame(br, length); err != nil {
+				resetStream(st, ErrCodeRequestIncomplete)
+				return
+			}
+		}
+	}
+	rw, req, err := sc.newRequest(st, br, fields)
+	if err != nil {
+		resetStream(st, ErrCodeMessage)
+		return
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	rw.req = req
+	if !sc.runHandler(rw, req) {
+		return
+	}
+	rw.finish()
+	if !rw.body.done() {
+		// The response is complete without the rest of the
+		// request, RFC 9114, Section 4.1.
+		st.CancelRead(uint64(ErrCodeNo))
+	}
+}
+
+// runHandler calls the handler, and reports whether it returned
+// normally.
+func (sc *serverConn) runHandler(rw *responseWriter, req *http.Request) (ok bool) {
+	defer func() {
+		if ok {
+			return
+		}
+		e := recover()
+		if e != nil && e != http.ErrAbortHandler {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			sc.logf("http3: panic serving %v: %v\n%s", sc.qc.RemoteAddr(), e, buf)
+		}
+		resetStream(rw.st, ErrCodeInternal)
+	}()
+	sc.handler.ServeHTTP(rw, req)
+	return true
+}
+
+// rejectRequest responds to a request without calling the handler.
+func (sc *serverConn) rejectRequest(st QUICStream, br *bufio.Reader, discard int64, status int) {
+	if discard > 0 {
+		if err := discardFrame(br, discard); err != nil {
+			resetStream(st, ErrCodeRequestIncomplete)
+			return
+		}
+	}
+	sc.writeHeadersFrame(st, []hpack.HeaderField{
+		{Name: ":status", Value: strconv.Itoa(status)},
+		{Name: "content-length", Value: "0"},
+	})
+	st.CloseWrite()
+	st.CancelRead(uint64(ErrCodeNo))
+}
+
+var errMalformed = errors.New("http3: malformed request")
+
+// newRequest builds the request from its field section,
+// RFC 9114, Section 4.3.1.
+func (sc *serverConn) newRequest(st QUICStream, br *bufio.Reader, fields []hpack.HeaderField) (*responseWriter, *http.Request, error) {
+	var (
+		method, scheme, authority, path string
+		sawRegular                      bool
+	)
+	header := make(http.Header)
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			if sawRegular {
+				return nil, nil, errMalformed
+			}
+			var p *string
+			switch f.Name {
+			case ":method":
+				p = &method
+			case ":scheme":
+				p = &scheme
+			case ":authority":
+				p = &authority
+			case ":path":
+				p = &path
+			default:
+				return nil, nil, errMalformed
+			}
+			if *p != "" || f.Value == "" {
+				return nil, nil, errMalformed
+			}
+			*p = f.Value
+			continue
+		}
+		sawRegular = true
+		if !validWireHeaderFieldName(f.Name) || isConnectionHeader(f.Name) ||
+			!httpguts.ValidHeaderFieldValue(f.Value) ||
+			f.Name == "te" && f.Value != "trailers" {
+			return nil, nil, errMalformed
+		}
+		k := http.CanonicalHeaderKey(f.Name)
+		header[k] = append(header[k], f.Value)
+	}
+	if cookies := header["Cookie"]; len(cookies) > 1 {
+		// RFC 9114, Section 4.2.1.
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if method == "" {
+		return nil, nil, errMalformed
+	}
+	var (
+		u          *url.URL
+		requestURI string
+		err        error
+	)
+	if method == "CONNECT" {
+		if scheme != "" || path != "" || authority == "" {
+			return nil, nil, errMalformed
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else {
+		if scheme == "" || path == "" {
+			return nil, nil, errMalformed
+		}
+		if u, err = url.ParseRequestURI(path); err != nil {
+			return nil, nil, errMalformed
+		}
+		requestURI = path
+	}
+	if authority == "" {
+		authority = header.Get("Host")
+	}
+	header.Del("Host")
+
+	contentLength := int64(-1)
+	if vv := header["Content-Length"]; len(vv) > 0 {
+		cl, err := strconv.ParseInt(vv[0], 10, 63)
+		if err != nil || len(vv) > 1 {
+			return nil, nil, errMalformed
+		}
+		contentLength = cl
+	}
+	var trailer http.Header
+	for _, v := range header["Trailer"] {
+		foreachHeaderElement(v, func(k string) {
+			k = http.CanonicalHeaderKey(k)
+			if httpguts.ValidTrailerHeader(k) {
+				if trailer == nil {
+					trailer = make(http.Header)
+				}
+				trailer[k] = nil
+			}
+		})
+	}
+	header.Del("Trailer")
+
+	cs := sc.qc.ConnectionState()
+	req := &http.Request{
+		Method:        method,
+		URL:           u,
+		Proto:         "HTTP/3.0",
+		ProtoMajor:    3,
+		ProtoMinor:    0,
+		Header:        header,
+		Host:          authority,
+		ContentLength: contentLength,
+		Trailer:       trailer,
+		RemoteAddr:    sc.qc.RemoteAddr().String(),
+		RequestURI:    requestURI,
+		TLS:           &cs,
+	}
+	body := &requestBody{bodyReader: bodyReader{
+		c:             &sc.conn,
+		id:            st.StreamID(),
+		r:             br,
+		contentLength: contentLength,
+		trailer: func(fields []hpack.HeaderField) {
+			if req.Trailer == nil {
+				req.Trailer = make(http.Header)
+			}
+			addTrailer(req.Trailer, fields)
+		},
+	}}
+	if contentLength == 0 {
+		req.Body = http.NoBody
+	} else {
+		req.Body = body
+	}
+	req = req.WithContext(sc.ctx)
+	rw := &responseWriter{
+		sc:            sc,
+		st:            st,
+		body:          body,
+		handlerHeader: make(http.Header),
+		isHead:        method == "HEAD",
+		buf:           make([]byte, 0, responseBufferSize),
+	}
+	return rw, req, nil
+}
+
+// requestBody is the body of a request received by the server.
+type requestBody struct {
+	bodyReader
+	mu     sync.Mutex
+	closed bool
+}
+
+var errBodyClosed = errors.New("http3: request body closed by handler")
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return 0, errBodyClosed
+	}
+	return b.bodyReader.Read(p)
+}
+
+func (b *requestBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return nil
+}
+
+// done reports whether the request stream was read to its end.
+func (b *requestBody) done() bool {
+	return b.err == io.EOF
+}
+
+// responseWriter implements http.ResponseWriter for a request stream.
+type responseWriter struct {
+	sc   *serverConn
+	st   QUICStream
+	req  *http.Request
+	body *requestBody
+	buf  []byte // buffered body
+
+	handlerHeader http.Header
+	snapHeader    http.Header // handlerHeader when WriteHeader was called
+	status        int
+	wroteHeader   bool // a final status was set
+	sentHeader    bool // the HEADERS frame of the final status was written
+	handlerDone   bool
+	isHead        bool
+
+	contentLength int64 // declared Content-Length, or -1
+	written       int64
+	trailers      []string
+	err           error // error writing to the stream
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.handlerHeader
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if code < 100 || code > 999 {
+		panic(fmt.Sprintf("invalid WriteHeader code %v", code))
+	}
+	if rw.wroteHeader {
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		// Informational responses are written immediately.
+		fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(code)}}
+		fields = appendHeaderFields(fields, rw.handlerHeader, nil)
+		if err := rw.sc.writeHeadersFrame(rw.st, fields); err != nil && rw.err == nil {
+			rw.err = err
+		}
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = code
+	rw.snapHeader = rw.handlerHeader.Clone()
+	rw.contentLength = -1
+	if cl := rw.snapHeader.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 63); err == nil {
+			rw.contentLength = n
+		} else {
+			rw.snapHeader.Del("Content-Length")
+		}
+	}
+	for _, v := range rw.snapHeader["Trailer"] {
+		foreachHeaderElement(v, rw.declareTrailer)
+	}
+}
+
+func (rw *responseWriter) declareTrailer(k string) {
+	k = http.CanonicalHeaderKey(k)
+	if !httpguts.ValidTrailerHeader(k) {
+		return
+	}
+	for _, t := range rw.trailers {
+		if t == k {
+			return
+		}
+	}
+	rw.trailers = append(rw.trailers, k)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	return rw.write(len(p), p, "")
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return rw.write(len(s), nil, s)
+}
+
+func (rw *responseWriter) write(n int, p []byte, s string) (int, error) {
+	if rw.handlerDone {
+		panic("Write called after Handler finished")
+	}
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !bodyAllowedForStatus(rw.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if rw.contentLength >= 0 && rw.written+int64(n) > rw.contentLength {
+		return 0, http.ErrContentLength
+	}
+	rw.written += int64(n)
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	if p != nil {
+		rw.buf = append(rw.buf, p...)
+	} else {
+		rw.buf = append(rw.buf, s...)
+	}
+	if len(rw.buf) >= responseBufferSize {
+		rw.flush()
+	}
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	return n, nil
+}
+
+// flush writes the response header, if needed, and the buffered data.
+func (rw *responseWriter) flush() {
+	if !rw.sentHeader {
+		rw.writeResponseHeader(rw.buf)
+	}
+	if len(rw.buf) > 0 {
+		rw.writeData(rw.buf)
+		rw.buf = rw.buf[:0]
+	}
+}
+
+// Flush sends any buffered data to the client.
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.flush()
+}
+
+// finish completes the response after the handler returned.
+func (rw *responseWriter) finish() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.handlerDone = true
+	if !rw.sentHeader && rw.contentLength < 0 && bodyAllowedForStatus(rw.status) &&
+		(len(rw.buf) > 0 || !rw.isHead) {
+		// The whole body is buffered, so its length is known.
+		rw.snapHeader.Set("Content-Length", strconv.Itoa(len(rw.buf)))
+	}
+	rw.flush()
+	if rw.err != nil {
+		resetStream(rw.st, ErrCodeInternal)
+		return
+	}
+	if fields := rw.trailerFields(); len(fields) > 0 {
+		if err := rw.sc.writeHeadersFrame(rw.st, fields); err != nil {
+			resetStream(rw.st, ErrCodeInternal)
+			return
+		}
+	}
+	rw.st.CloseWrite()
+}
+
+func (rw *responseWriter) writeData(p []byte) {
+	if rw.isHead || rw.err != nil {
+		return
+	}
+	b := appendVarint(nil, uint64(FrameData))
+	b = appendVarint(b, uint64(len(p)))
+	if _, err := rw.st.Write(b); err != nil {
+		rw.err = err
+		return
+	}
+	if _, err := rw.st.Write(p); err != nil {
+		rw.err = err
+	}
+}
+
+// writeResponseHeader writes the HEADERS frame of the final response,
+// sniffing the content type from the start of the body.
+func (rw *responseWriter) writeResponseHeader(body []byte) {
+	rw.sentHeader = true
+	h := rw.snapHeader
+	if _, ok := h["Content-Type"]; !ok && h.Get("Content-Encoding") == "" &&
+		bodyAllowedForStatus(rw.status) && len(body) > 0 {
+		h.Set("Content-Type", http.DetectContentType(body))
+	}
+	if _, ok := h["Date"]; !ok {
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(rw.status)}}
+	fields = appendHeaderFields(fields, h, func(k string) bool {
+		return strings.HasPrefix(k, strings.ToLower(http.TrailerPrefix))
+	})
+	if err := rw.sc.writeHeadersFrame(rw.st, fields); err != nil {
+		rw.err = err
+	}
+}
+
+// trailerFields returns the trailer section: the values of the
+// declared trailers, and of those set with http.TrailerPrefix.
+func (rw *responseWriter) trailerFields() []hpack.HeaderField {
+	for k := range rw.handlerHeader {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			rw.declareTrailer(strings.TrimPrefix(k, http.TrailerPrefix))
+		}
+	}
+	var fields []hpack.HeaderField
+	for _, k := range rw.trailers {
+		vv := rw.handlerHeader[k]
+		if v, ok := rw.handlerHeader[http.TrailerPrefix+k]; ok {
+			vv = v
+		}
+		name, _ := lowerHeader(k)
+		for _, v := range vv {
+			if httpguts.ValidHeaderFieldValue(v) {
+				fields = append(fields, hpack.HeaderField{Name: name, Value: v})
+			}
+		}
+	}
+	return fields
+}
+
+// bodyAllowedForStatus reports whether a given response status code
+// permits a body. See RFC 9110, Section 6.4.1.
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == 204:
+		return false
+	case status == 304:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,271 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/quic"
+)
+
+var testCert = func() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}()
+
+type testServer struct {
+	t    *testing.T
+	srv  *Server
+	e    *quic.Endpoint
+	tr   *Transport
+	errc chan error
+}
+
+// newTestServer starts a server for h, and returns it with a
+// Transport sending all requests to it.
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	e, err := quic.Listen("udp", "127.0.0.1:0", &quic.Config{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{testCert},
+		NextProtos:   []string{NextProtoTLS},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{
+		t:    t,
+		srv:  &Server{},
+		e:    e,
+		errc: make(chan error, 1),
+	}
+	go func() {
+		ts.errc <- ts.srv.Serve(NewQUICListener(e), &ServeConnOpts{Handler: h})
+	}()
+	roots := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(testCert.Certificate[0])
+	roots.AddCert(leaf)
+	addr := e.LocalAddr().String()
+	ts.tr = &Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "example.com"},
+		Dial: func(ctx context.Context, _ string, cfg *tls.Config) (QUICConn, error) {
+			qc, err := quic.Dial(ctx, "udp", addr, &quic.Config{TLSConfig: cfg})
+			if err != nil {
+				return nil, err
+			}
+			return NewQUICConn(qc), nil
+		},
+	}
+	t.Cleanup(ts.close)
+	return ts
+}
+
+func (ts *testServer) close() {
+	ts.tr.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ts.srv.Shutdown(ctx)
+	ts.e.Close(ctx)
+}
+
+func (ts *testServer) do(req *http.Request) (*http.Response, []byte) {
+	ts.t.Helper()
+	res, err := ts.tr.RoundTrip(req)
+	if err != nil {
+		ts.t.Fatalf("RoundTrip: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		ts.t.Fatalf("reading body: %v", err)
+	}
+	return res, body
+}
+
+func TestGet(t *testing.T) {
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Proto != "HTTP/3.0" || r.Host != "example.com" || r.URL.Path != "/path" || r.URL.RawQuery != "q=1" {
+			t.Errorf("request = %v %v %v; want HTTP/3.0, example.com, /path?q=1", r.Proto, r.Host, r.URL)
+		}
+		if got := r.Header.Get("Cookie"); got != "a=1; b=2" {
+			t.Errorf("Cookie = %q; want \"a=1; b=2\"", got)
+		}
+		w.Header().Set("X-Foo", "bar")
+		io.WriteString(w, "<html>hello</html>")
+	}))
+	req, _ := http.NewRequest("GET", "https://example.com/path?q=1", nil)
+	req.Header.Set("Cookie", "a=1; b=2")
+	res, body := ts.do(req)
+	if res.StatusCode != 200 || res.Proto != "HTTP/3.0" {
+		t.Errorf("status = %v %v; want 200 HTTP/3.0", res.StatusCode, res.Proto)
+	}
+	if got := res.Header.Get("X-Foo"); got != "bar" {
+		t.Errorf("X-Foo = %q; want \"bar\"", got)
+	}
+	if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Content-Type = %q; want text/html", got)
+	}
+	if res.ContentLength != int64(len(body)) || string(body) != "<html>hello</html>" {
+		t.Errorf("body = %q, ContentLength = %d", body, res.ContentLength)
+	}
+
+	// The connection is reused.
+	res, _ = ts.do(req)
+	if res.StatusCode != 200 {
+		t.Errorf("second request: status = %v; want 200", res.StatusCode)
+	}
+}
+
+func TestPostEcho(t *testing.T) {
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	}))
+	data := bytes.Repeat([]byte("0123456789"), 50000)
+	req, _ := http.NewRequest("POST", "https://example.com/", bytes.NewReader(data))
+	res, body := ts.do(req)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("status = %v; want %v", res.StatusCode, http.StatusCreated)
+	}
+	if !bytes.Equal(body, data) {
+		t.Errorf("echoed %d bytes; want %d", len(body), len(data))
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if got := r.Trailer.Get("X-Req-Trailer"); got != "req" {
+			t.Errorf("request trailer = %q; want \"req\"", got)
+		}
+		w.Header().Set("Trailer", "X-Declared")
+		io.WriteString(w, "body")
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Declared", "declared")
+		w.Header().Set(http.TrailerPrefix+"X-Late", "late")
+	}))
+	req, _ := http.NewRequest("POST", "https://example.com/", io.NopCloser(strings.NewReader("data")))
+	req.Trailer = http.Header{"X-Req-Trailer": {"req"}}
+	res, body := ts.do(req)
+	if string(body) != "body" {
+		t.Errorf("body = %q; want \"body\"", body)
+	}
+	if got := res.Trailer.Get("X-Declared"); got != "declared" {
+		t.Errorf("X-Declared trailer = %q; want \"declared\"", got)
+	}
+	if got := res.Trailer.Get("X-Late"); got != "late" {
+		t.Errorf("X-Late trailer = %q; want \"late\"", got)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip" {
+			t.Errorf("Accept-Encoding = %q; want \"gzip\"", got)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		// gzip encoding of "hello".
+		w.Write([]byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff,
+			0xca, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x04, 0x00, 0x00, 0xff, 0xff,
+			0x86, 0xa6, 0x10, 0x36, 0x05, 0x00, 0x00, 0x00})
+	}))
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	res, body := ts.do(req)
+	if string(body) != "hello" || !res.Uncompressed {
+		t.Errorf("body = %q, Uncompressed = %v; want \"hello\", true", body, res.Uncompressed)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	res, err := ts.tr.RoundTrip(req)
+	if err == nil {
+		_, err = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	var se *StreamError
+	if !errors.As(err, &se) || se.Code != ErrCodeInternal {
+		t.Errorf("RoundTrip error = %v; want stream error %v", err, ErrCodeInternal)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ts := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	}))
+	req, _ := http.NewRequest("GET", "https://example.com/", nil)
+	resc := make(chan string, 1)
+	go func() {
+		res, err := ts.tr.RoundTrip(req)
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		resc <- string(body)
+	}()
+	<-started
+	shutdownc := make(chan error, 1)
+	go func() {
+		shutdownc <- ts.srv.Shutdown(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-shutdownc:
+		t.Fatalf("Shutdown returned %v with a request in progress", err)
+	default:
+	}
+	close(release)
+	if body := <-resc; body != "done" {
+		t.Errorf("body = %q; want \"done\"", body)
+	}
+	if err := <-shutdownc; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if err := <-ts.errc; err != http.ErrServerClosed {
+		t.Errorf("Serve = %v; want %v", err, http.ErrServerClosed)
+	}
+}
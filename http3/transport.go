@@ -0,0 +1,811 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2/hpack"
+)
+
+// defaultMaxHeaderListSize is the default value of
+// Transport.MaxHeaderListSize.
+const defaultMaxHeaderListSize = 10 << 20
+
+// bodyWriteBufferSize is the size of the DATA frames of request
+// bodies.
+const bodyWriteBufferSize = 16 << 10
+
+// defaultDial is the dialer used when Transport.Dial is nil. It is
+// set when a QUIC implementation is available.
+var defaultDial func(ctx context.Context, addr string, tlsConfig *tls.Config) (QUICConn, error)
+
+var (
+	errNoDialer = errors.New("http3: no QUIC dialer configured")
+
+	// errClientConnUnusable is returned by a connection that no
+	// longer accepts requests; the request may be sent on another.
+	errClientConnUnusable = errors.New("http3: client conn not usable")
+)
+
+// Transport is an HTTP/3 Transport.
+//
+// A Transport internally caches connections to servers. It is safe
+// for concurrent use by multiple goroutines.
+type Transport struct {
+	// TLSClientConfig specifies the TLS configuration to use with
+	// QUIC connections. If nil, the default configuration is used.
+	// NextProtos is always set to NextProtoTLS.
+	TLSClientConfig *tls.Config
+
+	// Dial specifies an optional dial function for creating QUIC
+	// connections to addr, a host and port. If Dial is nil, the
+	// connections of golang.org/x/net/quic are used with Go 1.21 and
+	// later, and RoundTrip fails with earlier versions.
+	Dial func(ctx context.Context, addr string, tlsConfig *tls.Config) (QUICConn, error)
+
+	// DisableCompression, if true, prevents the Transport from
+	// requesting compression with an "Accept-Encoding: gzip"
+	// request header when the Request contains no existing
+	// Accept-Encoding value.
+	DisableCompression bool
+
+	// MaxHeaderListSize is the HTTP/3 SETTINGS_MAX_FIELD_SECTION_SIZE
+	// to send in the initial settings frame. It is how many bytes of
+	// response headers are allowed. If zero, a default of 10MB is
+	// used.
+	MaxHeaderListSize uint32
+
+	connMu sync.Mutex
+	conns  map[string]*clientConn // by "host:port"
+	dials  map[string]*dialCall
+}
+
+func (t *Transport) maxHeaderListSize() int64 {
+	if t.MaxHeaderListSize == 0 {
+		return defaultMaxHeaderListSize
+	}
+	return int64(t.MaxHeaderListSize)
+}
+
+// authorityAddr returns a given authority (a host/IP, or host:port /
+// ip:port) and returns a host:port. The port 443 is added if needed.
+func authorityAddr(authority string) string {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		host = authority
+		port = "443"
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil || req.URL.Scheme != "https" {
+		return nil, errors.New("http3: unsupported scheme")
+	}
+	addr := authorityAddr(req.URL.Host)
+	for retry := 0; ; retry++ {
+		cc, err := t.getConn(req.Context(), addr)
+		if err != nil {
+			return nil, err
+		}
+		res, err := cc.roundTrip(req)
+		if err == nil {
+			return res, nil
+		}
+		if retry > 0 || !canRetryError(err) {
+			return nil, err
+		}
+		if req, err = rewindBody(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// canRetryError reports whether a request that failed with err was
+// not processed by the server, and may be sent again.
+func canRetryError(err error) bool {
+	if err == errClientConnUnusable {
+		return true
+	}
+	var se *StreamError
+	return errors.As(err, &se) && se.Code == ErrCodeRequestRejected && errors.Is(err, ErrFromPeer)
+}
+
+// rewindBody returns a copy of req with its body rewound, so that it
+// can be sent again.
+func rewindBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("http3: cannot retry request with a body that cannot be rewound")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
+// CloseIdleConnections closes any connections which were previously
+// connected from previous requests but are now sitting idle.
+func (t *Transport) CloseIdleConnections() {
+	t.connMu.Lock()
+	var idle []*clientConn
+	for key, cc := range t.conns {
+		cc.mu.Lock()
+		if cc.streams == 0 {
+			idle = append(idle, cc)
+			delete(t.conns, key)
+		}
+		cc.mu.Unlock()
+	}
+	t.connMu.Unlock()
+	for _, cc := range idle {
+		cc.qc.CloseWithError(uint64(ErrCodeNo), "")
+	}
+}
+
+// A dialCall is an in-flight dial of a connection.
+type dialCall struct {
+	done chan struct{} // closed when the dial completes
+	cc   *clientConn
+	err  error
+}
+
+// getConn returns a connection to addr, dialing one if none can be
+// reused.
+func (t *Transport) getConn(ctx context.Context, addr string) (*clientConn, error) {
+	t.connMu.Lock()
+	if cc, ok := t.conns[addr]; ok && cc.canTakeNewRequest() {
+		t.connMu.Unlock()
+		return cc, nil
+	}
+	call, ok := t.dials[addr]
+	if !ok {
+		call = &dialCall{done: make(chan struct{})}
+		if t.dials == nil {
+			t.dials = make(map[string]*dialCall)
+		}
+		t.dials[addr] = call
+		// The dial is shared, so it does not use the context of
+		// the request.
+		go t.dial(call, addr)
+	}
+	t.connMu.Unlock()
+	select {
+	case <-call.done:
+		return call.cc, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *Transport) dial(call *dialCall, addr string) {
+	defer close(call.done)
+	call.cc, call.err = t.newClientConn(context.Background(), addr)
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+	delete(t.dials, addr)
+	if call.err != nil {
+		return
+	}
+	if t.conns == nil {
+		t.conns = make(map[string]*clientConn)
+	}
+	t.conns[addr] = call.cc
+}
+
+func (t *Transport) newClientConn(ctx context.Context, addr string) (*clientConn, error) {
+	dial := t.Dial
+	if dial == nil {
+		dial = defaultDial
+	}
+	if dial == nil {
+		return nil, errNoDialer
+	}
+	cfg := new(tls.Config)
+	if t.TLSClientConfig != nil {
+		cfg = t.TLSClientConfig.Clone()
+	}
+	cfg.NextProtos = []string{NextProtoTLS}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	qc, err := dial(ctx, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cc := &clientConn{t: t, key: addr}
+	cc.init(qc, true, t.maxHeaderListSize())
+	cc.onGoAway = cc.handleGoAway
+	if err := cc.start(ctx); err != nil {
+		qc.CloseWithError(uint64(ErrCodeInternal), "")
+		return nil, err
+	}
+	go cc.acceptLoop()
+	return cc, nil
+}
+
+// A clientConn is the client end of an HTTP/3 connection.
+type clientConn struct {
+	conn
+	t   *Transport
+	key string // in Transport.conns
+
+	// Guarded by conn.mu.
+	goingAway bool
+	closed    bool
+	streams   int // requests in progress
+}
+
+func (cc *clientConn) canTakeNewRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return !cc.goingAway && !cc.closed
+}
+
+// forget removes the connection from the pool of its Transport.
+func (cc *clientConn) forget() {
+	cc.t.connMu.Lock()
+	defer cc.t.connMu.Unlock()
+	if cc.t.conns[cc.key] == cc {
+		delete(cc.t.conns, cc.key)
+	}
+}
+
+func (cc *clientConn) handleGoAway(id int64) {
+	cc.mu.Lock()
+	cc.goingAway = true
+	idle := cc.streams == 0
+	cc.mu.Unlock()
+	cc.forget()
+	if idle {
+		cc.qc.CloseWithError(uint64(ErrCodeNo), "")
+	}
+}
+
+// acceptLoop handles the streams opened by the server until the
+// connection is closed.
+func (cc *clientConn) acceptLoop() {
+	for {
+		st, err := cc.qc.AcceptStream(context.Background())
+		if err != nil {
+			cc.mu.Lock()
+			cc.closed = true
+			cc.mu.Unlock()
+			cc.forget()
+			return
+		}
+		if !isUniStream(st.StreamID()) {
+			// Servers cannot open bidirectional streams,
+			// RFC 9114, Section 6.1.
+			cc.abort(ConnectionError(ErrCodeStreamCreation))
+			continue
+		}
+		go cc.handleUniStream(st)
+	}
+}
+
+// streamDone is called when a request completes.
+func (cc *clientConn) streamDone() {
+	cc.mu.Lock()
+	cc.streams--
+	closeIdle := cc.goingAway && cc.streams == 0
+	cc.mu.Unlock()
+	if closeIdle {
+		cc.qc.CloseWithError(uint64(ErrCodeNo), "")
+	}
+}
+
+// A clientStream is a request in progress.
+type clientStream struct {
+	cc   *clientConn
+	st   QUICStream
+	br   *bufio.Reader
+	req  *http.Request
+	once sync.Once
+	done chan struct{} // closed when the request completes
+}
+
+// finish releases the stream; the receiving part is abandoned with
+// code unless it was read to its end.
+func (cs *clientStream) finish(code ErrCode, complete bool) {
+	cs.once.Do(func() {
+		if !complete {
+			cs.st.CancelRead(uint64(code))
+		}
+		close(cs.done)
+		cs.cc.streamDone()
+	})
+}
+
+func (cc *clientConn) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	cc.mu.Lock()
+	if cc.goingAway || cc.closed {
+		cc.mu.Unlock()
+		return nil, errClientConnUnusable
+	}
+	cc.streams++
+	cc.mu.Unlock()
+
+	st, err := cc.qc.OpenStream(ctx)
+	if err != nil {
+		cc.streamDone()
+		return nil, err
+	}
+	cs := &clientStream{
+		cc:   cc,
+		st:   st,
+		br:   bufio.NewReader(st),
+		req:  req,
+		done: make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.CancelWrite(uint64(ErrCodeRequestCancelled))
+			cs.finish(ErrCodeRequestCancelled, false)
+		case <-cs.done:
+		}
+	}()
+
+	addGzip := !cc.t.DisableCompression &&
+		req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		req.Method != "HEAD"
+	contentLength := actualContentLength(req)
+	hasBody := contentLength != 0
+	fields, err := encodeRequestHeaders(req, addGzip, contentLength)
+	if err == nil && fieldSectionSize(fields) > cc.peerFieldSectionLimit() {
+		err = errRequestHeaderListSize
+	}
+	if err == nil {
+		err = cc.writeHeadersFrame(st, fields)
+	}
+	if err != nil {
+		st.CancelWrite(uint64(ErrCodeRequestCancelled))
+		cs.finish(ErrCodeRequestCancelled, false)
+		return nil, cs.error(err)
+	}
+	if hasBody {
+		go cs.writeBody()
+	} else {
+		st.CloseWrite()
+	}
+
+	res, err := cs.readResponse(addGzip)
+	if err != nil {
+		st.CancelWrite(uint64(ErrCodeRequestCancelled))
+		cs.finish(ErrCodeRequestCancelled, false)
+		return nil, cs.error(err)
+	}
+	return res, nil
+}
+
+// error returns the error to report for a request: the context's
+// error if the request was canceled.
+func (cs *clientStream) error(err error) error {
+	if ctxErr := cs.req.Context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+var errRequestHeaderListSize = errors.New("http3: request header list larger than peer's advertised limit")
+
+// writeBody sends the request body in DATA frames, followed by the
+// request trailer.
+func (cs *clientStream) writeBody() {
+	req := cs.req
+	err := cs.writeBodyData()
+	if closer := req.Body; closer != nil {
+		closer.Close()
+	}
+	if err == nil {
+		var fields []hpack.HeaderField
+		fields, err = encodeTrailers(req.Trailer)
+		if err == nil && len(fields) > 0 {
+			err = cs.cc.writeHeadersFrame(cs.st, fields)
+		}
+	}
+	if err != nil {
+		cs.st.CancelWrite(uint64(ErrCodeRequestCancelled))
+		return
+	}
+	cs.st.CloseWrite()
+}
+
+func (cs *clientStream) writeBodyData() error {
+	body := cs.req.Body
+	buf := make([]byte, bodyWriteBufferSize)
+	var sent int64
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			sent += int64(n)
+			if cs.req.ContentLength > 0 && sent > cs.req.ContentLength {
+				return errReqBodyTooLong
+			}
+			b := appendVarint(nil, uint64(FrameData))
+			b = appendVarint(b, uint64(n))
+			if _, err := cs.st.Write(b); err != nil {
+				return err
+			}
+			if _, err := cs.st.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			if cs.req.ContentLength > 0 && sent != cs.req.ContentLength {
+				return errBodyLength
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var errReqBodyTooLong = errors.New("http3: request body larger than specified content length")
+
+// readResponse reads the response header, skipping informational
+// responses.
+func (cs *clientStream) readResponse(addGzip bool) (*http.Response, error) {
+	cc := cs.cc
+	for {
+		typ, length, err := readFrameHeader(cs.br)
+		if err == io.EOF {
+			return nil, errors.New("http3: stream ended before the response header")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case typ == FrameHeaders:
+			payload, err := readFramePayload(cs.br, length, cc.maxHeaderBytes)
+			if err != nil {
+				if _, ok := err.(ConnectionError); ok {
+					return nil, fmt.Errorf("http3: response header too large")
+				}
+				return nil, err
+			}
+			fields, err := cc.decodeFieldSection(cs.st.StreamID(), payload)
+			if err == errFieldsLimit {
+				return nil, fmt.Errorf("http3: response header too large")
+			}
+			if err != nil {
+				cc.abort(err)
+				return nil, err
+			}
+			res, err := cs.newResponse(fields, addGzip)
+			if err != nil {
+				return nil, err
+			}
+			if res != nil {
+				return res, nil
+			}
+		case typ == FramePushPromise:
+			err := ConnectionError(ErrCodeID)
+			cc.abort(err)
+			return nil, err
+		case typ == FrameData, typ == FrameCancelPush, typ == FrameSettings,
+			typ == FrameGoAway, typ == FrameMaxPushID, isReservedFrameType(typ):
+			err := ConnectionError(ErrCodeFrameUnexpected)
+			cc.abort(err)
+			return nil, err
+		default:
+			if err := discardFrame(cs.br, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// newResponse builds the response from its field section. It returns
+// nil for informational responses.
+func (cs *clientStream) newResponse(fields []hpack.HeaderField, addGzip bool) (*http.Response, error) {
+	malformed := streamError(cs.st.StreamID(), ErrCodeMessage)
+	var status string
+	header := make(http.Header)
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			if f.Name != ":status" || status != "" || len(header) > 0 {
+				return nil, malformed
+			}
+			status = f.Value
+			continue
+		}
+		if !validWireHeaderFieldName(f.Name) {
+			return nil, malformed
+		}
+		k := http.CanonicalHeaderKey(f.Name)
+		header[k] = append(header[k], f.Value)
+	}
+	if status == "" {
+		return nil, malformed
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || len(status) != 3 {
+		return nil, malformed
+	}
+	if code >= 100 && code <= 199 {
+		return nil, nil
+	}
+	state := cs.cc.qc.ConnectionState()
+	res := &http.Response{
+		Proto:      "HTTP/3.0",
+		ProtoMajor: 3,
+		Header:     header,
+		StatusCode: code,
+		Status:     status + " " + http.StatusText(code),
+		Request:    cs.req,
+		TLS:        &state,
+	}
+	for _, v := range header["Trailer"] {
+		foreachHeaderElement(v, func(k string) {
+			k = http.CanonicalHeaderKey(k)
+			if httpguts.ValidTrailerHeader(k) {
+				if res.Trailer == nil {
+					res.Trailer = make(http.Header)
+				}
+				res.Trailer[k] = nil
+			}
+		})
+	}
+	delete(header, "Trailer")
+
+	res.ContentLength = -1
+	if clens := header["Content-Length"]; len(clens) == 1 {
+		if cl, err := strconv.ParseInt(clens[0], 10, 63); err == nil {
+			res.ContentLength = cl
+		}
+	}
+	if cs.req.Method == "HEAD" || !bodyAllowedForStatus(code) {
+		// The declared length of a response to HEAD is that of
+		// the resource.
+		res.Body = http.NoBody
+		if cs.req.Method != "HEAD" {
+			res.ContentLength = 0
+		}
+		cs.finish(ErrCodeNo, false)
+		return res, nil
+	}
+	body := &responseBody{cs: cs, bodyReader: bodyReader{
+		c:             &cs.cc.conn,
+		id:            cs.st.StreamID(),
+		r:             cs.br,
+		contentLength: res.ContentLength,
+		trailer: func(fields []hpack.HeaderField) {
+			if res.Trailer == nil {
+				res.Trailer = make(http.Header)
+			}
+			addTrailer(res.Trailer, fields)
+		},
+	}}
+	res.Body = body
+	if addGzip && textproto.TrimString(header.Get("Content-Encoding")) == "gzip" {
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Body = &gzipReader{body: body}
+		res.Uncompressed = true
+	}
+	return res, nil
+}
+
+// responseBody is the body of a response received by the client.
+type responseBody struct {
+	bodyReader
+	cs *clientStream
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.bodyReader.Read(p)
+	if err == io.EOF {
+		b.cs.finish(ErrCodeNo, true)
+	} else if err != nil {
+		b.cs.finish(ErrCodeRequestCancelled, false)
+		err = b.cs.error(err)
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.cs.finish(ErrCodeRequestCancelled, b.bodyReader.err == io.EOF)
+	return nil
+}
+
+// gzipReader wraps a response body so it can lazily
+// call gzip.NewReader on the first call to Read.
+type gzipReader struct {
+	body io.ReadCloser // underlying Response.Body
+	zr   *gzip.Reader  // lazily-initialized gzip reader
+	zerr error         // sticky error
+}
+
+func (gz *gzipReader) Read(p []byte) (n int, err error) {
+	if gz.zerr != nil {
+		return 0, gz.zerr
+	}
+	if gz.zr == nil {
+		gz.zr, err = gzip.NewReader(gz.body)
+		if err != nil {
+			gz.zerr = err
+			return 0, err
+		}
+	}
+	return gz.zr.Read(p)
+}
+
+func (gz *gzipReader) Close() error {
+	return gz.body.Close()
+}
+
+// actualContentLength returns a sanitized version of req.ContentLength,
+// where 0 actually means zero (not unknown) and -1 means unknown.
+func actualContentLength(req *http.Request) int64 {
+	if req.Body == nil || req.Body == http.NoBody {
+		return 0
+	}
+	if req.ContentLength != 0 {
+		return req.ContentLength
+	}
+	return -1
+}
+
+// encodeRequestHeaders returns the field section of req,
+// RFC 9114, Section 4.3.1.
+func encodeRequestHeaders(req *http.Request, addGzip bool, contentLength int64) ([]hpack.HeaderField, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host, err := httpguts.PunycodeHostPort(host)
+	if err != nil {
+		return nil, err
+	}
+	if !httpguts.ValidHostHeader(host) {
+		return nil, errors.New("http3: invalid Host header")
+	}
+	var path string
+	if req.Method != "CONNECT" {
+		path = req.URL.RequestURI()
+		if !validPseudoPath(path) {
+			orig := path
+			path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
+			if !validPseudoPath(path) {
+				if req.URL.Opaque != "" {
+					return nil, fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
+				}
+				return nil, fmt.Errorf("invalid request :path %q", orig)
+			}
+		}
+	}
+	for k, vv := range req.Header {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return nil, fmt.Errorf("invalid HTTP header name %q", k)
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return nil, fmt.Errorf("invalid HTTP header value for header %q", k)
+			}
+		}
+	}
+	trailers, err := commaSeparatedTrailers(req)
+	if err != nil {
+		return nil, err
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	fields := []hpack.HeaderField{{Name: ":authority", Value: host}, {Name: ":method", Value: method}}
+	if method != "CONNECT" {
+		fields = append(fields,
+			hpack.HeaderField{Name: ":path", Value: path},
+			hpack.HeaderField{Name: ":scheme", Value: req.URL.Scheme},
+		)
+	}
+	fields = appendHeaderFields(fields, req.Header, func(k string) bool {
+		switch k {
+		case "host", "content-length", "trailer", "user-agent", "cookie":
+			return true
+		}
+		return false
+	})
+	if trailers != "" {
+		fields = append(fields, hpack.HeaderField{Name: "trailer", Value: trailers})
+	}
+	if contentLength > 0 || contentLength == 0 && (method == "POST" || method == "PUT" || method == "PATCH") {
+		fields = append(fields, hpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(contentLength, 10)})
+	}
+	userAgent := "Go-http-client/3.0"
+	if vv, ok := req.Header["User-Agent"]; ok {
+		userAgent = ""
+		if len(vv) > 0 {
+			userAgent = vv[0]
+		}
+	}
+	if userAgent != "" {
+		fields = append(fields, hpack.HeaderField{Name: "user-agent", Value: userAgent})
+	}
+	// RFC 9114, Section 4.2.1: cookies may be split into separate
+	// field lines for better compression.
+	for _, v := range req.Header["Cookie"] {
+		for _, c := range strings.Split(v, "; ") {
+			if c = strings.TrimSpace(c); c != "" {
+				fields = append(fields, hpack.HeaderField{Name: "cookie", Value: c})
+			}
+		}
+	}
+	if addGzip {
+		fields = append(fields, hpack.HeaderField{Name: "accept-encoding", Value: "gzip"})
+	}
+	return fields, nil
+}
+
+// validPseudoPath reports whether v is a valid :path pseudo-header
+// value. It must be either "*" or an absolute path.
+func validPseudoPath(v string) bool {
+	return (len(v) > 0 && v[0] == '/') || v == "*"
+}
+
+// commaSeparatedTrailers returns the value of the Trailer header
+// announcing the keys of req.Trailer.
+func commaSeparatedTrailers(req *http.Request) (string, error) {
+	var keys []string
+	for k := range req.Trailer {
+		k = http.CanonicalHeaderKey(k)
+		switch k {
+		case "Transfer-Encoding", "Trailer", "Content-Length":
+			return "", fmt.Errorf("invalid Trailer key %q", k)
+		}
+		keys = append(keys, k)
+	}
+	return strings.Join(keys, ","), nil
+}
+
+// encodeTrailers returns the trailer section of a request.
+func encodeTrailers(trailer http.Header) ([]hpack.HeaderField, error) {
+	for k, vv := range trailer {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return nil, fmt.Errorf("invalid HTTP trailer name %q", k)
+		}
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return nil, fmt.Errorf("invalid HTTP trailer value for trailer %q", k)
+			}
+		}
+	}
+	return appendHeaderFields(nil, trailer, nil), nil
+}
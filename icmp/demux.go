@@ -0,0 +1,346 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/internal/iana"
+)
+
+// A Packet is an ICMP message received by a Demux.
+//
+// A Packet may be delivered to several subscriptions and must not be
+// modified.
+type Packet struct {
+	Message *Message // message
+	Peer    net.Addr // source of the message
+	Flow    *Flow    // flow of the original datagram of an error message, nil otherwise
+}
+
+// A Flow identifies the datagrams of a transport flow by their 5-tuple.
+type Flow struct {
+	Protocol int    // transport protocol number
+	Src      net.IP // source address
+	Dst      net.IP // destination address
+	SrcPort  int    // source port, or echo identifier for ICMP
+	DstPort  int    // destination port
+}
+
+// matches reports whether g belongs to the flow f, whose zero fields
+// match any value.
+func (f *Flow) matches(g *Flow) bool {
+	return g != nil &&
+		(f.Protocol == 0 || f.Protocol == g.Protocol) &&
+		(f.Src == nil || f.Src.Equal(g.Src)) &&
+		(f.Dst == nil || f.Dst.Equal(g.Dst)) &&
+		(f.SrcPort == 0 || f.SrcPort == g.SrcPort) &&
+		(f.DstPort == 0 || f.DstPort == g.DstPort)
+}
+
+// A Filter selects the packets delivered to a subscription. A packet
+// must match all the criteria set.
+type Filter struct {
+	// Types lists the message types matched. If empty, all types match.
+	Types []Type
+
+	// Codes lists the message codes matched. If empty, all codes match.
+	Codes []int
+
+	// Flow, if non-nil, matches the error messages about the datagrams
+	// of a flow, such as destination unreachable messages sent in
+	// response to UDP probes. Its zero fields match any value.
+	Flow *Flow
+
+	// EchoID, if non-nil, matches the echo and extended echo messages
+	// with the identifier *EchoID.
+	EchoID *int
+
+	// Match, if non-nil, is an additional predicate.
+	Match func(*Packet) bool
+}
+
+func (f *Filter) matches(p *Packet) bool {
+	if len(f.Types) > 0 {
+		ok := false
+		for _, typ := range f.Types {
+			if typ == p.Message.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.Codes) > 0 {
+		ok := false
+		for _, code := range f.Codes {
+			if code == p.Message.Code {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.Flow != nil && !f.Flow.matches(p.Flow) {
+		return false
+	}
+	if f.EchoID != nil {
+		switch b := p.Message.Body.(type) {
+		case *Echo:
+			if b.ID != *f.EchoID {
+				return false
+			}
+		case *ExtendedEchoRequest:
+			if b.ID != *f.EchoID {
+				return false
+			}
+		case *ExtendedEchoReply:
+			if b.ID != *f.EchoID {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return f.Match == nil || f.Match(p)
+}
+
+// A Demux reads the ICMP messages received on a PacketConn and delivers
+// each one to all the subscriptions whose filter matches it, so that
+// several consumers, such as probers, can share one endpoint without
+// stealing each other's messages.
+//
+// The PacketConn must not be read while the Demux is running, but it may
+// be written to. A read deadline set on it, such as with SetDeadline,
+// stops the Demux once it expires.
+type Demux struct {
+	c     *PacketConn
+	proto int
+	done  chan struct{} // closed when the read loop exits
+
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	closing bool
+	err     error
+}
+
+// NewDemux returns a Demux which reads the messages of the protocol
+// proto, either iana.ProtocolICMP or iana.ProtocolIPv6ICMP, received on
+// c until Close is called or reading c fails.
+func NewDemux(c *PacketConn, proto int) *Demux {
+	d := &Demux{
+		c:     c,
+		proto: proto,
+		done:  make(chan struct{}),
+		subs:  make(map[*Subscription]struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *Demux) run() {
+	b := make([]byte, 1<<16)
+	for {
+		n, peer, err := d.c.ReadFrom(b)
+		if err != nil {
+			// A deadline, unless set by Close, would fail every
+			// read until it is cleared.
+			d.stop(err)
+			return
+		}
+		m, err := ParseMessage(d.proto, append([]byte(nil), b[:n]...))
+		if err != nil {
+			continue
+		}
+		p := &Packet{Message: m, Peer: peer, Flow: originalFlow(d.proto, m)}
+		d.mu.Lock()
+		for s := range d.subs {
+			if s.filter.matches(p) {
+				select {
+				case s.c <- p:
+				default:
+					s.dropped++
+				}
+			}
+		}
+		d.mu.Unlock()
+	}
+}
+
+// stop closes the channels of all the subscriptions, and done, so that no
+// subscription is added after.
+func (d *Demux) stop(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		err = nil
+	}
+	d.err = err
+	for s := range d.subs {
+		close(s.c)
+		delete(d.subs, s)
+	}
+	close(d.done)
+}
+
+// Subscribe returns a subscription to the messages matching f, which
+// buffers up to n messages. A message arriving when the buffer is full
+// is dropped rather than delaying the other subscriptions.
+func (d *Demux) Subscribe(f Filter, n int) *Subscription {
+	c := make(chan *Packet, n)
+	s := &Subscription{C: c, c: c, d: d, filter: f}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		close(c)
+	default:
+		d.subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Close stops the Demux and waits for it to stop reading the
+// PacketConn, which it leaves open. The channels of all the
+// subscriptions are closed.
+func (d *Demux) Close() error {
+	d.mu.Lock()
+	d.closing = true
+	d.mu.Unlock()
+	select {
+	case <-d.done:
+		return nil
+	default:
+	}
+	if err := d.c.SetReadDeadline(time.Now()); err != nil {
+		return err
+	}
+	<-d.done
+	return d.c.SetReadDeadline(time.Time{})
+}
+
+// Err returns the error which stopped the Demux, or nil if it is
+// running or was closed.
+func (d *Demux) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// A Subscription receives the messages matching a filter.
+type Subscription struct {
+	// C receives the messages matching the filter. It is closed when
+	// the subscription or the Demux is closed.
+	C <-chan *Packet
+
+	c      chan *Packet
+	d      *Demux
+	filter Filter
+
+	dropped uint64 // guarded by d.mu
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if _, ok := s.d.subs[s]; ok {
+		close(s.c)
+		delete(s.d.subs, s)
+	}
+}
+
+// Dropped returns the number of messages matching the filter which were
+// dropped because the buffer of the subscription was full.
+func (s *Subscription) Dropped() uint64 {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return s.dropped
+}
+
+// originalFlow returns the flow of the original datagram of the error
+// message m, or nil if m is not an error message or the flow cannot be
+// parsed.
+func originalFlow(proto int, m *Message) *Flow {
+	var data []byte
+	switch b := m.Body.(type) {
+	case *DstUnreach:
+		data = b.Data
+	case *TimeExceeded:
+		data = b.Data
+	case *ParamProb:
+		data = b.Data
+	case *PacketTooBig:
+		data = b.Data
+	default:
+		return nil
+	}
+	var f Flow
+	switch proto {
+	case iana.ProtocolICMP:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return nil
+		}
+		hdrlen := int(data[0]&0x0f) << 2
+		if hdrlen < 20 || len(data) < hdrlen {
+			return nil
+		}
+		f.Protocol = int(data[9])
+		f.Src = net.IP(data[12:16])
+		f.Dst = net.IP(data[16:20])
+		data = data[hdrlen:]
+	case iana.ProtocolIPv6ICMP:
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return nil
+		}
+		f.Protocol = int(data[6])
+		f.Src = net.IP(data[8:24])
+		f.Dst = net.IP(data[24:40])
+		data = data[40:]
+		// Skip the extension headers which may precede the transport
+		// header.
+		for {
+			switch f.Protocol {
+			case iana.ProtocolHOPOPT, iana.ProtocolIPv6Route, iana.ProtocolIPv6Opts:
+				if len(data) < 2 || len(data) < (int(data[1])+1)*8 {
+					return &f
+				}
+				f.Protocol = int(data[0])
+				data = data[(int(data[1])+1)*8:]
+				continue
+			case iana.ProtocolIPv6Frag:
+				if len(data) < 8 {
+					return &f
+				}
+				f.Protocol = int(data[0])
+				data = data[8:]
+				continue
+			}
+			break
+		}
+	default:
+		return nil
+	}
+	if len(data) < 8 {
+		return &f
+	}
+	switch f.Protocol {
+	case iana.ProtocolICMP, iana.ProtocolIPv6ICMP:
+		// The identifier of the echo requests, which is all the flow
+		// may be told apart by.
+		f.SrcPort = int(binary.BigEndian.Uint16(data[4:6]))
+	default:
+		f.SrcPort = int(binary.BigEndian.Uint16(data[0:2]))
+		f.DstPort = int(binary.BigEndian.Uint16(data[2:4]))
+	}
+	return &f
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/internal/iana"
+	"golang.org/x/net/ipv4"
+)
+
+func TestDemux(t *testing.T) {
+	// The messages are sent over UDP, which needs no privileges.
+	uc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer uc.Close()
+	d := NewDemux(&PacketConn{c: uc}, iana.ProtocolICMP)
+	defer d.Close()
+
+	id1, id2 := 1, 2
+	echo1 := d.Subscribe(Filter{Types: []Type{ipv4.ICMPTypeEchoReply}, EchoID: &id1}, 1)
+	echo2 := d.Subscribe(Filter{Types: []Type{ipv4.ICMPTypeEchoReply}, EchoID: &id2}, 1)
+	udp := d.Subscribe(Filter{
+		Types: []Type{ipv4.ICMPTypeDestinationUnreachable},
+		Codes: []int{3},
+		Flow:  &Flow{Protocol: iana.ProtocolUDP, DstPort: 33434},
+	}, 1)
+
+	// An IPv4 header followed by a UDP header from port 5000 to 33434.
+	orig := []byte{
+		0x45, 0x00, 0x00, 0x1c, 0, 0, 0, 0, 0x40, 0x11, 0, 0,
+		192, 0, 2, 1,
+		198, 51, 100, 1,
+		0x13, 0x88, 0x82, 0x9a, 0x00, 0x08, 0, 0,
+	}
+	for _, m := range []Message{
+		{Type: ipv4.ICMPTypeEchoReply, Body: &Echo{ID: id2, Seq: 1}},
+		{Type: ipv4.ICMPTypeEchoReply, Body: &Echo{ID: 3, Seq: 1}},
+		{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 1, Body: &DstUnreach{Data: orig}},
+		{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 3, Body: &DstUnreach{Data: orig}},
+		{Type: ipv4.ICMPTypeEchoReply, Body: &Echo{ID: id1, Seq: 1}},
+	} {
+		b, err := m.Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := uc.WriteTo(b, uc.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recv := func(name string, s *Subscription) *Packet {
+		t.Helper()
+		select {
+		case p := <-s.C:
+			return p
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: no message received", name)
+		}
+		return nil
+	}
+	if p := recv("echo1", echo1); p.Message.Body.(*Echo).ID != id1 {
+		t.Errorf("echo1: got %#v", p.Message.Body)
+	}
+	if p := recv("echo2", echo2); p.Message.Body.(*Echo).ID != id2 {
+		t.Errorf("echo2: got %#v", p.Message.Body)
+	}
+	p := recv("udp", udp)
+	if p.Message.Code != 3 {
+		t.Errorf("udp: got code %d; want 3", p.Message.Code)
+	}
+	want := Flow{Protocol: iana.ProtocolUDP, Src: net.IPv4(192, 0, 2, 1), Dst: net.IPv4(198, 51, 100, 1), SrcPort: 5000, DstPort: 33434}
+	if f := p.Flow; f == nil || !want.matches(f) || f.SrcPort != want.SrcPort {
+		t.Errorf("udp: got flow %+v; want %+v", f, want)
+	}
+
+	echo2.Close()
+	if _, ok := <-echo2.C; ok {
+		t.Error("echo2: message received after Close")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Subscription{echo1, udp} {
+		select {
+		case p, ok := <-s.C:
+			if ok {
+				t.Errorf("unexpected message %#v", p.Message)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("subscription not closed by the Demux")
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Errorf("Err() = %v; want nil", err)
+	}
+}
+
+func TestDemuxReadDeadline(t *testing.T) {
+	uc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer uc.Close()
+	if err := uc.SetReadDeadline(time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDemux(&PacketConn{c: uc}, iana.ProtocolICMP)
+	defer d.Close()
+	s := d.Subscribe(Filter{}, 1)
+	select {
+	case _, ok := <-s.C:
+		if ok {
+			t.Fatal("message received")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("subscription not closed after the read deadline")
+	}
+	if ne, ok := d.Err().(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("Err() = %v; want a timeout", d.Err())
+	}
+}
@@ -75,7 +75,98 @@ type Message struct {
 // checksum field when psh is not nil, otherwise the kernel will
 // compute the checksum field during the message transmission.
 // When psh is not nil, it must be the pseudo header for IPv6.
+//
+// See MarshalWith for explicit control of the checksum.
 func (m *Message) Marshal(psh []byte) ([]byte, error) {
+	if _, ok := m.Type.(ipv4.ICMPType); ok {
+		psh = nil
+	}
+	return m.marshal(psh, m.Type != nil && (m.Type.Protocol() == iana.ProtocolICMP || psh != nil))
+}
+
+// A ChecksumMode selects how MarshalWith fills the checksum field of a
+// message.
+type ChecksumMode int
+
+const (
+	// ChecksumAuto calculates the checksum of ICMPv4 messages, and of
+	// ICMPv6 messages when the source and destination addresses are
+	// given. The checksum of other ICMPv6 messages is left zero, for the
+	// kernel to compute it during the message transmission, as it does
+	// on ICMPv6 sockets.
+	ChecksumAuto ChecksumMode = iota
+
+	// ChecksumCompute calculates the checksum, and fails for ICMPv6
+	// messages without source and destination addresses.
+	ChecksumCompute
+
+	// ChecksumOffload leaves the checksum zero, for the kernel or the
+	// network interface to compute it.
+	ChecksumOffload
+
+	// ChecksumKeep writes the Checksum field of the message as is, for
+	// instance to send a message with an invalid checksum.
+	ChecksumKeep
+)
+
+// MarshalOptions holds the options of MarshalWith.
+type MarshalOptions struct {
+	// Checksum selects how the checksum field is filled.
+	Checksum ChecksumMode
+
+	// Src and Dst are the source and destination IPv6 addresses of an
+	// ICMPv6 message, from which the pseudo header covered by its
+	// checksum is built. Either both or none must be set. They are
+	// ignored for ICMPv4 messages.
+	Src, Dst net.IP
+}
+
+var (
+	errInvalidChecksumMode = errors.New("invalid checksum mode")
+	errNoPseudoHeader      = errors.New("source and destination addresses required for ICMPv6 checksum")
+	errInvalidAddress      = errors.New("invalid IPv6 address")
+)
+
+// MarshalWith returns the binary encoding of the ICMP message m, with its
+// checksum field filled as selected by opts.
+func (m *Message) MarshalWith(opts MarshalOptions) ([]byte, error) {
+	if _, ok := m.Type.(ipv6.ICMPType); !ok {
+		opts.Src, opts.Dst = nil, nil
+	}
+	var psh []byte
+	if opts.Src != nil || opts.Dst != nil {
+		src, dst := opts.Src.To16(), opts.Dst.To16()
+		if src == nil || dst == nil || opts.Src.To4() != nil || opts.Dst.To4() != nil {
+			return nil, errInvalidAddress
+		}
+		psh = IPv6PseudoHeader(src, dst)
+	}
+	var compute bool
+	switch opts.Checksum {
+	case ChecksumAuto:
+		compute = m.Type != nil && (m.Type.Protocol() == iana.ProtocolICMP || psh != nil)
+	case ChecksumCompute:
+		if m.Type != nil && m.Type.Protocol() == iana.ProtocolIPv6ICMP && psh == nil {
+			return nil, errNoPseudoHeader
+		}
+		compute = true
+	case ChecksumOffload, ChecksumKeep:
+	default:
+		return nil, errInvalidChecksumMode
+	}
+	b, err := m.marshal(psh, compute)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Checksum == ChecksumKeep {
+		binary.BigEndian.PutUint16(b[2:4], uint16(m.Checksum))
+	}
+	return b, nil
+}
+
+// marshal returns the binary encoding of m, with its checksum calculated
+// if compute, and covering the IPv6 pseudo header psh if not nil.
+func (m *Message) marshal(psh []byte, compute bool) ([]byte, error) {
 	var mtype byte
 	switch typ := m.Type.(type) {
 	case ipv4.ICMPType:
@@ -85,11 +176,14 @@ func (m *Message) Marshal(psh []byte) ([]byte, error) {
 	default:
 		return nil, errInvalidProtocol
 	}
-	b := []byte{mtype, byte(m.Code), 0, 0}
 	proto := m.Type.Protocol()
-	if proto == iana.ProtocolIPv6ICMP && psh != nil {
-		b = append(psh, b...)
+	if !compute {
+		psh = nil
 	}
+	// Copy psh, so that the pseudo header of the caller is not modified.
+	b := make([]byte, len(psh), len(psh)+4)
+	copy(b, psh)
+	b = append(b, mtype, byte(m.Code), 0, 0)
 	if m.Body != nil && m.Body.Len(proto) != 0 {
 		mb, err := m.Body.Marshal(proto)
 		if err != nil {
@@ -97,10 +191,10 @@ func (m *Message) Marshal(psh []byte) ([]byte, error) {
 		}
 		b = append(b, mb...)
 	}
-	if proto == iana.ProtocolIPv6ICMP {
-		if psh == nil { // cannot calculate checksum here
-			return b, nil
-		}
+	if !compute {
+		return b, nil
+	}
+	if psh != nil {
 		off, l := 2*net.IPv6len, len(b)-len(psh)
 		binary.BigEndian.PutUint32(b[off:off+4], uint32(l))
 	}
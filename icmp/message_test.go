@@ -341,3 +341,68 @@ func TestMarshalAndParseRawMessage(t *testing.T) {
 		}
 	})
 }
+
+func TestMarshalWith(t *testing.T) {
+	src, dst := net.ParseIP("fe80::1"), net.ParseIP("ff02::1")
+	echo := func(typ icmp.Type) *icmp.Message {
+		return &icmp.Message{
+			Type: typ, Code: 0, Checksum: 0x1234,
+			Body: &icmp.Echo{ID: 1, Seq: 2, Data: []byte("HELLO-R-U-THERE")},
+		}
+	}
+	psh := icmp.IPv6PseudoHeader(src, dst)
+	pshCopy := append([]byte(nil), psh...)
+	want, err := echo(ipv6.ICMPTypeEchoRequest).Marshal(psh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(psh, pshCopy) {
+		t.Errorf("Marshal modified the pseudo header")
+	}
+	checksum := func(b []byte) []byte { return b[2:4] }
+
+	for _, tc := range []struct {
+		name    string
+		typ     icmp.Type
+		opts    icmp.MarshalOptions
+		want    []byte // checksum field
+		wantErr bool
+	}{
+		{"v6 auto with addresses", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Src: src, Dst: dst}, checksum(want), false},
+		{"v6 compute", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Checksum: icmp.ChecksumCompute, Src: src, Dst: dst}, checksum(want), false},
+		{"v6 auto without addresses", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{}, []byte{0, 0}, false},
+		{"v6 compute without addresses", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Checksum: icmp.ChecksumCompute}, nil, true},
+		{"v6 one address", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Src: src}, nil, true},
+		{"v6 IPv4 address", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Src: net.IPv4(192, 0, 2, 1), Dst: dst}, nil, true},
+		{"v6 offload", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Checksum: icmp.ChecksumOffload, Src: src, Dst: dst}, []byte{0, 0}, false},
+		{"v6 keep", ipv6.ICMPTypeEchoRequest, icmp.MarshalOptions{Checksum: icmp.ChecksumKeep}, []byte{0x12, 0x34}, false},
+		{"v4 offload", ipv4.ICMPTypeEcho, icmp.MarshalOptions{Checksum: icmp.ChecksumOffload}, []byte{0, 0}, false},
+		{"invalid mode", ipv4.ICMPTypeEcho, icmp.MarshalOptions{Checksum: -1}, nil, true},
+	} {
+		b, err := echo(tc.typ).MarshalWith(tc.opts)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %x; want an error", tc.name, b)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := checksum(b); !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: got checksum %x; want %x", tc.name, got, tc.want)
+		}
+	}
+
+	v4, err := echo(ipv4.ICMPTypeEcho).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []icmp.ChecksumMode{icmp.ChecksumAuto, icmp.ChecksumCompute} {
+		b, err := echo(ipv4.ICMPTypeEcho).MarshalWith(icmp.MarshalOptions{Checksum: mode, Src: src, Dst: dst})
+		if err != nil || !bytes.Equal(b, v4) {
+			t.Errorf("ICMPv4 message with mode %d: got %x, %v; want %x", mode, b, err, v4)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/internal/iana"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// A Responder answers the echo requests it receives with echo replies,
+// as a host does, with optional loss and latency, for the tests of
+// probers and the hosts of virtual networks. It reads the messages of a
+// PacketConn, which may be a PacketConn of this package or any
+// net.PacketConn carrying ICMP messages, such as a UDP socket on the
+// loopback interface.
+//
+// The fields must not be changed once Serve is called.
+type Responder struct {
+	// Loss is the probability, from 0 to 1, that an echo request goes
+	// unanswered.
+	Loss float64
+
+	// Delay delays each reply, by Delay plus a random duration of up to
+	// Jitter.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// Rand, if non-nil, is the source of the randomness of Loss and
+	// Jitter, such as rand.New(rand.NewSource(1)) for the replies to a
+	// sequence of requests to be reproducible. If nil, a source seeded
+	// with the current time is used.
+	Rand *rand.Rand
+
+	mu       sync.Mutex
+	received uint64
+	replied  uint64
+}
+
+// Serve answers the echo requests of the protocol proto, either
+// iana.ProtocolICMP or iana.ProtocolIPv6ICMP, received on c, until
+// reading c fails, such as when c is closed, and returns that error once
+// the delayed replies are sent. The messages which are not echo requests
+// are ignored.
+//
+// The replies of ICMPv6 are sent without checksum, which the kernel
+// computes for the PacketConns of this package.
+func (r *Responder) Serve(c net.PacketConn, proto int) error {
+	replyType := Type(ipv4.ICMPTypeEchoReply)
+	requestType := Type(ipv4.ICMPTypeEcho)
+	if proto == iana.ProtocolIPv6ICMP {
+		replyType, requestType = ipv6.ICMPTypeEchoReply, ipv6.ICMPTypeEchoRequest
+	}
+	r.mu.Lock()
+	if r.Rand == nil {
+		r.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	b := make([]byte, 1<<16)
+	for {
+		n, peer, err := c.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+		m, err := ParseMessage(proto, b[:n])
+		if err != nil || m.Type != requestType {
+			continue
+		}
+		echo, ok := m.Body.(*Echo)
+		if !ok {
+			continue
+		}
+		lost, delay := r.plan()
+		if lost {
+			continue
+		}
+		reply := Message{
+			Type: replyType,
+			Body: &Echo{ID: echo.ID, Seq: echo.Seq, Data: echo.Data},
+		}
+		wb, err := reply.Marshal(nil)
+		if err != nil {
+			continue
+		}
+		if delay <= 0 {
+			r.send(c, wb, peer)
+			continue
+		}
+		wg.Add(1)
+		time.AfterFunc(delay, func() {
+			defer wg.Done()
+			r.send(c, wb, peer)
+		})
+	}
+}
+
+// plan counts an echo request received, and returns whether it is lost
+// and the delay of its reply.
+func (r *Responder) plan() (lost bool, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received++
+	if r.Loss > 0 && r.Rand.Float64() < r.Loss {
+		return true, 0
+	}
+	delay = r.Delay
+	if r.Jitter > 0 {
+		delay += time.Duration(r.Rand.Int63n(int64(r.Jitter) + 1))
+	}
+	return false, delay
+}
+
+func (r *Responder) send(c net.PacketConn, b []byte, peer net.Addr) {
+	if _, err := c.WriteTo(b, peer); err != nil {
+		return
+	}
+	r.mu.Lock()
+	r.replied++
+	r.mu.Unlock()
+}
+
+// Stats returns the number of echo requests received and of replies sent
+// so far.
+func (r *Responder) Stats() (received, replied uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.received, r.replied
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/internal/iana"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// listenResponder returns a UDP socket on the loopback interface served
+// by r, another to send it messages from, and the result of Serve.
+func listenResponder(t *testing.T, r *Responder, proto int) (server, client net.PacketConn, done <-chan error) {
+	t.Helper()
+	sc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { sc.Close() })
+	client, err = net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	errc := make(chan error, 1)
+	go func() { errc <- r.Serve(sc, proto) }()
+	return sc, client, errc
+}
+
+func TestResponder(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	r := &Responder{Delay: delay}
+	sc, c, done := listenResponder(t, r, iana.ProtocolIPv6ICMP)
+	addr := sc.LocalAddr()
+
+	for _, m := range []Message{
+		{Type: ipv6.ICMPTypeEchoReply, Body: &Echo{ID: 1, Seq: 1}},
+		{Type: ipv6.ICMPTypeEchoRequest, Body: &Echo{ID: 7, Seq: 2, Data: []byte("ping")}},
+	} {
+		b, err := m.Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.WriteTo(b, addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 1500)
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < delay/2 {
+		t.Errorf("reply after %v; want a delay of %v", d, delay)
+	}
+	m, err := ParseMessage(iana.ProtocolIPv6ICMP, b[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo, ok := m.Body.(*Echo)
+	if m.Type != ipv6.ICMPTypeEchoReply || !ok || echo.ID != 7 || echo.Seq != 2 || string(echo.Data) != "ping" {
+		t.Errorf("got %+v with body %+v; want an echo reply of ID 7, Seq 2 with data %q", m, m.Body, "ping")
+	}
+	if received, replied := r.Stats(); received != 1 || replied != 1 {
+		t.Errorf("Stats() = %d, %d; want 1, 1", received, replied)
+	}
+	sc.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Serve returned nil after its PacketConn was closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Serve did not return after its PacketConn was closed")
+	}
+}
+
+func TestResponderLoss(t *testing.T) {
+	const requests = 200
+	// The seeds of the Responder and of the expectation are the same.
+	r := &Responder{Loss: 0.3, Rand: rand.New(rand.NewSource(1))}
+	sc, c, _ := listenResponder(t, r, iana.ProtocolICMP)
+	addr := sc.LocalAddr()
+	want := map[int]bool{}
+	rnd := rand.New(rand.NewSource(1))
+	for seq := 0; seq < requests; seq++ {
+		if rnd.Float64() >= r.Loss {
+			want[seq] = true
+		}
+	}
+
+	got := map[int]bool{}
+	b := make([]byte, 1500)
+	for seq := 0; seq < requests; seq++ {
+		m := Message{Type: ipv4.ICMPTypeEcho, Body: &Echo{ID: 1, Seq: seq}}
+		wb, err := m.Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.WriteTo(wb, addr); err != nil {
+			t.Fatal(err)
+		}
+		// One request at a time, for the replies to follow the
+		// sequence of the random source.
+		if !want[seq] {
+			continue
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := c.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("request %d: %v", seq, err)
+		}
+		rm, err := ParseMessage(iana.ProtocolICMP, b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[rm.Body.(*Echo).Seq] = true
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d replies; want %d", len(got), len(want))
+	}
+	for seq := range want {
+		if !got[seq] {
+			t.Errorf("no reply to request %d", seq)
+		}
+	}
+	// The last requests, which are lost, may not have been received yet.
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if received, _ := r.Stats(); received == requests {
+			break
+		}
+	}
+	if received, replied := r.Stats(); received != requests || replied != uint64(len(want)) {
+		t.Errorf("Stats() = %d, %d; want %d, %d", received, replied, requests, len(want))
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBackoffStart = 100 * time.Millisecond
+	defaultMaxBackoff   = 10 * time.Second
+)
+
+// A Scheduler paces the probes of a prober, such as echo requests or the
+// datagrams of a traceroute, so as to respect the rate limits which
+// routers and hosts apply to the ICMP messages they send: probes sent
+// faster go unanswered, as if the destination were unreachable.
+//
+// A Scheduler paces the probes to each destination and all of them
+// together. A destination is identified by a key chosen by the prober,
+// such as the address of a host, or the address of the target and the
+// hop limit of the probes of a traceroute, whose replies come from each
+// router on the path. When the probes to a destination go unanswered, the
+// interval between them doubles with each, until a reply arrives. The
+// state of a destination neither probed nor reported for MaxBackoff is
+// dropped, as with Forget.
+//
+// The zero value paces nothing. The fields must not be changed once the
+// Scheduler is used. A Scheduler may be used by multiple goroutines
+// simultaneously.
+type Scheduler struct {
+	// Rate is the number of probes per second sent to all the
+	// destinations, allowing bursts of Burst probes, at least one. If
+	// zero or negative, the aggregate rate is not limited.
+	Rate  float64
+	Burst int
+
+	// Interval is the minimum interval between two probes to the same
+	// destination.
+	Interval time.Duration
+
+	// MaxBackoff limits the interval between the probes to a
+	// destination whose probes go unanswered, which starts from
+	// Interval, or 100 milliseconds if Interval is zero, and doubles with
+	// each probe unanswered. If zero, ten seconds is used.
+	MaxBackoff time.Duration
+
+	now func() time.Time // for tests; time.Now if nil
+
+	mu    sync.Mutex
+	tat   time.Time // theoretical arrival time of the next probe, for Rate
+	swept time.Time // last removal of the idle destinations
+	dests map[string]*scheduleDest
+}
+
+// A scheduleDest is the pacing state of a destination of a Scheduler.
+type scheduleDest struct {
+	next     time.Time // earliest time of the next probe
+	seen     time.Time // last reservation or report
+	failures int       // consecutive probes unanswered
+}
+
+// Wait reserves the next probe to the destination dst and blocks until
+// it may be sent. If ctx is done before, Wait returns the error of ctx,
+// and the probe stays reserved.
+func (s *Scheduler) Wait(ctx context.Context, dst string) error {
+	d := s.Reserve(dst)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reserve reserves the next probe to the destination dst, and returns
+// the delay after which it may be sent.
+func (s *Scheduler) Reserve(dst string) time.Duration {
+	now := s.clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dests == nil {
+		s.dests = make(map[string]*scheduleDest)
+	}
+	if now.Sub(s.swept) >= s.maxBackoff() {
+		s.expire(now)
+		s.swept = now
+	}
+	d := s.dests[dst]
+	if d == nil {
+		d = &scheduleDest{}
+		s.dests[dst] = d
+	}
+	at := now
+	if d.next.After(at) {
+		at = d.next
+	}
+	if s.Rate > 0 {
+		// The generic cell rate algorithm: a probe conforms if it is
+		// sent no earlier than Burst-1 emission intervals before its
+		// theoretical arrival time.
+		emission := time.Duration(float64(time.Second) / s.Rate)
+		burst := s.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		if earliest := s.tat.Add(-time.Duration(burst-1) * emission); earliest.After(at) {
+			at = earliest
+		}
+		if s.tat.Before(at) {
+			s.tat = at
+		}
+		s.tat = s.tat.Add(emission)
+	}
+	d.next = at.Add(s.interval(d))
+	d.seen = now
+	return at.Sub(now)
+}
+
+// expire removes the destinations idle for MaxBackoff, whose next probe
+// was due as long ago.
+func (s *Scheduler) expire(now time.Time) {
+	cutoff := now.Add(-s.maxBackoff())
+	for dst, d := range s.dests {
+		if d.seen.Before(cutoff) && d.next.Before(cutoff) {
+			delete(s.dests, dst)
+		}
+	}
+}
+
+func (s *Scheduler) maxBackoff() time.Duration {
+	if s.MaxBackoff <= 0 {
+		return defaultMaxBackoff
+	}
+	return s.MaxBackoff
+}
+
+// interval returns the interval between two probes to the destination
+// of d.
+func (s *Scheduler) interval(d *scheduleDest) time.Duration {
+	if d.failures == 0 {
+		return s.Interval
+	}
+	max := s.maxBackoff()
+	backoff := s.Interval
+	if backoff <= 0 {
+		backoff = defaultBackoffStart
+	}
+	for i := 0; i < d.failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// Reply reports that a reply to a probe to the destination dst arrived,
+// such as an echo reply or a time exceeded or destination unreachable
+// message, ending its backoff.
+func (s *Scheduler) Reply(dst string) {
+	now := s.clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.dests[dst]; d != nil {
+		d.seen = now
+		if d.failures > 0 {
+			// The next probe was scheduled with the backoff.
+			d.next = d.next.Add(-s.interval(d) + s.Interval)
+		}
+		d.failures = 0
+	}
+}
+
+// Timeout reports that a probe to the destination dst was unanswered,
+// doubling the interval before the next ones, including the one already
+// reserved.
+func (s *Scheduler) Timeout(dst string) {
+	now := s.clock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d := s.dests[dst]; d != nil {
+		d.seen = now
+		if d.failures < 64 {
+			// The next probe was scheduled with the previous interval.
+			prev := s.interval(d)
+			d.failures++
+			d.next = d.next.Add(s.interval(d) - prev)
+		}
+	}
+}
+
+// Forget removes the state of the destination dst, such as once its
+// probing is done.
+func (s *Scheduler) Forget(dst string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.dests, dst)
+}
+
+func (s *Scheduler) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
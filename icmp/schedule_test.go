@@ -0,0 +1,82 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	now := time.Unix(1e9, 0)
+	s := &Scheduler{
+		Rate:       10,
+		Burst:      2,
+		Interval:   time.Second,
+		MaxBackoff: 4 * time.Second,
+		now:        func() time.Time { return now },
+	}
+	reserve := func(dst string, want time.Duration) {
+		t.Helper()
+		if got := s.Reserve(dst); got != want {
+			t.Errorf("Reserve(%q) = %v; want %v", dst, got, want)
+		}
+	}
+
+	// A burst of two, then the aggregate rate.
+	reserve("a", 0)
+	reserve("b", 0)
+	reserve("c", 100*time.Millisecond)
+	reserve("d", 200*time.Millisecond)
+
+	// The interval of a destination.
+	now = now.Add(time.Second)
+	reserve("a", 0)
+	reserve("a", time.Second)
+
+	// The backoff of a destination whose probes go unanswered.
+	now = now.Add(10 * time.Second)
+	s.Timeout("b")
+	reserve("b", 0)
+	s.Timeout("b")
+	reserve("b", 4*time.Second)
+	reserve("b", 8*time.Second) // the backoff is at most MaxBackoff
+	s.Reply("b")
+	reserve("b", 9*time.Second)
+
+	s.Forget("b")
+	now = now.Add(10 * time.Second)
+	reserve("b", 0)
+
+	// The idle destinations expire.
+	now = now.Add(10 * time.Second)
+	reserve("e", 0)
+	if _, ok := s.dests["e"]; len(s.dests) != 1 || !ok {
+		t.Errorf("destinations after idling: %v; want only e", s.dests)
+	}
+}
+
+func TestSchedulerZero(t *testing.T) {
+	var s Scheduler
+	for i := 0; i < 10; i++ {
+		if err := s.Wait(context.Background(), "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Timeout("a")
+	if d := s.Reserve("a"); d <= 0 || d > defaultBackoffStart*2 {
+		t.Errorf("Reserve after a timeout = %v; want at most %v", d, defaultBackoffStart*2)
+	}
+	if d := s.Reserve("a"); d <= defaultBackoffStart*2 || d > defaultBackoffStart*4 {
+		t.Errorf("Reserve during the backoff = %v; want at most %v", d, defaultBackoffStart*4)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Wait(ctx, "a"); err != context.Canceled {
+		t.Errorf("Wait with a canceled context = %v; want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package idna
+
+import (
+	"strings"
+	"unicode"
+)
+
+// displayScripts lists the combinations of scripts which a label may mix
+// and still be displayed in Unicode by a Profile with the SafeDisplay
+// option. They are those of the Highly Restrictive level of UTS #39,
+// which browsers use for their display policies; a label in a single
+// script is always accepted.
+var displayScripts = [][]*unicode.RangeTable{
+	{unicode.Latin, unicode.Han, unicode.Hiragana, unicode.Katakana},
+	{unicode.Latin, unicode.Han, unicode.Bopomofo},
+	{unicode.Latin, unicode.Han, unicode.Hangul},
+}
+
+// displayableScripts are the scripts of the labels which may be displayed
+// in Unicode, the Recommended scripts of UTS #31, Table 5, but for Common
+// and Inherited, which are used with any script. The runes of the other
+// scripts, of limited use, are not displayed, as browsers do not display
+// them. The tables are listed rather than looked up in unicode.Scripts,
+// which would link that of every script in the binaries using the
+// package.
+var displayableScripts = []*unicode.RangeTable{
+	unicode.Latin,
+	unicode.Arabic,
+	unicode.Armenian,
+	unicode.Bengali,
+	unicode.Bopomofo,
+	unicode.Cyrillic,
+	unicode.Devanagari,
+	unicode.Ethiopic,
+	unicode.Georgian,
+	unicode.Greek,
+	unicode.Gujarati,
+	unicode.Gurmukhi,
+	unicode.Han,
+	unicode.Hangul,
+	unicode.Hebrew,
+	unicode.Hiragana,
+	unicode.Kannada,
+	unicode.Katakana,
+	unicode.Khmer,
+	unicode.Lao,
+	unicode.Malayalam,
+	unicode.Myanmar,
+	unicode.Oriya,
+	unicode.Sinhala,
+	unicode.Tamil,
+	unicode.Telugu,
+	unicode.Thaana,
+	unicode.Thai,
+	unicode.Tibetan,
+}
+
+// latinConfusables lists, for the scripts whose letters may imitate Latin
+// ones, the letters which do, as in "аррӏе" in Cyrillic. A label written
+// only with them is a whole-script confusable of a Latin label.
+var latinConfusables = map[*unicode.RangeTable]string{
+	unicode.Cyrillic: "асԁеһіјӏорԛѕԝхуүѵ",
+	unicode.Greek:    "αικνορτυχ",
+}
+
+// spoofable reports whether the label s should not be displayed in its
+// Unicode form, as it contains invisible runes or runes of scripts which
+// are not displayed, mixes scripts in a way that may be used to imitate
+// another label, or is written only with letters imitating Latin ones.
+func spoofable(s string) bool {
+	var scripts []*unicode.RangeTable
+	for _, r := range s {
+		if invisible(r) {
+			return true
+		}
+		t, ok := script(r)
+		if !ok {
+			return true
+		}
+		if t == nil {
+			continue
+		}
+		seen := false
+		for _, u := range scripts {
+			if u == t {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			scripts = append(scripts, t)
+		}
+	}
+	if len(scripts) == 0 {
+		return false
+	}
+	if len(scripts) == 1 {
+		return confusable(s, latinConfusables[scripts[0]])
+	}
+	for _, allowed := range displayScripts {
+		if subset(scripts, allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+// invisible reports whether r is not rendered visibly, such as the format
+// characters, which include the zero-width joiners, and the variation
+// selectors.
+func invisible(r rune) bool {
+	return unicode.In(r, unicode.Cf, unicode.Variation_Selector, unicode.Other_Default_Ignorable_Code_Point)
+}
+
+// confusable reports whether the letters of s are all in lookalikes.
+func confusable(s, lookalikes string) bool {
+	if lookalikes == "" {
+		return false
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) && !strings.ContainsRune(lookalikes, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// script returns the script of r, or nil if r is in the Common or
+// Inherited script, which are used with any script. It reports false if r
+// is in none of the displayableScripts.
+func script(r rune) (*unicode.RangeTable, bool) {
+	if r < 0x80 {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+			return unicode.Latin, true
+		}
+		return nil, true
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return nil, true
+	}
+	for _, t := range displayableScripts {
+		if unicode.Is(t, r) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// subset reports whether all the tables of a are in b.
+func subset(a, b []*unicode.RangeTable) bool {
+	for _, t := range a {
+		found := false
+		for _, u := range b {
+			if t == u {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
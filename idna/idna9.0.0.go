@@ -135,6 +135,22 @@ func StrictDomainName(use bool) Option {
 	return func(o *options) { o.useSTD3Rules = use }
 }
 
+// SafeDisplay sets whether ToUnicode should keep the Punycode form of the
+// labels which may be used for spoofing, because they contain invisible
+// runes or runes of the scripts of limited use of UTS #31, mix scripts
+// other than in the combinations of the Highly Restrictive level of UTS
+// #39, such as Latin with Han and Hiragana, or are written in Cyrillic or
+// Greek only with letters which look like Latin ones, such as "аррӏе".
+// This mirrors the display policies of web browsers, which only show such
+// labels as Punycode. It is typically combined with the Display profile:
+//
+//	p := idna.New(idna.MapForLookup(), idna.BidiRule(), idna.SafeDisplay(true))
+//
+// The option has no effect on ToASCII.
+func SafeDisplay(enable bool) Option {
+	return func(o *options) { o.safeDisplay = enable }
+}
+
 // NOTE: the following options pull in tables. The tables should not be linked
 // in as long as the options are not used.
 
@@ -182,6 +198,7 @@ type options struct {
 	checkJoiners      bool
 	verifyDNSLength   bool
 	removeLeadingDots bool
+	safeDisplay       bool
 
 	trie *idnaTrie
 
@@ -261,6 +278,9 @@ func (p *Profile) String() string {
 	if p.verifyDNSLength {
 		s += ":VerifyDNSLength"
 	}
+	if p.safeDisplay {
+		s += ":SafeDisplay"
+	}
 	return s
 }
 
@@ -402,6 +422,16 @@ func (p *Profile) process(s string, toASCII bool) (string, error) {
 			}
 		}
 	}
+	if !toASCII && p.safeDisplay {
+		for labels.reset(); !labels.done(); labels.next() {
+			label := labels.label()
+			if !ascii(label) && spoofable(label) {
+				if a, err2 := encode(acePrefix, label); err2 == nil {
+					labels.set(a)
+				}
+			}
+		}
+	}
 	s = labels.result()
 	if toASCII && p.verifyDNSLength && err == nil {
 		// Compute the length of the domain name minus the root label and its dot.
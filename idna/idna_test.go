@@ -104,5 +104,40 @@ func TestIDNASeparators(t *testing.T) {
 	}
 }
 
+func TestSafeDisplay(t *testing.T) {
+	display := New(MapForLookup(), BidiRule(), SafeDisplay(true))
+	raw := New(SafeDisplay(true))
+	for _, tc := range []struct {
+		profile *Profile
+		ascii   string
+		want    string
+	}{
+		{display, "www.xn--mller-kva.de", "www.müller.de"},
+		{display, "example.xn--p1ai", "example.рф"},
+		{display, "xn--hxajbheg2az3al.gr", "παράδειγμα.gr"},
+		{display, "xn--eckn5b6bzl1du13vmo2b.jp", "東京スカイツリー.jp"},
+		// Cyrillic "а" followed by Latin "pple".
+		{display, "xn--pple-43d.com", "xn--pple-43d.com"},
+		// "аррӏе" in Cyrillic only, and a label in Cherokee, a script of
+		// limited use.
+		{display, "xn--80ak6aa92e.com", "xn--80ak6aa92e.com"},
+		{display, "xn--f9dt7l.com", "xn--f9dt7l.com"},
+		{display, "xn--0xack.gr", "τοπ.gr"},
+		// Zero-width non-joiner and variation selector.
+		{raw, "xn--ab-j1t.com", "xn--ab-j1t.com"},
+		{raw, "xn--ab-472n.com", "xn--ab-472n.com"},
+		{raw, "xn--bcher-kva.com", "bücher.com"},
+	} {
+		if got, err := tc.profile.ToUnicode(tc.ascii); err != nil {
+			t.Errorf("%v.ToUnicode(%q): %v", tc.profile, tc.ascii, err)
+		} else if got != tc.want {
+			t.Errorf("%v.ToUnicode(%q): got %q, want %q", tc.profile, tc.ascii, got, tc.want)
+		}
+	}
+	if got, _ := Display.ToUnicode("xn--pple-43d.com"); got != "аpple.com" {
+		t.Errorf("Display.ToUnicode(%q): got %q, want the Unicode form", "xn--pple-43d.com", got)
+	}
+}
+
 // TODO(nigeltao): test errors, once we've specified when ToASCII and ToUnicode
 // return errors.
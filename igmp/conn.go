@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package igmp
+
+import (
+	"net"
+	"runtime"
+
+	"golang.org/x/net/internal/iana"
+	"golang.org/x/net/ipv4"
+)
+
+var (
+	allSystems   = net.IPv4(224, 0, 0, 1)  // all systems on this subnet
+	allRouters   = net.IPv4(224, 0, 0, 2)  // all routers on this subnet
+	allV3Routers = net.IPv4(224, 0, 0, 22) // all IGMPv3-capable multicast routers
+	routerAlert  = []byte{0x94, 0x04, 0x00, 0x00}
+)
+
+const tosInternetworkControl = 0xc0 // IP precedence of IGMP messages
+
+// Destination returns the IPv4 address to which the message m is sent
+// by default: the group of a report, or of a group-specific query, the
+// all-systems group for a general query, the all-routers group for a
+// leave group message, and the all IGMPv3-capable routers group for an
+// IGMPv3 report.
+func Destination(m Message) net.IP {
+	switch m := m.(type) {
+	case *Query:
+		if m.Group != nil && !m.Group.IsUnspecified() {
+			return m.Group
+		}
+		return allSystems
+	case *Report:
+		return m.Group
+	case *Leave:
+		return allRouters
+	default:
+		return allV3Routers
+	}
+}
+
+// WriteTo writes the IGMP message m through the raw IPv4 connection c,
+// which must use the IGMP protocol, such as one listening on "ip4:2".
+// The message is sent to dst, or to Destination(m) if dst is nil, on
+// the interface ifi if it is not nil.
+//
+// The IPv4 header written carries a TTL of 1 and the Router Alert
+// option, as required by RFC 2236 and RFC 3376, so that multicast
+// tooling need not build raw packets. Note that the groups joined with
+// JoinGroup, or the JoinGroup method of c, are also reported by the
+// kernel: a program sending its own reports for a group should not join
+// it.
+func WriteTo(c *ipv4.RawConn, m Message, dst net.IP, ifi *net.Interface) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if dst == nil {
+		dst = Destination(m)
+	}
+	h := newHeader(dst, len(b))
+	var cm *ipv4.ControlMessage
+	if ifi != nil {
+		cm = &ipv4.ControlMessage{IfIndex: ifi.Index}
+	}
+	return c.WriteTo(h, b, cm)
+}
+
+// JoinGroup joins the group on the interface ifi, or the default
+// multicast interface if ifi is nil, with the raw IPv4 connection c, as
+// a tool monitoring or querying the group does. Where supported, it
+// also restricts the multicast datagrams c receives to those of the
+// groups it joined. On Linux, it turns IP_MULTICAST_ALL off, without
+// which c would also receive the datagrams of the groups joined by the
+// other sockets of the host.
+//
+// The kernel still sends the membership reports of the group, as it
+// does for every group joined: no socket option suppresses them. A
+// program sending its own reports for a group, with WriteTo, should
+// rather not join it, and receives the general queries, sent to the
+// all-systems group, which every host joins, without joining.
+func JoinGroup(c *ipv4.RawConn, ifi *net.Interface, group net.IP) error {
+	if runtime.GOOS == "linux" {
+		if err := c.SetMulticastAll(false); err != nil {
+			return err
+		}
+	}
+	return c.JoinGroup(ifi, &net.IPAddr{IP: group})
+}
+
+// newHeader returns the IPv4 header of an IGMP message of n bytes to
+// dst.
+func newHeader(dst net.IP, n int) *ipv4.Header {
+	hdrLen := ipv4.HeaderLen + len(routerAlert)
+	return &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      hdrLen,
+		TOS:      tosInternetworkControl,
+		TotalLen: hdrLen + n,
+		TTL:      1,
+		Protocol: iana.ProtocolIGMP,
+		Dst:      dst,
+		Options:  routerAlert,
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package igmp
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/nettest"
+)
+
+func TestJoinGroup(t *testing.T) {
+	if !nettest.SupportsRawSocket() {
+		t.Skipf("not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	ifi, err := nettest.RoutedInterface("ip4", net.FlagUp|net.FlagMulticast|net.FlagLoopback)
+	if err != nil {
+		t.Skipf("not available on %s", runtime.GOOS)
+	}
+	c, err := net.ListenPacket("ip4:2", "0.0.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	r, err := ipv4.NewRawConn(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := net.IPv4(224, 0, 0, 250) // see RFC 4727
+	if err := JoinGroup(r, ifi, group); err != nil {
+		t.Fatal(err)
+	}
+	defer r.LeaveGroup(ifi, &net.IPAddr{IP: group})
+	if runtime.GOOS == "linux" {
+		if all, err := r.MulticastAll(); err != nil || all {
+			t.Errorf("MulticastAll = %v, %v; want false", all, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package igmp provides basic functions for the manipulation of
+// messages used in the Internet Group Management Protocol.
+//
+// IGMPv2 is defined in RFC 2236 and IGMPv3 in RFC 3376. IGMPv1
+// membership reports and queries, defined in RFC 1112, are parsed as
+// those of IGMPv2.
+package igmp // import "golang.org/x/net/igmp"
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	errMessageTooShort = errors.New("message too short")
+	errInvalidChecksum = errors.New("invalid checksum")
+	errInvalidAddress  = errors.New("invalid address")
+	errUnknownType     = errors.New("unknown message type")
+	errTooManySources  = errors.New("too many sources")
+	errInvalidAuxData  = errors.New("auxiliary data length not a multiple of 4")
+	errTooManyRecords  = errors.New("too many group records")
+)
+
+func checksum(b []byte) uint16 {
+	csumcv := len(b) - 1 // checksum coverage
+	s := uint32(0)
+	for i := 0; i < csumcv; i += 2 {
+		s += uint32(b[i+1])<<8 | uint32(b[i])
+	}
+	if csumcv&1 == 0 {
+		s += uint32(b[csumcv])
+	}
+	s = s>>16 + s&0xffff
+	s = s + s>>16
+	return ^uint16(s)
+}
+
+// A Type represents an IGMP message type.
+type Type int
+
+const (
+	TypeMembershipQuery    Type = 0x11 // membership query
+	TypeV1MembershipReport Type = 0x12 // IGMPv1 membership report
+	TypeV2MembershipReport Type = 0x16 // IGMPv2 membership report
+	TypeV2LeaveGroup       Type = 0x17 // IGMPv2 leave group
+	TypeV3MembershipReport Type = 0x22 // IGMPv3 membership report
+)
+
+var typeNames = map[Type]string{
+	TypeMembershipQuery:    "membership query",
+	TypeV1MembershipReport: "v1 membership report",
+	TypeV2MembershipReport: "v2 membership report",
+	TypeV2LeaveGroup:       "v2 leave group",
+	TypeV3MembershipReport: "v3 membership report",
+}
+
+func (typ Type) String() string {
+	s, ok := typeNames[typ]
+	if !ok {
+		return "<nil>"
+	}
+	return s
+}
+
+// A Message represents an IGMP message: a *Query, a *Report, a *Leave
+// or a *V3Report.
+type Message interface {
+	// Type returns the type of the message.
+	Type() Type
+
+	// Marshal returns the binary encoding of the message, including
+	// its checksum.
+	Marshal() ([]byte, error)
+}
+
+// ParseMessage parses b as an IGMP message, without the IPv4 header
+// which carries it. The checksum of the message is verified.
+func ParseMessage(b []byte) (Message, error) {
+	if len(b) < 8 {
+		return nil, errMessageTooShort
+	}
+	if checksum(b) != 0 {
+		return nil, errInvalidChecksum
+	}
+	switch typ := Type(b[0]); typ {
+	case TypeMembershipQuery:
+		return parseQuery(b)
+	case TypeV1MembershipReport, TypeV2MembershipReport:
+		v := 2
+		if typ == TypeV1MembershipReport {
+			v = 1
+		}
+		return &Report{Version: v, Group: ipAt(b[4:8])}, nil
+	case TypeV2LeaveGroup:
+		return &Leave{Group: ipAt(b[4:8])}, nil
+	case TypeV3MembershipReport:
+		return parseV3Report(b)
+	default:
+		return nil, errUnknownType
+	}
+}
+
+// marshalHeader returns the binary encoding of a message of type typ,
+// code and group, followed by n more bytes for the caller to fill in
+// before calling setChecksum.
+func marshalHeader(typ Type, code byte, group net.IP, n int) ([]byte, error) {
+	b := make([]byte, 8+n)
+	b[0] = byte(typ)
+	b[1] = code
+	if err := putIP(b[4:8], group); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func setChecksum(b []byte) []byte {
+	s := checksum(b)
+	// Place checksum back in header; using ^= avoids the
+	// assumption the checksum bytes are zero.
+	b[2] ^= byte(s)
+	b[3] ^= byte(s >> 8)
+	return b
+}
+
+// putIP puts the IPv4 address ip in b. A nil ip is the unspecified
+// address.
+func putIP(b []byte, ip net.IP) error {
+	if ip == nil {
+		return nil
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errInvalidAddress
+	}
+	copy(b, ip4)
+	return nil
+}
+
+func ipAt(b []byte) net.IP {
+	return net.IPv4(b[0], b[1], b[2], b[3])
+}
+
+// The Max Resp Code and QQIC fields of IGMPv3 encode values of 128 or
+// more as a floating point number with a 3-bit exponent and a 4-bit
+// mantissa. See RFC 3376, Section 4.1.1.
+const maxFloatCode = 0x1f << (7 + 3)
+
+func encodeFloatCode(v int) byte {
+	if v < 128 {
+		if v < 0 {
+			v = 0
+		}
+		return byte(v)
+	}
+	if v > maxFloatCode {
+		v = maxFloatCode
+	}
+	exp := 0
+	for v>>(exp+3) > 0x1f {
+		exp++
+	}
+	return 0x80 | byte(exp)<<4 | byte(v>>(exp+3))&0x0f
+}
+
+func decodeFloatCode(c byte) int {
+	if c < 128 {
+		return int(c)
+	}
+	exp := uint(c>>4) & 0x07
+	mant := int(c & 0x0f)
+	return (mant | 0x10) << (exp + 3)
+}
+
+// tenths returns d in tenths of a second, rounded down.
+func tenths(d time.Duration) int {
+	return int(d / (time.Second / 10))
+}
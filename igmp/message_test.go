@@ -0,0 +1,115 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package igmp
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalAndParseMessage(t *testing.T) {
+	group := net.IPv4(239, 1, 2, 3)
+	for i, m := range []Message{
+		&Query{Version: 1, Group: net.IPv4zero},
+		&Query{Version: 2, MaxRespTime: 10 * time.Second, Group: net.IPv4zero},
+		&Query{Version: 2, MaxRespTime: time.Second, Group: group},
+		&Query{
+			Version:                  3,
+			MaxRespTime:              10 * time.Second,
+			Group:                    group,
+			SuppressRouterProcessing: true,
+			Robustness:               2,
+			QueryInterval:            125 * time.Second,
+			Sources:                  []net.IP{net.IPv4(192, 0, 2, 1), net.IPv4(192, 0, 2, 2)},
+		},
+		&Report{Version: 1, Group: group},
+		&Report{Version: 2, Group: group},
+		&Leave{Group: group},
+		&V3Report{Records: []GroupRecord{
+			{Type: ModeIsExclude, Group: group},
+			{Type: AllowNewSources, Group: net.IPv4(239, 4, 5, 6), Sources: []net.IP{net.IPv4(192, 0, 2, 1)}, AuxData: []byte{1, 2, 3, 4}},
+		}},
+	} {
+		b, err := m.Marshal()
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if Type(b[0]) != m.Type() {
+			t.Errorf("#%d: got type %v; want %v", i, Type(b[0]), m.Type())
+		}
+		got, err := ParseMessage(b)
+		if err != nil {
+			t.Errorf("#%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("#%d: got %#v; want %#v", i, got, m)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	// IGMPv3 general query with a Max Resp Code of 100 and a QQIC of 125.
+	b := []byte{0x11, 0x64, 0xec, 0x1e, 0, 0, 0, 0, 0x02, 0x7d, 0, 0}
+	m, err := ParseMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Query{Version: 3, MaxRespTime: 10 * time.Second, Group: net.IPv4zero, Robustness: 2, QueryInterval: 125 * time.Second}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %#v; want %#v", m, want)
+	}
+	if out, err := want.Marshal(); err != nil || !bytes.Equal(out, b) {
+		t.Errorf("Marshal = %x, %v; want %x", out, err, b)
+	}
+
+	b[9] = 0x7e
+	if _, err := ParseMessage(b); err != errInvalidChecksum {
+		t.Errorf("corrupted message: got %v; want %v", err, errInvalidChecksum)
+	}
+	if _, err := ParseMessage(b[:7]); err != errMessageTooShort {
+		t.Errorf("short message: got %v; want %v", err, errMessageTooShort)
+	}
+}
+
+func TestFloatCode(t *testing.T) {
+	for _, tt := range []struct {
+		v    int
+		code byte
+	}{
+		{0, 0},
+		{127, 127},
+		{128, 0x80},
+		{136, 0x81},
+		{248, 0x8f},
+		{256, 0x90},
+		{31744, 0xff},
+		{40000, 0xff},
+	} {
+		if code := encodeFloatCode(tt.v); code != tt.code {
+			t.Errorf("encodeFloatCode(%d) = %#x; want %#x", tt.v, code, tt.code)
+		}
+		if tt.v <= maxFloatCode {
+			if v := decodeFloatCode(tt.code); v != tt.v {
+				t.Errorf("decodeFloatCode(%#x) = %d; want %d", tt.code, v, tt.v)
+			}
+		}
+	}
+}
+
+func TestNewHeader(t *testing.T) {
+	h := newHeader(Destination(&Leave{Group: net.IPv4(239, 1, 2, 3)}), 8)
+	b, err := h.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 24 || h.TTL != 1 || !h.Dst.Equal(allRouters) || !bytes.Equal(b[20:], routerAlert) {
+		t.Errorf("got header %v (%x); want one with TTL 1 and Router Alert to %v", h, b, allRouters)
+	}
+}
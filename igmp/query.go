@@ -0,0 +1,103 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package igmp
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// A Query represents a membership query message, as sent by multicast
+// routers. Its Group is unspecified in a general query, and set in a
+// group-specific or, with Sources, a group-and-source-specific query.
+type Query struct {
+	// Version is the version of the query: 1 for an IGMPv1 query,
+	// which has no MaxRespTime, 2 for an IGMPv2 one, or 3 for an
+	// IGMPv3 one, which may use the fields following Group. Zero is
+	// taken as 2.
+	Version int
+
+	MaxRespTime time.Duration // maximum response time, in tenths of a second
+	Group       net.IP        // group address, nil or unspecified for a general query
+
+	SuppressRouterProcessing bool          // S flag
+	Robustness               int           // querier's robustness variable, QRV, from 0 to 7
+	QueryInterval            time.Duration // querier's query interval, QQI, in seconds
+	Sources                  []net.IP      // source addresses
+}
+
+// Type implements the Type method of the Message interface.
+func (q *Query) Type() Type { return TypeMembershipQuery }
+
+// Marshal implements the Marshal method of the Message interface.
+func (q *Query) Marshal() ([]byte, error) {
+	if q.Version != 3 {
+		code := 0
+		if q.Version != 1 {
+			code = tenths(q.MaxRespTime)
+			if code > 0xff {
+				code = 0xff
+			}
+		}
+		b, err := marshalHeader(TypeMembershipQuery, byte(code), q.Group, 0)
+		if err != nil {
+			return nil, err
+		}
+		return setChecksum(b), nil
+	}
+	if len(q.Sources) > 0xffff {
+		return nil, errTooManySources
+	}
+	b, err := marshalHeader(TypeMembershipQuery, encodeFloatCode(tenths(q.MaxRespTime)), q.Group, 4+4*len(q.Sources))
+	if err != nil {
+		return nil, err
+	}
+	if q.SuppressRouterProcessing {
+		b[8] |= 0x08
+	}
+	b[8] |= byte(q.Robustness) & 0x07
+	b[9] = encodeFloatCode(int(q.QueryInterval / time.Second))
+	binary.BigEndian.PutUint16(b[10:12], uint16(len(q.Sources)))
+	for i, src := range q.Sources {
+		if src == nil {
+			return nil, errInvalidAddress
+		}
+		if err := putIP(b[12+4*i:], src); err != nil {
+			return nil, err
+		}
+	}
+	return setChecksum(b), nil
+}
+
+// parseQuery parses b as a membership query. A query of 8 bytes is an
+// IGMPv1 or IGMPv2 one, and a longer one an IGMPv3 one.
+func parseQuery(b []byte) (*Query, error) {
+	q := &Query{Group: ipAt(b[4:8])}
+	if len(b) == 8 {
+		q.Version = 2
+		q.MaxRespTime = time.Duration(b[1]) * time.Second / 10
+		if b[1] == 0 {
+			q.Version = 1
+		}
+		return q, nil
+	}
+	if len(b) < 12 {
+		return nil, errMessageTooShort
+	}
+	q.Version = 3
+	q.MaxRespTime = time.Duration(decodeFloatCode(b[1])) * time.Second / 10
+	q.SuppressRouterProcessing = b[8]&0x08 != 0
+	q.Robustness = int(b[8] & 0x07)
+	q.QueryInterval = time.Duration(decodeFloatCode(b[9])) * time.Second
+	n := int(binary.BigEndian.Uint16(b[10:12]))
+	if len(b) < 12+4*n {
+		return nil, errMessageTooShort
+	}
+	for i := 0; i < n; i++ {
+		q.Sources = append(q.Sources, ipAt(b[12+4*i:]))
+	}
+	return q, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package igmp
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// A Report represents an IGMPv1 or IGMPv2 membership report message,
+// sent by a host for a group it is a member of.
+type Report struct {
+	Version int    // 1 or 2
+	Group   net.IP // group address
+}
+
+// Type implements the Type method of the Message interface.
+func (r *Report) Type() Type {
+	if r.Version == 1 {
+		return TypeV1MembershipReport
+	}
+	return TypeV2MembershipReport
+}
+
+// Marshal implements the Marshal method of the Message interface.
+func (r *Report) Marshal() ([]byte, error) {
+	b, err := marshalHeader(r.Type(), 0, r.Group, 0)
+	if err != nil {
+		return nil, err
+	}
+	return setChecksum(b), nil
+}
+
+// A Leave represents an IGMPv2 leave group message, sent by a host
+// leaving a group.
+type Leave struct {
+	Group net.IP // group address
+}
+
+// Type implements the Type method of the Message interface.
+func (l *Leave) Type() Type { return TypeV2LeaveGroup }
+
+// Marshal implements the Marshal method of the Message interface.
+func (l *Leave) Marshal() ([]byte, error) {
+	b, err := marshalHeader(TypeV2LeaveGroup, 0, l.Group, 0)
+	if err != nil {
+		return nil, err
+	}
+	return setChecksum(b), nil
+}
+
+// A RecordType represents the type of a group record of an IGMPv3
+// membership report.
+type RecordType int
+
+const (
+	ModeIsInclude       RecordType = 1 // current-state record, include mode
+	ModeIsExclude       RecordType = 2 // current-state record, exclude mode
+	ChangeToIncludeMode RecordType = 3 // filter-mode-change record, to include mode
+	ChangeToExcludeMode RecordType = 4 // filter-mode-change record, to exclude mode
+	AllowNewSources     RecordType = 5 // source-list-change record, allowing sources
+	BlockOldSources     RecordType = 6 // source-list-change record, blocking sources
+)
+
+// A GroupRecord represents a group record of an IGMPv3 membership
+// report: the sources of a group whose traffic a host receives, or not,
+// or a change to them.
+type GroupRecord struct {
+	Type    RecordType // record type
+	Group   net.IP     // multicast address
+	Sources []net.IP   // source addresses
+	AuxData []byte     // auxiliary data, whose length is a multiple of 4
+}
+
+// A V3Report represents an IGMPv3 membership report message.
+type V3Report struct {
+	Records []GroupRecord // group records
+}
+
+// Type implements the Type method of the Message interface.
+func (r *V3Report) Type() Type { return TypeV3MembershipReport }
+
+// Marshal implements the Marshal method of the Message interface.
+func (r *V3Report) Marshal() ([]byte, error) {
+	if len(r.Records) > 0xffff {
+		return nil, errTooManyRecords
+	}
+	n := 0
+	for _, rec := range r.Records {
+		if len(rec.Sources) > 0xffff {
+			return nil, errTooManySources
+		}
+		if len(rec.AuxData)%4 != 0 || len(rec.AuxData) > 0xff*4 {
+			return nil, errInvalidAuxData
+		}
+		n += 8 + 4*len(rec.Sources) + len(rec.AuxData)
+	}
+	b, err := marshalHeader(TypeV3MembershipReport, 0, nil, n)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(r.Records)))
+	off := 8
+	for _, rec := range r.Records {
+		b[off] = byte(rec.Type)
+		b[off+1] = byte(len(rec.AuxData) / 4)
+		binary.BigEndian.PutUint16(b[off+2:off+4], uint16(len(rec.Sources)))
+		if rec.Group == nil {
+			return nil, errInvalidAddress
+		}
+		if err := putIP(b[off+4:off+8], rec.Group); err != nil {
+			return nil, err
+		}
+		off += 8
+		for _, src := range rec.Sources {
+			if src == nil {
+				return nil, errInvalidAddress
+			}
+			if err := putIP(b[off:off+4], src); err != nil {
+				return nil, err
+			}
+			off += 4
+		}
+		off += copy(b[off:], rec.AuxData)
+	}
+	return setChecksum(b), nil
+}
+
+// parseV3Report parses b as an IGMPv3 membership report.
+func parseV3Report(b []byte) (*V3Report, error) {
+	r := &V3Report{}
+	n := int(binary.BigEndian.Uint16(b[6:8]))
+	off := 8
+	for i := 0; i < n; i++ {
+		if len(b[off:]) < 8 {
+			return nil, errMessageTooShort
+		}
+		rec := GroupRecord{
+			Type:  RecordType(b[off]),
+			Group: ipAt(b[off+4 : off+8]),
+		}
+		auxLen := 4 * int(b[off+1])
+		nsrcs := int(binary.BigEndian.Uint16(b[off+2 : off+4]))
+		off += 8
+		if len(b[off:]) < 4*nsrcs+auxLen {
+			return nil, errMessageTooShort
+		}
+		for j := 0; j < nsrcs; j++ {
+			rec.Sources = append(rec.Sources, ipAt(b[off:off+4]))
+			off += 4
+		}
+		if auxLen > 0 {
+			rec.AuxData = make([]byte, auxLen)
+			off += copy(rec.AuxData, b[off:off+auxLen])
+		}
+		r.Records = append(r.Records, rec)
+	}
+	return r, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package socks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errListenerClosed = errors.New("socks bind listener closed")
+
+// Bind requests the proxy server to accept a connection from the
+// provided address on the provided network, as protocols such as FTP
+// require for the connections their servers initiate.
+//
+// The returned Listener is a *Listener, whose Addr is the address on
+// which the proxy server listens, to be sent to the peer at address,
+// and whose Accept returns the connection from the peer, once. See the
+// BIND command of RFC 1928, section 4.
+//
+// The returned error value may be a net.OpError, as that of
+// DialContext.
+func (d *Dialer) Bind(ctx context.Context, network, address string) (net.Listener, error) {
+	bd := *d
+	bd.cmd = CmdBind
+	c, err := bd.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	sc := c.(*Conn)
+	return &Listener{conn: sc.Conn, addr: sc.boundAddr, cmd: bd.cmd, network: network}, nil
+}
+
+// A Listener represents a pending BIND command, waiting for the
+// connection of a peer to the proxy server.
+type Listener struct {
+	conn    net.Conn // to the proxy server
+	addr    net.Addr // on which the proxy server listens
+	cmd     Command
+	network string
+
+	mu        sync.Mutex
+	accepting bool // Accept was called
+	accepted  bool // Accept returned the connection
+	closed    bool
+}
+
+// Accept waits for the peer to connect to the proxy server and returns
+// the connection, a *Conn whose BoundAddr is the address of the peer.
+// It may only succeed once; the Listener is closed once the
+// connection is returned, and closing it then does not close the
+// connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.accepting || l.closed {
+		l.mu.Unlock()
+		return nil, &net.OpError{Op: l.cmd.String(), Net: l.network, Addr: l.addr, Err: errListenerClosed}
+	}
+	l.accepting = true
+	l.mu.Unlock()
+	a, err := readReply(l.conn)
+	l.mu.Lock()
+	if err == nil && l.closed {
+		err = errListenerClosed
+	}
+	l.accepted = err == nil
+	l.mu.Unlock()
+	if err != nil {
+		l.conn.Close()
+		return nil, &net.OpError{Op: l.cmd.String(), Net: l.network, Addr: l.addr, Err: err}
+	}
+	l.conn.SetReadDeadline(noDeadline)
+	return &Conn{Conn: l.conn, boundAddr: a}, nil
+}
+
+// SetDeadline sets the deadline of Accept.
+func (l *Listener) SetDeadline(t time.Time) error {
+	return l.conn.SetReadDeadline(t)
+}
+
+// Close closes the Listener. A blocked Accept call is unblocked and
+// returns an error.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	switch {
+	case l.accepted:
+		return nil
+	case l.accepting:
+		// Unblock Accept, which closes the connection.
+		return l.conn.SetReadDeadline(aLongTimeAgo)
+	}
+	return l.conn.Close()
+}
+
+// Addr returns the address on which the proxy server listens for the
+// connection of the peer.
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
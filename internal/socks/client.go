@@ -106,8 +106,15 @@ func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (_ net
 		return
 	}
 
-	if _, ctxErr = io.ReadFull(c, b[:4]); ctxErr != nil {
-		return
+	return readReply(c)
+}
+
+// readReply reads a command reply from r and returns its bound
+// address.
+func readReply(r io.Reader) (*Addr, error) {
+	b := make([]byte, 4, 6+255)
+	if _, err := io.ReadFull(r, b[:4]); err != nil {
+		return nil, err
 	}
 	if b[0] != Version5 {
 		return nil, errors.New("unexpected protocol version " + strconv.Itoa(int(b[0])))
@@ -128,7 +135,7 @@ func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (_ net
 		l += net.IPv6len
 		a.IP = make(net.IP, net.IPv6len)
 	case AddrTypeFQDN:
-		if _, err := io.ReadFull(c, b[:1]); err != nil {
+		if _, err := io.ReadFull(r, b[:1]); err != nil {
 			return nil, err
 		}
 		l += int(b[0])
@@ -140,8 +147,8 @@ func (d *Dialer) connect(ctx context.Context, c net.Conn, address string) (_ net
 	} else {
 		b = b[:l]
 	}
-	if _, ctxErr = io.ReadFull(c, b); ctxErr != nil {
-		return
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
 	}
 	if a.IP != nil {
 		copy(a.IP, b)
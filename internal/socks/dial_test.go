@@ -6,6 +6,7 @@ package socks_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"math/rand"
 	"net"
@@ -68,6 +69,69 @@ func TestDial(t *testing.T) {
 			t.Fatalf("got %+v; want socks.Addr", a)
 		}
 	})
+	t.Run("Bind", func(t *testing.T) {
+		ss, err := sockstest.NewServer(sockstest.NoAuthRequired, bindCmdFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ss.Close()
+		d := socks.NewDialer(ss.Addr().Network(), ss.Addr().String())
+		ln, err := d.Bind(context.Background(), "tcp", "127.0.0.1:21")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		peer, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peer.Close()
+		c, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if got, want := c.(*socks.Conn).BoundAddr().String(), peer.LocalAddr().String(); got != want {
+			t.Errorf("got bound address %s; want that of the peer, %s", got, want)
+		}
+		if _, err := ln.Accept(); err == nil {
+			t.Error("second Accept succeeded")
+		}
+		ln.Close()
+		if _, err := io.WriteString(peer, "hello"); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 5)
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(c, b); err != nil || string(b) != "hello" {
+			t.Fatalf("read %q, %v; want %q", b, err, "hello")
+		}
+	})
+	t.Run("BindClose", func(t *testing.T) {
+		ss, err := sockstest.NewServer(sockstest.NoAuthRequired, bindCmdFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ss.Close()
+		d := socks.NewDialer(ss.Addr().Network(), ss.Addr().String())
+		ln, err := d.Bind(context.Background(), "tcp", "127.0.0.1:21")
+		if err != nil {
+			t.Fatal(err)
+		}
+		acceptErr := make(chan error)
+		go func() {
+			c, err := ln.Accept()
+			if err == nil {
+				c.Close()
+			}
+			acceptErr <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		ln.Close()
+		if err := <-acceptErr; err == nil {
+			t.Fatal("Accept succeeded after Close")
+		}
+	})
 	t.Run("Cancel", func(t *testing.T) {
 		ss, err := sockstest.NewServer(sockstest.NoAuthRequired, blackholeCmdFunc)
 		if err != nil {
@@ -129,6 +193,47 @@ func TestDial(t *testing.T) {
 	})
 }
 
+// bindCmdFunc serves a BIND command, relaying the connection accepted
+// on a local listener.
+func bindCmdFunc(rw io.ReadWriter, b []byte) error {
+	req, err := sockstest.ParseCmdRequest(b)
+	if err != nil {
+		return err
+	}
+	if req.Cmd != socks.CmdBind {
+		return errors.New("unexpected command")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	la := ln.Addr().(*net.TCPAddr)
+	b, err = sockstest.MarshalCmdReply(socks.Version5, socks.StatusSucceeded, &socks.Addr{IP: la.IP, Port: la.Port})
+	if err != nil {
+		return err
+	}
+	if _, err := rw.Write(b); err != nil {
+		return err
+	}
+	peer, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer peer.Close()
+	ra := peer.RemoteAddr().(*net.TCPAddr)
+	b, err = sockstest.MarshalCmdReply(socks.Version5, socks.StatusSucceeded, &socks.Addr{IP: ra.IP, Port: ra.Port})
+	if err != nil {
+		return err
+	}
+	if _, err := rw.Write(b); err != nil {
+		return err
+	}
+	go io.Copy(peer, rw)
+	_, err = io.Copy(rw, peer)
+	return err
+}
+
 func blackholeCmdFunc(rw io.ReadWriter, b []byte) error {
 	if _, err := sockstest.ParseCmdRequest(b); err != nil {
 		return err
@@ -24,7 +24,7 @@ func (cmd Command) String() string {
 	switch cmd {
 	case CmdConnect:
 		return "socks connect"
-	case cmdBind:
+	case CmdBind:
 		return "socks bind"
 	default:
 		return "socks " + strconv.Itoa(int(cmd))
@@ -71,7 +71,7 @@ const (
 	AddrTypeIPv6 = 0x04
 
 	CmdConnect Command = 0x01 // establishes an active-open forward proxy connection
-	cmdBind    Command = 0x02 // establishes a passive-open forward proxy connection
+	CmdBind    Command = 0x02 // establishes a passive-open forward proxy connection
 
 	AuthMethodNotRequired         AuthMethod = 0x00 // no authentication required
 	AuthMethodUsernamePassword    AuthMethod = 0x02 // use username/password
@@ -119,7 +119,7 @@ func (c *Conn) BoundAddr() net.Addr {
 
 // A Dialer holds SOCKS-specific options.
 type Dialer struct {
-	cmd          Command // either CmdConnect or cmdBind
+	cmd          Command // either CmdConnect or CmdBind
 	proxyNetwork string  // network between a proxy server and a client
 	proxyAddress string  // proxy server address
 
@@ -237,7 +237,7 @@ func (d *Dialer) validateTarget(network, address string) error {
 		return errors.New("network not implemented")
 	}
 	switch d.cmd {
-	case CmdConnect, cmdBind:
+	case CmdConnect, CmdBind:
 	default:
 		return errors.New("command not implemented")
 	}
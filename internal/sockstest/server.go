@@ -61,7 +61,7 @@ func ParseCmdRequest(b []byte) (*CmdRequest, error) {
 	if b[0] != socks.Version5 {
 		return nil, errors.New("unexpected protocol version")
 	}
-	if socks.Command(b[1]) != socks.CmdConnect {
+	if cmd := socks.Command(b[1]); cmd != socks.CmdConnect && cmd != socks.CmdBind {
 		return nil, errors.New("unexpected command")
 	}
 	if b[2] != 0 {
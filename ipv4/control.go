@@ -25,10 +25,11 @@ func (c *rawOpt) isset(f ControlFlags) bool { return c.cflags&f != 0 }
 type ControlFlags uint
 
 const (
-	FlagTTL       ControlFlags = 1 << iota // pass the TTL on the received packet
-	FlagSrc                                // pass the source address on the received packet
-	FlagDst                                // pass the destination address on the received packet
-	FlagInterface                          // pass the interface index on the received packet
+	FlagTTL         ControlFlags = 1 << iota // pass the TTL on the received packet
+	FlagSrc                                  // pass the source address on the received packet
+	FlagDst                                  // pass the destination address on the received packet
+	FlagInterface                            // pass the interface index on the received packet
+	FlagSegmentSize                          // pass the UDP segment size of the received packet, enabling generic receive offload
 )
 
 // A ControlMessage represents per packet basis IP-level socket options.
@@ -41,17 +42,35 @@ type ControlMessage struct {
 	// method of PacketConn or RawConn allows to send the options
 	// to the protocol stack.
 	//
+	// The outbound interface of a packet, IfIndex, and its source
+	// address, Src, can only be specified on Darwin, Linux, Solaris
+	// and z/OS, and are ignored elsewhere; the interface of all the
+	// packets of an endpoint is specified on Darwin, Linux and
+	// Windows by SetUnicastInterface, or SetMulticastInterface for
+	// multicast packets.
+	//
 	TTL     int    // time-to-live, receiving only
 	Src     net.IP // source address, specifying only
 	Dst     net.IP // destination address, receiving only
 	IfIndex int    // interface index, must be 1 <= value when specifying
+
+	// SegmentSize is the size of the UDP segments of the packet, for
+	// the generic segmentation and receive offloads of the protocol
+	// stack. When specifying, the payload is sent as a train of
+	// datagrams of SegmentSize bytes, except for the last one, which
+	// may be shorter. When receiving, the payload is the concatenation
+	// of datagrams coalesced by the protocol stack, of SegmentSize
+	// bytes except for the last one, and SegmentSize is zero if the
+	// payload is a single datagram. Currently only Linux supports
+	// this.
+	SegmentSize int
 }
 
 func (cm *ControlMessage) String() string {
 	if cm == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("ttl=%d src=%v dst=%v ifindex=%d", cm.TTL, cm.Src, cm.Dst, cm.IfIndex)
+	return fmt.Sprintf("ttl=%d src=%v dst=%v ifindex=%d segsize=%d", cm.TTL, cm.Src, cm.Dst, cm.IfIndex, cm.SegmentSize)
 }
 
 // Marshal returns the binary encoding of cm.
@@ -59,12 +78,27 @@ func (cm *ControlMessage) Marshal() []byte {
 	if cm == nil {
 		return nil
 	}
-	var m socket.ControlMessage
+	var ls []int
+	pktinfo := false
 	if ctlOpts[ctlPacketInfo].name > 0 && (cm.Src.To4() != nil || cm.IfIndex > 0) {
-		m = socket.NewControlMessage([]int{ctlOpts[ctlPacketInfo].length})
+		pktinfo = true
+		ls = append(ls, ctlOpts[ctlPacketInfo].length)
 	}
-	if len(m) > 0 {
-		ctlOpts[ctlPacketInfo].marshal(m, cm)
+	segsize := false
+	if ctlOpts[ctlUDPSegment].name > 0 && cm.SegmentSize > 0 {
+		segsize = true
+		ls = append(ls, ctlOpts[ctlUDPSegment].length)
+	}
+	var m socket.ControlMessage
+	if len(ls) > 0 {
+		m = socket.NewControlMessage(ls)
+		mm := []byte(m)
+		if pktinfo {
+			mm = ctlOpts[ctlPacketInfo].marshal(mm, cm)
+		}
+		if segsize {
+			mm = ctlOpts[ctlUDPSegment].marshal(mm, cm)
+		}
 	}
 	return m
 }
@@ -80,6 +114,12 @@ func (cm *ControlMessage) Parse(b []byte) error {
 		if err != nil {
 			return err
 		}
+		if lvl == iana.ProtocolUDP {
+			if ctlOpts[ctlUDPGRO].name > 0 && typ == ctlOpts[ctlUDPGRO].name && l >= ctlOpts[ctlUDPGRO].length {
+				ctlOpts[ctlUDPGRO].parse(cm, m.Data(l))
+			}
+			continue
+		}
 		if lvl != iana.ProtocolIP {
 			continue
 		}
@@ -118,6 +158,9 @@ func NewControlMessage(cf ControlFlags) []byte {
 			l += socket.ControlMessageSpace(ctlOpts[ctlInterface].length)
 		}
 	}
+	if opt.isset(FlagSegmentSize) && ctlOpts[ctlUDPGRO].name > 0 {
+		l += socket.ControlMessageSpace(ctlOpts[ctlUDPGRO].length)
+	}
 	var b []byte
 	if l > 0 {
 		b = make([]byte, l)
@@ -132,6 +175,8 @@ const (
 	ctlDst               // header field
 	ctlInterface         // inbound or outbound interface
 	ctlPacketInfo        // inbound or outbound packet path
+	ctlUDPSegment        // outbound udp segment size
+	ctlUDPGRO            // inbound udp segment size
 	ctlMax
 )
 
@@ -0,0 +1,27 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv4
+
+import (
+	"unsafe"
+
+	"golang.org/x/net/internal/iana"
+	"golang.org/x/net/internal/socket"
+
+	"golang.org/x/sys/unix"
+)
+
+func marshalUDPSegment(b []byte, cm *ControlMessage) []byte {
+	m := socket.ControlMessage(b)
+	m.MarshalHeader(iana.ProtocolUDP, unix.UDP_SEGMENT, 2)
+	if cm != nil {
+		*(*uint16)(unsafe.Pointer(&m.Data(2)[:2][0])) = uint16(cm.SegmentSize)
+	}
+	return m.Next(2)
+}
+
+func parseUDPGRO(cm *ControlMessage, b []byte) {
+	cm.SegmentSize = int(*(*int32)(unsafe.Pointer(&b[:4][0])))
+}
@@ -62,6 +62,16 @@ func setControlMessage(c *socket.Conn, opt *rawOpt, cf ControlFlags, on bool) er
 			}
 		}
 	}
+	if so, ok := sockOpts[ssoUDPGRO]; ok && cf&FlagSegmentSize != 0 {
+		if err := so.SetInt(c, boolint(on)); err != nil {
+			return err
+		}
+		if on {
+			opt.set(FlagSegmentSize)
+		} else {
+			opt.clear(FlagSegmentSize)
+		}
+	}
 	return nil
 }
 
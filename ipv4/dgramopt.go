@@ -92,6 +92,39 @@ func (c *dgramOpt) SetMulticastLoopback(on bool) error {
 	return so.SetInt(c.Conn, boolint(on))
 }
 
+// MulticastAll reports whether the multicast datagrams of the groups
+// joined by the other sockets of the host are also delivered to the
+// endpoint. Currently only Linux supports this.
+func (c *dgramOpt) MulticastAll() (bool, error) {
+	if !c.ok() {
+		return false, errInvalidConn
+	}
+	so, ok := sockOpts[ssoMulticastAll]
+	if !ok {
+		return false, errNotImplemented
+	}
+	on, err := so.GetInt(c.Conn)
+	if err != nil {
+		return false, err
+	}
+	return on == 1, nil
+}
+
+// SetMulticastAll sets whether the multicast datagrams of the groups
+// joined by the other sockets of the host are also delivered to the
+// endpoint, as they are by default on Linux, rather than only those of
+// the groups it joined. Currently only Linux supports this.
+func (c *dgramOpt) SetMulticastAll(on bool) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoMulticastAll]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.SetInt(c.Conn, boolint(on))
+}
+
 // JoinGroup joins the group address group on the interface ifi.
 // By default all sources that can cast data to group are accepted.
 // It's possible to mute and unmute data transmission from a specific
@@ -262,3 +295,33 @@ func (c *dgramOpt) SetBPF(filter []bpf.RawInstruction) error {
 	}
 	return so.setBPF(c.Conn, filter)
 }
+
+// UDPSegmentSize returns the UDP segment size for outgoing packets.
+// Currently only Linux supports this.
+func (c *dgramOpt) UDPSegmentSize() (int, error) {
+	if !c.ok() {
+		return 0, errInvalidConn
+	}
+	so, ok := sockOpts[ssoUDPSegment]
+	if !ok {
+		return 0, errNotImplemented
+	}
+	return so.GetInt(c.Conn)
+}
+
+// SetUDPSegmentSize sets the UDP segment size for future outgoing
+// packets. A non-zero size makes the protocol stack send the payload
+// of each write as a train of datagrams of size bytes, except for the
+// last one, which may be shorter. ControlMessage.SegmentSize overrides
+// it per packet.
+// Currently only Linux supports this.
+func (c *dgramOpt) SetUDPSegmentSize(size int) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoUDPSegment]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.SetInt(c.Conn, size)
+}
@@ -98,6 +98,8 @@ type testIPv4MulticastConn interface {
 	SetMulticastTTL(ttl int) error
 	MulticastLoopback() (bool, error)
 	SetMulticastLoopback(bool) error
+	MulticastAll() (bool, error)
+	SetMulticastAll(bool) error
 	JoinGroup(*net.Interface, net.Addr) error
 	LeaveGroup(*net.Interface, net.Addr) error
 	JoinSourceSpecificGroup(*net.Interface, net.Addr, net.Addr) error
@@ -136,6 +138,22 @@ func testMulticastSocketOptions(t *testing.T, c testIPv4MulticastConn, ifi *net.
 		}
 	}
 
+	if runtime.GOOS == "linux" {
+		for _, toggle := range []bool{false, true} {
+			if err := c.SetMulticastAll(toggle); err != nil {
+				t.Error(err)
+				return
+			}
+			if v, err := c.MulticastAll(); err != nil {
+				t.Error(err)
+				return
+			} else if v != toggle {
+				t.Errorf("got multicast all %v; want %v", v, toggle)
+				return
+			}
+		}
+	}
+
 	if err := c.JoinGroup(ifi, grp); err != nil {
 		t.Error(err)
 		return
@@ -561,3 +561,53 @@ func testPacketConnConcurrentReadWriteUnicast(t *testing.T, p *ipv4.PacketConn,
 	}
 	wg.Wait()
 }
+
+func TestPacketConnUDPSegmentOffload(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("not supported on %s/%s: %v", runtime.GOOS, runtime.GOARCH, err)
+	}
+	defer c.Close()
+	p := ipv4.NewPacketConn(c)
+	if err := p.SetControlMessage(ipv4.FlagSegmentSize, true); err != nil {
+		t.Skipf("generic receive offload not supported: %v", err)
+	}
+	if err := p.SetUDPSegmentSize(0); err != nil {
+		t.Skipf("generic segmentation offload not supported: %v", err)
+	}
+
+	const segSize = 1000
+	payload := bytes.Repeat([]byte("GSO"), segSize)
+	cm := ipv4.ControlMessage{SegmentSize: segSize}
+	wms := []ipv4.Message{{Buffers: [][]byte{payload}, OOB: cm.Marshal(), Addr: c.LocalAddr()}}
+	if _, err := p.WriteBatch(wms, 0); err != nil {
+		t.Skipf("generic segmentation offload not supported: %v", err)
+	}
+
+	// The datagrams are received either coalesced by the generic
+	// receive offload, or one by one.
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	var got []byte
+	for len(got) < len(payload) {
+		b := make([]byte, len(payload))
+		rms := []ipv4.Message{{Buffers: [][]byte{b}, OOB: ipv4.NewControlMessage(ipv4.FlagSegmentSize)}}
+		if _, err := p.ReadBatch(rms, 0); err != nil {
+			t.Fatal(err)
+		}
+		var rcm ipv4.ControlMessage
+		if err := rcm.Parse(rms[0].OOB[:rms[0].NN]); err != nil {
+			t.Fatal(err)
+		}
+		n := rms[0].N
+		if rcm.SegmentSize != 0 && rcm.SegmentSize != segSize || rcm.SegmentSize == 0 && n != segSize {
+			t.Fatalf("read %d bytes with %v; want datagrams of %d bytes", n, &rcm, segSize)
+		}
+		got = append(got, b[:n]...)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("got %d bytes differing from the %d bytes sent", len(got), len(payload))
+	}
+}
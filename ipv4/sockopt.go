@@ -27,6 +27,12 @@ const (
 	ssoBlockSourceGroup          // any-source or source-specific multicast
 	ssoUnblockSourceGroup        // any-source or source-specific multicast
 	ssoAttachFilter              // attach BPF for filtering inbound traffic
+	ssoUDPSegment                // udp segment size for outbound packet
+	ssoUDPGRO                    // udp generic receive offload
+	ssoUnicastInterface          // outbound interface for unicast packet
+	ssoBindToDevice              // inbound and outbound device
+	ssoMark                      // routing mark of outbound packet
+	ssoMulticastAll              // delivery of the multicast groups joined by other sockets
 )
 
 // Sticky socket option value types
@@ -35,6 +41,7 @@ const (
 	ssoTypeIPMreqn
 	ssoTypeGroupReq
 	ssoTypeGroupSourceReq
+	ssoTypeIndexBigEndian
 )
 
 // A sockOpt represents a binding for sticky socket option.
@@ -41,3 +41,11 @@ func (so *sockOpt) setSourceGroup(c *socket.Conn, ifi *net.Interface, grp, src n
 func (so *sockOpt) setBPF(c *socket.Conn, f []bpf.RawInstruction) error {
 	return errNotImplemented
 }
+
+func (so *sockOpt) setUnicastInterface(c *socket.Conn, ifi *net.Interface) error {
+	return errNotImplemented
+}
+
+func (so *sockOpt) setDevice(c *socket.Conn, name string) error {
+	return errNotImplemented
+}
@@ -19,6 +19,8 @@ var (
 	ctlOpts = [ctlMax]ctlOpt{
 		ctlTTL:        {unix.IP_TTL, 1, marshalTTL, parseTTL},
 		ctlPacketInfo: {unix.IP_PKTINFO, sizeofInetPktinfo, marshalPacketInfo, parsePacketInfo},
+		ctlUDPSegment: {unix.UDP_SEGMENT, 2, marshalUDPSegment, nil},
+		ctlUDPGRO:     {unix.UDP_GRO, 4, nil, parseUDPGRO},
 	}
 
 	sockOpts = map[int]*sockOpt{
@@ -38,6 +40,12 @@ var (
 		ssoBlockSourceGroup:   {Option: socket.Option{Level: iana.ProtocolIP, Name: unix.MCAST_BLOCK_SOURCE, Len: sizeofGroupSourceReq}, typ: ssoTypeGroupSourceReq},
 		ssoUnblockSourceGroup: {Option: socket.Option{Level: iana.ProtocolIP, Name: unix.MCAST_UNBLOCK_SOURCE, Len: sizeofGroupSourceReq}, typ: ssoTypeGroupSourceReq},
 		ssoAttachFilter:       {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_ATTACH_FILTER, Len: unix.SizeofSockFprog}},
+		ssoUDPSegment:         {Option: socket.Option{Level: iana.ProtocolUDP, Name: unix.UDP_SEGMENT, Len: 4}},
+		ssoUDPGRO:             {Option: socket.Option{Level: iana.ProtocolUDP, Name: unix.UDP_GRO, Len: 4}},
+		ssoUnicastInterface:   {Option: socket.Option{Level: iana.ProtocolIP, Name: unix.IP_UNICAST_IF, Len: 4}, typ: ssoTypeIndexBigEndian},
+		ssoBindToDevice:       {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_BINDTODEVICE, Len: unix.IFNAMSIZ}},
+		ssoMark:               {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_MARK, Len: 4}},
+		ssoMulticastAll:       {Option: socket.Option{Level: iana.ProtocolIP, Name: unix.IP_MULTICAST_ALL, Len: 4}},
 	}
 )
 
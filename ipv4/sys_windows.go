@@ -12,6 +12,8 @@ import (
 )
 
 const (
+	sysIP_UNICAST_IF = 0x1f // missing from golang.org/x/sys/windows
+
 	sizeofIPMreq       = 0x8
 	sizeofIPMreqSource = 0xc
 )
@@ -40,5 +42,6 @@ var (
 		ssoHeaderPrepend:      {Option: socket.Option{Level: iana.ProtocolIP, Name: windows.IP_HDRINCL, Len: 4}},
 		ssoJoinGroup:          {Option: socket.Option{Level: iana.ProtocolIP, Name: windows.IP_ADD_MEMBERSHIP, Len: sizeofIPMreq}, typ: ssoTypeIPMreq},
 		ssoLeaveGroup:         {Option: socket.Option{Level: iana.ProtocolIP, Name: windows.IP_DROP_MEMBERSHIP, Len: sizeofIPMreq}, typ: ssoTypeIPMreq},
+		ssoUnicastInterface:   {Option: socket.Option{Level: iana.ProtocolIP, Name: sysIP_UNICAST_IF, Len: 4}, typ: ssoTypeIndexBigEndian},
 	}
 )
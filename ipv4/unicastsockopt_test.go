@@ -141,3 +141,52 @@ func testUnicastSocketOptions(t *testing.T, c testIPv4UnicastConn) {
 		t.Fatalf("got %v; want %v", v, ttl)
 	}
 }
+
+func TestPacketConnInterfaceBinding(t *testing.T) {
+	switch runtime.GOOS {
+	case "darwin", "ios", "linux", "windows":
+	default:
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	ifi, err := nettest.RoutedInterface("ip4", net.FlagUp|net.FlagLoopback)
+	if err != nil {
+		t.Skipf("not available on %s", runtime.GOOS)
+	}
+	c, err := nettest.NewLocalPacketListener("udp4")
+	if err != nil {
+		t.Skipf("not supported on %s/%s: %v", runtime.GOOS, runtime.GOARCH, err)
+	}
+	defer c.Close()
+	p := ipv4.NewPacketConn(c)
+
+	if err := p.SetUnicastInterface(ifi); err != nil {
+		t.Fatal(err)
+	}
+	wb := []byte("HELLO-R-U-THERE")
+	if _, err := p.WriteTo(wb, nil, c.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	rb := make([]byte, 128)
+	if n, _, _, err := p.ReadFrom(rb); err != nil {
+		t.Fatal(err)
+	} else if string(rb[:n]) != string(wb) {
+		t.Fatalf("got %q; want %q", rb[:n], wb)
+	}
+	if err := p.SetUnicastInterface(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if err := p.SetBindToDevice(ifi.Name); err != nil {
+		t.Logf("not permitted: %v", err)
+	} else if err := p.SetBindToDevice(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMark(42); err != nil {
+		t.Logf("not permitted: %v", err)
+	} else if mark, err := p.Mark(); err != nil || mark != 42 {
+		t.Fatalf("got mark %d, %v; want 42", mark, err)
+	}
+}
@@ -14,7 +14,8 @@ import (
 // BUG(mikio): On Windows, the ReadBatch and WriteBatch methods of
 // PacketConn are not implemented.
 
-// A Message represents an IO message.
+// A Message represents an IO message. It is the same type as
+// golang.org/x/net/socket.Message.
 //
 //	type Message struct {
 //		Buffers [][]byte
@@ -38,6 +38,9 @@ const (
 	FlagDst                                   // pass the destination address on the received packet
 	FlagInterface                             // pass the interface index on the received packet
 	FlagPathMTU                               // pass the path MTU on the received packet path
+	FlagSegmentSize                           // pass the UDP segment size of the received packet, enabling generic receive offload
+	FlagHopOptions                            // pass the hop-by-hop options of the received packet
+	FlagDstOptions                            // pass the destination options of the received packet
 )
 
 const flagPacketInfo = FlagDst | FlagInterface
@@ -53,6 +56,13 @@ type ControlMessage struct {
 	// method of PacketConn allows to send the options to the
 	// protocol stack.
 	//
+	// The outbound interface of a packet, IfIndex, and its source
+	// address, Src, can be specified on all the platforms but
+	// Windows, where they are ignored; the interface of all the
+	// packets of an endpoint is specified on Darwin, Linux and
+	// Windows by SetUnicastInterface, or SetMulticastInterface for
+	// multicast packets.
+	//
 	TrafficClass int    // traffic class, must be 1 <= value <= 255 when specifying
 	HopLimit     int    // hop limit, must be 1 <= value <= 255 when specifying
 	Src          net.IP // source address, specifying only
@@ -60,13 +70,33 @@ type ControlMessage struct {
 	IfIndex      int    // interface index, must be 1 <= value when specifying
 	NextHop      net.IP // next hop address, specifying only
 	MTU          int    // path MTU, receiving only
+
+	// SegmentSize is the size of the UDP segments of the packet, for
+	// the generic segmentation and receive offloads of the protocol
+	// stack. When specifying, the payload is sent as a train of
+	// datagrams of SegmentSize bytes, except for the last one, which
+	// may be shorter. When receiving, the payload is the concatenation
+	// of datagrams coalesced by the protocol stack, of SegmentSize
+	// bytes except for the last one, and SegmentSize is zero if the
+	// payload is a single datagram. Currently only Linux supports
+	// this.
+	SegmentSize int
+
+	// HopByHopOptions and DstOptions are the options of the
+	// Hop-by-Hop Options and Destination Options extension headers
+	// of the packet, such as the Router Alert option used by MLD and
+	// RSVP. When specifying, padding is added as needed, and the
+	// options are not sent if they do not fit in an extension header.
+	// When receiving, the padding options are dropped.
+	HopByHopOptions []Option
+	DstOptions      []Option
 }
 
 func (cm *ControlMessage) String() string {
 	if cm == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("tclass=%#x hoplim=%d src=%v dst=%v ifindex=%d nexthop=%v mtu=%d", cm.TrafficClass, cm.HopLimit, cm.Src, cm.Dst, cm.IfIndex, cm.NextHop, cm.MTU)
+	return fmt.Sprintf("tclass=%#x hoplim=%d src=%v dst=%v ifindex=%d nexthop=%v mtu=%d segsize=%d hopopts=%v dstopts=%v", cm.TrafficClass, cm.HopLimit, cm.Src, cm.Dst, cm.IfIndex, cm.NextHop, cm.MTU, cm.SegmentSize, cm.HopByHopOptions, cm.DstOptions)
 }
 
 // Marshal returns the binary encoding of cm.
@@ -95,6 +125,22 @@ func (cm *ControlMessage) Marshal() []byte {
 		nexthop = true
 		l += socket.ControlMessageSpace(ctlOpts[ctlNextHop].length)
 	}
+	segsize := false
+	if ctlOpts[ctlUDPSegment].name > 0 && cm.SegmentSize > 0 {
+		segsize = true
+		l += socket.ControlMessageSpace(ctlOpts[ctlUDPSegment].length)
+	}
+	var hopopts, dstopts []byte
+	if ctlOpts[ctlHopOpts].name > 0 {
+		if hopopts = marshalOptionsHeader(cm.HopByHopOptions); hopopts != nil {
+			l += socket.ControlMessageSpace(len(hopopts))
+		}
+	}
+	if ctlOpts[ctlDstOpts].name > 0 {
+		if dstopts = marshalOptionsHeader(cm.DstOptions); dstopts != nil {
+			l += socket.ControlMessageSpace(len(dstopts))
+		}
+	}
 	var b []byte
 	if l > 0 {
 		b = make([]byte, l)
@@ -111,6 +157,15 @@ func (cm *ControlMessage) Marshal() []byte {
 		if nexthop {
 			bb = ctlOpts[ctlNextHop].marshal(bb, cm)
 		}
+		if segsize {
+			bb = ctlOpts[ctlUDPSegment].marshal(bb, cm)
+		}
+		if hopopts != nil {
+			bb = marshalOptions(bb, ctlOpts[ctlHopOpts].name, hopopts)
+		}
+		if dstopts != nil {
+			bb = marshalOptions(bb, ctlOpts[ctlDstOpts].name, dstopts)
+		}
 	}
 	return b
 }
@@ -126,6 +181,12 @@ func (cm *ControlMessage) Parse(b []byte) error {
 		if err != nil {
 			return err
 		}
+		if lvl == iana.ProtocolUDP {
+			if ctlOpts[ctlUDPGRO].name > 0 && typ == ctlOpts[ctlUDPGRO].name && l >= ctlOpts[ctlUDPGRO].length {
+				ctlOpts[ctlUDPGRO].parse(cm, m.Data(l))
+			}
+			continue
+		}
 		if lvl != iana.ProtocolIPv6 {
 			continue
 		}
@@ -138,6 +199,10 @@ func (cm *ControlMessage) Parse(b []byte) error {
 			ctlOpts[ctlPacketInfo].parse(cm, m.Data(l))
 		case typ == ctlOpts[ctlPathMTU].name && l >= ctlOpts[ctlPathMTU].length:
 			ctlOpts[ctlPathMTU].parse(cm, m.Data(l))
+		case ctlOpts[ctlHopOpts].name > 0 && typ == ctlOpts[ctlHopOpts].name && l >= ctlOpts[ctlHopOpts].length:
+			cm.HopByHopOptions = parseOptionsHeader(m.Data(l))
+		case ctlOpts[ctlDstOpts].name > 0 && typ == ctlOpts[ctlDstOpts].name && l >= ctlOpts[ctlDstOpts].length:
+			cm.DstOptions = parseOptionsHeader(m.Data(l))
 		}
 	}
 	return nil
@@ -161,6 +226,15 @@ func NewControlMessage(cf ControlFlags) []byte {
 	if opt.isset(FlagPathMTU) && ctlOpts[ctlPathMTU].name > 0 {
 		l += socket.ControlMessageSpace(ctlOpts[ctlPathMTU].length)
 	}
+	if opt.isset(FlagSegmentSize) && ctlOpts[ctlUDPGRO].name > 0 {
+		l += socket.ControlMessageSpace(ctlOpts[ctlUDPGRO].length)
+	}
+	if opt.isset(FlagHopOptions) && ctlOpts[ctlHopOpts].name > 0 {
+		l += socket.ControlMessageSpace(maxOptionsHeaderLen)
+	}
+	if opt.isset(FlagDstOptions) && ctlOpts[ctlDstOpts].name > 0 {
+		l += socket.ControlMessageSpace(maxOptionsHeaderLen)
+	}
 	var b []byte
 	if l > 0 {
 		b = make([]byte, l)
@@ -175,13 +249,26 @@ const (
 	ctlPacketInfo          // inbound or outbound packet path
 	ctlNextHop             // nexthop
 	ctlPathMTU             // path mtu
+	ctlUDPSegment          // outbound udp segment size
+	ctlUDPGRO              // inbound udp segment size
+	ctlHopOpts             // hop-by-hop options extension header
+	ctlDstOpts             // destination options extension header
 	ctlMax
 )
 
 // A ctlOpt represents a binding for ancillary data socket option.
 type ctlOpt struct {
 	name    int // option name, must be equal or greater than 1
-	length  int // option length
+	length  int // option length, or minimum length if variable
 	marshal func([]byte, *ControlMessage) []byte
 	parse   func(*ControlMessage, []byte)
 }
+
+// marshalOptions marshals the extension header h as the ancillary data
+// of the option name, and returns the rest of b.
+func marshalOptions(b []byte, name int, h []byte) []byte {
+	m := socket.ControlMessage(b)
+	m.MarshalHeader(iana.ProtocolIPv6, name, len(h))
+	copy(m.Data(len(h)), h)
+	return m.Next(len(h))
+}
@@ -5,6 +5,8 @@
 package ipv6_test
 
 import (
+	"reflect"
+	"runtime"
 	"testing"
 
 	"golang.org/x/net/ipv6"
@@ -19,3 +21,24 @@ func TestControlMessageParseWithFuzz(t *testing.T) {
 		cm.Parse([]byte(fuzz))
 	}
 }
+
+func TestControlMessageOptions(t *testing.T) {
+	cm := ipv6.ControlMessage{
+		HopByHopOptions: []ipv6.Option{ipv6.RouterAlertOption(ipv6.RouterAlertMLD)},
+		DstOptions:      []ipv6.Option{{Type: 0x3e, Data: []byte{1, 2, 3}}},
+	}
+	b := cm.Marshal()
+	if b == nil {
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	var got ipv6.ControlMessage
+	if err := got.Parse(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.HopByHopOptions, cm.HopByHopOptions) || !reflect.DeepEqual(got.DstOptions, cm.DstOptions) {
+		t.Errorf("got %v; want %v", &got, &cm)
+	}
+	if v, ok := ipv6.RouterAlert(got.HopByHopOptions); !ok || v != ipv6.RouterAlertMLD {
+		t.Errorf("RouterAlert = %d, %v; want %d, true", v, ok, ipv6.RouterAlertMLD)
+	}
+}
@@ -52,5 +52,35 @@ func setControlMessage(c *socket.Conn, opt *rawOpt, cf ControlFlags, on bool) er
 			opt.clear(FlagPathMTU)
 		}
 	}
+	if so, ok := sockOpts[ssoUDPGRO]; ok && cf&FlagSegmentSize != 0 {
+		if err := so.SetInt(c, boolint(on)); err != nil {
+			return err
+		}
+		if on {
+			opt.set(FlagSegmentSize)
+		} else {
+			opt.clear(FlagSegmentSize)
+		}
+	}
+	if so, ok := sockOpts[ssoReceiveHopOpts]; ok && cf&FlagHopOptions != 0 {
+		if err := so.SetInt(c, boolint(on)); err != nil {
+			return err
+		}
+		if on {
+			opt.set(FlagHopOptions)
+		} else {
+			opt.clear(FlagHopOptions)
+		}
+	}
+	if so, ok := sockOpts[ssoReceiveDstOpts]; ok && cf&FlagDstOptions != 0 {
+		if err := so.SetInt(c, boolint(on)); err != nil {
+			return err
+		}
+		if on {
+			opt.set(FlagDstOptions)
+		} else {
+			opt.clear(FlagDstOptions)
+		}
+	}
 	return nil
 }
@@ -299,3 +299,33 @@ func (c *dgramOpt) SetBPF(filter []bpf.RawInstruction) error {
 	}
 	return so.setBPF(c.Conn, filter)
 }
+
+// UDPSegmentSize returns the UDP segment size for outgoing packets.
+// Currently only Linux supports this.
+func (c *dgramOpt) UDPSegmentSize() (int, error) {
+	if !c.ok() {
+		return 0, errInvalidConn
+	}
+	so, ok := sockOpts[ssoUDPSegment]
+	if !ok {
+		return 0, errNotImplemented
+	}
+	return so.GetInt(c.Conn)
+}
+
+// SetUDPSegmentSize sets the UDP segment size for future outgoing
+// packets. A non-zero size makes the protocol stack send the payload
+// of each write as a train of datagrams of size bytes, except for the
+// last one, which may be shorter. ControlMessage.SegmentSize overrides
+// it per packet.
+// Currently only Linux supports this.
+func (c *dgramOpt) SetUDPSegmentSize(size int) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoUDPSegment]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.SetInt(c.Conn, size)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv6
+
+// An Option represents an option of a Hop-by-Hop Options or
+// Destination Options extension header.
+// See RFC 8200, Section 4.2 for details.
+type Option struct {
+	Type int    // option type, including the action and change bits
+	Data []byte // option data, at most 255 bytes
+}
+
+// The option types used for padding, which are added and removed by
+// ControlMessage as needed.
+const (
+	optionTypePad1 = 0
+	optionTypePadN = 1
+)
+
+// OptionTypeRouterAlert is the type of the Router Alert hop-by-hop
+// option, defined in RFC 2711.
+const OptionTypeRouterAlert = 5
+
+// Values of the Router Alert option.
+const (
+	RouterAlertMLD            = 0 // Multicast Listener Discovery message
+	RouterAlertRSVP           = 1 // RSVP message
+	RouterAlertActiveNetworks = 2 // Active Networks message
+)
+
+// RouterAlertOption returns the Router Alert hop-by-hop option with
+// value, such as RouterAlertMLD.
+func RouterAlertOption(value int) Option {
+	return Option{Type: OptionTypeRouterAlert, Data: []byte{byte(value >> 8), byte(value)}}
+}
+
+// RouterAlert returns the value of the Router Alert option of opts, and
+// whether there is one.
+func RouterAlert(opts []Option) (value int, ok bool) {
+	for _, o := range opts {
+		if o.Type == OptionTypeRouterAlert && len(o.Data) == 2 {
+			return int(o.Data[0])<<8 | int(o.Data[1]), true
+		}
+	}
+	return 0, false
+}
+
+// maxOptionsHeaderLen is the maximum length of a Hop-by-Hop Options or
+// Destination Options extension header, whose length is encoded in
+// units of 8 bytes, not counting the first 8.
+const maxOptionsHeaderLen = 8 * (0xff + 1)
+
+// marshalOptionsHeader returns the encoding of an extension header
+// holding opts, padded to a multiple of 8 bytes, as passed to the
+// protocol stack in ancillary data. Its Next Header field is set by the
+// protocol stack. Padding options in opts are dropped. It returns nil
+// if opts holds no option, or an option whose data is too long, or if
+// the header would be too long.
+func marshalOptionsHeader(opts []Option) []byte {
+	n := 2
+	for _, o := range opts {
+		if o.Type == optionTypePad1 || o.Type == optionTypePadN {
+			continue
+		}
+		if len(o.Data) > 0xff {
+			return nil
+		}
+		n += 2 + len(o.Data)
+	}
+	if n == 2 {
+		return nil
+	}
+	l := (n + 7) &^ 7
+	if l > maxOptionsHeaderLen {
+		return nil
+	}
+	b := make([]byte, l)
+	b[1] = byte(l/8 - 1)
+	off := 2
+	for _, o := range opts {
+		if o.Type == optionTypePad1 || o.Type == optionTypePadN {
+			continue
+		}
+		b[off] = byte(o.Type)
+		b[off+1] = byte(len(o.Data))
+		off += 2 + copy(b[off+2:], o.Data)
+	}
+	switch pad := l - off; {
+	case pad == 1:
+		b[off] = optionTypePad1
+	case pad > 1:
+		b[off] = optionTypePadN
+		b[off+1] = byte(pad - 2)
+	}
+	return b
+}
+
+// parseOptionsHeader parses b as a Hop-by-Hop Options or Destination
+// Options extension header, and returns its options without the
+// padding ones. Parsing stops at the first malformed option.
+func parseOptionsHeader(b []byte) []Option {
+	if len(b) < 2 {
+		return nil
+	}
+	if l := 8 * (int(b[1]) + 1); l < len(b) {
+		b = b[:l]
+	}
+	var opts []Option
+	for off := 2; off < len(b); {
+		typ := int(b[off])
+		if typ == optionTypePad1 {
+			off++
+			continue
+		}
+		if off+2 > len(b) || off+2+int(b[off+1]) > len(b) {
+			break
+		}
+		l := int(b[off+1])
+		if typ != optionTypePadN {
+			data := make([]byte, l)
+			copy(data, b[off+2:])
+			opts = append(opts, Option{Type: typ, Data: data})
+		}
+		off += 2 + l
+	}
+	return opts
+}
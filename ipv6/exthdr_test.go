@@ -0,0 +1,57 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv6
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestOptionsHeader(t *testing.T) {
+	for _, tt := range []struct {
+		opts []Option
+		b    []byte
+	}{
+		{nil, nil},
+		{[]Option{{Type: optionTypePad1}}, nil},
+		{
+			[]Option{RouterAlertOption(RouterAlertMLD)},
+			[]byte{0, 0, 5, 2, 0, 0, 1, 0},
+		},
+		{
+			[]Option{RouterAlertOption(RouterAlertRSVP), {Type: 0x3e, Data: []byte{1}}},
+			[]byte{0, 1, 5, 2, 0, 1, 0x3e, 1, 1, 1, 5, 0, 0, 0, 0, 0},
+		},
+		{
+			[]Option{{Type: 0x3e, Data: []byte{1, 2, 3}}},
+			[]byte{0, 0, 0x3e, 3, 1, 2, 3, 0},
+		},
+		{[]Option{{Type: 0x3e, Data: make([]byte, 256)}}, nil},
+	} {
+		b := marshalOptionsHeader(tt.opts)
+		if !bytes.Equal(b, tt.b) {
+			t.Errorf("marshalOptionsHeader(%v) = %v; want %v", tt.opts, b, tt.b)
+			continue
+		}
+		if b == nil {
+			continue
+		}
+		if opts := parseOptionsHeader(b); !reflect.DeepEqual(opts, tt.opts) {
+			t.Errorf("parseOptionsHeader(%v) = %v; want %v", b, opts, tt.opts)
+		}
+	}
+
+	if v, ok := RouterAlert([]Option{{Type: 0x3e}, RouterAlertOption(RouterAlertActiveNetworks)}); !ok || v != RouterAlertActiveNetworks {
+		t.Errorf("RouterAlert = %d, %v; want %d, true", v, ok, RouterAlertActiveNetworks)
+	}
+	if _, ok := RouterAlert(nil); ok {
+		t.Error("RouterAlert(nil) found an option")
+	}
+	// A truncated option ends the parsing.
+	if opts := parseOptionsHeader([]byte{0, 0, 5, 2, 0, 0, 0x3e, 4}); len(opts) != 1 {
+		t.Errorf("parsed %v; want only the Router Alert option", opts)
+	}
+}
@@ -4,6 +4,8 @@
 
 package ipv6
 
+import "net"
+
 // TrafficClass returns the traffic class field value for outgoing
 // packets.
 func (c *genericOpt) TrafficClass() (int, error) {
@@ -54,3 +56,64 @@ func (c *genericOpt) SetHopLimit(hoplim int) error {
 	}
 	return so.SetInt(c.Conn, hoplim)
 }
+
+// SetUnicastInterface sets the outbound interface of the future
+// outgoing unicast packets to ifi, whichever the route to their
+// destination, for multi-homed hosts following the strong host model,
+// or lets the routing table select it if ifi is nil. Unlike the IfIndex
+// field of ControlMessage, it applies to all the packets, including
+// those of TCP connections, on all the platforms supporting it.
+// Currently only Darwin, Linux and Windows support this.
+func (c *genericOpt) SetUnicastInterface(ifi *net.Interface) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoUnicastInterface]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.setUnicastInterface(c.Conn, ifi)
+}
+
+// SetBindToDevice binds the endpoint to the network device name, such
+// as a VRF device, so that it only sends and receives the packets of
+// that device and routes them with its routing table, or unbinds it if
+// name is empty. It usually requires the CAP_NET_RAW capability.
+// Currently only Linux supports this.
+func (c *genericOpt) SetBindToDevice(name string) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoBindToDevice]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.setDevice(c.Conn, name)
+}
+
+// Mark returns the routing mark, or fwmark, of outgoing packets.
+func (c *genericOpt) Mark() (int, error) {
+	if !c.ok() {
+		return 0, errInvalidConn
+	}
+	so, ok := sockOpts[ssoMark]
+	if !ok {
+		return 0, errNotImplemented
+	}
+	return so.GetInt(c.Conn)
+}
+
+// SetMark sets the routing mark, or fwmark, of future outgoing
+// packets, which selects policy routing rules and firewall handling. It
+// requires the CAP_NET_ADMIN capability. Currently only Linux supports
+// this.
+func (c *genericOpt) SetMark(mark int) error {
+	if !c.ok() {
+		return errInvalidConn
+	}
+	so, ok := sockOpts[ssoMark]
+	if !ok {
+		return errNotImplemented
+	}
+	return so.SetInt(c.Conn, mark)
+}
@@ -11,11 +11,12 @@ import (
 )
 
 var (
-	errInvalidConn     = errors.New("invalid connection")
-	errMissingAddress  = errors.New("missing address")
-	errHeaderTooShort  = errors.New("header too short")
-	errInvalidConnType = errors.New("invalid conn type")
-	errNotImplemented  = errors.New("not implemented on " + runtime.GOOS + "/" + runtime.GOARCH)
+	errInvalidConn       = errors.New("invalid connection")
+	errMissingAddress    = errors.New("missing address")
+	errHeaderTooShort    = errors.New("header too short")
+	errInvalidConnType   = errors.New("invalid conn type")
+	errNotImplemented    = errors.New("not implemented on " + runtime.GOOS + "/" + runtime.GOARCH)
+	errDeviceNameTooLong = errors.New("device name too long")
 )
 
 func boolint(b bool) int {
@@ -0,0 +1,118 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv6
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/net/netif"
+)
+
+// InfiniteLifetime is the lifetime of an address which does not expire.
+const InfiniteLifetime = netif.Infinite
+
+// An AddrFlags represents the state of an interface address. It is the
+// AddrFlags of package netif, which reports the addresses.
+type AddrFlags = netif.AddrFlags
+
+const (
+	// AddrTemporary is set on the temporary addresses of the privacy
+	// extensions of stateless address autoconfiguration, RFC 8981,
+	// which are replaced regularly.
+	AddrTemporary = netif.AddrTemporary
+
+	// AddrDeprecated is set on the addresses whose preferred lifetime
+	// expired, which should not be used for new communications.
+	AddrDeprecated = netif.AddrDeprecated
+
+	// AddrTentative is set on the addresses whose uniqueness is being
+	// verified by duplicate address detection, RFC 4862, which cannot
+	// be used meanwhile.
+	AddrTentative = netif.AddrTentative
+
+	// AddrDuplicated is set on the addresses which duplicate address
+	// detection found to be in use by another node.
+	AddrDuplicated = netif.AddrDuplicated
+
+	// AddrAnycast is set on the anycast addresses, RFC 4291, which
+	// must not be used as source addresses.
+	AddrAnycast = netif.AddrAnycast
+)
+
+// unstableFlags are the flags of the addresses which are not stable
+// source addresses.
+const unstableFlags = AddrTemporary | AddrDeprecated | AddrTentative | AddrDuplicated | netif.AddrOptimistic | AddrAnycast
+
+// An InterfaceAddr is an IPv6 address of a network interface, with its
+// state.
+type InterfaceAddr struct {
+	IP        net.IP
+	PrefixLen int // length of the prefix of the subnet of IP
+	Interface int // index of the interface
+
+	Flags AddrFlags
+
+	// FlagsKnown reports whether the platform reported the flags of
+	// the address, which are otherwise zero.
+	FlagsKnown bool
+
+	// PreferredLifetime and ValidLifetime are the times left before
+	// the address is deprecated and removed, or InfiniteLifetime.
+	PreferredLifetime time.Duration
+	ValidLifetime     time.Duration
+}
+
+// Stable reports whether a is a stable source address, for a server: it
+// is neither temporary, deprecated, tentative, optimistic, duplicated
+// nor anycast. It reports false if the flags of a are not known.
+func (a *InterfaceAddr) Stable() bool {
+	return a.FlagsKnown && a.Flags&unstableFlags == 0
+}
+
+// InterfaceAddrs returns the IPv6 addresses of the interface ifi, or of
+// all the interfaces if ifi is nil, with their state, unicast and
+// anycast.
+//
+// The addresses are those of package netif, whose documentation lists
+// the platforms which report their flags, lifetimes and anycast
+// addresses. On the others, the flags of the addresses are not known,
+// and their lifetimes are infinite.
+func InterfaceAddrs(ifi *net.Interface) ([]InterfaceAddr, error) {
+	var its []netif.Interface
+	if ifi != nil {
+		it, err := netif.InterfaceByName(ifi.Name)
+		if err != nil {
+			return nil, err
+		}
+		its = []netif.Interface{*it}
+	} else {
+		var err error
+		if its, err = netif.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	var addrs []InterfaceAddr
+	for _, it := range its {
+		for _, as := range [][]netif.Addr{it.Addrs, it.AnycastAddrs} {
+			for _, a := range as {
+				if len(a.IP) != net.IPv6len || a.IP.To4() != nil {
+					continue
+				}
+				prefixLen, _ := a.Mask.Size()
+				addrs = append(addrs, InterfaceAddr{
+					IP:                a.IP,
+					PrefixLen:         prefixLen,
+					Interface:         it.Index,
+					Flags:             a.Flags,
+					FlagsKnown:        a.FlagsKnown,
+					PreferredLifetime: a.PreferredLifetime,
+					ValidLifetime:     a.ValidLifetime,
+				})
+			}
+		}
+	}
+	return addrs, nil
+}
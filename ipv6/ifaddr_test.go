@@ -0,0 +1,98 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv6_test
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv6"
+	"golang.org/x/net/netif"
+	"golang.org/x/net/nettest"
+)
+
+func TestAddrFlagsString(t *testing.T) {
+	for _, tt := range []struct {
+		f    ipv6.AddrFlags
+		want string
+	}{
+		{0, "0"},
+		{ipv6.AddrTemporary, "temporary"},
+		{ipv6.AddrDeprecated | ipv6.AddrAnycast, "deprecated|anycast"},
+	} {
+		if got := tt.f.String(); got != tt.want {
+			t.Errorf("%#x.String() = %q; want %q", uint(tt.f), got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceAddrStable(t *testing.T) {
+	for _, tt := range []struct {
+		f     ipv6.AddrFlags
+		known bool
+		want  bool
+	}{
+		{0, true, true},
+		{netif.AddrPermanent, true, true},
+		{ipv6.AddrTemporary, true, false},
+		{netif.AddrOptimistic, true, false},
+		{ipv6.AddrAnycast | netif.AddrPermanent, true, false},
+		{0, false, false},
+	} {
+		a := ipv6.InterfaceAddr{Flags: tt.f, FlagsKnown: tt.known}
+		if got := a.Stable(); got != tt.want {
+			t.Errorf("Stable() with flags %v, known %v = %v; want %v", tt.f, tt.known, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	if !nettest.SupportsIPv6() {
+		t.Skip("ipv6 is not supported")
+	}
+	ifis, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := ipv6.InterfaceAddrs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, ifi := range ifis {
+		ifi := ifi
+		addrs, err := ipv6.InterfaceAddrs(&ifi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]bool)
+		for _, a := range addrs {
+			if a.Interface != ifi.Index {
+				t.Errorf("%s: address %v of interface %d", ifi.Name, a.IP, a.Interface)
+			}
+			if a.ValidLifetime < a.PreferredLifetime {
+				t.Errorf("%s: address %v valid for %v, less than preferred for %v", ifi.Name, a.IP, a.ValidLifetime, a.PreferredLifetime)
+			}
+			got[a.IP.String()] = true
+		}
+		ifat, err := ifi.Addrs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ifa := range ifat {
+			ipn, ok := ifa.(*net.IPNet)
+			if !ok || ipn.IP.To4() != nil {
+				continue
+			}
+			if !got[ipn.IP.String()] {
+				t.Errorf("%s: missing address %v in %+v", ifi.Name, ipn.IP, addrs)
+			}
+		}
+		n += len(addrs)
+	}
+	if n != len(all) {
+		t.Errorf("%d addresses of all the interfaces; want %d", len(all), n)
+	}
+}
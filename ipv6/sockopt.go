@@ -27,6 +27,13 @@ const (
 	ssoBlockSourceGroup           // any-source or source-specific multicast
 	ssoUnblockSourceGroup         // any-source or source-specific multicast
 	ssoAttachFilter               // attach BPF for filtering inbound traffic
+	ssoUDPSegment                 // udp segment size for outbound packet
+	ssoUDPGRO                     // udp generic receive offload
+	ssoReceiveHopOpts             // hop-by-hop options on received packet, RFC 3542
+	ssoReceiveDstOpts             // destination options on received packet, RFC 3542
+	ssoUnicastInterface           // outbound interface for unicast packet
+	ssoBindToDevice               // inbound and outbound device
+	ssoMark                       // routing mark of outbound packet
 )
 
 // Sticky socket option value types
@@ -34,6 +41,7 @@ const (
 	ssoTypeIPMreq = iota + 1
 	ssoTypeGroupReq
 	ssoTypeGroupSourceReq
+	ssoTypeIndexBigEndian
 )
 
 // A sockOpt represents a binding for sticky socket option.
@@ -0,0 +1,41 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipv6
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/net/internal/socket"
+)
+
+func TestUnicastInterfaceByteOrder(t *testing.T) {
+	c, err := net.ListenPacket("udp6", "[::]:0")
+	if err != nil {
+		t.Skipf("not supported: %v", err)
+	}
+	defer c.Close()
+	ifi, err := net.InterfaceByIndex(1)
+	if err != nil {
+		t.Skipf("no interface of index 1: %v", err)
+	}
+	if err := NewPacketConn(c).SetUnicastInterface(ifi); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := socket.NewConn(c.(net.Conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IPV6_UNICAST_IF takes an index in network byte order, and
+	// reports it the same way.
+	var b [4]byte
+	if _, err := sockOpts[ssoUnicastInterface].Get(sc, b[:]); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.BigEndian.Uint32(b[:]); got != uint32(ifi.Index) {
+		t.Errorf("IPV6_UNICAST_IF = %d (% x); want %d", got, b, ifi.Index)
+	}
+}
@@ -8,6 +8,7 @@
 package ipv6
 
 import (
+	"encoding/binary"
 	"net"
 	"runtime"
 	"unsafe"
@@ -88,3 +89,25 @@ func (so *sockOpt) setSourceGroup(c *socket.Conn, ifi *net.Interface, grp, src n
 func (so *sockOpt) setBPF(c *socket.Conn, f []bpf.RawInstruction) error {
 	return so.setAttachFilter(c, f)
 }
+
+func (so *sockOpt) setUnicastInterface(c *socket.Conn, ifi *net.Interface) error {
+	var i int
+	if ifi != nil {
+		i = ifi.Index
+	}
+	if so.typ == ssoTypeIndexBigEndian {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(i))
+		return so.Set(c, b[:])
+	}
+	return so.SetInt(c, i)
+}
+
+func (so *sockOpt) setDevice(c *socket.Conn, name string) error {
+	if len(name) >= so.Len {
+		return errDeviceNameTooLong
+	}
+	b := make([]byte, so.Len)
+	copy(b, name)
+	return so.Set(c, b)
+}
@@ -24,6 +24,8 @@ var (
 		ctlPacketInfo:   {unix.IPV6_PKTINFO, sizeofInet6Pktinfo, marshalPacketInfo, parsePacketInfo},
 		ctlNextHop:      {unix.IPV6_NEXTHOP, sizeofSockaddrInet6, marshalNextHop, parseNextHop},
 		ctlPathMTU:      {unix.IPV6_PATHMTU, sizeofIPv6Mtuinfo, marshalPathMTU, parsePathMTU},
+		ctlHopOpts:      {unix.IPV6_HOPOPTS, 8, nil, nil},
+		ctlDstOpts:      {unix.IPV6_DSTOPTS, 8, nil, nil},
 	}
 
 	sockOpts = map[int]sockOpt{
@@ -36,6 +38,8 @@ var (
 		ssoReceiveHopLimit:     {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVHOPLIMIT, Len: 4}},
 		ssoReceivePacketInfo:   {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVPKTINFO, Len: 4}},
 		ssoReceivePathMTU:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVPATHMTU, Len: 4}},
+		ssoReceiveHopOpts:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVHOPOPTS, Len: 4}},
+		ssoReceiveDstOpts:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVDSTOPTS, Len: 4}},
 		ssoPathMTU:             {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_PATHMTU, Len: sizeofIPv6Mtuinfo}},
 		ssoChecksum:            {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_CHECKSUM, Len: 4}},
 		ssoICMPFilter:          {Option: socket.Option{Level: iana.ProtocolIPv6ICMP, Name: unix.ICMP6_FILTER, Len: sizeofICMPv6Filter}},
@@ -21,6 +21,10 @@ var (
 		ctlHopLimit:     {unix.IPV6_HOPLIMIT, 4, marshalHopLimit, parseHopLimit},
 		ctlPacketInfo:   {unix.IPV6_PKTINFO, sizeofInet6Pktinfo, marshalPacketInfo, parsePacketInfo},
 		ctlPathMTU:      {unix.IPV6_PATHMTU, sizeofIPv6Mtuinfo, marshalPathMTU, parsePathMTU},
+		ctlHopOpts:      {unix.IPV6_HOPOPTS, 8, nil, nil},
+		ctlDstOpts:      {unix.IPV6_DSTOPTS, 8, nil, nil},
+		ctlUDPSegment:   {unix.UDP_SEGMENT, 2, marshalUDPSegment, nil},
+		ctlUDPGRO:       {unix.UDP_GRO, 4, nil, parseUDPGRO},
 	}
 
 	sockOpts = map[int]*sockOpt{
@@ -33,6 +37,8 @@ var (
 		ssoReceiveHopLimit:     {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVHOPLIMIT, Len: 4}},
 		ssoReceivePacketInfo:   {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVPKTINFO, Len: 4}},
 		ssoReceivePathMTU:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVPATHMTU, Len: 4}},
+		ssoReceiveHopOpts:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVHOPOPTS, Len: 4}},
+		ssoReceiveDstOpts:      {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_RECVDSTOPTS, Len: 4}},
 		ssoPathMTU:             {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_PATHMTU, Len: sizeofIPv6Mtuinfo}},
 		ssoChecksum:            {Option: socket.Option{Level: iana.ProtocolReserved, Name: unix.IPV6_CHECKSUM, Len: 4}},
 		ssoICMPFilter:          {Option: socket.Option{Level: iana.ProtocolIPv6ICMP, Name: unix.ICMPV6_FILTER, Len: sizeofICMPv6Filter}},
@@ -43,6 +49,11 @@ var (
 		ssoBlockSourceGroup:    {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.MCAST_BLOCK_SOURCE, Len: sizeofGroupSourceReq}, typ: ssoTypeGroupSourceReq},
 		ssoUnblockSourceGroup:  {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.MCAST_UNBLOCK_SOURCE, Len: sizeofGroupSourceReq}, typ: ssoTypeGroupSourceReq},
 		ssoAttachFilter:        {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_ATTACH_FILTER, Len: unix.SizeofSockFprog}},
+		ssoUDPSegment:          {Option: socket.Option{Level: iana.ProtocolUDP, Name: unix.UDP_SEGMENT, Len: 4}},
+		ssoUDPGRO:              {Option: socket.Option{Level: iana.ProtocolUDP, Name: unix.UDP_GRO, Len: 4}},
+		ssoUnicastInterface:    {Option: socket.Option{Level: iana.ProtocolIPv6, Name: unix.IPV6_UNICAST_IF, Len: 4}, typ: ssoTypeIndexBigEndian},
+		ssoBindToDevice:        {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_BINDTODEVICE, Len: unix.IFNAMSIZ}},
+		ssoMark:                {Option: socket.Option{Level: unix.SOL_SOCKET, Name: unix.SO_MARK, Len: 4}},
 	}
 )
 
@@ -15,6 +15,8 @@ import (
 )
 
 const (
+	sysIPV6_UNICAST_IF = 0x1f // missing from golang.org/x/sys/windows
+
 	sizeofSockaddrInet6 = 0x1c
 
 	sizeofIPv6Mreq     = 0x14
@@ -54,6 +56,7 @@ var (
 		ssoMulticastLoopback:  {Option: socket.Option{Level: iana.ProtocolIPv6, Name: windows.IPV6_MULTICAST_LOOP, Len: 4}},
 		ssoJoinGroup:          {Option: socket.Option{Level: iana.ProtocolIPv6, Name: windows.IPV6_JOIN_GROUP, Len: sizeofIPv6Mreq}, typ: ssoTypeIPMreq},
 		ssoLeaveGroup:         {Option: socket.Option{Level: iana.ProtocolIPv6, Name: windows.IPV6_LEAVE_GROUP, Len: sizeofIPv6Mreq}, typ: ssoTypeIPMreq},
+		ssoUnicastInterface:   {Option: socket.Option{Level: iana.ProtocolIPv6, Name: sysIPV6_UNICAST_IF, Len: 4}},
 	}
 )
 
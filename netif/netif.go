@@ -0,0 +1,245 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netif reports network interfaces together with metadata
+// about their addresses that the net package does not expose, such
+// as address scopes, lifetimes and the deprecated and temporary flags
+// of IPv6 addresses.
+//
+// The metadata reported depends on the platform:
+//
+//   - On Linux, scopes, flags and lifetimes are fetched over rtnetlink.
+//   - On Windows, flags and lifetimes are fetched with
+//     GetAdaptersAddresses.
+//   - On Solaris, flags are fetched from the logical interface
+//     carrying each address.
+//   - On Darwin, FreeBSD, NetBSD and OpenBSD, the flags and lifetimes
+//     of IPv6 addresses are fetched with the SIOCGIFAFLAG_IN6 and
+//     SIOCGIFALIFETIME_IN6 ioctls.
+//   - On other platforms, only the information provided by the net
+//     package is reported.
+//
+// Where the platform reports no scope, it is derived from the address.
+// Where it reports no lifetimes, they are Infinite.
+package netif // import "golang.org/x/net/netif"
+
+import (
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Infinite is the lifetime of an address that does not expire.
+const Infinite time.Duration = math.MaxInt64
+
+var errNoSuchInterface = errors.New("no such network interface")
+
+// An Interface represents a network interface and its addresses.
+type Interface struct {
+	Index        int              // positive integer that starts at one, zero is never used
+	MTU          int              // maximum transmission unit
+	Name         string           // e.g., "en0", "lo0", "eth0.100"
+	HardwareAddr net.HardwareAddr // IEEE MAC-48, EUI-48 and EUI-64 form
+	Flags        net.Flags        // e.g., net.FlagUp, net.FlagLoopback
+	Addrs        []Addr           // unicast interface addresses
+
+	// AnycastAddrs are the anycast addresses of the interface, RFC
+	// 4291, which are flagged AddrAnycast, on the platforms which
+	// report them: Linux, Windows, Darwin and the BSDs above.
+	AnycastAddrs []Addr
+}
+
+// An Addr represents a unicast address assigned to an interface.
+type Addr struct {
+	IP    net.IP
+	Mask  net.IPMask
+	Scope Scope
+	Flags AddrFlags
+
+	// FlagsKnown reports whether the platform reported the flags of
+	// the address. Where it did not, Flags is zero whatever the state
+	// of the address, which may be temporary or deprecated.
+	FlagsKnown bool
+
+	// PreferredLifetime is the remaining time during which the
+	// address may be used for new communications, and
+	// ValidLifetime is the remaining time before the address is
+	// removed. Each is Infinite if the address does not expire.
+	PreferredLifetime time.Duration
+	ValidLifetime     time.Duration
+}
+
+// IPNet returns the address and mask of a as a net.IPNet.
+func (a *Addr) IPNet() *net.IPNet {
+	return &net.IPNet{IP: a.IP, Mask: a.Mask}
+}
+
+// A Scope represents the topological area within which an address is
+// unique and meaningful.
+type Scope int
+
+const (
+	ScopeGlobal Scope = iota // unique in the Internet
+	ScopeSite                // unique within a site, such as ULAs and IPv4 private addresses
+	ScopeLink                // unique on a link, such as link-local addresses
+	ScopeHost                // meaningful only within the host, such as loopback addresses
+)
+
+var scopeNames = []string{
+	ScopeGlobal: "global",
+	ScopeSite:   "site",
+	ScopeLink:   "link",
+	ScopeHost:   "host",
+}
+
+func (s Scope) String() string {
+	if 0 <= s && int(s) < len(scopeNames) {
+		return scopeNames[s]
+	}
+	return "scope(" + strconv.Itoa(int(s)) + ")"
+}
+
+// An AddrFlags represents the state of an address.
+type AddrFlags uint
+
+const (
+	AddrTemporary  AddrFlags = 1 << iota // temporary address for privacy extensions, RFC 8981
+	AddrDeprecated                       // preferred lifetime expired, should not be used for new communications
+	AddrTentative                        // duplicate address detection in progress
+	AddrDuplicated                       // duplicate address detection failed
+	AddrOptimistic                       // usable while duplicate address detection is in progress, RFC 4429
+	AddrPermanent                        // configured by an administrator rather than autoconfigured
+	AddrAnycast                          // anycast address, RFC 4291, which must not be used as a source address
+)
+
+var addrFlagNames = []string{
+	"temporary",
+	"deprecated",
+	"tentative",
+	"duplicated",
+	"optimistic",
+	"permanent",
+	"anycast",
+}
+
+func (f AddrFlags) String() string {
+	s := ""
+	for i, name := range addrFlagNames {
+		if f&(1<<uint(i)) != 0 {
+			if s != "" {
+				s += "|"
+			}
+			s += name
+		}
+	}
+	if s == "" {
+		s = "0"
+	}
+	return s
+}
+
+// Interfaces returns a list of the system's network interfaces and
+// their addresses.
+func Interfaces() ([]Interface, error) {
+	ifts, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	return interfaces(ifts)
+}
+
+// InterfaceByName returns the interface specified by name.
+func InterfaceByName(name string) (*Interface, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	ifts, err := interfaces([]net.Interface{*ifi})
+	if err != nil {
+		return nil, err
+	}
+	if len(ifts) == 0 {
+		return nil, &net.OpError{Op: "route", Net: "ip+net", Err: errNoSuchInterface}
+	}
+	return &ifts[0], nil
+}
+
+func newInterface(ifi *net.Interface) Interface {
+	return Interface{
+		Index:        ifi.Index,
+		MTU:          ifi.MTU,
+		Name:         ifi.Name,
+		HardwareAddr: ifi.HardwareAddr,
+		Flags:        ifi.Flags,
+	}
+}
+
+// netAddrs returns the addresses of ifi as reported by the net
+// package, with scopes derived from the addresses.
+func netAddrs(ifi *net.Interface) ([]Addr, error) {
+	ifat, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var as []Addr
+	for _, ifa := range ifat {
+		ipn, ok := ifa.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		as = append(as, newAddr(ipn.IP, ipn.Mask))
+	}
+	return as, nil
+}
+
+func newAddr(ip net.IP, mask net.IPMask) Addr {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+	}
+	return Addr{
+		IP:                ip,
+		Mask:              mask,
+		Scope:             scopeOf(ip),
+		PreferredLifetime: Infinite,
+		ValidLifetime:     Infinite,
+	}
+}
+
+var sitePrefixes = []*net.IPNet{
+	{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+	{IP: net.IP{172, 16, 0, 0}, Mask: net.CIDRMask(12, 32)},
+	{IP: net.IP{192, 168, 0, 0}, Mask: net.CIDRMask(16, 32)},
+	{IP: net.IP{0xfc, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(7, 128)},
+	{IP: net.IP{0xfe, 0xc0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, Mask: net.CIDRMask(10, 128)}, // deprecated site-local
+}
+
+// scopeOf returns the scope of ip derived from its value.
+func scopeOf(ip net.IP) Scope {
+	switch {
+	case ip.IsLoopback():
+		return ScopeHost
+	case ip.IsLinkLocalUnicast():
+		return ScopeLink
+	}
+	for _, p := range sitePrefixes {
+		if p.Contains(ip) {
+			return ScopeSite
+		}
+	}
+	return ScopeGlobal
+}
+
+// lifetime returns the duration of a lifetime in seconds reported by
+// the kernel, where 0xffffffff means infinity.
+func lifetime(secs uint32) time.Duration {
+	if secs == math.MaxUint32 {
+		return Infinite
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+package netif
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// The ioctls of the KAME IPv6 stack, _IOWR('i', 73, struct
+	// in6_ifreq) and _IOWR('i', 81, struct in6_ifreq).
+	sysSIOCGIFAFLAG_IN6     = 0xc1206949
+	sysSIOCGIFALIFETIME_IN6 = 0xc1206951
+
+	// The union of struct in6_ifreq, whose largest member is struct
+	// icmp6_ifstat, of 34 64-bit counters.
+	sizeofIn6IfreqUnion = 0x110
+
+	sizeofSockaddrInet6 = 0x1c
+	sizeofTimeT         = unsafe.Sizeof(syscall.Timespec{}.Sec)
+
+	in6IffAnycast    = 0x01
+	in6IffTentative  = 0x02
+	in6IffDuplicated = 0x04
+	in6IffDeprecated = 0x10
+	in6IffTemporary  = 0x80
+
+	nd6InfiniteLifetime = 0xffffffff
+)
+
+type in6Ifreq struct {
+	Name [syscall.IFNAMSIZ]byte
+	Ifru [sizeofIn6IfreqUnion / 8]uint64 // aligned as the C union
+}
+
+func (ifr *in6Ifreq) data() []byte {
+	return (*[sizeofIn6IfreqUnion]byte)(unsafe.Pointer(&ifr.Ifru))[:]
+}
+
+var nativeEndian binary.ByteOrder
+
+func init() {
+	i := uint32(1)
+	b := (*[4]byte)(unsafe.Pointer(&i))
+	if b[0] == 1 {
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+func interfaces(ifts []net.Interface) ([]Interface, error) {
+	// The flags and lifetimes of IPv6 addresses are queried one
+	// address at a time. Without IPv6, there are none to query.
+	s, err := syscall.Socket(syscall.AF_INET6, syscall.SOCK_DGRAM, 0)
+	haveIPv6 := err == nil
+	if haveIPv6 {
+		defer syscall.Close(s)
+	}
+	its := make([]Interface, len(ifts))
+	for i := range ifts {
+		its[i] = newInterface(&ifts[i])
+		as, err := netAddrs(&ifts[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range as {
+			if haveIPv6 && len(a.IP) == net.IPv6len {
+				queryAddr(s, &ifts[i], &a)
+			}
+			if a.Flags&AddrAnycast != 0 {
+				its[i].AnycastAddrs = append(its[i].AnycastAddrs, a)
+			} else {
+				its[i].Addrs = append(its[i].Addrs, a)
+			}
+		}
+	}
+	return its, nil
+}
+
+// queryAddr sets the flags and lifetimes of the IPv6 address a of ifi,
+// leaving them unset if the ioctls fail.
+func queryAddr(s int, ifi *net.Interface, a *Addr) {
+	var ifr in6Ifreq
+	copy(ifr.Name[:len(ifr.Name)-1], ifi.Name)
+	setSockaddr(ifr.data(), ifi, a.IP)
+	if ioctl(s, sysSIOCGIFAFLAG_IN6, &ifr) != nil {
+		return
+	}
+	flags := nativeEndian.Uint32(ifr.data())
+	a.FlagsKnown = true
+	if flags&in6IffAnycast != 0 {
+		a.Flags |= AddrAnycast
+	}
+	if flags&in6IffTentative != 0 {
+		a.Flags |= AddrTentative
+	}
+	if flags&in6IffDuplicated != 0 {
+		a.Flags |= AddrDuplicated
+	}
+	if flags&in6IffDeprecated != 0 {
+		a.Flags |= AddrDeprecated
+	}
+	if flags&in6IffTemporary != 0 {
+		a.Flags |= AddrTemporary
+	}
+
+	setSockaddr(ifr.data(), ifi, a.IP)
+	if ioctl(s, sysSIOCGIFALIFETIME_IN6, &ifr) != nil {
+		return
+	}
+	// struct in6_addrlifetime holds the times of expiry, in seconds
+	// since the epoch, and then the lifetimes, both valid first.
+	b := ifr.data()
+	now := time.Now().Unix()
+	tt := int(sizeofTimeT)
+	a.ValidLifetime = remaining(timeT(b[0:tt]), nativeEndian.Uint32(b[2*tt:]), now)
+	a.PreferredLifetime = remaining(timeT(b[tt:2*tt]), nativeEndian.Uint32(b[2*tt+4:]), now)
+}
+
+// setSockaddr writes the struct sockaddr_in6 of ip, an address of ifi,
+// to b.
+func setSockaddr(b []byte, ifi *net.Interface, ip net.IP) {
+	for i := range b {
+		b[i] = 0
+	}
+	b[0] = sizeofSockaddrInet6
+	b[1] = syscall.AF_INET6
+	copy(b[8:24], ip)
+	if ip.IsLinkLocalUnicast() {
+		nativeEndian.PutUint32(b[24:28], uint32(ifi.Index))
+	}
+}
+
+func timeT(b []byte) int64 {
+	if len(b) == 4 {
+		return int64(int32(nativeEndian.Uint32(b)))
+	}
+	return int64(nativeEndian.Uint64(b))
+}
+
+// remaining returns the lifetime left until expire, falling back to the
+// lifetime lt when no time of expiry is set.
+func remaining(expire int64, lt uint32, now int64) time.Duration {
+	switch {
+	case lt == nd6InfiniteLifetime:
+		return Infinite
+	case expire == 0:
+		return time.Duration(lt) * time.Second
+	case expire <= now:
+		return 0
+	}
+	return time.Duration(expire-now) * time.Second
+}
+
+func ioctl(s int, req uintptr, ifr *in6Ifreq) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(s), req, uintptr(unsafe.Pointer(ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+package netif
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRemaining(t *testing.T) {
+	const now = 1000000
+	for _, tt := range []struct {
+		expire int64
+		lt     uint32
+		want   time.Duration
+	}{
+		{0, nd6InfiniteLifetime, Infinite},
+		{now + 60, nd6InfiniteLifetime, Infinite},
+		{now + 60, 3600, time.Minute},
+		{now - 60, 3600, 0},
+		{0, 3600, time.Hour},
+	} {
+		if got := remaining(tt.expire, tt.lt, now); got != tt.want {
+			t.Errorf("remaining(%d, %d, %d) = %v; want %v", tt.expire, tt.lt, now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netif
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ifaFlags   = 0x8 // IFA_FLAGS, carries the full 32-bit flags on Linux 3.14 and above
+	ifaAnycast = 0x7 // IFA_ANYCAST, the address of the messages of RTM_GETANYCAST
+
+	rtmNewAnycast = 0x3c
+	rtmGetAnycast = 0x3e
+
+	ifaFSecondary  = 0x01 // IFA_F_SECONDARY and IFA_F_TEMPORARY
+	ifaFOptimistic = 0x04
+	ifaFDADFailed  = 0x08
+	ifaFDeprecated = 0x20
+	ifaFTentative  = 0x40
+	ifaFPermanent  = 0x80
+
+	sizeofIfaCacheinfo = 0x10
+)
+
+var nativeEndian binary.ByteOrder
+
+func init() {
+	i := uint32(1)
+	b := (*[4]byte)(unsafe.Pointer(&i))
+	if b[0] == 1 {
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+func interfaces(ifts []net.Interface) ([]Interface, error) {
+	addrs, err := dumpAddrs(syscall.RTM_GETADDR, syscall.RTM_NEWADDR, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	// Only IPv6 has anycast addresses. Their dump fails if IPv6 is
+	// disabled, and then there are none.
+	anycast, _ := dumpAddrs(rtmGetAnycast, rtmNewAnycast, syscall.AF_INET6)
+	its := make([]Interface, len(ifts))
+	for i := range ifts {
+		its[i] = newInterface(&ifts[i])
+		its[i].Addrs = addrs[ifts[i].Index]
+		its[i].AnycastAddrs = anycast[ifts[i].Index]
+		for j := range its[i].AnycastAddrs {
+			its[i].AnycastAddrs[j].Flags |= AddrAnycast
+		}
+	}
+	return its, nil
+}
+
+// dumpAddrs returns the addresses of family af dumped by the rtnetlink
+// request proto, whose messages are of type typ, by interface index.
+func dumpAddrs(proto int, typ uint16, af int) (map[int][]Addr, error) {
+	rib, err := syscall.NetlinkRIB(proto, af)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, os.NewSyscallError("parsenetlinkmessage", err)
+	}
+	addrs := make(map[int][]Addr)
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Type != typ || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(m)
+		if err != nil {
+			return nil, os.NewSyscallError("parsenetlinkrouteattr", err)
+		}
+		ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		if a, ok := parseAddr(ifam, attrs); ok {
+			addrs[int(ifam.Index)] = append(addrs[int(ifam.Index)], a)
+		}
+	}
+	return addrs, nil
+}
+
+func parseAddr(ifam *syscall.IfAddrmsg, attrs []syscall.NetlinkRouteAttr) (Addr, bool) {
+	var ip net.IP
+	flags := uint32(ifam.Flags)
+	var ci []byte
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFA_ADDRESS:
+			// IFA_LOCAL, when present, is the local address of a
+			// point-to-point interface and takes precedence.
+			if ip == nil {
+				ip = copyIP(a.Value)
+			}
+		case syscall.IFA_LOCAL, ifaAnycast:
+			ip = copyIP(a.Value)
+		case syscall.IFA_CACHEINFO:
+			ci = a.Value
+		case ifaFlags:
+			if len(a.Value) >= 4 {
+				flags = nativeEndian.Uint32(a.Value)
+			}
+		}
+	}
+	var mask net.IPMask
+	switch {
+	case ifam.Family == syscall.AF_INET && len(ip) == net.IPv4len:
+		mask = net.CIDRMask(int(ifam.Prefixlen), 8*net.IPv4len)
+	case ifam.Family == syscall.AF_INET6 && len(ip) == net.IPv6len:
+		mask = net.CIDRMask(int(ifam.Prefixlen), 8*net.IPv6len)
+	default:
+		return Addr{}, false
+	}
+	a := newAddr(ip, mask)
+	a.FlagsKnown = true
+	switch ifam.Scope {
+	case syscall.RT_SCOPE_UNIVERSE:
+		// The kernel reports IPv4 private and IPv6 unique local
+		// addresses as universal; keep the derived scope.
+	case syscall.RT_SCOPE_SITE:
+		a.Scope = ScopeSite
+	case syscall.RT_SCOPE_LINK:
+		a.Scope = ScopeLink
+	case syscall.RT_SCOPE_HOST:
+		a.Scope = ScopeHost
+	}
+	if flags&ifaFSecondary != 0 && ifam.Family == syscall.AF_INET6 {
+		a.Flags |= AddrTemporary
+	}
+	if flags&ifaFDeprecated != 0 {
+		a.Flags |= AddrDeprecated
+	}
+	if flags&ifaFTentative != 0 {
+		a.Flags |= AddrTentative
+	}
+	if flags&ifaFDADFailed != 0 {
+		a.Flags |= AddrDuplicated
+	}
+	if flags&ifaFOptimistic != 0 {
+		a.Flags |= AddrOptimistic
+	}
+	if flags&ifaFPermanent != 0 {
+		a.Flags |= AddrPermanent
+	}
+	if len(ci) >= sizeofIfaCacheinfo {
+		a.PreferredLifetime = lifetime(nativeEndian.Uint32(ci[0:4]))
+		a.ValidLifetime = lifetime(nativeEndian.Uint32(ci[4:8]))
+	}
+	return a, true
+}
+
+func copyIP(b []byte) net.IP {
+	ip := make(net.IP, len(b))
+	copy(ip, b)
+	return ip
+}
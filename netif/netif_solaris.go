@@ -0,0 +1,70 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netif
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/net/lif"
+)
+
+func interfaces(ifts []net.Interface) ([]Interface, error) {
+	its := make([]Interface, len(ifts))
+	for i := range ifts {
+		its[i] = newInterface(&ifts[i])
+	}
+	// Each address is carried by a logical interface, such as
+	// "net0:1", whose flags describe the address. Logical
+	// interfaces are named alike in both address families.
+	for _, af := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		lls, err := lif.Links(af, "")
+		if err != nil {
+			continue
+		}
+		for _, ll := range lls {
+			for i := range its {
+				if ll.Index != its[i].Index {
+					continue
+				}
+				as, err := lif.Addrs(af, ll.Name)
+				if err != nil {
+					return nil, err
+				}
+				for _, la := range as {
+					if a, ok := parseAddr(la, ll.Flags); ok {
+						its[i].Addrs = append(its[i].Addrs, a)
+					}
+				}
+			}
+		}
+	}
+	return its, nil
+}
+
+func parseAddr(la lif.Addr, flags int) (Addr, bool) {
+	var a Addr
+	switch la := la.(type) {
+	case *lif.Inet4Addr:
+		a = newAddr(net.IP(la.IP[:]).To4(), net.CIDRMask(la.PrefixLen, 8*net.IPv4len))
+	case *lif.Inet6Addr:
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, la.IP[:])
+		a = newAddr(ip, net.CIDRMask(la.PrefixLen, 8*net.IPv6len))
+	default:
+		return Addr{}, false
+	}
+	a.FlagsKnown = true
+	if flags&syscall.IFF_TEMPORARY != 0 {
+		a.Flags |= AddrTemporary
+	}
+	if flags&syscall.IFF_DEPRECATED != 0 {
+		a.Flags |= AddrDeprecated
+	}
+	if flags&syscall.IFF_DUPLICATE != 0 {
+		a.Flags |= AddrDuplicated
+	}
+	return a, true
+}
@@ -0,0 +1,23 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package netif
+
+import "net"
+
+func interfaces(ifts []net.Interface) ([]Interface, error) {
+	its := make([]Interface, len(ifts))
+	for i := range ifts {
+		its[i] = newInterface(&ifts[i])
+		as, err := netAddrs(&ifts[i])
+		if err != nil {
+			return nil, err
+		}
+		its[i].Addrs = as
+	}
+	return its, nil
+}
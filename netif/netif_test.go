@@ -0,0 +1,121 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netif
+
+import (
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestInterfaces(t *testing.T) {
+	ifts, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("net.Interfaces: %v", err)
+	}
+	its, err := Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(its) != len(ifts) {
+		t.Fatalf("got %d interfaces; want %d", len(its), len(ifts))
+	}
+	for i, it := range its {
+		ifi := &ifts[i]
+		if it.Index != ifi.Index || it.Name != ifi.Name || it.MTU != ifi.MTU || it.Flags != ifi.Flags {
+			t.Errorf("got %+v; want %+v", it, ifi)
+		}
+		ifat, err := ifi.Addrs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := make(map[string]bool)
+		for _, ifa := range ifat {
+			if ipn, ok := ifa.(*net.IPNet); ok {
+				want[ipn.String()] = true
+			}
+		}
+		for _, a := range it.Addrs {
+			s := a.IPNet().String()
+			if !want[s] {
+				t.Errorf("%s: unexpected address %s", it.Name, s)
+			}
+			delete(want, s)
+			if runtime.GOOS == "linux" && !a.FlagsKnown {
+				t.Errorf("%s: %s: flags not known", it.Name, s)
+			}
+			if a.ValidLifetime < a.PreferredLifetime {
+				t.Errorf("%s: %s: valid lifetime %v shorter than preferred lifetime %v", it.Name, s, a.ValidLifetime, a.PreferredLifetime)
+			}
+		}
+		for s := range want {
+			t.Errorf("%s: missing address %s", it.Name, s)
+		}
+		for _, a := range it.AnycastAddrs {
+			if a.Flags&AddrAnycast == 0 || a.IP.To4() != nil {
+				t.Errorf("%s: unexpected anycast address %s, flags %v", it.Name, a.IP, a.Flags)
+			}
+		}
+	}
+}
+
+func TestLoopbackScope(t *testing.T) {
+	switch runtime.GOOS {
+	case "js", "plan9", "wasip1":
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	its, err := Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range its {
+		for _, a := range it.Addrs {
+			if a.IP.IsLoopback() && a.Scope != ScopeHost {
+				t.Errorf("%s: %s: got scope %v; want %v", it.Name, a.IP, a.Scope, ScopeHost)
+			}
+		}
+	}
+}
+
+func TestScopeOf(t *testing.T) {
+	for _, tt := range []struct {
+		ip    string
+		scope Scope
+	}{
+		{"127.0.0.1", ScopeHost},
+		{"::1", ScopeHost},
+		{"169.254.1.1", ScopeLink},
+		{"fe80::1", ScopeLink},
+		{"10.1.2.3", ScopeSite},
+		{"172.31.0.1", ScopeSite},
+		{"192.168.0.1", ScopeSite},
+		{"fd00::1", ScopeSite},
+		{"fec0::1", ScopeSite},
+		{"172.32.0.1", ScopeGlobal},
+		{"8.8.8.8", ScopeGlobal},
+		{"2001:db8::1", ScopeGlobal},
+	} {
+		if got := scopeOf(net.ParseIP(tt.ip)); got != tt.scope {
+			t.Errorf("scopeOf(%s) = %v; want %v", tt.ip, got, tt.scope)
+		}
+	}
+}
+
+func TestAddrFlagsString(t *testing.T) {
+	for _, tt := range []struct {
+		f AddrFlags
+		s string
+	}{
+		{0, "0"},
+		{AddrTemporary, "temporary"},
+		{AddrDeprecated | AddrTemporary, "temporary|deprecated"},
+		{AddrPermanent, "permanent"},
+		{AddrAnycast | AddrDeprecated, "deprecated|anycast"},
+	} {
+		if got := tt.f.String(); got != tt.s {
+			t.Errorf("%#x: got %q; want %q", uint(tt.f), got, tt.s)
+		}
+	}
+}
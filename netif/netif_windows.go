@@ -0,0 +1,116 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netif
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// See NL_PREFIX_ORIGIN, NL_SUFFIX_ORIGIN and NL_DAD_STATE in nldef.h.
+const (
+	ipPrefixOriginManual = 1
+	ipSuffixOriginRandom = 4
+
+	ipDadStateTentative  = 1
+	ipDadStateDuplicate  = 2
+	ipDadStateDeprecated = 3
+)
+
+func interfaces(ifts []net.Interface) ([]Interface, error) {
+	aas, err := adapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+	its := make([]Interface, len(ifts))
+	for i := range ifts {
+		its[i] = newInterface(&ifts[i])
+		for _, aa := range aas {
+			index := aa.IfIndex
+			if index == 0 {
+				index = aa.Ipv6IfIndex
+			}
+			if int(index) != ifts[i].Index {
+				continue
+			}
+			for ua := aa.FirstUnicastAddress; ua != nil; ua = ua.Next {
+				if a, ok := parseAddr(ua); ok {
+					its[i].Addrs = append(its[i].Addrs, a)
+				}
+			}
+			for aa := aa.FirstAnycastAddress; aa != nil; aa = aa.Next {
+				if ip := aa.Address.IP(); ip != nil {
+					a := newAddr(ip, net.CIDRMask(8*len(ip), 8*len(ip)))
+					a.Flags |= AddrAnycast
+					a.FlagsKnown = true
+					its[i].AnycastAddrs = append(its[i].AnycastAddrs, a)
+				}
+			}
+		}
+	}
+	return its, nil
+}
+
+func parseAddr(ua *windows.IpAdapterUnicastAddress) (Addr, bool) {
+	ip := ua.Address.IP()
+	if ip == nil {
+		return Addr{}, false
+	}
+	var mask net.IPMask
+	if ip4 := ip.To4(); ip4 != nil {
+		mask = net.CIDRMask(int(ua.OnLinkPrefixLength), 8*net.IPv4len)
+	} else {
+		mask = net.CIDRMask(int(ua.OnLinkPrefixLength), 8*net.IPv6len)
+	}
+	a := newAddr(ip, mask)
+	a.FlagsKnown = true
+	if ua.SuffixOrigin == ipSuffixOriginRandom {
+		a.Flags |= AddrTemporary
+	}
+	if ua.PrefixOrigin == ipPrefixOriginManual {
+		a.Flags |= AddrPermanent
+	}
+	switch ua.DadState {
+	case ipDadStateTentative:
+		a.Flags |= AddrTentative
+	case ipDadStateDuplicate:
+		a.Flags |= AddrDuplicated
+	case ipDadStateDeprecated:
+		a.Flags |= AddrDeprecated
+	}
+	a.PreferredLifetime = lifetime(ua.PreferredLifetime)
+	a.ValidLifetime = lifetime(ua.ValidLifetime)
+	return a, true
+}
+
+func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
+	var b []byte
+	l := uint32(15000) // recommended initial size
+	for {
+		b = make([]byte, l)
+		err := windows.GetAdaptersAddresses(syscall.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])), &l)
+		if err == nil {
+			if l == 0 {
+				return nil, nil
+			}
+			break
+		}
+		if err.(syscall.Errno) != syscall.ERROR_BUFFER_OVERFLOW {
+			return nil, os.NewSyscallError("getadaptersaddresses", err)
+		}
+		if l <= uint32(len(b)) {
+			return nil, os.NewSyscallError("getadaptersaddresses", err)
+		}
+	}
+	var aas []*windows.IpAdapterAddresses
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])); aa != nil; aa = aa.Next {
+		aas = append(aas, aa)
+	}
+	return aas, nil
+}
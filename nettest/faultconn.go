@@ -0,0 +1,178 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// A FaultOp identifies the operation affected by a Fault.
+type FaultOp int
+
+const (
+	FaultRead  FaultOp = iota // affects calls to Read
+	FaultWrite                // affects calls to Write
+)
+
+func (op FaultOp) String() string {
+	switch op {
+	case FaultRead:
+		return "read"
+	case FaultWrite:
+		return "write"
+	}
+	return "unknown"
+}
+
+// A Fault describes a misbehavior injected by a FaultConn into a
+// single call of Read or Write.
+type Fault struct {
+	// Op is the operation to affect.
+	Op FaultOp
+
+	// Call is the 1-based index of the affected call among all
+	// calls of Op made on the connection.
+	Call int
+
+	// Short, if positive, limits the number of bytes transferred
+	// from or to the underlying connection by the call.
+	// A short Read is not an error, but a short Write reports
+	// io.ErrShortWrite unless Err is set.
+	Short int
+
+	// Err, if non-nil, is returned by the call wrapped in a
+	// *net.OpError. Unless Short is positive, the call returns Err
+	// without touching the underlying connection.
+	Err error
+
+	// Persist makes the fault apply to every call of Op from Call
+	// onwards, which is useful for simulating a connection reset.
+	Persist bool
+}
+
+// A FaultConn wraps a net.Conn and injects scripted faults into calls
+// of Read and Write, which permits testing retry and error handling
+// paths without relying on real network failures.
+//
+// It is safe to call the methods of FaultConn concurrently.
+type FaultConn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	faults []Fault
+	reads  int
+	writes int
+}
+
+// NewFaultConn returns a FaultConn that wraps c and injects faults.
+func NewFaultConn(c net.Conn, faults ...Fault) *FaultConn {
+	return &FaultConn{Conn: c, faults: append([]Fault(nil), faults...)}
+}
+
+// Inject schedules f in addition to the faults already scheduled.
+// A fault whose Call has already passed only applies if Persist is
+// set, in which case it applies to the next call.
+func (c *FaultConn) Inject(f Fault) {
+	c.mu.Lock()
+	c.faults = append(c.faults, f)
+	c.mu.Unlock()
+}
+
+// Calls reports the number of calls of Read and Write made so far.
+func (c *FaultConn) Calls() (reads, writes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads, c.writes
+}
+
+// next counts a call of op and returns the fault that applies to it,
+// if any. When several faults apply, the one scheduled first wins.
+func (c *FaultConn) next(op FaultOp) (Fault, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var call int
+	switch op {
+	case FaultRead:
+		c.reads++
+		call = c.reads
+	case FaultWrite:
+		c.writes++
+		call = c.writes
+	}
+	for _, f := range c.faults {
+		if f.Op != op {
+			continue
+		}
+		if f.Call == call || f.Persist && f.Call <= call {
+			return f, true
+		}
+	}
+	return Fault{}, false
+}
+
+func (c *FaultConn) opError(op FaultOp, err error) error {
+	return &net.OpError{
+		Op:     op.String(),
+		Net:    c.LocalAddr().Network(),
+		Source: c.LocalAddr(),
+		Addr:   c.RemoteAddr(),
+		Err:    err,
+	}
+}
+
+// Read reads data from the underlying connection, subject to any
+// fault scheduled for the call.
+func (c *FaultConn) Read(b []byte) (int, error) {
+	f, ok := c.next(FaultRead)
+	if !ok {
+		return c.Conn.Read(b)
+	}
+	if f.Short <= 0 {
+		if f.Err == nil {
+			return c.Conn.Read(b)
+		}
+		return 0, c.opError(FaultRead, f.Err)
+	}
+	if len(b) > f.Short {
+		b = b[:f.Short]
+	}
+	n, err := c.Conn.Read(b)
+	if err == nil && f.Err != nil {
+		err = c.opError(FaultRead, f.Err)
+	}
+	return n, err
+}
+
+// Write writes data to the underlying connection, subject to any
+// fault scheduled for the call.
+func (c *FaultConn) Write(b []byte) (int, error) {
+	f, ok := c.next(FaultWrite)
+	if !ok {
+		return c.Conn.Write(b)
+	}
+	if f.Short <= 0 {
+		if f.Err == nil {
+			return c.Conn.Write(b)
+		}
+		return 0, c.opError(FaultWrite, f.Err)
+	}
+	short := len(b) > f.Short
+	if short {
+		b = b[:f.Short]
+	}
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		return n, err
+	}
+	switch {
+	case f.Err != nil:
+		err = c.opError(FaultWrite, f.Err)
+	case short:
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
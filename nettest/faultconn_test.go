@@ -0,0 +1,98 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestFaultConnPassthrough(t *testing.T) {
+	TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+		p1, p2 := NewPipe(PipeConfig{})
+		c1, c2 = NewFaultConn(p1), NewFaultConn(p2)
+		stop = func() {
+			c1.Close()
+			c2.Close()
+		}
+		return c1, c2, stop, nil
+	})
+}
+
+func TestFaultConnShortWrite(t *testing.T) {
+	p1, p2 := NewPipe(PipeConfig{})
+	defer p1.Close()
+	defer p2.Close()
+	c := NewFaultConn(p1, Fault{Op: FaultWrite, Call: 2, Short: 3})
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("first Write: %v", err)
+	}
+	n, err := c.Write([]byte("world"))
+	if n != 3 || err != io.ErrShortWrite {
+		t.Fatalf("second Write = %d, %v; want 3, %v", n, err, io.ErrShortWrite)
+	}
+	if _, err := c.Write([]byte("!")); err != nil {
+		t.Fatalf("third Write: %v", err)
+	}
+	p1.Close()
+	got, err := io.ReadAll(p2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hellowor!" {
+		t.Errorf("got %q; want %q", got, "hellowor!")
+	}
+}
+
+func TestFaultConnPartialRead(t *testing.T) {
+	p1, p2 := NewPipe(PipeConfig{})
+	defer p1.Close()
+	defer p2.Close()
+	c := NewFaultConn(p2, Fault{Op: FaultRead, Call: 1, Short: 2})
+
+	if _, err := p1.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	n, err := c.Read(buf)
+	if n != 2 || err != nil {
+		t.Fatalf("first Read = %d, %v; want 2, <nil>", n, err)
+	}
+	n, err = c.Read(buf)
+	if string(buf[:n]) != "llo" || err != nil {
+		t.Fatalf("second Read = %q, %v; want %q, <nil>", buf[:n], err, "llo")
+	}
+}
+
+func TestFaultConnInjectedErrors(t *testing.T) {
+	errReset := errors.New("connection reset by peer")
+	p1, p2 := NewPipe(PipeConfig{})
+	defer p1.Close()
+	defer p2.Close()
+	c := NewFaultConn(p1,
+		Fault{Op: FaultRead, Call: 1, Err: os.ErrDeadlineExceeded},
+		Fault{Op: FaultWrite, Call: 2, Err: errReset, Persist: true},
+	)
+
+	_, err := c.Read(make([]byte, 1))
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("Read error = %v; want timeout", err)
+	}
+	if _, err := c.Write([]byte("ok")); err != nil {
+		t.Errorf("first Write: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.Write([]byte("x")); !errors.Is(err, errReset) {
+			t.Errorf("Write #%d error = %v; want %v", i+2, err, errReset)
+		}
+	}
+	if reads, writes := c.Calls(); reads != 1 || writes != 4 {
+		t.Errorf("Calls() = %d, %d; want 1, 4", reads, writes)
+	}
+}
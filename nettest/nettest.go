@@ -25,6 +25,7 @@ var (
 	canListenTCP4OnLoopback bool
 	ipv6Enabled             bool
 	canListenTCP6OnLoopback bool
+	canListenDualStack      bool
 	unStrmDgramEnabled      bool
 	rawSocketSess           bool
 
@@ -50,6 +51,7 @@ func probeStack() {
 		ln.Close()
 		canListenTCP6OnLoopback = true
 	}
+	canListenDualStack = probeDualStack()
 	rawSocketSess = supportsRawSocket()
 	switch runtime.GOOS {
 	case "aix":
@@ -66,6 +68,29 @@ func probeStack() {
 	}
 }
 
+// probeDualStack reports whether an IPv6 socket bound to the
+// unspecified address accepts connections from IPv4 peers.
+func probeDualStack() bool {
+	if !canListenTCP4OnLoopback || !canListenTCP6OnLoopback {
+		return false
+	}
+	ln, err := net.Listen("tcp", "[::]:0")
+	if err != nil {
+		return false
+	}
+	defer ln.Close()
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok || addr.IP.To4() != nil {
+		return false
+	}
+	c, err := net.DialTimeout("tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port)), time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
 func unixStrmDgramEnabled() bool {
 	stackOnce.Do(probeStack)
 	return unStrmDgramEnabled
@@ -85,6 +110,14 @@ func SupportsIPv6() bool {
 	return ipv6Enabled
 }
 
+// SupportsDualStack reports whether the platform supports IPv6
+// sockets that also accept IPv4 traffic through IPv4-mapped IPv6
+// addresses.
+func SupportsDualStack() bool {
+	stackOnce.Do(probeStack)
+	return canListenDualStack
+}
+
 // SupportsRawSocket reports whether the current session is available
 // to use raw sockets.
 func SupportsRawSocket() bool {
@@ -97,6 +130,14 @@ func SupportsRawSocket() bool {
 //
 // See func Dial of the standard library for the supported networks.
 func TestableNetwork(network string) bool {
+	return ProbeNetwork(network) == nil
+}
+
+// ProbeNetwork reports why network is not testable on the current
+// platform configuration. It returns nil if the network is testable.
+//
+// See func Dial of the standard library for the supported networks.
+func ProbeNetwork(network string) error {
 	ss := strings.Split(network, ":")
 	switch ss[0] {
 	case "ip+nopriv":
@@ -104,37 +145,47 @@ func TestableNetwork(network string) bool {
 		// package net of the standard library.
 		switch runtime.GOOS {
 		case "android", "fuchsia", "hurd", "ios", "js", "nacl", "plan9", "wasip1", "windows":
-			return false
+			return unsupportedError(network, "unprivileged raw IP sockets are not available")
 		}
 	case "ip", "ip4", "ip6":
 		switch runtime.GOOS {
 		case "fuchsia", "hurd", "js", "nacl", "plan9", "wasip1":
-			return false
+			return unsupportedError(network, "raw IP sockets are not available")
 		default:
 			if os.Getuid() != 0 {
-				return false
+				return unsupportedError(network, "raw IP sockets require root privileges")
 			}
 		}
 	case "unix", "unixgram":
 		switch runtime.GOOS {
 		case "android", "fuchsia", "hurd", "ios", "js", "nacl", "plan9", "wasip1", "windows":
-			return false
+			return unsupportedError(network, "Unix domain sockets are not available")
 		case "aix":
-			return unixStrmDgramEnabled()
+			if !unixStrmDgramEnabled() {
+				return unsupportedError(network, "Unix domain sockets require AIX 7.2 TL2 or later")
+			}
 		}
 	case "unixpacket":
 		switch runtime.GOOS {
 		case "aix", "android", "fuchsia", "hurd", "darwin", "ios", "js", "nacl", "plan9", "wasip1", "windows", "zos":
-			return false
+			return unsupportedError(network, "SOCK_SEQPACKET Unix domain sockets are not available")
 		}
 	}
 	switch ss[0] {
 	case "tcp4", "udp4", "ip4":
-		return SupportsIPv4()
+		if !SupportsIPv4() {
+			return unsupportedError(network, "no network interface routes IPv4 traffic")
+		}
 	case "tcp6", "udp6", "ip6":
-		return SupportsIPv6()
+		if !SupportsIPv6() {
+			return unsupportedError(network, "no network interface routes IPv6 traffic")
+		}
 	}
-	return true
+	return nil
+}
+
+func unsupportedError(network, reason string) error {
+	return fmt.Errorf("%s is not supported on %s/%s: %s", network, runtime.GOOS, runtime.GOARCH, reason)
 }
 
 // TestableAddress reports whether address of network is testable on
@@ -219,6 +270,149 @@ func NewLocalPacketListener(network string) (net.PacketConn, error) {
 	return nil, fmt.Errorf("%s is not supported on %s/%s", network, runtime.GOOS, runtime.GOARCH)
 }
 
+// An IPMode selects the IP stack used by a listener created with a
+// LocalListenConfig.
+type IPMode int
+
+const (
+	// IPDefault selects the stack as NewLocalListener does.
+	IPDefault IPMode = iota
+
+	// IPv6Only listens to the IPv6 loopback address on a socket
+	// that does not accept IPv4 traffic.
+	IPv6Only
+
+	// DualStack listens to the IPv6 unspecified address on a
+	// socket that also accepts IPv4 traffic. Since only the
+	// unspecified address can be shared by both stacks, the
+	// listener is reachable from other hosts.
+	DualStack
+)
+
+// LocalListenConfig contains options for creating local listeners.
+// The zero value creates the same listeners as NewLocalListener and
+// NewLocalPacketListener.
+type LocalListenConfig struct {
+	// IPMode selects the IP stack used by IP networks.
+	// IPv6Only requires network "tcp", "tcp6", "udp" or "udp6",
+	// and DualStack requires network "tcp" or "udp".
+	IPMode IPMode
+
+	// Abstract requests an address in the Linux abstract socket
+	// namespace, rather than a file system path, for Unix networks.
+	Abstract bool
+}
+
+// Listen returns a listener which listens to a loopback IP address,
+// local file system path or abstract socket address, as configured.
+//
+// The provided network must be "tcp", "tcp4", "tcp6", "unix" or
+// "unixpacket".
+func (lc *LocalListenConfig) Listen(network string) (net.Listener, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		address, err := lc.ipAddress(network)
+		if err != nil {
+			return nil, err
+		}
+		if address == "" {
+			return NewLocalListener(network)
+		}
+		return net.Listen(ipNetwork(network, lc.IPMode), address)
+	case "unix", "unixpacket":
+		if err := ProbeNetwork(network); err != nil {
+			return nil, err
+		}
+		path, err := lc.unixAddress(network)
+		if err != nil {
+			return nil, err
+		}
+		return net.Listen(network, path)
+	}
+	return nil, unsupportedError(network, "not a stream network")
+}
+
+// ListenPacket returns a packet listener which listens to a loopback
+// IP address, local file system path or abstract socket address, as
+// configured.
+//
+// The provided network must be "udp", "udp4", "udp6" or "unixgram".
+func (lc *LocalListenConfig) ListenPacket(network string) (net.PacketConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+		address, err := lc.ipAddress(network)
+		if err != nil {
+			return nil, err
+		}
+		if address == "" {
+			return NewLocalPacketListener(network)
+		}
+		return net.ListenPacket(ipNetwork(network, lc.IPMode), address)
+	case "unixgram":
+		if err := ProbeNetwork(network); err != nil {
+			return nil, err
+		}
+		path, err := lc.unixAddress(network)
+		if err != nil {
+			return nil, err
+		}
+		return net.ListenPacket(network, path)
+	}
+	return nil, unsupportedError(network, "not a packet network")
+}
+
+// ipAddress returns the address to listen to for IP networks, or the
+// empty string if the default behavior applies.
+func (lc *LocalListenConfig) ipAddress(network string) (string, error) {
+	stackOnce.Do(probeStack)
+	switch lc.IPMode {
+	case IPDefault:
+		return "", nil
+	case IPv6Only:
+		if strings.HasSuffix(network, "4") {
+			return "", unsupportedError(network, "IPv6-only mode requires an IPv6 network")
+		}
+		if !canListenTCP6OnLoopback {
+			return "", unsupportedError(network, "cannot listen to the IPv6 loopback address")
+		}
+		return "[::1]:0", nil
+	case DualStack:
+		if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+			return "", unsupportedError(network, "dual-stack mode requires a network of either IP version")
+		}
+		if !canListenDualStack {
+			return "", unsupportedError(network, "IPv4-mapped IPv6 addresses are not available")
+		}
+		return "[::]:0", nil
+	}
+	return "", unsupportedError(network, fmt.Sprintf("unknown IP mode %d", lc.IPMode))
+}
+
+// ipNetwork returns the network to pass to the standard library for
+// mode. The standard library only disables dual-stack operation on
+// IPv6 networks.
+func ipNetwork(network string, mode IPMode) string {
+	if mode == IPv6Only {
+		return network[:3] + "6"
+	}
+	return network
+}
+
+// unixAddress returns the address to listen to for Unix networks.
+func (lc *LocalListenConfig) unixAddress(network string) (string, error) {
+	path, err := LocalPath()
+	if err != nil {
+		return "", err
+	}
+	if lc.Abstract {
+		if runtime.GOOS != "linux" {
+			return "", unsupportedError(network, "abstract socket addresses are a Linux-ism")
+		}
+		return "@" + path, nil
+	}
+	return path, nil
+}
+
 // LocalPath returns a local path that can be used for Unix-domain
 // protocol testing.
 func LocalPath() (string, error) {
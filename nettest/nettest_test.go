@@ -0,0 +1,88 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestProbeNetwork(t *testing.T) {
+	for _, network := range []string{"tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "ip4:icmp", "ip6:ipv6-icmp", "unix", "unixgram", "unixpacket"} {
+		err := ProbeNetwork(network)
+		if (err == nil) != TestableNetwork(network) {
+			t.Errorf("ProbeNetwork(%q) = %v, but TestableNetwork(%q) = %v", network, err, network, TestableNetwork(network))
+		}
+	}
+}
+
+func TestLocalListenConfig(t *testing.T) {
+	t.Run("IPv6Only", func(t *testing.T) {
+		if !SupportsIPv6() {
+			t.Skip("IPv6 is not supported")
+		}
+		lc := LocalListenConfig{IPMode: IPv6Only}
+		ln, err := lc.Listen("tcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		if ip := ln.Addr().(*net.TCPAddr).IP; !ip.Equal(net.IPv6loopback) {
+			t.Errorf("listening to %v; want %v", ip, net.IPv6loopback)
+		}
+		if _, err := lc.ListenPacket("udp4"); err == nil {
+			t.Error("IPv6-only udp4 listener succeeded")
+		}
+	})
+	t.Run("DualStack", func(t *testing.T) {
+		if !SupportsDualStack() {
+			t.Skip("dual-stack sockets are not supported")
+		}
+		lc := LocalListenConfig{IPMode: DualStack}
+		ln, err := lc.Listen("tcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		port := ln.Addr().(*net.TCPAddr).Port
+		for _, addr := range []*net.TCPAddr{{IP: net.IPv4(127, 0, 0, 1), Port: port}, {IP: net.IPv6loopback, Port: port}} {
+			c, err := net.DialTCP("tcp", nil, addr)
+			if err != nil {
+				t.Errorf("dial %v: %v", addr, err)
+				continue
+			}
+			c.Close()
+		}
+		if _, err := lc.Listen("tcp6"); err == nil {
+			t.Error("dual-stack tcp6 listener succeeded")
+		}
+	})
+	t.Run("Abstract", func(t *testing.T) {
+		lc := LocalListenConfig{Abstract: true}
+		if runtime.GOOS != "linux" {
+			if _, err := lc.Listen("unix"); err == nil {
+				t.Errorf("abstract listener succeeded on %s", runtime.GOOS)
+			}
+			return
+		}
+		for _, network := range []string{"unix", "unixpacket"} {
+			ln, err := lc.Listen(network)
+			if err != nil {
+				t.Errorf("%s: %v", network, err)
+				continue
+			}
+			if addr := ln.Addr().String(); addr[0] != '@' {
+				t.Errorf("%s listener address = %q; want abstract address", network, addr)
+			}
+			ln.Close()
+		}
+		c, err := lc.ListenPacket("unixgram")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+	})
+}
@@ -0,0 +1,396 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MakePacketPipe creates two packet-oriented endpoints and returns the
+// pair as c1 and c2, such that a datagram that c1 writes to
+// c2.LocalAddr() is read by c2 and vice-versa.
+// The stop function closes all resources, including c1 and c2, and
+// should not be nil.
+type MakePacketPipe func() (c1, c2 net.PacketConn, stop func(), err error)
+
+// TestPacketConn tests that a net.PacketConn implementation properly
+// satisfies the interface.
+// As with TestConn, the tests should not produce any false positives,
+// but may experience false negatives. The tests tolerate the loss of
+// datagrams when exercising concurrent use, but otherwise expect that
+// datagrams sent between the two endpoints are delivered.
+func TestPacketConn(t *testing.T, mp MakePacketPipe) {
+	t.Run("BasicIO", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketBasicIO) })
+	t.Run("ZeroBytePayload", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketZeroBytePayload) })
+	t.Run("ReadTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketReadTimeout) })
+	t.Run("WriteTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketWriteTimeout) })
+	t.Run("PastTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketPastTimeout) })
+	t.Run("PresentTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketPresentTimeout) })
+	t.Run("FutureTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketFutureTimeout) })
+	t.Run("CloseTimeout", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketCloseTimeout) })
+	t.Run("UseAfterClose", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketUseAfterClose) })
+	t.Run("ConcurrentReadWrite", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketConcurrentReadWrite) })
+	t.Run("ConcurrentMethods", func(t *testing.T) { packetTimeoutWrapper(t, mp, testPacketConcurrentMethods) })
+}
+
+type packetConnTester func(t *testing.T, c1, c2 net.PacketConn)
+
+func packetTimeoutWrapper(t *testing.T, mp MakePacketPipe, f packetConnTester) {
+	t.Helper()
+	c1, c2, stop, err := mp()
+	if err != nil {
+		t.Fatalf("unable to make packet pipe: %v", err)
+	}
+	var once sync.Once
+	defer once.Do(func() { stop() })
+	timer := time.AfterFunc(time.Minute, func() {
+		once.Do(func() {
+			t.Error("test timed out; terminating packet pipe")
+			stop()
+		})
+	})
+	defer timer.Stop()
+	f(t, c1, c2)
+}
+
+// testPacketBasicIO tests that datagrams sent on c1 are received
+// intact on c2 along with the address of c1, and vice-versa.
+func testPacketBasicIO(t *testing.T, c1, c2 net.PacketConn) {
+	for i, want := range [][]byte{[]byte("Hello, world!"), bytes.Repeat([]byte{0x5a}, 1024)} {
+		src, dst := c1, c2
+		if i%2 == 1 {
+			src, dst = c2, c1
+		}
+		if _, err := src.WriteTo(want, dst.LocalAddr()); err != nil {
+			t.Fatalf("unexpected WriteTo error: %v", err)
+		}
+		dst.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 2048)
+		n, addr, err := dst.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("unexpected ReadFrom error: %v", err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("datagram mismatch: got %d bytes, want %d bytes", n, len(want))
+		}
+		if addr == nil || addr.String() != src.LocalAddr().String() {
+			t.Errorf("unexpected source address: got %v, want %v", addr, src.LocalAddr())
+		}
+	}
+}
+
+// testPacketZeroBytePayload tests that an empty datagram is delivered
+// as a zero-length read rather than being dropped or treated as EOF.
+func testPacketZeroBytePayload(t *testing.T, c1, c2 net.PacketConn) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows; zero-byte datagrams are not reliably delivered")
+	}
+	n, err := c1.WriteTo(nil, c2.LocalAddr())
+	if err != nil {
+		t.Fatalf("unexpected WriteTo error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("unexpected WriteTo count: got %d, want 0", n)
+	}
+	if _, err := c1.WriteTo([]byte("next"), c2.LocalAddr()); err != nil {
+		t.Fatalf("unexpected WriteTo error: %v", err)
+	}
+
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err = c2.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("unexpected ReadFrom error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("unexpected ReadFrom count: got %d, want 0", n)
+	}
+	n, _, err = c2.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("unexpected ReadFrom error: %v", err)
+	}
+	if string(buf[:n]) != "next" {
+		t.Errorf("unexpected datagram: got %q, want %q", buf[:n], "next")
+	}
+}
+
+// testPacketReadTimeout tests that ReadFrom timeouts do not affect WriteTo.
+func testPacketReadTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	c1.SetReadDeadline(aLongTimeAgo)
+	_, _, err := c1.ReadFrom(make([]byte, 1024))
+	checkForTimeoutError(t, err)
+	if _, err := c1.WriteTo(make([]byte, 1024), c2.LocalAddr()); err != nil {
+		t.Errorf("unexpected WriteTo error: %v", err)
+	}
+}
+
+// testPacketWriteTimeout tests that WriteTo timeouts do not affect ReadFrom.
+func testPacketWriteTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	c1.SetWriteDeadline(aLongTimeAgo)
+	_, err := c1.WriteTo(make([]byte, 1024), c2.LocalAddr())
+	checkForTimeoutError(t, err)
+
+	if _, err := c2.WriteTo([]byte("ping"), c1.LocalAddr()); err != nil {
+		t.Fatalf("unexpected WriteTo error: %v", err)
+	}
+	c1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := c1.ReadFrom(make([]byte, 1024)); err != nil {
+		t.Errorf("unexpected ReadFrom error: %v", err)
+	}
+}
+
+// testPacketPastTimeout tests that a deadline set in the past
+// immediately times out ReadFrom and WriteTo requests.
+func testPacketPastTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	testPacketRoundtrip(t, c1, c2)
+
+	c1.SetDeadline(aLongTimeAgo)
+	n, err := c1.WriteTo(make([]byte, 1024), c2.LocalAddr())
+	if n != 0 {
+		t.Errorf("unexpected WriteTo count: got %d, want 0", n)
+	}
+	checkForTimeoutError(t, err)
+	n, _, err = c1.ReadFrom(make([]byte, 1024))
+	if n != 0 {
+		t.Errorf("unexpected ReadFrom count: got %d, want 0", n)
+	}
+	checkForTimeoutError(t, err)
+
+	testPacketRoundtrip(t, c1, c2)
+}
+
+// testPacketPresentTimeout tests that a past deadline set while there
+// is a pending ReadFrom operation immediately times out that operation.
+func testPacketPresentTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(2)
+
+	deadlineSet := make(chan bool, 1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(100 * time.Millisecond)
+		deadlineSet <- true
+		c1.SetReadDeadline(aLongTimeAgo)
+	}()
+	go func() {
+		defer wg.Done()
+		n, _, err := c1.ReadFrom(make([]byte, 1024))
+		if n != 0 {
+			t.Errorf("unexpected ReadFrom count: got %d, want 0", n)
+		}
+		checkForTimeoutError(t, err)
+		if len(deadlineSet) == 0 {
+			t.Error("ReadFrom timed out before deadline is set")
+		}
+	}()
+}
+
+// testPacketFutureTimeout tests that a future deadline will eventually
+// time out a ReadFrom operation and that the endpoint remains usable
+// once the deadline is cleared.
+func testPacketFutureTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	c1.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err := c1.ReadFrom(make([]byte, 1024))
+	checkForTimeoutError(t, err)
+
+	testPacketRoundtrip(t, c1, c2)
+}
+
+// testPacketCloseTimeout tests that calling Close immediately unblocks
+// a pending ReadFrom operation.
+func testPacketCloseTimeout(t *testing.T, c1, c2 net.PacketConn) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(2)
+
+	c1.SetDeadline(neverTimeout)
+	go func() {
+		defer wg.Done()
+		time.Sleep(100 * time.Millisecond)
+		c1.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1024)
+		if _, _, err := c1.ReadFrom(buf); err == nil {
+			t.Error("ReadFrom succeeded after Close")
+		}
+	}()
+}
+
+// testPacketUseAfterClose tests that all I/O methods fail once the
+// endpoint is closed.
+func testPacketUseAfterClose(t *testing.T, c1, c2 net.PacketConn) {
+	if err := c1.Close(); err != nil {
+		t.Fatalf("unexpected Close error: %v", err)
+	}
+	if _, _, err := c1.ReadFrom(make([]byte, 1024)); err == nil {
+		t.Error("ReadFrom succeeded after Close")
+	}
+	if _, err := c1.WriteTo(make([]byte, 1024), c2.LocalAddr()); err == nil {
+		t.Error("WriteTo succeeded after Close")
+	}
+	if err := c1.SetDeadline(neverTimeout); err == nil {
+		t.Error("SetDeadline succeeded after Close")
+	}
+}
+
+// testPacketConcurrentReadWrite tests that ReadFrom and WriteTo can be
+// called concurrently from multiple goroutines without interleaving
+// the contents of distinct datagrams.
+func testPacketConcurrentReadWrite(t *testing.T, c1, c2 net.PacketConn) {
+	const (
+		writers = 4
+		packets = 50
+		size    = 256
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			b := make([]byte, size)
+			for j := 0; j < packets; j++ {
+				for k := range b {
+					b[k] = id
+				}
+				binary.BigEndian.PutUint16(b, uint16(j))
+				if _, err := c1.WriteTo(b, c2.LocalAddr()); err != nil {
+					t.Errorf("unexpected WriteTo error: %v", err)
+					return
+				}
+			}
+		}(byte(i + 1))
+	}
+
+	// Datagrams may be dropped under load, so readers stop at the
+	// first timeout rather than waiting for every datagram.
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := make([]byte, 2*size)
+			for {
+				n, _, err := c2.ReadFrom(b)
+				if err != nil {
+					checkForTimeoutError(t, err)
+					return
+				}
+				if n != size {
+					t.Errorf("unexpected datagram size: got %d, want %d", n, size)
+					continue
+				}
+				for _, v := range b[2:n] {
+					if v != b[n-1] {
+						t.Errorf("datagram contents interleaved: %x", b[:n])
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// testPacketConcurrentMethods tests that the methods of net.PacketConn
+// can safely be called concurrently.
+func testPacketConcurrentMethods(t *testing.T, c1, c2 net.PacketConn) {
+	if runtime.GOOS == "plan9" {
+		t.Skip("skipping on plan9; see https://golang.org/issue/20489")
+	}
+
+	// The results of the calls may be nonsensical, but this should
+	// not trigger a race detector warning.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(6)
+		go func() {
+			defer wg.Done()
+			c1.ReadFrom(make([]byte, 1024))
+		}()
+		go func() {
+			defer wg.Done()
+			c1.WriteTo(make([]byte, 1024), c2.LocalAddr())
+		}()
+		go func() {
+			defer wg.Done()
+			c1.SetDeadline(time.Now().Add(10 * time.Millisecond))
+		}()
+		go func() {
+			defer wg.Done()
+			c1.SetReadDeadline(aLongTimeAgo)
+		}()
+		go func() {
+			defer wg.Done()
+			c1.SetWriteDeadline(aLongTimeAgo)
+		}()
+		go func() {
+			defer wg.Done()
+			c1.LocalAddr()
+		}()
+	}
+	wg.Wait() // At worst, the deadline is set 10ms into the future
+
+	drainPacketConn(c1)
+	drainPacketConn(c2)
+	testPacketRoundtrip(t, c1, c2)
+}
+
+// testPacketRoundtrip sends a datagram from c1 to c2, which echoes it
+// back to c1, and checks that the datagram arrives intact.
+func testPacketRoundtrip(t *testing.T, c1, c2 net.PacketConn) {
+	t.Helper()
+	if err := c1.SetDeadline(neverTimeout); err != nil {
+		t.Errorf("roundtrip SetDeadline error: %v", err)
+	}
+	c2.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c2.SetDeadline(neverTimeout)
+
+	const s = "Hello, world!"
+	if _, err := c1.WriteTo([]byte(s), c2.LocalAddr()); err != nil {
+		t.Errorf("roundtrip WriteTo error: %v", err)
+		return
+	}
+	buf := make([]byte, 1024)
+	n, addr, err := c2.ReadFrom(buf)
+	if err != nil {
+		t.Errorf("roundtrip echo ReadFrom error: %v", err)
+		return
+	}
+	if _, err := c2.WriteTo(buf[:n], addr); err != nil {
+		t.Errorf("roundtrip echo WriteTo error: %v", err)
+		return
+	}
+	c1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c1.SetReadDeadline(neverTimeout)
+	n, _, err = c1.ReadFrom(buf)
+	if err != nil {
+		t.Errorf("roundtrip ReadFrom error: %v", err)
+	}
+	if string(buf[:n]) != s {
+		t.Errorf("roundtrip data mismatch: got %q, want %q", buf[:n], s)
+	}
+}
+
+// drainPacketConn discards any datagrams queued on c.
+func drainPacketConn(c net.PacketConn) {
+	buf := make([]byte, 1024)
+	for {
+		c.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, _, err := c.ReadFrom(buf); err != nil {
+			break
+		}
+	}
+	c.SetReadDeadline(neverTimeout)
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestTestPacketConn(t *testing.T) {
+	tests := []struct{ name, network string }{
+		{"UDP", "udp"},
+		{"UnixDatagram", "unixgram"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !TestableNetwork(tt.network) {
+				t.Skipf("%s not supported on %s/%s", tt.network, runtime.GOOS, runtime.GOARCH)
+			}
+
+			mp := func() (c1, c2 net.PacketConn, stop func(), err error) {
+				c1, err = NewLocalPacketListener(tt.network)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				c2, err = NewLocalPacketListener(tt.network)
+				if err != nil {
+					c1.Close()
+					return nil, nil, nil, err
+				}
+
+				stop = func() {
+					c1.Close()
+					c2.Close()
+					if tt.network == "unixgram" {
+						os.Remove(c1.LocalAddr().String())
+						os.Remove(c2.LocalAddr().String())
+					}
+				}
+				return c1, c2, stop, nil
+			}
+
+			TestPacketConn(t, mp)
+		})
+	}
+}
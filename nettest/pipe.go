@@ -0,0 +1,404 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultPipeBufferSize is the per-direction buffer size used when
+// PipeConfig.BufferSize is zero.
+const defaultPipeBufferSize = 64 << 10
+
+// PipeConfig describes the network conditions simulated by a pipe
+// created with NewPipe. The same conditions apply independently to
+// each direction of the pipe. The zero value describes an ideal
+// network with no latency, unlimited bandwidth and no loss.
+type PipeConfig struct {
+	// Latency is the one-way delay added to every segment.
+	Latency time.Duration
+
+	// Jitter is the upper bound of a random delay added to the
+	// latency of each segment. Segments are never reordered; a
+	// segment whose jittered delivery time is earlier than that of
+	// its predecessor is delivered right after the predecessor.
+	Jitter time.Duration
+
+	// Bandwidth is the link capacity in bytes per second.
+	// Zero means unlimited.
+	Bandwidth int
+
+	// MTU is the maximum number of bytes carried by a single
+	// segment. A Write is split into segments of at most MTU bytes
+	// and a Read never returns more than one segment's worth of
+	// data. Zero means unlimited.
+	MTU int
+
+	// Loss is the probability in the range [0, 1] that a segment is
+	// lost in transit. Since a pipe is a reliable stream, a lost
+	// segment is retransmitted, which delays its delivery and that
+	// of all following segments by one round trip (twice Latency).
+	Loss float64
+
+	// BufferSize is the maximum number of bytes that may be in
+	// flight or waiting to be read in each direction. Write blocks
+	// while the buffer is full. Zero means 64 KiB.
+	BufferSize int
+
+	// Seed seeds the random source used for jitter and loss, which
+	// makes the simulated conditions reproducible.
+	Seed int64
+}
+
+// NewPipe creates an in-memory, full duplex network connection much
+// like net.Pipe, except that the data written to one end is subject
+// to the network conditions described by cfg before it can be read
+// from the other end.
+//
+// Unlike net.Pipe, writes are buffered: a Write returns as soon as
+// its data fits in the buffer, which permits testing code that relies
+// on flow control or keepalives against slow or lossy links.
+func NewPipe(cfg PipeConfig) (c1, c2 net.Conn) {
+	l1 := newPipeLink(&cfg, cfg.Seed)
+	l2 := newPipeLink(&cfg, cfg.Seed+1)
+	c1 = newPipeConn(l1, l2)
+	c2 = newPipeConn(l2, l1)
+	return c1, c2
+}
+
+// A pipeSegment is a chunk of data in transit.
+type pipeSegment struct {
+	data []byte
+	at   time.Time // time at which data becomes readable
+}
+
+// A pipeLink simulates one direction of a pipe.
+type pipeLink struct {
+	cfg *PipeConfig
+
+	mu          sync.Mutex
+	rnd         *rand.Rand
+	segs        []pipeSegment
+	buffered    int       // number of bytes in segs
+	txDone      time.Time // time at which the transmitter becomes idle
+	lastArrival time.Time // delivery time of the last queued segment
+	wclosed     bool      // writing end closed; reads return io.EOF once drained
+	rclosed     bool      // reading end closed; writes fail
+	wake        chan struct{}
+}
+
+func newPipeLink(cfg *PipeConfig, seed int64) *pipeLink {
+	return &pipeLink{
+		cfg:  cfg,
+		rnd:  rand.New(rand.NewSource(seed)),
+		wake: make(chan struct{}),
+	}
+}
+
+// broadcast wakes up all waiters. The caller must hold l.mu.
+func (l *pipeLink) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *pipeLink) bufferSize() int {
+	if l.cfg.BufferSize > 0 {
+		return l.cfg.BufferSize
+	}
+	return defaultPipeBufferSize
+}
+
+// read copies readable data into b. If no data is readable yet, it
+// returns the duration until the next segment arrives (or zero if
+// there is none) and a channel that is closed when the state of the
+// link changes.
+func (l *pipeLink) read(b []byte, now time.Time) (n int, wait time.Duration, wake <-chan struct{}, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.segs) == 0 {
+		if l.wclosed {
+			return 0, 0, nil, io.EOF
+		}
+		return 0, 0, l.wake, nil
+	}
+	seg := &l.segs[0]
+	if now.Before(seg.at) {
+		return 0, seg.at.Sub(now), l.wake, nil
+	}
+	n = copy(b, seg.data)
+	seg.data = seg.data[n:]
+	if len(seg.data) == 0 {
+		l.segs[0] = pipeSegment{}
+		l.segs = l.segs[1:]
+	}
+	l.buffered -= n
+	l.broadcast()
+	return n, 0, nil, nil
+}
+
+// write queues as much of b as fits in the buffer, splitting it into
+// segments of at most MTU bytes. If nothing fits, it returns a
+// channel that is closed when the state of the link changes.
+func (l *pipeLink) write(b []byte, now time.Time) (n int, wake <-chan struct{}, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rclosed {
+		return 0, nil, io.ErrClosedPipe
+	}
+	for n < len(b) {
+		avail := l.bufferSize() - l.buffered
+		if avail <= 0 {
+			break
+		}
+		size := len(b) - n
+		if size > avail {
+			size = avail
+		}
+		if l.cfg.MTU > 0 && size > l.cfg.MTU {
+			size = l.cfg.MTU
+		}
+		data := make([]byte, size)
+		copy(data, b[n:])
+		l.segs = append(l.segs, pipeSegment{data: data, at: l.arrival(size, now)})
+		l.buffered += size
+		n += size
+	}
+	if n == 0 {
+		return 0, l.wake, nil
+	}
+	l.broadcast()
+	return n, nil, nil
+}
+
+// arrival computes the delivery time of a segment of size bytes that
+// is handed to the link at now. The caller must hold l.mu.
+func (l *pipeLink) arrival(size int, now time.Time) time.Time {
+	start := l.txDone
+	if start.Before(now) {
+		start = now
+	}
+	if l.cfg.Bandwidth > 0 {
+		start = start.Add(time.Duration(size) * time.Second / time.Duration(l.cfg.Bandwidth))
+	}
+	l.txDone = start
+	at := start.Add(l.cfg.Latency)
+	if l.cfg.Jitter > 0 {
+		at = at.Add(time.Duration(l.rnd.Int63n(int64(l.cfg.Jitter) + 1)))
+	}
+	if l.cfg.Loss > 0 && l.rnd.Float64() < l.cfg.Loss {
+		at = at.Add(2 * l.cfg.Latency)
+	}
+	if at.Before(l.lastArrival) {
+		at = l.lastArrival
+	}
+	l.lastArrival = at
+	return at
+}
+
+func (l *pipeLink) closeRead() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rclosed = true
+	l.segs = nil
+	l.buffered = 0
+	l.broadcast()
+}
+
+func (l *pipeLink) closeWrite() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.wclosed = true
+	l.broadcast()
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+type pipeConn struct {
+	rd, wr *pipeLink
+
+	readDeadline  *pipeDeadline
+	writeDeadline *pipeDeadline
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newPipeConn(rd, wr *pipeLink) *pipeConn {
+	return &pipeConn{
+		rd:            rd,
+		wr:            wr,
+		readDeadline:  newPipeDeadline(),
+		writeDeadline: newPipeDeadline(),
+		done:          make(chan struct{}),
+	}
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return pipeAddr{} }
+func (c *pipeConn) RemoteAddr() net.Addr { return pipeAddr{} }
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	for {
+		switch {
+		case isClosedChan(c.done):
+			return 0, io.ErrClosedPipe
+		case isClosedChan(c.readDeadline.wait()):
+			return 0, os.ErrDeadlineExceeded
+		}
+		n, wait, wake, err := c.rd.read(b, time.Now())
+		if n > 0 || err != nil || len(b) == 0 {
+			return n, err
+		}
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-wake:
+		case <-timeout:
+		case <-c.done:
+		case <-c.readDeadline.wait():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	var n int
+	for {
+		switch {
+		case isClosedChan(c.done):
+			return n, io.ErrClosedPipe
+		case isClosedChan(c.writeDeadline.wait()):
+			return n, os.ErrDeadlineExceeded
+		}
+		m, wake, err := c.wr.write(b[n:], time.Now())
+		n += m
+		if err != nil || n == len(b) {
+			return n, err
+		}
+		if m > 0 {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-c.done:
+		case <-c.writeDeadline.wait():
+		}
+	}
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	if isClosedChan(c.done) {
+		return io.ErrClosedPipe
+	}
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	if isClosedChan(c.done) {
+		return io.ErrClosedPipe
+	}
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	if isClosedChan(c.done) {
+		return io.ErrClosedPipe
+	}
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *pipeConn) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+		c.rd.closeRead()
+		c.wr.closeWrite()
+	})
+	return nil
+}
+
+// pipeDeadline is an abstraction for handling timeouts.
+type pipeDeadline struct {
+	mu     sync.Mutex // Guards timer and cancel
+	timer  *time.Timer
+	cancel chan struct{} // Must be non-nil
+}
+
+func newPipeDeadline() *pipeDeadline {
+	return &pipeDeadline{cancel: make(chan struct{})}
+}
+
+// set sets the point in time when the deadline will time out.
+// A timeout event is signaled by closing the channel returned by wait.
+// Once a timeout has occurred, the deadline can be refreshed by specifying a
+// t value in the future.
+//
+// A zero value for t prevents timeout.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // Wait for the timer callback to finish and close cancel
+	}
+	d.timer = nil
+
+	// Time is zero, then there is no deadline.
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	// Time in the future, setup a timer to cancel in the future.
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		d.timer = time.AfterFunc(dur, func() {
+			close(d.cancel)
+		})
+		return
+	}
+
+	// Time in the past, so close immediately.
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel that is closed when the deadline is exceeded.
+func (d *pipeDeadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nettest
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPipeConn(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  PipeConfig
+	}{
+		{"Ideal", PipeConfig{}},
+		{"Latency", PipeConfig{Latency: time.Millisecond, Jitter: time.Millisecond}},
+		{"MTU", PipeConfig{MTU: 1024, BufferSize: 4096}},
+		{"Lossy", PipeConfig{Latency: 100 * time.Microsecond, Loss: 0.1, Seed: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TestConn(t, func() (c1, c2 net.Conn, stop func(), err error) {
+				c1, c2 = NewPipe(tt.cfg)
+				stop = func() {
+					c1.Close()
+					c2.Close()
+				}
+				return c1, c2, stop, nil
+			})
+		})
+	}
+}
+
+func TestPipeLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	c1, c2 := NewPipe(PipeConfig{Latency: latency})
+	defer c1.Close()
+	defer c2.Close()
+
+	start := time.Now()
+	if _, err := c1.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= latency {
+		t.Errorf("Write blocked for %v; want less than %v", d, latency)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < latency {
+		t.Errorf("data arrived after %v; want at least %v", d, latency)
+	}
+}
+
+func TestPipeBandwidth(t *testing.T) {
+	const (
+		bandwidth = 100 << 10
+		size      = 10 << 10
+	)
+	c1, c2 := NewPipe(PipeConfig{Bandwidth: bandwidth})
+	defer c1.Close()
+	defer c2.Close()
+
+	start := time.Now()
+	go c1.Write(make([]byte, size))
+	if _, err := io.ReadFull(c2, make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if d, want := time.Since(start), time.Duration(size)*time.Second/bandwidth; d < want {
+		t.Errorf("transfer took %v; want at least %v", d, want)
+	}
+}
+
+func TestPipeMTU(t *testing.T) {
+	const mtu = 100
+	c1, c2 := NewPipe(PipeConfig{MTU: mtu})
+	defer c1.Close()
+	defer c2.Close()
+
+	want := bytes.Repeat([]byte("0123456789"), 25)
+	if _, err := c1.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	c1.Close()
+	var got []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := c2.Read(buf)
+		if n > mtu {
+			t.Errorf("Read returned %d bytes; want at most %d", n, mtu)
+		}
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// A ListenerGroup coordinates the shutdown of several listeners, and of
+// the connections accepted from them: Shutdown stops accepting on all
+// the listeners, asks the peers to drain their connections, waits for
+// them to be closed, and closes those still open when its context is
+// done.
+//
+// The zero value is an empty group ready to use.
+type ListenerGroup struct {
+	// Drain, if non-nil, is called by Shutdown for each connection
+	// still open after the listeners are closed, to send it a
+	// protocol-specific drain signal, such as an HTTP/2 GOAWAY frame
+	// or a close message telling the peer to finish its requests and
+	// hang up. Drain must not block for long, as the connections are
+	// drained in turn.
+	Drain func(net.Conn)
+
+	mu        sync.Mutex
+	listeners map[*groupListener]struct{}
+	conns     map[*groupConn]struct{}
+	shutdown  bool
+	idle      chan struct{} // closed when no connection is open after shutdown
+}
+
+// Add returns a Listener which accepts the connections of l, tracked by
+// g until they are closed. If g is already shut down, l is closed.
+func (g *ListenerGroup) Add(l net.Listener) net.Listener {
+	gl := &groupListener{Listener: l, g: g}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.shutdown {
+		l.Close()
+		return gl
+	}
+	if g.listeners == nil {
+		g.listeners = make(map[*groupListener]struct{})
+	}
+	g.listeners[gl] = struct{}{}
+	return gl
+}
+
+// Len returns the number of connections of g which are open.
+func (g *ListenerGroup) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.conns)
+}
+
+// Shutdown gracefully shuts down the listeners of g: it closes them,
+// calls Drain for each of the connections still open, and waits until
+// they are closed, or ctx is done. In the latter case, it closes the
+// connections still open and returns the error of ctx. Otherwise, it
+// returns the first error of closing the listeners.
+func (g *ListenerGroup) Shutdown(ctx context.Context) error {
+	conns, err := g.closeListeners()
+	if g.Drain != nil {
+		for _, c := range conns {
+			g.Drain(c)
+		}
+	}
+	select {
+	case <-g.idle:
+		return err
+	case <-ctx.Done():
+		g.closeConns()
+		return ctx.Err()
+	}
+}
+
+// Close closes the listeners of g and the connections accepted from
+// them, without draining them. It returns the first error of closing
+// the listeners.
+func (g *ListenerGroup) Close() error {
+	_, err := g.closeListeners()
+	g.closeConns()
+	return err
+}
+
+// closeListeners stops the group from accepting connections, and returns
+// the connections still open and the first error of closing its
+// listeners.
+func (g *ListenerGroup) closeListeners() ([]net.Conn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.shutdown {
+		g.shutdown = true
+		g.idle = make(chan struct{})
+		if len(g.conns) == 0 {
+			close(g.idle)
+		}
+	}
+	var err error
+	for l := range g.listeners {
+		if cerr := l.Listener.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(g.listeners, l)
+	}
+	conns := make([]net.Conn, 0, len(g.conns))
+	for c := range g.conns {
+		conns = append(conns, c)
+	}
+	return conns, err
+}
+
+func (g *ListenerGroup) closeConns() {
+	g.mu.Lock()
+	conns := make([]*groupConn, 0, len(g.conns))
+	for c := range g.conns {
+		conns = append(conns, c)
+	}
+	g.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// track adds c to the connections of g, unless g is shut down.
+func (g *ListenerGroup) track(c *groupConn) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.shutdown {
+		return false
+	}
+	if g.conns == nil {
+		g.conns = make(map[*groupConn]struct{})
+	}
+	g.conns[c] = struct{}{}
+	return true
+}
+
+func (g *ListenerGroup) forget(c *groupConn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.conns, c)
+	if g.shutdown && len(g.conns) == 0 {
+		select {
+		case <-g.idle:
+		default:
+			close(g.idle)
+		}
+	}
+}
+
+type groupListener struct {
+	net.Listener
+	g *ListenerGroup
+}
+
+func (l *groupListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	gc := &groupConn{Conn: c, g: l.g}
+	if !l.g.track(gc) {
+		// The group was shut down while accepting c.
+		c.Close()
+		return nil, net.ErrClosed
+	}
+	return gc, nil
+}
+
+// Close closes l, which leaves its group.
+func (l *groupListener) Close() error {
+	l.g.mu.Lock()
+	delete(l.g.listeners, l)
+	l.g.mu.Unlock()
+	return l.Listener.Close()
+}
+
+type groupConn struct {
+	net.Conn
+	g         *ListenerGroup
+	closeOnce sync.Once
+}
+
+func (c *groupConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { c.g.forget(c) })
+	return err
+}
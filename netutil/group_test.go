@@ -0,0 +1,121 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// groupTestConns returns n connections accepted from the listeners ls,
+// in turn, and closes their client ends when the test ends.
+func groupTestConns(t *testing.T, ls []net.Listener, n int) []net.Conn {
+	var conns []net.Conn
+	for i := 0; i < n; i++ {
+		l := ls[i%len(ls)]
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func newGroupTestListeners(t *testing.T, g *ListenerGroup, n int) []net.Listener {
+	var ls []net.Listener
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, g.Add(l))
+	}
+	return ls
+}
+
+func TestListenerGroupShutdown(t *testing.T) {
+	var g ListenerGroup
+	drained := make(chan net.Conn, 4)
+	g.Drain = func(c net.Conn) {
+		io.WriteString(c, "bye\n")
+		drained <- c
+	}
+	ls := newGroupTestListeners(t, &g, 2)
+	conns := groupTestConns(t, ls, 4)
+	if n := g.Len(); n != 4 {
+		t.Fatalf("Len() = %d; want 4", n)
+	}
+
+	// Close the connections once they are drained.
+	go func() {
+		for range conns {
+			(<-drained).Close()
+		}
+	}()
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if n := g.Len(); n != 0 {
+		t.Errorf("Len() = %d after Shutdown; want 0", n)
+	}
+	for _, l := range ls {
+		if _, err := l.Accept(); err == nil {
+			t.Errorf("Accept on %v succeeded after Shutdown", l.Addr())
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Add(l).Accept(); err == nil {
+		t.Error("Accept on a listener added after Shutdown succeeded")
+	}
+}
+
+func TestListenerGroupShutdownDeadline(t *testing.T) {
+	var g ListenerGroup
+	ls := newGroupTestListeners(t, &g, 1)
+	conns := groupTestConns(t, ls, 2)
+	conns[0].Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if n := g.Len(); n != 0 {
+		t.Errorf("Len() = %d after Shutdown; want 0", n)
+	}
+	if _, err := conns[1].Write([]byte("x")); err == nil {
+		t.Error("Write on a connection closed by Shutdown succeeded")
+	}
+}
+
+func TestListenerGroupClose(t *testing.T) {
+	var g ListenerGroup
+	ls := newGroupTestListeners(t, &g, 2)
+	// A listener closed on its own leaves the group.
+	if err := ls[1].Close(); err != nil {
+		t.Fatal(err)
+	}
+	groupTestConns(t, ls[:1], 1)
+	if err := g.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := g.Len(); n != 0 {
+		t.Errorf("Len() = %d after Close; want 0", n)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// LimitTLSListener returns a Listener that accepts at most n simultaneous
+// connections from the provided Listener, and serves them with TLS with
+// config, as tls.NewListener does, but performs their handshakes itself:
+// at most handshakes of them at a time, each of which fails once timeout,
+// if positive, has elapsed. As handshakes are costly, a flood of them
+// could exhaust the CPU long before n connections are open.
+//
+// While handshakes are in progress, no more connections are accepted,
+// leaving them in the backlog of the provided Listener. The connections
+// returned by Accept are *tls.Conn whose handshakes completed, which an
+// http.Server serves with Serve, not ServeTLS. The connections whose
+// handshakes failed are closed without being returned.
+func LimitTLSListener(l net.Listener, config *tls.Config, n, handshakes int, timeout time.Duration) net.Listener {
+	if handshakes > n {
+		handshakes = n
+	}
+	if handshakes < 1 {
+		handshakes = 1
+	}
+	return &tlsLimitListener{
+		limitListener: limitListener{
+			Listener: l,
+			sem:      make(chan struct{}, n),
+			done:     make(chan struct{}),
+		},
+		config:     config,
+		timeout:    timeout,
+		handshakes: make(chan struct{}, handshakes),
+		conns:      make(chan net.Conn),
+		errs:       make(chan error),
+	}
+}
+
+type tlsLimitListener struct {
+	limitListener
+	config     *tls.Config
+	timeout    time.Duration
+	handshakes chan struct{} // semaphore of the handshakes in progress
+	startOnce  sync.Once     // starts accept on the first call to Accept
+	conns      chan net.Conn // handshaken connections
+	errs       chan error    // errors of the provided Listener
+}
+
+func (l *tlsLimitListener) Accept() (net.Conn, error) {
+	l.startOnce.Do(func() { go l.accept() })
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// accept accepts the connections of the provided Listener until l is
+// closed, and starts their handshakes.
+func (l *tlsLimitListener) accept() {
+	for {
+		if !l.acquire() {
+			return
+		}
+		select {
+		case l.handshakes <- struct{}{}:
+		case <-l.done:
+			l.release()
+			return
+		}
+		c, err := l.Listener.Accept()
+		if err != nil {
+			<-l.handshakes
+			l.release()
+			select {
+			case l.errs <- err:
+				continue
+			case <-l.done:
+				return
+			}
+		}
+		go l.handshake(&limitListenerConn{Conn: c, release: l.release})
+	}
+}
+
+func (l *tlsLimitListener) handshake(c net.Conn) {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if l.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), l.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	stop := make(chan struct{})
+	go func() {
+		// Abort the handshake once l is closed.
+		select {
+		case <-l.done:
+			cancel()
+		case <-stop:
+		}
+	}()
+	tc := tls.Server(c, l.config)
+	err := tc.HandshakeContext(ctx)
+	close(stop)
+	cancel()
+	<-l.handshakes
+	if err != nil {
+		tc.Close()
+		return
+	}
+	select {
+	case l.conns <- tc:
+	case <-l.done:
+		tc.Close()
+	}
+}
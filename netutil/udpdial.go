@@ -0,0 +1,332 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAttemptDelay is the delay between the attempts of a UDPDialer
+// without AttemptDelay, the Connection Attempt Delay recommended by
+// RFC 8305, Section 5.
+const DefaultAttemptDelay = 250 * time.Millisecond
+
+var errNoAddresses = errors.New("netutil: no suitable address")
+
+var testHookLookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+// InterleaveAddrs returns the addresses ordered for connection attempts
+// as RFC 8305, Section 4 specifies: alternating between IPv6 and IPv4,
+// starting with the family of the first address, and otherwise keeping
+// the order of addrs, such as that of RFC 6724 returned by a Resolver.
+func InterleaveAddrs(addrs []net.IPAddr) []net.IPAddr {
+	if len(addrs) == 0 {
+		return nil
+	}
+	var first, other []net.IPAddr
+	v4 := addrs[0].IP.To4() != nil
+	for _, a := range addrs {
+		if (a.IP.To4() != nil) == v4 {
+			first = append(first, a)
+		} else {
+			other = append(other, a)
+		}
+	}
+	res := make([]net.IPAddr, 0, len(addrs))
+	for i := 0; i < len(first) || i < len(other); i++ {
+		if i < len(first) {
+			res = append(res, first[i])
+		}
+		if i < len(other) {
+			res = append(res, other[i])
+		}
+	}
+	return res
+}
+
+// A UDPDialer dials "connected" UDP sockets to the addresses of a host,
+// racing them in the manner RFC 8305 specifies for TCP: the attempts
+// start in the order of InterleaveAddrs, one every AttemptDelay or as
+// soon as the previous one fails, and the first socket whose
+// destination proves reachable wins, the others being closed.
+//
+// As UDP has no handshake, the reachability of a destination is that
+// of the protocol used over it, checked by Probe.
+//
+// The zero value is a UDPDialer using the default resolver, whose
+// sockets win once connected.
+type UDPDialer struct {
+	// Resolver optionally resolves the host names.
+	Resolver *net.Resolver
+
+	// LocalAddr optionally is the local address of the sockets.
+	LocalAddr *net.UDPAddr
+
+	// AttemptDelay is the delay before starting the next attempt while
+	// one is under way. If zero, DefaultAttemptDelay is used.
+	AttemptDelay time.Duration
+
+	// Setup, if non-nil, is called with each socket dialed and its
+	// network, "udp4" or "udp6", before it is probed, for instance to
+	// set its options with the ipv4 or ipv6 packages.
+	Setup func(network string, c *net.UDPConn) error
+
+	// Probe, if non-nil, checks the reachability of the destination of
+	// c, typically by sending a request of the protocol and waiting for
+	// a response. It must return once ctx is done, which happens when
+	// another socket wins. If Probe is nil, a socket wins once connected,
+	// which only fails without a route to the destination.
+	Probe func(ctx context.Context, c *net.UDPConn) error
+}
+
+type udpDialResult struct {
+	c   *net.UDPConn
+	err error
+}
+
+// DialContext dials a connected UDP socket to address on network, "udp",
+// "udp4" or "udp6", racing the addresses of its host.
+func (d *UDPDialer) DialContext(ctx context.Context, network, address string) (*net.UDPConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+	addrs, port, err := d.resolve(ctx, network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan udpDialResult, len(addrs))
+	delay := d.AttemptDelay
+	if delay <= 0 {
+		delay = DefaultAttemptDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	if !timer.Stop() {
+		<-timer.C
+	}
+	timerOn := false
+
+	var firstErr error
+	next, pending := 0, 0
+	for {
+		if next < len(addrs) && !timerOn {
+			raddr := &net.UDPAddr{IP: addrs[next].IP, Port: port, Zone: addrs[next].Zone}
+			next++
+			pending++
+			go func() {
+				c, err := d.attempt(ctx, raddr)
+				results <- udpDialResult{c, err}
+			}()
+			if next < len(addrs) {
+				timer.Reset(delay)
+				timerOn = true
+			}
+		}
+		if pending == 0 {
+			return nil, firstErr
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				go closeUDPResults(results, pending)
+				return r.c, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if timerOn && !timer.Stop() {
+				<-timer.C
+			}
+			timerOn = false
+		case <-timer.C:
+			timerOn = false
+		case <-ctx.Done():
+			go closeUDPResults(results, pending)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	}
+}
+
+// closeUDPResults closes the sockets of the n attempts left, which lost
+// the race.
+func closeUDPResults(results <-chan udpDialResult, n int) {
+	for ; n > 0; n-- {
+		if r := <-results; r.c != nil {
+			r.c.Close()
+		}
+	}
+}
+
+// resolve returns the addresses to dial for address on network, in the
+// order of the attempts, and the port.
+func (d *UDPDialer) resolve(ctx context.Context, network, address string) ([]net.IPAddr, int, error) {
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	r := d.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	port, err := strconv.Atoi(service)
+	if err != nil {
+		if port, err = r.LookupPort(ctx, "udp", service); err != nil {
+			return nil, 0, err
+		}
+	}
+	lookup := r.LookupIPAddr
+	if testHookLookupIPAddr != nil {
+		lookup = testHookLookupIPAddr
+	}
+	var addrs []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		addrs = []net.IPAddr{{IP: ip}}
+	} else if addrs, err = lookup(ctx, host); err != nil {
+		return nil, 0, err
+	}
+	var res []net.IPAddr
+	for _, a := range addrs {
+		if v4 := a.IP.To4() != nil; network == "udp" || v4 == (network == "udp4") {
+			res = append(res, a)
+		}
+	}
+	if len(res) == 0 {
+		return nil, 0, &net.AddrError{Err: errNoAddresses.Error(), Addr: host}
+	}
+	return InterleaveAddrs(res), port, nil
+}
+
+// attempt dials, sets up and probes a socket to raddr.
+func (d *UDPDialer) attempt(ctx context.Context, raddr *net.UDPAddr) (*net.UDPConn, error) {
+	network := "udp6"
+	if raddr.IP.To4() != nil {
+		network = "udp4"
+	}
+	var nd net.Dialer
+	if d.LocalAddr != nil {
+		nd.LocalAddr = d.LocalAddr
+	}
+	c, err := nd.DialContext(ctx, network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	uc := c.(*net.UDPConn)
+	if d.Setup != nil {
+		if err := d.Setup(network, uc); err != nil {
+			uc.Close()
+			return nil, err
+		}
+	}
+	if d.Probe != nil {
+		if err := d.Probe(ctx, uc); err != nil {
+			uc.Close()
+			return nil, err
+		}
+	}
+	return uc, nil
+}
+
+// UDPConns manages the connected UDP sockets of a client talking to
+// several destinations, dialing one socket per destination with Dialer
+// and reusing it until it is forgotten.
+//
+// The zero value is ready to use with a zero UDPDialer.
+type UDPConns struct {
+	// Dialer optionally dials the sockets.
+	Dialer *UDPDialer
+
+	mu    sync.Mutex
+	conns map[string]*udpConnEntry
+}
+
+type udpConnEntry struct {
+	done chan struct{} // closed once dialed
+	c    *net.UDPConn
+	err  error
+}
+
+// Get returns the socket to address on network, dialing it if needed.
+// Concurrent calls for the same destination share a dial, whose
+// failure is not retained.
+func (s *UDPConns) Get(ctx context.Context, network, address string) (*net.UDPConn, error) {
+	key := network + " " + address
+	s.mu.Lock()
+	e, ok := s.conns[key]
+	if !ok {
+		if s.conns == nil {
+			s.conns = make(map[string]*udpConnEntry)
+		}
+		e = &udpConnEntry{done: make(chan struct{})}
+		s.conns[key] = e
+		s.mu.Unlock()
+		d := s.Dialer
+		if d == nil {
+			d = &UDPDialer{}
+		}
+		e.c, e.err = d.DialContext(ctx, network, address)
+		close(e.done)
+		if e.err != nil {
+			s.mu.Lock()
+			if s.conns[key] == e {
+				delete(s.conns, key)
+			}
+			s.mu.Unlock()
+		}
+		return e.c, e.err
+	}
+	s.mu.Unlock()
+	select {
+	case <-e.done:
+		return e.c, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Forget closes and forgets the socket to address on network, if any,
+// for instance once its destination stops responding, so that the next
+// Get dials again.
+func (s *UDPConns) Forget(network, address string) {
+	key := network + " " + address
+	s.mu.Lock()
+	e := s.conns[key]
+	delete(s.conns, key)
+	s.mu.Unlock()
+	if e != nil {
+		go func() {
+			<-e.done
+			if e.c != nil {
+				e.c.Close()
+			}
+		}()
+	}
+}
+
+// Close closes and forgets all the sockets.
+func (s *UDPConns) Close() error {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, e := range conns {
+		<-e.done
+		if e.c != nil {
+			e.c.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInterleaveAddrs(t *testing.T) {
+	addrs := func(ips ...string) []net.IPAddr {
+		var res []net.IPAddr
+		for _, ip := range ips {
+			res = append(res, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return res
+	}
+	tests := []struct {
+		in, want []net.IPAddr
+	}{
+		{nil, nil},
+		{addrs("::1", "::2", "10.0.0.1", "10.0.0.2", "10.0.0.3"), addrs("::1", "10.0.0.1", "::2", "10.0.0.2", "10.0.0.3")},
+		{addrs("10.0.0.1", "10.0.0.2", "::1"), addrs("10.0.0.1", "::1", "10.0.0.2")},
+		{addrs("::1", "::2"), addrs("::1", "::2")},
+	}
+	for _, tt := range tests {
+		got := InterleaveAddrs(tt.in)
+		if len(got) != len(tt.want) {
+			t.Errorf("InterleaveAddrs(%v) = %v; want %v", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].IP.Equal(tt.want[i].IP) {
+				t.Errorf("InterleaveAddrs(%v) = %v; want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// udpEchoServer listens on ip and answers the datagrams it receives if
+// answer, until the test ends, and returns its port.
+func udpEchoServer(t *testing.T, ip string, port int, answer bool) int {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP(ip), Port: port})
+	if err != nil {
+		t.Skipf("listening on %s: %v", ip, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	go func() {
+		b := make([]byte, 64)
+		for {
+			n, addr, err := c.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			if answer {
+				c.WriteTo(b[:n], addr)
+			}
+		}
+	}()
+	return c.LocalAddr().(*net.UDPAddr).Port
+}
+
+// echoProbe probes a destination with a datagram, which must be echoed.
+func echoProbe(ctx context.Context, c *net.UDPConn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetReadDeadline(deadline)
+	}
+	go func() {
+		<-ctx.Done()
+		c.SetReadDeadline(time.Now())
+	}()
+	if _, err := c.Write([]byte("probe")); err != nil {
+		return err
+	}
+	b := make([]byte, 64)
+	_, err := c.Read(b)
+	return err
+}
+
+func TestUDPDialer(t *testing.T) {
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.2")}, {IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	testHookLookupIPAddr = lookup
+	defer func() { testHookLookupIPAddr = nil }()
+
+	t.Run("refused", func(t *testing.T) {
+		// The first address refuses the probe, which starts the next
+		// attempt before AttemptDelay.
+		port := udpEchoServer(t, "127.0.0.1", 0, true)
+		var setups int32
+		d := &UDPDialer{
+			AttemptDelay: time.Minute,
+			Probe:        echoProbe,
+			Setup: func(network string, c *net.UDPConn) error {
+				if network != "udp4" {
+					t.Errorf("Setup network %q; want udp4", network)
+				}
+				atomic.AddInt32(&setups, 1)
+				return nil
+			},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		c, err := d.DialContext(ctx, "udp", net.JoinHostPort("example.com", strconv.Itoa(port)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if got := c.RemoteAddr().(*net.UDPAddr).IP.String(); got != "127.0.0.1" {
+			t.Errorf("dialed %s; want 127.0.0.1", got)
+		}
+		if n := atomic.LoadInt32(&setups); n != 2 {
+			t.Errorf("Setup called %d times; want 2", n)
+		}
+	})
+
+	t.Run("silent", func(t *testing.T) {
+		// The first address does not answer, and loses once the next
+		// attempt answers.
+		port := udpEchoServer(t, "127.0.0.1", 0, true)
+		udpEchoServer(t, "127.0.0.2", port, false)
+		d := &UDPDialer{AttemptDelay: 10 * time.Millisecond, Probe: echoProbe}
+		c, err := d.DialContext(context.Background(), "udp4", net.JoinHostPort("example.com", strconv.Itoa(port)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if got := c.RemoteAddr().(*net.UDPAddr).IP.String(); got != "127.0.0.1" {
+			t.Errorf("dialed %s; want 127.0.0.1", got)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		d := &UDPDialer{Probe: echoProbe}
+		if _, err := d.DialContext(context.Background(), "udp6", "example.com:53"); err == nil {
+			t.Error("dialing a host without IPv6 addresses succeeded")
+		}
+		if _, err := d.DialContext(context.Background(), "tcp", "example.com:53"); err == nil {
+			t.Error("dialing TCP succeeded")
+		}
+	})
+}
+
+func TestUDPConns(t *testing.T) {
+	port := udpEchoServer(t, "127.0.0.1", 0, true)
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	var s UDPConns
+	defer s.Close()
+	ctx := context.Background()
+	c1, err := s.Get(ctx, "udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := s.Get(ctx, "udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Error("Get dialed a second socket to the same destination")
+	}
+	s.Forget("udp", addr)
+	c3, err := s.Get(ctx, "udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c1 {
+		t.Error("Get returned a forgotten socket")
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// A MultiDialer dials through one of several proxies, failing over to the
+// next when a dial fails. A proxy whose dials or health probes fail is
+// unhealthy: it is only tried after the healthy ones, and after the others
+// until its backoff, doubling with each consecutive failure, expires. A
+// success makes it healthy again.
+//
+// Any failure of a dial other than the cancellation of its context counts
+// against the proxy, including the failure of the proxy to reach the
+// address, which may succeed through another.
+type MultiDialer struct {
+	// Balance spreads the dials across the healthy proxies in turn. If
+	// false, the dials go through the first healthy proxy, in the order
+	// given to NewMultiDialer, the others being fallbacks.
+	Balance bool
+
+	// MinBackoff and MaxBackoff are the backoff of a proxy after its
+	// first failure and its limit, which is at least MinBackoff. If zero,
+	// one second and one minute are used.
+	MinBackoff, MaxBackoff time.Duration
+
+	// Probe optionally checks the health of proxy, for CheckHealth. If
+	// nil, a TCP connection to the proxy is established and closed.
+	Probe func(ctx context.Context, proxy *url.URL) error
+
+	forward   Dialer
+	endpoints []*proxyEndpoint
+
+	mu   sync.Mutex
+	next int // index of the first endpoint tried by the next balanced dial
+}
+
+// A proxyEndpoint is a proxy of a MultiDialer and its health, guarded by
+// the mutex of the MultiDialer.
+type proxyEndpoint struct {
+	u *url.URL
+	d Dialer
+
+	failures int
+	err      error
+	retryAt  time.Time
+	checked  time.Time
+}
+
+// An EndpointStatus is the health of a proxy of a MultiDialer.
+type EndpointStatus struct {
+	// URL is the URL of the proxy, with its password redacted.
+	URL string
+
+	// Healthy reports whether the last dial or probe of the proxy, if
+	// any, succeeded.
+	Healthy bool
+
+	// Failures is the number of consecutive failures of the proxy, and
+	// Err the last one.
+	Failures int
+	Err      error
+
+	// RetryAt is the end of the backoff of an unhealthy proxy.
+	RetryAt time.Time
+
+	// LastCheck is the time of the last dial or probe of the proxy.
+	LastCheck time.Time
+}
+
+var errNoProxies = errors.New("proxy: no proxy URLs")
+
+// NewMultiDialer returns a MultiDialer dialing through the proxies of
+// urls, as returned by FromURL with forward.
+//
+// The returned Dialer also implements ContextDialer.
+func NewMultiDialer(urls []*url.URL, forward Dialer) (*MultiDialer, error) {
+	if len(urls) == 0 {
+		return nil, errNoProxies
+	}
+	d := &MultiDialer{forward: forward}
+	for _, u := range urls {
+		pd, err := FromURL(u, forward)
+		if err != nil {
+			return nil, err
+		}
+		d.endpoints = append(d.endpoints, &proxyEndpoint{u: u, d: pd})
+	}
+	return d, nil
+}
+
+// Dial connects to the address addr on the given network through one of
+// the proxies.
+func (d *MultiDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address addr on the given network through
+// one of the proxies using the provided context. It tries the proxies in
+// turn until a dial succeeds, returning the error of the first one
+// otherwise.
+func (d *MultiDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var firstErr error
+	for _, e := range d.candidates() {
+		var c net.Conn
+		var err error
+		if x, ok := e.d.(ContextDialer); ok {
+			c, err = x.DialContext(ctx, network, addr)
+		} else {
+			c, err = dialContext(ctx, e.d, network, addr)
+		}
+		if ctx.Err() != nil {
+			if c != nil {
+				c.Close()
+			}
+			return nil, ctx.Err()
+		}
+		d.report(e, err)
+		if err == nil {
+			return c, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// candidates returns the endpoints in the order of the attempts of a dial:
+// the healthy ones, the unhealthy ones whose backoff expired, then the
+// others by the end of their backoff.
+func (d *MultiDialer) candidates() []*proxyEndpoint {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var healthy, due, waiting []*proxyEndpoint
+	for _, e := range d.endpoints {
+		switch {
+		case e.failures == 0:
+			healthy = append(healthy, e)
+		case !now.Before(e.retryAt):
+			due = append(due, e)
+		default:
+			waiting = append(waiting, e)
+		}
+	}
+	if d.Balance && len(healthy) > 1 {
+		i := d.next % len(healthy)
+		d.next = i + 1
+		healthy = append(healthy[i:], healthy[:i]...)
+	}
+	sort.SliceStable(waiting, func(i, j int) bool {
+		return waiting[i].retryAt.Before(waiting[j].retryAt)
+	})
+	res := append(healthy, due...)
+	return append(res, waiting...)
+}
+
+// report records the result of a dial or probe of e.
+func (d *MultiDialer) report(e *proxyEndpoint, err error) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e.checked = now
+	if err == nil {
+		e.failures, e.err, e.retryAt = 0, nil, time.Time{}
+		return
+	}
+	e.failures++
+	e.err = err
+	min, max := d.MinBackoff, d.MaxBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	if max < min {
+		max = min
+	}
+	backoff := min
+	for i := 1; i < e.failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	e.retryAt = now.Add(backoff)
+}
+
+// CheckHealth probes the proxies which are healthy or whose backoff
+// expired, concurrently, and returns once all are probed.
+func (d *MultiDialer) CheckHealth(ctx context.Context) {
+	now := time.Now()
+	var probe []*proxyEndpoint
+	d.mu.Lock()
+	for _, e := range d.endpoints {
+		if !now.Before(e.retryAt) {
+			probe = append(probe, e)
+		}
+	}
+	d.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, e := range probe {
+		wg.Add(1)
+		go func(e *proxyEndpoint) {
+			defer wg.Done()
+			err := d.probe(ctx, e.u)
+			if ctx.Err() == nil {
+				d.report(e, err)
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// probe checks the health of the proxy u.
+func (d *MultiDialer) probe(ctx context.Context, u *url.URL) error {
+	if d.Probe != nil {
+		return d.Probe(ctx, u)
+	}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			p, err := net.DefaultResolver.LookupPort(ctx, "tcp", u.Scheme)
+			if err != nil {
+				return err
+			}
+			port = strconv.Itoa(p)
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+	fwd := d.forward
+	if fwd == nil {
+		fwd = Direct
+	}
+	var c net.Conn
+	var err error
+	if x, ok := fwd.(ContextDialer); ok {
+		c, err = x.DialContext(ctx, "tcp", addr)
+	} else {
+		c, err = dialContext(ctx, fwd, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// StartHealthChecks calls CheckHealth every interval in a goroutine, until
+// the returned function is called.
+func (d *MultiDialer) StartHealthChecks(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				d.CheckHealth(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// Status returns the health of the proxies, in the order given to
+// NewMultiDialer.
+func (d *MultiDialer) Status() []EndpointStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := make([]EndpointStatus, len(d.endpoints))
+	for i, e := range d.endpoints {
+		res[i] = EndpointStatus{
+			URL:       e.u.Redacted(),
+			Healthy:   e.failures == 0,
+			Failures:  e.failures,
+			Err:       e.err,
+			RetryAt:   e.retryAt,
+			LastCheck: e.checked,
+		}
+	}
+	return res
+}
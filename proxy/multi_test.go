@@ -0,0 +1,115 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/internal/sockstest"
+)
+
+var errFailDial = errors.New("dial failed")
+
+func TestMultiDialer(t *testing.T) {
+	ss, err := sockstest.NewServer(sockstest.NoAuthRequired, sockstest.NoProxyRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	urls := []*url.URL{
+		{Scheme: "socks5", Host: closedAddr},
+		{Scheme: "socks5", Host: ss.Addr().String()},
+	}
+	d, err := NewMultiDialer(urls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.MinBackoff = time.Hour
+
+	for i := 0; i < 2; i++ {
+		c, err := d.Dial("tcp", ss.TargetAddr().String())
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		c.Close()
+	}
+	st := d.Status()
+	if s := st[0]; s.Healthy || s.Failures != 1 || s.Err == nil || !s.RetryAt.After(time.Now().Add(time.Hour/2)) {
+		t.Errorf("status of the unreachable proxy: %+v; want one failure and a backoff of an hour", s)
+	}
+	if s := st[1]; !s.Healthy || s.Failures != 0 || s.LastCheck.IsZero() {
+		t.Errorf("status of the proxy: %+v; want healthy", s)
+	}
+
+	var mu sync.Mutex
+	var probed []string
+	d.Probe = func(ctx context.Context, u *url.URL) error {
+		mu.Lock()
+		probed = append(probed, u.Host)
+		mu.Unlock()
+		return nil
+	}
+	d.CheckHealth(context.Background())
+	if len(probed) != 1 || probed[0] != ss.Addr().String() {
+		t.Errorf("probed %v; want only the healthy proxy, the other being in backoff", probed)
+	}
+
+	// Expire the backoff.
+	d.endpoints[0].retryAt = time.Now()
+	d.Probe = nil
+	d.CheckHealth(context.Background())
+	if s := d.Status()[0]; s.Failures != 2 {
+		t.Errorf("status of the unreachable proxy after a probe: %+v; want two failures", s)
+	}
+	if s := d.Status()[1]; !s.Healthy {
+		t.Errorf("status of the proxy after a probe: %+v; want healthy", s)
+	}
+}
+
+func TestMultiDialerBackoff(t *testing.T) {
+	d := &MultiDialer{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	e := &proxyEndpoint{}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		start := time.Now()
+		d.report(e, errFailDial)
+		if got := e.retryAt.Sub(start); got < want || got > want+time.Second/2 {
+			t.Errorf("after %d failures, backoff of %v; want %v", e.failures, got, want)
+		}
+	}
+	d.report(e, nil)
+	if e.failures != 0 || !e.retryAt.IsZero() {
+		t.Errorf("after a success, %d failures and retry at %v; want none", e.failures, e.retryAt)
+	}
+}
+
+func TestMultiDialerBalance(t *testing.T) {
+	a, b := &proxyEndpoint{}, &proxyEndpoint{}
+	d := &MultiDialer{Balance: true, endpoints: []*proxyEndpoint{a, b}}
+	var firsts []*proxyEndpoint
+	for i := 0; i < 4; i++ {
+		firsts = append(firsts, d.candidates()[0])
+	}
+	if firsts[0] == firsts[1] || firsts[0] != firsts[2] || firsts[1] != firsts[3] {
+		t.Errorf("balanced dials do not alternate between the proxies")
+	}
+	d.Balance = false
+	d.report(a, errFailDial)
+	if c := d.candidates(); len(c) != 2 || c[0] != b {
+		t.Errorf("the unhealthy proxy is tried first")
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/internal/socks"
+)
+
+// A DialEventType is the type of a DialEvent.
+type DialEventType int
+
+const (
+	// EventDialStart is sent when a dial starts.
+	EventDialStart DialEventType = iota
+
+	// EventProxyConnect is sent when the connection to a SOCKS5 proxy
+	// is established, or fails with Err, before the proxy handshake.
+	EventProxyConnect
+
+	// EventDialDone is sent when a dial ends, once the connection to
+	// the address is established, including the proxy handshake if
+	// any, or has failed with Err.
+	EventDialDone
+
+	// EventConnClose is sent when a connection dialed is closed, with
+	// the bytes tunneled through it.
+	EventConnClose
+)
+
+func (t DialEventType) String() string {
+	switch t {
+	case EventDialStart:
+		return "dial start"
+	case EventProxyConnect:
+		return "proxy connect"
+	case EventDialDone:
+		return "dial done"
+	case EventConnClose:
+		return "conn close"
+	}
+	return "<nil>"
+}
+
+// A DialFailure classifies the cause of a failed dial.
+type DialFailure int
+
+const (
+	FailureNone             DialFailure = iota // the dial succeeded
+	FailureDial                                // the dial failed, with no SOCKS5 proxy involved
+	FailureProxyUnreachable                    // the connection to the proxy failed
+	FailureProxyHandshake                      // the proxy failed the handshake, or the connection to the address
+	FailureCanceled                            // the context of the dial was done
+)
+
+func (f DialFailure) String() string {
+	switch f {
+	case FailureNone:
+		return "none"
+	case FailureDial:
+		return "dial"
+	case FailureProxyUnreachable:
+		return "proxy unreachable"
+	case FailureProxyHandshake:
+		return "proxy handshake"
+	case FailureCanceled:
+		return "canceled"
+	}
+	return "<nil>"
+}
+
+// A DialEvent describes a step of a dial, or the end of a connection,
+// observed by an Observer.
+type DialEvent struct {
+	Type    DialEventType
+	Network string // network dialed
+	Address string // address dialed
+
+	// Proxy is the address of the SOCKS5 proxy the connection goes
+	// through, once it is known from EventProxyConnect. It is empty for
+	// the connections made directly.
+	Proxy string
+
+	// Elapsed is the time since the dial started.
+	Elapsed time.Duration
+
+	// Err is the error of a failed dial or proxy connection, and Failure
+	// its cause for EventDialDone.
+	Err     error
+	Failure DialFailure
+
+	// BytesRead and BytesWritten count the bytes tunneled through the
+	// connection, for EventConnClose.
+	BytesRead, BytesWritten int64
+}
+
+// An Observer receives the events of the dials made through the Dialers
+// returned by WithObserver. It may be called concurrently.
+type Observer interface {
+	ObserveDial(DialEvent)
+}
+
+// The ObserverFunc type is an adapter to allow the use of ordinary
+// functions as Observers.
+type ObserverFunc func(DialEvent)
+
+// ObserveDial calls f(e).
+func (f ObserverFunc) ObserveDial(e DialEvent) { f(e) }
+
+// WithObserver returns a Dialer which dials through d, reporting the
+// events of its dials and of the connections they return to o. The
+// Dialers of a PerHost, such as one returned by FromEnvironment, are
+// observed separately, so that the events tell the connections going
+// through a proxy from those bypassing it, and the connections to
+// SOCKS5 proxies are reported with EventProxyConnect. Since PerHost
+// rules are copied, d must not be modified afterwards.
+//
+// The returned Dialer also implements ContextDialer.
+func WithObserver(d Dialer, o Observer) Dialer {
+	switch x := d.(type) {
+	case *PerHost:
+		p := *x
+		p.def = WithObserver(x.def, o)
+		p.bypass = WithObserver(x.bypass, o)
+		return &p
+	case *socks.Dialer:
+		s := *x
+		s.ProxyDial = observeProxyDial(x.ProxyDial)
+		d = &s
+	}
+	return &observedDialer{d: d, o: o}
+}
+
+// observeProxyDial returns a function dialing SOCKS5 proxies with dial,
+// or a net.Dialer if nil, which reports to the dialTrace of its context.
+func observeProxyDial(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		var c net.Conn
+		var err error
+		if dial != nil {
+			c, err = dial(ctx, network, address)
+		} else {
+			var d net.Dialer
+			c, err = d.DialContext(ctx, network, address)
+		}
+		if t, ok := ctx.Value(dialTraceKey{}).(*dialTrace); ok {
+			t.proxyConnect(address, err)
+		}
+		return c, err
+	}
+}
+
+type dialTraceKey struct{}
+
+// A dialTrace holds the state of an observed dial.
+type dialTrace struct {
+	o       Observer
+	network string
+	address string
+	start   time.Time
+
+	mu             sync.Mutex
+	proxy          string
+	proxyConnected bool
+}
+
+// event returns an event of type typ of the dial.
+func (t *dialTrace) event(typ DialEventType) DialEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return DialEvent{
+		Type:    typ,
+		Network: t.network,
+		Address: t.address,
+		Proxy:   t.proxy,
+		Elapsed: time.Since(t.start),
+	}
+}
+
+func (t *dialTrace) proxyConnect(proxy string, err error) {
+	t.mu.Lock()
+	t.proxy = proxy
+	t.proxyConnected = err == nil
+	t.mu.Unlock()
+	e := t.event(EventProxyConnect)
+	e.Err = err
+	t.o.ObserveDial(e)
+}
+
+// failure returns the cause of the failure of the dial with ctx.
+func (t *dialTrace) failure(ctx context.Context) DialFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		return FailureCanceled
+	case t.proxyConnected:
+		return FailureProxyHandshake
+	case t.proxy != "":
+		return FailureProxyUnreachable
+	}
+	return FailureDial
+}
+
+// observedDialer reports the dials of d to o.
+type observedDialer struct {
+	d Dialer
+	o Observer
+}
+
+var (
+	_ Dialer        = (*observedDialer)(nil)
+	_ ContextDialer = (*observedDialer)(nil)
+)
+
+// Dial connects to the address addr on the given network through the
+// observed Dialer.
+func (d *observedDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address addr on the given network through
+// the observed Dialer using the provided context.
+func (d *observedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	t := &dialTrace{o: d.o, network: network, address: addr, start: time.Now()}
+	d.o.ObserveDial(t.event(EventDialStart))
+	ctx = context.WithValue(ctx, dialTraceKey{}, t)
+	var c net.Conn
+	var err error
+	if x, ok := d.d.(ContextDialer); ok {
+		c, err = x.DialContext(ctx, network, addr)
+	} else {
+		c, err = dialContext(ctx, d.d, network, addr)
+	}
+	e := t.event(EventDialDone)
+	if err != nil {
+		e.Err, e.Failure = err, t.failure(ctx)
+		d.o.ObserveDial(e)
+		return nil, err
+	}
+	d.o.ObserveDial(e)
+	return &observedConn{Conn: c, t: t}, nil
+}
+
+// observedConn counts the bytes tunneled through a connection, and
+// reports them when it is closed.
+type observedConn struct {
+	read, written int64 // atomic; first for alignment on 32-bit platforms
+
+	net.Conn
+	t         *dialTrace
+	closeOnce sync.Once
+}
+
+func (c *observedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *observedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+func (c *observedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		e := c.t.event(EventConnClose)
+		e.BytesRead = atomic.LoadInt64(&c.read)
+		e.BytesWritten = atomic.LoadInt64(&c.written)
+		c.t.o.ObserveDial(e)
+	})
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/internal/sockstest"
+)
+
+// eventRecorder records the events of the dials.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []DialEvent
+}
+
+func (r *eventRecorder) ObserveDial(e DialEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *eventRecorder) reset() []DialEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func eventTypes(events []DialEvent) []DialEventType {
+	var types []DialEventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestWithObserver(t *testing.T) {
+	ss, err := sockstest.NewServer(sockstest.NoAuthRequired, sockstest.NoProxyRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+	socks, err := SOCKS5("tcp", ss.Addr().String(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	var r eventRecorder
+	perHost := NewPerHost(socks, Direct)
+	perHost.AddHost("localhost")
+	d := WithObserver(perHost, &r)
+
+	c, err := d.Dial("tcp", ss.TargetAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c.Close()
+	events := r.reset()
+	if got, want := eventTypes(events), []DialEventType{EventDialStart, EventProxyConnect, EventDialDone, EventConnClose}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events through the proxy: %v; want %v", got, want)
+	}
+	for _, e := range events[1:] {
+		if e.Proxy != ss.Addr().String() || e.Address != ss.TargetAddr().String() || e.Err != nil {
+			t.Errorf("%v event %+v; want the proxy and the address, without error", e.Type, e)
+		}
+	}
+	if e := events[3]; e.BytesWritten != 3 {
+		t.Errorf("%d bytes written; want 3", e.BytesWritten)
+	}
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	bypassed := net.JoinHostPort("localhost", port)
+	c, err = d.Dial("tcp", bypassed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	events = r.reset()
+	if got, want := eventTypes(events), []DialEventType{EventDialStart, EventDialDone, EventConnClose}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("events bypassing the proxy: %v; want %v", got, want)
+	}
+	if e := events[1]; e.Proxy != "" || e.Address != bypassed {
+		t.Errorf("dial done event %+v; want no proxy", e)
+	}
+}
+
+func TestWithObserverFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	unreachable, err := SOCKS5("tcp", closedAddr, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errFail := errors.New("dial failed")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name string
+		d    Dialer
+		ctx  context.Context
+		want DialFailure
+	}{
+		{"proxy unreachable", unreachable, context.Background(), FailureProxyUnreachable},
+		{"dial", funcFailDialer(func(context.Context) error { return errFail }), context.Background(), FailureDial},
+		{"canceled", funcFailDialer(func(ctx context.Context) error { return ctx.Err() }), canceled, FailureCanceled},
+	} {
+		var r eventRecorder
+		d := WithObserver(tc.d, &r).(ContextDialer)
+		if _, err := d.DialContext(tc.ctx, "tcp", "example.com:80"); err == nil {
+			t.Errorf("%s: dial succeeded", tc.name)
+			continue
+		}
+		events := r.reset()
+		e := events[len(events)-1]
+		if e.Type != EventDialDone || e.Err == nil || e.Failure != tc.want {
+			t.Errorf("%s: last event %+v; want %v with failure %v", tc.name, e, EventDialDone, tc.want)
+		}
+	}
+}
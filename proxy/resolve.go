@@ -0,0 +1,103 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// A ResolveMode selects where the host names of the addresses dialed
+// through a proxy are resolved.
+type ResolveMode int
+
+const (
+	// ResolveRemote passes host names to the proxy, which resolves them.
+	// The names dialed are not disclosed to the local resolver, as
+	// needed for uses such as Tor. This is the default of the Dialers of
+	// this package.
+	ResolveRemote ResolveMode = iota
+
+	// ResolveLocal resolves host names locally, and passes the resulting
+	// IP addresses to the proxy, for the proxies which cannot resolve
+	// names.
+	ResolveLocal
+)
+
+// WithResolveMode returns a Dialer which dials through d, resolving the
+// host names of the addresses dialed according to mode. With
+// ResolveLocal, names are resolved with r, or net.DefaultResolver if r
+// is nil, and the addresses found are dialed in turn until one succeeds.
+// With ResolveRemote, d is returned as is.
+//
+// The returned Dialer also implements ContextDialer, and may be used as
+// the forwarding Dialer of another proxy Dialer, or with PerHost.
+func WithResolveMode(d Dialer, mode ResolveMode, r *net.Resolver) Dialer {
+	if mode == ResolveRemote {
+		return d
+	}
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return &localResolver{d: d, r: r}
+}
+
+// localResolver resolves host names before dialing them through d.
+type localResolver struct {
+	d Dialer
+	r *net.Resolver
+}
+
+var (
+	_ Dialer        = (*localResolver)(nil)
+	_ ContextDialer = (*localResolver)(nil)
+)
+
+// Dial resolves the host of addr and dials it through the proxy.
+func (l *localResolver) Dial(network, addr string) (net.Conn, error) {
+	return l.DialContext(context.Background(), network, addr)
+}
+
+// DialContext resolves the host of addr and dials it through the proxy
+// using the provided context.
+func (l *localResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || net.ParseIP(host) != nil {
+		return l.dial(ctx, network, addr)
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4", "udp4":
+		ipNetwork = "ip4"
+	case "tcp6", "udp6":
+		ipNetwork = "ip6"
+	}
+	ips, err := l.r.LookupIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("proxy: no address found for " + host)
+	}
+	for _, ip := range ips {
+		var c net.Conn
+		c, err = l.dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return c, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+func (l *localResolver) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d, ok := l.d.(ContextDialer); ok {
+		return d.DialContext(ctx, network, addr)
+	}
+	return dialContext(ctx, l.d, network, addr)
+}
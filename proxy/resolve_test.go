@@ -0,0 +1,38 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestWithResolveMode(t *testing.T) {
+	var remote recordingProxy
+	if d := WithResolveMode(&remote, ResolveRemote, nil); d != Dialer(&remote) {
+		t.Fatalf("WithResolveMode(ResolveRemote) = %v; want the Dialer itself", d)
+	}
+
+	var local recordingProxy
+	d := WithResolveMode(&local, ResolveLocal, nil)
+	for _, addr := range []string{"localhost:80", "127.0.0.1:80", "[::1]:80"} {
+		if _, err := d.(ContextDialer).DialContext(context.Background(), "tcp4", addr); err == nil {
+			t.Errorf("dial %s: recordingProxy succeeded", addr)
+		}
+	}
+	if len(local.addrs) < 3 {
+		t.Fatalf("dialed %v; want localhost to be resolved", local.addrs)
+	}
+	for _, addr := range local.addrs {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) == nil {
+			t.Errorf("dialed %q; want an IP address", addr)
+		}
+	}
+	if last := local.addrs[len(local.addrs)-2:]; last[0] != "127.0.0.1:80" || last[1] != "[::1]:80" {
+		t.Errorf("IP addresses dialed as %v; want them passed as is", last)
+	}
+}
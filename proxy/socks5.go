@@ -11,9 +11,25 @@ import (
 	"golang.org/x/net/internal/socks"
 )
 
+// A Binder is implemented by the Dialers returned by SOCKS5. Its Bind
+// method requests the proxy to accept a connection from address, as
+// protocols such as active FTP need for the connections their servers
+// initiate, with the SOCKSv5 BIND command. The Addr method of the
+// Listener returned is the address on which the proxy listens, to send
+// to the peer; its Accept method returns the connection of the peer,
+// once.
+type Binder interface {
+	Bind(ctx context.Context, network, address string) (net.Listener, error)
+}
+
+var _ Binder = (*socks.Dialer)(nil)
+
 // SOCKS5 returns a Dialer that makes SOCKSv5 connections to the given
 // address with an optional username and password.
 // See RFC 1928 and RFC 1929.
+// The Dialer returned implements Binder.
+// Host names are resolved by the proxy; see WithResolveMode to resolve
+// them locally.
 func SOCKS5(network, address string, auth *Auth, forward Dialer) (Dialer, error) {
 	d := socks.NewDialer(network, address)
 	if forward != nil {
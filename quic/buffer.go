@@ -0,0 +1,181 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+// A sendBuffer holds data written to a stream, or to the crypto
+// stream of an encryption level, until the peer acknowledges it.
+type sendBuffer struct {
+	buf     []byte   // unacknowledged data starting at base
+	base    int64    // offset of buf[0]; all data below it is acknowledged
+	end     int64    // offset of the end of the written data
+	unsent  rangeset // data that needs to be sent or sent again
+	acked   rangeset // acknowledged data above base
+	sentMax int64    // offset of the end of the data sent so far
+
+	fin        bool // no more data will be written
+	finPending bool // the end of the stream needs to be sent
+	finAcked   bool // the end of the stream has been acknowledged
+}
+
+func (s *sendBuffer) write(b []byte) {
+	s.buf = append(s.buf, b...)
+	s.unsent.add(s.end, s.end+int64(len(b)))
+	s.end += int64(len(b))
+}
+
+// close marks the end of the stream.
+func (s *sendBuffer) close() {
+	if !s.fin {
+		s.fin = true
+		s.finPending = true
+	}
+}
+
+// pending reports whether there is anything to send, given the
+// flow control limit on the stream data offset.
+func (s *sendBuffer) pending(limit int64) bool {
+	if len(s.unsent) > 0 && s.unsent[0].start < limit {
+		return true
+	}
+	return s.finPending && s.end <= limit
+}
+
+// next returns up to max bytes of data to send, ending at or before
+// limit, and whether the frame carrying it should end the stream.
+func (s *sendBuffer) next(max int, limit int64) (off int64, data []byte, fin bool) {
+	if len(s.unsent) == 0 {
+		return s.end, nil, s.finPending && s.end <= limit
+	}
+	r := s.unsent[0]
+	end := r.end
+	if end > r.start+int64(max) {
+		end = r.start + int64(max)
+	}
+	if end > limit {
+		end = limit
+	}
+	if end < r.start {
+		end = r.start
+	}
+	data = s.buf[r.start-s.base : end-s.base]
+	fin = s.finPending && end == s.end
+	return r.start, data, fin
+}
+
+// markSent records that [off, off+n) and possibly the end of the
+// stream were sent.
+func (s *sendBuffer) markSent(off int64, n int, fin bool) {
+	s.unsent.sub(off, off+int64(n))
+	if fin {
+		s.finPending = false
+	}
+	if off+int64(n) > s.sentMax {
+		s.sentMax = off + int64(n)
+	}
+}
+
+// lost records that the packet carrying [off, off+n) was lost.
+func (s *sendBuffer) lost(off int64, n int, fin bool) {
+	start, end := off, off+int64(n)
+	if start < s.base {
+		start = s.base
+	}
+	for start < end {
+		// Skip acknowledged data.
+		next := end
+		for _, r := range s.acked {
+			if r.start <= start && start < r.end {
+				start = r.end
+				next = -1
+				break
+			}
+			if r.start > start && r.start < next {
+				next = r.start
+			}
+		}
+		if next < 0 {
+			continue
+		}
+		s.unsent.add(start, next)
+		start = next
+	}
+	if fin && !s.finAcked {
+		s.finPending = true
+	}
+}
+
+// ack records that [off, off+n) and possibly the end of the stream
+// were acknowledged, and releases acknowledged data.
+func (s *sendBuffer) ack(off int64, n int, fin bool) {
+	s.acked.add(off, off+int64(n))
+	if fin {
+		s.finAcked = true
+	}
+	if len(s.acked) > 0 && s.acked[0].start <= s.base && s.acked[0].end > s.base {
+		newBase := s.acked[0].end
+		s.buf = s.buf[newBase-s.base:]
+		s.base = newBase
+		s.acked.sub(0, newBase)
+	}
+}
+
+// done reports whether all data and the end of the stream were
+// acknowledged.
+func (s *sendBuffer) done() bool {
+	return s.fin && s.finAcked && s.base == s.end
+}
+
+// A recvBuffer reassembles data received on a stream or on the crypto
+// stream of an encryption level.
+type recvBuffer struct {
+	buf   []byte   // data following off, not all of it received yet
+	off   int64    // offset of the next byte to read
+	recvd rangeset // received data above off
+	end   int64    // offset of the end of the received data
+}
+
+// write stores data received at off.
+func (r *recvBuffer) write(off int64, data []byte) {
+	end := off + int64(len(data))
+	if end > r.end {
+		r.end = end
+	}
+	if end <= r.off {
+		return
+	}
+	if off < r.off {
+		data = data[r.off-off:]
+		off = r.off
+	}
+	if need := int(end - r.off); need > len(r.buf) {
+		if need <= cap(r.buf) {
+			r.buf = r.buf[:need]
+		} else {
+			buf := make([]byte, need, 2*need)
+			copy(buf, r.buf)
+			r.buf = buf
+		}
+	}
+	copy(r.buf[off-r.off:], data)
+	r.recvd.add(off, end)
+}
+
+// readable returns the contiguous data available to read.
+func (r *recvBuffer) readable() []byte {
+	if len(r.recvd) == 0 || r.recvd[0].start != r.off {
+		return nil
+	}
+	return r.buf[:r.recvd[0].end-r.off]
+}
+
+// consume discards the first n readable bytes.
+func (r *recvBuffer) consume(n int) {
+	r.buf = r.buf[n:]
+	r.off += int64(n)
+	r.recvd.sub(0, r.off)
+}
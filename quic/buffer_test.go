@@ -0,0 +1,82 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSendBuffer(t *testing.T) {
+	var s sendBuffer
+	s.write([]byte("hello, "))
+	s.write([]byte("world"))
+	s.close()
+
+	off, data, fin := s.next(5, 100)
+	if off != 0 || string(data) != "hello" || fin {
+		t.Fatalf("next = %d, %q, %v", off, data, fin)
+	}
+	s.markSent(off, len(data), fin)
+	off, data, fin = s.next(100, 10)
+	if off != 5 || string(data) != ", wor" || fin {
+		t.Fatalf("next with limit = %d, %q, %v", off, data, fin)
+	}
+	s.markSent(off, len(data), fin)
+	off, data, fin = s.next(100, 100)
+	if off != 10 || string(data) != "ld" || !fin {
+		t.Fatalf("next = %d, %q, %v", off, data, fin)
+	}
+	s.markSent(off, len(data), fin)
+	if s.pending(100) {
+		t.Fatal("pending after sending everything")
+	}
+
+	// Lose the middle, acknowledge the rest.
+	s.ack(0, 5, false)
+	s.ack(10, 2, true)
+	s.lost(5, 5, false)
+	if s.base != 5 {
+		t.Errorf("base = %d; want 5", s.base)
+	}
+	off, data, fin = s.next(100, 100)
+	if off != 5 || string(data) != ", wor" || fin {
+		t.Fatalf("retransmission = %d, %q, %v", off, data, fin)
+	}
+	s.markSent(off, len(data), fin)
+	// A loss of data that was acknowledged through another packet
+	// is ignored.
+	s.ack(5, 5, false)
+	s.lost(0, 12, true)
+	if s.pending(100) {
+		t.Error("acknowledged data pending after loss")
+	}
+	if !s.done() {
+		t.Error("not done after all data acknowledged")
+	}
+}
+
+func TestRecvBuffer(t *testing.T) {
+	var r recvBuffer
+	r.write(6, []byte("world"))
+	if got := r.readable(); got != nil {
+		t.Fatalf("readable = %q; want nothing", got)
+	}
+	r.write(0, []byte("hello,"))
+	if got := r.readable(); !bytes.Equal(got, []byte("hello,world")) {
+		t.Fatalf("readable = %q", got)
+	}
+	r.consume(6)
+	r.write(0, []byte("hello,wor")) // duplicate
+	if got := r.readable(); !bytes.Equal(got, []byte("world")) {
+		t.Fatalf("readable after duplicate = %q", got)
+	}
+	if r.end != 11 {
+		t.Errorf("end = %d; want 11", r.end)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// This file implements the ChaCha20 stream cipher and the
+// ChaCha20-Poly1305 AEAD of RFC 8439, for TLS_CHACHA20_POLY1305_SHA256,
+// which the standard library does not export.
+
+const (
+	chachaKeySize   = 32
+	chachaNonceSize = 12
+	poly1305TagSize = 16
+)
+
+var errOpen = errors.New("quic: message authentication failed")
+
+// chachaBlock writes the ChaCha20 block of key, counter and nonce to out.
+func chachaBlock(out *[64]byte, key *[chachaKeySize]byte, counter uint32, nonce []byte) {
+	var s, x [16]uint32
+	s[0], s[1], s[2], s[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		s[4+i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	s[12] = counter
+	s[13] = binary.LittleEndian.Uint32(nonce[0:])
+	s[14] = binary.LittleEndian.Uint32(nonce[4:])
+	s[15] = binary.LittleEndian.Uint32(nonce[8:])
+	x = s
+	qr := func(a, b, c, d int) {
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+	}
+	for i := 0; i < 10; i++ {
+		qr(0, 4, 8, 12)
+		qr(1, 5, 9, 13)
+		qr(2, 6, 10, 14)
+		qr(3, 7, 11, 15)
+		qr(0, 5, 10, 15)
+		qr(1, 6, 11, 12)
+		qr(2, 7, 8, 13)
+		qr(3, 4, 9, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+s[i])
+	}
+}
+
+// chachaXOR sets dst to src XORed with the key stream of key and nonce
+// starting at the block counter. dst and src may overlap exactly.
+func chachaXOR(dst, src []byte, key *[chachaKeySize]byte, counter uint32, nonce []byte) {
+	var block [64]byte
+	for len(src) > 0 {
+		chachaBlock(&block, key, counter, nonce)
+		counter++
+		n := subtle.XORBytes(dst, src, block[:])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// poly1305 returns the Poly1305 tag of msg under the one-time key.
+// It uses the 26-bit limbs of poly1305-donna.
+func poly1305(key *[32]byte, msg []byte) [poly1305TagSize]byte {
+	const mask26 = 0x3ffffff
+	r0 := binary.LittleEndian.Uint32(key[0:]) & 0x3ffffff
+	r1 := (binary.LittleEndian.Uint32(key[3:]) >> 2) & 0x3ffff03
+	r2 := (binary.LittleEndian.Uint32(key[6:]) >> 4) & 0x3ffc0ff
+	r3 := (binary.LittleEndian.Uint32(key[9:]) >> 6) & 0x3f03fff
+	r4 := (binary.LittleEndian.Uint32(key[12:]) >> 8) & 0x00fffff
+	s1, s2, s3, s4 := uint64(r1*5), uint64(r2*5), uint64(r3*5), uint64(r4*5)
+	var h0, h1, h2, h3, h4 uint32
+	for len(msg) > 0 {
+		var m [16]byte
+		hibit := uint32(1 << 24)
+		if len(msg) >= 16 {
+			copy(m[:], msg[:16])
+			msg = msg[16:]
+		} else {
+			copy(m[:], msg)
+			m[len(msg)] = 1
+			hibit = 0
+			msg = nil
+		}
+		h0 += binary.LittleEndian.Uint32(m[0:]) & mask26
+		h1 += (binary.LittleEndian.Uint32(m[3:]) >> 2) & mask26
+		h2 += (binary.LittleEndian.Uint32(m[6:]) >> 4) & mask26
+		h3 += (binary.LittleEndian.Uint32(m[9:]) >> 6) & mask26
+		h4 += (binary.LittleEndian.Uint32(m[12:]) >> 8) | hibit
+
+		d0 := uint64(h0)*uint64(r0) + uint64(h1)*s4 + uint64(h2)*s3 + uint64(h3)*s2 + uint64(h4)*s1
+		d1 := uint64(h0)*uint64(r1) + uint64(h1)*uint64(r0) + uint64(h2)*s4 + uint64(h3)*s3 + uint64(h4)*s2
+		d2 := uint64(h0)*uint64(r2) + uint64(h1)*uint64(r1) + uint64(h2)*uint64(r0) + uint64(h3)*s4 + uint64(h4)*s3
+		d3 := uint64(h0)*uint64(r3) + uint64(h1)*uint64(r2) + uint64(h2)*uint64(r1) + uint64(h3)*uint64(r0) + uint64(h4)*s4
+		d4 := uint64(h0)*uint64(r4) + uint64(h1)*uint64(r3) + uint64(h2)*uint64(r2) + uint64(h3)*uint64(r1) + uint64(h4)*uint64(r0)
+
+		c := d0 >> 26
+		h0 = uint32(d0) & mask26
+		d1 += c
+		c = d1 >> 26
+		h1 = uint32(d1) & mask26
+		d2 += c
+		c = d2 >> 26
+		h2 = uint32(d2) & mask26
+		d3 += c
+		c = d3 >> 26
+		h3 = uint32(d3) & mask26
+		d4 += c
+		c = d4 >> 26
+		h4 = uint32(d4) & mask26
+		h0 += uint32(c) * 5
+		h1 += h0 >> 26
+		h0 &= mask26
+	}
+
+	// Fully carry h, and reduce it modulo 2^130-5.
+	c := h1 >> 26
+	h1 &= mask26
+	h2 += c
+	c = h2 >> 26
+	h2 &= mask26
+	h3 += c
+	c = h3 >> 26
+	h3 &= mask26
+	h4 += c
+	c = h4 >> 26
+	h4 &= mask26
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= mask26
+	h1 += c
+
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= mask26
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= mask26
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= mask26
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= mask26
+	g4 := h4 + c - 1<<26
+
+	// h if h < 2^130-5, that is if g4 is negative, and g otherwise.
+	sel := (g4 >> 31) - 1
+	h0 = h0&^sel | g0&sel
+	h1 = h1&^sel | g1&sel
+	h2 = h2&^sel | g2&sel
+	h3 = h3&^sel | g3&sel
+	h4 = h4&^sel | g4&sel
+
+	// h mod 2^128, plus s.
+	w0 := h0 | h1<<26
+	w1 := h1>>6 | h2<<20
+	w2 := h2>>12 | h3<<14
+	w3 := h3>>18 | h4<<8
+	var tag [poly1305TagSize]byte
+	f := uint64(w0) + uint64(binary.LittleEndian.Uint32(key[16:]))
+	binary.LittleEndian.PutUint32(tag[0:], uint32(f))
+	f = uint64(w1) + uint64(binary.LittleEndian.Uint32(key[20:])) + f>>32
+	binary.LittleEndian.PutUint32(tag[4:], uint32(f))
+	f = uint64(w2) + uint64(binary.LittleEndian.Uint32(key[24:])) + f>>32
+	binary.LittleEndian.PutUint32(tag[8:], uint32(f))
+	f = uint64(w3) + uint64(binary.LittleEndian.Uint32(key[28:])) + f>>32
+	binary.LittleEndian.PutUint32(tag[12:], uint32(f))
+	return tag
+}
+
+// chacha20Poly1305 is the AEAD of RFC 8439, Section 2.8.
+type chacha20Poly1305 struct {
+	key [chachaKeySize]byte
+}
+
+func newChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != chachaKeySize {
+		return nil, errors.New("quic: bad ChaCha20-Poly1305 key length")
+	}
+	a := &chacha20Poly1305{}
+	copy(a.key[:], key)
+	return a, nil
+}
+
+func (a *chacha20Poly1305) NonceSize() int { return chachaNonceSize }
+func (a *chacha20Poly1305) Overhead() int  { return poly1305TagSize }
+
+// tag returns the tag of the ciphertext and additional data.
+func (a *chacha20Poly1305) tag(nonce, ciphertext, additionalData []byte) [poly1305TagSize]byte {
+	var block [64]byte
+	chachaBlock(&block, &a.key, 0, nonce)
+	var polyKey [32]byte
+	copy(polyKey[:], block[:32])
+	pad := func(b []byte) []byte {
+		if n := len(b) % 16; n != 0 {
+			b = append(b, make([]byte, 16-n)...)
+		}
+		return b
+	}
+	msg := make([]byte, 0, len(additionalData)+len(ciphertext)+48)
+	msg = pad(append(msg, additionalData...))
+	msg = pad(append(msg, ciphertext...))
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(additionalData)))
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(ciphertext)))
+	return poly1305(&polyKey, msg)
+}
+
+func (a *chacha20Poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != chachaNonceSize {
+		panic("quic: bad ChaCha20-Poly1305 nonce length")
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+poly1305TagSize)
+	ciphertext := out[:len(plaintext)]
+	chachaXOR(ciphertext, plaintext, &a.key, 1, nonce)
+	tag := a.tag(nonce, ciphertext, additionalData)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (a *chacha20Poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != chachaNonceSize {
+		panic("quic: bad ChaCha20-Poly1305 nonce length")
+	}
+	if len(ciphertext) < poly1305TagSize {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-poly1305TagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-poly1305TagSize]
+	want := a.tag(nonce, ciphertext, additionalData)
+	if subtle.ConstantTimeCompare(tag, want[:]) != 1 {
+		return nil, errOpen
+	}
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	chachaXOR(out, ciphertext, &a.key, 1, nonce)
+	return ret, nil
+}
+
+// sliceForAppend extends in by n bytes, returning the whole slice and
+// the n bytes appended.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	return head, head[len(in):]
+}
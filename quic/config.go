@@ -0,0 +1,138 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// A Config structure is used to configure a QUIC endpoint or
+// connection. A Config may be reused; this package does not modify
+// it.
+type Config struct {
+	// TLSConfig is the TLS configuration used by connections. It
+	// must not be nil, and its MinVersion is raised to TLS 1.3 if
+	// lower, since QUIC requires TLS 1.3. Servers must provide a
+	// certificate.
+	TLSConfig *tls.Config
+
+	// MaxBidiRemoteStreams limits the number of simultaneous
+	// bidirectional streams the peer may open.
+	// If zero, the default value of 100 is used.
+	// If negative, the peer may not open any.
+	MaxBidiRemoteStreams int64
+
+	// MaxUniRemoteStreams limits the number of simultaneous
+	// unidirectional streams the peer may open.
+	// If zero, the default value of 100 is used.
+	// If negative, the peer may not open any.
+	MaxUniRemoteStreams int64
+
+	// MaxStreamReadBufferSize is the flow control window of each
+	// stream: the maximum amount of data the peer may send on a
+	// stream beyond what has been read.
+	// If zero, the default value of 1 MiB is used.
+	MaxStreamReadBufferSize int64
+
+	// MaxStreamWriteBufferSize is the maximum amount of data
+	// buffered by a stream for sending, after which Write blocks.
+	// If zero, the default value of 1 MiB is used.
+	MaxStreamWriteBufferSize int64
+
+	// MaxConnReadBufferSize is the flow control window of the
+	// connection: the maximum amount of data the peer may send on
+	// all streams beyond what has been read.
+	// If zero, the default value of 1 MiB is used.
+	MaxConnReadBufferSize int64
+
+	// HandshakeTimeout is the maximum duration of the handshake of
+	// accepted connections. Dialed connections use the context
+	// passed to Dial instead.
+	// If zero, the default value of 10 seconds is used.
+	HandshakeTimeout time.Duration
+
+	// MaxIdleTimeout is the maximum duration a connection may be
+	// idle before it is discarded. The connection uses the smaller
+	// of this and the timeout advertised by the peer.
+	// If zero, the default value of 30 seconds is used.
+	// If negative, connections never time out, unless the peer
+	// advertises a timeout.
+	MaxIdleTimeout time.Duration
+
+	// KeepAlivePeriod, if positive, is the period after which an
+	// idle connection sends a PING to keep it alive. It should be
+	// well below MaxIdleTimeout.
+	KeepAlivePeriod time.Duration
+
+	// MaxPendingHandshakes limits the number of inbound connections
+	// whose handshake is in progress. The Initial packets of new
+	// connections beyond it are dropped, and the clients retransmit
+	// them later.
+	// If zero, the default value of 100 is used.
+	MaxPendingHandshakes int
+}
+
+func configDefault(v, def int64) int64 {
+	switch {
+	case v < 0:
+		return 0
+	case v == 0:
+		return def
+	}
+	return v
+}
+
+func (c *Config) maxBidiRemoteStreams() int64 {
+	return configDefault(c.MaxBidiRemoteStreams, 100)
+}
+
+func (c *Config) maxUniRemoteStreams() int64 {
+	return configDefault(c.MaxUniRemoteStreams, 100)
+}
+
+func (c *Config) maxStreamReadBufferSize() int64 {
+	return configDefault(c.MaxStreamReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxStreamWriteBufferSize() int64 {
+	return configDefault(c.MaxStreamWriteBufferSize, 1<<20)
+}
+
+func (c *Config) maxConnReadBufferSize() int64 {
+	return configDefault(c.MaxConnReadBufferSize, 1<<20)
+}
+
+func (c *Config) maxPendingHandshakes() int {
+	return int(configDefault(int64(c.MaxPendingHandshakes), 100))
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout > 0 {
+		return c.HandshakeTimeout
+	}
+	return 10 * time.Second
+}
+
+func (c *Config) maxIdleTimeout() time.Duration {
+	switch {
+	case c.MaxIdleTimeout < 0:
+		return 0
+	case c.MaxIdleTimeout == 0:
+		return 30 * time.Second
+	}
+	return c.MaxIdleTimeout
+}
+
+func (c *Config) tlsConfig() *tls.Config {
+	cfg := c.TLSConfig.Clone()
+	if cfg.MinVersion < tls.VersionTLS13 {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+	return cfg
+}
@@ -0,0 +1,549 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// A connSide distinguishes the client and server ends of a
+// connection.
+type connSide int8
+
+const (
+	clientSide connSide = iota
+	serverSide
+)
+
+// A connState is the state of a connection, RFC 9000, Section 10.
+type connState int8
+
+const (
+	connOpen     connState = iota
+	connClosing            // sent CONNECTION_CLOSE
+	connDraining           // received CONNECTION_CLOSE
+	connDone               // discarded
+)
+
+// A space holds the state of a packet number space.
+type space struct {
+	rkeys, wkeys *keys
+
+	// Received packets.
+	recvd        rangeset // received packet numbers
+	largestRecvd int64
+	largestTime  time.Time // when largestRecvd was received
+	unacked      int       // packets received since the last ACK was sent
+	ackEliciting int       // ack-eliciting packets received since the last ACK
+	ackDeadline  time.Time // when an ACK must be sent, if ackEliciting > 0
+
+	// Sent packets.
+	nextPNum     int64
+	sent         []*sentPacket
+	largestAcked int64
+	lossTime     time.Time
+	lastSent     time.Time // when the last ack-eliciting packet was sent
+	probe        bool      // an ack-eliciting packet must be sent
+
+	cryptoSend sendBuffer
+	cryptoRecv recvBuffer
+}
+
+// hasInFlight reports whether ack-eliciting packets await
+// acknowledgement.
+func (s *space) hasInFlight() bool {
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			return true
+		}
+	}
+	return false
+}
+
+// A Conn is a QUIC connection.
+//
+// Multiple goroutines may invoke methods on a Conn simultaneously.
+type Conn struct {
+	endpoint *Endpoint
+	config   *Config
+	side     connSide
+	peerAddr net.Addr
+
+	recvc chan []byte   // datagrams from the endpoint
+	wakec chan struct{} // wakes the connection loop
+	donec chan struct{} // closed when the connection loop exits
+
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced when the state changes
+
+	state    connState
+	closeErr error // error returned to users once closing
+	// CONNECTION_CLOSE to send while closing.
+	closeApp     bool
+	closeCode    uint64
+	closeReason  string
+	closePending bool
+	doneTime     time.Time // when a closing or draining connection is done
+
+	tls          *tls.QUICConn
+	spaces       [numberSpaceCount]space
+	localConnID  []byte
+	remoteConnID []byte
+	origConnID   []byte // destination connection ID of the client's first Initial
+	gotPeerID    bool   // client: remoteConnID was taken from the server
+
+	localParams transportParameters
+	peerParams  transportParameters
+	gotParams   bool
+
+	handshakeComplete  bool
+	handshakeConfirmed bool
+	handshakeDone      bool // server: HANDSHAKE_DONE must be sent
+	handshakeDeadline  time.Time
+	addrValidated      bool // server: the client's address is validated
+	bytesRecvd         int64
+	bytesSent          int64
+
+	// Key updates, RFC 9001, Section 6.
+	keyPhase  bool
+	nextRKeys *keys
+
+	rtt      rttState
+	cc       congestion
+	ptoCount int
+
+	idleTimeout  time.Duration
+	lastActivity time.Time
+
+	// Connection-level flow control.
+	maxData         int64 // limit on data sent, set by the peer
+	dataSent        int64
+	recvMaxData     int64 // limit on data received, set by us
+	dataRecvd       int64
+	dataRead        int64
+	maxDataPending  bool
+	pathResponses   []uint64
+	keepAlivePing   bool
+	lastAckElicited time.Time // when the last ack-eliciting packet was sent
+
+	streams streamsState
+}
+
+func newConn(e *Endpoint, side connSide, config *Config, peerAddr net.Addr, dcid, origDCID []byte, now time.Time) (*Conn, error) {
+	c := &Conn{
+		endpoint:     e,
+		config:       config,
+		side:         side,
+		peerAddr:     peerAddr,
+		recvc:        make(chan []byte, 64),
+		wakec:        make(chan struct{}, 1),
+		donec:        make(chan struct{}),
+		changed:      make(chan struct{}),
+		localConnID:  newConnID(),
+		remoteConnID: dcid,
+		origConnID:   origDCID,
+		rtt:          newRTTState(),
+		cc:           newCongestion(),
+		lastActivity: now,
+	}
+	for i := range c.spaces {
+		c.spaces[i].largestRecvd = -1
+		c.spaces[i].largestAcked = -1
+	}
+	ck, sk := initialKeys(origDCID)
+	if side == clientSide {
+		c.spaces[initialSpace].rkeys, c.spaces[initialSpace].wkeys = sk, ck
+	} else {
+		c.spaces[initialSpace].rkeys, c.spaces[initialSpace].wkeys = ck, sk
+	}
+	c.idleTimeout = config.maxIdleTimeout()
+	c.handshakeDeadline = now.Add(config.handshakeTimeout())
+	c.recvMaxData = config.maxConnReadBufferSize()
+	c.streams.init(config)
+
+	c.localParams = defaultTransportParameters()
+	c.localParams.maxIdleTimeout = c.idleTimeout
+	c.localParams.initialMaxData = c.recvMaxData
+	c.localParams.initialMaxStreamDataBidiLocal = config.maxStreamReadBufferSize()
+	c.localParams.initialMaxStreamDataBidiRemote = config.maxStreamReadBufferSize()
+	c.localParams.initialMaxStreamDataUni = config.maxStreamReadBufferSize()
+	c.localParams.initialMaxStreamsBidi = config.maxBidiRemoteStreams()
+	c.localParams.initialMaxStreamsUni = config.maxUniRemoteStreams()
+	c.localParams.maxAckDelay = maxAckDelay
+	c.localParams.disableActiveMigration = true
+	c.localParams.initialSrcConnID = c.localConnID
+	if side == serverSide {
+		c.localParams.originalDstConnID = origDCID
+	}
+
+	qconfig := &tls.QUICConfig{TLSConfig: config.tlsConfig()}
+	if side == clientSide {
+		c.tls = tls.QUICClient(qconfig)
+	} else {
+		c.tls = tls.QUICServer(qconfig)
+	}
+	c.tls.SetTransportParameters(c.localParams.marshal())
+	if err := c.tls.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	if err := c.handleTLSEvents(now); err != nil {
+		c.tls.Close()
+		return nil, err
+	}
+	e.addConn(c)
+	c.wake()
+	go c.loop()
+	return c, nil
+}
+
+func newConnID() []byte {
+	id := make([]byte, connIDLen)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.endpoint.LocalAddr()
+}
+
+// RemoteAddr returns the network address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.peerAddr
+}
+
+// ConnectionState returns basic TLS details about the connection.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tls.ConnectionState()
+}
+
+// Close closes the connection gracefully, with the application error
+// code 0. Streams that are open are abandoned.
+//
+// Close does not wait for the peer to acknowledge the closure; use
+// Wait for that.
+func (c *Conn) Close() error {
+	c.Abort(nil)
+	return nil
+}
+
+// Abort closes the connection with an error. If err is an
+// *ApplicationError, its code and reason are sent to the peer.
+// Otherwise, the connection is closed with the application error code
+// 0 and the text of err, if any, as the reason.
+func (c *Conn) Abort(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ae *ApplicationError
+	switch {
+	case errors.As(err, &ae):
+		c.enterClosing(errConnClosed, true, ae.Code, ae.Reason)
+	case err != nil:
+		c.enterClosing(errConnClosed, true, 0, err.Error())
+	default:
+		c.enterClosing(errConnClosed, true, 0, "")
+	}
+}
+
+// Wait waits for the connection to be closed, by either side, or for
+// ctx to be done. It returns the error that closed the connection:
+// an *ApplicationError or *TransportError if the peer closed it, or
+// another error if it was closed locally or timed out.
+func (c *Conn) Wait(ctx context.Context) error {
+	select {
+	case <-c.donec:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeErr
+}
+
+// notify wakes goroutines waiting for a change of state. It is
+// called with c.mu held.
+func (c *Conn) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait waits for a change of state or for ctx to be done. It is called
+// with c.mu held, which it releases while waiting.
+func (c *Conn) wait(ctx context.Context) error {
+	ch := c.changed
+	c.mu.Unlock()
+	defer c.mu.Lock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wake asks the connection loop to send any pending data.
+func (c *Conn) wake() {
+	select {
+	case c.wakec <- struct{}{}:
+	default:
+	}
+}
+
+// deliver passes a datagram received by the endpoint to the
+// connection.
+func (c *Conn) deliver(b []byte) {
+	select {
+	case c.recvc <- b:
+	default:
+		// Dropping the datagram under load is no different from
+		// losing it in the network.
+	}
+}
+
+func (c *Conn) loop() {
+	defer close(c.donec)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		select {
+		case b := <-c.recvc:
+			c.mu.Lock()
+			c.handleDatagram(b, time.Now())
+			c.mu.Unlock()
+		case <-c.wakec:
+		case <-timer.C:
+		}
+		c.mu.Lock()
+		now := time.Now()
+		c.handleTimers(now)
+		c.sendDatagrams(now)
+		done := c.state == connDone
+		next := c.nextTimeout(now)
+		c.mu.Unlock()
+		if done {
+			c.endpoint.removeConn(c)
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next.Sub(now))
+	}
+}
+
+// isClosed reports whether the connection is closing or closed, in
+// which case c.closeErr is set.
+func (c *Conn) isClosed() bool {
+	return c.state != connOpen
+}
+
+// enterClosing starts closing the connection, sending a
+// CONNECTION_CLOSE frame with the given code and reason.
+func (c *Conn) enterClosing(err error, app bool, code uint64, reason string) {
+	if c.state != connOpen {
+		return
+	}
+	c.state = connClosing
+	c.closeErr = err
+	c.closeApp, c.closeCode, c.closeReason = app, code, reason
+	c.closePending = true
+	c.doneTime = time.Now().Add(3 * c.rtt.pto(maxAckDelay))
+	c.tls.Close()
+	c.notify()
+	c.wake()
+}
+
+// abortTransport closes the connection because of a transport error.
+func (c *Conn) abortTransport(err error) {
+	var te *TransportError
+	if !errors.As(err, &te) {
+		te = &TransportError{Code: errInternal, Reason: err.Error()}
+	}
+	c.enterClosing(te, false, uint64(te.Code), te.Reason)
+}
+
+// enterDraining handles a CONNECTION_CLOSE frame from the peer.
+func (c *Conn) enterDraining(err error, now time.Time) {
+	if c.state == connDone || c.state == connDraining {
+		return
+	}
+	if c.state == connOpen {
+		c.closeErr = err
+		c.tls.Close()
+	}
+	c.state = connDraining
+	c.closePending = false
+	c.doneTime = now.Add(3 * c.rtt.pto(maxAckDelay))
+	c.notify()
+}
+
+// discard drops the connection immediately, without informing the
+// peer.
+func (c *Conn) discard(err error) {
+	if c.state == connDone {
+		return
+	}
+	if c.state == connOpen {
+		c.closeErr = err
+		c.tls.Close()
+	}
+	c.state = connDone
+	c.notify()
+}
+
+func (c *Conn) handleTimers(now time.Time) {
+	switch c.state {
+	case connDone:
+		return
+	case connClosing, connDraining:
+		if !now.Before(c.doneTime) {
+			c.discard(nil)
+		}
+		return
+	}
+	if !c.handshakeComplete && !now.Before(c.handshakeDeadline) {
+		c.discard(errIdleTimeout)
+		return
+	}
+	if c.idleTimeout > 0 && !now.Before(c.lastActivity.Add(c.idleTimeoutPTO())) {
+		c.discard(errIdleTimeout)
+		return
+	}
+	if p := c.config.KeepAlivePeriod; p > 0 && c.handshakeComplete && !now.Before(c.lastKeepAlive().Add(p)) {
+		c.keepAlivePing = true
+	}
+	for i := range c.spaces {
+		s := &c.spaces[i]
+		if !s.lossTime.IsZero() && !now.Before(s.lossTime) {
+			c.detectLosses(numberSpace(i), now)
+		}
+	}
+	if sp, t := c.ptoDeadline(now); !t.IsZero() && !now.Before(t) {
+		c.onPTO(sp, now)
+	}
+}
+
+// idleTimeoutPTO returns the idle timeout, which is at least three
+// times the probe timeout, RFC 9000, Section 10.1.
+func (c *Conn) idleTimeoutPTO() time.Duration {
+	min := 3 * c.rtt.pto(c.peerParams.maxAckDelay)
+	if c.idleTimeout < min {
+		return min
+	}
+	return c.idleTimeout
+}
+
+func (c *Conn) lastKeepAlive() time.Time {
+	if c.lastAckElicited.After(c.lastActivity) {
+		return c.lastAckElicited
+	}
+	return c.lastActivity
+}
+
+// nextTimeout returns the time at which handleTimers must next run.
+func (c *Conn) nextTimeout(now time.Time) time.Time {
+	next := now.Add(time.Hour)
+	at := func(t time.Time) {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	switch c.state {
+	case connDone:
+		return now
+	case connClosing, connDraining:
+		at(c.doneTime)
+		return next
+	}
+	if !c.handshakeComplete {
+		at(c.handshakeDeadline)
+	}
+	if c.idleTimeout > 0 {
+		at(c.lastActivity.Add(c.idleTimeoutPTO()))
+	}
+	if p := c.config.KeepAlivePeriod; p > 0 && c.handshakeComplete {
+		at(c.lastKeepAlive().Add(p))
+	}
+	for i := range c.spaces {
+		s := &c.spaces[i]
+		at(s.lossTime)
+		if s.ackEliciting > 0 {
+			at(s.ackDeadline)
+		}
+	}
+	_, pto := c.ptoDeadline(now)
+	at(pto)
+	return next
+}
+
+// setPeerParams validates and applies the peer's transport
+// parameters.
+func (c *Conn) setPeerParams(b []byte) error {
+	p, err := unmarshalTransportParameters(b)
+	if err != nil {
+		return err
+	}
+	if c.side == clientSide {
+		if string(p.originalDstConnID) != string(c.origConnID) {
+			return errTransportParam("original_destination_connection_id mismatch")
+		}
+		if p.retrySrcConnID != nil {
+			return errTransportParam("unexpected retry_source_connection_id")
+		}
+	} else if p.originalDstConnID != nil || p.retrySrcConnID != nil {
+		return errTransportParam("server-only parameter sent by client")
+	}
+	if string(p.initialSrcConnID) != string(c.remoteConnID) {
+		return errTransportParam("initial_source_connection_id mismatch")
+	}
+	c.peerParams = p
+	c.gotParams = true
+	if p.maxIdleTimeout > 0 && (c.idleTimeout == 0 || p.maxIdleTimeout < c.idleTimeout) {
+		c.idleTimeout = p.maxIdleTimeout
+	}
+	c.maxData = p.initialMaxData
+	c.streams.setPeerParams(&p)
+	return nil
+}
+
+// handshakeConfirm discards the Handshake keys once the handshake is
+// confirmed, RFC 9001, Section 4.1.2.
+func (c *Conn) handshakeConfirm() {
+	c.handshakeConfirmed = true
+	c.discardKeys(handshakeSpace)
+}
+
+// discardKeys discards the keys of a packet number space, and with
+// them all state of the space.
+func (c *Conn) discardKeys(sp numberSpace) {
+	s := &c.spaces[sp]
+	if s.wkeys == nil && s.rkeys == nil {
+		return
+	}
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			c.cc.onRemoved(p)
+		}
+	}
+	largestRecvd, largestAcked, next := s.largestRecvd, s.largestAcked, s.nextPNum
+	*s = space{largestRecvd: largestRecvd, largestAcked: largestAcked, nextPNum: next}
+	c.ptoCount = 0
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "time"
+
+// handleAck handles an ACK frame received in the given space.
+func (c *Conn) handleAck(sp numberSpace, acks rangeset, delay uint64, now time.Time) error {
+	s := &c.spaces[sp]
+	if acks.max() >= s.nextPNum {
+		return errProtocol("acknowledgement of unsent packet")
+	}
+	var newlyAcked []*sentPacket
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if acks.contains(p.pnum) {
+			newlyAcked = append(newlyAcked, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	if len(newlyAcked) == 0 {
+		return nil
+	}
+	largest := newlyAcked[len(newlyAcked)-1]
+	if largest.pnum > s.largestAcked {
+		s.largestAcked = largest.pnum
+		ackEliciting := false
+		for _, p := range newlyAcked {
+			ackEliciting = ackEliciting || p.ackEliciting
+		}
+		if largest.pnum == acks.max() && ackEliciting {
+			var ackDelay time.Duration
+			if sp == appDataSpace {
+				ackDelay = time.Duration(delay<<uint(c.peerParams.ackDelayExponent)) * time.Microsecond
+				if c.handshakeConfirmed && ackDelay > c.peerParams.maxAckDelay {
+					ackDelay = c.peerParams.maxAckDelay
+				}
+			}
+			c.rtt.update(now.Sub(largest.time), ackDelay)
+		}
+	}
+	for _, p := range newlyAcked {
+		if p.ackEliciting {
+			c.cc.onAcked(p)
+		}
+		for _, f := range p.frames {
+			c.frameAcked(sp, &f)
+		}
+	}
+	c.detectLosses(sp, now)
+	c.ptoCount = 0
+	c.notify()
+	return nil
+}
+
+// detectLosses declares packets lost, RFC 9002, Section 6.1.
+func (c *Conn) detectLosses(sp numberSpace, now time.Time) {
+	s := &c.spaces[sp]
+	s.lossTime = time.Time{}
+	if s.largestAcked < 0 {
+		return
+	}
+	lossDelay := c.rtt.lossDelay()
+	var lost []*sentPacket
+	kept := s.sent[:0]
+	for _, p := range s.sent {
+		if p.pnum > s.largestAcked {
+			kept = append(kept, p)
+			continue
+		}
+		if s.largestAcked-p.pnum >= packetThreshold || !p.time.Add(lossDelay).After(now) {
+			lost = append(lost, p)
+			continue
+		}
+		if t := p.time.Add(lossDelay); s.lossTime.IsZero() || t.Before(s.lossTime) {
+			s.lossTime = t
+		}
+		kept = append(kept, p)
+	}
+	for i := len(kept); i < len(s.sent); i++ {
+		s.sent[i] = nil
+	}
+	s.sent = kept
+	if len(lost) == 0 {
+		return
+	}
+	for _, p := range lost {
+		c.packetLost(sp, p)
+	}
+	c.cc.onCongestion(lost[len(lost)-1].time, now)
+}
+
+func (c *Conn) packetLost(sp numberSpace, p *sentPacket) {
+	if p.ackEliciting {
+		c.cc.onRemoved(p)
+	}
+	for _, f := range p.frames {
+		c.frameLost(sp, &f)
+	}
+}
+
+// ptoDeadline returns the space in which the probe timeout is armed,
+// and when it expires, RFC 9002, Section 6.2.
+func (c *Conn) ptoDeadline(now time.Time) (numberSpace, time.Time) {
+	if c.state != connOpen {
+		return 0, time.Time{}
+	}
+	backoff := time.Duration(1) << uint(c.ptoCount)
+	var (
+		deadline time.Time
+		dsp      numberSpace
+	)
+	for i := range c.spaces {
+		sp := numberSpace(i)
+		s := &c.spaces[i]
+		if s.wkeys == nil || !s.hasInFlight() {
+			continue
+		}
+		pto := c.rtt.pto(0)
+		if sp == appDataSpace {
+			if !c.handshakeComplete {
+				continue
+			}
+			pto = c.rtt.pto(c.peerParams.maxAckDelay)
+		}
+		t := s.lastSent.Add(pto * backoff)
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline, dsp = t, sp
+		}
+	}
+	if deadline.IsZero() && c.side == clientSide && !c.handshakeComplete {
+		// The server may be blocked by the anti-amplification
+		// limit; keep probing, RFC 9002, Section 6.2.2.1.
+		dsp = initialSpace
+		if c.spaces[handshakeSpace].wkeys != nil {
+			dsp = handshakeSpace
+		}
+		last := c.spaces[dsp].lastSent
+		if last.IsZero() {
+			last = now
+		}
+		deadline = last.Add(c.rtt.pto(0) * backoff)
+	}
+	return dsp, deadline
+}
+
+// onPTO handles the expiry of the probe timeout by retransmitting the
+// data in flight in the space.
+func (c *Conn) onPTO(sp numberSpace, now time.Time) {
+	c.ptoCount++
+	s := &c.spaces[sp]
+	var kept []*sentPacket
+	for _, p := range s.sent {
+		if p.ackEliciting {
+			c.packetLost(sp, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	s.sent = kept
+	s.probe = true
+	s.lastSent = now
+}
+
+// frameAcked is called when the packet carrying f is acknowledged.
+func (c *Conn) frameAcked(sp numberSpace, f *sentFrame) {
+	switch f.kind {
+	case sentCrypto:
+		c.spaces[sp].cryptoSend.ack(f.off, f.n, false)
+	case sentStream:
+		if st := c.streams.get(f.id); st != nil {
+			st.out.ack(f.off, f.n, f.fin)
+			c.streams.maybeRemove(c, st)
+		}
+	case sentResetStream:
+		if st := c.streams.get(f.id); st != nil {
+			st.resetAcked = true
+			c.streams.maybeRemove(c, st)
+		}
+	}
+}
+
+// frameLost is called when the packet carrying f is lost.
+func (c *Conn) frameLost(sp numberSpace, f *sentFrame) {
+	switch f.kind {
+	case sentCrypto:
+		c.spaces[sp].cryptoSend.lost(f.off, f.n, false)
+	case sentStream:
+		if st := c.streams.get(f.id); st != nil && !st.resetting() {
+			st.out.lost(f.off, f.n, f.fin)
+			c.streams.queue(st)
+		}
+	case sentResetStream:
+		if st := c.streams.get(f.id); st != nil && !st.resetAcked {
+			st.resetPending = true
+			c.streams.queue(st)
+		}
+	case sentStopSending:
+		if st := c.streams.get(f.id); st != nil && !st.inDone() {
+			st.stopPending = true
+			c.streams.queue(st)
+		}
+	case sentMaxStreamData:
+		if st := c.streams.get(f.id); st != nil && !st.inDone() {
+			st.maxDataPending = true
+			c.streams.queue(st)
+		}
+	case sentMaxData:
+		c.maxDataPending = true
+	case sentMaxStreamsBidi:
+		c.streams.maxStreamsPending[bidiStream] = true
+	case sentMaxStreamsUni:
+		c.streams.maxStreamsPending[uniStream] = true
+	case sentHandshakeDone:
+		c.handshakeDone = true
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// maxCryptoBuffer is the maximum amount of out-of-order crypto data
+// that is buffered.
+const maxCryptoBuffer = 64 << 10
+
+func (c *Conn) handleDatagram(b []byte, now time.Time) {
+	c.bytesRecvd += int64(len(b))
+	if c.state == connDone {
+		return
+	}
+	if c.state == connClosing {
+		// Respond to packets with another CONNECTION_CLOSE, in case
+		// the first one was lost.
+		c.closePending = true
+		return
+	}
+	if c.state == connDraining {
+		return
+	}
+	for len(b) > 0 {
+		n := c.handlePacket(b, now)
+		if n <= 0 || c.state != connOpen {
+			return
+		}
+		b = b[n:]
+	}
+}
+
+// handlePacket handles the packet at the start of b, and returns its
+// size, or a non-positive value if the rest of the datagram must be
+// dropped.
+func (c *Conn) handlePacket(b []byte, now time.Time) int {
+	var (
+		sp    numberSpace
+		pkt   []byte
+		pnOff int
+		h     longHeader
+	)
+	if isLongHeader(b[0]) {
+		var ok bool
+		h, ok = parseLongHeader(b)
+		if !ok {
+			return -1
+		}
+		switch {
+		case h.ptype == packetTypeVersionNegotiation:
+			if c.side == clientSide && !c.gotPeerID && string(h.dstConnID) == string(c.localConnID) {
+				c.discard(errors.New("quic: server does not support QUIC version 1"))
+			}
+			return -1
+		case h.version != quicVersion1:
+			return -1
+		case h.ptype == packetTypeInitial:
+			sp = initialSpace
+		case h.ptype == packetTypeHandshake:
+			sp = handshakeSpace
+		default:
+			// Retry and 0-RTT packets are not supported.
+			return h.end
+		}
+		pkt = b[:h.end]
+		pnOff = h.pnOff
+	} else {
+		sp = appDataSpace
+		pkt = b
+		pnOff = 1 + connIDLen
+	}
+	s := &c.spaces[sp]
+	if s.rkeys == nil {
+		return len(pkt)
+	}
+	k := s.rkeys
+	pnLen := k.unprotectHeader(pkt, pnOff)
+	if pnLen < 0 {
+		return -1
+	}
+	pnum := decodePacketNumber(s.largestRecvd, readPacketNumber(pkt[pnOff:], pnLen), pnLen)
+	keyUpdate := false
+	if sp == appDataSpace && (pkt[0]&headerKeyPhase != 0) != c.keyPhase {
+		if c.nextRKeys == nil {
+			var err error
+			if c.nextRKeys, err = k.next(); err != nil {
+				return len(pkt)
+			}
+		}
+		k = c.nextRKeys
+		keyUpdate = true
+	}
+	payload, err := k.open(pkt, pnOff+pnLen, pnum)
+	if err != nil {
+		return len(pkt)
+	}
+	if keyUpdate {
+		if pnum < s.largestRecvd {
+			// A reordered packet from the previous key phase would
+			// have been decrypted in the previous phase; this one
+			// is a forgery or a protocol error.
+			return len(pkt)
+		}
+		if err := c.updateKeys(); err != nil {
+			c.abortTransport(err)
+			return -1
+		}
+	}
+	reserved := byte(0x18)
+	if isLongHeader(pkt[0]) {
+		reserved = 0x0c
+	}
+	if pkt[0]&reserved != 0 {
+		c.abortTransport(errProtocol("reserved header bits set"))
+		return -1
+	}
+	if s.recvd.contains(pnum) {
+		return len(pkt)
+	}
+	if sp == initialSpace && c.side == clientSide && !c.gotPeerID {
+		c.remoteConnID = append([]byte(nil), h.srcConnID...)
+		c.gotPeerID = true
+	}
+	ackEliciting, err := c.handleFrames(sp, payload, now)
+	if err != nil {
+		c.abortTransport(err)
+		return -1
+	}
+	if c.state != connOpen {
+		return -1
+	}
+	c.lastActivity = now
+	s = &c.spaces[sp] // handling frames may have discarded the space
+	if s.rkeys == nil {
+		return len(pkt)
+	}
+	// Acknowledge out-of-order packets immediately, so that the
+	// peer detects losses quickly, RFC 9000, Section 13.2.1.
+	outOfOrder := pnum != s.largestRecvd+1
+	s.recvd.add(pnum, pnum+1)
+	if pnum > s.largestRecvd {
+		s.largestRecvd = pnum
+		s.largestTime = now
+	}
+	s.unacked++
+	if ackEliciting {
+		if s.ackEliciting == 0 {
+			s.ackDeadline = now.Add(maxAckDelay)
+		}
+		if outOfOrder {
+			s.ackDeadline = now
+		}
+		s.ackEliciting++
+	}
+	if c.side == serverSide && sp == handshakeSpace {
+		// A client that can decrypt Handshake packets received
+		// our Initial packets, RFC 9000, Section 8.1.
+		c.addrValidated = true
+		c.discardKeys(initialSpace)
+	}
+	return len(pkt)
+}
+
+// updateKeys switches to the next key phase at the request of the
+// peer.
+func (c *Conn) updateKeys() error {
+	s := &c.spaces[appDataSpace]
+	wkeys, err := s.wkeys.next()
+	if err != nil {
+		return err
+	}
+	s.rkeys, s.wkeys = c.nextRKeys, wkeys
+	c.nextRKeys = nil
+	c.keyPhase = !c.keyPhase
+	return nil
+}
+
+// handleFrames handles the frames in the payload of a packet, and
+// reports whether any of them is ack-eliciting.
+func (c *Conn) handleFrames(sp numberSpace, b []byte, now time.Time) (ackEliciting bool, err error) {
+	if len(b) == 0 {
+		return false, errProtocol("packet without frames")
+	}
+	for len(b) > 0 {
+		ftype := b[0]
+		if ftype > frameTypeHandshakeDone {
+			return false, errFrame("unknown frame type")
+		}
+		switch ftype {
+		case frameTypePadding, frameTypeAck, frameTypeAckECN,
+			frameTypeConnectionCloseTransport, frameTypeConnectionCloseApplication:
+		default:
+			ackEliciting = true
+		}
+		if sp != appDataSpace {
+			switch ftype {
+			case frameTypePadding, frameTypePing, frameTypeAck, frameTypeAckECN,
+				frameTypeCrypto, frameTypeConnectionCloseTransport:
+			default:
+				return false, errProtocol("frame not allowed in Initial or Handshake packet")
+			}
+		}
+		n := -1
+		switch ftype {
+		case frameTypePadding:
+			n = 1
+			for n < len(b) && b[n] == frameTypePadding {
+				n++
+			}
+		case frameTypePing:
+			n = 1
+		case frameTypeAck, frameTypeAckECN:
+			var acks rangeset
+			var delay uint64
+			acks, delay, n = consumeAckFrame(b)
+			if n > 0 {
+				err = c.handleAck(sp, acks, delay, now)
+			}
+		case frameTypeCrypto:
+			var off int64
+			var data []byte
+			off, data, n = consumeCryptoFrame(b)
+			if n > 0 {
+				err = c.handleCrypto(sp, off, data, now)
+			}
+		case frameTypeConnectionCloseTransport, frameTypeConnectionCloseApplication:
+			var app bool
+			var code uint64
+			var reason string
+			app, code, reason, n = consumeConnectionCloseFrame(b)
+			if n > 0 {
+				if app {
+					c.enterDraining(&ApplicationError{Code: code, Reason: reason}, now)
+				} else {
+					c.enterDraining(&TransportError{Code: TransportErrorCode(code), Reason: reason}, now)
+				}
+				return ackEliciting, nil
+			}
+		case frameTypeHandshakeDone:
+			n = 1
+			if c.side == serverSide {
+				return false, errProtocol("HANDSHAKE_DONE sent by client")
+			}
+			if !c.handshakeConfirmed {
+				c.handshakeConfirm()
+			}
+		case frameTypeNewToken:
+			if c.side == serverSide {
+				return false, errProtocol("NEW_TOKEN sent by client")
+			}
+			// Tokens are only useful for address validation of
+			// future connections, which this package does not do.
+			_, m := consumeVarintBytes(b[1:])
+			if m > 0 {
+				n = 1 + m
+			}
+		case frameTypeNewConnectionID:
+			// Only the connection IDs from the handshake are used,
+			// and no more are requested. A peer retiring them is
+			// not supported.
+			var retire int64
+			_, retire, _, n = consumeNewConnectionIDFrame(b)
+			if n > 0 && retire > 0 {
+				return false, &TransportError{Code: errConnectionIDLimit, Reason: "retiring the handshake connection ID is not supported"}
+			}
+		case frameTypeRetireConnectionID:
+			vs, m := consumeVarints(b[1:], 1)
+			if m > 0 {
+				n = 1 + m
+				if vs[0] > 0 {
+					return false, errProtocol("retired connection ID that was never issued")
+				}
+			}
+		case frameTypePathChallenge:
+			if len(b) >= 9 {
+				n = 9
+				c.pathResponses = append(c.pathResponses, binary.BigEndian.Uint64(b[1:9]))
+			}
+		case frameTypePathResponse:
+			if len(b) >= 9 {
+				n = 9
+			}
+		default:
+			n, err = c.handleStreamFrame(ftype, b, now)
+		}
+		if err != nil {
+			return false, err
+		}
+		if n <= 0 {
+			return false, errFrame("malformed frame")
+		}
+		b = b[n:]
+	}
+	return ackEliciting, nil
+}
+
+func (c *Conn) handleCrypto(sp numberSpace, off int64, data []byte, now time.Time) error {
+	r := &c.spaces[sp].cryptoRecv
+	if off+int64(len(data))-r.off > maxCryptoBuffer {
+		return &TransportError{Code: errCryptoBufferExceeded}
+	}
+	r.write(off, data)
+	b := r.readable()
+	if len(b) == 0 {
+		return nil
+	}
+	if err := c.tls.HandleData(tlsLevel(sp), b); err != nil {
+		return tlsError(err)
+	}
+	r.consume(len(b))
+	return c.handleTLSEvents(now)
+}
+
+func tlsLevel(sp numberSpace) tls.QUICEncryptionLevel {
+	switch sp {
+	case initialSpace:
+		return tls.QUICEncryptionLevelInitial
+	case handshakeSpace:
+		return tls.QUICEncryptionLevelHandshake
+	}
+	return tls.QUICEncryptionLevelApplication
+}
+
+// tlsError converts an error from crypto/tls into a CRYPTO_ERROR.
+func tlsError(err error) error {
+	var ae tls.AlertError
+	if errors.As(err, &ae) {
+		return &TransportError{Code: errTLSBase + TransportErrorCode(ae), Reason: err.Error()}
+	}
+	return &TransportError{Code: errInternal, Reason: err.Error()}
+}
+
+func (c *Conn) handleTLSEvents(now time.Time) error {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			var sp numberSpace
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				sp = handshakeSpace
+			case tls.QUICEncryptionLevelApplication:
+				sp = appDataSpace
+			default:
+				// 0-RTT is not supported.
+				continue
+			}
+			k, err := newKeys(e.Suite, append([]byte(nil), e.Data...), nil)
+			if err != nil {
+				return &TransportError{Code: errTLSBase + 40, Reason: err.Error()} // handshake_failure
+			}
+			if e.Kind == tls.QUICSetReadSecret {
+				c.spaces[sp].rkeys = k
+			} else {
+				c.spaces[sp].wkeys = k
+			}
+		case tls.QUICWriteData:
+			var sp numberSpace
+			switch e.Level {
+			case tls.QUICEncryptionLevelInitial:
+				sp = initialSpace
+			case tls.QUICEncryptionLevelHandshake:
+				sp = handshakeSpace
+			case tls.QUICEncryptionLevelApplication:
+				sp = appDataSpace
+			default:
+				continue
+			}
+			c.spaces[sp].cryptoSend.write(e.Data)
+		case tls.QUICTransportParameters:
+			if err := c.setPeerParams(append([]byte(nil), e.Data...)); err != nil {
+				return err
+			}
+		case tls.QUICTransportParametersRequired:
+			c.tls.SetTransportParameters(c.localParams.marshal())
+		case tls.QUICHandshakeDone:
+			if !c.gotParams {
+				return errTransportParam("missing transport parameters")
+			}
+			c.handshakeComplete = true
+			if c.side == serverSide {
+				c.handshakeDone = true
+				c.endpoint.accept(c)
+				c.handshakeConfirm()
+				if !c.config.TLSConfig.SessionTicketsDisabled {
+					c.tls.SendSessionTicket(tls.QUICSessionTicketOptions{})
+				}
+			}
+			c.notify()
+		}
+	}
+}
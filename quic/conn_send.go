@@ -0,0 +1,325 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "time"
+
+// maxDatagramsPerWake bounds the datagrams sent each time the
+// connection loop runs, so that received datagrams, including
+// acknowledgements, are processed in between.
+const maxDatagramsPerWake = 16
+
+// sendDatagrams sends datagrams until there is nothing left to send,
+// the congestion window or anti-amplification limit is reached, or
+// maxDatagramsPerWake datagrams were sent.
+func (c *Conn) sendDatagrams(now time.Time) {
+	for i := 0; i < maxDatagramsPerWake; i++ {
+		d := c.buildDatagram(now)
+		if d == nil {
+			return
+		}
+		c.bytesSent += int64(len(d))
+		c.endpoint.writeTo(d, c.peerAddr)
+	}
+	c.wake()
+}
+
+// A builtPacket is the payload of a packet being assembled into a
+// datagram.
+type builtPacket struct {
+	sp      numberSpace
+	hdrLen  int
+	payload []byte
+	sent    *sentPacket
+}
+
+// buildDatagram returns the next datagram to send, or nil.
+//
+// Packets are coalesced in two phases: the payloads of all spaces are
+// gathered first, so that the last one can be padded when the
+// datagram carries an Initial packet, RFC 9000, Section 14.1, and are
+// then protected.
+func (c *Conn) buildDatagram(now time.Time) []byte {
+	if c.state == connDone || c.state == connDraining {
+		return nil
+	}
+	if c.state == connClosing && !c.closePending {
+		return nil
+	}
+	limit := maxDatagramSize
+	if c.side == serverSide && !c.addrValidated {
+		// RFC 9000, Section 8.1.
+		if allowed := 3*c.bytesRecvd - c.bytesSent; allowed < int64(limit) {
+			limit = int(allowed)
+		}
+	}
+	var (
+		pkts []builtPacket
+		size int
+	)
+	for sp := initialSpace; sp < numberSpaceCount; sp++ {
+		s := &c.spaces[sp]
+		if s.wkeys == nil {
+			continue
+		}
+		hdrLen := c.headerLen(sp)
+		room := limit - size - hdrLen - aeadOverhead
+		if room < 32 {
+			break
+		}
+		payload, sent := c.appendFrames(sp, room, now)
+		if len(payload) == 0 {
+			continue
+		}
+		pkts = append(pkts, builtPacket{sp, hdrLen, payload, sent})
+		size += hdrLen + len(payload) + aeadOverhead
+	}
+	if c.state == connClosing {
+		c.closePending = false
+	}
+	if len(pkts) == 0 {
+		return nil
+	}
+	pad := false
+	for _, p := range pkts {
+		if p.sp == initialSpace && (c.side == clientSide || p.sent.ackEliciting) {
+			pad = true
+		}
+	}
+	if pad && size < minInitialDatagramSize {
+		extra := minInitialDatagramSize - size
+		if extra > limit-size {
+			extra = limit - size
+		}
+		last := &pkts[len(pkts)-1]
+		last.payload = append(last.payload, make([]byte, extra)...)
+		size += extra
+	}
+
+	d := make([]byte, 0, size)
+	sentHandshake := false
+	for _, p := range pkts {
+		s := &c.spaces[p.sp]
+		pnum := s.nextPNum
+		s.nextPNum++
+		start := len(d)
+		switch p.sp {
+		case initialSpace, handshakeSpace:
+			ptype := packetTypeInitial
+			if p.sp == handshakeSpace {
+				ptype = packetTypeHandshake
+				sentHandshake = true
+			}
+			var lenOff int
+			d, lenOff = appendLongHeader(d, ptype, c.remoteConnID, c.localConnID, nil, pnum)
+			setLongHeaderLength(d, lenOff, pnLen+len(p.payload)+aeadOverhead)
+		default:
+			d = appendShortHeader(d, c.remoteConnID, c.keyPhase, pnum)
+		}
+		pnOff := len(d) - start - pnLen
+		d = append(d, p.payload...)
+		pkt := s.wkeys.protect(d[start:], pnOff, pnLen, pnum)
+		d = append(d[:start], pkt...)
+
+		p.sent.pnum = pnum
+		p.sent.time = now
+		p.sent.size = len(pkt)
+		if p.sent.ackEliciting || len(p.sent.frames) > 0 {
+			s.sent = append(s.sent, p.sent)
+		}
+		if p.sent.ackEliciting {
+			c.cc.onSent(len(pkt))
+			s.lastSent = now
+			c.lastAckElicited = now
+		}
+	}
+	if sentHandshake && c.side == clientSide {
+		// RFC 9001, Section 4.9.1.
+		c.discardKeys(initialSpace)
+	}
+	return d
+}
+
+// headerLen returns the size of the header of packets sent in sp.
+func (c *Conn) headerLen(sp numberSpace) int {
+	if sp == appDataSpace {
+		return 1 + len(c.remoteConnID) + pnLen
+	}
+	n := 1 + 4 + 1 + len(c.remoteConnID) + 1 + len(c.localConnID) + 2 + pnLen
+	if sp == initialSpace {
+		n++ // empty token
+	}
+	return n
+}
+
+// appendFrames returns the payload of the next packet to send in sp,
+// of at most room bytes, and a record of what it carries. It returns
+// an empty payload if the space has nothing to send.
+func (c *Conn) appendFrames(sp numberSpace, room int, now time.Time) ([]byte, *sentPacket) {
+	s := &c.spaces[sp]
+	sent := &sentPacket{}
+	b := make([]byte, 0, room)
+
+	if c.state == connClosing {
+		app, code, reason := c.closeApp, c.closeCode, c.closeReason
+		if app && sp != appDataSpace {
+			// Application errors must not be revealed before the
+			// handshake completes, RFC 9000, Section 10.2.3.
+			app, code, reason = false, uint64(errApplicationError), ""
+		}
+		if max := room - 1 - 8 - 8 - 2; len(reason) > max {
+			reason = reason[:max]
+		}
+		return appendConnectionCloseFrame(b, app, code, reason), sent
+	}
+
+	ackRequired := s.ackEliciting > 0 &&
+		(sp != appDataSpace || s.ackEliciting >= 2 || !now.Before(s.ackDeadline))
+	ackSent := false
+	if s.unacked > 0 && len(s.recvd) > 0 {
+		delay := now.Sub(s.largestTime).Microseconds() >> uint(c.localParams.ackDelayExponent)
+		if delay < 0 {
+			delay = 0
+		}
+		ack := appendAckFrame(nil, s.recvd, uint64(delay))
+		if len(ack) <= room {
+			b = append(b, ack...)
+			ackSent = true
+		}
+	}
+	start := len(b)
+	if s.probe || c.cc.canSend() {
+		b = c.appendElicitingFrames(sp, b, room, sent)
+		if len(b) == start && (s.probe || sp == appDataSpace && c.keepAlivePing) {
+			b = append(b, frameTypePing)
+		}
+	}
+	if len(b) == start && !ackRequired {
+		return nil, nil
+	}
+	if ackSent {
+		s.unacked = 0
+		s.ackEliciting = 0
+	}
+	if len(b) > start {
+		sent.ackEliciting = true
+		s.probe = false
+		if sp == appDataSpace {
+			c.keepAlivePing = false
+		}
+	}
+	return b, sent
+}
+
+// appendElicitingFrames appends the ack-eliciting frames pending in
+// sp that fit in room, recording those that must be retransmitted if
+// lost in sent.
+func (c *Conn) appendElicitingFrames(sp numberSpace, b []byte, room int, sent *sentPacket) []byte {
+	s := &c.spaces[sp]
+	left := func() int { return room - len(b) }
+	if sp == appDataSpace {
+		if c.handshakeDone && left() >= 1 {
+			b = append(b, frameTypeHandshakeDone)
+			sent.frames = append(sent.frames, sentFrame{kind: sentHandshakeDone})
+			c.handshakeDone = false
+		}
+		for len(c.pathResponses) > 0 && left() >= 9 {
+			b = appendPathResponseFrame(b, c.pathResponses[0])
+			c.pathResponses = c.pathResponses[1:]
+		}
+		if c.maxDataPending && left() >= 9 {
+			b = appendIntFrame(b, frameTypeMaxData, c.recvMaxData)
+			sent.frames = append(sent.frames, sentFrame{kind: sentMaxData})
+			c.maxDataPending = false
+		}
+		ss := &c.streams
+		if ss.maxStreamsPending[bidiStream] && left() >= 9 {
+			b = appendIntFrame(b, frameTypeMaxStreamsBidi, ss.remoteMax[bidiStream])
+			sent.frames = append(sent.frames, sentFrame{kind: sentMaxStreamsBidi})
+			ss.maxStreamsPending[bidiStream] = false
+		}
+		if ss.maxStreamsPending[uniStream] && left() >= 9 {
+			b = appendIntFrame(b, frameTypeMaxStreamsUni, ss.remoteMax[uniStream])
+			sent.frames = append(sent.frames, sentFrame{kind: sentMaxStreamsUni})
+			ss.maxStreamsPending[uniStream] = false
+		}
+	}
+	for s.cryptoSend.pending(maxVarint) {
+		max := left() - sizeCryptoFrameHeader(s.cryptoSend.end, room)
+		if max <= 0 {
+			break
+		}
+		off, data, _ := s.cryptoSend.next(max, maxVarint)
+		if len(data) == 0 {
+			break
+		}
+		b = appendCryptoFrame(b, off, data)
+		s.cryptoSend.markSent(off, len(data), false)
+		sent.frames = append(sent.frames, sentFrame{kind: sentCrypto, off: off, n: len(data)})
+	}
+	if sp != appDataSpace {
+		return b
+	}
+	ss := &c.streams
+	for n := len(ss.sendq); n > 0 && left() > 0; n-- {
+		st := ss.sendq[0]
+		ss.sendq[0] = nil
+		ss.sendq = ss.sendq[1:]
+		b = c.appendStreamFrames(st, b, room, sent)
+		if st.hasPending(c) {
+			ss.sendq = append(ss.sendq, st)
+		} else {
+			st.queued = false
+		}
+	}
+	return b
+}
+
+// appendStreamFrames appends the frames pending for st that fit in
+// room.
+func (c *Conn) appendStreamFrames(st *Stream, b []byte, room int, sent *sentPacket) []byte {
+	const maxIntFrame = 1 + 8 + 8
+	if st.removed {
+		return b
+	}
+	if st.stopPending && room-len(b) >= maxIntFrame {
+		b = appendStopSendingFrame(b, st.id, 0)
+		sent.frames = append(sent.frames, sentFrame{kind: sentStopSending, id: st.id})
+		st.stopPending = false
+	}
+	if st.maxDataPending && room-len(b) >= maxIntFrame {
+		b = appendStreamIntFrame(b, frameTypeMaxStreamData, st.id, st.inMaxData)
+		sent.frames = append(sent.frames, sentFrame{kind: sentMaxStreamData, id: st.id})
+		st.maxDataPending = false
+	}
+	if st.resetPending && room-len(b) >= maxIntFrame+8 {
+		b = appendResetStreamFrame(b, st.id, st.resetCode, st.out.sentMax)
+		sent.frames = append(sent.frames, sentFrame{kind: sentResetStream, id: st.id})
+		st.resetPending = false
+		st.resetSent = true
+	}
+	if !st.hasOut || st.resetting() {
+		return b
+	}
+	for limit := st.sendLimit(c); st.out.pending(limit); limit = st.sendLimit(c) {
+		max := room - len(b) - sizeStreamFrameHeader(st.id, st.out.end, room)
+		if max < 0 {
+			break
+		}
+		off, data, fin := st.out.next(max, limit)
+		if len(data) == 0 && !fin {
+			break
+		}
+		b = appendStreamFrame(b, st.id, off, data, fin)
+		prev := st.out.sentMax
+		st.out.markSent(off, len(data), fin)
+		c.dataSent += st.out.sentMax - prev
+		sent.frames = append(sent.frames, sentFrame{kind: sentStream, id: st.id, off: off, n: len(data), fin: fin})
+	}
+	return b
+}
@@ -0,0 +1,339 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testCert = func() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}()
+
+func testConfigs() (server, client *Config) {
+	server = &Config{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{testCert},
+		NextProtos:   []string{"test"},
+	}}
+	client = &Config{TLSConfig: &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"test"},
+	}}
+	return server, client
+}
+
+// newTestConns returns a connected client and server. A non-nil wrap
+// is applied to the client's PacketConn.
+func newTestConns(t *testing.T, wrap func(net.PacketConn) net.PacketConn) (client, server *Conn) {
+	t.Helper()
+	sconf, cconf := testConfigs()
+	se, err := Listen("udp", "127.0.0.1:0", sconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		pc = wrap(pc)
+	}
+	ce := NewEndpoint(pc, nil)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ce.Close(ctx)
+		se.Close(ctx)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err = ce.Dial(ctx, "udp", se.LocalAddr().String(), cconf)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	server, err = se.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	return client, server
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestHandshake(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	if got := client.ConnectionState().NegotiatedProtocol; got != "test" {
+		t.Errorf("client NegotiatedProtocol = %q; want %q", got, "test")
+	}
+	if got := server.ConnectionState().ServerName; got != "example.com" {
+		t.Errorf("server ServerName = %q; want %q", got, "example.com")
+	}
+}
+
+func TestStreamEcho(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	ctx := testContext(t)
+	go func() {
+		s, err := server.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		io.Copy(s, s)
+		s.CloseWrite()
+	}()
+	s, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReadContext(ctx)
+	want := []byte("hello, world")
+	if _, err := s.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	s.CloseWrite()
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %q; want %q", got, want)
+	}
+}
+
+// testTransfer sends size bytes from the client to the server on each
+// of n concurrent streams and checks that they arrive intact.
+func testTransfer(t *testing.T, client, server *Conn, n, size int) {
+	ctx := testContext(t)
+	data := make([]byte, size)
+	rand.Read(data)
+	var wg sync.WaitGroup
+	errc := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s, err := client.NewSendOnlyStream(ctx)
+			if err != nil {
+				errc <- err
+				return
+			}
+			s.SetWriteContext(ctx)
+			if _, err := s.Write(data); err != nil {
+				errc <- err
+			}
+			s.CloseWrite()
+		}()
+		go func() {
+			defer wg.Done()
+			s, err := server.AcceptStream(ctx)
+			if err != nil {
+				errc <- err
+				return
+			}
+			s.SetReadContext(ctx)
+			got, err := io.ReadAll(s)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if !bytes.Equal(got, data) {
+				errc <- errors.New("stream data mismatch")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+func TestLargeTransfer(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	testTransfer(t, client, server, 1, 4<<20)
+}
+
+func TestMultipleStreams(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	testTransfer(t, client, server, 150, 10<<10)
+}
+
+// lossyPacketConn drops every dropEvery-th datagram it sends and
+// receives.
+type lossyPacketConn struct {
+	net.PacketConn
+	dropEvery int
+
+	mu sync.Mutex
+	n  int
+}
+
+func (c *lossyPacketConn) drop() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return c.n%c.dropEvery == 0
+}
+
+func (c *lossyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil || !c.drop() {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.drop() {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+func TestLossyTransfer(t *testing.T) {
+	client, server := newTestConns(t, func(pc net.PacketConn) net.PacketConn {
+		return &lossyPacketConn{PacketConn: pc, dropEvery: 10}
+	})
+	testTransfer(t, client, server, 4, 64<<10)
+}
+
+func TestStreamReset(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	ctx := testContext(t)
+	s, err := client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("x"))
+	ss, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.SetReadContext(ctx)
+	if _, err := ss.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	s.Reset(42)
+	var se *StreamError
+	if _, err := ss.Read(make([]byte, 1)); !errors.As(err, &se) || se.Code != 42 {
+		t.Errorf("Read after reset = %v; want StreamError with code 42", err)
+	}
+
+	// STOP_SENDING stops the writer.
+	s, err = client.NewStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("x"))
+	if ss, err = server.AcceptStream(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ss.CloseRead()
+	s.SetWriteContext(ctx)
+	for {
+		_, err := s.Write(make([]byte, 1024))
+		if err == nil {
+			continue
+		}
+		if !errors.As(err, &se) || se.Code != 0 {
+			t.Errorf("Write after STOP_SENDING = %v; want StreamError with code 0", err)
+		}
+		break
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	client, server := newTestConns(t, nil)
+	ctx := testContext(t)
+	client.Abort(&ApplicationError{Code: 7, Reason: "bye"})
+	err := server.Wait(ctx)
+	var ae *ApplicationError
+	if !errors.As(err, &ae) || ae.Code != 7 || ae.Reason != "bye" {
+		t.Errorf("server.Wait() = %v; want ApplicationError 7 \"bye\"", err)
+	}
+	if _, err := server.AcceptStream(ctx); err == nil {
+		t.Error("AcceptStream on closed connection succeeded")
+	}
+}
+
+func TestDialNoServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	_, cconf := testConfigs()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := Dial(ctx, "udp", addr, cconf); err == nil {
+		t.Fatal("Dial succeeded without a server")
+	}
+}
+
+func TestMaxPendingHandshakes(t *testing.T) {
+	sconf, _ := testConfigs()
+	sconf.MaxPendingHandshakes = 1
+	se, err := Listen("udp", "127.0.0.1:0", sconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		se.Close(ctx)
+	}()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	// Initial packets which never complete a handshake.
+	for i := 0; i < 3; i++ {
+		b, _ := appendLongHeader(nil, packetTypeInitial, newConnID(), newConnID(), nil, 0)
+		b = append(b, make([]byte, minInitialDatagramSize-len(b))...)
+		se.handleDatagram(b, addr)
+	}
+	se.mu.Lock()
+	pending, conns := len(se.pending), len(se.connList())
+	se.mu.Unlock()
+	if pending != 1 || conns != 1 {
+		t.Errorf("got %d pending handshakes and %d connections; want 1 and 1", pending, conns)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "crypto/sha512" // for crypto.SHA384
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// initialSalt is the salt from which Initial secrets are derived,
+// RFC 9001, Section 5.2.
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+var errUnsupportedSuite = errors.New("quic: unsupported cipher suite")
+
+// headerProtectionSampleSize is the size of the ciphertext sample used
+// for header protection.
+const headerProtectionSampleSize = 16
+
+// aeadOverhead is the size of the authentication tag added by all
+// supported AEADs.
+const aeadOverhead = 16
+
+// keys are the packet protection keys for one direction of one
+// encryption level.
+type keys struct {
+	suite  uint16
+	secret []byte
+	aead   cipher.AEAD
+	iv     []byte
+	hp     headerProtector
+}
+
+// A headerProtector computes the masks of header protection, RFC 9001,
+// Section 5.4, from samples of ciphertext.
+type headerProtector interface {
+	mask(sample []byte) [5]byte
+}
+
+// aesHeaderProtector is the header protection of the AES suites, RFC
+// 9001, Section 5.4.3.
+type aesHeaderProtector struct {
+	block cipher.Block
+}
+
+func (hp aesHeaderProtector) mask(sample []byte) (mask [5]byte) {
+	var b [aes.BlockSize]byte
+	hp.block.Encrypt(b[:], sample[:headerProtectionSampleSize])
+	copy(mask[:], b[:])
+	return mask
+}
+
+// chachaHeaderProtector is the header protection of
+// TLS_CHACHA20_POLY1305_SHA256, RFC 9001, Section 5.4.4: the mask is
+// the key stream of the counter and nonce taken from the sample.
+type chachaHeaderProtector struct {
+	key *[chachaKeySize]byte
+}
+
+func (hp chachaHeaderProtector) mask(sample []byte) (mask [5]byte) {
+	counter := binary.LittleEndian.Uint32(sample[0:4])
+	var b [64]byte
+	chachaBlock(&b, hp.key, counter, sample[4:headerProtectionSampleSize])
+	copy(mask[:], b[:])
+	return mask
+}
+
+func (k *keys) isSet() bool {
+	return k != nil && k.aead != nil
+}
+
+// newKeys derives packet protection keys from a TLS traffic secret.
+// Header protection keys are not updated by key updates, so hp may
+// carry the header protection key of the previous key phase.
+func newKeys(suite uint16, secret []byte, hp headerProtector) (*keys, error) {
+	h, keyLen, err := suiteParams(suite)
+	if err != nil {
+		return nil, err
+	}
+	key := hkdfExpandLabel(h, secret, "quic key", keyLen)
+	hpKey := hkdfExpandLabel(h, secret, "quic hp", keyLen)
+	var aead cipher.AEAD
+	if suite == tls.TLS_CHACHA20_POLY1305_SHA256 {
+		if aead, err = newChaCha20Poly1305(key); err != nil {
+			return nil, err
+		}
+		if hp == nil {
+			chachaHP := chachaHeaderProtector{key: new([chachaKeySize]byte)}
+			copy(chachaHP.key[:], hpKey)
+			hp = chachaHP
+		}
+	} else {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		if hp == nil {
+			hpBlock, err := aes.NewCipher(hpKey)
+			if err != nil {
+				return nil, err
+			}
+			hp = aesHeaderProtector{hpBlock}
+		}
+	}
+	return &keys{
+		suite:  suite,
+		secret: secret,
+		aead:   aead,
+		iv:     hkdfExpandLabel(h, secret, "quic iv", aead.NonceSize()),
+		hp:     hp,
+	}, nil
+}
+
+// next returns the keys of the next key phase, RFC 9001, Section 6.
+func (k *keys) next() (*keys, error) {
+	h, _, err := suiteParams(k.suite)
+	if err != nil {
+		return nil, err
+	}
+	secret := hkdfExpandLabel(h, k.secret, "quic ku", len(k.secret))
+	return newKeys(k.suite, secret, k.hp)
+}
+
+func suiteParams(suite uint16) (h crypto.Hash, keyLen int, err error) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		return crypto.SHA256, 16, nil
+	case tls.TLS_AES_256_GCM_SHA384:
+		return crypto.SHA384, 32, nil
+	case tls.TLS_CHACHA20_POLY1305_SHA256:
+		return crypto.SHA256, chachaKeySize, nil
+	}
+	return 0, 0, errUnsupportedSuite
+}
+
+// initialKeys returns the client and server Initial keys for a
+// connection whose client chose the destination connection ID cid.
+func initialKeys(cid []byte) (client, server *keys) {
+	initial := hkdfExtract(sha256.New, initialSalt, cid)
+	cs := hkdfExpandLabel(crypto.SHA256, initial, "client in", sha256.Size)
+	ss := hkdfExpandLabel(crypto.SHA256, initial, "server in", sha256.Size)
+	// The suite is fixed and supported, so errors cannot happen.
+	client, _ = newKeys(tls.TLS_AES_128_GCM_SHA256, cs, nil)
+	server, _ = newKeys(tls.TLS_AES_128_GCM_SHA256, ss, nil)
+	return client, server
+}
+
+func hkdfExtract(h func() hash.Hash, salt, ikm []byte) []byte {
+	mac := hmac.New(h, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label from RFC 8446,
+// Section 7.1, with an empty context.
+func hkdfExpandLabel(h crypto.Hash, secret []byte, label string, length int) []byte {
+	info := make([]byte, 0, 4+len("tls13 ")+len(label))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len("tls13 ")+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0) // context
+	mac := hmac.New(h.New, secret)
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+func (k *keys) nonce(pnum int64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(uint64(pnum) >> (8 * i))
+	}
+	return nonce
+}
+
+// protect encrypts the payload of the packet in pkt, whose header
+// occupies pkt[:pnOff+pnLen] and whose payload occupies the rest,
+// and applies header protection. It returns the protected packet,
+// which extends pkt by the authentication tag.
+func (k *keys) protect(pkt []byte, pnOff, pnLen int, pnum int64) []byte {
+	hdr := pkt[:pnOff+pnLen]
+	payload := pkt[pnOff+pnLen:]
+	pkt = k.aead.Seal(hdr, k.nonce(pnum), payload, hdr)
+	mask := k.headerMask(pkt[pnOff+4:])
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+	}
+	return pkt
+}
+
+func (k *keys) headerMask(sample []byte) [5]byte {
+	return k.hp.mask(sample)
+}
+
+// unprotectHeader removes header protection from the packet in pkt,
+// whose packet number starts at pnOff, in place. It returns the
+// length of the packet number, or -1 if pkt is too short.
+func (k *keys) unprotectHeader(pkt []byte, pnOff int) int {
+	if len(pkt) < pnOff+4+headerProtectionSampleSize {
+		return -1
+	}
+	mask := k.headerMask(pkt[pnOff+4:])
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	pnLen := int(pkt[0]&0x03) + 1
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOff+i] ^= mask[1+i]
+	}
+	return pnLen
+}
+
+// open decrypts the payload of a packet whose header protection has
+// been removed. The plaintext is written over the ciphertext.
+func (k *keys) open(pkt []byte, hdrLen int, pnum int64) ([]byte, error) {
+	hdr := pkt[:hdrLen]
+	return k.aead.Open(pkt[hdrLen:hdrLen], k.nonce(pnum), pkt[hdrLen:], hdr)
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestInitialKeys(t *testing.T) {
+	// Test vectors from RFC 9001, Appendix A.1.
+	client, server := initialKeys(unhex("8394c8f03e515708"))
+	for _, tt := range []struct {
+		name    string
+		k       *keys
+		key, iv string
+		hp      string
+	}{
+		{"client", client, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{"server", server, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+	} {
+		if !bytes.Equal(tt.k.iv, unhex(tt.iv)) {
+			t.Errorf("%s iv = %x; want %s", tt.name, tt.k.iv, tt.iv)
+		}
+		// Compare keys by their effect, since cipher.AEAD and
+		// cipher.Block do not expose them.
+		block, _ := aes.NewCipher(unhex(tt.hp))
+		in := make([]byte, 16)
+		want := make([]byte, 16)
+		block.Encrypt(want, in)
+		if got := tt.k.hp.mask(in); !bytes.Equal(got[:], want[:5]) {
+			t.Errorf("%s hp key mismatch", tt.name)
+		}
+		kb, _ := aes.NewCipher(unhex(tt.key))
+		aead, _ := cipher.NewGCM(kb)
+		if got, want := tt.k.aead.Seal(nil, tt.k.iv, nil, nil), aead.Seal(nil, tt.k.iv, nil, nil); !bytes.Equal(got, want) {
+			t.Errorf("%s key mismatch", tt.name)
+		}
+	}
+}
+
+func TestProtect(t *testing.T) {
+	client, _ := initialKeys(unhex("8394c8f03e515708"))
+	for _, hdr := range [][]byte{
+		unhex("c300000001088394c8f03e5157080000449e00000002"), // long header
+		unhex("4300000000000000000000000002"),                 // short header
+	} {
+		pnOff := len(hdr) - 4
+		payload := bytes.Repeat([]byte{0x01}, 20)
+		pkt := append(append([]byte{}, hdr...), payload...)
+		pkt = client.protect(pkt, pnOff, 4, 2)
+		if bytes.Equal(pkt[:len(hdr)], hdr) {
+			t.Errorf("header %x not protected", hdr)
+		}
+		if pnLen := client.unprotectHeader(pkt, pnOff); pnLen != 4 {
+			t.Fatalf("unprotectHeader = %d; want 4", pnLen)
+		}
+		if !bytes.Equal(pkt[:len(hdr)], hdr) {
+			t.Errorf("unprotected header = %x; want %x", pkt[:len(hdr)], hdr)
+		}
+		got, err := client.open(pkt, len(hdr), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("payload = %x; want %x", got, payload)
+		}
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	client, _ := initialKeys(unhex("8394c8f03e515708"))
+	next, err := client.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.hp != client.hp {
+		t.Error("header protection key changed by key update")
+	}
+	if bytes.Equal(next.secret, client.secret) || bytes.Equal(next.iv, client.iv) {
+		t.Error("packet protection key not changed by key update")
+	}
+}
+
+func TestChaCha20Poly1305Packet(t *testing.T) {
+	// Test vectors from RFC 9001, Appendix A.5.
+	k, err := newKeys(tls.TLS_CHACHA20_POLY1305_SHA256, unhex("9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "e0459b3474bdd0e44a41c144"; !bytes.Equal(k.iv, unhex(want)) {
+		t.Errorf("iv = %x; want %s", k.iv, want)
+	}
+	const pnum = 654360564
+	hdr := unhex("4200bff4")
+	pkt := k.protect(append(append([]byte{}, hdr...), 0x01), 1, 3, pnum)
+	if want := "4cfe4189655e5cd55c41f69080575d7999c25a5bfb"; !bytes.Equal(pkt, unhex(want)) {
+		t.Errorf("protected packet = %x; want %s", pkt, want)
+	}
+	if pnLen := k.unprotectHeader(pkt, 1); pnLen != 3 {
+		t.Fatalf("unprotectHeader = %d; want 3", pnLen)
+	}
+	got, err := k.open(pkt, len(hdr), pnum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x01}) {
+		t.Errorf("payload = %x; want 01", got)
+	}
+	next, err := k.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1223504755036d556342ee9361d253421a826c9ecdf3c7148684b36b714881f9"; !bytes.Equal(next.secret, unhex(want)) {
+		t.Errorf("next secret = %x; want %s", next.secret, want)
+	}
+}
+
+func TestPoly1305(t *testing.T) {
+	// Test vector from RFC 8439, Section 2.5.2.
+	var key [32]byte
+	copy(key[:], unhex("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b"))
+	tag := poly1305(&key, []byte("Cryptographic Forum Research Group"))
+	if want := "a8061dc1305136c6c22b8baf0c0127a9"; !bytes.Equal(tag[:], unhex(want)) {
+		t.Errorf("tag = %x; want %s", tag, want)
+	}
+}
+
+func TestChaCha20Poly1305Tampered(t *testing.T) {
+	a, err := newChaCha20Poly1305(bytes.Repeat([]byte{7}, chachaKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, chachaNonceSize)
+	sealed := a.Seal(nil, nonce, []byte("hello, world"), []byte("ad"))
+	if got, err := a.Open(nil, nonce, sealed, []byte("ad")); err != nil || string(got) != "hello, world" {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+	sealed[0] ^= 1
+	if _, err := a.Open(nil, nonce, sealed, []byte("ad")); err == nil {
+		t.Error("Open of a tampered message succeeded")
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxUDPPayload is the size of the buffer datagrams are read into.
+const maxUDPPayload = 65536
+
+// An Endpoint handles QUIC traffic on a network address. It can
+// accept inbound connections, if created with a Config, and dial
+// outbound ones.
+//
+// Multiple goroutines may invoke methods on an Endpoint
+// simultaneously.
+type Endpoint struct {
+	pc      net.PacketConn
+	config  *Config // for accepted connections; nil if not listening
+	acceptq chan *Conn
+	closec  chan struct{} // closed when Close is called
+	donec   chan struct{} // closed when the read loop exits
+
+	mu        sync.Mutex
+	conns     map[string]*Conn // by connection ID
+	pending   map[*Conn]bool   // accepted connections whose handshake is in progress
+	closing   bool
+	dialOnly  bool // created by Dial; closed with its connection
+	closeOnce sync.Once
+}
+
+// Listen listens for QUIC connections on the local UDP network
+// address. The network must be "udp", "udp4" or "udp6".
+//
+// A nil config returns an Endpoint that does not accept
+// connections.
+func Listen(network, address string, config *Config) (*Endpoint, error) {
+	if config != nil && config.TLSConfig == nil {
+		return nil, errNoTLSConfig
+	}
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewEndpoint(pc, config), nil
+}
+
+// NewEndpoint returns an Endpoint handling traffic on pc, which it
+// takes ownership of: Close closes it. A nil config returns an
+// Endpoint that does not accept connections.
+func NewEndpoint(pc net.PacketConn, config *Config) *Endpoint {
+	e := &Endpoint{
+		pc:      pc,
+		config:  config,
+		acceptq: make(chan *Conn, 64),
+		closec:  make(chan struct{}),
+		donec:   make(chan struct{}),
+		conns:   make(map[string]*Conn),
+		pending: make(map[*Conn]bool),
+	}
+	go e.readLoop()
+	return e
+}
+
+// Dial connects to the QUIC server at address on the named UDP
+// network, from a new Endpoint that is closed along with the
+// connection.
+func Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	laddr := ":0"
+	switch network {
+	case "udp4":
+		laddr = "0.0.0.0:0"
+	case "udp6":
+		laddr = "[::]:0"
+	}
+	e, err := Listen(network, laddr, nil)
+	if err != nil {
+		return nil, err
+	}
+	e.dialOnly = true
+	c, err := e.Dial(ctx, network, address, config)
+	if err != nil {
+		// Discard the connection without waiting for it to close.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		e.Close(ctx)
+		return nil, err
+	}
+	return c, nil
+}
+
+// Dial connects to the QUIC server at address on the named UDP
+// network. It returns once the handshake completes, or with an error
+// once it fails or ctx is done.
+//
+// If config.TLSConfig has no ServerName, the host part of address is
+// used.
+func (e *Endpoint) Dial(ctx context.Context, network, address string, config *Config) (*Conn, error) {
+	if config == nil || config.TLSConfig == nil {
+		return nil, errNoTLSConfig
+	}
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if config.TLSConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		cfg := *config
+		cfg.TLSConfig = config.TLSConfig.Clone()
+		cfg.TLSConfig.ServerName = host
+		config = &cfg
+	}
+	e.mu.Lock()
+	closing := e.closing
+	e.mu.Unlock()
+	if closing {
+		return nil, errEndpointClose
+	}
+	// The client's first destination connection ID must be at least
+	// eight bytes long, RFC 9000, Section 7.2.
+	dcid := newConnID()
+	c, err := newConn(e, clientSide, config, addr, dcid, dcid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for !c.handshakeComplete {
+		if c.isClosed() {
+			return nil, c.closeErr
+		}
+		if err := c.wait(ctx); err != nil {
+			c.enterClosing(err, false, uint64(errNoError), "")
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Accept waits for and returns the next connection whose handshake
+// completed. It returns an error once ctx is done or the Endpoint is
+// closed.
+func (e *Endpoint) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-e.acceptq:
+		return c, nil
+	case <-e.closec:
+		return nil, errEndpointClose
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes all connections of the Endpoint gracefully, as
+// Conn.Close does, and waits for them to finish closing or for ctx to
+// be done, after which it discards the remaining connections and
+// closes the underlying PacketConn.
+func (e *Endpoint) Close(ctx context.Context) error {
+	e.mu.Lock()
+	e.closing = true
+	conns := e.connList()
+	e.mu.Unlock()
+	e.closeOnce.Do(func() { close(e.closec) })
+	for _, c := range conns {
+		c.Close()
+	}
+	for _, c := range conns {
+		select {
+		case <-c.donec:
+			continue
+		case <-ctx.Done():
+		}
+		c.mu.Lock()
+		c.discard(errEndpointClose)
+		c.mu.Unlock()
+		c.wake()
+		<-c.donec
+	}
+	err := e.pc.Close()
+	<-e.donec
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (e *Endpoint) LocalAddr() net.Addr {
+	return e.pc.LocalAddr()
+}
+
+// connList returns the distinct connections of e. It is called with
+// e.mu held.
+func (e *Endpoint) connList() []*Conn {
+	seen := make(map[*Conn]bool)
+	var conns []*Conn
+	for _, c := range e.conns {
+		if !seen[c] {
+			seen[c] = true
+			conns = append(conns, c)
+		}
+	}
+	return conns
+}
+
+// addConn routes datagrams addressed to c's connection IDs to c.
+func (e *Endpoint) addConn(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conns[string(c.localConnID)] = c
+	if c.side == serverSide {
+		// Until the client learns our connection ID, it addresses
+		// us by the one it chose.
+		e.conns[string(c.origConnID)] = c
+		e.pending[c] = true
+	}
+}
+
+// removeConn stops routing datagrams to c once it is done.
+func (e *Endpoint) removeConn(c *Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id, cc := range e.conns {
+		if cc == c {
+			delete(e.conns, id)
+		}
+	}
+	delete(e.pending, c)
+	if e.dialOnly && len(e.conns) == 0 && !e.closing {
+		e.closing = true
+		e.closeOnce.Do(func() { close(e.closec) })
+		e.pc.Close()
+	}
+}
+
+// accept queues a server connection whose handshake completed for
+// Accept. It is called with c.mu held.
+func (e *Endpoint) accept(c *Conn) {
+	e.mu.Lock()
+	delete(e.pending, c)
+	e.mu.Unlock()
+	select {
+	case e.acceptq <- c:
+	default:
+		c.abortTransport(&TransportError{Code: errConnectionRefused, Reason: "accept queue full"})
+	}
+}
+
+func (e *Endpoint) writeTo(b []byte, addr net.Addr) {
+	// Errors are handled as packet loss.
+	e.pc.WriteTo(b, addr)
+}
+
+func (e *Endpoint) readLoop() {
+	defer close(e.donec)
+	buf := make([]byte, maxUDPPayload)
+	for {
+		n, addr, err := e.pc.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		e.handleDatagram(append([]byte(nil), buf[:n]...), addr)
+	}
+}
+
+func (e *Endpoint) handleDatagram(b []byte, addr net.Addr) {
+	dcid, ok := dstConnIDOf(b)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	c := e.conns[string(dcid)]
+	closing := e.closing
+	pending := len(e.pending)
+	e.mu.Unlock()
+	if c != nil {
+		c.deliver(b)
+		return
+	}
+	if closing || !isLongHeader(b[0]) || len(b) < 6 {
+		// Stateless resets are not supported.
+		return
+	}
+	if v := binary.BigEndian.Uint32(b[1:5]); v != quicVersion1 {
+		if v != 0 && len(b) >= minInitialDatagramSize {
+			e.sendVersionNegotiation(b, addr)
+		}
+		return
+	}
+	h, ok := parseLongHeader(b)
+	if !ok || h.ptype != packetTypeInitial || e.config == nil {
+		return
+	}
+	if len(b) < minInitialDatagramSize || len(dcid) < connIDLen {
+		// RFC 9000, Sections 7.2 and 14.1.
+		return
+	}
+	if pending >= e.config.maxPendingHandshakes() {
+		// Address validation with Retry packets, RFC 9000, Section
+		// 8.1.2, is not supported: past the limit, the Initial
+		// packets of new connections are dropped as lost.
+		return
+	}
+	c, err := newConn(e, serverSide, e.config, addr, append([]byte(nil), h.srcConnID...), append([]byte(nil), dcid...), time.Now())
+	if err != nil {
+		return
+	}
+	c.deliver(b)
+}
+
+// sendVersionNegotiation responds to a long-header packet of an
+// unsupported version, RFC 9000, Section 6.
+func (e *Endpoint) sendVersionNegotiation(b []byte, addr net.Addr) {
+	dcid, n := consumeUint8Bytes(b[5:])
+	if n < 0 {
+		return
+	}
+	scid, m := consumeUint8Bytes(b[5+n:])
+	if m < 0 {
+		return
+	}
+	e.writeTo(appendVersionNegotiation(nil, dcid, scid), addr)
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A TransportErrorCode is a QUIC transport error code, RFC 9000,
+// Section 20.1.
+type TransportErrorCode uint64
+
+const (
+	errNoError              TransportErrorCode = 0x0
+	errInternal             TransportErrorCode = 0x1
+	errConnectionRefused    TransportErrorCode = 0x2
+	errFlowControl          TransportErrorCode = 0x3
+	errStreamLimit          TransportErrorCode = 0x4
+	errStreamState          TransportErrorCode = 0x5
+	errFinalSize            TransportErrorCode = 0x6
+	errFrameEncoding        TransportErrorCode = 0x7
+	errTransportParameter   TransportErrorCode = 0x8
+	errConnectionIDLimit    TransportErrorCode = 0x9
+	errProtocolViolation    TransportErrorCode = 0xa
+	errInvalidToken         TransportErrorCode = 0xb
+	errApplicationError     TransportErrorCode = 0xc
+	errCryptoBufferExceeded TransportErrorCode = 0xd
+	errKeyUpdateError       TransportErrorCode = 0xe
+	errAEADLimitReached     TransportErrorCode = 0xf
+	errNoViablePath         TransportErrorCode = 0x10
+	errTLSBase              TransportErrorCode = 0x100 // 0x1XX; last byte is the TLS alert
+)
+
+var transportErrorCodeNames = map[TransportErrorCode]string{
+	errNoError:              "NO_ERROR",
+	errInternal:             "INTERNAL_ERROR",
+	errConnectionRefused:    "CONNECTION_REFUSED",
+	errFlowControl:          "FLOW_CONTROL_ERROR",
+	errStreamLimit:          "STREAM_LIMIT_ERROR",
+	errStreamState:          "STREAM_STATE_ERROR",
+	errFinalSize:            "FINAL_SIZE_ERROR",
+	errFrameEncoding:        "FRAME_ENCODING_ERROR",
+	errTransportParameter:   "TRANSPORT_PARAMETER_ERROR",
+	errConnectionIDLimit:    "CONNECTION_ID_LIMIT_ERROR",
+	errProtocolViolation:    "PROTOCOL_VIOLATION",
+	errInvalidToken:         "INVALID_TOKEN",
+	errApplicationError:     "APPLICATION_ERROR",
+	errCryptoBufferExceeded: "CRYPTO_BUFFER_EXCEEDED",
+	errKeyUpdateError:       "KEY_UPDATE_ERROR",
+	errAEADLimitReached:     "AEAD_LIMIT_REACHED",
+	errNoViablePath:         "NO_VIABLE_PATH",
+}
+
+func (e TransportErrorCode) String() string {
+	if s, ok := transportErrorCodeNames[e]; ok {
+		return s
+	}
+	if e&^0xff == errTLSBase {
+		return fmt.Sprintf("CRYPTO_ERROR(%d)", uint64(e&0xff))
+	}
+	return fmt.Sprintf("ERROR_%x", uint64(e))
+}
+
+// A TransportError is an error that closed a connection at the
+// transport layer, either locally or by the peer.
+type TransportError struct {
+	Code   TransportErrorCode
+	Reason string
+}
+
+func (e *TransportError) Error() string {
+	s := "quic: transport error " + e.Code.String()
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+// An ApplicationError is an error that closed a connection at the
+// application layer. Passing an ApplicationError to Conn.Abort closes
+// the connection with its code and reason; an ApplicationError is
+// returned when the peer does so.
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+}
+
+func (e *ApplicationError) Error() string {
+	s := fmt.Sprintf("quic: application error %#x", e.Code)
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+// A StreamError is returned by Read when the peer resets the sending
+// part of a stream, and by Write when the peer asks to stop sending
+// on a stream.
+type StreamError struct {
+	Code uint64
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("quic: stream reset with code %#x", e.Code)
+}
+
+var (
+	errConnClosed    = errors.New("quic: connection closed")
+	errIdleTimeout   = errors.New("quic: idle timeout")
+	errStreamClosed  = errors.New("quic: stream closed")
+	errEndpointClose = errors.New("quic: endpoint closed")
+	errNoTLSConfig   = errors.New("quic: nil TLSConfig")
+)
+
+func errProtocol(reason string) error {
+	return &TransportError{Code: errProtocolViolation, Reason: reason}
+}
+
+func errFrame(reason string) error {
+	return &TransportError{Code: errFrameEncoding, Reason: reason}
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "encoding/binary"
+
+// Frame types, RFC 9000, Section 19.
+const (
+	frameTypePadding                    = 0x00
+	frameTypePing                       = 0x01
+	frameTypeAck                        = 0x02
+	frameTypeAckECN                     = 0x03
+	frameTypeResetStream                = 0x04
+	frameTypeStopSending                = 0x05
+	frameTypeCrypto                     = 0x06
+	frameTypeNewToken                   = 0x07
+	frameTypeStreamBase                 = 0x08 // through 0x0f
+	frameTypeMaxData                    = 0x10
+	frameTypeMaxStreamData              = 0x11
+	frameTypeMaxStreamsBidi             = 0x12
+	frameTypeMaxStreamsUni              = 0x13
+	frameTypeDataBlocked                = 0x14
+	frameTypeStreamDataBlocked          = 0x15
+	frameTypeStreamsBlockedBidi         = 0x16
+	frameTypeStreamsBlockedUni          = 0x17
+	frameTypeNewConnectionID            = 0x18
+	frameTypeRetireConnectionID         = 0x19
+	frameTypePathChallenge              = 0x1a
+	frameTypePathResponse               = 0x1b
+	frameTypeConnectionCloseTransport   = 0x1c
+	frameTypeConnectionCloseApplication = 0x1d
+	frameTypeHandshakeDone              = 0x1e
+)
+
+// Bits of the STREAM frame type.
+const (
+	streamFinBit = 0x01
+	streamLenBit = 0x02
+	streamOffBit = 0x04
+)
+
+// maxAckRanges is the maximum number of ranges sent in an ACK frame.
+const maxAckRanges = 32
+
+// appendAckFrame appends an ACK frame acknowledging the packet
+// numbers in acks, of which only the most recent maxAckRanges ranges
+// are included.
+func appendAckFrame(b []byte, acks rangeset, delay uint64) []byte {
+	b = append(b, frameTypeAck)
+	i := len(acks) - 1
+	largest := acks[i].end - 1
+	b = appendVarint(b, uint64(largest))
+	b = appendVarint(b, delay)
+	n := len(acks)
+	if n > maxAckRanges {
+		n = maxAckRanges
+	}
+	b = appendVarint(b, uint64(n-1))
+	b = appendVarint(b, uint64(acks[i].size()-1))
+	smallest := acks[i].start
+	for j := 1; j < n; j++ {
+		r := acks[i-j]
+		b = appendVarint(b, uint64(smallest-r.end-1)) // gap
+		b = appendVarint(b, uint64(r.size()-1))
+		smallest = r.start
+	}
+	return b
+}
+
+// consumeAckFrame parses an ACK frame, including its type. It returns
+// the acknowledged packet numbers and the raw ACK Delay field.
+func consumeAckFrame(b []byte) (acks rangeset, delay uint64, n int) {
+	ftype := b[0]
+	n = 1
+	largest, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return nil, 0, -1
+	}
+	delay, m = consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return nil, 0, -1
+	}
+	count, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return nil, 0, -1
+	}
+	first, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 || first > largest {
+		return nil, 0, -1
+	}
+	end := int64(largest) + 1
+	start := end - int64(first) - 1
+	acks.add(start, end)
+	for i := uint64(0); i < count; i++ {
+		gap, m := consumeVarint(b[n:])
+		n += m
+		if m < 0 {
+			return nil, 0, -1
+		}
+		l, m := consumeVarint(b[n:])
+		n += m
+		if m < 0 {
+			return nil, 0, -1
+		}
+		end = start - int64(gap) - 1
+		start = end - int64(l) - 1
+		if start < 0 {
+			return nil, 0, -1
+		}
+		acks.add(start, end)
+	}
+	if ftype == frameTypeAckECN {
+		for i := 0; i < 3; i++ {
+			_, m := consumeVarint(b[n:])
+			n += m
+			if m < 0 {
+				return nil, 0, -1
+			}
+		}
+	}
+	return acks, delay, n
+}
+
+// sizeStreamFrameHeader returns the size of a STREAM frame header.
+func sizeStreamFrameHeader(id, off int64, length int) int {
+	n := 1 + sizeVarint(uint64(id)) + sizeVarint(uint64(length))
+	if off > 0 {
+		n += sizeVarint(uint64(off))
+	}
+	return n
+}
+
+func appendStreamFrame(b []byte, id, off int64, data []byte, fin bool) []byte {
+	ftype := byte(frameTypeStreamBase | streamLenBit)
+	if off > 0 {
+		ftype |= streamOffBit
+	}
+	if fin {
+		ftype |= streamFinBit
+	}
+	b = append(b, ftype)
+	b = appendVarint(b, uint64(id))
+	if off > 0 {
+		b = appendVarint(b, uint64(off))
+	}
+	return appendVarintBytes(b, data)
+}
+
+// consumeStreamFrame parses a STREAM frame, including its type.
+func consumeStreamFrame(b []byte) (id, off int64, fin bool, data []byte, n int) {
+	ftype := b[0]
+	n = 1
+	v, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return 0, 0, false, nil, -1
+	}
+	id = int64(v)
+	if ftype&streamOffBit != 0 {
+		v, m := consumeVarint(b[n:])
+		n += m
+		if m < 0 {
+			return 0, 0, false, nil, -1
+		}
+		off = int64(v)
+	}
+	if ftype&streamLenBit != 0 {
+		data, m = consumeVarintBytes(b[n:])
+		n += m
+		if m < 0 {
+			return 0, 0, false, nil, -1
+		}
+	} else {
+		data = b[n:]
+		n = len(b)
+	}
+	if uint64(off)+uint64(len(data)) > maxVarint {
+		return 0, 0, false, nil, -1
+	}
+	return id, off, ftype&streamFinBit != 0, data, n
+}
+
+func sizeCryptoFrameHeader(off int64, length int) int {
+	return 1 + sizeVarint(uint64(off)) + sizeVarint(uint64(length))
+}
+
+func appendCryptoFrame(b []byte, off int64, data []byte) []byte {
+	b = append(b, frameTypeCrypto)
+	b = appendVarint(b, uint64(off))
+	return appendVarintBytes(b, data)
+}
+
+// consumeCryptoFrame parses a CRYPTO frame, including its type.
+func consumeCryptoFrame(b []byte) (off int64, data []byte, n int) {
+	n = 1
+	v, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return 0, nil, -1
+	}
+	data, m = consumeVarintBytes(b[n:])
+	n += m
+	if m < 0 || v+uint64(len(data)) > maxVarint {
+		return 0, nil, -1
+	}
+	return int64(v), data, n
+}
+
+func appendResetStreamFrame(b []byte, id int64, code uint64, finalSize int64) []byte {
+	b = append(b, frameTypeResetStream)
+	b = appendVarint(b, uint64(id))
+	b = appendVarint(b, code)
+	return appendVarint(b, uint64(finalSize))
+}
+
+// consumeResetStreamFrame parses a RESET_STREAM frame, including its
+// type.
+func consumeResetStreamFrame(b []byte) (id int64, code uint64, finalSize int64, n int) {
+	vs, n := consumeVarints(b[1:], 3)
+	if n < 0 {
+		return 0, 0, 0, -1
+	}
+	return int64(vs[0]), vs[1], int64(vs[2]), 1 + n
+}
+
+func appendStopSendingFrame(b []byte, id int64, code uint64) []byte {
+	b = append(b, frameTypeStopSending)
+	b = appendVarint(b, uint64(id))
+	return appendVarint(b, code)
+}
+
+// appendIntFrame appends a frame consisting of its type and a single
+// integer, such as MAX_DATA or MAX_STREAMS.
+func appendIntFrame(b []byte, ftype byte, v int64) []byte {
+	b = append(b, ftype)
+	return appendVarint(b, uint64(v))
+}
+
+// appendStreamIntFrame appends a frame consisting of its type, a
+// stream ID and an integer, such as MAX_STREAM_DATA.
+func appendStreamIntFrame(b []byte, ftype byte, id, v int64) []byte {
+	b = append(b, ftype)
+	b = appendVarint(b, uint64(id))
+	return appendVarint(b, uint64(v))
+}
+
+// consumeVarints parses count variable-length integers.
+func consumeVarints(b []byte, count int) ([]uint64, int) {
+	vs := make([]uint64, count)
+	n := 0
+	for i := range vs {
+		v, m := consumeVarint(b[n:])
+		if m < 0 {
+			return nil, -1
+		}
+		vs[i] = v
+		n += m
+	}
+	return vs, n
+}
+
+// consumeNewConnectionIDFrame parses a NEW_CONNECTION_ID frame,
+// including its type.
+func consumeNewConnectionIDFrame(b []byte) (seq, retirePriorTo int64, cid []byte, n int) {
+	vs, n := consumeVarints(b[1:], 2)
+	if n < 0 {
+		return 0, 0, nil, -1
+	}
+	n++
+	cid, m := consumeUint8Bytes(b[n:])
+	n += m
+	if m < 0 || len(cid) < 1 || len(cid) > maxConnIDLen || len(b) < n+16 {
+		return 0, 0, nil, -1
+	}
+	n += 16 // stateless reset token
+	if vs[1] > vs[0] {
+		return 0, 0, nil, -1
+	}
+	return int64(vs[0]), int64(vs[1]), cid, n
+}
+
+func appendPathResponseFrame(b []byte, data uint64) []byte {
+	b = append(b, frameTypePathResponse)
+	return binary.BigEndian.AppendUint64(b, data)
+}
+
+func appendConnectionCloseFrame(b []byte, app bool, code uint64, reason string) []byte {
+	if app {
+		b = append(b, frameTypeConnectionCloseApplication)
+		b = appendVarint(b, code)
+	} else {
+		b = append(b, frameTypeConnectionCloseTransport)
+		b = appendVarint(b, code)
+		b = appendVarint(b, 0) // frame type
+	}
+	return appendVarintBytes(b, []byte(reason))
+}
+
+// consumeConnectionCloseFrame parses a CONNECTION_CLOSE frame,
+// including its type.
+func consumeConnectionCloseFrame(b []byte) (app bool, code uint64, reason string, n int) {
+	app = b[0] == frameTypeConnectionCloseApplication
+	n = 1
+	code, m := consumeVarint(b[n:])
+	n += m
+	if m < 0 {
+		return false, 0, "", -1
+	}
+	if !app {
+		_, m := consumeVarint(b[n:])
+		n += m
+		if m < 0 {
+			return false, 0, "", -1
+		}
+	}
+	r, m := consumeVarintBytes(b[n:])
+	n += m
+	if m < 0 {
+		return false, 0, "", -1
+	}
+	return app, code, string(r), n
+}
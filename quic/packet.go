@@ -0,0 +1,226 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "encoding/binary"
+
+// A packetType is a type of QUIC packet.
+type packetType byte
+
+const (
+	packetTypeInitial packetType = iota
+	packetType0RTT
+	packetTypeHandshake
+	packetTypeRetry
+	packetType1RTT // short header
+	packetTypeVersionNegotiation
+)
+
+const (
+	quicVersion1 = 0x00000001
+
+	// connIDLen is the length of the connection IDs this package
+	// chooses for itself.
+	connIDLen = 8
+
+	// maxConnIDLen is the maximum length of a connection ID in QUIC
+	// version 1.
+	maxConnIDLen = 20
+
+	// minInitialDatagramSize is the size to which datagrams carrying
+	// ack-eliciting Initial packets are padded.
+	minInitialDatagramSize = 1200
+
+	// maxDatagramSize is the largest UDP payload this package sends.
+	// It is the minimum every QUIC path supports, RFC 9000,
+	// Section 14.
+	maxDatagramSize = 1200
+
+	// pnLen is the length of the packet numbers this package sends.
+	// A constant four-byte packet number keeps header protection
+	// samples in place regardless of the payload length.
+	pnLen = 4
+)
+
+const (
+	headerFormLong  = 0x80
+	headerFixedBit  = 0x40
+	headerKeyPhase  = 0x04
+	longHeaderShift = 4
+)
+
+// isLongHeader reports whether b starts with a long-header packet.
+func isLongHeader(b byte) bool {
+	return b&headerFormLong != 0
+}
+
+// A longHeader is the parsed header of a long-header packet.
+type longHeader struct {
+	ptype     packetType
+	version   uint32
+	dstConnID []byte
+	srcConnID []byte
+	token     []byte // Initial packets only
+	pnOff     int    // offset of the packet number
+	end       int    // offset of the end of the packet
+}
+
+// parseLongHeader parses the long header of the packet at the start
+// of b, before header protection is removed.
+func parseLongHeader(b []byte) (h longHeader, ok bool) {
+	if len(b) < 7 || !isLongHeader(b[0]) {
+		return h, false
+	}
+	h.version = binary.BigEndian.Uint32(b[1:5])
+	n := 5
+	dcid, m := consumeUint8Bytes(b[n:])
+	if m < 0 || len(dcid) > maxConnIDLen {
+		return h, false
+	}
+	n += m
+	scid, m := consumeUint8Bytes(b[n:])
+	if m < 0 || len(scid) > maxConnIDLen {
+		return h, false
+	}
+	n += m
+	h.dstConnID, h.srcConnID = dcid, scid
+	if h.version == 0 {
+		h.ptype = packetTypeVersionNegotiation
+		h.end = len(b)
+		return h, true
+	}
+	h.ptype = packetType((b[0] >> longHeaderShift) & 0x03)
+	switch h.ptype {
+	case packetTypeRetry:
+		h.end = len(b)
+		return h, true
+	case packetTypeInitial:
+		token, m := consumeVarintBytes(b[n:])
+		if m < 0 {
+			return h, false
+		}
+		h.token = token
+		n += m
+	}
+	length, m := consumeVarint(b[n:])
+	if m < 0 || uint64(len(b)-n-m) < length {
+		return h, false
+	}
+	n += m
+	h.pnOff = n
+	h.end = n + int(length)
+	return h, true
+}
+
+// dstConnIDOf returns the destination connection ID of the packet at
+// the start of b. Short-header packets are assumed to carry a
+// connection ID chosen by this package.
+func dstConnIDOf(b []byte) ([]byte, bool) {
+	if len(b) < 1 {
+		return nil, false
+	}
+	if !isLongHeader(b[0]) {
+		if len(b) < 1+connIDLen {
+			return nil, false
+		}
+		return b[1 : 1+connIDLen], true
+	}
+	if len(b) < 6 {
+		return nil, false
+	}
+	dcid, m := consumeUint8Bytes(b[5:])
+	if m < 0 {
+		return nil, false
+	}
+	return dcid, true
+}
+
+func consumeUint8Bytes(b []byte) ([]byte, int) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, -1
+	}
+	return b[1 : 1+int(b[0])], 1 + int(b[0])
+}
+
+// appendLongHeader appends a long header up to and including the
+// packet number. The length field is written as a two-byte
+// placeholder at the returned offset, to be filled in by
+// setLongHeaderLength once the payload is known.
+func appendLongHeader(b []byte, ptype packetType, dcid, scid, token []byte, pnum int64) (out []byte, lenOff int) {
+	b = append(b, headerFormLong|headerFixedBit|byte(ptype)<<longHeaderShift|(pnLen-1))
+	b = binary.BigEndian.AppendUint32(b, quicVersion1)
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	if ptype == packetTypeInitial {
+		b = appendVarintBytes(b, token)
+	}
+	lenOff = len(b)
+	b = append(b, 0x40, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(pnum))
+	return b, lenOff
+}
+
+// setLongHeaderLength fills in the length field of a long header at
+// lenOff, given the length of the rest of the packet, including the
+// packet number and the authentication tag.
+func setLongHeaderLength(b []byte, lenOff, length int) {
+	b[lenOff] = 0x40 | byte(length>>8)
+	b[lenOff+1] = byte(length)
+}
+
+// appendShortHeader appends a short header up to and including the
+// packet number.
+func appendShortHeader(b []byte, dcid []byte, keyPhase bool, pnum int64) []byte {
+	first := byte(headerFixedBit | (pnLen - 1))
+	if keyPhase {
+		first |= headerKeyPhase
+	}
+	b = append(b, first)
+	b = append(b, dcid...)
+	return binary.BigEndian.AppendUint32(b, uint32(pnum))
+}
+
+// appendVersionNegotiation appends a Version Negotiation packet
+// responding to a packet with the given connection IDs.
+func appendVersionNegotiation(b []byte, dcid, scid []byte) []byte {
+	b = append(b, headerFormLong|headerFixedBit)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	return binary.BigEndian.AppendUint32(b, quicVersion1)
+}
+
+// decodePacketNumber reconstructs a full packet number from its
+// truncated encoding, RFC 9000, Appendix A.3.
+func decodePacketNumber(largest, truncated int64, n int) int64 {
+	expected := largest + 1
+	win := int64(1) << (8 * n)
+	hwin := win / 2
+	mask := win - 1
+	candidate := (expected &^ mask) | truncated
+	switch {
+	case candidate <= expected-hwin && candidate < 1<<62-win:
+		return candidate + win
+	case candidate > expected+hwin && candidate >= win:
+		return candidate - win
+	}
+	return candidate
+}
+
+// readPacketNumber reads a truncated packet number of n bytes.
+func readPacketNumber(b []byte, n int) int64 {
+	var v int64
+	for i := 0; i < n; i++ {
+		v = v<<8 | int64(b[i])
+	}
+	return v
+}
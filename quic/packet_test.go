@@ -0,0 +1,76 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodePacketNumber(t *testing.T) {
+	for _, tt := range []struct {
+		largest, truncated int64
+		n                  int
+		want               int64
+	}{
+		// Example from RFC 9000, Appendix A.3.
+		{0xa82f30ea, 0x9b32, 2, 0xa82f9b32},
+		{-1, 0, 4, 0},
+		{0xff, 0x01, 1, 0x101},
+		{0x101, 0xff, 1, 0xff},
+	} {
+		if got := decodePacketNumber(tt.largest, tt.truncated, tt.n); got != tt.want {
+			t.Errorf("decodePacketNumber(%#x, %#x, %d) = %#x; want %#x", tt.largest, tt.truncated, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLongHeader(t *testing.T) {
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	scid := []byte{9, 10, 11}
+	token := []byte("token")
+	b, lenOff := appendLongHeader(nil, packetTypeInitial, dcid, scid, token, 7)
+	payload := []byte("payload")
+	b = append(b, payload...)
+	setLongHeaderLength(b, lenOff, pnLen+len(payload))
+	b = append(b, "next packet"...)
+
+	h, ok := parseLongHeader(b)
+	if !ok {
+		t.Fatal("parseLongHeader failed")
+	}
+	if h.ptype != packetTypeInitial || h.version != quicVersion1 {
+		t.Errorf("got type %v, version %#x", h.ptype, h.version)
+	}
+	if !bytes.Equal(h.dstConnID, dcid) || !bytes.Equal(h.srcConnID, scid) || !bytes.Equal(h.token, token) {
+		t.Errorf("got dcid %x, scid %x, token %q", h.dstConnID, h.srcConnID, h.token)
+	}
+	if got := readPacketNumber(b[h.pnOff:], pnLen); got != 7 {
+		t.Errorf("packet number = %d; want 7", got)
+	}
+	if got := string(b[h.pnOff+pnLen : h.end]); got != "payload" {
+		t.Errorf("payload = %q; want %q", got, "payload")
+	}
+	if got, ok := dstConnIDOf(b); !ok || !bytes.Equal(got, dcid) {
+		t.Errorf("dstConnIDOf = %x, %v; want %x, true", got, ok, dcid)
+	}
+	if _, ok := parseLongHeader(b[:h.end-len(payload)-1]); ok {
+		t.Error("parseLongHeader succeeded on truncated packet")
+	}
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	b := appendVersionNegotiation(nil, []byte{1, 2}, []byte{3, 4, 5})
+	h, ok := parseLongHeader(b)
+	if !ok || h.ptype != packetTypeVersionNegotiation {
+		t.Fatalf("got %+v, %v", h, ok)
+	}
+	if !bytes.Equal(h.dstConnID, []byte{3, 4, 5}) || !bytes.Equal(h.srcConnID, []byte{1, 2}) {
+		t.Errorf("connection IDs not swapped: %x, %x", h.dstConnID, h.srcConnID)
+	}
+}
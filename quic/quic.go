@@ -0,0 +1,24 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+// Package quic implements the QUIC transport protocol, version 1, as
+// defined in RFC 9000, RFC 9001 and RFC 9002.
+//
+// An Endpoint sends and receives the datagrams of any number of
+// connections on a single UDP socket. Servers Listen and Accept
+// connections; clients Dial them. Each Conn carries multiplexed,
+// flow-controlled Streams.
+//
+// The implementation is minimal. It does not support Retry packets,
+// 0-RTT data, connection migration, stateless resets or issuing
+// additional connection IDs, and only negotiates the AES-GCM cipher
+// suites. Datagrams are limited to 1200 bytes, the size every QUIC
+// path supports.
+//
+// This package requires Go 1.21 or later, for the QUIC support of
+// crypto/tls.
+package quic
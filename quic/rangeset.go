@@ -0,0 +1,117 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+// A rangeset is a set of int64s, stored as an ordered list of
+// non-overlapping, non-adjacent half-open intervals.
+type rangeset []span
+
+// A span is the half-open interval [start, end).
+type span struct {
+	start, end int64
+}
+
+func (s span) size() int64 { return s.end - s.start }
+
+// add adds [start, end) to the set.
+func (s *rangeset) add(start, end int64) {
+	if start >= end {
+		return
+	}
+	rs := *s
+	// Find the first span that ends at or after start.
+	i := 0
+	for i < len(rs) && rs[i].end < start {
+		i++
+	}
+	// Find the first span that starts after end.
+	j := i
+	for j < len(rs) && rs[j].start <= end {
+		j++
+	}
+	if i == j {
+		rs = append(rs, span{})
+		copy(rs[i+1:], rs[i:])
+		rs[i] = span{start, end}
+		*s = rs
+		return
+	}
+	if rs[i].start < start {
+		start = rs[i].start
+	}
+	if rs[j-1].end > end {
+		end = rs[j-1].end
+	}
+	rs[i] = span{start, end}
+	*s = append(rs[:i+1], rs[j:]...)
+}
+
+// sub removes [start, end) from the set.
+func (s *rangeset) sub(start, end int64) {
+	if start >= end {
+		return
+	}
+	var out rangeset
+	for _, r := range *s {
+		if r.end <= start || r.start >= end {
+			out = append(out, r)
+			continue
+		}
+		if r.start < start {
+			out = append(out, span{r.start, start})
+		}
+		if r.end > end {
+			out = append(out, span{end, r.end})
+		}
+	}
+	*s = out
+}
+
+// contains reports whether v is in the set.
+func (s rangeset) contains(v int64) bool {
+	for _, r := range s {
+		if r.start > v {
+			return false
+		}
+		if v < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// containsRange reports whether all of [start, end) is in the set.
+func (s rangeset) containsRange(start, end int64) bool {
+	for _, r := range s {
+		if r.start <= start && end <= r.end {
+			return true
+		}
+	}
+	return start >= end
+}
+
+// min returns the smallest value in the set, or 0 if it is empty.
+func (s rangeset) min() int64 {
+	if len(s) == 0 {
+		return 0
+	}
+	return s[0].start
+}
+
+// max returns the largest value in the set, or -1 if it is empty.
+func (s rangeset) max() int64 {
+	if len(s) == 0 {
+		return -1
+	}
+	return s[len(s)-1].end - 1
+}
+
+// isEmpty reports whether the set is empty.
+func (s rangeset) isEmpty() bool {
+	return len(s) == 0
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangesetAdd(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		add  []span
+		want rangeset
+	}{
+		{"empty span", []span{{1, 1}}, nil},
+		{"disjoint", []span{{5, 6}, {1, 2}, {9, 10}}, rangeset{{1, 2}, {5, 6}, {9, 10}}},
+		{"adjacent", []span{{1, 2}, {2, 3}}, rangeset{{1, 3}}},
+		{"overlap", []span{{1, 4}, {3, 6}}, rangeset{{1, 6}}},
+		{"bridge", []span{{1, 2}, {5, 6}, {9, 10}, {2, 9}}, rangeset{{1, 10}}},
+		{"inside", []span{{1, 10}, {3, 4}}, rangeset{{1, 10}}},
+		{"cover", []span{{3, 4}, {6, 7}, {1, 10}}, rangeset{{1, 10}}},
+	} {
+		var s rangeset
+		for _, r := range tt.add {
+			s.add(r.start, r.end)
+		}
+		if !reflect.DeepEqual(s, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.desc, s, tt.want)
+		}
+	}
+}
+
+func TestRangesetSub(t *testing.T) {
+	s := rangeset{{0, 10}, {20, 30}}
+	s.sub(5, 25)
+	if want := (rangeset{{0, 5}, {25, 30}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("got %v; want %v", s, want)
+	}
+	s.sub(1, 2)
+	if want := (rangeset{{0, 1}, {2, 5}, {25, 30}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("got %v; want %v", s, want)
+	}
+	if !s.contains(3) || s.contains(1) || s.contains(30) {
+		t.Errorf("contains gives wrong results for %v", s)
+	}
+	if !s.containsRange(2, 5) || s.containsRange(0, 3) {
+		t.Errorf("containsRange gives wrong results for %v", s)
+	}
+	if s.min() != 0 || s.max() != 29 {
+		t.Errorf("min, max = %d, %d; want 0, 29", s.min(), s.max())
+	}
+}
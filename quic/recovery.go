@@ -0,0 +1,183 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "time"
+
+// A numberSpace is a packet number space, RFC 9000, Section 12.3.
+type numberSpace int
+
+const (
+	initialSpace numberSpace = iota
+	handshakeSpace
+	appDataSpace
+	numberSpaceCount
+)
+
+// Loss detection constants, RFC 9002, Section 6.
+const (
+	packetThreshold  = 3
+	timerGranularity = time.Millisecond
+	initialRTT       = 333 * time.Millisecond
+
+	// maxAckDelay is the max_ack_delay advertised by this package.
+	maxAckDelay = 25 * time.Millisecond
+)
+
+// A sentFrameKind identifies what a sentFrame records.
+type sentFrameKind byte
+
+const (
+	sentCrypto sentFrameKind = iota
+	sentStream
+	sentResetStream
+	sentStopSending
+	sentMaxData
+	sentMaxStreamData
+	sentMaxStreamsBidi
+	sentMaxStreamsUni
+	sentHandshakeDone
+)
+
+// A sentFrame records a frame that must be retransmitted, in some
+// form, if the packet carrying it is lost.
+type sentFrame struct {
+	kind sentFrameKind
+	id   int64 // stream ID
+	off  int64
+	n    int
+	fin  bool
+}
+
+// A sentPacket records a packet awaiting acknowledgement.
+type sentPacket struct {
+	pnum         int64
+	time         time.Time
+	size         int
+	ackEliciting bool
+	frames       []sentFrame
+}
+
+// rttState estimates the round-trip time, RFC 9002, Section 5.
+type rttState struct {
+	latest    time.Duration
+	smoothed  time.Duration
+	rttvar    time.Duration
+	min       time.Duration
+	hasSample bool
+}
+
+func newRTTState() rttState {
+	return rttState{
+		smoothed: initialRTT,
+		rttvar:   initialRTT / 2,
+	}
+}
+
+func (r *rttState) update(sample, ackDelay time.Duration) {
+	r.latest = sample
+	if !r.hasSample {
+		r.hasSample = true
+		r.min = sample
+		r.smoothed = sample
+		r.rttvar = sample / 2
+		return
+	}
+	if sample < r.min {
+		r.min = sample
+	}
+	adjusted := sample
+	if sample >= r.min+ackDelay {
+		adjusted = sample - ackDelay
+	}
+	d := r.smoothed - adjusted
+	if d < 0 {
+		d = -d
+	}
+	r.rttvar = (3*r.rttvar + d) / 4
+	r.smoothed = (7*r.smoothed + adjusted) / 8
+}
+
+// pto returns the probe timeout, without backoff.
+func (r *rttState) pto(maxAckDelay time.Duration) time.Duration {
+	v := 4 * r.rttvar
+	if v < timerGranularity {
+		v = timerGranularity
+	}
+	return r.smoothed + v + maxAckDelay
+}
+
+// lossDelay returns the time after which a packet is deemed lost
+// once a later packet was acknowledged.
+func (r *rttState) lossDelay() time.Duration {
+	d := r.smoothed
+	if r.latest > d {
+		d = r.latest
+	}
+	d = d * 9 / 8
+	if d < timerGranularity {
+		d = timerGranularity
+	}
+	return d
+}
+
+// congestion implements the NewReno congestion controller of
+// RFC 9002, Section 7.
+type congestion struct {
+	window        int
+	ssthresh      int
+	inFlight      int
+	recoveryStart time.Time
+}
+
+const minCongestionWindow = 2 * maxDatagramSize
+
+func newCongestion() congestion {
+	return congestion{
+		window:   10 * maxDatagramSize,
+		ssthresh: 1<<31 - 1,
+	}
+}
+
+func (cc *congestion) canSend() bool {
+	return cc.inFlight+maxDatagramSize <= cc.window
+}
+
+func (cc *congestion) onSent(size int) {
+	cc.inFlight += size
+}
+
+func (cc *congestion) onAcked(p *sentPacket) {
+	cc.inFlight -= p.size
+	if !p.time.After(cc.recoveryStart) {
+		return
+	}
+	if cc.window < cc.ssthresh {
+		cc.window += p.size
+	} else {
+		cc.window += maxDatagramSize * p.size / cc.window
+	}
+}
+
+// onRemoved is called for packets deemed lost, and for packets that are
+// no longer tracked because their keys were discarded.
+func (cc *congestion) onRemoved(p *sentPacket) {
+	cc.inFlight -= p.size
+}
+
+func (cc *congestion) onCongestion(sent, now time.Time) {
+	if !sent.After(cc.recoveryStart) {
+		return
+	}
+	cc.recoveryStart = now
+	cc.ssthresh = cc.window / 2
+	if cc.ssthresh < minCongestionWindow {
+		cc.ssthresh = minCongestionWindow
+	}
+	cc.window = cc.ssthresh
+}
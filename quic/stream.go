@@ -0,0 +1,668 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// A streamKind distinguishes bidirectional and unidirectional
+// streams.
+type streamKind int8
+
+const (
+	bidiStream streamKind = iota
+	uniStream
+)
+
+// newStreamID returns the ID of the num-th stream of a kind opened by
+// initiator, RFC 9000, Section 2.1.
+func newStreamID(initiator connSide, kind streamKind, num int64) int64 {
+	return num<<2 | int64(kind)<<1 | int64(initiator)
+}
+
+func streamIDInitiator(id int64) connSide { return connSide(id & 1) }
+func streamIDKind(id int64) streamKind    { return streamKind((id >> 1) & 1) }
+func streamIDNum(id int64) int64          { return id >> 2 }
+
+var (
+	errReadOnly  = errors.New("quic: write to receive-only stream")
+	errWriteOnly = errors.New("quic: read from send-only stream")
+)
+
+// A Stream is an ordered byte stream within a connection.
+//
+// Streams are either bidirectional, or unidirectional, in which case
+// only the peer that opened them may write to them.
+//
+// Multiple goroutines may invoke methods on a Stream simultaneously,
+// though concurrent calls to Read, or to Write, are not useful.
+type Stream struct {
+	id   int64
+	conn *Conn
+
+	// All fields are guarded by conn.mu.
+	readCtx  context.Context
+	writeCtx context.Context
+
+	// The receiving part.
+	hasIn          bool
+	in             recvBuffer
+	inMaxData      int64 // flow control limit, set by us
+	inFinal        int64 // final size, or -1 if not known yet
+	inEOF          bool  // all data up to the final size was read
+	inResetErr     error // the peer reset the stream
+	inClosed       bool  // CloseRead was called
+	stopPending    bool  // STOP_SENDING must be sent
+	maxDataPending bool  // MAX_STREAM_DATA must be sent
+
+	// The sending part.
+	hasOut       bool
+	out          sendBuffer
+	outMaxData   int64 // flow control limit, set by the peer
+	outStopErr   error // the peer sent STOP_SENDING
+	outClosed    bool  // Close, CloseWrite or Reset was called
+	resetPending bool  // RESET_STREAM must be sent
+	resetSent    bool
+	resetAcked   bool
+	resetCode    uint64
+
+	queued  bool // in streams.sendq
+	removed bool // no longer tracked by the connection
+}
+
+// ID returns the QUIC stream ID of s.
+func (s *Stream) ID() int64 {
+	return s.id
+}
+
+// IsReadOnly reports whether s is a unidirectional stream opened by
+// the peer, which can only be read from.
+func (s *Stream) IsReadOnly() bool {
+	return !s.hasOut
+}
+
+// IsWriteOnly reports whether s is a unidirectional stream opened
+// locally, which can only be written to.
+func (s *Stream) IsWriteOnly() bool {
+	return !s.hasIn
+}
+
+// SetReadContext sets the context that bounds subsequent calls to
+// Read. Read returns the context's error once it is done.
+func (s *Stream) SetReadContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.readCtx = ctx
+	s.conn.mu.Unlock()
+}
+
+// SetWriteContext sets the context that bounds subsequent calls to
+// Write. Write returns the context's error once it is done.
+func (s *Stream) SetWriteContext(ctx context.Context) {
+	s.conn.mu.Lock()
+	s.writeCtx = ctx
+	s.conn.mu.Unlock()
+}
+
+// Read reads data from the stream. It returns io.EOF once the peer
+// closed the stream and all of its data was read, and a *StreamError
+// if the peer reset the stream.
+func (s *Stream) Read(b []byte) (int, error) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasIn {
+		return 0, errWriteOnly
+	}
+	for {
+		switch {
+		case s.inClosed:
+			return 0, errStreamClosed
+		case s.inResetErr != nil:
+			return 0, s.inResetErr
+		}
+		if data := s.in.readable(); len(data) > 0 {
+			n := copy(b, data)
+			s.in.consume(n)
+			c.streamDataRead(s, n)
+			return n, nil
+		}
+		if s.inFinal >= 0 && s.in.off == s.inFinal {
+			if !s.inEOF {
+				s.inEOF = true
+				c.streams.maybeRemove(c, s)
+			}
+			return 0, io.EOF
+		}
+		if c.isClosed() {
+			return 0, c.closeErr
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+		if err := c.wait(s.readCtx); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes data to the stream. It blocks while the stream buffers
+// Config.MaxStreamWriteBufferSize bytes of unacknowledged data.
+// It returns a *StreamError if the peer asked to stop sending.
+func (s *Stream) Write(b []byte) (int, error) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasOut {
+		return 0, errReadOnly
+	}
+	n := 0
+	for {
+		switch {
+		case s.outStopErr != nil:
+			return n, s.outStopErr
+		case s.outClosed:
+			return n, errStreamClosed
+		case c.isClosed():
+			return n, c.closeErr
+		}
+		if len(b) == 0 {
+			return n, nil
+		}
+		room := c.config.maxStreamWriteBufferSize() - (s.out.end - s.out.base)
+		if room <= 0 {
+			if err := c.wait(s.writeCtx); err != nil {
+				return n, err
+			}
+			continue
+		}
+		chunk := b
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		s.out.write(chunk)
+		n += len(chunk)
+		b = b[len(chunk):]
+		c.streams.queue(s)
+		c.wake()
+	}
+}
+
+// CloseWrite closes the sending part of the stream gracefully: the
+// peer reads io.EOF after the data written so far.
+func (s *Stream) CloseWrite() error {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !s.hasOut || s.outClosed {
+		return nil
+	}
+	s.outClosed = true
+	s.out.close()
+	c.streams.queue(s)
+	c.wake()
+	c.notify()
+	return nil
+}
+
+// CloseRead discards the receiving part of the stream, asking the peer
+// to stop sending with the application error code 0.
+func (s *Stream) CloseRead() error {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.closeRead(0)
+	return nil
+}
+
+func (s *Stream) closeRead(code uint64) {
+	c := s.conn
+	if !s.hasIn || s.inClosed {
+		return
+	}
+	s.inClosed = true
+	// Data that will never be read must not hold up the
+	// connection's flow control.
+	c.dataRead += s.in.end - s.in.off
+	c.streamDataRead(s, 0)
+	if !s.inDone() {
+		s.stopPending = true
+		c.streams.queue(s)
+		c.wake()
+	}
+	c.streams.maybeRemove(c, s)
+	c.notify()
+}
+
+// Close closes both parts of the stream: the sending part gracefully,
+// as by CloseWrite, and the receiving part as by CloseRead.
+func (s *Stream) Close() error {
+	s.CloseWrite()
+	return s.CloseRead()
+}
+
+// Reset abandons the sending part of the stream, informing the peer
+// with the given application error code. Data that was written but
+// not yet acknowledged may never be delivered.
+func (s *Stream) Reset(code uint64) {
+	c := s.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s.reset(code)
+}
+
+func (s *Stream) reset(code uint64) {
+	c := s.conn
+	s.outClosed = true
+	if !s.hasOut || s.resetting() || s.out.done() {
+		return
+	}
+	s.resetPending = true
+	s.resetCode = code
+	s.out.unsent = nil
+	s.out.finPending = false
+	c.streams.queue(s)
+	c.wake()
+	c.notify()
+}
+
+func (s *Stream) resetting() bool {
+	return s.resetPending || s.resetSent
+}
+
+// inDone reports whether the receiving part no longer needs tracking.
+func (s *Stream) inDone() bool {
+	if !s.hasIn || s.inEOF || s.inResetErr != nil {
+		return true
+	}
+	return s.inClosed && s.inFinal >= 0 && s.in.end == s.inFinal
+}
+
+// outDone reports whether the sending part no longer needs tracking.
+func (s *Stream) outDone() bool {
+	return !s.hasOut || s.resetAcked || s.out.done()
+}
+
+// sendLimit returns the offset up to which stream data may be sent
+// under both stream and connection flow control.
+func (s *Stream) sendLimit(c *Conn) int64 {
+	limit := s.out.sentMax + (c.maxData - c.dataSent)
+	if s.outMaxData < limit {
+		limit = s.outMaxData
+	}
+	return limit
+}
+
+// hasPending reports whether s has frames to send.
+func (s *Stream) hasPending(c *Conn) bool {
+	if s.removed {
+		return false
+	}
+	if s.stopPending || s.maxDataPending || s.resetPending {
+		return true
+	}
+	return s.hasOut && !s.resetting() && s.out.pending(s.sendLimit(c))
+}
+
+// streamsState is the state of the streams of a connection.
+type streamsState struct {
+	streams map[int64]*Stream
+
+	opened    [2]int64 // number of streams opened locally
+	peerMax   [2]int64 // limit on streams opened locally, set by the peer
+	remote    [2]int64 // number of streams opened by the peer
+	remoteMax [2]int64 // limit on streams opened by the peer
+
+	maxStreamsPending [2]bool
+	acceptq           []*Stream
+	sendq             []*Stream
+
+	readWindow int64
+	peer       transportParameters
+}
+
+func (ss *streamsState) init(config *Config) {
+	ss.streams = make(map[int64]*Stream)
+	ss.remoteMax[bidiStream] = config.maxBidiRemoteStreams()
+	ss.remoteMax[uniStream] = config.maxUniRemoteStreams()
+	ss.readWindow = config.maxStreamReadBufferSize()
+}
+
+func (ss *streamsState) setPeerParams(p *transportParameters) {
+	ss.peer = *p
+	ss.peerMax[bidiStream] = p.initialMaxStreamsBidi
+	ss.peerMax[uniStream] = p.initialMaxStreamsUni
+}
+
+func (ss *streamsState) get(id int64) *Stream {
+	return ss.streams[id]
+}
+
+func (ss *streamsState) queue(s *Stream) {
+	if !s.queued && !s.removed {
+		s.queued = true
+		ss.sendq = append(ss.sendq, s)
+	}
+}
+
+// newStream creates and tracks a stream.
+func (ss *streamsState) newStream(c *Conn, id int64) *Stream {
+	s := &Stream{
+		id:       id,
+		conn:     c,
+		readCtx:  context.Background(),
+		writeCtx: context.Background(),
+		inFinal:  -1,
+	}
+	local := streamIDInitiator(id) == c.side
+	switch kind := streamIDKind(id); {
+	case kind == bidiStream && local:
+		s.hasIn, s.hasOut = true, true
+		s.outMaxData = ss.peer.initialMaxStreamDataBidiRemote
+	case kind == bidiStream:
+		s.hasIn, s.hasOut = true, true
+		s.outMaxData = ss.peer.initialMaxStreamDataBidiLocal
+	case local:
+		s.hasOut = true
+		s.outMaxData = ss.peer.initialMaxStreamDataUni
+	default:
+		s.hasIn = true
+	}
+	if s.hasIn {
+		s.inMaxData = ss.readWindow
+	}
+	ss.streams[id] = s
+	return s
+}
+
+// maybeRemove stops tracking s once both of its parts are done.
+func (ss *streamsState) maybeRemove(c *Conn, s *Stream) {
+	if s.removed || !s.inDone() || !s.outDone() {
+		return
+	}
+	s.removed = true
+	delete(ss.streams, s.id)
+	if streamIDInitiator(s.id) != c.side {
+		// Allow the peer to open another stream.
+		kind := streamIDKind(s.id)
+		ss.remoteMax[kind]++
+		ss.maxStreamsPending[kind] = true
+		c.wake()
+	}
+}
+
+// NewStream opens a bidirectional stream. It blocks until the
+// handshake completes and the peer allows opening another stream,
+// or until ctx is done.
+func (c *Conn) NewStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, bidiStream)
+}
+
+// NewSendOnlyStream opens a unidirectional stream.
+// It blocks as NewStream does.
+func (c *Conn) NewSendOnlyStream(ctx context.Context) (*Stream, error) {
+	return c.newLocalStream(ctx, uniStream)
+}
+
+func (c *Conn) newLocalStream(ctx context.Context, kind streamKind) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.isClosed() {
+			return nil, c.closeErr
+		}
+		ss := &c.streams
+		if c.handshakeComplete && ss.opened[kind] < ss.peerMax[kind] {
+			id := newStreamID(c.side, kind, ss.opened[kind])
+			ss.opened[kind]++
+			return ss.newStream(c, id), nil
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// AcceptStream waits for and returns the next stream opened by the
+// peer, or returns an error once ctx is done or the connection is
+// closed.
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if ss := &c.streams; len(ss.acceptq) > 0 {
+			s := ss.acceptq[0]
+			ss.acceptq[0] = nil
+			ss.acceptq = ss.acceptq[1:]
+			return s, nil
+		}
+		if c.isClosed() {
+			return nil, c.closeErr
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// streamDataRead updates flow control after n bytes were read from s.
+func (c *Conn) streamDataRead(s *Stream, n int) {
+	c.dataRead += int64(n)
+	window := c.config.maxConnReadBufferSize()
+	if c.recvMaxData-c.dataRead < window/2 {
+		c.recvMaxData = c.dataRead + window
+		c.maxDataPending = true
+		c.wake()
+	}
+	if !s.inClosed && s.inFinal < 0 && s.inMaxData-s.in.off < c.streams.readWindow/2 {
+		s.inMaxData = s.in.off + c.streams.readWindow
+		s.maxDataPending = true
+		c.streams.queue(s)
+		c.wake()
+	}
+}
+
+// streamForFrame returns the stream a frame refers to, opening
+// streams initiated by the peer as needed. It returns nil if the
+// stream was already closed. recv reports whether the frame concerns
+// the receiving part of the stream.
+func (c *Conn) streamForFrame(id int64, recv bool) (*Stream, error) {
+	ss := &c.streams
+	initiator, kind, num := streamIDInitiator(id), streamIDKind(id), streamIDNum(id)
+	if kind == uniStream && recv == (initiator == c.side) {
+		return nil, &TransportError{Code: errStreamState, Reason: "wrong direction of unidirectional stream"}
+	}
+	if initiator == c.side {
+		if num >= ss.opened[kind] {
+			return nil, &TransportError{Code: errStreamState, Reason: "stream not opened yet"}
+		}
+		return ss.streams[id], nil
+	}
+	if num < ss.remote[kind] {
+		return ss.streams[id], nil
+	}
+	if num >= ss.remoteMax[kind] {
+		return nil, &TransportError{Code: errStreamLimit}
+	}
+	for ; ss.remote[kind] <= num; ss.remote[kind]++ {
+		s := ss.newStream(c, newStreamID(initiator, kind, ss.remote[kind]))
+		ss.acceptq = append(ss.acceptq, s)
+	}
+	c.notify()
+	return ss.streams[id], nil
+}
+
+// handleStreamFrame handles the frames that concern streams and flow
+// control, and returns the size of the frame.
+func (c *Conn) handleStreamFrame(ftype byte, b []byte, now time.Time) (int, error) {
+	ss := &c.streams
+	switch {
+	case ftype&^0x07 == frameTypeStreamBase:
+		id, off, fin, data, n := consumeStreamFrame(b)
+		if n < 0 {
+			return n, nil
+		}
+		s, err := c.streamForFrame(id, true)
+		if err != nil || s == nil {
+			return n, err
+		}
+		return n, c.handleStreamData(s, off, data, fin)
+	case ftype == frameTypeResetStream:
+		id, code, finalSize, n := consumeResetStreamFrame(b)
+		if n < 0 {
+			return n, nil
+		}
+		s, err := c.streamForFrame(id, true)
+		if err != nil || s == nil {
+			return n, err
+		}
+		return n, c.handleResetStream(s, code, finalSize)
+	case ftype == frameTypeStopSending:
+		vs, n := consumeVarints(b[1:], 2)
+		if n < 0 {
+			return n, nil
+		}
+		s, err := c.streamForFrame(int64(vs[0]), false)
+		if err != nil || s == nil {
+			return 1 + n, err
+		}
+		if s.outStopErr == nil {
+			s.outStopErr = &StreamError{Code: vs[1]}
+			s.reset(vs[1])
+			c.notify()
+		}
+		return 1 + n, nil
+	case ftype == frameTypeMaxData:
+		vs, n := consumeVarints(b[1:], 1)
+		if n < 0 {
+			return n, nil
+		}
+		if v := int64(vs[0]); v > c.maxData {
+			c.maxData = v
+			for _, s := range ss.streams {
+				if s.hasPending(c) {
+					ss.queue(s)
+				}
+			}
+		}
+		return 1 + n, nil
+	case ftype == frameTypeMaxStreamData:
+		vs, n := consumeVarints(b[1:], 2)
+		if n < 0 {
+			return n, nil
+		}
+		s, err := c.streamForFrame(int64(vs[0]), false)
+		if err != nil || s == nil {
+			return 1 + n, err
+		}
+		if v := int64(vs[1]); v > s.outMaxData {
+			s.outMaxData = v
+			ss.queue(s)
+		}
+		return 1 + n, nil
+	case ftype == frameTypeMaxStreamsBidi || ftype == frameTypeMaxStreamsUni:
+		vs, n := consumeVarints(b[1:], 1)
+		if n < 0 {
+			return n, nil
+		}
+		if vs[0] > 1<<60 {
+			return 1 + n, &TransportError{Code: errFrameEncoding, Reason: "MAX_STREAMS above 2^60"}
+		}
+		kind := bidiStream
+		if ftype == frameTypeMaxStreamsUni {
+			kind = uniStream
+		}
+		if v := int64(vs[0]); v > ss.peerMax[kind] {
+			ss.peerMax[kind] = v
+			c.notify()
+		}
+		return 1 + n, nil
+	case ftype == frameTypeDataBlocked, ftype == frameTypeStreamsBlockedBidi, ftype == frameTypeStreamsBlockedUni:
+		_, n := consumeVarints(b[1:], 1)
+		if n < 0 {
+			return n, nil
+		}
+		return 1 + n, nil
+	case ftype == frameTypeStreamDataBlocked:
+		vs, n := consumeVarints(b[1:], 2)
+		if n < 0 {
+			return n, nil
+		}
+		_, err := c.streamForFrame(int64(vs[0]), true)
+		return 1 + n, err
+	}
+	return -1, nil
+}
+
+func (c *Conn) handleStreamData(s *Stream, off int64, data []byte, fin bool) error {
+	end := off + int64(len(data))
+	if end > s.inMaxData {
+		return &TransportError{Code: errFlowControl, Reason: "stream data exceeds MAX_STREAM_DATA"}
+	}
+	if s.inFinal >= 0 && (end > s.inFinal || fin && end != s.inFinal) {
+		return &TransportError{Code: errFinalSize}
+	}
+	if fin {
+		if end < s.in.end {
+			return &TransportError{Code: errFinalSize}
+		}
+		s.inFinal = end
+	}
+	if end > s.in.end {
+		c.dataRecvd += end - s.in.end
+		if c.dataRecvd > c.recvMaxData {
+			return &TransportError{Code: errFlowControl, Reason: "stream data exceeds MAX_DATA"}
+		}
+	}
+	if s.inClosed || s.inResetErr != nil {
+		// Discard the data, returning its flow control credit.
+		if end > s.in.end {
+			c.dataRead += end - s.in.end
+			s.in.end = end
+		}
+		c.streams.maybeRemove(c, s)
+		return nil
+	}
+	s.in.write(off, data)
+	c.notify()
+	return nil
+}
+
+func (c *Conn) handleResetStream(s *Stream, code uint64, finalSize int64) error {
+	if s.inFinal >= 0 && finalSize != s.inFinal || finalSize < s.in.end {
+		return &TransportError{Code: errFinalSize}
+	}
+	if finalSize > s.inMaxData {
+		return &TransportError{Code: errFlowControl, Reason: "final size exceeds MAX_STREAM_DATA"}
+	}
+	c.dataRecvd += finalSize - s.in.end
+	if c.dataRecvd > c.recvMaxData {
+		return &TransportError{Code: errFlowControl, Reason: "final size exceeds MAX_DATA"}
+	}
+	if s.inResetErr != nil || s.inEOF {
+		return nil
+	}
+	s.inFinal = finalSize
+	if !s.inClosed {
+		c.dataRead += finalSize - s.in.off
+	} else {
+		c.dataRead += finalSize - s.in.end
+	}
+	s.in.end = finalSize
+	s.in.buf = nil
+	s.in.recvd = nil
+	s.inResetErr = &StreamError{Code: code}
+	s.stopPending = false
+	s.maxDataPending = false
+	c.streams.maybeRemove(c, s)
+	c.notify()
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import "time"
+
+// Transport parameter IDs, RFC 9000, Section 18.2.
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+)
+
+// transportParameters are the transport parameters exchanged during
+// the handshake.
+type transportParameters struct {
+	originalDstConnID              []byte
+	maxIdleTimeout                 time.Duration
+	maxUDPPayloadSize              int64
+	initialMaxData                 int64
+	initialMaxStreamDataBidiLocal  int64
+	initialMaxStreamDataBidiRemote int64
+	initialMaxStreamDataUni        int64
+	initialMaxStreamsBidi          int64
+	initialMaxStreamsUni           int64
+	ackDelayExponent               int64
+	maxAckDelay                    time.Duration
+	disableActiveMigration         bool
+	activeConnIDLimit              int64
+	initialSrcConnID               []byte
+	retrySrcConnID                 []byte
+}
+
+// defaultTransportParameters returns the values of transport
+// parameters that are absent from the peer's parameters.
+func defaultTransportParameters() transportParameters {
+	return transportParameters{
+		maxUDPPayloadSize: 65527,
+		ackDelayExponent:  3,
+		maxAckDelay:       25 * time.Millisecond,
+		activeConnIDLimit: 2,
+	}
+}
+
+func (p *transportParameters) marshal() []byte {
+	var b []byte
+	appendParam := func(id uint64, v []byte) {
+		b = appendVarint(b, id)
+		b = appendVarintBytes(b, v)
+	}
+	appendInt := func(id uint64, v int64) {
+		appendParam(id, appendVarint(nil, uint64(v)))
+	}
+	if p.originalDstConnID != nil {
+		appendParam(paramOriginalDestinationConnectionID, p.originalDstConnID)
+	}
+	if p.maxIdleTimeout > 0 {
+		appendInt(paramMaxIdleTimeout, p.maxIdleTimeout.Milliseconds())
+	}
+	if p.maxUDPPayloadSize != 65527 {
+		appendInt(paramMaxUDPPayloadSize, p.maxUDPPayloadSize)
+	}
+	appendInt(paramInitialMaxData, p.initialMaxData)
+	appendInt(paramInitialMaxStreamDataBidiLocal, p.initialMaxStreamDataBidiLocal)
+	appendInt(paramInitialMaxStreamDataBidiRemote, p.initialMaxStreamDataBidiRemote)
+	appendInt(paramInitialMaxStreamDataUni, p.initialMaxStreamDataUni)
+	appendInt(paramInitialMaxStreamsBidi, p.initialMaxStreamsBidi)
+	appendInt(paramInitialMaxStreamsUni, p.initialMaxStreamsUni)
+	if p.ackDelayExponent != 3 {
+		appendInt(paramAckDelayExponent, p.ackDelayExponent)
+	}
+	if p.maxAckDelay != 25*time.Millisecond {
+		appendInt(paramMaxAckDelay, p.maxAckDelay.Milliseconds())
+	}
+	if p.disableActiveMigration {
+		appendParam(paramDisableActiveMigration, nil)
+	}
+	if p.activeConnIDLimit != 2 {
+		appendInt(paramActiveConnectionIDLimit, p.activeConnIDLimit)
+	}
+	if p.initialSrcConnID != nil {
+		appendParam(paramInitialSourceConnectionID, p.initialSrcConnID)
+	}
+	if p.retrySrcConnID != nil {
+		appendParam(paramRetrySourceConnectionID, p.retrySrcConnID)
+	}
+	return b
+}
+
+// unmarshalTransportParameters parses the transport parameters
+// received from the peer.
+func unmarshalTransportParameters(b []byte) (transportParameters, error) {
+	p := defaultTransportParameters()
+	seen := make(map[uint64]bool)
+	for len(b) > 0 {
+		id, n := consumeVarint(b)
+		if n < 0 {
+			return p, errTransportParam("truncated parameter ID")
+		}
+		b = b[n:]
+		v, n := consumeVarintBytes(b)
+		if n < 0 {
+			return p, errTransportParam("truncated parameter value")
+		}
+		b = b[n:]
+		if seen[id] {
+			return p, errTransportParam("duplicate parameter")
+		}
+		seen[id] = true
+		var ival int64
+		switch id {
+		case paramMaxIdleTimeout, paramMaxUDPPayloadSize, paramInitialMaxData,
+			paramInitialMaxStreamDataBidiLocal, paramInitialMaxStreamDataBidiRemote,
+			paramInitialMaxStreamDataUni, paramInitialMaxStreamsBidi,
+			paramInitialMaxStreamsUni, paramAckDelayExponent, paramMaxAckDelay,
+			paramActiveConnectionIDLimit:
+			u, n := consumeVarint(v)
+			if n != len(v) {
+				return p, errTransportParam("invalid integer parameter")
+			}
+			ival = int64(u)
+		}
+		switch id {
+		case paramOriginalDestinationConnectionID:
+			p.originalDstConnID = v
+		case paramMaxIdleTimeout:
+			p.maxIdleTimeout = time.Duration(ival) * time.Millisecond
+		case paramStatelessResetToken:
+			if len(v) != 16 {
+				return p, errTransportParam("invalid stateless_reset_token")
+			}
+		case paramMaxUDPPayloadSize:
+			if ival < 1200 {
+				return p, errTransportParam("max_udp_payload_size below 1200")
+			}
+			p.maxUDPPayloadSize = ival
+		case paramInitialMaxData:
+			p.initialMaxData = ival
+		case paramInitialMaxStreamDataBidiLocal:
+			p.initialMaxStreamDataBidiLocal = ival
+		case paramInitialMaxStreamDataBidiRemote:
+			p.initialMaxStreamDataBidiRemote = ival
+		case paramInitialMaxStreamDataUni:
+			p.initialMaxStreamDataUni = ival
+		case paramInitialMaxStreamsBidi:
+			if ival > 1<<60 {
+				return p, errTransportParam("initial_max_streams_bidi above 2^60")
+			}
+			p.initialMaxStreamsBidi = ival
+		case paramInitialMaxStreamsUni:
+			if ival > 1<<60 {
+				return p, errTransportParam("initial_max_streams_uni above 2^60")
+			}
+			p.initialMaxStreamsUni = ival
+		case paramAckDelayExponent:
+			if ival > 20 {
+				return p, errTransportParam("ack_delay_exponent above 20")
+			}
+			p.ackDelayExponent = ival
+		case paramMaxAckDelay:
+			if ival >= 1<<14 {
+				return p, errTransportParam("max_ack_delay above 2^14")
+			}
+			p.maxAckDelay = time.Duration(ival) * time.Millisecond
+		case paramDisableActiveMigration:
+			if len(v) != 0 {
+				return p, errTransportParam("invalid disable_active_migration")
+			}
+			p.disableActiveMigration = true
+		case paramActiveConnectionIDLimit:
+			if ival < 2 {
+				return p, errTransportParam("active_connection_id_limit below 2")
+			}
+			p.activeConnIDLimit = ival
+		case paramInitialSourceConnectionID:
+			p.initialSrcConnID = v
+		case paramRetrySourceConnectionID:
+			p.retrySrcConnID = v
+		}
+		// Unknown parameters, including preferred_address, which
+		// this package does not use, are ignored.
+	}
+	return p, nil
+}
+
+func errTransportParam(reason string) error {
+	return &TransportError{Code: errTransportParameter, Reason: reason}
+}
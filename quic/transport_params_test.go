@@ -0,0 +1,58 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransportParameters(t *testing.T) {
+	p := defaultTransportParameters()
+	p.originalDstConnID = []byte{1, 2, 3, 4}
+	p.maxIdleTimeout = 30 * time.Second
+	p.initialMaxData = 1 << 20
+	p.initialMaxStreamDataBidiLocal = 1 << 16
+	p.initialMaxStreamDataBidiRemote = 1 << 17
+	p.initialMaxStreamDataUni = 1 << 18
+	p.initialMaxStreamsBidi = 100
+	p.initialMaxStreamsUni = 3
+	p.maxAckDelay = 10 * time.Millisecond
+	p.disableActiveMigration = true
+	p.initialSrcConnID = []byte{5, 6}
+	got, err := unmarshalTransportParameters(p.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("got %+v; want %+v", got, p)
+	}
+}
+
+func TestTransportParametersErrors(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		b    []byte
+	}{
+		{"truncated", []byte{paramInitialMaxData, 4, 0x80}},
+		{"duplicate", []byte{paramInitialMaxData, 1, 1, paramInitialMaxData, 1, 1}},
+		{"trailing bytes in integer", []byte{paramInitialMaxData, 2, 1, 1}},
+		{"ack_delay_exponent", []byte{paramAckDelayExponent, 1, 21}},
+		{"active_connection_id_limit", []byte{paramActiveConnectionIDLimit, 1, 1}},
+		{"disable_active_migration", []byte{paramDisableActiveMigration, 1, 0}},
+	} {
+		if _, err := unmarshalTransportParameters(tt.b); err == nil {
+			t.Errorf("%s: unmarshal succeeded; want error", tt.desc)
+		}
+	}
+	// Unknown parameters are ignored.
+	if _, err := unmarshalTransportParameters([]byte{0x40, 0xff, 1, 0}); err != nil {
+		t.Errorf("unknown parameter: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+// maxVarint is the largest value that can be encoded as a
+// variable-length integer, RFC 9000, Section 16.
+const maxVarint = 1<<62 - 1
+
+// sizeVarint returns the number of bytes needed to encode v.
+func sizeVarint(v uint64) int {
+	switch {
+	case v < 1<<6:
+		return 1
+	case v < 1<<14:
+		return 2
+	case v < 1<<30:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// appendVarint appends the variable-length encoding of v to b.
+// v must not exceed maxVarint.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// consumeVarint parses a variable-length integer at the start of b.
+// It returns the value and the number of bytes consumed, or a
+// negative length if b is too short.
+func consumeVarint(b []byte) (uint64, int) {
+	if len(b) < 1 {
+		return 0, -1
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, -1
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// consumeVarintBytes parses a variable-length integer length followed
+// by that many bytes.
+func consumeVarintBytes(b []byte) ([]byte, int) {
+	l, n := consumeVarint(b)
+	if n < 0 || uint64(len(b)-n) < l {
+		return nil, -1
+	}
+	return b[n : n+int(l)], n + int(l)
+}
+
+// appendVarintBytes appends the length of v as a variable-length
+// integer, followed by v.
+func appendVarintBytes(b, v []byte) []byte {
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package quic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	// Examples from RFC 9000, Appendix A.1.
+	for _, tt := range []struct {
+		v uint64
+		b []byte
+	}{
+		{151288809941952652, []byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}},
+		{494878333, []byte{0x9d, 0x7f, 0x3e, 0x7d}},
+		{15293, []byte{0x7b, 0xbd}},
+		{37, []byte{0x25}},
+	} {
+		if got := appendVarint(nil, tt.v); !bytes.Equal(got, tt.b) {
+			t.Errorf("appendVarint(%d) = %x; want %x", tt.v, got, tt.b)
+		}
+		if got := sizeVarint(tt.v); got != len(tt.b) {
+			t.Errorf("sizeVarint(%d) = %d; want %d", tt.v, got, len(tt.b))
+		}
+		v, n := consumeVarint(tt.b)
+		if v != tt.v || n != len(tt.b) {
+			t.Errorf("consumeVarint(%x) = %d, %d; want %d, %d", tt.b, v, n, tt.v, len(tt.b))
+		}
+		if _, n := consumeVarint(tt.b[:len(tt.b)-1]); n >= 0 {
+			t.Errorf("consumeVarint(%x) succeeded on truncated input", tt.b[:len(tt.b)-1])
+		}
+	}
+	// Non-minimal encodings are valid.
+	if v, n := consumeVarint([]byte{0x40, 0x25}); v != 37 || n != 2 {
+		t.Errorf("consumeVarint(4025) = %d, %d; want 37, 2", v, n)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import "syscall"
+
+// An Addr represents an address associated with packet routing.
+type Addr interface {
+	// Family returns an address family.
+	Family() int
+}
+
+// A LinkAddr represents a link-layer address.
+type LinkAddr struct {
+	Index int    // interface index when attached
+	Name  string // interface name when attached
+	Addr  []byte // link-layer address when attached
+}
+
+// Family implements the Family method of Addr interface.
+// Linux has no AF_LINK; link-layer addresses belong to the packet
+// family instead.
+func (a *LinkAddr) Family() int { return syscall.AF_PACKET }
+
+// An Inet4Addr represents an internet address for IPv4.
+type Inet4Addr struct {
+	IP [4]byte // IP address
+}
+
+// Family implements the Family method of Addr interface.
+func (a *Inet4Addr) Family() int { return syscall.AF_INET }
+
+// An Inet6Addr represents an internet address for IPv6.
+type Inet6Addr struct {
+	IP     [16]byte // IP address
+	ZoneID int      // zone identifier
+}
+
+// Family implements the Family method of Addr interface.
+func (a *Inet6Addr) Family() int { return syscall.AF_INET6 }
+
+// A DefaultAddr represents an address of various operating
+// system-specific features.
+type DefaultAddr struct {
+	af  int
+	Raw []byte // raw format of address
+}
+
+// Family implements the Family method of Addr interface.
+func (a *DefaultAddr) Family() int { return a.af }
+
+// parseInetAddr parses b, the payload of a netlink attribute, as an
+// address of family af.
+func parseInetAddr(af int, b []byte) Addr {
+	switch {
+	case af == syscall.AF_INET && len(b) == 4:
+		a := &Inet4Addr{}
+		copy(a.IP[:], b)
+		return a
+	case af == syscall.AF_INET6 && len(b) == 16:
+		a := &Inet6Addr{}
+		copy(a.IP[:], b)
+		return a
+	}
+	return &DefaultAddr{af: af, Raw: b}
+}
+
+// prefixAddr returns the address of family af whose leading bits
+// bits are set, which is how BSD variants represent netmasks.
+func prefixAddr(af, bits int) Addr {
+	var b []byte
+	switch af {
+	case syscall.AF_INET:
+		b = make([]byte, 4)
+	case syscall.AF_INET6:
+		b = make([]byte, 16)
+	default:
+		return nil
+	}
+	for i := range b {
+		switch {
+		case bits >= 8:
+			b[i] = 0xff
+			bits -= 8
+		case bits > 0:
+			b[i] = ^byte(0xff >> uint(bits))
+			bits = 0
+		}
+	}
+	return parseInetAddr(af, b)
+}
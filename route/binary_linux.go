@@ -0,0 +1,17 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import "unsafe"
+
+// nativeEndian decodes the fixed-size headers of rtnetlink messages,
+// which are in host byte order.
+var nativeEndian = func() binaryByteOrder {
+	i := uint32(1)
+	if b := (*[4]byte)(unsafe.Pointer(&i)); b[0] == 1 {
+		return littleEndian
+	}
+	return bigEndian
+}()
@@ -0,0 +1,18 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package route provides basic functions for the manipulation of
+// packet routing facilities on BSD variants.
+//
+// The package supports any version of Darwin, any version of
+// DragonFly BSD, FreeBSD 7 and above, NetBSD 6 and above, and OpenBSD
+// 5.6 and above.
+//
+// On Linux, the package provides the same functions for fetching and
+// parsing routing information over rtnetlink, so that interfaces,
+// addresses and routes can be enumerated through a single API.
+//
+// On all supported systems, Watch delivers changes to routes,
+// addresses and interfaces as typed events.
+package route
@@ -0,0 +1,160 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// An InterfaceMessage represents an interface message.
+//
+// On Linux, an InterfaceMessage is parsed from an rtnetlink link
+// message, and its Addrs field holds the link-layer address at the
+// same index as on BSD variants.
+type InterfaceMessage struct {
+	Version int    // message version
+	Type    int    // message type
+	Flags   int    // interface flags
+	Index   int    // interface index
+	Name    string // interface name
+	Addrs   []Addr // addresses
+
+	ifType int
+	mtu    int
+}
+
+// Sys implements the Sys method of Message interface.
+func (m *InterfaceMessage) Sys() []Sys {
+	return []Sys{&InterfaceMetrics{Type: m.ifType, MTU: m.mtu}}
+}
+
+// InterfaceMetrics represents interface metrics.
+type InterfaceMetrics struct {
+	Type int // interface type
+	MTU  int // maximum transmission unit
+}
+
+// SysType implements the SysType method of Sys interface.
+func (imx *InterfaceMetrics) SysType() SysType { return SysMetrics }
+
+// An InterfaceAddrMessage represents an interface address message.
+//
+// On Linux, an InterfaceAddrMessage is parsed from an rtnetlink
+// address message. Its Addrs field holds the netmask derived from the
+// prefix length, the interface address and the broadcast or
+// point-to-point destination address at the same indices as on BSD
+// variants.
+type InterfaceAddrMessage struct {
+	Version int    // message version
+	Type    int    // message type
+	Flags   int    // interface flags
+	Index   int    // interface index
+	Addrs   []Addr // addresses
+
+	Scope int // address scope
+}
+
+// Sys implements the Sys method of Message interface.
+func (m *InterfaceAddrMessage) Sys() []Sys { return nil }
+
+func parseInterfaceMessage(nm *syscall.NetlinkMessage) (Message, error) {
+	if len(nm.Data) < syscall.SizeofIfInfomsg {
+		return nil, errMessageTooShort
+	}
+	ifim := (*syscall.IfInfomsg)(unsafe.Pointer(&nm.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(nm)
+	if err != nil {
+		return nil, err
+	}
+	m := &InterfaceMessage{
+		Type:   int(nm.Header.Type),
+		Flags:  int(ifim.Flags),
+		Index:  int(ifim.Index),
+		Addrs:  make([]Addr, addrMax),
+		ifType: int(ifim.Type),
+	}
+	la := &LinkAddr{Index: m.Index}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFLA_IFNAME:
+			m.Name = string(trimNUL(a.Value))
+			la.Name = m.Name
+		case syscall.IFLA_ADDRESS:
+			la.Addr = a.Value
+		case syscall.IFLA_MTU:
+			if len(a.Value) >= 4 {
+				m.mtu = int(nativeEndian.Uint32(a.Value))
+			}
+		}
+	}
+	m.Addrs[addrIFP] = la
+	return m, nil
+}
+
+func parseInterfaceAddrMessage(nm *syscall.NetlinkMessage) (Message, error) {
+	if len(nm.Data) < syscall.SizeofIfAddrmsg {
+		return nil, errMessageTooShort
+	}
+	ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&nm.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(nm)
+	if err != nil {
+		return nil, err
+	}
+	af := int(ifam.Family)
+	m := &InterfaceAddrMessage{
+		Type:  int(nm.Header.Type),
+		Flags: int(ifam.Flags),
+		Index: int(ifam.Index),
+		Addrs: make([]Addr, addrMax),
+		Scope: int(ifam.Scope),
+	}
+	m.Addrs[addrNetmask] = prefixAddr(af, int(ifam.Prefixlen))
+	var local, address Addr
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFA_LOCAL:
+			local = parseInetAddr(af, a.Value)
+		case syscall.IFA_ADDRESS:
+			address = parseInetAddr(af, a.Value)
+		case syscall.IFA_BROADCAST:
+			m.Addrs[addrBrd] = parseInetAddr(af, a.Value)
+		}
+	}
+	// On point-to-point links, IFA_LOCAL is the local address and
+	// IFA_ADDRESS is the address of the peer. Otherwise IFA_LOCAL is
+	// usually absent or equal to IFA_ADDRESS.
+	switch {
+	case local == nil:
+		m.Addrs[addrIFA] = address
+	default:
+		m.Addrs[addrIFA] = local
+		if m.Addrs[addrBrd] == nil && !sameAddr(local, address) {
+			m.Addrs[addrBrd] = address
+		}
+	}
+	return m, nil
+}
+
+func sameAddr(a, b Addr) bool {
+	switch a := a.(type) {
+	case *Inet4Addr:
+		b, ok := b.(*Inet4Addr)
+		return ok && a.IP == b.IP
+	case *Inet6Addr:
+		b, ok := b.(*Inet6Addr)
+		return ok && a.IP == b.IP
+	}
+	return false
+}
+
+func trimNUL(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
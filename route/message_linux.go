@@ -0,0 +1,86 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import (
+	"os"
+	"syscall"
+)
+
+// A Message represents a routing message.
+type Message interface {
+	// Sys returns operating system-specific information.
+	Sys() []Sys
+}
+
+// A Sys reprensents operating system-specific information.
+type Sys interface {
+	// SysType returns a type of operating system-specific
+	// information.
+	SysType() SysType
+}
+
+// A SysType represents a type of operating system-specific
+// information.
+type SysType int
+
+const (
+	SysMetrics SysType = iota
+	SysStats
+)
+
+// ParseRIB parses b as a routing information base and returns a list
+// of routing messages.
+//
+// On Linux, b is a sequence of rtnetlink messages as returned by
+// FetchRIB. Messages other than link, address and route messages are
+// skipped.
+func ParseRIB(typ RIBType, b []byte) ([]Message, error) {
+	nms, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	for i := range nms {
+		nm := &nms[i]
+		var m Message
+		switch nm.Header.Type {
+		case syscall.NLMSG_DONE:
+			continue
+		case syscall.NLMSG_ERROR:
+			// An error of errno 0 is an acknowledgement.
+			if err := parseNetlinkError(nm); err != nil {
+				return nil, err
+			}
+			continue
+		case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			m, err = parseInterfaceMessage(nm)
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+			m, err = parseInterfaceAddrMessage(nm)
+		case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+			m, err = parseRouteMessage(nm)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func parseNetlinkError(nm *syscall.NetlinkMessage) error {
+	if len(nm.Data) < 4 {
+		return errMessageTooShort
+	}
+	errno := -int32(nativeEndian.Uint32(nm.Data[:4]))
+	if errno == 0 {
+		return nil
+	}
+	return os.NewSyscallError("netlink", syscall.Errno(errno))
+}
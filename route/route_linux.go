@@ -0,0 +1,179 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	errUnsupportedMessage = errors.New("unsupported message")
+	errMessageTooShort    = errors.New("message too short")
+)
+
+// A RouteMessage represents a message conveying an address prefix, a
+// nexthop address and an output interface.
+//
+// On Linux, a RouteMessage is parsed from an rtnetlink route message.
+// The Addrs field is laid out as on BSD variants, so that index 0
+// holds the destination, 1 the gateway, 2 the netmask derived from
+// the prefix length and 5 the preferred source address; absent
+// addresses are nil. The Flags field holds the rtnetlink route flags.
+type RouteMessage struct {
+	Version int     // message version
+	Type    int     // message type
+	Flags   int     // route flags
+	Index   int     // interface index when attached
+	ID      uintptr // sender's identifier; usually process ID
+	Seq     int     // sequence number
+	Err     error   // error on requested operation
+	Addrs   []Addr  // addresses
+
+	Table     int // routing table identifier
+	Protocol  int // routing protocol that installed the route
+	Scope     int // distance to the destination
+	RouteType int // type of route, such as unicast or blackhole
+
+	pathMTU int
+}
+
+// Sys implements the Sys method of Message interface.
+func (m *RouteMessage) Sys() []Sys {
+	return []Sys{&RouteMetrics{PathMTU: m.pathMTU}}
+}
+
+// RouteMetrics represents route metrics.
+type RouteMetrics struct {
+	PathMTU int // path maximum transmission unit
+}
+
+// SysType implements the SysType method of Sys interface.
+func (rmx *RouteMetrics) SysType() SysType { return SysMetrics }
+
+// A RIBType represents a type of routing information base.
+type RIBType int
+
+const (
+	RIBTypeRoute     RIBType = syscall.RTM_GETROUTE
+	RIBTypeInterface RIBType = syscall.RTM_GETLINK
+)
+
+// Indices of addresses in the Addrs field of messages, matching those
+// used by BSD variants.
+const (
+	addrDst     = 0
+	addrGateway = 1
+	addrNetmask = 2
+	addrIFP     = 4
+	addrIFA     = 5
+	addrBrd     = 7
+	addrMax     = 8
+)
+
+// FetchRIB fetches a routing information base from the operating
+// system.
+//
+// The provided af must be an address family.
+//
+// On Linux, the routing information base is fetched over rtnetlink.
+// When RIBType is related to network interfaces, the result contains
+// both link and address messages, as on BSD variants. The provided
+// arg is reserved and must be zero.
+func FetchRIB(af int, typ RIBType, arg int) ([]byte, error) {
+	switch typ {
+	case RIBTypeRoute:
+		return netlinkRIB(syscall.RTM_GETROUTE, af)
+	case RIBTypeInterface:
+		links, err := netlinkRIB(syscall.RTM_GETLINK, af)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := netlinkRIB(syscall.RTM_GETADDR, af)
+		if err != nil {
+			return nil, err
+		}
+		return append(links, addrs...), nil
+	}
+	return nil, errUnsupportedMessage
+}
+
+func netlinkRIB(proto, af int) ([]byte, error) {
+	b, err := syscall.NetlinkRIB(proto, af)
+	if err != nil {
+		return nil, os.NewSyscallError("netlinkrib", err)
+	}
+	return b, nil
+}
+
+func parseRouteMessage(nm *syscall.NetlinkMessage) (Message, error) {
+	if len(nm.Data) < syscall.SizeofRtMsg {
+		return nil, errMessageTooShort
+	}
+	rtm := (*syscall.RtMsg)(unsafe.Pointer(&nm.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(nm)
+	if err != nil {
+		return nil, err
+	}
+	af := int(rtm.Family)
+	m := &RouteMessage{
+		Type:      int(nm.Header.Type),
+		Flags:     int(rtm.Flags),
+		ID:        uintptr(nm.Header.Pid),
+		Seq:       int(nm.Header.Seq),
+		Addrs:     make([]Addr, addrMax),
+		Table:     int(rtm.Table),
+		Protocol:  int(rtm.Protocol),
+		Scope:     int(rtm.Scope),
+		RouteType: int(rtm.Type),
+	}
+	// A route without a destination attribute is a default route.
+	m.Addrs[addrDst] = prefixAddr(af, 0)
+	m.Addrs[addrNetmask] = prefixAddr(af, int(rtm.Dst_len))
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_DST:
+			m.Addrs[addrDst] = parseInetAddr(af, a.Value)
+		case syscall.RTA_GATEWAY:
+			m.Addrs[addrGateway] = parseInetAddr(af, a.Value)
+		case syscall.RTA_PREFSRC:
+			m.Addrs[addrIFA] = parseInetAddr(af, a.Value)
+		case syscall.RTA_OIF:
+			if len(a.Value) >= 4 {
+				m.Index = int(nativeEndian.Uint32(a.Value))
+			}
+		case syscall.RTA_TABLE:
+			if len(a.Value) >= 4 {
+				m.Table = int(nativeEndian.Uint32(a.Value))
+			}
+		case syscall.RTA_METRICS:
+			m.pathMTU = parseRouteMTU(a.Value)
+		}
+	}
+	return m, nil
+}
+
+// parseRouteMTU returns the path MTU in b, the payload of a nested
+// RTA_METRICS attribute.
+func parseRouteMTU(b []byte) int {
+	for len(b) >= syscall.SizeofRtAttr {
+		l := int(nativeEndian.Uint16(b[0:2]))
+		typ := nativeEndian.Uint16(b[2:4])
+		if l < syscall.SizeofRtAttr || l > len(b) {
+			return 0
+		}
+		if typ == syscall.RTAX_MTU && l >= syscall.SizeofRtAttr+4 {
+			return int(nativeEndian.Uint32(b[syscall.SizeofRtAttr:]))
+		}
+		l = (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if l > len(b) {
+			return 0
+		}
+		b = b[l:]
+	}
+	return 0
+}
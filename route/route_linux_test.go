@@ -0,0 +1,125 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestFetchAndParseRIBLinux(t *testing.T) {
+	for _, typ := range []RIBType{RIBTypeRoute, RIBTypeInterface} {
+		b, err := FetchRIB(syscall.AF_UNSPEC, typ, 0)
+		if err != nil {
+			t.Fatalf("FetchRIB(%d): %v", typ, err)
+		}
+		msgs, err := ParseRIB(typ, b)
+		if err != nil {
+			t.Fatalf("ParseRIB(%d): %v", typ, err)
+		}
+		if len(msgs) == 0 {
+			t.Errorf("ParseRIB(%d) returned no messages", typ)
+		}
+	}
+}
+
+// netlinkError returns an NLMSG_ERROR message of errno, followed by the
+// header of the request it answers.
+func netlinkError(errno syscall.Errno) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+4+syscall.NLMSG_HDRLEN)
+	nativeEndian.PutUint32(b[0:4], uint32(len(b)))
+	nativeEndian.PutUint16(b[4:6], syscall.NLMSG_ERROR)
+	nativeEndian.PutUint32(b[syscall.NLMSG_HDRLEN:], uint32(-int32(errno)))
+	return b
+}
+
+func TestParseRIBNetlinkError(t *testing.T) {
+	b, err := FetchRIB(syscall.AF_UNSPEC, RIBTypeInterface, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseRIB(RIBTypeInterface, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An acknowledgement is skipped, with the messages around it.
+	ack := netlinkError(0)
+	acked := append(append(append([]byte(nil), ack...), b...), ack...)
+	msgs, err := ParseRIB(RIBTypeInterface, acked)
+	if err != nil || len(msgs) != len(want) {
+		t.Errorf("ParseRIB with acknowledgements = %d messages, %v; want %d messages", len(msgs), err, len(want))
+	}
+
+	failed := append(netlinkError(syscall.EPERM), b...)
+	if _, err := ParseRIB(RIBTypeInterface, failed); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("ParseRIB with an EPERM error: %v; want EPERM", err)
+	}
+}
+
+func TestInterfaceMessagesMatchNet(t *testing.T) {
+	ift, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := FetchRIB(syscall.AF_UNSPEC, RIBTypeInterface, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := ParseRIB(RIBTypeInterface, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[int]string)
+	var naddrs int
+	for _, m := range msgs {
+		switch m := m.(type) {
+		case *InterfaceMessage:
+			names[m.Index] = m.Name
+			if la, ok := m.Addrs[addrIFP].(*LinkAddr); !ok || la.Index != m.Index || la.Name != m.Name {
+				t.Errorf("interface %d: unexpected link address %#v", m.Index, m.Addrs[addrIFP])
+			}
+		case *InterfaceAddrMessage:
+			naddrs++
+			if m.Addrs[addrIFA] == nil || m.Addrs[addrNetmask] == nil {
+				t.Errorf("interface %d: incomplete address message %#v", m.Index, m.Addrs)
+			}
+		}
+	}
+	for _, ifi := range ift {
+		if names[ifi.Index] != ifi.Name {
+			t.Errorf("interface %d: got name %q; want %q", ifi.Index, names[ifi.Index], ifi.Name)
+		}
+	}
+	if naddrs == 0 {
+		t.Error("no address messages")
+	}
+}
+
+func TestPrefixAddr(t *testing.T) {
+	tests := []struct {
+		af, bits int
+		want     net.IP
+	}{
+		{syscall.AF_INET, 0, net.IPv4(0, 0, 0, 0).To4()},
+		{syscall.AF_INET, 20, net.IPv4(255, 255, 240, 0).To4()},
+		{syscall.AF_INET, 32, net.IPv4(255, 255, 255, 255).To4()},
+		{syscall.AF_INET6, 64, net.ParseIP("ffff:ffff:ffff:ffff::")},
+	}
+	for _, tt := range tests {
+		var got net.IP
+		switch a := prefixAddr(tt.af, tt.bits).(type) {
+		case *Inet4Addr:
+			got = a.IP[:]
+		case *Inet6Addr:
+			got = a.IP[:]
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("prefixAddr(%d, %d) = %v; want %v", tt.af, tt.bits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package route
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	errNoDestination = errors.New("no destination address")
+	errFamilyMix     = errors.New("mismatched address families")
+)
+
+// A RouteSpec describes a route to add, delete or change in the
+// routing information base.
+type RouteSpec struct {
+	// Dst is the destination address; it must be an *Inet4Addr or
+	// *Inet6Addr.
+	Dst Addr
+
+	// Mask is the netmask of the destination; it must be of the
+	// same family as Dst. A nil Mask denotes a host route.
+	Mask Addr
+
+	// Gateway is the nexthop address. It is either an address of
+	// the same family as Dst, or a *LinkAddr denoting a route
+	// directly attached to an interface. It may be nil when
+	// deleting a route or when Index is set.
+	Gateway Addr
+
+	// Index, if non-zero, is the index of the outgoing interface.
+	Index int
+
+	// Flags are route flags in addition to those implied by the
+	// other fields, such as syscall.RTF_BLACKHOLE.
+	Flags int
+}
+
+var routeSeq uint32
+
+// NewAddRouteMessage returns a message that adds the route described
+// by spec when written to a routing socket.
+func NewAddRouteMessage(spec *RouteSpec) (*RouteMessage, error) {
+	return newRouteMessage(syscall.RTM_ADD, spec)
+}
+
+// NewDeleteRouteMessage returns a message that deletes the route
+// described by spec when written to a routing socket.
+func NewDeleteRouteMessage(spec *RouteSpec) (*RouteMessage, error) {
+	return newRouteMessage(syscall.RTM_DELETE, spec)
+}
+
+// NewChangeRouteMessage returns a message that changes the gateway,
+// interface or flags of the route described by spec when written to a
+// routing socket.
+func NewChangeRouteMessage(spec *RouteSpec) (*RouteMessage, error) {
+	return newRouteMessage(syscall.RTM_CHANGE, spec)
+}
+
+func newRouteMessage(typ int, spec *RouteSpec) (*RouteMessage, error) {
+	af, err := spec.family()
+	if err != nil {
+		return nil, err
+	}
+	flags := spec.Flags | syscall.RTF_UP
+	if typ == syscall.RTM_ADD {
+		flags |= syscall.RTF_STATIC
+	}
+	if spec.Mask == nil {
+		flags |= syscall.RTF_HOST
+	}
+	gw := spec.Gateway
+	switch gw.(type) {
+	case *Inet4Addr, *Inet6Addr:
+		flags |= syscall.RTF_GATEWAY
+	case nil:
+		// Kernels locate the outgoing interface of an interface
+		// route through a link-layer gateway address.
+		if spec.Index > 0 && typ != syscall.RTM_DELETE {
+			gw = &LinkAddr{Index: spec.Index}
+		}
+	}
+	as := make([]Addr, syscall.RTAX_MAX)
+	as[syscall.RTAX_DST] = spec.Dst
+	as[syscall.RTAX_GATEWAY] = gw
+	as[syscall.RTAX_NETMASK] = spec.Mask
+	if spec.Index > 0 && af == syscall.AF_INET6 {
+		// IPv6 link-local destinations and gateways are scoped
+		// to the outgoing interface.
+		as[syscall.RTAX_IFP] = &LinkAddr{Index: spec.Index}
+	}
+	return &RouteMessage{
+		Type:  typ,
+		Flags: flags,
+		Index: spec.Index,
+		ID:    uintptr(os.Getpid()),
+		Seq:   int(atomic.AddUint32(&routeSeq, 1)),
+		Addrs: as,
+	}, nil
+}
+
+// family validates the addresses of spec and returns their family.
+func (spec *RouteSpec) family() (int, error) {
+	var af int
+	switch spec.Dst.(type) {
+	case *Inet4Addr, *Inet6Addr:
+		af = spec.Dst.Family()
+	case nil:
+		return 0, errNoDestination
+	default:
+		return 0, errInvalidAddr
+	}
+	if spec.Mask != nil && spec.Mask.Family() != af {
+		return 0, errFamilyMix
+	}
+	switch gw := spec.Gateway.(type) {
+	case nil, *LinkAddr:
+	case *Inet4Addr, *Inet6Addr:
+		if gw.Family() != af {
+			return 0, errFamilyMix
+		}
+	default:
+		return 0, errInvalidAddr
+	}
+	return af, nil
+}
+
+// WriteRouteMessage writes m to a routing socket and returns the
+// kernel's reply. If the kernel rejects the request, the returned
+// error wraps the reported error number, such as syscall.EEXIST or
+// syscall.ESRCH.
+//
+// Modifying the routing information base usually requires
+// appropriate privileges.
+func WriteRouteMessage(m *RouteMessage) (*RouteMessage, error) {
+	b, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	s, err := syscall.Socket(syscall.AF_ROUTE, syscall.SOCK_RAW, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(s)
+	if _, err := syscall.Write(s, b); err != nil {
+		return nil, os.NewSyscallError("write", err)
+	}
+	rb := make([]byte, os.Getpagesize())
+	for {
+		n, err := syscall.Read(s, rb)
+		if err != nil {
+			return nil, os.NewSyscallError("read", err)
+		}
+		msgs, err := ParseRIB(RIBTypeRoute, rb[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			rm, ok := msg.(*RouteMessage)
+			if !ok || rm.ID != m.ID || rm.Seq != m.Seq {
+				continue
+			}
+			return rm, rm.Err
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package route
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestNewRouteMessage(t *testing.T) {
+	spec := &RouteSpec{
+		Dst:     &Inet4Addr{IP: [4]byte{192, 0, 2, 0}},
+		Mask:    &Inet4Addr{IP: [4]byte{255, 255, 255, 0}},
+		Gateway: &Inet4Addr{IP: [4]byte{127, 0, 0, 1}},
+	}
+	for _, fn := range []func(*RouteSpec) (*RouteMessage, error){NewAddRouteMessage, NewChangeRouteMessage, NewDeleteRouteMessage} {
+		m, err := fn(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Flags&(syscall.RTF_UP|syscall.RTF_GATEWAY) != syscall.RTF_UP|syscall.RTF_GATEWAY || m.Flags&syscall.RTF_HOST != 0 {
+			t.Errorf("type %d: unexpected flags %#x", m.Type, m.Flags)
+		}
+		b, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := ParseRIB(RIBTypeRoute, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rm := msgs[0].(*RouteMessage)
+		if rm.Type != m.Type || rm.Seq != m.Seq || rm.ID != m.ID {
+			t.Errorf("got type %d seq %d id %d; want type %d seq %d id %d", rm.Type, rm.Seq, rm.ID, m.Type, m.Seq, m.ID)
+		}
+		for _, i := range []int{syscall.RTAX_DST, syscall.RTAX_GATEWAY} {
+			if got, want := rm.Addrs[i].(*Inet4Addr).IP, m.Addrs[i].(*Inet4Addr).IP; got != want {
+				t.Errorf("address %d: got %v; want %v", i, got, want)
+			}
+		}
+	}
+}
+
+func TestNewRouteMessageInterfaceRoute(t *testing.T) {
+	m, err := NewAddRouteMessage(&RouteSpec{
+		Dst:   &Inet6Addr{IP: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+		Index: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Flags&syscall.RTF_HOST == 0 || m.Flags&syscall.RTF_GATEWAY != 0 {
+		t.Errorf("unexpected flags %#x", m.Flags)
+	}
+	if a, ok := m.Addrs[syscall.RTAX_GATEWAY].(*LinkAddr); !ok || a.Index != 1 {
+		t.Errorf("gateway = %#v; want link address of interface 1", m.Addrs[syscall.RTAX_GATEWAY])
+	}
+}
+
+func TestNewRouteMessageErrors(t *testing.T) {
+	v4 := &Inet4Addr{IP: [4]byte{192, 0, 2, 1}}
+	v6 := &Inet6Addr{IP: [16]byte{15: 1}}
+	for _, spec := range []*RouteSpec{
+		{},
+		{Dst: &LinkAddr{Index: 1}},
+		{Dst: v4, Mask: v6},
+		{Dst: v4, Gateway: v6},
+		{Dst: v6, Gateway: &DefaultAddr{}},
+	} {
+		if _, err := NewAddRouteMessage(spec); err == nil {
+			t.Errorf("NewAddRouteMessage(%#v) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package route
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// An EventType represents a type of change to the routing
+// information base.
+type EventType int
+
+const (
+	// RouteAdded reports that a route was added. On Linux, it is
+	// also reported when an existing route is replaced.
+	RouteAdded EventType = iota + 1
+
+	// RouteDeleted reports that a route was deleted.
+	RouteDeleted
+
+	// RouteChanged reports that the gateway, interface or metrics
+	// of a route changed. It is not reported on Linux.
+	RouteChanged
+
+	// AddrAdded reports that an address was assigned to an
+	// interface.
+	AddrAdded
+
+	// AddrDeleted reports that an address was removed from an
+	// interface.
+	AddrDeleted
+
+	// LinkUp reports that an interface was administratively
+	// brought up. Except on Linux, where LinkAdded is reported
+	// instead, it is also reported when an interface which arrived
+	// after Watch was called is first announced up.
+	LinkUp
+
+	// LinkDown reports that an interface was brought down. Except on
+	// Linux, where LinkAdded is reported instead, it is also reported
+	// when an interface which arrived after Watch was called is first
+	// announced down.
+	LinkDown
+
+	// LinkAdded reports that an interface arrived. On Linux, it is
+	// reported for the first link notification of an interface which
+	// did not exist when Watch was called, whatever its state. It is
+	// not reported on Darwin.
+	LinkAdded
+
+	// LinkRemoved reports that an interface departed.
+	LinkRemoved
+
+	// Resync reports that the kernel dropped notifications because
+	// they were not read fast enough. Consumers that maintain state
+	// should fetch the routing information base again.
+	Resync
+)
+
+var eventTypeNames = map[EventType]string{
+	RouteAdded:   "RouteAdded",
+	RouteDeleted: "RouteDeleted",
+	RouteChanged: "RouteChanged",
+	AddrAdded:    "AddrAdded",
+	AddrDeleted:  "AddrDeleted",
+	LinkUp:       "LinkUp",
+	LinkDown:     "LinkDown",
+	LinkAdded:    "LinkAdded",
+	LinkRemoved:  "LinkRemoved",
+	Resync:       "Resync",
+}
+
+func (typ EventType) String() string {
+	if s, ok := eventTypeNames[typ]; ok {
+		return s
+	}
+	return "EventType(" + itoa(int(typ)) + ")"
+}
+
+// An Event represents a change to the routing information base.
+type Event struct {
+	Type EventType
+
+	// Message is the notification that caused the event. It is a
+	// *RouteMessage for route events, an *InterfaceAddrMessage for
+	// address events, and an *InterfaceMessage or
+	// *InterfaceAnnounceMessage for link events. It is nil for
+	// Resync events.
+	Message Message
+}
+
+// A Watcher delivers changes to the routing information base as
+// they are announced by the kernel.
+type Watcher struct {
+	events chan Event
+	f      *os.File
+
+	closeOnce sync.Once
+	closing   chan struct{}
+
+	mu  sync.Mutex
+	err error
+
+	links map[int]bool // whether each known interface is up
+}
+
+// knownLinks returns the state of the interfaces of the system, by
+// index, as the links known to a new Watcher.
+func knownLinks() (map[int]bool, error) {
+	ifts, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[int]bool, len(ifts))
+	for _, ifi := range ifts {
+		links[ifi.Index] = ifi.Flags&net.FlagUp != 0
+	}
+	return links, nil
+}
+
+// Watch starts watching the routing information base for changes.
+// Events are delivered until ctx is done, Close is called or reading
+// notifications fails, at which point the channel returned by Events
+// is closed.
+//
+// Watching starts before Watch returns, so a consumer may call
+// FetchRIB afterwards to obtain an initial state without missing any
+// change.
+func Watch(ctx context.Context) (*Watcher, error) {
+	f, err := openWatchSocket()
+	if err != nil {
+		return nil, err
+	}
+	// The interfaces are listed once the socket is open, so that
+	// those which arrive later are announced.
+	links, err := knownLinks()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		events:  make(chan Event, 64),
+		f:       f,
+		closing: make(chan struct{}),
+		links:   links,
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Close()
+		case <-w.closing:
+		}
+	}()
+	go func() {
+		defer close(w.events)
+		err := w.run()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+	}()
+	return w, nil
+}
+
+// Events returns the channel on which events are delivered.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Err returns the error that stopped the Watcher, once the channel
+// returned by Events is closed. It returns ctx.Err() if the context
+// passed to Watch is done, and nil if Close was called.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops the Watcher. Events that were already read from the
+// kernel may still be delivered before the channel returned by Events
+// is closed.
+func (w *Watcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.closing)
+		err = w.f.Close()
+	})
+	return err
+}
+
+func (w *Watcher) run() error {
+	b := make([]byte, 1<<16)
+	defer w.Close()
+	for {
+		n, err := w.f.Read(b)
+		if err != nil {
+			if errors.Is(err, syscall.ENOBUFS) {
+				if !w.send(Event{Type: Resync}) {
+					return nil
+				}
+				continue
+			}
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		msgs, err := parseWatchMessages(b[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			typ, ok := w.eventType(m)
+			if !ok {
+				continue
+			}
+			if !w.send(Event{Type: typ, Message: m}) {
+				return nil
+			}
+		}
+	}
+}
+
+func (w *Watcher) send(ev Event) bool {
+	select {
+	case w.events <- ev:
+		return true
+	case <-w.closing:
+		return false
+	}
+}
+
+// linkEvent records the state of the interface with the given index
+// and reports whether it changed. An interface unknown to the Watcher,
+// which arrived after Watch was called, is reported up or down.
+func (w *Watcher) linkEvent(index int, up bool) (EventType, bool) {
+	if was, ok := w.links[index]; ok && was == up {
+		return 0, false
+	}
+	w.links[index] = up
+	if up {
+		return LinkUp, true
+	}
+	return LinkDown, true
+}
+
+func itoa(n int) string {
+	if n < 0 {
+		return "-" + itoa(-n)
+	}
+	var b [20]byte
+	i := len(b)
+	for {
+		i--
+		b[i] = byte('0' + n%10)
+		n /= 10
+		if n == 0 {
+			break
+		}
+	}
+	return string(b[i:])
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package route
+
+import (
+	"os"
+	"syscall"
+)
+
+func openWatchSocket() (*os.File, error) {
+	s, err := syscall.Socket(syscall.AF_ROUTE, syscall.SOCK_RAW, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	syscall.CloseOnExec(s)
+	if err := syscall.SetNonblock(s, true); err != nil {
+		syscall.Close(s)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	return os.NewFile(uintptr(s), "route"), nil
+}
+
+// linkInfoType is the type of notifications of interface state.
+const linkInfoType = syscall.RTM_IFINFO
+
+func parseWatchMessages(b []byte) ([]Message, error) {
+	msgs, err := ParseRIB(RIBTypeRoute, b)
+	if err == errMessageMismatch {
+		// Notifications of message types unknown to this package
+		// are not worth stopping the Watcher for.
+		return nil, nil
+	}
+	return msgs, err
+}
+
+func (w *Watcher) eventType(m Message) (EventType, bool) {
+	switch m := m.(type) {
+	case *RouteMessage:
+		switch m.Type {
+		case syscall.RTM_ADD:
+			return RouteAdded, true
+		case syscall.RTM_DELETE:
+			return RouteDeleted, true
+		case syscall.RTM_CHANGE:
+			return RouteChanged, true
+		}
+	case *InterfaceAddrMessage:
+		switch m.Type {
+		case syscall.RTM_NEWADDR:
+			return AddrAdded, true
+		case syscall.RTM_DELADDR:
+			return AddrDeleted, true
+		}
+	case *InterfaceMessage:
+		if m.Type == linkInfoType {
+			return w.linkEvent(m.Index, m.Flags&syscall.IFF_UP != 0)
+		}
+	case *InterfaceAnnounceMessage:
+		switch m.What {
+		case 0:
+			return LinkAdded, true
+		case 1:
+			delete(w.links, m.Index)
+			return LinkRemoved, true
+		}
+	}
+	return 0, false
+}
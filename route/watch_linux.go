@@ -0,0 +1,71 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package route
+
+import (
+	"os"
+	"syscall"
+)
+
+// watchGroups are the rtnetlink multicast groups joined by a Watcher.
+const watchGroups = 1<<(syscall.RTNLGRP_LINK-1) |
+	1<<(syscall.RTNLGRP_IPV4_IFADDR-1) |
+	1<<(syscall.RTNLGRP_IPV6_IFADDR-1) |
+	1<<(syscall.RTNLGRP_IPV4_ROUTE-1) |
+	1<<(syscall.RTNLGRP_IPV6_ROUTE-1)
+
+func openWatchSocket() (*os.File, error) {
+	s, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: watchGroups}
+	if err := syscall.Bind(s, sa); err != nil {
+		syscall.Close(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return os.NewFile(uintptr(s), "rtnetlink"), nil
+}
+
+// linkInfoType is the type of notifications of interface state.
+const linkInfoType = syscall.RTM_NEWLINK
+
+func parseWatchMessages(b []byte) ([]Message, error) {
+	return ParseRIB(RIBTypeRoute, b)
+}
+
+func (w *Watcher) eventType(m Message) (EventType, bool) {
+	switch m := m.(type) {
+	case *RouteMessage:
+		switch m.Type {
+		case syscall.RTM_NEWROUTE:
+			return RouteAdded, true
+		case syscall.RTM_DELROUTE:
+			return RouteDeleted, true
+		}
+	case *InterfaceAddrMessage:
+		switch m.Type {
+		case syscall.RTM_NEWADDR:
+			return AddrAdded, true
+		case syscall.RTM_DELADDR:
+			return AddrDeleted, true
+		}
+	case *InterfaceMessage:
+		switch m.Type {
+		case linkInfoType:
+			// There are no arrival notifications: the interfaces
+			// not listed by Watch arrived.
+			if _, ok := w.links[m.Index]; !ok {
+				w.links[m.Index] = m.Flags&syscall.IFF_UP != 0
+				return LinkAdded, true
+			}
+			return w.linkEvent(m.Index, m.Flags&syscall.IFF_UP != 0)
+		case syscall.RTM_DELLINK:
+			delete(w.links, m.Index)
+			return LinkRemoved, true
+		}
+	}
+	return 0, false
+}
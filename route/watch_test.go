@@ -0,0 +1,91 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package route
+
+import (
+	"context"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func drainEvents(t *testing.T, w *Watcher) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-w.Events():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Events channel not closed")
+		}
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := Watch(ctx)
+	if err != nil {
+		t.Skipf("Watch: %v", err)
+	}
+	cancel()
+	drainEvents(t, w)
+	if err := w.Err(); err != context.Canceled {
+		t.Errorf("Err() = %v; want %v", err, context.Canceled)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close after cancel: %v", err)
+	}
+}
+
+func TestWatchClose(t *testing.T) {
+	w, err := Watch(context.Background())
+	if err != nil {
+		t.Skipf("Watch: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	drainEvents(t, w)
+	if err := w.Err(); err != nil {
+		t.Errorf("Err() = %v; want nil", err)
+	}
+}
+
+func TestWatcherLinkEvent(t *testing.T) {
+	// Interface 1 is up and interface 2 down when Watch is called, and
+	// interface 3 arrives up later.
+	w := &Watcher{links: map[int]bool{1: true, 2: false}}
+	arrived := LinkUp
+	if runtime.GOOS == "linux" {
+		arrived = LinkAdded
+	}
+	for i, tt := range []struct {
+		m    *InterfaceMessage
+		typ  EventType
+		want bool
+	}{
+		{&InterfaceMessage{Index: 1, Flags: syscall.IFF_UP}, 0, false},
+		{&InterfaceMessage{Index: 1, Flags: syscall.IFF_UP | syscall.IFF_RUNNING}, 0, false},
+		{&InterfaceMessage{Index: 2, Flags: syscall.IFF_UP}, LinkUp, true},
+		{&InterfaceMessage{Index: 1}, LinkDown, true},
+		{&InterfaceMessage{Index: 1, Flags: syscall.IFF_UP}, LinkUp, true},
+		{&InterfaceMessage{Index: 3, Flags: syscall.IFF_UP}, arrived, true},
+		{&InterfaceMessage{Index: 3, Flags: syscall.IFF_UP}, 0, false},
+		{&InterfaceMessage{Index: 3}, LinkDown, true},
+	} {
+		tt.m.Type = linkInfoType
+		typ, ok := w.eventType(tt.m)
+		if typ != tt.typ || ok != tt.want {
+			t.Errorf("#%d: eventType = %v, %v; want %v, %v", i, typ, ok, tt.typ, tt.want)
+		}
+	}
+}
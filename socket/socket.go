@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package socket provides access to socket system calls that the net
+// package does not expose: sendmsg and recvmsg with ancillary data,
+// the batched sendmmsg and recvmmsg system calls, and raw socket
+// options.
+//
+// The package is the one the ipv4, ipv6 and icmp packages build on,
+// and its types are identical to theirs; for example, ipv4.Message
+// and ipv6.Message are both socket.Message.
+//
+// Control messages are laid out as described in RFC 3542. A buffer
+// for receiving them is allocated with NewControlMessage, and a
+// received buffer is split with the Parse method of ControlMessage:
+//
+//	oob := socket.NewControlMessage([]int{4, 16})
+//	m := socket.Message{Buffers: [][]byte{b}, OOB: oob}
+//	if err := c.RecvMsg(&m, 0); err != nil {
+//		// handle error
+//	}
+//	cms, err := socket.ControlMessage(m.OOB[:m.NN]).Parse()
+//	if err != nil {
+//		// handle error
+//	}
+//	for _, cm := range cms {
+//		lvl, typ, l, err := cm.ParseHeader()
+//		if err != nil {
+//			// handle error
+//		}
+//		data := cm.Data(l)
+//		// use lvl, typ and data
+//	}
+//
+// The batched RecvMsgs and SendMsgs methods of Conn are implemented
+// only on Linux. On other platforms, and on platforms that lack
+// sendmsg and recvmsg altogether, methods return an error.
+package socket // import "golang.org/x/net/socket"
+
+import (
+	"encoding/binary"
+	"net"
+
+	"golang.org/x/net/internal/socket"
+)
+
+// A Conn represents a raw connection.
+//
+// A Conn is created from a *net.TCPConn, *net.UDPConn or *net.IPConn
+// by NewConn. It provides the RecvMsg, SendMsg, RecvMsgs and SendMsgs
+// methods:
+//
+//	func (c *Conn) RecvMsg(m *Message, flags int) error
+//	func (c *Conn) SendMsg(m *Message, flags int) error
+//	func (c *Conn) RecvMsgs(ms []Message, flags int) (int, error)
+//	func (c *Conn) SendMsgs(ms []Message, flags int) (int, error)
+//
+// The provided flags are platform-dependent, such as syscall.MSG_PEEK.
+// RecvMsgs and SendMsgs return the number of messages processed.
+type Conn = socket.Conn
+
+// NewConn returns a new raw connection for c, which must be a
+// *net.TCPConn, *net.UDPConn or *net.IPConn.
+func NewConn(c net.Conn) (*Conn, error) {
+	return socket.NewConn(c)
+}
+
+// A Message represents an IO message.
+//
+//	type Message struct {
+//		Buffers [][]byte
+//		OOB     []byte
+//		Addr    net.Addr
+//		N       int
+//		NN      int
+//		Flags   int
+//	}
+//
+// The Buffers field represents a list of contiguous buffers used for
+// vectored IO. When writing, it must contain at least one byte to
+// write.
+//
+// The OOB field contains ancillary data, such as control messages.
+// It can be nil when not required.
+//
+// The Addr field specifies a destination address when writing. It can
+// be nil when the connection is connection-oriented. After a
+// successful read, it may contain the source address of the received
+// message.
+//
+// The N and NN fields indicate the number of bytes read or written
+// from or to Buffers and OOB respectively.
+//
+// The Flags field contains protocol-specific information on the
+// received message, such as syscall.MSG_TRUNC.
+type Message = socket.Message
+
+// An Option represents a sticky socket option.
+//
+//	type Option struct {
+//		Level int
+//		Name  int
+//		Len   int
+//	}
+//
+// Name and Len must be at least 1. The value of the option is read
+// and written with the Get, GetInt, Set and SetInt methods:
+//
+//	func (o *Option) Get(c *Conn, b []byte) (int, error)
+//	func (o *Option) GetInt(c *Conn) (int, error)
+//	func (o *Option) Set(c *Conn, b []byte) error
+//	func (o *Option) SetInt(c *Conn, v int) error
+//
+// GetInt and SetInt require Len to be either 1 or 4.
+type Option = socket.Option
+
+// A ControlMessage represents the head message in a stream of control
+// messages.
+//
+// It provides the Data, Next, MarshalHeader, ParseHeader, Marshal and
+// Parse methods for walking and building streams of control messages.
+type ControlMessage = socket.ControlMessage
+
+// ControlMessageSpace returns the whole length of a control message
+// carrying dataLen bytes of data, including padding.
+func ControlMessageSpace(dataLen int) int {
+	return socket.ControlMessageSpace(dataLen)
+}
+
+// NewControlMessage returns a new stream of control messages with
+// room for messages carrying the given lengths of data.
+func NewControlMessage(dataLen []int) ControlMessage {
+	return socket.NewControlMessage(dataLen)
+}
+
+// NativeEndian is the byte order of the platform, in which socket
+// option values and control message data are encoded by the kernel.
+var NativeEndian binary.ByteOrder = socket.NativeEndian
@@ -0,0 +1,159 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris || zos
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris zos
+
+package socket_test
+
+import (
+	"bytes"
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/nettest"
+	"golang.org/x/net/socket"
+)
+
+// The public types are those of the packages built on top.
+var _ []ipv4.Message = []socket.Message(nil)
+
+func newUDPConns(t *testing.T) (net.PacketConn, *socket.Conn, *socket.Conn) {
+	t.Helper()
+	c1, err := nettest.NewLocalPacketListener("udp")
+	if err != nil {
+		t.Skipf("not supported on %s/%s: %v", runtime.GOOS, runtime.GOARCH, err)
+	}
+	t.Cleanup(func() { c1.Close() })
+	c2, err := net.DialUDP("udp", nil, c1.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c2.Close() })
+	r, err := socket.NewConn(c1.(net.Conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := socket.NewConn(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c1, r, w
+}
+
+func TestOption(t *testing.T) {
+	_, c, _ := newUDPConns(t)
+	o := &socket.Option{Level: syscall.SOL_SOCKET, Name: syscall.SO_RCVBUF, Len: 4}
+	const N = 2048
+	if err := o.SetInt(c, N); err != nil {
+		t.Fatal(err)
+	}
+	n, err := o.GetInt(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < N {
+		t.Fatalf("got %d; want greater than or equal to %d", n, N)
+	}
+	b := make([]byte, 4)
+	if _, err := o.Get(c, b); err != nil {
+		t.Fatal(err)
+	}
+	if got := int(socket.NativeEndian.Uint32(b)); got != n {
+		t.Errorf("Get = %d; GetInt = %d", got, n)
+	}
+}
+
+func TestMsg(t *testing.T) {
+	_, r, w := newUDPConns(t)
+	data := []byte("HELLO-R-U-THERE")
+	wm := socket.Message{Buffers: [][]byte{data[:5], data[5:]}}
+	if err := w.SendMsg(&wm, 0); err != nil {
+		t.Fatal(err)
+	}
+	if wm.N != len(data) {
+		t.Fatalf("SendMsg wrote %d bytes; want %d", wm.N, len(data))
+	}
+	b := make([]byte, 64)
+	rm := socket.Message{Buffers: [][]byte{b}}
+	if err := r.RecvMsg(&rm, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:rm.N], data) {
+		t.Errorf("got %q; want %q", b[:rm.N], data)
+	}
+	if rm.Addr == nil {
+		t.Error("RecvMsg returned no source address")
+	}
+}
+
+func TestMsgs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skipf("not supported on %s", runtime.GOOS)
+	}
+	_, r, w := newUDPConns(t)
+	const N = 3
+	wms := make([]socket.Message, N)
+	for i := range wms {
+		wms[i].Buffers = [][]byte{{byte('a' + i)}}
+	}
+	if n, err := w.SendMsgs(wms, 0); err != nil || n != N {
+		t.Fatalf("SendMsgs = %d, %v; want %d, nil", n, err, N)
+	}
+	rms := make([]socket.Message, N)
+	for i := range rms {
+		rms[i].Buffers = [][]byte{make([]byte, 8)}
+	}
+	for got := 0; got < N; {
+		n, err := r.RecvMsgs(rms[got:], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += n
+	}
+	for i, m := range rms {
+		if m.N != 1 || m.Buffers[0][0] != byte('a'+i) {
+			t.Errorf("#%d: got %q", i, m.Buffers[0][:m.N])
+		}
+	}
+}
+
+func TestControlMessage(t *testing.T) {
+	m := socket.NewControlMessage([]int{0, 1, 4})
+	if len(m) != socket.ControlMessageSpace(0)+socket.ControlMessageSpace(1)+socket.ControlMessageSpace(4) {
+		t.Fatalf("got %d bytes", len(m))
+	}
+	next, err := m.Marshal(1, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, err = next.Marshal(2, 2, []byte{0xfe}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = next.Marshal(3, 3, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	cms, err := m.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cms) != 3 {
+		t.Fatalf("got %d messages; want 3", len(cms))
+	}
+	for i, cm := range cms {
+		lvl, typ, l, err := cm.ParseHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lvl != i+1 || typ != i+1 {
+			t.Errorf("#%d: got level %d, type %d", i, lvl, typ)
+		}
+		if want := []int{0, 1, 4}[i]; l != want {
+			t.Errorf("#%d: got data length %d; want %d", i, l, want)
+		}
+	}
+}
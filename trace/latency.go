@@ -0,0 +1,167 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+// This file exports the latency distributions of the families, for
+// metrics systems.
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"golang.org/x/net/internal/timeseries"
+)
+
+// maxLatencyTitles is the maximum number of titles of a family whose
+// latency is tracked separately. The traces of further titles are only
+// accounted for in the distribution of the family.
+const maxLatencyTitles = 100
+
+// A LatencyWindow selects the traces accounted for by a
+// LatencyDistribution, by the time they finished.
+type LatencyWindow int
+
+const (
+	LastMinute LatencyWindow = iota // traces finished in the last minute
+	LastHour                        // traces finished in the last hour
+	AllTime                         // all the finished traces
+)
+
+// A LatencyDistribution is a snapshot of the distribution of the
+// durations of the finished traces of a family, or of those of the
+// family with a given title, typically the method of an RPC.
+type LatencyDistribution struct {
+	Family string
+	Title  string // empty for the distribution of the whole family
+
+	Count int64         // number of traces
+	Sum   time.Duration // total duration of the traces
+
+	// Buckets holds the histogram of the durations, whose buckets are
+	// spaced out in powers of 2 microseconds. Only the non-empty buckets
+	// are listed, in increasing order.
+	Buckets []LatencyBucket
+
+	h *histogram
+}
+
+// A LatencyBucket counts the traces whose duration is at least Lower and
+// less than Upper.
+type LatencyBucket struct {
+	Lower, Upper time.Duration
+	Count        int64
+}
+
+// Mean returns the mean duration of the traces.
+func (d *LatencyDistribution) Mean() time.Duration {
+	return time.Duration(d.h.average() * float64(time.Microsecond))
+}
+
+// Percentile estimates the duration which the fraction p of the traces,
+// between 0 and 1, took less than, such as 0.99 for the 99th percentile.
+// The estimate is interpolated within the bucket of the histogram which
+// holds it.
+func (d *LatencyDistribution) Percentile(p float64) time.Duration {
+	return time.Duration(d.h.percentileBoundary(p)) * time.Microsecond
+}
+
+// Latency returns the latency distribution of the traces of family
+// which finished in window w. If title is not empty, only the traces
+// with that title are accounted for; they are tracked for at most
+// maxLatencyTitles titles per family. Latency returns nil if no trace
+// was accounted for.
+func Latency(family, title string, w LatencyWindow) *LatencyDistribution {
+	f := getFamily(family, false)
+	if f == nil {
+		return nil
+	}
+	f.LatencyMu.Lock()
+	defer f.LatencyMu.Unlock()
+	ts := f.Latency
+	if title != "" {
+		if ts = f.TitleLatency[title]; ts == nil {
+			return nil
+		}
+	}
+	return newLatencyDistribution(family, title, ts, w)
+}
+
+// Latencies returns the latency distributions of all the families, and
+// of their titles, for the traces which finished in window w. They are
+// sorted by family, then title.
+func Latencies(w LatencyWindow) []*LatencyDistribution {
+	completedMu.RLock()
+	families := make(map[string]*family, len(completedTraces))
+	for fam, f := range completedTraces {
+		families[fam] = f
+	}
+	completedMu.RUnlock()
+
+	var ds []*LatencyDistribution
+	for fam, f := range families {
+		f.LatencyMu.Lock()
+		if d := newLatencyDistribution(fam, "", f.Latency, w); d != nil {
+			ds = append(ds, d)
+		}
+		for title, ts := range f.TitleLatency {
+			if d := newLatencyDistribution(fam, title, ts, w); d != nil {
+				ds = append(ds, d)
+			}
+		}
+		f.LatencyMu.Unlock()
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].Family != ds[j].Family {
+			return ds[i].Family < ds[j].Family
+		}
+		return ds[i].Title < ds[j].Title
+	})
+	return ds
+}
+
+// newLatencyDistribution returns a snapshot of window w of ts, or nil if
+// it is empty. The caller must hold the LatencyMu of the family of ts
+// locked for writing, as the windows of ts advance when read.
+func newLatencyDistribution(family, title string, ts *timeseries.MinuteHourSeries, w LatencyWindow) *LatencyDistribution {
+	var obs timeseries.Observable
+	switch w {
+	case LastMinute:
+		obs = ts.Minute()
+	case LastHour:
+		obs = ts.Hour()
+	default:
+		obs = ts.Total()
+	}
+	h := new(histogram)
+	h.CopyFrom(obs)
+	if h.total() == 0 {
+		return nil
+	}
+	// percentileBoundary only walks the buckets.
+	h.allocateBuckets()
+	d := &LatencyDistribution{
+		Family: family,
+		Title:  title,
+		Count:  h.total(),
+		Sum:    time.Duration(h.sum) * time.Microsecond,
+		h:      h,
+	}
+	for i, n := range h.buckets {
+		if n == 0 {
+			continue
+		}
+		b := LatencyBucket{
+			Lower: time.Duration(bucketBoundary(uint8(i))) * time.Microsecond,
+			Upper: time.Duration(math.MaxInt64),
+			Count: n,
+		}
+		if i+1 < bucketCount {
+			b.Upper = time.Duration(bucketBoundary(uint8(i+1))) * time.Microsecond
+		}
+		d.Buckets = append(d.Buckets, b)
+	}
+	return d
+}
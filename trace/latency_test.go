@@ -0,0 +1,78 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package trace
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	const fam = "TestLatency"
+	defer func() {
+		completedMu.Lock()
+		delete(completedTraces, fam)
+		completedMu.Unlock()
+	}()
+	for i, d := range []time.Duration{
+		1 * time.Millisecond,
+		2 * time.Millisecond,
+		4 * time.Millisecond,
+		100 * time.Millisecond,
+	} {
+		title := "fast"
+		if i == 3 {
+			title = "slow"
+		}
+		tr := New(fam, title)
+		tr.(*trace).Start = time.Now().Add(-d)
+		tr.Finish()
+	}
+
+	d := Latency(fam, "", AllTime)
+	if d == nil {
+		t.Fatal("no latency distribution")
+	}
+	if d.Count != 4 {
+		t.Errorf("Count = %d; want 4", d.Count)
+	}
+	if d.Sum < 107*time.Millisecond || d.Sum > 200*time.Millisecond {
+		t.Errorf("Sum = %v; want about 107ms", d.Sum)
+	}
+	var n int64
+	for i, b := range d.Buckets {
+		if b.Lower >= b.Upper || i > 0 && b.Lower < d.Buckets[i-1].Upper {
+			t.Errorf("bucket %d: bad bounds %+v", i, b)
+		}
+		n += b.Count
+	}
+	if n != d.Count {
+		t.Errorf("buckets count %d traces; want %d", n, d.Count)
+	}
+	if p50, p99 := d.Percentile(0.5), d.Percentile(0.99); p50 > p99 || p99 < 50*time.Millisecond {
+		t.Errorf("Percentile(0.5) = %v, Percentile(0.99) = %v", p50, p99)
+	}
+
+	fast := Latency(fam, "fast", LastMinute)
+	if fast == nil || fast.Count != 3 || fast.Title != "fast" {
+		t.Fatalf("fast: got %+v", fast)
+	}
+	if p := fast.Percentile(0.99); p >= 10*time.Millisecond {
+		t.Errorf("fast: Percentile(0.99) = %v; want less than 10ms", p)
+	}
+	if Latency(fam, "unknown", AllTime) != nil || Latency("TestLatencyUnknown", "", AllTime) != nil {
+		t.Error("got a distribution for an unknown title or family")
+	}
+
+	var titles []string
+	for _, d := range Latencies(AllTime) {
+		if d.Family == fam {
+			titles = append(titles, d.Title)
+		}
+	}
+	if len(titles) != 3 || titles[0] != "" || titles[1] != "fast" || titles[2] != "slow" {
+		t.Errorf("Latencies: got titles %q", titles)
+	}
+}
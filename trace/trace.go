@@ -24,6 +24,9 @@ A request handler might be implemented like this:
 The /debug/requests HTTP endpoint organizes the traces by family,
 errors, and duration.  It also provides histogram of request duration
 for each family.
+The Latency and Latencies functions export these distributions, also
+tracked for each title of a family, such as the method of an RPC, for
+use by metrics systems.
 
 A trace.EventLog provides tracing for long-lived objects, such as RPC
 connections.
@@ -425,6 +428,14 @@ func (tr *trace) Finish() {
 	h.addMeasurement(elapsed.Nanoseconds() / 1e3)
 	f.LatencyMu.Lock()
 	f.Latency.Add(h)
+	ts := f.TitleLatency[tr.Title]
+	if ts == nil && tr.Title != "" && len(f.TitleLatency) < maxLatencyTitles {
+		ts = newLatencySeries()
+		f.TitleLatency[tr.Title] = ts
+	}
+	if ts != nil {
+		ts.Add(h)
+	}
 	f.LatencyMu.Unlock()
 
 	tr.unref() // matches ref in New
@@ -568,6 +579,10 @@ type family struct {
 	// latency time series
 	LatencyMu sync.RWMutex
 	Latency   *timeseries.MinuteHourSeries
+
+	// latency time series per title, for up to maxLatencyTitles titles;
+	// guarded by LatencyMu
+	TitleLatency map[string]*timeseries.MinuteHourSeries
 }
 
 func newFamily() *family {
@@ -583,10 +598,15 @@ func newFamily() *family {
 			{Cond: minCond(100 * time.Second)},
 			{Cond: errorCond{}},
 		},
-		Latency: timeseries.NewMinuteHourSeries(func() timeseries.Observable { return new(histogram) }),
+		Latency:      newLatencySeries(),
+		TitleLatency: make(map[string]*timeseries.MinuteHourSeries),
 	}
 }
 
+func newLatencySeries() *timeseries.MinuteHourSeries {
+	return timeseries.NewMinuteHourSeries(func() timeseries.Observable { return new(histogram) })
+}
+
 // traceBucket represents a size-capped bucket of historic traces,
 // along with a condition for a trace to belong to the bucket.
 type traceBucket struct {
@@ -0,0 +1,200 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	ixml "golang.org/x/net/webdav/internal/xml"
+)
+
+// BulkNamespace is the XML namespace of the body of the bulk requests
+// submitted to the BulkPath of a Handler.
+const BulkNamespace = "http://golang.org/x/net/webdav/bulk"
+
+// maxBulkOperations is the most operations of a bulk request.
+const maxBulkOperations = 1000
+
+type bulkOperation struct {
+	XMLName     ixml.Name
+	Href        string          `xml:"DAV: href"`
+	Update      *propertyupdate `xml:"DAV: propertyupdate"`
+	Destination string          `xml:"http://golang.org/x/net/webdav/bulk destination"`
+	Overwrite   string          `xml:"http://golang.org/x/net/webdav/bulk overwrite"`
+}
+
+type bulkBody struct {
+	XMLName    ixml.Name       `xml:"http://golang.org/x/net/webdav/bulk bulk"`
+	Operations []bulkOperation `xml:",any"`
+}
+
+// bulkResult is the outcome of an operation of a bulk request, once
+// executed.
+type bulkResult struct {
+	done   bool
+	status int
+	pstats []Propstat
+}
+
+// readBulk parses the body of the bulk request r into the Requests of its
+// operations.
+func (h *Handler) readBulk(r *http.Request) (ops []*Request, status int, err error) {
+	var b bulkBody
+	if err = ixml.NewDecoder(r.Body).Decode(&b); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(b.Operations) == 0 {
+		return nil, http.StatusBadRequest, errInvalidBulk
+	}
+	if len(b.Operations) > maxBulkOperations {
+		return nil, http.StatusRequestEntityTooLarge, errInvalidBulk
+	}
+	for _, bo := range b.Operations {
+		if bo.XMLName.Space != BulkNamespace {
+			return nil, http.StatusBadRequest, errInvalidBulk
+		}
+		u, err := url.Parse(bo.Href)
+		if bo.Href == "" || err != nil {
+			return nil, http.StatusBadRequest, errInvalidBulk
+		}
+		op := &Request{Request: r}
+		if op.Path, status, err = h.stripPrefix(h.localPath(r, u.Path)); err != nil {
+			return nil, status, err
+		}
+		switch bo.XMLName.Local {
+		case "proppatch":
+			if bo.Update == nil {
+				return nil, http.StatusBadRequest, errInvalidProppatch
+			}
+			op.Method = "PROPPATCH"
+			if op.Patches, status, err = bo.Update.patches(); err != nil {
+				return nil, status, err
+			}
+		case "delete":
+			op.Method = "DELETE"
+		case "move":
+			op.Method = "MOVE"
+			u, status, err := h.parseDestination(r, bo.Destination)
+			if err != nil {
+				return nil, status, err
+			}
+			if h.Shares != nil {
+				if x := h.Shares.lookup(h, u.Path); x != nil && x != h {
+					return nil, http.StatusBadGateway, errInvalidDestination
+				}
+			}
+			if op.Destination, status, err = h.stripPrefix(u.Path); err != nil {
+				return nil, status, err
+			}
+			op.Depth = infiniteDepth
+			op.Overwrite = bo.Overwrite == "T"
+		default:
+			return nil, http.StatusBadRequest, errInvalidBulk
+		}
+		ops = append(ops, op)
+	}
+	return ops, 0, nil
+}
+
+// handleBulk executes the operations of the bulk request req, each
+// through next, and writes their multistatus response. The error is
+// that of the first operation which failed, for the Logger.
+func (h *Handler) handleBulk(w http.ResponseWriter, req *Request, next MethodHandler) (status int, err error) {
+	mw := h.newMultistatusWriter(w, req.Request)
+	for _, op := range req.bulk {
+		op.bulkResult = &bulkResult{}
+		rw := &bulkResponseWriter{header: make(http.Header)}
+		st, opErr := next(rw, op)
+		if opErr != nil && err == nil {
+			err = opErr
+		}
+		href := h.HrefEscaping.escape(path.Join(h.clientPrefix(req.Request), op.Path))
+		res := op.bulkResult
+		var resp *response
+		if res.done && res.pstats != nil {
+			resp = makePropstatResponse(href, res.pstats)
+		} else {
+			if res.done {
+				st = res.status
+			} else if st == 0 {
+				// A Middleware replied itself.
+				if st = rw.status; st == 0 {
+					st = http.StatusOK
+				}
+			}
+			resp = &response{
+				Href:   []string{href},
+				Status: fmt.Sprintf("HTTP/1.1 %d %s", st, StatusText(st)),
+				code:   st,
+			}
+		}
+		if writeErr := mw.write(resp); writeErr != nil {
+			return http.StatusInternalServerError, writeErr
+		}
+	}
+	if closeErr := mw.close(); closeErr != nil {
+		return http.StatusInternalServerError, closeErr
+	}
+	return 0, err
+}
+
+// executeBulkOp executes req, an operation of a bulk request, recording
+// its outcome to be reported by the multistatus response.
+func (h *Handler) executeBulkOp(req *Request) (status int, err error) {
+	res := req.bulkResult
+	res.done = true
+	switch req.Method {
+	case "PROPPATCH":
+		res.pstats, res.status, err = h.proppatch(req)
+	case "DELETE":
+		res.status, err = h.handleDelete(nil, req)
+	case "MOVE":
+		res.status, err = h.moveBulk(req)
+	default:
+		res.status, err = http.StatusBadRequest, errUnsupportedMethod
+	}
+	return 0, err
+}
+
+// moveBulk executes req, a MOVE operation of a bulk request.
+func (h *Handler) moveBulk(req *Request) (status int, err error) {
+	src, dst := req.Path, req.Destination
+	if dst == src {
+		return http.StatusForbidden, errDestinationEqualsSource
+	}
+	release, status, err := h.confirmLocks(req.Request, src, dst)
+	if err != nil {
+		return status, err
+	}
+	defer release()
+	defer h.PropCache.Forget(src)
+	defer h.PropCache.Forget(dst)
+	return moveFiles(req.Request.Context(), h.FileSystem, src, dst, req.Overwrite)
+}
+
+// bulkResponseWriter records the status of the response of a Middleware
+// to an operation of a bulk request, discarding its body.
+type bulkResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *bulkResponseWriter) Header() http.Header { return w.header }
+
+func (w *bulkResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *bulkResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,467 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ixml "golang.org/x/net/webdav/internal/xml"
+)
+
+// InfiniteDepth is the depth of the PROPFIND and COPY requests of a
+// Client which apply to all the descendants of a collection.
+const InfiniteDepth = infiniteDepth
+
+var errInvalidMultistatus = errors.New("webdav: invalid multistatus response")
+
+// A Client is a client of a WebDAV server. Its methods take the names of
+// resources, slash-separated paths such as "/dir/file", relative to the
+// root URL of the Client; the names of collections may have a trailing
+// slash.
+//
+// The Client holds the tokens of the locks it created with Lock, until
+// Unlock, and submits them in the If header of the requests which modify
+// the resources they lock.
+type Client struct {
+	root *url.URL
+	hc   *http.Client
+
+	mu    sync.Mutex
+	locks map[string]string // lock tokens to the names of their roots
+}
+
+// NewClient returns a Client of the WebDAV server whose root collection
+// is at the URL root, such as "https://example.com/dav/", which sends its
+// requests with hc, or with http.DefaultClient if hc is nil.
+func NewClient(root string, hc *http.Client) (*Client, error) {
+	u, err := url.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return &Client{root: u, hc: hc, locks: make(map[string]string)}, nil
+}
+
+// A StatusError is the error of a request of a Client which failed with
+// an HTTP status.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webdav: %s %s: %d %s", e.Method, e.URL, e.StatusCode, StatusText(e.StatusCode))
+}
+
+// A MultistatusResponse is a response element of the multistatus response
+// of a PROPFIND or PROPPATCH request, for one resource.
+type MultistatusResponse struct {
+	// Href is the URL of the resource, as sent by the server.
+	Href string
+	// Name is the name of the resource: the path of Href, with the path
+	// of the root URL of the Client stripped.
+	Name string
+	// Propstats are the properties of the resource, by status.
+	Propstats []Propstat
+	// Status is the status of the resource, for a response without
+	// propstats.
+	Status int
+	// XMLError is the XML of the error element of the response, if any.
+	XMLError string
+	// ResponseDescription is the responsedescription of the response, if
+	// any.
+	ResponseDescription string
+}
+
+// url returns the URL of the resource name.
+func (c *Client) url(name string) string {
+	u := *c.root
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	u.Path += name
+	return u.String()
+}
+
+// ifHeader returns the If header of a request on the resources names,
+// with the tokens of the locks of c on them or on their ancestors.
+func (c *Client) ifHeader(names ...string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var b strings.Builder
+	for token, root := range c.locks {
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			name = slashClean(name)
+			if name == root || root == "/" || strings.HasPrefix(name, root+"/") {
+				b.WriteString("(<" + token + ">) ")
+				break
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// do sends the request of method on the resource name, with the XML body
+// if not nil, and returns its response if it has one of the statuses
+// want, or a *StatusError. The locks held on name and dst, if not empty,
+// are submitted.
+func (c *Client) do(ctx context.Context, method, name, dst string, body io.Reader, hdr http.Header, want ...int) (*http.Response, error) {
+	u := c.url(name)
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	if req.Header.Get("If") == "" {
+		if ih := c.ifHeader(name, dst); ih != "" {
+			req.Header.Set("If", ih)
+		}
+	}
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range want {
+		if res.StatusCode == code {
+			return res, nil
+		}
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	return nil, &StatusError{Method: method, URL: u, StatusCode: res.StatusCode}
+}
+
+// doNoBody is do for the requests whose response bodies are ignored.
+func (c *Client) doNoBody(ctx context.Context, method, name, dst string, body io.Reader, hdr http.Header, want ...int) error {
+	res, err := c.do(ctx, method, name, dst, body, hdr, want...)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return res.Body.Close()
+}
+
+// Get returns the contents of the file name, which the caller must close.
+func (c *Client) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := c.do(ctx, "GET", name, "", nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Put writes the file name, with the contents of body.
+func (c *Client) Put(ctx context.Context, name string, body io.Reader) error {
+	hdr := http.Header{"Content-Type": {"application/octet-stream"}}
+	return c.doNoBody(ctx, "PUT", name, "", body, hdr, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+}
+
+// Delete removes the resource name, and its members if it is a
+// collection.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	return c.doNoBody(ctx, "DELETE", name, "", nil, nil, http.StatusOK, http.StatusNoContent)
+}
+
+// Mkcol creates the collection name.
+func (c *Client) Mkcol(ctx context.Context, name string) error {
+	return c.doNoBody(ctx, "MKCOL", name, "", nil, nil, http.StatusCreated)
+}
+
+// Copy copies the resource src to dst, with the members of a collection
+// down to depth, 0 or InfiniteDepth, replacing the resource dst unless
+// overwrite is false.
+func (c *Client) Copy(ctx context.Context, src, dst string, depth int, overwrite bool) error {
+	hdr := copyMoveHeader(c.url(dst), overwrite)
+	hdr.Set("Depth", depthHeader(depth))
+	return c.doNoBody(ctx, "COPY", src, dst, nil, hdr, http.StatusCreated, http.StatusNoContent)
+}
+
+// Move moves the resource src to dst, replacing the resource dst unless
+// overwrite is false.
+func (c *Client) Move(ctx context.Context, src, dst string, overwrite bool) error {
+	return c.doNoBody(ctx, "MOVE", src, dst, nil, copyMoveHeader(c.url(dst), overwrite), http.StatusCreated, http.StatusNoContent)
+}
+
+func copyMoveHeader(dst string, overwrite bool) http.Header {
+	hdr := http.Header{"Destination": {dst}, "Overwrite": {"T"}}
+	if !overwrite {
+		hdr.Set("Overwrite", "F")
+	}
+	return hdr
+}
+
+func depthHeader(depth int) string {
+	if depth == InfiniteDepth {
+		return "infinity"
+	}
+	return strconv.Itoa(depth)
+}
+
+// PropFind returns the properties named props of the resource name, and
+// of its descendants down to depth, 0, 1 or InfiniteDepth, in the
+// responses of the multistatus response of the server. If props is nil,
+// it returns all the properties, as the allprop element requests.
+func (c *Client) PropFind(ctx context.Context, name string, depth int, props []xml.Name) ([]MultistatusResponse, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:">`)
+	if props == nil {
+		b.WriteString(`<D:allprop/>`)
+	} else {
+		b.WriteString(`<D:prop>`)
+		for _, pn := range props {
+			writeStartElement(&b, pn, "", true)
+		}
+		b.WriteString(`</D:prop>`)
+	}
+	b.WriteString(`</D:propfind>`)
+	hdr := http.Header{"Depth": {depthHeader(depth)}}
+	res, err := c.do(ctx, "PROPFIND", name, "", &b, hdr, StatusMulti)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return c.readMultistatus(res.Body)
+}
+
+// PropPatch applies the patches to the dead properties of the resource
+// name, and returns the propstats of the response of the server. Patching
+// is atomic: if it fails, none of the propstats has a 200 OK status.
+func (c *Client) PropPatch(ctx context.Context, name string, patches []Proppatch) ([]Propstat, error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:propertyupdate xmlns:D="DAV:">`)
+	for _, patch := range patches {
+		op := "set"
+		if patch.Remove {
+			op = "remove"
+		}
+		b.WriteString(`<D:` + op + `><D:prop>`)
+		for _, p := range patch.Props {
+			writeStartElement(&b, p.XMLName, p.Lang, patch.Remove)
+			if !patch.Remove {
+				b.Write(p.InnerXML)
+				writeEndElement(&b, p.XMLName)
+			}
+		}
+		b.WriteString(`</D:prop></D:` + op + `>`)
+	}
+	b.WriteString(`</D:propertyupdate>`)
+	res, err := c.do(ctx, "PROPPATCH", name, "", &b, nil, StatusMulti)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	rs, err := c.readMultistatus(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var pstats []Propstat
+	for _, r := range rs {
+		pstats = append(pstats, r.Propstats...)
+	}
+	return pstats, nil
+}
+
+// writeStartElement writes the start tag of the element n to b, with the
+// xml:lang attribute lang if not empty, as an empty element if empty is
+// set. The DAV: namespace has the prefix of the enclosing request, "D".
+func writeStartElement(b *bytes.Buffer, n xml.Name, lang string, empty bool) {
+	switch n.Space {
+	case "DAV:":
+		b.WriteString("<D:" + n.Local)
+	case "":
+		b.WriteString("<" + n.Local)
+	default:
+		b.WriteString("<x:" + n.Local + ` xmlns:x="` + escape(n.Space) + `"`)
+	}
+	if lang != "" {
+		b.WriteString(` xml:lang="` + escape(lang) + `"`)
+	}
+	if empty {
+		b.WriteString("/>")
+	} else {
+		b.WriteString(">")
+	}
+}
+
+func writeEndElement(b *bytes.Buffer, n xml.Name) {
+	switch n.Space {
+	case "DAV:":
+		b.WriteString("</D:" + n.Local + ">")
+	case "":
+		b.WriteString("</" + n.Local + ">")
+	default:
+		b.WriteString("</x:" + n.Local + ">")
+	}
+}
+
+// See http://www.webdav.org/specs/rfc4918.html#ELEMENT_multistatus
+type clientMultistatus struct {
+	Responses []clientResponse `xml:"DAV: response"`
+}
+
+type clientResponse struct {
+	Href                []string         `xml:"DAV: href"`
+	Propstat            []clientPropstat `xml:"DAV: propstat"`
+	Status              string           `xml:"DAV: status"`
+	Error               *clientXMLError  `xml:"DAV: error"`
+	ResponseDescription string           `xml:"DAV: responsedescription"`
+}
+
+type clientPropstat struct {
+	Prop                propValues      `xml:"DAV: prop"`
+	Status              string          `xml:"DAV: status"`
+	Error               *clientXMLError `xml:"DAV: error"`
+	ResponseDescription string          `xml:"DAV: responsedescription"`
+}
+
+type clientXMLError struct {
+	InnerXML []byte `xml:",innerxml"`
+}
+
+func (e *clientXMLError) String() string {
+	if e == nil {
+		return ""
+	}
+	return string(e.InnerXML)
+}
+
+// readMultistatus reads the responses of the multistatus response r.
+func (c *Client) readMultistatus(r io.Reader) ([]MultistatusResponse, error) {
+	var ms clientMultistatus
+	if err := ixml.NewDecoder(r).Decode(&ms); err != nil {
+		return nil, err
+	}
+	rs := make([]MultistatusResponse, 0, len(ms.Responses))
+	for _, xr := range ms.Responses {
+		if len(xr.Href) == 0 {
+			return nil, errInvalidMultistatus
+		}
+		r := MultistatusResponse{
+			Href:                xr.Href[0],
+			XMLError:            xr.Error.String(),
+			ResponseDescription: xr.ResponseDescription,
+		}
+		if u, err := url.Parse(r.Href); err == nil {
+			r.Name = "/" + strings.TrimPrefix(strings.TrimPrefix(u.Path, c.root.Path), "/")
+		}
+		if xr.Status != "" {
+			var err error
+			if r.Status, err = parseStatusLine(xr.Status); err != nil {
+				return nil, err
+			}
+		}
+		for _, xps := range xr.Propstat {
+			code, err := parseStatusLine(xps.Status)
+			if err != nil {
+				return nil, err
+			}
+			r.Propstats = append(r.Propstats, Propstat{
+				Props:               []Property(xps.Prop),
+				Status:              code,
+				XMLError:            xps.Error.String(),
+				ResponseDescription: xps.ResponseDescription,
+			})
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// parseStatusLine returns the status code of the status line s, such as
+// "HTTP/1.1 200 OK".
+func parseStatusLine(s string) (int, error) {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return 0, errInvalidMultistatus
+	}
+	code, err := strconv.Atoi(f[1])
+	if err != nil {
+		return 0, errInvalidMultistatus
+	}
+	return code, nil
+}
+
+// Lock creates an exclusive write lock of the resource name, which may
+// not exist, with the Duration, OwnerXML and ZeroDepth of ld, and returns
+// its token. The Root of ld is ignored. A Duration which is not positive
+// requests an infinite timeout.
+func (c *Client) Lock(ctx context.Context, name string, ld LockDetails) (token string, err error) {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:lockinfo xmlns:D="DAV:">` +
+		`<D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>`)
+	if ld.OwnerXML != "" {
+		b.WriteString(`<D:owner>` + ld.OwnerXML + `</D:owner>`)
+	}
+	b.WriteString(`</D:lockinfo>`)
+	hdr := http.Header{"Timeout": {timeoutHeader(ld.Duration)}, "Depth": {"infinity"}}
+	if ld.ZeroDepth {
+		hdr.Set("Depth", "0")
+	}
+	res, err := c.do(ctx, "LOCK", name, "", &b, hdr, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	token = strings.TrimSuffix(strings.TrimPrefix(res.Header.Get("Lock-Token"), "<"), ">")
+	if token == "" {
+		return "", errInvalidLockToken
+	}
+	c.mu.Lock()
+	c.locks[token] = slashClean(name)
+	c.mu.Unlock()
+	return token, nil
+}
+
+// RefreshLock refreshes the lock of token of the resource name, with
+// the timeout duration, infinite if not positive.
+func (c *Client) RefreshLock(ctx context.Context, name, token string, duration time.Duration) error {
+	hdr := http.Header{"Timeout": {timeoutHeader(duration)}, "If": {"(<" + token + ">)"}}
+	return c.doNoBody(ctx, "LOCK", name, "", nil, hdr, http.StatusOK)
+}
+
+// Unlock removes the lock of token of the resource name.
+func (c *Client) Unlock(ctx context.Context, name, token string) error {
+	hdr := http.Header{"Lock-Token": {"<" + token + ">"}}
+	if err := c.doNoBody(ctx, "UNLOCK", name, "", nil, hdr, http.StatusOK, http.StatusNoContent); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.locks, token)
+	c.mu.Unlock()
+	return nil
+}
+
+func timeoutHeader(d time.Duration) string {
+	if d <= 0 {
+		return "Infinite"
+	}
+	return "Second-" + strconv.FormatInt(int64(d/time.Second), 10)
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	h := &Handler{
+		Prefix:     "/dav",
+		FileSystem: NewMemFS(),
+		LockSystem: NewMemLS(),
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c, err := NewClient(srv.URL+"/dav/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.Mkcol(ctx, "/dir"); err != nil {
+		t.Fatalf("Mkcol: %v", err)
+	}
+	if err := c.Put(ctx, "/dir/a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err := c.Get(ctx, "/dir/a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("Get: got %q, %v, want %q", b, err, "hello")
+	}
+	if _, err := c.Get(ctx, "/dir/missing"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Get of a missing file: %v, want a 404 StatusError", err)
+	}
+
+	if err := c.Copy(ctx, "/dir/a", "/dir/b", InfiniteDepth, false); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if err := c.Copy(ctx, "/dir/a", "/dir/b", InfiniteDepth, false); !isStatus(err, http.StatusPreconditionFailed) {
+		t.Errorf("Copy without overwrite: %v, want a 412 StatusError", err)
+	}
+	if err := c.Move(ctx, "/dir/b", "/dir/c", true); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+
+	foo := xml.Name{Space: "http://example.com/ns", Local: "foo"}
+	pstats, err := c.PropPatch(ctx, "/dir/a", []Proppatch{{
+		Props: []Property{{XMLName: foo, InnerXML: []byte("bar")}},
+	}})
+	if err != nil {
+		t.Fatalf("PropPatch: %v", err)
+	}
+	if len(pstats) != 1 || pstats[0].Status != http.StatusOK || len(pstats[0].Props) != 1 || pstats[0].Props[0].XMLName != foo {
+		t.Errorf("PropPatch: got %+v", pstats)
+	}
+
+	rs, err := c.PropFind(ctx, "/dir/a", 0, []xml.Name{foo, {Space: "DAV:", Local: "getcontentlength"}})
+	if err != nil {
+		t.Fatalf("PropFind: %v", err)
+	}
+	if len(rs) != 1 || rs[0].Name != "/dir/a" || len(rs[0].Propstats) != 1 {
+		t.Fatalf("PropFind: got %+v", rs)
+	}
+	got := map[string]string{}
+	for _, p := range rs[0].Propstats[0].Props {
+		got[p.XMLName.Local] = string(p.InnerXML)
+	}
+	if got["foo"] != "bar" || got["getcontentlength"] != "5" {
+		t.Errorf("PropFind: got properties %v", got)
+	}
+
+	rs, err = c.PropFind(ctx, "/dir/", 1, nil)
+	if err != nil {
+		t.Fatalf("PropFind allprop: %v", err)
+	}
+	var names []string
+	for _, r := range rs {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	if want := "/dir/ /dir/a /dir/c"; strings.Join(names, " ") != want {
+		t.Errorf("PropFind allprop: got names %q, want %q", names, want)
+	}
+
+	if err := c.Delete(ctx, "/dir/c"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := c.Get(ctx, "/dir/c"); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("Get after Delete: %v, want a 404 StatusError", err)
+	}
+}
+
+func TestClientLock(t *testing.T) {
+	h := &Handler{
+		FileSystem: NewMemFS(),
+		LockSystem: NewMemLS(),
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.Mkcol(ctx, "/dir"); err != nil {
+		t.Fatalf("Mkcol: %v", err)
+	}
+	token, err := c.Lock(ctx, "/dir", LockDetails{Duration: time.Minute, OwnerXML: "<D:href>me</D:href>"})
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if token == "" {
+		t.Fatalf("Lock: empty token")
+	}
+
+	// The lock of /dir is submitted for its members, which other cannot
+	// write.
+	if err := c.Put(ctx, "/dir/a", strings.NewReader("a")); err != nil {
+		t.Fatalf("Put with the lock: %v", err)
+	}
+	if err := other.Put(ctx, "/dir/b", strings.NewReader("b")); !isStatus(err, StatusLocked) {
+		t.Errorf("Put without the lock: %v, want a 423 StatusError", err)
+	}
+	if err := c.Move(ctx, "/dir/a", "/dir/b", false); err != nil {
+		t.Fatalf("Move with the lock: %v", err)
+	}
+	if err := c.RefreshLock(ctx, "/dir", token, time.Hour); err != nil {
+		t.Fatalf("RefreshLock: %v", err)
+	}
+
+	if err := c.Unlock(ctx, "/dir", token); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := other.Put(ctx, "/dir/b", strings.NewReader("b")); err != nil {
+		t.Errorf("Put after Unlock: %v", err)
+	}
+	if err := c.RefreshLock(ctx, "/dir", token, time.Hour); err == nil {
+		t.Errorf("RefreshLock after Unlock succeeded")
+	}
+}
+
+func isStatus(err error, code int) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == code
+}
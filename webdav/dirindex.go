@@ -0,0 +1,55 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// A DirectoryIndexFunc writes the response to a GET or HEAD request on
+// the collection name, whose entries are sorted by name. The request
+// path ends with a slash, so that the entries may be linked to by
+// relative URLs.
+type DirectoryIndexFunc func(w http.ResponseWriter, r *http.Request, name string, entries []os.FileInfo)
+
+// HTMLDirectoryIndex lists the entries of a collection in an HTML page,
+// as http.FileServer does for directories.
+func HTMLDirectoryIndex(w http.ResponseWriter, r *http.Request, name string, entries []os.FileInfo) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, fi := range entries {
+		n := fi.Name()
+		if fi.IsDir() {
+			n += "/"
+		}
+		// The name may contain ':', which would be parsed as a scheme.
+		u := url.URL{Path: "./" + n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// JSONDirectoryIndex lists the entries of a collection as a JSON array
+// of objects with the members "name", "size", "modTime" and "isDir".
+func JSONDirectoryIndex(w http.ResponseWriter, r *http.Request, name string, entries []os.FileInfo) {
+	type entry struct {
+		Name    string    `json:"name"`
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"modTime"`
+		IsDir   bool      `json:"isDir"`
+	}
+	list := make([]entry, 0, len(entries))
+	for _, fi := range entries {
+		list = append(list, entry{fi.Name(), fi.Size(), fi.ModTime(), fi.IsDir()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -660,6 +660,12 @@ func copyProps(dst, src File) error {
 //
 // See section 9.8.5 for when various HTTP status codes apply.
 func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bool, depth int, recursion int) (status int, err error) {
+	return copyFilesBetween(ctx, fs, fs, src, dst, overwrite, depth, recursion)
+}
+
+// copyFilesBetween copies files and/or directories from src in srcFS to
+// dst in dstFS.
+func copyFilesBetween(ctx context.Context, srcFS, dstFS FileSystem, src, dst string, overwrite bool, depth int, recursion int) (status int, err error) {
 	if recursion == 1000 {
 		return http.StatusInternalServerError, errRecursionTooDeep
 	}
@@ -668,7 +674,7 @@ func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bo
 	// TODO: section 9.8.3 says that "Note that an infinite-depth COPY of /A/
 	// into /A/B/ could lead to infinite recursion if not handled correctly."
 
-	srcFile, err := fs.OpenFile(ctx, src, os.O_RDONLY, 0)
+	srcFile, err := srcFS.OpenFile(ctx, src, os.O_RDONLY, 0)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return http.StatusNotFound, err
@@ -686,7 +692,7 @@ func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bo
 	srcPerm := srcStat.Mode() & os.ModePerm
 
 	created := false
-	if _, err := fs.Stat(ctx, dst); err != nil {
+	if _, err := dstFS.Stat(ctx, dst); err != nil {
 		if os.IsNotExist(err) {
 			created = true
 		} else {
@@ -696,13 +702,13 @@ func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bo
 		if !overwrite {
 			return http.StatusPreconditionFailed, os.ErrExist
 		}
-		if err := fs.RemoveAll(ctx, dst); err != nil && !os.IsNotExist(err) {
+		if err := dstFS.RemoveAll(ctx, dst); err != nil && !os.IsNotExist(err) {
 			return http.StatusForbidden, err
 		}
 	}
 
 	if srcStat.IsDir() {
-		if err := fs.Mkdir(ctx, dst, srcPerm); err != nil {
+		if err := dstFS.Mkdir(ctx, dst, srcPerm); err != nil {
 			return http.StatusForbidden, err
 		}
 		if depth == infiniteDepth {
@@ -714,7 +720,7 @@ func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bo
 				name := c.Name()
 				s := path.Join(src, name)
 				d := path.Join(dst, name)
-				cStatus, cErr := copyFiles(ctx, fs, s, d, overwrite, depth, recursion)
+				cStatus, cErr := copyFilesBetween(ctx, srcFS, dstFS, s, d, overwrite, depth, recursion)
 				if cErr != nil {
 					// TODO: MultiStatus.
 					return cStatus, cErr
@@ -723,7 +729,7 @@ func copyFiles(ctx context.Context, fs FileSystem, src, dst string, overwrite bo
 		}
 
 	} else {
-		dstFile, err := fs.OpenFile(ctx, dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, srcPerm)
+		dstFile, err := dstFS.OpenFile(ctx, dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, srcPerm)
 		if err != nil {
 			if os.IsNotExist(err) {
 				return http.StatusConflict, err
@@ -772,32 +778,40 @@ func walkFS(ctx context.Context, fs FileSystem, depth int, name string, info os.
 		depth = 0
 	}
 
-	// Read directory names.
+	// Read directory names, walkReaddirCount at a time, so that the
+	// memory used for huge directories stays bounded.
 	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
 	if err != nil {
 		return walkFn(name, info, err)
 	}
-	fileInfos, err := f.Readdir(0)
-	f.Close()
-	if err != nil {
-		return walkFn(name, info, err)
-	}
-
-	for _, fileInfo := range fileInfos {
-		filename := path.Join(name, fileInfo.Name())
-		fileInfo, err := fs.Stat(ctx, filename)
-		if err != nil {
-			if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
-				return err
-			}
-		} else {
-			err = walkFS(ctx, fs, depth, filename, fileInfo, walkFn)
+	defer f.Close()
+	for {
+		fileInfos, readErr := f.Readdir(walkReaddirCount)
+		for _, fileInfo := range fileInfos {
+			filename := path.Join(name, fileInfo.Name())
+			fileInfo, err := fs.Stat(ctx, filename)
 			if err != nil {
-				if !fileInfo.IsDir() || err != filepath.SkipDir {
+				if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
 					return err
 				}
+			} else {
+				err = walkFS(ctx, fs, depth, filename, fileInfo, walkFn)
+				if err != nil {
+					if !fileInfo.IsDir() || err != filepath.SkipDir {
+						return err
+					}
+				}
 			}
 		}
+		if readErr == io.EOF || (readErr == nil && len(fileInfos) == 0) {
+			return nil
+		}
+		if readErr != nil {
+			return walkFn(name, info, readErr)
+		}
 	}
-	return nil
 }
+
+// walkReaddirCount is the number of directory entries walkFS reads at a
+// time.
+const walkReaddirCount = 1024
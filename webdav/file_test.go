@@ -1181,3 +1181,120 @@ func buildTestFS(buildfs []string) (FileSystem, error) {
 	}
 	return fs, nil
 }
+
+func TestPersistentPropsFS(t *testing.T) {
+	td, err := ioutil.TempDir("", "webdav-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	testFS(t, NewPersistentPropsFS(Dir(td), nil))
+}
+
+func TestPersistentPropsFSProps(t *testing.T) {
+	ctx := context.Background()
+	td, err := ioutil.TempDir("", "webdav-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	p0 := Property{XMLName: xml.Name{Space: "x:", Local: "color"}, InnerXML: []byte("<x:red/>")}
+	p1 := Property{XMLName: xml.Name{Space: "x:", Local: "tag"}, Lang: "en", InnerXML: []byte("urgent")}
+	patch := func(fs FileSystem, name string, remove bool, props ...Property) {
+		t.Helper()
+		f, err := fs.OpenFile(ctx, name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.(DeadPropsHolder).Patch([]Proppatch{{Remove: remove, Props: props}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	props := func(fs FileSystem, name string) map[xml.Name]Property {
+		t.Helper()
+		f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		m, err := f.(DeadPropsHolder).DeadProps()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	fs := NewPersistentPropsFS(Dir(td), nil)
+	if err := fs.Mkdir(ctx, "/dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile(ctx, "/dir/file", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	patch(fs, "/dir/file", false, p0, p1)
+	patch(fs, "/", false, p1)
+
+	// The properties persist across FileSystems, as across restarts.
+	fs = NewPersistentPropsFS(Dir(td), nil)
+	want := map[xml.Name]Property{p0.XMLName: p0, p1.XMLName: p1}
+	if got := props(fs, "/dir/file"); !reflect.DeepEqual(got, want) {
+		t.Errorf("props of /dir/file = %v, want %v", got, want)
+	}
+	if got := props(fs, "/"); !reflect.DeepEqual(got, map[xml.Name]Property{p1.XMLName: p1}) {
+		t.Errorf("props of / = %v, want %v", got, p1)
+	}
+
+	// The sidecar files are hidden.
+	d, err := fs.OpenFile(ctx, "/dir", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fis, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 || fis[0].Name() != "file" {
+		t.Errorf("Readdir of /dir: %d entries, want only file", len(fis))
+	}
+	for _, name := range []string{
+		"/dir/file.davprops",
+		"/dir/file.DAVPROPS",
+		"/dir/file.davprops.",
+		"/dir/file.davprops. .",
+		"/dir/file.DavProps::$DATA",
+	} {
+		if _, err := fs.Stat(ctx, name); !os.IsNotExist(err) {
+			t.Errorf("Stat of sidecar file %s: %v, want not exist", name, err)
+		}
+		if _, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0); !os.IsNotExist(err) {
+			t.Errorf("OpenFile of sidecar file %s: %v, want not exist", name, err)
+		}
+	}
+
+	// The properties follow their resources.
+	if _, err := copyFiles(ctx, fs, "/dir", "/copy", false, infiniteDepth, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moveFiles(ctx, fs, "/dir/file", "/moved", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/copy/file", "/moved"} {
+		if got := props(fs, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("props of %s = %v, want %v", name, got, want)
+		}
+	}
+	patch(fs, "/moved", true, p0, p1)
+	if err := fs.RemoveAll(ctx, "/copy"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"moved.davprops", "copy.davprops", "dir/file.davprops"} {
+		if _, err := os.Stat(filepath.Join(td, name)); !os.IsNotExist(err) {
+			t.Errorf("sidecar file %s left: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// An HrefEscaping selects how the Handler percent-encodes the paths of the
+// href elements of multistatus responses. Clients differ in the
+// characters they accept unescaped, or escaped.
+type HrefEscaping int
+
+const (
+	// HrefEscapeDefault escapes paths as url.URL.EscapedPath does: the
+	// characters other than the unreserved characters and some of the
+	// reserved characters of RFC 3986, such as '&', ',', ':' and '=',
+	// are escaped.
+	HrefEscapeDefault HrefEscaping = iota
+
+	// HrefEscapeStrict escapes all the bytes of paths but the unreserved
+	// characters of RFC 3986, Section 2.3, and the '/' separators.
+	HrefEscapeStrict
+
+	// HrefEscapeMinimal only escapes the bytes which cannot appear in
+	// the path of a URL: controls, space, '"', '#', '%', '<', '>', '?',
+	// '\\', '^', '`', '{', '|' and '}', and those of invalid UTF-8
+	// sequences. Other non-ASCII characters are written in UTF-8, as in
+	// the IRIs of RFC 3987.
+	HrefEscapeMinimal
+)
+
+// escape returns the href of the path p.
+func (e HrefEscaping) escape(p string) string {
+	var keep func(s string, i int) int
+	switch e {
+	case HrefEscapeStrict:
+		keep = keepStrict
+	case HrefEscapeMinimal:
+		keep = keepMinimal
+	default:
+		return (&url.URL{Path: p}).EscapedPath()
+	}
+	var b strings.Builder
+	for i := 0; i < len(p); {
+		if n := keep(p, i); n > 0 {
+			b.WriteString(p[i : i+n])
+			i += n
+			continue
+		}
+		const hex = "0123456789ABCDEF"
+		b.WriteByte('%')
+		b.WriteByte(hex[p[i]>>4])
+		b.WriteByte(hex[p[i]&0xf])
+		i++
+	}
+	return b.String()
+}
+
+// keepStrict returns the length of the character at s[i] if it is kept
+// unescaped by HrefEscapeStrict, or zero.
+func keepStrict(s string, i int) int {
+	switch c := s[i]; {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return 1
+	case c == '-', c == '.', c == '_', c == '~', c == '/':
+		return 1
+	}
+	return 0
+}
+
+// keepMinimal returns the length of the character at s[i] if it is kept
+// unescaped by HrefEscapeMinimal, or zero.
+func keepMinimal(s string, i int) int {
+	c := s[i]
+	if c >= utf8.RuneSelf {
+		if r, n := utf8.DecodeRuneInString(s[i:]); r != utf8.RuneError {
+			return n
+		}
+		return 0
+	}
+	if c <= ' ' || c == 0x7f || strings.IndexByte("\"#%<>?\\^`{|}", c) >= 0 {
+		return 0
+	}
+	return 1
+}
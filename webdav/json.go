@@ -0,0 +1,152 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonResponse is the JSON representation of a response of a multistatus
+// response. See Handler.JSONMultistatus.
+type jsonResponse struct {
+	Href      string         `json:"href"`
+	Status    int            `json:"status,omitempty"`
+	Propstats []jsonPropstat `json:"propstats,omitempty"`
+}
+
+type jsonPropstat struct {
+	Status              int            `json:"status"`
+	Props               []jsonProperty `json:"props"`
+	Error               string         `json:"error,omitempty"`
+	ResponseDescription string         `json:"responseDescription,omitempty"`
+}
+
+type jsonProperty struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang,omitempty"`
+	Value     string `json:"value,omitempty"`
+	XML       string `json:"xml,omitempty"`
+}
+
+// makeJSONResponse converts r, a response of a single href, to JSON.
+func makeJSONResponse(r *response) jsonResponse {
+	jr := jsonResponse{
+		Href:   r.Href[0],
+		Status: r.code,
+	}
+	for _, ps := range r.Propstat {
+		jps := jsonPropstat{
+			Status:              ps.code,
+			Props:               make([]jsonProperty, 0, len(ps.Prop)),
+			ResponseDescription: ps.ResponseDescription,
+		}
+		if ps.Error != nil {
+			jps.Error = string(ps.Error.InnerXML)
+		}
+		for _, p := range ps.Prop {
+			jp := jsonProperty{
+				Namespace: p.XMLName.Space,
+				Name:      p.XMLName.Local,
+				Lang:      p.Lang,
+			}
+			if text, ok := xmlText(p.InnerXML); ok {
+				jp.Value = text
+			} else {
+				jp.XML = string(p.InnerXML)
+			}
+			jps.Props = append(jps.Props, jp)
+		}
+		jr.Propstats = append(jr.Propstats, jps)
+	}
+	return jr
+}
+
+// xmlText returns the text of the XML content b, unescaped, and whether b
+// is only text, without elements.
+func xmlText(b []byte) (string, bool) {
+	var sb strings.Builder
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return sb.String(), true
+		}
+		if err != nil {
+			return "", false
+		}
+		switch t := t.(type) {
+		case xml.CharData:
+			sb.Write(t)
+		case xml.Comment, xml.ProcInst:
+		default:
+			return "", false
+		}
+	}
+}
+
+// prefersJSON reports whether the Accept headers of a request, accept,
+// prefer application/json to the XML media types.
+func prefersJSON(accept []string) bool {
+	var jsonQ, xmlQ float64
+	for _, v := range accept {
+		for _, r := range strings.Split(v, ",") {
+			params := strings.Split(r, ";")
+			q := 1.0
+			for _, p := range params[1:] {
+				p = strings.TrimSpace(p)
+				if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+					if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+						q = f
+					}
+				}
+			}
+			switch strings.ToLower(strings.TrimSpace(params[0])) {
+			case "application/json":
+				if q > jsonQ {
+					jsonQ = q
+				}
+			case "application/xml", "text/xml":
+				if q > xmlQ {
+					xmlQ = q
+				}
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ > xmlQ
+}
+
+// writeJSON emits r as part of a JSON multistatus response.
+func (w *multistatusWriter) writeJSON(r *response) error {
+	b, err := json.Marshal(makeJSONResponse(r))
+	if err != nil {
+		return err
+	}
+	if w.jsonResponses > 0 {
+		b = append([]byte{','}, b...)
+	}
+	w.jsonResponses++
+	_, err = w.w.Write(b)
+	return err
+}
+
+// closeJSON completes a JSON multistatus response.
+func (w *multistatusWriter) closeJSON() error {
+	end := "]"
+	if w.responseDescription != "" {
+		b, err := json.Marshal(w.responseDescription)
+		if err != nil {
+			return err
+		}
+		end += `,"responseDescription":` + string(b)
+	}
+	_, err := io.WriteString(w.w, end+"}\n")
+	return err
+}
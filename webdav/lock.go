@@ -6,7 +6,12 @@ package webdav
 
 import (
 	"container/heap"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -65,7 +70,10 @@ type LockSystem interface {
 	//
 	// The token returned identifies the created lock. It should be an absolute
 	// URI as defined by RFC 3986, Section 4.3. In particular, it should not
-	// contain whitespace.
+	// contain whitespace. Its scheme is up to the LockSystem, such as the
+	// opaquelocktoken scheme of Appendix C of RFC 4918, or that of a lock
+	// service shared by several servers: the Handler treats tokens as opaque
+	// strings.
 	Create(now time.Time, details LockDetails) (token string, err error)
 
 	// Refresh refreshes the lock with the given token.
@@ -93,6 +101,18 @@ type LockSystem interface {
 	Unlock(now time.Time, token string) error
 }
 
+// A TokenValidator is a LockSystem which checks the lock tokens given
+// by clients. The Handler fails the UNLOCK and LOCK refresh requests
+// whose token is not valid with a "400 Bad Request" HTTP status, and
+// considers that the If header conditions on such tokens do not match,
+// without calling the other methods of the LockSystem.
+type TokenValidator interface {
+	// ValidToken reports whether token is in the format of the tokens of
+	// the LockSystem, such as issued by another server sharing a lock
+	// service. It does not report whether the lock exists.
+	ValidToken(token string) bool
+}
+
 // LockDetails are a lock's metadata.
 type LockDetails struct {
 	// Root is the root resource name being locked. For a zero-depth lock, the
@@ -114,10 +134,100 @@ type LockDetails struct {
 // NewMemLS returns a new in-memory LockSystem.
 func NewMemLS() LockSystem {
 	return &memLS{
-		byName:  make(map[string]*memLSNode),
-		byToken: make(map[string]*memLSNode),
-		gen:     uint64(time.Now().Unix()),
+		byName:      make(map[string]*memLSNode),
+		byToken:     make(map[string]*memLSNode),
+		gen:         uint64(time.Now().Unix()),
+		tokenPrefix: opaqueLockTokenPrefix(),
+	}
+}
+
+// MemLSOptions configures a LockSystem returned by NewMemLSWithOptions.
+type MemLSOptions struct {
+	// ScavengeInterval is how often expired locks are removed in the
+	// background. If it is not positive, locks only expire when the
+	// LockSystem is next used, as with NewMemLS.
+	ScavengeInterval time.Duration
+
+	// OnExpire, if non-nil, is called with the token and details of
+	// each lock removed because it expired, whether by the background
+	// scavenger or by a LockSystem method. It is called while the
+	// LockSystem is locked, so it must not call its methods.
+	OnExpire func(token string, details LockDetails)
+
+	// NewToken, if non-nil, returns the token of each lock created,
+	// which must be a unique absolute URI, such as of a custom scheme.
+	// By default, the tokens are opaquelocktoken URIs.
+	NewToken func() string
+}
+
+// MemLSStats reports the state of a MemLS.
+type MemLSStats struct {
+	// Active is the number of locks that have not been unlocked and
+	// have not expired.
+	Active int
+	// Expired is the number of locks removed because they expired.
+	Expired uint64
+}
+
+// MemLS is an in-memory LockSystem which removes expired locks in the
+// background. It is created by NewMemLSWithOptions.
+type MemLS struct {
+	memLS
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemLSWithOptions returns a new in-memory LockSystem configured by
+// opts. If opts.ScavengeInterval is positive, Close must be called to
+// stop the background scavenger once the LockSystem is no longer used.
+func NewMemLSWithOptions(opts MemLSOptions) *MemLS {
+	m := &MemLS{
+		memLS: memLS{
+			byName:      make(map[string]*memLSNode),
+			byToken:     make(map[string]*memLSNode),
+			gen:         uint64(time.Now().Unix()),
+			tokenPrefix: opaqueLockTokenPrefix(),
+			newToken:    opts.NewToken,
+			onExpire:    opts.OnExpire,
+		},
+		stop: make(chan struct{}),
+	}
+	if opts.ScavengeInterval > 0 {
+		go m.scavenge(opts.ScavengeInterval)
 	}
+	return m
+}
+
+func (m *MemLS) scavenge(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			m.mu.Lock()
+			m.collectExpiredNodes(now)
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Stats returns the number of active and expired locks of m.
+func (m *MemLS) Stats() MemLSStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MemLSStats{
+		Active:  len(m.byToken),
+		Expired: m.expired,
+	}
+}
+
+// Close stops the background scavenger of m. The locks of m remain
+// usable, but then only expire lazily.
+func (m *MemLS) Close() error {
+	m.stopOnce.Do(func() { close(m.stop) })
+	return nil
 }
 
 type memLS struct {
@@ -128,11 +238,47 @@ type memLS struct {
 	// byExpiry only contains those nodes whose LockDetails have a finite
 	// Duration and are yet to expire.
 	byExpiry byExpiry
+	// expired is the number of locks removed by collectExpiredNodes.
+	expired  uint64
+	onExpire func(token string, details LockDetails) // may be nil
+
+	tokenPrefix string        // of the opaquelocktoken URIs
+	newToken    func() string // may be nil
+}
+
+const opaqueLockTokenScheme = "opaquelocktoken:"
+
+var randReader = rand.Reader // for tests
+
+// opaqueLockTokenPrefix returns the random prefix of the opaquelocktoken
+// URIs of a memLS, whose UUIDs end with a counter.
+func opaqueLockTokenPrefix() string {
+	var b [10]byte
+	if _, err := io.ReadFull(randReader, b[:]); err != nil {
+		// The time and the process keep the tokens of successive
+		// memLSs, and those of a restarted server, distinct.
+		binary.BigEndian.PutUint64(b[0:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint16(b[8:10], uint16(os.Getpid()))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%s%x-%x-%x-%x-", opaqueLockTokenScheme, b[0:4], b[4:6], b[6:8], b[8:10])
 }
 
 func (m *memLS) nextToken() string {
+	if m.newToken != nil {
+		return m.newToken()
+	}
 	m.gen++
-	return strconv.FormatUint(m.gen, 10)
+	return fmt.Sprintf("%s%012x", m.tokenPrefix, m.gen&(1<<48-1))
+}
+
+// ValidToken implements TokenValidator.
+func (m *memLS) ValidToken(token string) bool {
+	if m.newToken != nil {
+		return token != ""
+	}
+	return strings.HasPrefix(token, opaqueLockTokenScheme)
 }
 
 func (m *memLS) collectExpiredNodes(now time.Time) {
@@ -140,7 +286,13 @@ func (m *memLS) collectExpiredNodes(now time.Time) {
 		if now.Before(m.byExpiry[0].expiry) {
 			break
 		}
-		m.remove(m.byExpiry[0])
+		n := m.byExpiry[0]
+		token := n.token
+		m.remove(n)
+		m.expired++
+		if m.onExpire != nil {
+			m.onExpire(token, n.details)
+		}
 	}
 }
 
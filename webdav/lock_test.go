@@ -5,14 +5,18 @@
 package webdav
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"path"
 	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -449,6 +453,130 @@ func TestMemLSExpiry(t *testing.T) {
 	}
 }
 
+func TestMemLSOnExpire(t *testing.T) {
+	var expired []string
+	m := NewMemLSWithOptions(MemLSOptions{
+		OnExpire: func(token string, details LockDetails) {
+			expired = append(expired, details.Root)
+			if token == "" {
+				t.Errorf("OnExpire %s: empty token", details.Root)
+			}
+		},
+	})
+	defer m.Close()
+	now := time.Unix(0, 0)
+	for _, c := range []struct {
+		root     string
+		duration time.Duration
+	}{
+		{"/a", 5 * time.Second},
+		{"/b", 10 * time.Second},
+		{"/c", infiniteTimeout},
+	} {
+		if _, err := m.Create(now, LockDetails{Root: c.root, Duration: c.duration, ZeroDepth: true}); err != nil {
+			t.Fatalf("Create %s: %v", c.root, err)
+		}
+	}
+	if got, want := m.Stats(), (MemLSStats{Active: 3}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	if _, err := m.Create(now.Add(7*time.Second), LockDetails{Root: "/d", Duration: infiniteTimeout}); err != nil {
+		t.Fatalf("Create /d: %v", err)
+	}
+	if got, want := strings.Join(expired, " "), "/a"; got != want {
+		t.Errorf("expired = %q, want %q", got, want)
+	}
+	if got, want := m.Stats(), (MemLSStats{Active: 3, Expired: 1}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestMemLSTokens(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemLS()
+	v := m.(TokenValidator)
+	seen := map[string]bool{}
+	for _, name := range []string{"/a", "/b", "/c"} {
+		token, err := m.Create(now, LockDetails{Root: name, Duration: infiniteTimeout})
+		if err != nil {
+			t.Fatalf("creating lock for %q: %v", name, err)
+		}
+		if !opaqueLockTokenRE.MatchString(token) {
+			t.Errorf("token %q is not an opaquelocktoken URI", token)
+		}
+		if seen[token] {
+			t.Errorf("token %q issued twice", token)
+		}
+		seen[token] = true
+		if !v.ValidToken(token) {
+			t.Errorf("ValidToken(%q) = false", token)
+		}
+	}
+	if v.ValidToken("urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6") {
+		t.Error("ValidToken accepted a token of another scheme")
+	}
+
+	n := 0
+	c := NewMemLSWithOptions(MemLSOptions{
+		NewToken: func() string {
+			n++
+			return "urn:example:lock:" + strconv.Itoa(n)
+		},
+	})
+	defer c.Close()
+	token, err := c.Create(now, LockDetails{Root: "/a", Duration: infiniteTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "urn:example:lock:1" || !c.ValidToken(token) {
+		t.Errorf("custom token: got %q", token)
+	}
+	if err := c.Unlock(now, token); err != nil {
+		t.Errorf("Unlock(%q): %v", token, err)
+	}
+}
+
+var opaqueLockTokenRE = regexp.MustCompile(`^opaquelocktoken:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestOpaqueLockTokenPrefixWithoutRandomness(t *testing.T) {
+	defer func(r io.Reader) { randReader = r }(randReader)
+	randReader = iotest.ErrReader(errors.New("no randomness"))
+	p := opaqueLockTokenPrefix()
+	if !opaqueLockTokenRE.MatchString(p + "000000000001") {
+		t.Errorf("prefix %q is not that of an opaquelocktoken URI", p)
+	}
+	if p == "opaquelocktoken:00000000-0000-4000-8000-" {
+		t.Errorf("prefix %q is not unique", p)
+	}
+}
+
+func TestMemLSScavenge(t *testing.T) {
+	expired := make(chan string, 1)
+	m := NewMemLSWithOptions(MemLSOptions{
+		ScavengeInterval: time.Millisecond,
+		OnExpire: func(token string, details LockDetails) {
+			expired <- details.Root
+		},
+	})
+	defer m.Close()
+	if _, err := m.Create(time.Now(), LockDetails{Root: "/a", Duration: time.Millisecond}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	select {
+	case root := <-expired:
+		if root != "/a" {
+			t.Errorf("expired %q, want %q", root, "/a")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock was not scavenged")
+	}
+	if got, want := m.Stats(), (MemLSStats{Expired: 1}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	m.Close()
+	m.Close()
+}
+
 func TestMemLS(t *testing.T) {
 	now := time.Unix(0, 0)
 	m := NewMemLS().(*memLS)
@@ -0,0 +1,133 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The extensions of the X-MSDAVEXT header, MS-WDV, which the Handler
+// implements with OfficeCompatible: a GET request may get the properties
+// of a file together with its contents, and a PUT request may set them
+// together with the contents. The bodies of those requests and responses
+// consist of two parts, each preceded by its size in 16 hexadecimal
+// digits: a PROPFIND or PROPPATCH multistatus response or propertyupdate
+// request, and the contents of the file.
+//
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-wdv/
+
+// The values of the X-MSDAVEXT header: that of the responses to OPTIONS
+// requests, by which the server advertises the extensions, and those of
+// the extended GET and PUT requests.
+const (
+	msdavextSupported = "1"
+	msdavextPropfind  = "PROPFIND"
+	msdavextProppatch = "PROPPATCH"
+)
+
+// msdavextSizeLen is the length of the size of each part of an extended
+// body, and maxMSDAVExtPropsSize the limit of the size of the property
+// updates of an extended PUT request.
+const (
+	msdavextSizeLen      = 16
+	maxMSDAVExtPropsSize = 1 << 20
+)
+
+var errInvalidMSDAVExt = errors.New("webdav: invalid X-MSDAVEXT body")
+
+// msdavext reports whether r is a request of the extension value.
+func (h *Handler) msdavext(r *http.Request, value string) bool {
+	return h.OfficeCompatible && strings.EqualFold(strings.TrimSpace(r.Header.Get("X-MSDAVEXT")), value)
+}
+
+// serveExtendedGet writes the properties of the file reqPath, opened as
+// f, followed by its contents, to w.
+func (h *Handler) serveExtendedGet(w http.ResponseWriter, r *http.Request, reqPath string, f File, fi os.FileInfo) (status int, err error) {
+	pstats, err := allprop(r.Context(), h.FileSystem, h.LockSystem, reqPath, nil)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var ms bufferedResponse
+	mw := multistatusWriter{w: &ms}
+	if err := mw.write(makePropstatResponse(h.HrefEscaping.escape(h.clientPrefix(r)+reqPath), pstats)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := mw.close(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(2*msdavextSizeLen+int64(ms.body.Len())+fi.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "HEAD" {
+		return 0, nil
+	}
+	fmt.Fprintf(w, "%016x", ms.body.Len())
+	w.Write(ms.body.Bytes())
+	fmt.Fprintf(w, "%016x", fi.Size())
+	io.Copy(w, f)
+	return 0, nil
+}
+
+// readExtendedPut reads the property updates of the body of an extended
+// PUT request, returning them with the reader and size of the contents of
+// the file, which follow them.
+func readExtendedPut(body io.Reader) (patches []Proppatch, contents io.Reader, size int64, status int, err error) {
+	n, err := readMSDAVExtSize(body)
+	if err != nil || n > maxMSDAVExtPropsSize {
+		return nil, nil, 0, http.StatusBadRequest, errInvalidMSDAVExt
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(body, n))
+	if err != nil {
+		return nil, nil, 0, http.StatusBadRequest, err
+	}
+	if int64(len(b)) != n {
+		return nil, nil, 0, http.StatusBadRequest, errInvalidMSDAVExt
+	}
+	if patches, status, err = readProppatch(bytes.NewReader(b)); err != nil {
+		return nil, nil, 0, status, err
+	}
+	if size, err = readMSDAVExtSize(body); err != nil {
+		return nil, nil, 0, http.StatusBadRequest, errInvalidMSDAVExt
+	}
+	return patches, io.LimitReader(body, size), size, 0, nil
+}
+
+// readMSDAVExtSize reads the size of the next part of an extended body.
+func readMSDAVExtSize(r io.Reader) (int64, error) {
+	var b [msdavextSizeLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(string(b[:]), 16, 63)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// A bufferedResponse is an http.ResponseWriter buffering the body
+// written, for a part of an extended response.
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *bufferedResponse) Write(p []byte) (int, error) { return w.body.Write(p) }
+func (w *bufferedResponse) WriteHeader(int)             {}
@@ -7,6 +7,7 @@ package webdav
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // Proppatch describes a property update instruction as defined in RFC 4918.
@@ -99,6 +101,8 @@ type DeadPropsHolder interface {
 	Patch([]Proppatch) ([]Propstat, error)
 }
 
+var contentTypeName = xml.Name{Space: "DAV:", Local: "getcontenttype"}
+
 // liveProps contains all supported, protected DAV: properties.
 var liveProps = map[xml.Name]struct {
 	// findFn implements the propfind function of this property. If nil,
@@ -138,7 +142,7 @@ var liveProps = map[xml.Name]struct {
 		findFn: nil,
 		dir:    false,
 	},
-	{Space: "DAV:", Local: "getcontenttype"}: {
+	contentTypeName: {
 		findFn: findContentType,
 		dir:    false,
 	},
@@ -154,6 +158,11 @@ var liveProps = map[xml.Name]struct {
 	// TODO: The lockdiscovery property requires LockSystem to list the
 	// active locks on a resource.
 	{Space: "DAV:", Local: "lockdiscovery"}: {},
+
+	// The quota properties are found by findQuota, for the FileSystems
+	// implementing QuotaFileSystem.
+	quotaAvailableName: {},
+	quotaUsedName:      {},
 	{Space: "DAV:", Local: "supportedlock"}: {
 		findFn: findSupportedLock,
 		dir:    true,
@@ -167,27 +176,52 @@ var liveProps = map[xml.Name]struct {
 // Each Propstat has a unique status and each property name will only be part
 // of one Propstat element.
 func props(ctx context.Context, fs FileSystem, ls LockSystem, name string, pnames []xml.Name) ([]Propstat, error) {
-	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+	r, err := openResource(ctx, fs, name)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	fi, err := f.Stat()
+	defer r.f.Close()
+	return r.props(ctx, fs, ls, name, pnames)
+}
+
+// A resource is a file opened to find its properties.
+type resource struct {
+	f         File
+	fi        os.FileInfo
+	deadProps map[xml.Name]Property
+}
+
+// openResource opens the resource name and gets its dead properties.
+func openResource(ctx context.Context, fs FileSystem, name string) (*resource, error) {
+	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
-	isDir := fi.IsDir()
-
-	var deadProps map[xml.Name]Property
+	r := &resource{f: f}
+	if r.fi, err = f.Stat(); err != nil {
+		f.Close()
+		return nil, err
+	}
 	if dph, ok := f.(DeadPropsHolder); ok {
-		deadProps, err = dph.DeadProps()
-		if err != nil {
+		if r.deadProps, err = dph.DeadProps(); err != nil {
+			f.Close()
 			return nil, err
 		}
 	}
+	return r, nil
+}
+
+// props returns the status of the properties named pnames of r, the
+// resource name.
+func (r *resource) props(ctx context.Context, fs FileSystem, ls LockSystem, name string, pnames []xml.Name) ([]Propstat, error) {
+	fi, deadProps := r.fi, r.deadProps
+	isDir := fi.IsDir()
+	// The content type is sniffed from the file already open.
+	ctx = context.WithValue(ctx, openFileKey{}, r.f)
 
 	pstatOK := Propstat{Status: http.StatusOK}
 	pstatNotFound := Propstat{Status: http.StatusNotFound}
+	previews := previewFinder{fi: fi}
 	for _, pn := range pnames {
 		// If this file has dead properties, check if they contain pn.
 		if dp, ok := deadProps[pn]; ok {
@@ -204,6 +238,20 @@ func props(ctx context.Context, fs FileSystem, ls LockSystem, name string, pname
 				XMLName:  pn,
 				InnerXML: []byte(innerXML),
 			})
+		} else if innerXML, ok, err := findQuota(ctx, fs, name, fi, pn); err != nil {
+			return nil, err
+		} else if ok {
+			pstatOK.Props = append(pstatOK.Props, Property{
+				XMLName:  pn,
+				InnerXML: []byte(innerXML),
+			})
+		} else if innerXML, ok, err := previews.find(ctx, pn); err != nil {
+			return nil, err
+		} else if ok {
+			pstatOK.Props = append(pstatOK.Props, Property{
+				XMLName:  pn,
+				InnerXML: []byte(innerXML),
+			})
 		} else {
 			pstatNotFound.Props = append(pstatNotFound.Props, Property{
 				XMLName: pn,
@@ -215,35 +263,27 @@ func props(ctx context.Context, fs FileSystem, ls LockSystem, name string, pname
 
 // propnames returns the property names defined for resource name.
 func propnames(ctx context.Context, fs FileSystem, ls LockSystem, name string) ([]xml.Name, error) {
-	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+	r, err := openResource(ctx, fs, name)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	fi, err := f.Stat()
-	if err != nil {
-		return nil, err
-	}
-	isDir := fi.IsDir()
-
-	var deadProps map[xml.Name]Property
-	if dph, ok := f.(DeadPropsHolder); ok {
-		deadProps, err = dph.DeadProps()
-		if err != nil {
-			return nil, err
-		}
-	}
+	r.f.Close()
+	return r.propnames(), nil
+}
 
-	pnames := make([]xml.Name, 0, len(liveProps)+len(deadProps))
+// propnames returns the property names defined for r.
+func (r *resource) propnames() []xml.Name {
+	isDir := r.fi.IsDir()
+	pnames := make([]xml.Name, 0, len(liveProps)+len(r.deadProps))
 	for pn, prop := range liveProps {
 		if prop.findFn != nil && (prop.dir || !isDir) {
 			pnames = append(pnames, pn)
 		}
 	}
-	for pn := range deadProps {
+	for pn := range r.deadProps {
 		pnames = append(pnames, pn)
 	}
-	return pnames, nil
+	return pnames
 }
 
 // allprop returns the properties defined for resource name and the properties
@@ -255,10 +295,16 @@ func propnames(ctx context.Context, fs FileSystem, ls LockSystem, name string) (
 //
 // See http://www.webdav.org/specs/rfc4918.html#METHOD_PROPFIND
 func allprop(ctx context.Context, fs FileSystem, ls LockSystem, name string, include []xml.Name) ([]Propstat, error) {
-	pnames, err := propnames(ctx, fs, ls, name)
+	r, err := openResource(ctx, fs, name)
 	if err != nil {
 		return nil, err
 	}
+	defer r.f.Close()
+	pnames := r.propnames()
+	p, _ := ctx.Value(contentTypePolicyKey{}).(*contentTypePolicy)
+	if p != nil && p.allpropNoSniff && needsSniffing(ctx, name, r.fi) {
+		pnames = removeName(pnames, contentTypeName)
+	}
 	// Add names from include if they are not already covered in pnames.
 	nameset := make(map[xml.Name]bool)
 	for _, pn := range pnames {
@@ -269,7 +315,17 @@ func allprop(ctx context.Context, fs FileSystem, ls LockSystem, name string, inc
 			pnames = append(pnames, pn)
 		}
 	}
-	return props(ctx, fs, ls, name, pnames)
+	return r.props(ctx, fs, ls, name, pnames)
+}
+
+// removeName returns pnames without pn.
+func removeName(pnames []xml.Name, pn xml.Name) []xml.Name {
+	for i, n := range pnames {
+		if n == pn {
+			return append(pnames[:i], pnames[i+1:]...)
+		}
+	}
+	return pnames
 }
 
 // patch patches the properties of resource name. The return values are
@@ -389,8 +445,9 @@ var ErrNotImplemented = errors.New("not implemented")
 // If this interface is defined then it will be used to read the
 // content type from the object.
 //
-// If this interface is not defined the file will be opened and the
-// content type will be guessed from the initial contents of the file.
+// If this interface is not defined the content type will be found from
+// the extension of the file name, or else guessed from the initial
+// contents of the file, unless Handler.DisableContentSniffing is set.
 type ContentTyper interface {
 	// ContentType returns the content type for the file.
 	//
@@ -400,6 +457,36 @@ type ContentTyper interface {
 	ContentType(ctx context.Context) (string, error)
 }
 
+// contentTypePolicy holds the content type settings of a Handler. It is
+// passed to findContentType in the context of the request.
+type contentTypePolicy struct {
+	types          map[string]string // Handler.ContentTypes
+	noSniff        bool              // Handler.DisableContentSniffing
+	allpropNoSniff bool              // Handler.AllpropOmitsSniffedTypes
+	cache          *PropCache        // Handler.PropCache
+}
+
+type contentTypePolicyKey struct{}
+
+// openFileKey is the context key of the File of the resource whose
+// properties or ETag are found, if it is open.
+type openFileKey struct{}
+
+// typeByExtension returns the content type for the extension of name,
+// or "" if it is unknown.
+func (p *contentTypePolicy) typeByExtension(name string) string {
+	ext := filepath.Ext(name)
+	if p != nil && ext != "" {
+		if ctype, ok := p.types[ext]; ok {
+			return ctype
+		}
+		if ctype, ok := p.types[strings.ToLower(ext)]; ok {
+			return ctype
+		}
+	}
+	return mime.TypeByExtension(ext)
+}
+
 func findContentType(ctx context.Context, fs FileSystem, ls LockSystem, name string, fi os.FileInfo) (string, error) {
 	if do, ok := fi.(ContentTyper); ok {
 		ctype, err := do.ContentType(ctx)
@@ -407,36 +494,81 @@ func findContentType(ctx context.Context, fs FileSystem, ls LockSystem, name str
 			return ctype, err
 		}
 	}
-	f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
 	// This implementation is based on serveContent's code in the standard net/http package.
-	ctype := mime.TypeByExtension(filepath.Ext(name))
-	if ctype != "" {
+	p, _ := ctx.Value(contentTypePolicyKey{}).(*contentTypePolicy)
+	if ctype := p.typeByExtension(name); ctype != "" {
 		return ctype, nil
 	}
+	if p != nil && p.noSniff {
+		return "application/octet-stream", nil
+	}
+	if p != nil {
+		if ctype, ok := p.cache.get(contentTypeName, name, fi); ok {
+			return ctype, nil
+		}
+	}
+	f, ok := ctx.Value(openFileKey{}).(File)
+	if !ok {
+		var err error
+		if f, err = fs.OpenFile(ctx, name, os.O_RDONLY, 0); err != nil {
+			return "", err
+		}
+		defer f.Close()
+	}
 	// Read a chunk to decide between utf-8 text and binary.
 	var buf [512]byte
 	n, err := io.ReadFull(f, buf[:])
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", err
 	}
-	ctype = http.DetectContentType(buf[:n])
+	ctype := http.DetectContentType(buf[:n])
 	// Rewind file.
-	_, err = f.Seek(0, io.SeekStart)
-	return ctype, err
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if p != nil {
+		p.cache.put(contentTypeName, name, fi, ctype)
+	}
+	return ctype, nil
+}
+
+// needsSniffing reports whether the content type of the file fi, the
+// resource name, is only known by reading it.
+func needsSniffing(ctx context.Context, name string, fi os.FileInfo) bool {
+	if fi.IsDir() {
+		return false
+	}
+	if do, ok := fi.(ContentTyper); ok {
+		if _, err := do.ContentType(ctx); err != ErrNotImplemented {
+			return false
+		}
+	}
+	p, _ := ctx.Value(contentTypePolicyKey{}).(*contentTypePolicy)
+	if p.typeByExtension(name) != "" || p != nil && p.noSniff {
+		return false
+	}
+	if p != nil {
+		if _, ok := p.cache.get(contentTypeName, name, fi); ok {
+			return false
+		}
+	}
+	return true
 }
 
 // ETager is an optional interface for the os.FileInfo objects
-// returned by the FileSystem.
+// returned by the FileSystem, or for the File objects it opens.
 //
 // If this interface is defined then it will be used to read the ETag
-// for the object.
+// for the object, such as a strong ETag derived from a hash of the
+// contents of the file. That of the os.FileInfo is used first.
 //
-// If this interface is not defined an ETag will be computed using the
+// If this interface is not defined, and the FileSystem does not
+// implement FileSystemETager, an ETag will be computed using the
 // ModTime() and the Size() methods of the os.FileInfo object.
+//
+// The ETag is that of the ETag header of the GET, HEAD and PUT responses,
+// of the getetag property, and the one the If-Match and If-None-Match
+// headers of requests are evaluated against.
 type ETager interface {
 	// ETag returns an ETag for the file.  This should be of the
 	// form "value" or W/"value"
@@ -447,6 +579,20 @@ type ETager interface {
 	ETag(ctx context.Context) (string, error)
 }
 
+// FileSystemETager is an optional interface for a FileSystem which
+// computes the ETags of its files, such as from the hashes of their
+// contents it stores. It is used for the files whose os.FileInfo and File
+// objects do not implement ETager.
+type FileSystemETager interface {
+	// ETag returns an ETag for the file name, whose os.FileInfo is fi,
+	// of the form "value" or W/"value".
+	//
+	// If this returns error ErrNotImplemented then the error will
+	// be ignored and the base implementation will be used
+	// instead.
+	ETag(ctx context.Context, name string, fi os.FileInfo) (string, error)
+}
+
 func findETag(ctx context.Context, fs FileSystem, ls LockSystem, name string, fi os.FileInfo) (string, error) {
 	if do, ok := fi.(ETager); ok {
 		etag, err := do.ETag(ctx)
@@ -454,12 +600,95 @@ func findETag(ctx context.Context, fs FileSystem, ls LockSystem, name string, fi
 			return etag, err
 		}
 	}
+	if do, ok := ctx.Value(openFileKey{}).(ETager); ok {
+		etag, err := do.ETag(ctx)
+		if err != ErrNotImplemented {
+			return etag, err
+		}
+	}
+	if do, ok := fs.(FileSystemETager); ok {
+		etag, err := do.ETag(ctx, name, fi)
+		if err != ErrNotImplemented {
+			return etag, err
+		}
+	}
 	// The Apache http 2.4 web server by default concatenates the
 	// modification time and size of a file. We replicate the heuristic
 	// with nanosecond granularity.
 	return fmt.Sprintf(`"%x%x"`, fi.ModTime().UnixNano(), fi.Size()), nil
 }
 
+// Previewer is an optional interface for the os.FileInfo objects
+// returned by the FileSystem, whose files have previews for clients such
+// as file managers.
+//
+// If this interface is defined and Handler.PreviewNamespace is set, the
+// Preview of a file is exposed by the properties of that namespace
+// named in PROPFIND requests: "preview-url", with Preview.URL, and
+// "thumbnail", with a data URL of Preview.Data. As they may be costly to
+// compute, they are not listed by allprop and propname requests.
+type Previewer interface {
+	// Preview returns a preview of the file.
+	//
+	// If this returns error ErrNotImplemented then the file has no
+	// preview.
+	Preview(ctx context.Context) (Preview, error)
+}
+
+// A Preview is the preview of a file returned by a Previewer.
+type Preview struct {
+	// URL optionally is the URL of a preview of the file, such as a
+	// larger image served elsewhere.
+	URL string
+	// Data optionally is a small thumbnail of the file, of the content
+	// type ContentType, inlined in base64 in the responses.
+	Data        []byte
+	ContentType string
+}
+
+type previewNamespaceKey struct{}
+
+// previewFinder finds the preview properties of the file fi, getting its
+// Preview once.
+type previewFinder struct {
+	fi   os.FileInfo
+	done bool
+	p    Preview
+	err  error
+}
+
+// find returns the value of the property pn, and whether it is a preview
+// property of the file, in the namespace of the context.
+func (f *previewFinder) find(ctx context.Context, pn xml.Name) (string, bool, error) {
+	ns, _ := ctx.Value(previewNamespaceKey{}).(string)
+	if ns == "" || pn.Space != ns || pn.Local != "preview-url" && pn.Local != "thumbnail" {
+		return "", false, nil
+	}
+	if !f.done {
+		f.done = true
+		if pv, ok := f.fi.(Previewer); ok {
+			f.p, f.err = pv.Preview(ctx)
+		} else {
+			f.err = ErrNotImplemented
+		}
+	}
+	switch {
+	case f.err == ErrNotImplemented:
+		return "", false, nil
+	case f.err != nil:
+		return "", false, f.err
+	case pn.Local == "preview-url" && f.p.URL != "":
+		return escapeXML(f.p.URL), true, nil
+	case pn.Local == "thumbnail" && f.p.Data != nil:
+		ctype := f.p.ContentType
+		if ctype == "" {
+			ctype = http.DetectContentType(f.p.Data)
+		}
+		return "data:" + escapeXML(ctype) + ";base64," + base64.StdEncoding.EncodeToString(f.p.Data), true, nil
+	}
+	return "", false, nil
+}
+
 func findSupportedLock(ctx context.Context, fs FileSystem, ls LockSystem, name string, fi os.FileInfo) (string, error) {
 	return `` +
 		`<D:lockentry xmlns:D="DAV:">` +
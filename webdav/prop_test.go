@@ -9,10 +9,12 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -663,6 +665,244 @@ func TestFindContentTypeOverride(t *testing.T) {
 	}
 }
 
+// openCountingFS is a FileSystem which counts the files it opens.
+type openCountingFS struct {
+	FileSystem
+	opened int
+}
+
+func (fs *openCountingFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	fs.opened++
+	return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+}
+
+func TestFindContentTypePolicy(t *testing.T) {
+	memFS, err := buildTestFS([]string{"touch /file", "touch /notes.MD", "touch /page.html"})
+	if err != nil {
+		t.Fatalf("cannot create test filesystem: %v", err)
+	}
+	fs := &openCountingFS{FileSystem: memFS}
+	h := &Handler{
+		ContentTypes: map[string]string{
+			".md":   "text/markdown",
+			".html": "application/xhtml+xml",
+		},
+		DisableContentSniffing: true,
+	}
+	ctx := context.WithValue(context.Background(), contentTypePolicyKey{}, h.contentTypePolicy())
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"/file", "application/octet-stream"},
+		{"/notes.MD", "text/markdown"},
+		{"/page.html", "application/xhtml+xml"},
+	} {
+		fi, err := fs.Stat(ctx, tc.name)
+		if err != nil {
+			t.Fatalf("cannot Stat %s: %v", tc.name, err)
+		}
+		got, err := findContentType(ctx, fs, nil, tc.name, fi)
+		if err != nil {
+			t.Fatalf("findContentType %s failed: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("findContentType %s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if fs.opened != 0 {
+		t.Errorf("findContentType opened %d files, want none", fs.opened)
+	}
+	if p := (&Handler{}).contentTypePolicy(); p != nil {
+		t.Errorf("contentTypePolicy of a zero Handler = %+v, want nil", p)
+	}
+}
+
+// propValue returns the value of the property pn in pstats, and whether
+// it was found.
+func propValue(pstats []Propstat, pn xml.Name) (string, bool) {
+	for _, ps := range pstats {
+		for _, p := range ps.Props {
+			if p.XMLName == pn && ps.Status == http.StatusOK {
+				return string(p.InnerXML), true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestAllpropContentType(t *testing.T) {
+	memFS, err := buildTestFS([]string{"write /file <html></html>", "touch /notes.txt"})
+	if err != nil {
+		t.Fatalf("cannot create test filesystem: %v", err)
+	}
+	fs := &openCountingFS{FileSystem: memFS}
+	ctx := context.Background()
+	const sniffed = "text/html; charset=utf-8"
+
+	pstats, err := allprop(ctx, fs, nil, "/file", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := propValue(pstats, contentTypeName); got != sniffed {
+		t.Errorf("getcontenttype: got %q, want %q", got, sniffed)
+	}
+	if fs.opened != 1 {
+		t.Errorf("allprop opened %d files, want 1", fs.opened)
+	}
+
+	h := &Handler{AllpropOmitsSniffedTypes: true}
+	ctx = context.WithValue(ctx, contentTypePolicyKey{}, h.contentTypePolicy())
+	pstats, err = allprop(ctx, fs, nil, "/file", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := propValue(pstats, contentTypeName); ok {
+		t.Errorf("getcontenttype of a file to sniff: got %q, want none", got)
+	}
+	pstats, err = allprop(ctx, fs, nil, "/notes.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := propValue(pstats, contentTypeName); !ok {
+		t.Errorf("no getcontenttype of a file with a known extension")
+	}
+	pstats, err = allprop(ctx, fs, nil, "/file", []xml.Name{contentTypeName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := propValue(pstats, contentTypeName); got != sniffed {
+		t.Errorf("getcontenttype included: got %q, want %q", got, sniffed)
+	}
+}
+
+func TestPropCache(t *testing.T) {
+	fs, err := buildTestFS([]string{"write /file <html></html>"})
+	if err != nil {
+		t.Fatalf("cannot create test filesystem: %v", err)
+	}
+	c := NewPropCache(1)
+	h := &Handler{PropCache: c, AllpropOmitsSniffedTypes: true}
+	ctx := context.WithValue(context.Background(), contentTypePolicyKey{}, h.contentTypePolicy())
+	const sniffed = "text/html; charset=utf-8"
+
+	fi, err := fs.Stat(ctx, "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findContentType(ctx, fs, nil, "/file", fi); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.get(contentTypeName, "/file", fi); !ok || got != sniffed {
+		t.Errorf("cached content type: got %q, %t, want %q", got, ok, sniffed)
+	}
+	// Once sniffed, the content type is included in allprop responses.
+	pstats, err := allprop(ctx, fs, nil, "/file", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := propValue(pstats, contentTypeName); got != sniffed {
+		t.Errorf("getcontenttype cached: got %q, want %q", got, sniffed)
+	}
+
+	f, err := fs.OpenFile(ctx, "/file", os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("plain"))
+	f.Close()
+	if fi, err = fs.Stat(ctx, "/file"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.get(contentTypeName, "/file", fi); ok {
+		t.Errorf("cached content type of a changed file: got %q, want none", got)
+	}
+
+	c.put(contentTypeName, "/a", fi, "a")
+	c.put(contentTypeName, "/b", fi, "b")
+	if _, ok := c.get(contentTypeName, "/a", fi); ok {
+		t.Errorf("least recently used value not evicted")
+	}
+	c.Forget("/b")
+	if _, ok := c.get(contentTypeName, "/b", fi); ok {
+		t.Errorf("value not forgotten")
+	}
+	c.put(contentTypeName, "/dir/b", fi, "b")
+	c.Forget("/dir/")
+	if _, ok := c.get(contentTypeName, "/dir/b", fi); ok {
+		t.Errorf("value under a collection not forgotten")
+	}
+	// A Handler without a PropCache has a nil one.
+	var nilCache *PropCache
+	nilCache.Forget("/b")
+}
+
+func TestPropCacheForgottenByHandler(t *testing.T) {
+	c := NewPropCache(100)
+	h := &Handler{FileSystem: NewMemFS(), LockSystem: NewMemLS(), PropCache: c}
+	do := func(method, target, body string, hdr ...string) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for i := 0; i < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code >= 300 {
+			t.Fatalf("%s %s: status %d", method, target, w.Code)
+		}
+	}
+	cached := func(name string) bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		_, ok := c.entries[propCacheKey{contentTypeName, name}]
+		return ok
+	}
+	fi, err := h.FileSystem.Stat(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const proppatch = `<?xml version="1.0" encoding="utf-8" ?><D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><Z:a xmlns:Z="z:">b</Z:a></D:prop></D:set></D:propertyupdate>`
+	for _, tt := range []struct {
+		method, target, body string
+		hdr                  []string
+		forgotten            []string
+	}{
+		{"PUT", "/a", "a", nil, []string{"/a"}},
+		{"PROPPATCH", "/a", proppatch, nil, []string{"/a"}},
+		{"COPY", "/a", "", []string{"Destination", "/b"}, []string{"/b"}},
+		{"MOVE", "/b", "", []string{"Destination", "/c"}, []string{"/b", "/c"}},
+		{"DELETE", "/c", "", nil, []string{"/c"}},
+	} {
+		for _, name := range tt.forgotten {
+			c.put(contentTypeName, name, fi, "text/plain")
+		}
+		do(tt.method, tt.target, tt.body, tt.hdr...)
+		for _, name := range tt.forgotten {
+			if cached(name) {
+				t.Errorf("%s %s: value of %s not forgotten", tt.method, tt.target, name)
+			}
+		}
+	}
+}
+
+func TestNeedsSniffingContentTyper(t *testing.T) {
+	fs, err := buildTestFS([]string{"write /file <html></html>"})
+	if err != nil {
+		t.Fatalf("cannot create test filesystem: %v", err)
+	}
+	ctx := context.Background()
+	fi, err := fs.Stat(ctx, "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !needsSniffing(ctx, "/file", &overrideContentType{fi, "", ErrNotImplemented}) {
+		t.Errorf("needsSniffing of a ContentTyper returning ErrNotImplemented = false, want true")
+	}
+	if needsSniffing(ctx, "/file", &overrideContentType{fi, "text/html", nil}) {
+		t.Errorf("needsSniffing of a ContentTyper = true, want false")
+	}
+}
+
 type overrideETag struct {
 	os.FileInfo
 	eTag string
@@ -714,3 +954,75 @@ func TestFindETagOverride(t *testing.T) {
 		t.Fatalf("ETag wrong want %q got %q", originalETag, ETag)
 	}
 }
+
+type overridePreview struct {
+	os.FileInfo
+	preview Preview
+	err     error
+	calls   int
+}
+
+func (o *overridePreview) Preview(ctx context.Context) (Preview, error) {
+	o.calls++
+	return o.preview, o.err
+}
+
+func TestFindPreview(t *testing.T) {
+	fs, err := buildTestFS([]string{"touch /file"})
+	if err != nil {
+		t.Fatalf("cannot create test filesystem: %v", err)
+	}
+	fi, err := fs.Stat(context.Background(), "/file")
+	if err != nil {
+		t.Fatalf("cannot Stat /file: %v", err)
+	}
+	const ns = "http://example.com/ns"
+	ctx := context.WithValue(context.Background(), previewNamespaceKey{}, ns)
+	url := xml.Name{Space: ns, Local: "preview-url"}
+	thumb := xml.Name{Space: ns, Local: "thumbnail"}
+
+	o := &overridePreview{FileInfo: fi, preview: Preview{
+		URL:  "https://example.com/preview?a=1&b=2",
+		Data: []byte("\x89PNG\r\n\x1a\n"),
+	}}
+	f := previewFinder{fi: o}
+	for _, tc := range []struct {
+		pn   xml.Name
+		want string
+		ok   bool
+	}{
+		{url, "https://example.com/preview?a=1&amp;b=2", true},
+		{thumb, "data:image/png;base64,iVBORw0KGgo=", true},
+		{xml.Name{Space: ns, Local: "other"}, "", false},
+		{xml.Name{Space: "DAV:", Local: "thumbnail"}, "", false},
+	} {
+		got, ok, err := f.find(ctx, tc.pn)
+		if err != nil || got != tc.want || ok != tc.ok {
+			t.Errorf("find %v = %q, %t, %v; want %q, %t", tc.pn, got, ok, err, tc.want, tc.ok)
+		}
+	}
+	if o.calls != 1 {
+		t.Errorf("Preview called %d times, want once", o.calls)
+	}
+
+	// Without a namespace, the properties are not previews.
+	f = previewFinder{fi: o}
+	if _, ok, err := f.find(context.Background(), url); ok || err != nil {
+		t.Errorf("find without namespace = %t, %v; want false, nil", ok, err)
+	}
+
+	// ErrNotImplemented means no preview, and missing fields no property.
+	for _, o := range []*overridePreview{
+		{FileInfo: fi, err: ErrNotImplemented},
+		{FileInfo: fi, preview: Preview{Data: []byte("x")}},
+	} {
+		f = previewFinder{fi: o}
+		if got, ok, err := f.find(ctx, url); ok || err != nil {
+			t.Errorf("find with %+v = %q, %t, %v; want false, nil", o, got, ok, err)
+		}
+	}
+	f = previewFinder{fi: fi}
+	if _, ok, err := f.find(ctx, thumb); ok || err != nil {
+		t.Errorf("find without Previewer = %t, %v; want false, nil", ok, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"container/list"
+	"encoding/xml"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A PropCache memoizes the values of the live properties of resources
+// which are expensive to compute, such as the content types sniffed from
+// the contents of files. A value is kept while the size and modification
+// time of its resource are unchanged, for at most the number of values
+// given to NewPropCache, the least recently used being evicted.
+//
+// A PropCache may be shared by Handlers serving the same FileSystem
+// with the same properties settings.
+type PropCache struct {
+	max int
+
+	mu      sync.Mutex
+	entries map[propCacheKey]*list.Element
+	lru     list.List // of *propCacheEntry, the most recently used first
+}
+
+type propCacheKey struct {
+	pn   xml.Name
+	name string
+}
+
+type propCacheEntry struct {
+	key     propCacheKey
+	size    int64
+	modTime time.Time
+	value   string
+}
+
+// NewPropCache returns a PropCache holding at most max values.
+func NewPropCache(max int) *PropCache {
+	return &PropCache{
+		max:     max,
+		entries: make(map[propCacheKey]*list.Element),
+	}
+}
+
+// get returns the value of the property pn of the resource name, whose
+// info is fi, if it is cached and fi is unchanged.
+func (c *PropCache) get(pn xml.Name, name string, fi os.FileInfo) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[propCacheKey{pn, name}]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*propCacheEntry)
+	if e.size != fi.Size() || !e.modTime.Equal(fi.ModTime()) {
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		return "", false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true
+}
+
+// put caches value as that of the property pn of the resource name,
+// whose info is fi.
+func (c *PropCache) put(pn xml.Name, name string, fi os.FileInfo, value string) {
+	if c == nil || c.max <= 0 {
+		return
+	}
+	key := propCacheKey{pn, name}
+	e := &propCacheEntry{key: key, size: fi.Size(), modTime: fi.ModTime(), value: value}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*propCacheEntry).key)
+	}
+}
+
+// Forget removes the values of the resource name, and of the resources
+// under it if it is a collection, such as after its contents change
+// without a change in size nor modification time. The Handler calls it
+// for the resources which its requests change. It does nothing on a nil
+// PropCache, that of a Handler without one.
+func (c *PropCache) Forget(name string) {
+	if c == nil {
+		return
+	}
+	name = slashClean(name)
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.entries {
+		if key.name == name || strings.HasPrefix(key.name, prefix) {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
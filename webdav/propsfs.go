@@ -0,0 +1,268 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PersistentPropsOptions are the options of NewPersistentPropsFS.
+type PersistentPropsOptions struct {
+	// Suffix is the suffix of the names of the sidecar files, ".davprops"
+	// if empty.
+	Suffix string
+}
+
+// NewPersistentPropsFS returns a FileSystem which serves the files of fs,
+// such as a Dir, whose files do not hold dead properties, and persists
+// the dead properties set by PROPPATCH requests in sidecar files of fs:
+// those of the resource "/dir/name" in "/dir/name.davprops", and those of
+// the root directory in "/.davprops". Clients such as the Finder of macOS
+// and the Explorer of Windows store their metadata in dead properties.
+//
+// The sidecar files are hidden: they are neither listed nor can be
+// accessed through the FileSystem returned, and they follow their
+// resources when these are renamed, removed or copied. The sidecar of a
+// file removed or renamed directly in fs, not through the FileSystem
+// returned, is left behind; it is the sidecar of the next file of the
+// same name.
+//
+// A nil opts is equivalent to the zero PersistentPropsOptions.
+func NewPersistentPropsFS(fs FileSystem, opts *PersistentPropsOptions) FileSystem {
+	suffix := ".davprops"
+	if opts != nil && opts.Suffix != "" {
+		suffix = opts.Suffix
+	}
+	return &propsFS{fs: fs, suffix: suffix}
+}
+
+type propsFS struct {
+	fs     FileSystem
+	suffix string
+
+	mu sync.Mutex // serializes the updates of the sidecar files
+}
+
+// isSidecar reports whether name is, or may open on the file systems of
+// macOS and Windows, that of a sidecar file: the suffix is matched
+// without regard to case, after removing the name of an NTFS stream,
+// such as in "x.davprops::$DATA", and the trailing dots and spaces,
+// which Windows ignores.
+func (fs *propsFS) isSidecar(name string) bool {
+	name = path.Base(slashClean(name))
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, ". ")
+	return len(name) >= len(fs.suffix) && strings.EqualFold(name[len(name)-len(fs.suffix):], fs.suffix)
+}
+
+// sidecar returns the name of the sidecar file of the resource name.
+func (fs *propsFS) sidecar(name string) string {
+	return slashClean(name) + fs.suffix
+}
+
+func (fs *propsFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if fs.isSidecar(name) {
+		return os.ErrPermission
+	}
+	return fs.fs.Mkdir(ctx, name, perm)
+}
+
+func (fs *propsFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	if fs.isSidecar(name) {
+		return nil, os.ErrNotExist
+	}
+	f, err := fs.fs.OpenFile(ctx, name, flag, perm)
+	if err != nil && flag&(os.O_WRONLY|os.O_RDWR) != 0 && flag&(os.O_CREATE|os.O_TRUNC) == 0 {
+		// PROPPATCH opens its resource for writing, which the
+		// directories of a Dir are not.
+		if fi, statErr := fs.fs.Stat(ctx, name); statErr == nil && fi.IsDir() {
+			f, err = fs.fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &propsFile{File: f, fs: fs, ctx: ctx, name: name}, nil
+}
+
+func (fs *propsFS) RemoveAll(ctx context.Context, name string) error {
+	if fs.isSidecar(name) {
+		return os.ErrNotExist
+	}
+	if err := fs.fs.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fs.RemoveAll(ctx, fs.sidecar(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *propsFS) Rename(ctx context.Context, oldName, newName string) error {
+	if fs.isSidecar(oldName) || fs.isSidecar(newName) {
+		return os.ErrNotExist
+	}
+	if err := fs.fs.Rename(ctx, oldName, newName); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldProps, newProps := fs.sidecar(oldName), fs.sidecar(newName)
+	if err := fs.fs.RemoveAll(ctx, newProps); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := fs.fs.Stat(ctx, oldProps); os.IsNotExist(err) {
+		return nil
+	}
+	return fs.fs.Rename(ctx, oldProps, newProps)
+}
+
+func (fs *propsFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if fs.isSidecar(name) {
+		return nil, os.ErrNotExist
+	}
+	return fs.fs.Stat(ctx, name)
+}
+
+// Quota implements QuotaFileSystem with the quotas of the FileSystem fs
+// wraps, if any.
+func (fs *propsFS) Quota(ctx context.Context, name string) (available, used int64, err error) {
+	if qfs, ok := fs.fs.(QuotaFileSystem); ok {
+		return qfs.Quota(ctx, name)
+	}
+	return 0, 0, ErrNotImplemented
+}
+
+// readProps returns the dead properties of the resource name. fs.mu must
+// be held.
+func (fs *propsFS) readProps(ctx context.Context, name string) (map[xml.Name]Property, error) {
+	f, err := fs.fs.OpenFile(ctx, fs.sidecar(name), os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var props []Property
+	if err := json.NewDecoder(f).Decode(&props); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(props) == 0 {
+		return nil, nil
+	}
+	m := make(map[xml.Name]Property, len(props))
+	for _, p := range props {
+		m[p.XMLName] = p
+	}
+	return m, nil
+}
+
+// writeProps replaces the dead properties of the resource name with m.
+// fs.mu must be held.
+func (fs *propsFS) writeProps(ctx context.Context, name string, m map[xml.Name]Property) error {
+	if len(m) == 0 {
+		if err := fs.fs.RemoveAll(ctx, fs.sidecar(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	props := make([]Property, 0, len(m))
+	for _, p := range m {
+		props = append(props, p)
+	}
+	sort.Slice(props, func(i, j int) bool {
+		if props[i].XMLName.Space != props[j].XMLName.Space {
+			return props[i].XMLName.Space < props[j].XMLName.Space
+		}
+		return props[i].XMLName.Local < props[j].XMLName.Local
+	})
+	f, err := fs.fs.OpenFile(ctx, fs.sidecar(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	encErr := json.NewEncoder(f).Encode(props)
+	closeErr := f.Close()
+	if encErr != nil {
+		return encErr
+	}
+	return closeErr
+}
+
+// A propsFile is a File of a propsFS, holding the dead properties of its
+// sidecar file.
+type propsFile struct {
+	File
+	fs   *propsFS
+	ctx  context.Context // of OpenFile
+	name string
+}
+
+func (f *propsFile) DeadProps() (map[xml.Name]Property, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.fs.readProps(f.ctx, f.name)
+}
+
+func (f *propsFile) Patch(patches []Proppatch) ([]Propstat, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	m, err := f.fs.readProps(f.ctx, f.name)
+	if err != nil {
+		return nil, err
+	}
+	pstat := Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, Property{XMLName: p.XMLName})
+			if patch.Remove {
+				delete(m, p.XMLName)
+				continue
+			}
+			if m == nil {
+				m = map[xml.Name]Property{}
+			}
+			m[p.XMLName] = p
+		}
+	}
+	if err := f.fs.writeProps(f.ctx, f.name, m); err != nil {
+		return nil, err
+	}
+	return []Propstat{pstat}, nil
+}
+
+// Readdir returns the entries of the directory but the sidecar files.
+func (f *propsFile) Readdir(count int) ([]os.FileInfo, error) {
+	var entries []os.FileInfo
+	for {
+		fis, err := f.File.Readdir(count)
+		for _, fi := range fis {
+			if !strings.HasSuffix(fi.Name(), f.fs.suffix) {
+				entries = append(entries, fi)
+			}
+		}
+		if err != nil || count <= 0 || len(entries) > 0 || len(fis) == 0 {
+			if err == io.EOF && len(entries) > 0 {
+				err = nil
+			}
+			return entries, err
+		}
+		// All the entries read were sidecar files: read on, not to
+		// report the end of the directory early.
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+)
+
+// ErrInsufficientStorage may be returned by the FileSystem and File
+// methods writing files or creating directories when the storage is
+// exhausted, for the Handler to respond with a 507 Insufficient Storage
+// status.
+var ErrInsufficientStorage = errors.New("webdav: insufficient storage")
+
+// The quota properties of RFC 4331.
+var (
+	quotaAvailableName = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedName      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+// QuotaFileSystem is an optional interface for a FileSystem whose
+// collections have storage quotas. If implemented, the quotas are
+// exposed by the quota-available-bytes and quota-used-bytes properties of
+// the collections, defined by RFC 4331, and the Handler rejects the PUT
+// requests whose Content-Length exceeds the quota available in the
+// parent collection, and the MKCOL requests in a collection with no
+// quota available, with a 507 Insufficient Storage status. As they may
+// be costly to compute, the properties are not listed by allprop and
+// propname requests.
+type QuotaFileSystem interface {
+	// Quota returns the number of bytes available to the collection
+	// name, which may be negative once exceeded, and the number of
+	// bytes its resources use.
+	//
+	// If this returns error ErrNotImplemented then the collection has
+	// no quota.
+	Quota(ctx context.Context, name string) (available, used int64, err error)
+}
+
+// findQuota returns the value of the quota property pn of the resource
+// name, and whether it is one defined for the resource.
+func findQuota(ctx context.Context, fs FileSystem, name string, fi os.FileInfo, pn xml.Name) (string, bool, error) {
+	if pn != quotaAvailableName && pn != quotaUsedName || !fi.IsDir() {
+		return "", false, nil
+	}
+	qfs, ok := fs.(QuotaFileSystem)
+	if !ok {
+		return "", false, nil
+	}
+	available, used, err := qfs.Quota(ctx, name)
+	if err == ErrNotImplemented {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if pn == quotaUsedName {
+		return strconv.FormatInt(used, 10), true, nil
+	}
+	if available < 0 {
+		available = 0
+	}
+	return strconv.FormatInt(available, 10), true, nil
+}
+
+// checkQuota returns a 507 Insufficient Storage status if writing size
+// bytes to the resource name, or creating the collection name if size is
+// negative, exceeds the quota of its parent collection, or 0.
+func (h *Handler) checkQuota(ctx context.Context, name string, size int64) (int, error) {
+	qfs, ok := h.FileSystem.(QuotaFileSystem)
+	name = slashClean(name)
+	if !ok || name == "/" {
+		return 0, nil
+	}
+	// The name of a collection, such as that of a MKCOL request, may
+	// have a trailing slash: its parent is that of the clean name.
+	available, _, err := qfs.Quota(ctx, path.Dir(name))
+	if err == ErrNotImplemented {
+		return 0, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if size < 0 {
+		if available <= 0 {
+			return StatusInsufficientStorage, ErrInsufficientStorage
+		}
+		return 0, nil
+	}
+	// The file replaced frees its storage.
+	if fi, err := h.FileSystem.Stat(ctx, name); err == nil && !fi.IsDir() {
+		available += fi.Size()
+	}
+	if size > available {
+		return StatusInsufficientStorage, ErrInsufficientStorage
+	}
+	return 0, nil
+}
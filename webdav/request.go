@@ -0,0 +1,286 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DepthInfinity is the Depth of a Request with a "Depth: infinity"
+// header.
+const DepthInfinity = infiniteDepth
+
+// A Request holds the inputs of a WebDAV request, as parsed and checked
+// by the Handler before it executes the method. A Middleware may change
+// them before passing the Request on, but for LockTokens. The Depth of a
+// COPY, MOVE or PROPFIND request and the body of a PROPFIND or PROPPATCH
+// request are checked when the method executes, after the resource is
+// found and locked, so that the request fails as it did without a
+// Middleware: their fields are zero if they are invalid.
+type Request struct {
+	// Request is the HTTP request, whose headers and body have already
+	// been parsed into the other fields where they apply.
+	Request *http.Request
+
+	// Method is the method of the request, such as "PROPFIND".
+	Method string
+
+	// Path is the path of the resource, with the Prefix of the Handler
+	// stripped. It is empty for UNLOCK requests and lock refreshes.
+	Path string
+
+	// Depth is the depth of a COPY, MOVE, LOCK or PROPFIND request, 0, 1
+	// or DepthInfinity, which is their default without a Depth header.
+	Depth int
+
+	// Destination is the path of the destination of a COPY or MOVE
+	// request, with the Prefix of the Handler stripped, and Overwrite
+	// reports whether an existing destination is replaced.
+	Destination string
+	Overwrite   bool
+
+	// DestinationHandler is the Handler of the Shares of the Handler
+	// whose Prefix the destination of a COPY or MOVE request is under,
+	// if not the Handler itself, in which case Destination is a path of
+	// its FileSystem, with its Prefix stripped.
+	DestinationHandler *Handler
+
+	// LockTokens lists the lock tokens of the conditions of the If
+	// header, as submitted by the client, for a Middleware to inspect.
+	// Changing them has no effect: the locks are confirmed from the If
+	// header of Request itself.
+	LockTokens []string
+
+	// LockToken is the token of the lock to release by an UNLOCK request,
+	// or to refresh by a LOCK request without a body.
+	LockToken string
+
+	// Timeout is the requested duration of the lock of a LOCK request.
+	Timeout time.Duration
+
+	// Patches lists the changes of the properties of a PROPPATCH request.
+	Patches []Proppatch
+
+	lockInfo lockInfo // body of a LOCK request
+	propfind propfind // body of a PROPFIND request
+
+	// inputStatus and inputErr, if set, are those with which the request
+	// fails when the method executes, for an invalid Depth or body.
+	inputStatus int
+	inputErr    error
+
+	bulk       []*Request  // operations of a bulk request
+	bulkResult *bulkResult // outcome of an operation of a bulk request
+}
+
+// A MethodHandler executes the method of a WebDAV request. It returns the
+// status of the response, or 0 if it wrote the response itself, and an
+// error, if any, for the Logger of the Handler.
+type MethodHandler func(w http.ResponseWriter, r *Request) (status int, err error)
+
+// A Middleware wraps the MethodHandler which executes the WebDAV methods.
+// It may check or rewrite the Request before calling next, or reply
+// itself without calling it.
+type Middleware func(next MethodHandler) MethodHandler
+
+// parseRequest parses the inputs of the WebDAV request r.
+func (h *Handler) parseRequest(r *http.Request) (req *Request, status int, err error) {
+	req = &Request{Request: r, Method: r.Method}
+	switch r.Method {
+	case "OPTIONS", "GET", "HEAD", "POST", "DELETE", "PUT", "MKCOL", "PROPPATCH":
+		if req.Path, status, err = h.stripPrefix(r.URL.Path); err != nil {
+			return nil, status, err
+		}
+		if r.Method == "PROPPATCH" {
+			req.Patches, req.inputStatus, req.inputErr = readProppatch(r.Body)
+		}
+		if r.Method == "POST" && h.BulkPath != "" && req.Path == h.BulkPath {
+			if req.bulk, status, err = h.readBulk(r); err != nil {
+				return nil, status, err
+			}
+		}
+	case "COPY", "MOVE":
+		if status, err = h.parseCopyMove(req); err != nil {
+			return nil, status, err
+		}
+	case "LOCK":
+		if status, err = h.parseLock(req); err != nil {
+			return nil, status, err
+		}
+	case "UNLOCK":
+		// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
+		// Lock-Token value is a Coded-URL. We strip its angle brackets.
+		t := r.Header.Get("Lock-Token")
+		if h.OfficeCompatible && t != "" && t[0] != '<' {
+			t = "<" + t + ">"
+		}
+		if len(t) < 2 || t[0] != '<' || t[len(t)-1] != '>' {
+			return nil, http.StatusBadRequest, errInvalidLockToken
+		}
+		req.LockToken = t[1 : len(t)-1]
+		if !h.validToken(req.LockToken) {
+			return nil, http.StatusBadRequest, errInvalidLockToken
+		}
+	case "PROPFIND":
+		if req.Path, status, err = h.stripPrefix(r.URL.Path); err != nil {
+			return nil, status, err
+		}
+		req.Depth = infiniteDepth
+		if hdr := r.Header.Get("Depth"); hdr != "" {
+			req.Depth = parseDepth(hdr)
+		}
+		if req.Depth == invalidDepth {
+			req.Depth, req.inputStatus, req.inputErr = 0, http.StatusBadRequest, errInvalidDepth
+		} else {
+			req.propfind, req.inputStatus, req.inputErr = readPropfind(r.Body)
+		}
+	default:
+		return nil, http.StatusBadRequest, errUnsupportedMethod
+	}
+	if ih, ok := parseIfHeader(r.Header.Get("If")); ok {
+		for _, l := range ih.lists {
+			for _, c := range l.conditions {
+				if c.Token != "" {
+					req.LockTokens = append(req.LockTokens, c.Token)
+				}
+			}
+		}
+	}
+	for _, op := range req.bulk {
+		op.LockTokens = req.LockTokens
+	}
+	return req, 0, nil
+}
+
+func (h *Handler) parseCopyMove(req *Request) (status int, err error) {
+	r := req.Request
+	u, status, err := h.parseDestination(r, r.Header.Get("Destination"))
+	if err != nil {
+		return status, err
+	}
+
+	if req.Path, status, err = h.stripPrefix(r.URL.Path); err != nil {
+		return status, err
+	}
+	dh := h
+	if h.Shares != nil {
+		if x := h.Shares.lookup(h, u.Path); x != nil && x != h {
+			dh, req.DestinationHandler = x, x
+		}
+	}
+	if req.Destination, status, err = dh.stripPrefix(u.Path); err != nil {
+		return status, err
+	}
+
+	// Section 9.8.3 says that "The COPY method on a collection without a Depth
+	// header must act as if a Depth header with value "infinity" was included".
+	req.Depth = infiniteDepth
+	if hdr := r.Header.Get("Depth"); hdr != "" {
+		req.Depth = parseDepth(hdr)
+	}
+	if r.Method == "COPY" {
+		// Section 9.8.3 says that "A client may submit a Depth header on a
+		// COPY on a collection with a value of "0" or "infinity"."
+		if req.Depth != 0 && req.Depth != infiniteDepth {
+			req.Depth, req.inputStatus, req.inputErr = 0, http.StatusBadRequest, errInvalidDepth
+		}
+		req.Overwrite = r.Header.Get("Overwrite") != "F"
+	} else {
+		// Section 9.9.2 says that "The MOVE method on a collection must act as if
+		// a "Depth: infinity" header was used on it. A client must not submit a
+		// Depth header on a MOVE on a collection with any value but "infinity"."
+		if req.Depth != infiniteDepth {
+			req.Depth, req.inputStatus, req.inputErr = 0, http.StatusBadRequest, errInvalidDepth
+		}
+		req.Overwrite = r.Header.Get("Overwrite") == "T"
+	}
+	return 0, nil
+}
+
+// parseDestination parses the destination dst of a COPY or MOVE request
+// r, checked or rewritten as configured.
+func (h *Handler) parseDestination(r *http.Request, dst string) (u *url.URL, status int, err error) {
+	if dst == "" {
+		return nil, http.StatusBadRequest, errInvalidDestination
+	}
+	u, err = url.Parse(dst)
+	if err != nil {
+		return nil, http.StatusBadRequest, errInvalidDestination
+	}
+	switch {
+	case h.RewriteDestination != nil:
+		if u, err = h.RewriteDestination(r, u); err != nil {
+			return nil, http.StatusBadGateway, err
+		}
+		if u == nil {
+			return nil, http.StatusBadGateway, errInvalidDestination
+		}
+	case h.DestinationPolicy == DestinationIgnoreHost:
+	default:
+		if u.Host != "" && u.Host != r.Host {
+			return nil, http.StatusBadGateway, errInvalidDestination
+		}
+	}
+	if h.PrefixFunc != nil {
+		v := *u
+		v.Path = h.localPath(r, u.Path)
+		u = &v
+	}
+	return u, 0, nil
+}
+
+func (h *Handler) parseLock(req *Request) (status int, err error) {
+	r := req.Request
+	if req.Timeout, err = parseTimeout(r.Header.Get("Timeout")); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.lockInfo, status, err = readLockInfo(r.Body); err != nil {
+		return status, err
+	}
+	if req.lockInfo == (lockInfo{}) {
+		// An empty lockInfo means to refresh the lock.
+		if hdr := r.Header.Get("Lock-Token"); h.OfficeCompatible && r.Header.Get("If") == "" && hdr != "" {
+			req.LockToken = strings.TrimSuffix(strings.TrimPrefix(hdr, "<"), ">")
+		} else {
+			ih, ok := parseIfHeader(r.Header.Get("If"))
+			if !ok {
+				return http.StatusBadRequest, errInvalidIfHeader
+			}
+			if len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
+				req.LockToken = ih.lists[0].conditions[0].Token
+			}
+		}
+		if req.LockToken == "" || !h.validToken(req.LockToken) {
+			return http.StatusBadRequest, errInvalidLockToken
+		}
+		return 0, nil
+	}
+	if h.OfficeCompatible {
+		// The lock of the token of the If header, if any, may be
+		// refreshed rather than locked again.
+		if ih, ok := parseIfHeader(r.Header.Get("If")); ok && len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
+			if t := ih.lists[0].conditions[0].Token; t != "" && h.validToken(t) {
+				req.LockToken = t
+			}
+		}
+	}
+
+	// Section 9.10.3 says that "If no Depth header is submitted on a LOCK request,
+	// then the request MUST act as if a "Depth:infinity" had been submitted."
+	req.Depth = infiniteDepth
+	if hdr := r.Header.Get("Depth"); hdr != "" {
+		req.Depth = parseDepth(hdr)
+		if req.Depth != 0 && req.Depth != infiniteDepth {
+			// Section 9.10.3 says that "Values other than 0 or infinity must not be
+			// used with the Depth header on a LOCK method".
+			return http.StatusBadRequest, errInvalidDepth
+		}
+	}
+	req.Path, status, err = h.stripPrefix(r.URL.Path)
+	return status, err
+}
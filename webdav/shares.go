@@ -0,0 +1,121 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webdav
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var errTransferDenied = errors.New("webdav: transfer between shares denied")
+
+// Shares registers the Handlers of a process which serve several
+// FileSystems, or shares, under different prefixes. A COPY or MOVE request
+// to a Handler whose Shares field is set, with a destination whose
+// longest Prefix is that of another Handler registered, transfers the
+// resources from one FileSystem to the other, rather than failing: they
+// are copied, and for a MOVE, the source is then deleted.
+//
+// Each Handler confirms the locks of its own resource with its
+// LockSystem. The If header of the request must list the lock tokens of
+// both, if any.
+type Shares struct {
+	// AllowTransfer optionally reports whether a COPY or MOVE request,
+	// according to method, may transfer resources from the share of the
+	// Handler src to that of dst. Denied transfers fail with a 502 Bad
+	// Gateway status, as Section 9.8.5 of RFC 4918 specifies for
+	// destinations in a namespace which does not accept them. If nil,
+	// all transfers are allowed.
+	AllowTransfer func(method string, src, dst *Handler) bool
+
+	mu       sync.RWMutex
+	handlers []*Handler
+}
+
+// Register adds the Handlers h to s, as destinations of transfers.
+func (s *Shares) Register(h ...*Handler) {
+	s.mu.Lock()
+	s.handlers = append(s.handlers, h...)
+	s.mu.Unlock()
+}
+
+// Unregister removes the Handler h from s.
+func (s *Shares) Unregister(h *Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, x := range s.handlers {
+		if x == h {
+			s.handlers = append(s.handlers[:i:i], s.handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// lookup returns the Handler, h or one of those registered, whose Prefix
+// is the longest prefix of p, or nil.
+func (s *Shares) lookup(h *Handler, p string) *Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found *Handler
+	for _, x := range append([]*Handler{h}, s.handlers...) {
+		if !strings.HasPrefix(p, x.Prefix) {
+			continue
+		}
+		if found == nil || len(x.Prefix) > len(found.Prefix) {
+			found = x
+		}
+	}
+	return found
+}
+
+// handleTransfer executes a COPY or MOVE request whose destination is in
+// the share of the Handler dh.
+func (h *Handler) handleTransfer(req *Request, dh *Handler) (status int, err error) {
+	r, src, dst := req.Request, req.Path, req.Destination
+	if h.Shares != nil && h.Shares.AllowTransfer != nil && !h.Shares.AllowTransfer(r.Method, h, dh) {
+		return http.StatusBadGateway, errTransferDenied
+	}
+	if dh.FileSystem == nil {
+		return http.StatusInternalServerError, errNoFileSystem
+	}
+	if dh.LockSystem == nil {
+		return http.StatusInternalServerError, errNoLockSystem
+	}
+
+	ctx := r.Context()
+
+	// As for a COPY within a share, only the destination is locked.
+	if r.Method == "MOVE" {
+		release, status, err := h.confirmLocks(r, src, "")
+		if err != nil {
+			return status, err
+		}
+		defer release()
+		defer h.PropCache.Forget(src)
+	}
+	release, status, err := dh.confirmLocks(r, "", dst)
+	if err != nil {
+		return status, err
+	}
+	defer release()
+	defer dh.PropCache.Forget(dst)
+	if req.inputErr != nil {
+		return req.inputStatus, req.inputErr
+	}
+	if status, err := h.checkPreconditions(r, src); err != nil {
+		return status, err
+	}
+
+	status, err = copyFilesBetween(ctx, h.FileSystem, dh.FileSystem, src, dst, req.Overwrite, req.Depth, 0)
+	if err != nil || r.Method == "COPY" {
+		return status, err
+	}
+	if err := h.FileSystem.RemoveAll(ctx, src); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return status, nil
+}
@@ -6,6 +6,7 @@
 package webdav // import "golang.org/x/net/webdav"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -28,6 +31,188 @@ type Handler struct {
 	// Logger is an optional error logger. If non-nil, it will be called
 	// for all HTTP requests.
 	Logger func(*http.Request, error)
+	// ContentTypes optionally maps file name extensions, such as ".md",
+	// to content types. They take precedence over mime.TypeByExtension
+	// for the getcontenttype property and for GET responses.
+	ContentTypes map[string]string
+	// DisableContentSniffing stops the Handler from reading the start of
+	// a file to guess its content type when none is known from the file
+	// name extension, which makes PROPFIND open every file it lists.
+	// Such files are reported as application/octet-stream instead.
+	DisableContentSniffing bool
+	// DestinationPolicy selects how the host of the Destination header of
+	// COPY and MOVE requests is checked. It is ignored if
+	// RewriteDestination is set.
+	DestinationPolicy DestinationPolicy
+	// RewriteDestination optionally checks the Destination URL of a COPY
+	// or MOVE request and returns the URL to use, whose path, including
+	// Prefix, names the destination resource. It allows serving clients
+	// through a reverse proxy which changes the host or the path prefix
+	// of requests, but not the Destination header. An error, or a nil URL,
+	// fails the request with a 502 Bad Gateway status.
+	RewriteDestination func(r *http.Request, dst *url.URL) (*url.URL, error)
+	// DirectoryIndex optionally serves the GET and HEAD requests on
+	// collections, which otherwise fail with a 405 Method Not Allowed
+	// status, for instance with HTMLDirectoryIndex to let browsers list
+	// them. Requests for a collection without a trailing slash are
+	// redirected to the path with one.
+	DirectoryIndex DirectoryIndexFunc
+	// Middleware optionally wraps the execution of the WebDAV methods,
+	// the first Middleware outermost. They are passed the inputs of the
+	// requests once parsed and checked, and are not called for requests
+	// which fail to be.
+	Middleware []Middleware
+	// Shares optionally lets COPY and MOVE requests transfer resources to
+	// the other Handlers registered in it, when the longest Prefix of
+	// their destination is that of one of them.
+	Shares *Shares
+	// HrefEscaping selects how the paths of the hrefs of multistatus
+	// responses are percent-encoded, for clients which do not accept
+	// those of HrefEscapeDefault.
+	HrefEscaping HrefEscaping
+	// PreviewNamespace optionally is the XML namespace of the properties
+	// exposing the previews of the files whose os.FileInfo implements
+	// Previewer, such as "http://example.com/ns".
+	PreviewNamespace string
+	// AllpropOmitsSniffedTypes omits from the responses to allprop
+	// PROPFIND requests the getcontenttype property of the files whose
+	// content type is only known by reading them, so that listing a
+	// collection opens none of its files. Clients may still request it
+	// with the include element, or by name.
+	AllpropOmitsSniffedTypes bool
+	// PropCache optionally memoizes the properties which are expensive
+	// to compute, such as the content types sniffed, across the
+	// resources of PROPFIND requests and across requests.
+	PropCache *PropCache
+	// JSONMultistatus sends the multistatus responses of PROPFIND and
+	// PROPPATCH requests in JSON to the clients whose Accept header
+	// prefers application/json to XML, such as
+	//
+	//	{"responses": [{"href": "/dir/", "propstats": [{"status": 200,
+	//		"props": [{"namespace": "DAV:", "name": "displayname", "value": "dir"},
+	//			{"namespace": "DAV:", "name": "resourcetype",
+	//				"xml": "<D:collection xmlns:D=\"DAV:\"/>"}]}]}]}
+	//
+	// A property whose value is text has it unescaped in "value", and
+	// one with elements has its XML in "xml". A propstat may also have
+	// "error", the XML of its error element, and "responseDescription".
+	// The responses of a bulk request without propstats have a "status"
+	// instead. The other responses are unchanged.
+	JSONMultistatus bool
+	// BulkPath optionally is the path, with Prefix stripped, of an
+	// endpoint to which POST requests submit several PROPPATCH, DELETE
+	// and MOVE operations at once, such as for sync clients. The body
+	// of such a request is a bulk element of the BulkNamespace, such as
+	//
+	//	<b:bulk xmlns:b="http://golang.org/x/net/webdav/bulk" xmlns:D="DAV:">
+	//		<b:proppatch><D:href>/a</D:href>
+	//			<D:propertyupdate>...</D:propertyupdate></b:proppatch>
+	//		<b:delete><D:href>/b</D:href></b:delete>
+	//		<b:move><D:href>/c</D:href><b:destination>/d</b:destination>
+	//			<b:overwrite>T</b:overwrite></b:move>
+	//	</b:bulk>
+	//
+	// whose hrefs and destinations are paths including Prefix, or the
+	// prefix of PrefixFunc. The
+	// operations are executed in order, each through the Middleware as
+	// a Request of its own method. They are reported by a multistatus
+	// response with the propstats of each PROPPATCH and the status of
+	// the others, such as 404 Not Found; the failure of one does not
+	// stop the others. A bulk request has at most 1000 operations, and
+	// moves only within the FileSystem of the Handler.
+	BulkPath string
+	// PrefixFunc optionally returns the URL path prefix under which the
+	// client of the request r addresses the resources, when it differs
+	// from the Prefix of the paths the Handler receives, such as behind
+	// a reverse proxy which strips a prefix and forwards it in an
+	// X-Forwarded-Prefix header, or under the SCRIPT_NAME of a FastCGI
+	// deployment. The prefix returned is that of the hrefs of the
+	// multistatus responses, and is replaced by Prefix in the URLs of
+	// the Destination and If headers and of the bulk requests, which
+	// the client sends. Prefix is still stripped from the path of the
+	// request URL.
+	PrefixFunc func(r *http.Request) string
+	// OfficeCompatible relaxes the handling of locks and PUT requests for
+	// the clients of Microsoft Office and the Windows WebDAV redirector:
+	//
+	//   - a LOCK request without an If header refreshes the lock of the
+	//     token of its Lock-Token header, and the refreshed token is
+	//     echoed in the Lock-Token header of the response;
+	//   - a LOCK request with a lockinfo body, whose If header has the
+	//     token of a lock of the resource, refreshes that lock instead of
+	//     failing with a 423 Locked status, and fails with a 412
+	//     Precondition Failed status if it has the token of another lock;
+	//   - an UNLOCK request may have a Lock-Token header without angle
+	//     brackets;
+	//   - a LOCK request on a resource which does not exist, which creates
+	//     it as an empty file, fails with a 409 Conflict status if its
+	//     parent collection does not exist either;
+	//   - a PUT request without a body on a file which is not empty, by
+	//     which the holder of a lock of the file probes whether it may
+	//     write it, leaves it unmodified if the request submits the token
+	//     of that lock in its If header: other empty PUT requests still
+	//     truncate the file;
+	//   - a PUT request which replaces a file succeeds with a 204 No
+	//     Content status rather than 201 Created;
+	//   - the X-MSDAVEXT header of MS-WDV is advertised in the responses
+	//     to OPTIONS requests, and a GET request with an X-MSDAVEXT:
+	//     PROPFIND header gets the properties of the file with its
+	//     contents, and a PUT request with an X-MSDAVEXT: PROPPATCH header
+	//     sets properties with the contents, its response being that of
+	//     the PROPPATCH. The extended GET is not conditional, and the
+	//     other extensions of MS-WDV, such as X-MSDAVEXT_Error, are not
+	//     implemented.
+	OfficeCompatible bool
+	// AllowPartialPut accepts the PUT requests with a Content-Range
+	// header, such as "bytes 100-199/1000" or "bytes 100-199/*", as
+	// sync clients send to upload large files in pieces: their body,
+	// which must be of the length of the range, is written at its
+	// offset in the file, opened with O_RDWR, rather than replacing it.
+	// The file is created if it does not exist. A range starting past
+	// the end of the file, which would leave a hole in it, fails with a
+	// 416 Range Not Satisfiable status, and an invalid one with a 400 Bad
+	// Request status.
+	AllowPartialPut bool
+	// PropfindFlushInterval, if positive, is the interval at which the
+	// multistatus responses of PROPFIND requests, written one response
+	// element at a time as the resources are walked, are flushed to the
+	// client, if the http.ResponseWriter is an http.Flusher, so that
+	// clients listing huge directories see progress early rather than
+	// once the server's buffers fill. The first response element is
+	// flushed as soon as it is written. If zero, responses are flushed
+	// as the http.ResponseWriter does.
+	PropfindFlushInterval time.Duration
+}
+
+// A DestinationPolicy selects how the Handler checks the host of the
+// Destination header of COPY and MOVE requests.
+type DestinationPolicy int
+
+const (
+	// DestinationSameHost requires the host, if any, to be that of the
+	// request. Other destinations fail with a 502 Bad Gateway status,
+	// as Section 9.8.5 of RFC 4918 specifies for destinations on other
+	// servers.
+	DestinationSameHost DestinationPolicy = iota
+
+	// DestinationIgnoreHost ignores the scheme and the host, and only
+	// uses the path of the destination, for a Handler which is reached
+	// under several host names.
+	DestinationIgnoreHost
+)
+
+// contentTypePolicy returns the content type settings of h, or nil if
+// there are none.
+func (h *Handler) contentTypePolicy() *contentTypePolicy {
+	if h.ContentTypes == nil && !h.DisableContentSniffing && !h.AllpropOmitsSniffedTypes && h.PropCache == nil {
+		return nil
+	}
+	return &contentTypePolicy{
+		types:          h.ContentTypes,
+		noSniff:        h.DisableContentSniffing,
+		allpropNoSniff: h.AllpropOmitsSniffedTypes,
+		cache:          h.PropCache,
+	}
 }
 
 func (h *Handler) stripPrefix(p string) (string, int, error) {
@@ -40,34 +225,44 @@ func (h *Handler) stripPrefix(p string) (string, int, error) {
 	return p, http.StatusNotFound, errPrefixMismatch
 }
 
+// clientPrefix returns the URL path prefix under which the client of r
+// addresses the resources. See PrefixFunc.
+func (h *Handler) clientPrefix(r *http.Request) string {
+	if h.PrefixFunc != nil {
+		return h.PrefixFunc(r)
+	}
+	return h.Prefix
+}
+
+// localPath returns the path p of a URL sent by the client of r, with its
+// client prefix, if any, replaced by Prefix.
+func (h *Handler) localPath(r *http.Request, p string) string {
+	if h.PrefixFunc == nil {
+		return p
+	}
+	if prefix := h.PrefixFunc(r); strings.HasPrefix(p, prefix) {
+		return h.Prefix + p[len(prefix):]
+	}
+	return p
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	status, err := http.StatusBadRequest, errUnsupportedMethod
 	if h.FileSystem == nil {
 		status, err = http.StatusInternalServerError, errNoFileSystem
 	} else if h.LockSystem == nil {
 		status, err = http.StatusInternalServerError, errNoLockSystem
+	} else if req, st, e := h.parseRequest(r); e != nil {
+		status, err = st, e
 	} else {
-		switch r.Method {
-		case "OPTIONS":
-			status, err = h.handleOptions(w, r)
-		case "GET", "HEAD", "POST":
-			status, err = h.handleGetHeadPost(w, r)
-		case "DELETE":
-			status, err = h.handleDelete(w, r)
-		case "PUT":
-			status, err = h.handlePut(w, r)
-		case "MKCOL":
-			status, err = h.handleMkcol(w, r)
-		case "COPY", "MOVE":
-			status, err = h.handleCopyMove(w, r)
-		case "LOCK":
-			status, err = h.handleLock(w, r)
-		case "UNLOCK":
-			status, err = h.handleUnlock(w, r)
-		case "PROPFIND":
-			status, err = h.handlePropfind(w, r)
-		case "PROPPATCH":
-			status, err = h.handleProppatch(w, r)
+		next := MethodHandler(h.execute)
+		for i := len(h.Middleware) - 1; i >= 0; i-- {
+			next = h.Middleware[i](next)
+		}
+		if req.bulk != nil {
+			status, err = h.handleBulk(w, req, next)
+		} else {
+			status, err = next(w, req)
 		}
 	}
 
@@ -82,6 +277,36 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// execute executes the method of req.
+func (h *Handler) execute(w http.ResponseWriter, req *Request) (status int, err error) {
+	if req.bulkResult != nil {
+		return h.executeBulkOp(req)
+	}
+	switch req.Method {
+	case "OPTIONS":
+		return h.handleOptions(w, req)
+	case "GET", "HEAD", "POST":
+		return h.handleGetHeadPost(w, req)
+	case "DELETE":
+		return h.handleDelete(w, req)
+	case "PUT":
+		return h.handlePut(w, req)
+	case "MKCOL":
+		return h.handleMkcol(w, req)
+	case "COPY", "MOVE":
+		return h.handleCopyMove(w, req)
+	case "LOCK":
+		return h.handleLock(w, req)
+	case "UNLOCK":
+		return h.handleUnlock(w, req)
+	case "PROPFIND":
+		return h.handlePropfind(w, req)
+	case "PROPPATCH":
+		return h.handleProppatch(w, req)
+	}
+	return http.StatusBadRequest, errUnsupportedMethod
+}
+
 func (h *Handler) lock(now time.Time, root string) (token string, status int, err error) {
 	token, err = h.LockSystem.Create(now, LockDetails{
 		Root:      root,
@@ -98,6 +323,14 @@ func (h *Handler) lock(now time.Time, root string) (token string, status int, er
 }
 
 func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func(), status int, err error) {
+	release, _, status, err = h.confirmHeldLocks(r, src, dst)
+	return release, status, err
+}
+
+// confirmHeldLocks is confirmLocks, also reporting whether the lock of src
+// that it confirmed is one whose token the If header of r submits, rather
+// than a temporary lock.
+func (h *Handler) confirmHeldLocks(r *http.Request, src, dst string) (release func(), held bool, status int, err error) {
 	hdr := r.Header.Get("If")
 	if hdr == "" {
 		// An empty If header means that the client hasn't previously created locks.
@@ -109,7 +342,7 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 		if src != "" {
 			srcToken, status, err = h.lock(now, src)
 			if err != nil {
-				return nil, status, err
+				return nil, false, status, err
 			}
 		}
 		if dst != "" {
@@ -118,7 +351,7 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 				if srcToken != "" {
 					h.LockSystem.Unlock(now, srcToken)
 				}
-				return nil, status, err
+				return nil, false, status, err
 			}
 		}
 
@@ -129,12 +362,12 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 			if srcToken != "" {
 				h.LockSystem.Unlock(now, srcToken)
 			}
-		}, 0, nil
+		}, false, 0, nil
 	}
 
 	ih, ok := parseIfHeader(hdr)
 	if !ok {
-		return nil, http.StatusBadRequest, errInvalidIfHeader
+		return nil, false, http.StatusBadRequest, errInvalidIfHeader
 	}
 	// ih is a disjunction (OR) of ifLists, so any ifList will do.
 	for _, l := range ih.lists {
@@ -149,37 +382,129 @@ func (h *Handler) confirmLocks(r *http.Request, src, dst string) (release func()
 			if u.Host != r.Host {
 				continue
 			}
-			lsrc, status, err = h.stripPrefix(u.Path)
+			lsrc, status, err = h.stripPrefix(h.localPath(r, u.Path))
 			if err != nil {
-				return nil, status, err
+				return nil, false, status, err
 			}
 		}
+		if !h.validConditions(l.conditions) {
+			continue
+		}
 		release, err = h.LockSystem.Confirm(time.Now(), lsrc, dst, l.conditions...)
 		if err == ErrConfirmationFailed {
 			continue
 		}
 		if err != nil {
-			return nil, http.StatusInternalServerError, err
+			return nil, false, http.StatusInternalServerError, err
 		}
-		return release, 0, nil
+		return release, lsrc == src && submitsToken(l.conditions), 0, nil
 	}
 	// Section 10.4.1 says that "If this header is evaluated and all state lists
 	// fail, then the request must fail with a 412 (Precondition Failed) status."
 	// We follow the spec even though the cond_put_corrupt_token test case from
 	// the litmus test warns on seeing a 412 instead of a 423 (Locked).
-	return nil, http.StatusPreconditionFailed, ErrLocked
+	return nil, false, http.StatusPreconditionFailed, ErrLocked
 }
 
-func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
-	if err != nil {
-		return status, err
+// submitsToken reports whether conditions, which a LockSystem confirmed,
+// hold the token of a lock.
+func submitsToken(conditions []Condition) bool {
+	for _, c := range conditions {
+		if !c.Not && c.Token != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of
+// r, for the state-changing methods, against the ETag of the resource
+// reqPath, which may not exist. It is called once the locks of r are
+// confirmed, for no concurrent request to change the resource between
+// the evaluation and the change. GET and HEAD requests are evaluated by
+// http.ServeContent.
+// https://www.rfc-editor.org/rfc/rfc7232#section-3
+func (h *Handler) checkPreconditions(r *http.Request, reqPath string) (status int, err error) {
+	im, inm := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if im == "" && inm == "" {
+		return 0, nil
+	}
+	ctx := r.Context()
+	exists := true
+	var etag string
+	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		exists = false
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	} else {
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		etag, err = findETag(context.WithValue(ctx, openFileKey{}, f), h.FileSystem, h.LockSystem, reqPath, fi)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if im != "" && !(exists && matchETags(im, etag, false)) {
+		return http.StatusPreconditionFailed, errPreconditionFailed
+	}
+	if inm != "" && exists && matchETags(inm, etag, true) {
+		return http.StatusPreconditionFailed, errPreconditionFailed
+	}
+	return 0, nil
+}
+
+// matchETags reports whether the value of an If-Match or If-None-Match
+// header, "*" or a list of entity tags, matches etag, with the weak
+// comparison if weak is set, and the strong one otherwise.
+func matchETags(list, etag string, weak bool) bool {
+	list = strings.TrimSpace(list)
+	if list == "*" {
+		return true
+	}
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			if strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if t == etag && !strings.HasPrefix(t, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// validToken reports whether token may be a lock token of h.LockSystem.
+func (h *Handler) validToken(token string) bool {
+	v, ok := h.LockSystem.(TokenValidator)
+	return !ok || v.ValidToken(token)
+}
+
+// validConditions reports whether the conditions on lock tokens may
+// match, given that an invalid token is not that of any lock.
+func (h *Handler) validConditions(conditions []Condition) bool {
+	for _, c := range conditions {
+		if c.Token != "" && !c.Not && !h.validToken(c.Token) {
+			return false
+		}
 	}
+	return true
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath := req.Request, req.Path
 	ctx := r.Context()
 	allow := "OPTIONS, LOCK, PUT, MKCOL"
 	if fi, err := h.FileSystem.Stat(ctx, reqPath); err == nil {
 		if fi.IsDir() {
 			allow = "OPTIONS, LOCK, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND"
+			if h.DirectoryIndex != nil {
+				allow = "OPTIONS, LOCK, GET, HEAD, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND"
+			}
 		} else {
 			allow = "OPTIONS, LOCK, GET, HEAD, POST, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND, PUT"
 		}
@@ -189,14 +514,14 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) (status
 	w.Header().Set("DAV", "1, 2")
 	// http://msdn.microsoft.com/en-au/library/cc250217.aspx
 	w.Header().Set("MS-Author-Via", "DAV")
+	if h.OfficeCompatible {
+		w.Header().Set("X-MSDAVEXT", msdavextSupported)
+	}
 	return 0, nil
 }
 
-func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
-	if err != nil {
-		return status, err
-	}
+func (h *Handler) handleGetHeadPost(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath := req.Request, req.Path
 	// TODO: check locks for read-only access??
 	ctx := r.Context()
 	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDONLY, 0)
@@ -209,28 +534,59 @@ func (h *Handler) handleGetHeadPost(w http.ResponseWriter, r *http.Request) (sta
 		return http.StatusNotFound, err
 	}
 	if fi.IsDir() {
-		return http.StatusMethodNotAllowed, nil
+		if h.DirectoryIndex == nil || r.Method == "POST" {
+			return http.StatusMethodNotAllowed, nil
+		}
+		return h.serveDirectoryIndex(w, r, reqPath, f)
 	}
-	etag, err := findETag(ctx, h.FileSystem, h.LockSystem, reqPath, fi)
+	if r.Method != "POST" && h.msdavext(r, msdavextPropfind) {
+		return h.serveExtendedGet(w, r, reqPath, f, fi)
+	}
+	etag, err := findETag(context.WithValue(ctx, openFileKey{}, f), h.FileSystem, h.LockSystem, reqPath, fi)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
+	// ServeContent evaluates the preconditions against the ETag.
 	w.Header().Set("ETag", etag)
-	// Let ServeContent determine the Content-Type header.
+	if p := h.contentTypePolicy(); p != nil {
+		if ctype := p.typeByExtension(reqPath); ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		} else if p.noSniff {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+	}
+	// Let ServeContent determine the Content-Type header, if not set above.
 	http.ServeContent(w, r, reqPath, fi.ModTime(), f)
 	return 0, nil
 }
 
-func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+func (h *Handler) serveDirectoryIndex(w http.ResponseWriter, r *http.Request, reqPath string, f File) (status int, err error) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		u := *r.URL
+		u.Path += "/"
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+		return 0, nil
+	}
+	entries, err := f.Readdir(-1)
 	if err != nil {
-		return status, err
+		return http.StatusInternalServerError, err
 	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	h.DirectoryIndex(w, r, reqPath, entries)
+	return 0, nil
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath := req.Request, req.Path
 	release, status, err := h.confirmLocks(r, reqPath, "")
 	if err != nil {
 		return status, err
 	}
 	defer release()
+	defer h.PropCache.Forget(reqPath)
+	if status, err := h.checkPreconditions(r, reqPath); err != nil {
+		return status, err
+	}
 
 	ctx := r.Context()
 
@@ -251,27 +607,68 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) (status i
 	return http.StatusNoContent, nil
 }
 
-func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+func (h *Handler) handlePut(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath := req.Request, req.Path
+	release, held, status, err := h.confirmHeldLocks(r, reqPath, "")
 	if err != nil {
 		return status, err
 	}
-	release, status, err := h.confirmLocks(r, reqPath, "")
-	if err != nil {
+	defer release()
+	defer h.PropCache.Forget(reqPath)
+	if status, err := h.checkPreconditions(r, reqPath); err != nil {
 		return status, err
 	}
-	defer release()
-	// TODO(rost): Support the If-Match, If-None-Match headers? See bradfitz'
-	// comments in http.checkEtag.
 	ctx := r.Context()
 
+	if cr := r.Header.Get("Content-Range"); cr != "" && h.AllowPartialPut {
+		return h.handlePartialPut(w, r, reqPath, cr)
+	}
+	body, length := io.Reader(r.Body), r.ContentLength
+	var patches []Proppatch
+	extended := h.msdavext(r, msdavextProppatch)
+	if extended {
+		if patches, body, length, status, err = readExtendedPut(r.Body); err != nil {
+			return status, err
+		}
+	}
+	created := true
+	if h.OfficeCompatible {
+		if fi, err := h.FileSystem.Stat(ctx, reqPath); err == nil {
+			created = false
+			if length == 0 && !fi.IsDir() && fi.Size() > 0 && held {
+				// A probe, which must not truncate the file.
+				etag, err := findETag(ctx, h.FileSystem, h.LockSystem, reqPath, fi)
+				if err != nil {
+					return http.StatusInternalServerError, err
+				}
+				w.Header().Set("ETag", etag)
+				return http.StatusNoContent, nil
+			}
+		}
+	}
+	if length > 0 {
+		if status, err := h.checkQuota(ctx, reqPath, length); err != nil {
+			return status, err
+		}
+	}
 	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
+		if errors.Is(err, ErrInsufficientStorage) {
+			return StatusInsufficientStorage, err
+		}
 		return http.StatusNotFound, err
 	}
-	_, copyErr := io.Copy(f, r.Body)
+	n, copyErr := io.Copy(f, body)
+	if copyErr == nil && extended && n != length {
+		copyErr = errInvalidMSDAVExt
+	}
 	fi, statErr := f.Stat()
 	closeErr := f.Close()
+	for _, err := range []error{copyErr, closeErr} {
+		if errors.Is(err, ErrInsufficientStorage) {
+			return StatusInsufficientStorage, err
+		}
+	}
 	// TODO(rost): Returning 405 Method Not Allowed might not be appropriate.
 	if copyErr != nil {
 		return http.StatusMethodNotAllowed, copyErr
@@ -287,60 +684,186 @@ func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request) (status int,
 		return http.StatusInternalServerError, err
 	}
 	w.Header().Set("ETag", etag)
+	if extended {
+		// The response is that of the PROPPATCH request.
+		pstats, err := patch(ctx, h.FileSystem, h.LockSystem, reqPath, patches)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		mw := h.newMultistatusWriter(w, r)
+		writeErr := mw.write(makePropstatResponse(h.HrefEscaping.escape(h.clientPrefix(r)+reqPath), pstats))
+		closeErr := mw.close()
+		if writeErr != nil {
+			return http.StatusInternalServerError, writeErr
+		}
+		if closeErr != nil {
+			return http.StatusInternalServerError, closeErr
+		}
+		return 0, nil
+	}
+	if !created {
+		return http.StatusNoContent, nil
+	}
 	return http.StatusCreated, nil
 }
 
-func (h *Handler) handleMkcol(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+// handlePartialPut writes the body of the PUT request r at the offset of
+// its Content-Range cr in the file reqPath.
+func (h *Handler) handlePartialPut(w http.ResponseWriter, r *http.Request, reqPath, cr string) (status int, err error) {
+	ctx := r.Context()
+	first, last, complete, err := parseContentRange(cr)
 	if err != nil {
-		return status, err
+		return http.StatusBadRequest, err
+	}
+	n := last - first + 1
+	if r.ContentLength >= 0 && r.ContentLength != n {
+		return http.StatusBadRequest, errInvalidContentRange
+	}
+	var size int64
+	created := true
+	if fi, err := h.FileSystem.Stat(ctx, reqPath); err == nil {
+		if fi.IsDir() {
+			return http.StatusMethodNotAllowed, errNotAFile
+		}
+		size, created = fi.Size(), false
+	}
+	if first > size {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		return http.StatusRequestedRangeNotSatisfiable, errRangeNotSatisfiable
+	}
+	if end := last + 1; end > size {
+		if status, err := h.checkQuota(ctx, reqPath, end); err != nil {
+			return status, err
+		}
+	}
+	if complete >= 0 && size > complete {
+		// The file already exceeds the length the client intends.
+		return http.StatusBadRequest, errInvalidContentRange
+	}
+
+	f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		if errors.Is(err, ErrInsufficientStorage) {
+			return StatusInsufficientStorage, err
+		}
+		return http.StatusNotFound, err
+	}
+	_, seekErr := f.Seek(first, io.SeekStart)
+	var copyErr error
+	if seekErr == nil {
+		var written int64
+		written, copyErr = io.Copy(f, io.LimitReader(r.Body, n))
+		if copyErr == nil && written != n {
+			copyErr = errInvalidContentRange
+		}
+	}
+	fi, statErr := f.Stat()
+	closeErr := f.Close()
+	for _, err := range []error{copyErr, closeErr} {
+		if errors.Is(err, ErrInsufficientStorage) {
+			return StatusInsufficientStorage, err
+		}
+	}
+	if copyErr == errInvalidContentRange {
+		return http.StatusBadRequest, copyErr
+	}
+	for _, err := range []error{seekErr, copyErr, statErr, closeErr} {
+		if err != nil {
+			return http.StatusMethodNotAllowed, err
+		}
+	}
+	etag, err := findETag(ctx, h.FileSystem, h.LockSystem, reqPath, fi)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("ETag", etag)
+	if created {
+		return http.StatusCreated, nil
+	}
+	return http.StatusNoContent, nil
+}
+
+// parseContentRange parses the Content-Range header of a partial PUT,
+// such as "bytes 0-99/1000", and returns its first and last byte
+// positions, and its complete length, -1 if unknown ("*").
+//
+// See https://www.rfc-editor.org/rfc/rfc9110#section-14.4
+func parseContentRange(s string) (first, last, complete int64, err error) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, 0, errInvalidContentRange
+	}
+	s = strings.TrimPrefix(s, "bytes ")
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, 0, 0, errInvalidContentRange
+	}
+	rng, length := s[:i], s[i+1:]
+	j := strings.IndexByte(rng, '-')
+	if j < 0 {
+		return 0, 0, 0, errInvalidContentRange
+	}
+	first, err1 := parseDigits(rng[:j])
+	last, err2 := parseDigits(rng[j+1:])
+	if err1 != nil || err2 != nil || last < first {
+		return 0, 0, 0, errInvalidContentRange
+	}
+	complete = -1
+	if length != "*" {
+		if complete, err = parseDigits(length); err != nil || complete <= last {
+			return 0, 0, 0, errInvalidContentRange
+		}
 	}
+	return first, last, complete, nil
+}
+
+// parseDigits parses the non-negative decimal number s, which has neither
+// a sign nor white space.
+func parseDigits(s string) (int64, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, errInvalidContentRange
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func (h *Handler) handleMkcol(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath := req.Request, req.Path
 	release, status, err := h.confirmLocks(r, reqPath, "")
 	if err != nil {
 		return status, err
 	}
 	defer release()
+	if status, err := h.checkPreconditions(r, reqPath); err != nil {
+		return status, err
+	}
 
 	ctx := r.Context()
 
 	if r.ContentLength > 0 {
 		return http.StatusUnsupportedMediaType, nil
 	}
+	if status, err := h.checkQuota(ctx, reqPath, -1); err != nil {
+		return status, err
+	}
 	if err := h.FileSystem.Mkdir(ctx, reqPath, 0777); err != nil {
 		if os.IsNotExist(err) {
 			return http.StatusConflict, err
 		}
+		if errors.Is(err, ErrInsufficientStorage) {
+			return StatusInsufficientStorage, err
+		}
 		return http.StatusMethodNotAllowed, err
 	}
 	return http.StatusCreated, nil
 }
 
-func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	hdr := r.Header.Get("Destination")
-	if hdr == "" {
-		return http.StatusBadRequest, errInvalidDestination
-	}
-	u, err := url.Parse(hdr)
-	if err != nil {
-		return http.StatusBadRequest, errInvalidDestination
-	}
-	if u.Host != "" && u.Host != r.Host {
-		return http.StatusBadGateway, errInvalidDestination
-	}
-
-	src, status, err := h.stripPrefix(r.URL.Path)
-	if err != nil {
-		return status, err
-	}
-
-	dst, status, err := h.stripPrefix(u.Path)
-	if err != nil {
-		return status, err
-	}
-
+func (h *Handler) handleCopyMove(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, src, dst := req.Request, req.Path, req.Destination
 	if dst == "" {
 		return http.StatusBadGateway, errInvalidDestination
 	}
+	if dh := req.DestinationHandler; dh != nil && dh != h {
+		return h.handleTransfer(req, dh)
+	}
 	if dst == src {
 		return http.StatusForbidden, errDestinationEqualsSource
 	}
@@ -358,19 +881,14 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 			return status, err
 		}
 		defer release()
-
-		// Section 9.8.3 says that "The COPY method on a collection without a Depth
-		// header must act as if a Depth header with value "infinity" was included".
-		depth := infiniteDepth
-		if hdr := r.Header.Get("Depth"); hdr != "" {
-			depth = parseDepth(hdr)
-			if depth != 0 && depth != infiniteDepth {
-				// Section 9.8.3 says that "A client may submit a Depth header on a
-				// COPY on a collection with a value of "0" or "infinity"."
-				return http.StatusBadRequest, errInvalidDepth
-			}
+		defer h.PropCache.Forget(dst)
+		if req.inputErr != nil {
+			return req.inputStatus, req.inputErr
+		}
+		if status, err := h.checkPreconditions(r, src); err != nil {
+			return status, err
 		}
-		return copyFiles(ctx, h.FileSystem, src, dst, r.Header.Get("Overwrite") != "F", depth, 0)
+		return copyFiles(ctx, h.FileSystem, src, dst, req.Overwrite, req.Depth, 0)
 	}
 
 	release, status, err := h.confirmLocks(r, src, dst)
@@ -378,71 +896,73 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) (status
 		return status, err
 	}
 	defer release()
-
-	// Section 9.9.2 says that "The MOVE method on a collection must act as if
-	// a "Depth: infinity" header was used on it. A client must not submit a
-	// Depth header on a MOVE on a collection with any value but "infinity"."
-	if hdr := r.Header.Get("Depth"); hdr != "" {
-		if parseDepth(hdr) != infiniteDepth {
-			return http.StatusBadRequest, errInvalidDepth
-		}
+	defer h.PropCache.Forget(src)
+	defer h.PropCache.Forget(dst)
+	if req.inputErr != nil {
+		return req.inputStatus, req.inputErr
 	}
-	return moveFiles(ctx, h.FileSystem, src, dst, r.Header.Get("Overwrite") == "T")
-}
-
-func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus int, retErr error) {
-	duration, err := parseTimeout(r.Header.Get("Timeout"))
-	if err != nil {
-		return http.StatusBadRequest, err
-	}
-	li, status, err := readLockInfo(r.Body)
-	if err != nil {
+	if status, err := h.checkPreconditions(r, src); err != nil {
 		return status, err
 	}
+	return moveFiles(ctx, h.FileSystem, src, dst, req.Overwrite)
+}
 
+func (h *Handler) handleLock(w http.ResponseWriter, req *Request) (retStatus int, retErr error) {
+	r, li, duration := req.Request, req.lockInfo, req.Timeout
 	ctx := r.Context()
 	token, ld, now, created := "", LockDetails{}, time.Now(), false
-	if li == (lockInfo{}) {
-		// An empty lockInfo means to refresh the lock.
-		ih, ok := parseIfHeader(r.Header.Get("If"))
-		if !ok {
-			return http.StatusBadRequest, errInvalidIfHeader
-		}
-		if len(ih.lists) == 1 && len(ih.lists[0].conditions) == 1 {
-			token = ih.lists[0].conditions[0].Token
-		}
-		if token == "" {
-			return http.StatusBadRequest, errInvalidLockToken
+	var err error
+	refreshed := false
+	if li == (lockInfo{}) || req.LockToken != "" {
+		// A refresh changes no resource. A lock that is created is
+		// checked again below, once it is held.
+		if status, err := h.checkPreconditions(r, req.Path); err != nil {
+			return status, err
 		}
-		ld, err = h.LockSystem.Refresh(now, token, duration)
+	}
+	if li != (lockInfo{}) && req.LockToken != "" {
+		// With OfficeCompatible, a lock of the resource whose token is
+		// in the If header is refreshed, rather than locked again. It is
+		// confirmed first, so that the lock of another resource is not
+		// refreshed.
+		release, err := h.LockSystem.Confirm(now, req.Path, "", Condition{Token: req.LockToken})
 		if err != nil {
-			if err == ErrNoSuchLock {
+			if err == ErrConfirmationFailed {
 				return http.StatusPreconditionFailed, err
 			}
 			return http.StatusInternalServerError, err
 		}
-
-	} else {
-		// Section 9.10.3 says that "If no Depth header is submitted on a LOCK request,
-		// then the request MUST act as if a "Depth:infinity" had been submitted."
-		depth := infiniteDepth
-		if hdr := r.Header.Get("Depth"); hdr != "" {
-			depth = parseDepth(hdr)
-			if depth != 0 && depth != infiniteDepth {
-				// Section 9.10.3 says that "Values other than 0 or infinity must not be
-				// used with the Depth header on a LOCK method".
-				return http.StatusBadRequest, errInvalidDepth
+		release()
+		ld, err = h.LockSystem.Refresh(now, req.LockToken, duration)
+		if err != nil {
+			if err == ErrNoSuchLock {
+				return http.StatusPreconditionFailed, err
 			}
+			return http.StatusInternalServerError, err
 		}
-		reqPath, status, err := h.stripPrefix(r.URL.Path)
+		token, refreshed = req.LockToken, true
+	}
+	switch {
+	case refreshed:
+		// The lock of the If header was refreshed above.
+	case li == (lockInfo{}):
+		// An empty lockInfo means to refresh the lock.
+		token = req.LockToken
+		ld, err = h.LockSystem.Refresh(now, token, duration)
 		if err != nil {
-			return status, err
+			if err == ErrNoSuchLock {
+				return http.StatusPreconditionFailed, err
+			}
+			return http.StatusInternalServerError, err
 		}
+		refreshed = true
+	default:
+		reqPath := req.Path
 		ld = LockDetails{
 			Root:      reqPath,
 			Duration:  duration,
 			OwnerXML:  li.Owner.InnerXML,
-			ZeroDepth: depth == 0,
+			ZeroDepth: req.Depth == 0,
 		}
 		token, err = h.LockSystem.Create(now, ld)
 		if err != nil {
@@ -456,12 +976,18 @@ func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus
 				h.LockSystem.Unlock(now, token)
 			}
 		}()
+		if status, err := h.checkPreconditions(r, reqPath); err != nil {
+			return status, err
+		}
 
 		// Create the resource if it didn't previously exist.
 		if _, err := h.FileSystem.Stat(ctx, reqPath); err != nil {
 			f, err := h.FileSystem.OpenFile(ctx, reqPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 			if err != nil {
 				// TODO: detect missing intermediate dirs and return http.StatusConflict?
+				if h.OfficeCompatible && os.IsNotExist(err) {
+					return http.StatusConflict, err
+				}
 				return http.StatusInternalServerError, err
 			}
 			f.Close()
@@ -472,6 +998,9 @@ func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus
 		// Lock-Token value is a Coded-URL. We add angle brackets.
 		w.Header().Set("Lock-Token", "<"+token+">")
 	}
+	if refreshed && h.OfficeCompatible {
+		w.Header().Set("Lock-Token", "<"+token+">")
+	}
 
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	if created {
@@ -484,16 +1013,8 @@ func (h *Handler) handleLock(w http.ResponseWriter, r *http.Request) (retStatus
 	return 0, nil
 }
 
-func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
-	// Lock-Token value is a Coded-URL. We strip its angle brackets.
-	t := r.Header.Get("Lock-Token")
-	if len(t) < 2 || t[0] != '<' || t[len(t)-1] != '>' {
-		return http.StatusBadRequest, errInvalidLockToken
-	}
-	t = t[1 : len(t)-1]
-
-	switch err = h.LockSystem.Unlock(time.Now(), t); err {
+func (h *Handler) handleUnlock(w http.ResponseWriter, req *Request) (status int, err error) {
+	switch err = h.LockSystem.Unlock(time.Now(), req.LockToken); err {
 	case nil:
 		return http.StatusNoContent, err
 	case ErrForbidden:
@@ -507,11 +1028,8 @@ func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) (status i
 	}
 }
 
-func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
-	if err != nil {
-		return status, err
-	}
+func (h *Handler) handlePropfind(w http.ResponseWriter, req *Request) (status int, err error) {
+	r, reqPath, depth, pf := req.Request, req.Path, req.Depth, req.propfind
 	ctx := r.Context()
 	fi, err := h.FileSystem.Stat(ctx, reqPath)
 	if err != nil {
@@ -520,24 +1038,31 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status
 		}
 		return http.StatusMethodNotAllowed, err
 	}
-	depth := infiniteDepth
-	if hdr := r.Header.Get("Depth"); hdr != "" {
-		depth = parseDepth(hdr)
-		if depth == invalidDepth {
-			return http.StatusBadRequest, errInvalidDepth
-		}
+	if req.inputErr != nil {
+		return req.inputStatus, req.inputErr
 	}
-	pf, status, err := readPropfind(r.Body)
-	if err != nil {
-		return status, err
+	if p := h.contentTypePolicy(); p != nil {
+		ctx = context.WithValue(ctx, contentTypePolicyKey{}, p)
+	}
+	if h.PreviewNamespace != "" {
+		ctx = context.WithValue(ctx, previewNamespaceKey{}, h.PreviewNamespace)
 	}
+	prefs := parsePrefer(r.Header["Prefer"])
+	if depth == 0 {
+		prefs.depthNoRoot = false
+	}
+	prefs.apply(w)
+	root := reqPath
 
-	mw := multistatusWriter{w: w}
+	mw := h.newMultistatusWriter(w, r)
 
 	walkFn := func(reqPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return handlePropfindError(err, info)
 		}
+		if prefs.depthNoRoot && reqPath == root {
+			return nil
+		}
 
 		var pstats []Propstat
 		if pf.Propname != nil {
@@ -558,14 +1083,21 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status
 		if err != nil {
 			return handlePropfindError(err, info)
 		}
-		href := path.Join(h.Prefix, reqPath)
+		if prefs.returnMinimal {
+			pstats = omitNotFound(pstats)
+		}
+		href := path.Join(h.clientPrefix(r), reqPath)
 		if href != "/" && info.IsDir() {
 			href += "/"
 		}
-		return mw.write(makePropstatResponse(href, pstats))
+		return mw.write(makePropstatResponse(h.HrefEscaping.escape(href), pstats))
 	}
 
 	walkErr := walkFS(ctx, h.FileSystem, depth, reqPath, fi, walkFn)
+	if walkErr == nil && prefs.depthNoRoot {
+		// Without the root, there may be no response at all.
+		walkErr = mw.writeHeader()
+	}
 	closeErr := mw.close()
 	if walkErr != nil {
 		return http.StatusInternalServerError, walkErr
@@ -576,48 +1108,84 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) (status
 	return 0, nil
 }
 
-func (h *Handler) handleProppatch(w http.ResponseWriter, r *http.Request) (status int, err error) {
-	reqPath, status, err := h.stripPrefix(r.URL.Path)
+func (h *Handler) handleProppatch(w http.ResponseWriter, req *Request) (status int, err error) {
+	r := req.Request
+	pstats, status, err := h.proppatch(req)
 	if err != nil {
 		return status, err
 	}
+	prefs := parsePrefer(r.Header["Prefer"])
+	prefs.depthNoRoot = false
+	if !allOK(pstats) {
+		prefs.returnMinimal = false
+	}
+	prefs.apply(w)
+	if prefs.returnMinimal {
+		// As allowed by RFC 8144, a successful PROPPATCH needs no
+		// multistatus body.
+		w.WriteHeader(http.StatusOK)
+		return 0, nil
+	}
+	mw := h.newMultistatusWriter(w, r)
+	writeErr := mw.write(makePropstatResponse(h.HrefEscaping.escape(h.clientPrefix(r)+req.Path), pstats))
+	closeErr := mw.close()
+	if writeErr != nil {
+		return http.StatusInternalServerError, writeErr
+	}
+	if closeErr != nil {
+		return http.StatusInternalServerError, closeErr
+	}
+	return 0, nil
+}
+
+// proppatch applies the Patches of req, returning their propstats.
+func (h *Handler) proppatch(req *Request) (pstats []Propstat, status int, err error) {
+	r, reqPath := req.Request, req.Path
 	release, status, err := h.confirmLocks(r, reqPath, "")
 	if err != nil {
-		return status, err
+		return nil, status, err
 	}
 	defer release()
+	defer h.PropCache.Forget(reqPath)
+	if status, err := h.checkPreconditions(r, reqPath); err != nil {
+		return nil, status, err
+	}
 
 	ctx := r.Context()
 
 	if _, err := h.FileSystem.Stat(ctx, reqPath); err != nil {
 		if os.IsNotExist(err) {
-			return http.StatusNotFound, err
+			return nil, http.StatusNotFound, err
 		}
-		return http.StatusMethodNotAllowed, err
+		return nil, http.StatusMethodNotAllowed, err
 	}
-	patches, status, err := readProppatch(r.Body)
-	if err != nil {
-		return status, err
+	if req.inputErr != nil {
+		return nil, req.inputStatus, req.inputErr
 	}
-	pstats, err := patch(ctx, h.FileSystem, h.LockSystem, reqPath, patches)
+	pstats, err = patch(ctx, h.FileSystem, h.LockSystem, reqPath, req.Patches)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, http.StatusInternalServerError, err
 	}
+	return pstats, 0, nil
+}
+
+// newMultistatusWriter returns the multistatus writer of the response w to
+// r, negotiating its representation if JSONMultistatus is set.
+func (h *Handler) newMultistatusWriter(w http.ResponseWriter, r *http.Request) multistatusWriter {
 	mw := multistatusWriter{w: w}
-	writeErr := mw.write(makePropstatResponse(r.URL.Path, pstats))
-	closeErr := mw.close()
-	if writeErr != nil {
-		return http.StatusInternalServerError, writeErr
+	if r.Method == "PROPFIND" {
+		mw.flushInterval = h.PropfindFlushInterval
 	}
-	if closeErr != nil {
-		return http.StatusInternalServerError, closeErr
+	if h.JSONMultistatus {
+		w.Header().Add("Vary", "Accept")
+		mw.json = prefersJSON(r.Header["Accept"])
 	}
-	return 0, nil
+	return mw
 }
 
 func makePropstatResponse(href string, pstats []Propstat) *response {
 	resp := response{
-		Href:     []string{(&url.URL{Path: href}).EscapedPath()},
+		Href:     []string{href},
 		Propstat: make([]propstat, 0, len(pstats)),
 	}
 	for _, p := range pstats {
@@ -630,11 +1198,38 @@ func makePropstatResponse(href string, pstats []Propstat) *response {
 			Prop:                p.Props,
 			ResponseDescription: p.ResponseDescription,
 			Error:               xmlErr,
+			code:                p.Status,
 		})
 	}
 	return &resp
 }
 
+// omitNotFound removes the propstats of the properties that were not
+// found from pstats, for a minimal PROPFIND response. If nothing is left,
+// it returns an empty 200 propstat so that the response stays valid.
+func omitNotFound(pstats []Propstat) []Propstat {
+	var kept []Propstat
+	for _, p := range pstats {
+		if p.Status != http.StatusNotFound {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		kept = append(kept, Propstat{Status: http.StatusOK})
+	}
+	return kept
+}
+
+// allOK reports whether every propstat of pstats has status 200.
+func allOK(pstats []Propstat) bool {
+	for _, p := range pstats {
+		if p.Status != http.StatusOK {
+			return false
+		}
+	}
+	return true
+}
+
 func handlePropfindError(err error, info os.FileInfo) error {
 	var skipResp error = nil
 	if info != nil && info.IsDir() {
@@ -676,7 +1271,7 @@ const (
 //   - MOVE accepts only "infinity", as per section 9.9.2.
 //   - LOCK accepts only "0" or "infinity", as per section 9.10.3.
 //
-// These constraints are enforced by the handleXxx methods.
+// These constraints are enforced by Handler.parseRequest.
 func parseDepth(s string) int {
 	switch s {
 	case "0":
@@ -689,6 +1284,62 @@ func parseDepth(s string) int {
 	return invalidDepth
 }
 
+// preferences holds the preferences of a Prefer header (RFC 7240) that
+// the Handler honors for PROPFIND and PROPPATCH, as defined by RFC 8144.
+type preferences struct {
+	returnMinimal bool // return=minimal
+	depthNoRoot   bool // depth-noroot
+}
+
+// parsePrefer parses the values of the Prefer headers of a request.
+// Preference parameters and unknown preferences are ignored, and so is
+// a repeated preference.
+func parsePrefer(values []string) preferences {
+	var p preferences
+	seen := make(map[string]bool)
+	for _, v := range values {
+		for _, pref := range strings.Split(v, ",") {
+			if i := strings.IndexByte(pref, ';'); i >= 0 {
+				pref = pref[:i]
+			}
+			pref = strings.ToLower(strings.Join(strings.Fields(pref), ""))
+			name := pref
+			if i := strings.IndexByte(pref, '='); i >= 0 {
+				name = pref[:i]
+			}
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			switch pref {
+			case "return=minimal", `return="minimal"`:
+				p.returnMinimal = true
+			case "depth-noroot":
+				p.depthNoRoot = true
+			}
+		}
+	}
+	return p
+}
+
+// apply reports the preferences in effect in the Preference-Applied
+// header of w, and marks the response as varying with Prefer, whether or
+// not any applies.
+func (p preferences) apply(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Prefer")
+	var applied []string
+	if p.returnMinimal {
+		applied = append(applied, "return=minimal")
+	}
+	if p.depthNoRoot {
+		applied = append(applied, "depth-noroot")
+	}
+	if len(applied) == 0 {
+		return
+	}
+	w.Header().Set("Preference-Applied", strings.Join(applied, ", "))
+}
+
 // http://www.webdav.org/specs/rfc4918.html#status.code.extensions.to.http11
 const (
 	StatusMulti               = 207
@@ -717,6 +1368,8 @@ func StatusText(code int) string {
 var (
 	errDestinationEqualsSource = errors.New("webdav: destination equals source")
 	errDirectoryNotEmpty       = errors.New("webdav: directory not empty")
+	errInvalidBulk             = errors.New("webdav: invalid bulk request")
+	errInvalidContentRange     = errors.New("webdav: invalid Content-Range")
 	errInvalidDepth            = errors.New("webdav: invalid depth")
 	errInvalidDestination      = errors.New("webdav: invalid destination")
 	errInvalidIfHeader         = errors.New("webdav: invalid If header")
@@ -729,7 +1382,10 @@ var (
 	errNoFileSystem            = errors.New("webdav: no file system")
 	errNoLockSystem            = errors.New("webdav: no lock system")
 	errNotADirectory           = errors.New("webdav: not a directory")
+	errNotAFile                = errors.New("webdav: not a file")
+	errPreconditionFailed      = errors.New("webdav: precondition failed")
 	errPrefixMismatch          = errors.New("webdav: prefix mismatch")
+	errRangeNotSatisfiable     = errors.New("webdav: range not satisfiable")
 	errRecursionTooDeep        = errors.New("webdav: recursion too deep")
 	errUnsupportedLockInfo     = errors.New("webdav: unsupported lock info")
 	errUnsupportedMethod       = errors.New("webdav: unsupported method")
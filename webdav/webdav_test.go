@@ -6,6 +6,8 @@ package webdav
 
 import (
 	"context"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
@@ -17,8 +19,11 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TODO: add tests to check XML responses with the expected prefix path
@@ -204,6 +209,372 @@ func TestPrefix(t *testing.T) {
 	}
 }
 
+func TestDestinationPolicy(t *testing.T) {
+	rewrite := func(r *http.Request, dst *url.URL) (*url.URL, error) {
+		// A reverse proxy serves the Handler under /public/ at
+		// dav.example.com.
+		if dst.Host != "dav.example.com" || !strings.HasPrefix(dst.Path, "/public/") {
+			return nil, errors.New("bad destination")
+		}
+		return &url.URL{Path: "/dav/" + strings.TrimPrefix(dst.Path, "/public/")}, nil
+	}
+	testCases := []struct {
+		desc       string
+		policy     DestinationPolicy
+		rewrite    func(*http.Request, *url.URL) (*url.URL, error)
+		dst        string
+		wantStatus int
+	}{
+		{"same host", DestinationSameHost, nil, "http://example.com/dav/b", http.StatusCreated},
+		{"path only", DestinationSameHost, nil, "/dav/b", http.StatusCreated},
+		{"other host", DestinationSameHost, nil, "http://other.example.com/dav/b", http.StatusBadGateway},
+		{"ignored host", DestinationIgnoreHost, nil, "http://other.example.com/dav/b", http.StatusCreated},
+		{"ignored host, other prefix", DestinationIgnoreHost, nil, "http://other.example.com/b", http.StatusNotFound},
+		{"rewritten", DestinationSameHost, rewrite, "https://dav.example.com/public/b", http.StatusCreated},
+		{"rejected by rewrite", DestinationIgnoreHost, rewrite, "http://example.com/dav/b", http.StatusBadGateway},
+		{"nil rewrite", DestinationSameHost, func(*http.Request, *url.URL) (*url.URL, error) { return nil, nil }, "/dav/b", http.StatusBadGateway},
+	}
+	ctx := context.Background()
+	for _, tc := range testCases {
+		for _, method := range []string{"COPY", "MOVE"} {
+			fs := NewMemFS()
+			f, err := fs.OpenFile(ctx, "/a", os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			h := &Handler{
+				Prefix:             "/dav",
+				FileSystem:         fs,
+				LockSystem:         NewMemLS(),
+				DestinationPolicy:  tc.policy,
+				RewriteDestination: tc.rewrite,
+			}
+			req := httptest.NewRequest(method, "http://example.com/dav/a", nil)
+			req.Header.Set("Destination", tc.dst)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("%s: %s: got status %d, want %d", tc.desc, method, rec.Code, tc.wantStatus)
+			}
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	ctx := context.Background()
+	newShare := func(prefix string, files ...string) *Handler {
+		fs := NewMemFS()
+		for _, name := range files {
+			if strings.HasSuffix(name, "/") {
+				if err := fs.Mkdir(ctx, name, 0777); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			f, err := fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte("content of " + name)); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+		return &Handler{Prefix: prefix, FileSystem: fs, LockSystem: NewMemLS()}
+	}
+	exists := func(h *Handler, name string) bool {
+		_, err := h.FileSystem.Stat(ctx, name)
+		return err == nil
+	}
+	serve := func(h *Handler, method, src, dst string) int {
+		req := httptest.NewRequest(method, "http://example.com"+src, nil)
+		req.Header.Set("Destination", dst)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	shares := &Shares{}
+	a := newShare("/a", "/f", "/d/", "/d/g")
+	b := newShare("/b", "/x")
+	ro := newShare("/b/ro")
+	a.Shares, b.Shares = shares, shares
+	shares.Register(a, b, ro)
+	shares.AllowTransfer = func(method string, src, dst *Handler) bool {
+		return dst != ro
+	}
+
+	if got := serve(a, "COPY", "/a/f", "/b/f"); got != http.StatusCreated {
+		t.Errorf("COPY /a/f to /b/f: got status %d, want %d", got, http.StatusCreated)
+	}
+	if !exists(a, "/f") || !exists(b, "/f") {
+		t.Errorf("COPY /a/f to /b/f: source exists: %t, destination exists: %t", exists(a, "/f"), exists(b, "/f"))
+	}
+	if got := serve(a, "MOVE", "/a/d", "/b/x"); got != http.StatusPreconditionFailed {
+		t.Errorf("MOVE /a/d to existing /b/x: got status %d, want %d", got, http.StatusPreconditionFailed)
+	}
+	if got := serve(a, "MOVE", "/a/d", "/b/d"); got != http.StatusCreated {
+		t.Errorf("MOVE /a/d to /b/d: got status %d, want %d", got, http.StatusCreated)
+	}
+	if exists(a, "/d") || !exists(b, "/d/g") {
+		t.Errorf("MOVE /a/d to /b/d: source exists: %t, destination exists: %t", exists(a, "/d"), exists(b, "/d/g"))
+	}
+	f, err := b.FileSystem.OpenFile(ctx, "/d/g", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "content of /d/g" {
+		t.Errorf("moved /b/d/g: got %q, %v, want %q", data, err, "content of /d/g")
+	}
+
+	// The longest prefix selects the destination share.
+	if got := serve(b, "COPY", "/b/x", "/b/ro/x"); got != http.StatusBadGateway {
+		t.Errorf("COPY /b/x to /b/ro/x: got status %d, want %d", got, http.StatusBadGateway)
+	}
+	if exists(ro, "/x") {
+		t.Errorf("COPY /b/x to /b/ro/x: denied transfer created the destination")
+	}
+
+	// Handlers without Shares do not transfer.
+	if got := serve(ro, "COPY", "/b/ro/x", "/a/x"); got != http.StatusNotFound {
+		t.Errorf("COPY from a Handler without Shares: got status %d, want %d", got, http.StatusNotFound)
+	}
+	shares.Unregister(b)
+	if got := serve(a, "COPY", "/a/f", "/b/g"); got != http.StatusNotFound {
+		t.Errorf("COPY to an unregistered Handler: got status %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	f, err := fs.OpenFile(ctx, "/a", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var order []string
+	var got *Request
+	h := &Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: NewMemLS(),
+		Middleware: []Middleware{
+			func(next MethodHandler) MethodHandler {
+				return func(w http.ResponseWriter, r *Request) (int, error) {
+					order = append(order, "outer")
+					if r.Method == "MOVE" {
+						return http.StatusForbidden, nil
+					}
+					return next(w, r)
+				}
+			},
+			func(next MethodHandler) MethodHandler {
+				return func(w http.ResponseWriter, r *Request) (int, error) {
+					order = append(order, "inner")
+					got = r
+					if r.Method == "COPY" {
+						r.Destination = "/c"
+					}
+					return next(w, r)
+				}
+			},
+		},
+	}
+
+	req := httptest.NewRequest("COPY", "http://example.com/dav/a", nil)
+	req.Header.Set("Destination", "/dav/b")
+	req.Header.Set("Depth", "0")
+	req.Header.Set("If", "(<opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>) (Not <urn:x>)")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("COPY with an unknown lock: got status %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	if got == nil {
+		t.Fatal("COPY: middleware not called")
+	}
+	if got.Path != "/a" || got.Depth != 0 || !got.Overwrite {
+		t.Errorf("COPY: got Path %q, Depth %d, Overwrite %t; want \"/a\", 0, true", got.Path, got.Depth, got.Overwrite)
+	}
+	wantTokens := []string{"opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "urn:x"}
+	if !reflect.DeepEqual(got.LockTokens, wantTokens) {
+		t.Errorf("COPY: got LockTokens %q, want %q", got.LockTokens, wantTokens)
+	}
+
+	req = httptest.NewRequest("COPY", "http://example.com/dav/a", nil)
+	req.Header.Set("Destination", "/dav/b")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("COPY: got status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if got.Depth != DepthInfinity {
+		t.Errorf("COPY: got Depth %d, want DepthInfinity", got.Depth)
+	}
+	if _, err := fs.Stat(ctx, "/c"); err != nil {
+		t.Errorf("COPY to the rewritten destination: %v", err)
+	}
+	if _, err := fs.Stat(ctx, "/b"); err == nil {
+		t.Errorf("COPY to the original destination: /b exists")
+	}
+
+	order = nil
+	req = httptest.NewRequest("MOVE", "http://example.com/dav/a", nil)
+	req.Header.Set("Destination", "/dav/b")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("MOVE: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if !reflect.DeepEqual(order, []string{"outer"}) {
+		t.Errorf("MOVE: middlewares called %v, want [outer]", order)
+	}
+
+	order = nil
+	req = httptest.NewRequest("PROPFIND", "http://example.com/dav/a", nil)
+	req.Header.Set("Depth", "2")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !reflect.DeepEqual(order, []string{"outer", "inner"}) {
+		t.Errorf("PROPFIND with an invalid depth: got status %d and middlewares called %v, want %d and [outer inner]", rec.Code, order, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest("PROPPATCH", "http://example.com/dav/a", strings.NewReader(`<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><Z:author xmlns:Z="http://ns.example.com/z/">A</Z:author></D:prop></D:set></D:propertyupdate>`))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != StatusMulti {
+		t.Errorf("PROPPATCH: got status %d, want %d", rec.Code, StatusMulti)
+	}
+	if len(got.Patches) != 1 || len(got.Patches[0].Props) != 1 || got.Patches[0].Props[0].InnerXML == nil {
+		t.Errorf("PROPPATCH: got Patches %+v, want one property set", got.Patches)
+	}
+}
+
+func TestInputErrorPrecedence(t *testing.T) {
+	h := &Handler{FileSystem: NewMemFS(), LockSystem: NewMemLS()}
+	ls := h.LockSystem
+	if _, err := ls.Create(time.Now(), LockDetails{Root: "/locked", Duration: infiniteTimeout, ZeroDepth: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.FileSystem.Mkdir(context.Background(), "/dir", 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		method, target, body string
+		hdr                  []string
+		want                 int
+	}{
+		{"PROPFIND", "/missing", "", []string{"Depth", "2"}, http.StatusNotFound},
+		{"PROPFIND", "/missing", "<bad", nil, http.StatusNotFound},
+		{"PROPFIND", "/dir", "", []string{"Depth", "2"}, http.StatusBadRequest},
+		{"PROPPATCH", "/missing", "<bad", nil, http.StatusNotFound},
+		{"PROPPATCH", "/locked", "<bad", nil, StatusLocked},
+		{"PROPPATCH", "/dir", "<bad", nil, http.StatusBadRequest},
+		{"COPY", "/dir", "", []string{"Destination", "/locked", "Depth", "1"}, StatusLocked},
+		{"MOVE", "/dir", "", []string{"Destination", "/locked", "Depth", "0"}, StatusLocked},
+		{"COPY", "/dir", "", []string{"Destination", "/dir2", "Depth", "1"}, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		for i := 0; i < len(tt.hdr); i += 2 {
+			r.Header.Set(tt.hdr[i], tt.hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s %v: status %d, want %d", tt.method, tt.target, tt.hdr, w.Code, tt.want)
+		}
+	}
+}
+
+func TestInvalidLockToken(t *testing.T) {
+	h := &Handler{
+		FileSystem: NewMemFS(),
+		LockSystem: NewMemLS(),
+	}
+	for _, tc := range []struct {
+		method, header, value string
+		wantStatus            int
+	}{
+		{"UNLOCK", "Lock-Token", "<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>", http.StatusBadRequest},
+		{"UNLOCK", "Lock-Token", "<opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>", http.StatusConflict},
+		{"LOCK", "If", "(<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>)", http.StatusBadRequest},
+		{"LOCK", "If", "(<opaquelocktoken:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>)", http.StatusPreconditionFailed},
+		{"PUT", "If", "(<urn:uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6>)", http.StatusPreconditionFailed},
+	} {
+		req := httptest.NewRequest(tc.method, "http://example.com/a", nil)
+		req.Header.Set(tc.header, tc.value)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s with %s %s: got status %d, want %d", tc.method, tc.header, tc.value, rec.Code, tc.wantStatus)
+		}
+	}
+}
+
+func TestDirectoryIndex(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	if err := fs.Mkdir(ctx, "/d", 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/d/b.txt", "/d/a&b.txt"} {
+		f, err := fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if err := fs.Mkdir(ctx, "/d/c", 0777); err != nil {
+		t.Fatal(err)
+	}
+	get := func(h *Handler, method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	h := &Handler{FileSystem: fs, LockSystem: NewMemLS()}
+	if rec := get(h, "GET", "/d/"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("without DirectoryIndex: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	h.DirectoryIndex = HTMLDirectoryIndex
+	if rec := get(h, "GET", "/d?x=1"); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/d/?x=1" {
+		t.Errorf("GET /d: got status %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	rec := get(h, "GET", "/d/")
+	want := "<pre>\n" +
+		"<a href=\"./a&amp;b.txt\">a&amp;b.txt</a>\n" +
+		"<a href=\"./b.txt\">b.txt</a>\n" +
+		"<a href=\"./c/\">c/</a>\n" +
+		"</pre>\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("HTML index: got status %d, body\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+	if rec := get(h, "POST", "/d/"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	h.DirectoryIndex = JSONDirectoryIndex
+	rec = get(h, "GET", "/d/")
+	var entries []struct {
+		Name  string
+		IsDir bool
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("JSON index: %v in %s", err, rec.Body)
+	}
+	if len(entries) != 3 || entries[0].Name != "a&b.txt" || entries[2].Name != "c" || !entries[2].IsDir {
+		t.Errorf("JSON index: got %+v", entries)
+	}
+}
+
 func TestEscapeXML(t *testing.T) {
 	// These test cases aren't exhaustive, and there is more than one way to
 	// escape e.g. a quot (as "&#34;" or "&quot;") or an apos. We presume that
@@ -347,3 +718,1050 @@ func TestFilenameEscape(t *testing.T) {
 		}
 	}
 }
+
+func TestHrefEscaping(t *testing.T) {
+	testCases := []struct {
+		path                 string
+		def, strict, minimal string
+	}{
+		{"/a/b/", "/a/b/", "/a/b/", "/a/b/"},
+		{"/foo%bar", "/foo%25bar", "/foo%25bar", "/foo%25bar"},
+		{"/go+lang&co=1,2", "/go+lang&co=1,2", "/go%2Blang%26co%3D1%2C2", "/go+lang&co=1,2"},
+		{"/it's (1)!", "/it%27s%20%281%29%21", "/it%27s%20%281%29%21", "/it's%20(1)!"},
+		{"/a:b@c~d", "/a:b@c~d", "/a%3Ab%40c~d", "/a:b@c~d"},
+		{"/q?#[x]", "/q%3F%23%5Bx%5D", "/q%3F%23%5Bx%5D", "/q%3F%23[x]"},
+		{"/世界", "/%E4%B8%96%E7%95%8C", "/%E4%B8%96%E7%95%8C", "/世界"},
+		{"/bad\xff\x7f", "/bad%FF%7F", "/bad%FF%7F", "/bad%FF%7F"},
+	}
+	for _, tc := range testCases {
+		for _, e := range []struct {
+			e    HrefEscaping
+			want string
+		}{
+			{HrefEscapeDefault, tc.def},
+			{HrefEscapeStrict, tc.strict},
+			{HrefEscapeMinimal, tc.minimal},
+		} {
+			if got := e.e.escape(tc.path); got != e.want {
+				t.Errorf("HrefEscaping(%d).escape(%q) = %q, want %q", e.e, tc.path, got, e.want)
+			}
+		}
+	}
+}
+
+func TestParsePrefer(t *testing.T) {
+	testCases := []struct {
+		values []string
+		want   preferences
+	}{
+		{nil, preferences{}},
+		{[]string{"return=minimal"}, preferences{returnMinimal: true}},
+		{[]string{"Return = \"minimal\"; foo=bar"}, preferences{returnMinimal: true}},
+		{[]string{"respond-async, depth-noroot"}, preferences{depthNoRoot: true}},
+		{[]string{"return=representation", "return=minimal"}, preferences{}},
+		{[]string{"depth-noroot", "return=minimal"}, preferences{returnMinimal: true, depthNoRoot: true}},
+	}
+	for _, tc := range testCases {
+		if got := parsePrefer(tc.values); got != tc.want {
+			t.Errorf("parsePrefer(%q) = %+v, want %+v", tc.values, got, tc.want)
+		}
+	}
+}
+
+func TestPrefer(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	if err := fs.Mkdir(ctx, "/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile(ctx, "/dir/file", os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	srv := httptest.NewServer(&Handler{
+		FileSystem: fs,
+		LockSystem: NewMemLS(),
+	})
+	defer srv.Close()
+
+	do := func(method, path, body string, headers ...string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(headers) >= 2 {
+			req.Header.Add(headers[0], headers[1])
+			headers = headers[2:]
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(b)
+	}
+
+	const propfindBody = `<?xml version="1.0" encoding="utf-8" ?>
+		<D:propfind xmlns:D="DAV:"><D:prop>
+			<D:getcontentlength/><D:bogus/>
+		</D:prop></D:propfind>`
+
+	res, body := do("PROPFIND", "/dir/", propfindBody, "Depth", "1")
+	if !strings.Contains(body, "404") || !strings.Contains(body, "<D:href>/dir/</D:href>") {
+		t.Errorf("PROPFIND without Prefer: want the root and a 404 propstat, got:\n%s", body)
+	}
+	if got := res.Header.Get("Preference-Applied"); got != "" {
+		t.Errorf("PROPFIND without Prefer: Preference-Applied = %q, want none", got)
+	}
+	if got := res.Header.Get("Vary"); got != "Prefer" {
+		t.Errorf("PROPFIND without Prefer: Vary = %q, want %q", got, "Prefer")
+	}
+
+	res, body = do("PROPFIND", "/dir/", propfindBody, "Depth", "1", "Prefer", "return=minimal, depth-noroot")
+	if res.StatusCode != StatusMulti {
+		t.Fatalf("minimal PROPFIND: status %d, want %d", res.StatusCode, StatusMulti)
+	}
+	if strings.Contains(body, "404") || strings.Contains(body, "<D:href>/dir/</D:href>") {
+		t.Errorf("minimal PROPFIND: want neither the root nor a 404 propstat, got:\n%s", body)
+	}
+	if !strings.Contains(body, "<D:href>/dir/file</D:href>") {
+		t.Errorf("minimal PROPFIND: want a response for /dir/file, got:\n%s", body)
+	}
+	if got, want := res.Header.Get("Preference-Applied"), "return=minimal, depth-noroot"; got != want {
+		t.Errorf("minimal PROPFIND: Preference-Applied = %q, want %q", got, want)
+	}
+	if got := res.Header.Get("Vary"); got != "Prefer" {
+		t.Errorf("minimal PROPFIND: Vary = %q, want %q", got, "Prefer")
+	}
+
+	res, body = do("PROPFIND", "/dir/file", propfindBody, "Depth", "0", "Prefer", "depth-noroot")
+	if !strings.Contains(body, "<D:href>/dir/file</D:href>") {
+		t.Errorf("PROPFIND with depth 0: want the root despite depth-noroot, got:\n%s", body)
+	}
+	if got := res.Header.Get("Preference-Applied"); got != "" {
+		t.Errorf("PROPFIND with depth 0: Preference-Applied = %q, want none", got)
+	}
+
+	const proppatchBody = `<?xml version="1.0" encoding="utf-8" ?>
+		<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://ns.example.com/z/">
+			<D:set><D:prop><Z:author>Jim</Z:author></D:prop></D:set>
+		</D:propertyupdate>`
+
+	res, body = do("PROPPATCH", "/dir/file", proppatchBody, "Prefer", "return=minimal")
+	if res.StatusCode != http.StatusOK || body != "" {
+		t.Errorf("minimal PROPPATCH: got status %d and body %q, want 200 and no body", res.StatusCode, body)
+	}
+	if got := res.Header.Get("Preference-Applied"); got != "return=minimal" {
+		t.Errorf("minimal PROPPATCH: Preference-Applied = %q, want %q", got, "return=minimal")
+	}
+
+	res, _ = do("PROPPATCH", "/dir/file", proppatchBody)
+	if res.StatusCode != StatusMulti {
+		t.Errorf("PROPPATCH without Prefer: status %d, want %d", res.StatusCode, StatusMulti)
+	}
+	if got := res.Header.Get("Vary"); got != "Prefer" {
+		t.Errorf("PROPPATCH without Prefer: Vary = %q, want %q", got, "Prefer")
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	testCases := []struct {
+		accept []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"application/json"}, true},
+		{[]string{"Application/JSON; charset=utf-8"}, true},
+		{[]string{"text/xml, application/json"}, false},
+		{[]string{"text/xml;q=0.5, application/json"}, true},
+		{[]string{"application/json;q=0", "*/*"}, false},
+		{[]string{"text/html", "application/json;q=0.1"}, true},
+	}
+	for _, tc := range testCases {
+		if got := prefersJSON(tc.accept); got != tc.want {
+			t.Errorf("prefersJSON(%q) = %t, want %t", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestJSONMultistatus(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	if err := fs.Mkdir(ctx, "/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&Handler{
+		FileSystem:      fs,
+		LockSystem:      NewMemLS(),
+		JSONMultistatus: true,
+	})
+	defer srv.Close()
+
+	do := func(method, body, accept string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+"/dir/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Depth", "0")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, b
+	}
+
+	const propfindBody = `<?xml version="1.0" encoding="utf-8" ?>
+		<D:propfind xmlns:D="DAV:"><D:prop>
+			<D:displayname/><D:resourcetype/><D:bogus/>
+		</D:prop></D:propfind>`
+
+	res, _ := do("PROPFIND", propfindBody, "")
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/xml") {
+		t.Errorf("PROPFIND without Accept: Content-Type = %q, want XML", ct)
+	}
+	if got, want := res.Header.Values("Vary"), []string{"Prefer", "Accept"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PROPFIND without Accept: Vary = %q, want %q", got, want)
+	}
+
+	res, body := do("PROPFIND", propfindBody, "application/json")
+	if res.StatusCode != StatusMulti || res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("JSON PROPFIND: status %d, Content-Type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var ms struct {
+		Responses []jsonResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(body, &ms); err != nil {
+		t.Fatalf("JSON PROPFIND: %v in:\n%s", err, body)
+	}
+	want := []jsonResponse{{
+		Href: "/dir/",
+		Propstats: []jsonPropstat{{
+			Status: http.StatusOK,
+			Props: []jsonProperty{
+				{Namespace: "DAV:", Name: "displayname", Value: "dir"},
+				{Namespace: "DAV:", Name: "resourcetype", XML: `<D:collection xmlns:D="DAV:"/>`},
+			},
+		}, {
+			Status: http.StatusNotFound,
+			Props:  []jsonProperty{{Namespace: "DAV:", Name: "bogus"}},
+		}},
+	}}
+	if !reflect.DeepEqual(ms.Responses, want) {
+		t.Errorf("JSON PROPFIND:\ngot  %+v\nwant %+v", ms.Responses, want)
+	}
+
+	const proppatchBody = `<?xml version="1.0" encoding="utf-8" ?>
+		<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://ns.example.com/z/">
+			<D:set><D:prop><Z:author>Jim</Z:author></D:prop></D:set>
+		</D:propertyupdate>`
+	res, body = do("PROPPATCH", proppatchBody, "application/json")
+	ms.Responses = nil
+	if err := json.Unmarshal(body, &ms); err != nil {
+		t.Fatalf("JSON PROPPATCH: %v in:\n%s", err, body)
+	}
+	if len(ms.Responses) != 1 || len(ms.Responses[0].Propstats) != 1 || ms.Responses[0].Propstats[0].Status != http.StatusOK {
+		t.Errorf("JSON PROPPATCH: got %+v, want a 200 propstat", ms.Responses)
+	}
+}
+
+func TestBulk(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	for _, name := range []string{"/a", "/b", "/c", "/locked"} {
+		f, err := fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	var methods []string
+	srv := httptest.NewServer(&Handler{
+		Prefix:          "/dav",
+		FileSystem:      fs,
+		LockSystem:      NewMemLS(),
+		JSONMultistatus: true,
+		BulkPath:        "/.bulk",
+		Middleware: []Middleware{
+			func(next MethodHandler) MethodHandler {
+				return func(w http.ResponseWriter, r *Request) (int, error) {
+					methods = append(methods, r.Method)
+					if r.Path == "/locked" {
+						return http.StatusForbidden, nil
+					}
+					return next(w, r)
+				}
+			},
+		},
+	})
+	defer srv.Close()
+
+	do := func(body string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest("POST", srv.URL+"/dav/.bulk", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, b
+	}
+
+	res, body := do(`<?xml version="1.0" encoding="utf-8" ?>
+		<b:bulk xmlns:b="http://golang.org/x/net/webdav/bulk" xmlns:D="DAV:" xmlns:Z="http://ns.example.com/z/">
+			<b:proppatch><D:href>/dav/a</D:href><D:propertyupdate>
+				<D:set><D:prop><Z:author>Jim</Z:author></D:prop></D:set>
+			</D:propertyupdate></b:proppatch>
+			<b:delete><D:href>/dav/b</D:href></b:delete>
+			<b:delete><D:href>/dav/missing</D:href></b:delete>
+			<b:move><D:href>/dav/c</D:href><b:destination>/dav/d</b:destination></b:move>
+			<b:move><D:href>/dav/a</D:href><b:destination>/dav/d</b:destination><b:overwrite>F</b:overwrite></b:move>
+			<b:delete><D:href>/dav/locked</D:href></b:delete>
+		</b:bulk>`)
+	if res.StatusCode != StatusMulti {
+		t.Fatalf("status %d, want %d:\n%s", res.StatusCode, StatusMulti, body)
+	}
+	var ms struct {
+		Responses []jsonResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(body, &ms); err != nil {
+		t.Fatalf("%v in:\n%s", err, body)
+	}
+	want := []jsonResponse{{
+		Href: "/dav/a",
+		Propstats: []jsonPropstat{{
+			Status: http.StatusOK,
+			Props:  []jsonProperty{{Namespace: "http://ns.example.com/z/", Name: "author"}},
+		}},
+	}, {
+		Href: "/dav/b", Status: http.StatusNoContent,
+	}, {
+		Href: "/dav/missing", Status: http.StatusNotFound,
+	}, {
+		Href: "/dav/c", Status: http.StatusCreated,
+	}, {
+		Href: "/dav/a", Status: http.StatusPreconditionFailed,
+	}, {
+		Href: "/dav/locked", Status: http.StatusForbidden,
+	}}
+	if !reflect.DeepEqual(ms.Responses, want) {
+		t.Errorf("responses:\ngot  %+v\nwant %+v", ms.Responses, want)
+	}
+	if want := []string{"PROPPATCH", "DELETE", "DELETE", "MOVE", "MOVE", "DELETE"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("middleware methods: got %q, want %q", methods, want)
+	}
+	for name, exists := range map[string]bool{"/a": true, "/b": false, "/c": false, "/d": true, "/locked": true} {
+		if _, err := fs.Stat(ctx, name); (err == nil) != exists {
+			t.Errorf("Stat(%q): %v, want exists %t", name, err, exists)
+		}
+	}
+
+	for _, body := range []string{
+		`<b:bulk xmlns:b="http://golang.org/x/net/webdav/bulk"/>`,
+		`<b:bulk xmlns:b="http://golang.org/x/net/webdav/bulk"><b:copy><D:href xmlns:D="DAV:">/dav/a</D:href></b:copy></b:bulk>`,
+		`<b:bulk xmlns:b="http://golang.org/x/net/webdav/bulk"><b:delete><D:href xmlns:D="DAV:">/elsewhere</D:href></b:delete></b:bulk>`,
+	} {
+		if res, _ := do(body); res.StatusCode == StatusMulti {
+			t.Errorf("invalid bulk %s: status %d", body, res.StatusCode)
+		}
+	}
+}
+
+func TestPrefixFunc(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	if err := fs.Mkdir(ctx, "/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: NewMemLS(),
+		PrefixFunc: func(r *http.Request) string {
+			return r.Header.Get("X-Forwarded-Prefix") + "/dav"
+		},
+	})
+	defer srv.Close()
+
+	do := func(method, p, body string, hdr ...string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+p, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Forwarded-Prefix", "/public")
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(b)
+	}
+
+	_, body := do("PROPFIND", "/dav/", "", "Depth", "1")
+	for _, href := range []string{"<D:href>/public/dav/</D:href>", "<D:href>/public/dav/dir/</D:href>"} {
+		if !strings.Contains(body, href) {
+			t.Errorf("PROPFIND: missing %s in:\n%s", href, body)
+		}
+	}
+
+	_, body = do("PROPPATCH", "/dav/dir", `<?xml version="1.0" encoding="utf-8" ?>
+		<D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://ns.example.com/z/">
+			<D:set><D:prop><Z:author>Jim</Z:author></D:prop></D:set>
+		</D:propertyupdate>`)
+	if href := "<D:href>/public/dav/dir</D:href>"; !strings.Contains(body, href) {
+		t.Errorf("PROPPATCH: missing %s in:\n%s", href, body)
+	}
+
+	res, _ := do("MOVE", "/dav/dir", "", "Destination", srv.URL+"/public/dav/moved")
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("MOVE: status %d, want %d", res.StatusCode, http.StatusCreated)
+	}
+	if _, err := fs.Stat(ctx, "/moved"); err != nil {
+		t.Errorf("MOVE: %v", err)
+	}
+}
+
+// hashETagFS is a FileSystem whose ETags are the lengths of the contents of
+// its files, standing for hashes.
+type hashETagFS struct {
+	FileSystem
+}
+
+func (fs hashETagFS) ETag(ctx context.Context, name string, fi os.FileInfo) (string, error) {
+	if fi.IsDir() {
+		return "", ErrNotImplemented
+	}
+	return fmt.Sprintf(`"len-%d"`, fi.Size()), nil
+}
+
+func TestETagPreconditions(t *testing.T) {
+	srv := httptest.NewServer(&Handler{
+		FileSystem: hashETagFS{NewMemFS()},
+		LockSystem: NewMemLS(),
+	})
+	defer srv.Close()
+
+	do := func(method, p, body string, hdr ...string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+p, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		return res
+	}
+
+	for _, tt := range []struct {
+		method, hdr, val string
+		body             string
+		wantStatus       int
+		wantETag         string
+	}{
+		{"PUT", "If-Match", "*", "abc", http.StatusPreconditionFailed, ""},
+		{"PUT", "If-None-Match", "*", "abc", http.StatusCreated, `"len-3"`},
+		{"PUT", "If-None-Match", "*", "abcd", http.StatusPreconditionFailed, ""},
+		{"GET", "If-None-Match", `"len-3"`, "", http.StatusNotModified, `"len-3"`},
+		{"GET", "If-None-Match", `"other"`, "", http.StatusOK, `"len-3"`},
+		{"PUT", "If-Match", `"other", "len-3"`, "abcd", http.StatusCreated, `"len-4"`},
+		{"PUT", "If-Match", `W/"len-4"`, "abcde", http.StatusPreconditionFailed, ""},
+		{"DELETE", "If-None-Match", `W/"len-4"`, "", http.StatusPreconditionFailed, ""},
+		{"DELETE", "If-Match", `"len-4"`, "", http.StatusNoContent, ""},
+	} {
+		res := do(tt.method, "/f", tt.body, tt.hdr, tt.val)
+		if res.StatusCode != tt.wantStatus {
+			t.Errorf("%s with %s: %s: status %d, want %d", tt.method, tt.hdr, tt.val, res.StatusCode, tt.wantStatus)
+		}
+		if got := res.Header.Get("ETag"); tt.wantETag != "" && got != tt.wantETag {
+			t.Errorf("%s with %s: %s: ETag %s, want %s", tt.method, tt.hdr, tt.val, got, tt.wantETag)
+		}
+	}
+}
+
+// blockingLS is a LockSystem whose first Create waits for proceed to be
+// closed, after closing entered.
+type blockingLS struct {
+	LockSystem
+	mu      sync.Mutex
+	created bool
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func (ls *blockingLS) Create(now time.Time, details LockDetails) (string, error) {
+	ls.mu.Lock()
+	first := !ls.created
+	ls.created = true
+	ls.mu.Unlock()
+	if first {
+		close(ls.entered)
+		<-ls.proceed
+	}
+	return ls.LockSystem.Create(now, details)
+}
+
+func TestETagPreconditionsUnderLock(t *testing.T) {
+	ls := &blockingLS{
+		LockSystem: NewMemLS(),
+		entered:    make(chan struct{}),
+		proceed:    make(chan struct{}),
+	}
+	fs := hashETagFS{NewMemFS()}
+	h := &Handler{FileSystem: fs, LockSystem: ls}
+	f, err := fs.OpenFile(context.Background(), "/f", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("abc"))
+	f.Close()
+
+	put := func(body string) int {
+		r := httptest.NewRequest("PUT", "/f", strings.NewReader(body))
+		r.Header.Set("If-Match", `"len-3"`)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// The first PUT waits to lock the file while the second changes it.
+	// The ETag it matched is then stale, so it must not overwrite the
+	// change.
+	first := make(chan int)
+	go func() { first <- put("abcdef") }()
+	<-ls.entered
+	if code := put("abcd"); code != http.StatusCreated {
+		t.Fatalf("second PUT: status %d, want %d", code, http.StatusCreated)
+	}
+	close(ls.proceed)
+	if code := <-first; code != http.StatusPreconditionFailed {
+		t.Errorf("first PUT: status %d, want %d", code, http.StatusPreconditionFailed)
+	}
+}
+
+// A traceExchange is a request and its expected response, read from a
+// trace of testdata by readTrace.
+type traceExchange struct {
+	line       int
+	method     string
+	path       string
+	header     http.Header
+	body       string
+	wantStatus int
+	wantHeader http.Header
+	wantBody   *string
+}
+
+// readTrace reads the exchanges of the trace file name, whose format is
+// documented in testdata/office.trace.
+func readTrace(t *testing.T, name string) []traceExchange {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xs []traceExchange
+	var x *traceExchange
+	var body []string
+	// The state is 0 outside exchanges, 1 in the request headers, 2 in
+	// the request body and 3 in the response headers.
+	state := 0
+	for i, l := range strings.Split(string(b), "\n") {
+		switch {
+		case strings.HasPrefix(l, "#") && state != 2:
+			continue
+		case strings.HasPrefix(l, ">>> "):
+			f := strings.Fields(l[4:])
+			if len(f) != 2 {
+				t.Fatalf("%s:%d: bad request line %q", name, i+1, l)
+			}
+			xs = append(xs, traceExchange{
+				line:       i + 1,
+				method:     f[0],
+				path:       f[1],
+				header:     http.Header{},
+				wantHeader: http.Header{},
+			})
+			x, body, state = &xs[len(xs)-1], nil, 1
+		case strings.HasPrefix(l, "<<< ") && x != nil:
+			if x.wantStatus, err = strconv.Atoi(l[4:]); err != nil {
+				t.Fatalf("%s:%d: bad status line %q", name, i+1, l)
+			}
+			x.body, state = strings.Join(body, "\n"), 3
+		case state == 2:
+			body = append(body, l)
+		case l == "":
+			if state == 1 {
+				state = 2
+			} else {
+				state = 0
+			}
+		case state == 1 || state == 3:
+			j := strings.Index(l, ": ")
+			if j < 0 {
+				t.Fatalf("%s:%d: bad header %q", name, i+1, l)
+			}
+			k, v := l[:j], l[j+2:]
+			if state == 1 {
+				x.header.Add(k, v)
+			} else if k == "Body" {
+				want, err := strconv.Unquote(v)
+				if err != nil {
+					t.Fatalf("%s:%d: bad body %q", name, i+1, v)
+				}
+				x.wantBody = &want
+			} else {
+				x.wantHeader.Add(k, v)
+			}
+		default:
+			t.Fatalf("%s:%d: unexpected line %q", name, i+1, l)
+		}
+	}
+	return xs
+}
+
+func TestOfficeCompatible(t *testing.T) {
+	srv := httptest.NewServer(&Handler{
+		FileSystem:       NewMemFS(),
+		LockSystem:       NewMemLS(),
+		OfficeCompatible: true,
+	})
+	defer srv.Close()
+
+	const name = "testdata/office.trace"
+	token := ""
+	for _, x := range readTrace(t, name) {
+		desc := fmt.Sprintf("%s:%d: %s %s", name, x.line, x.method, x.path)
+		req, err := http.NewRequest(x.method, srv.URL+x.path, strings.NewReader(x.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, vs := range x.header {
+			for _, v := range vs {
+				req.Header.Add(k, strings.Replace(v, "TOKEN", token, -1))
+			}
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != x.wantStatus {
+			t.Fatalf("%s: status %d, want %d", desc, res.StatusCode, x.wantStatus)
+		}
+		for k := range x.wantHeader {
+			want, got := x.wantHeader.Get(k), res.Header.Get(k)
+			if token == "" && want == "<TOKEN>" && k == "Lock-Token" {
+				token = strings.Trim(got, "<>")
+			}
+			if want = strings.Replace(want, "TOKEN", token, -1); got != want {
+				t.Errorf("%s: %s header %q, want %q", desc, k, got, want)
+			}
+		}
+		if x.wantBody != nil && string(b) != *x.wantBody {
+			t.Errorf("%s: body %q, want %q", desc, b, *x.wantBody)
+		}
+	}
+	if token == "" {
+		t.Error("no lock token in the responses")
+	}
+}
+
+// refreshCountingLS is a LockSystem counting the locks refreshed.
+type refreshCountingLS struct {
+	LockSystem
+	refreshed int
+}
+
+func (ls *refreshCountingLS) Refresh(now time.Time, token string, duration time.Duration) (LockDetails, error) {
+	ls.refreshed++
+	return ls.LockSystem.Refresh(now, token, duration)
+}
+
+func TestOfficeCompatibleRefreshOtherLock(t *testing.T) {
+	ls := &refreshCountingLS{LockSystem: NewMemLS()}
+	h := &Handler{FileSystem: NewMemFS(), LockSystem: ls, OfficeCompatible: true}
+	const lockInfo = `<?xml version="1.0" encoding="utf-8" ?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	lock := func(p, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("LOCK", p, strings.NewReader(lockInfo))
+		if token != "" {
+			r.Header.Set("If", "(<"+token+">)")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w := lock("/a", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("LOCK /a: status %d, want %d", w.Code, http.StatusCreated)
+	}
+	token := strings.Trim(w.Header().Get("Lock-Token"), "<>")
+	if w := lock("/b", token); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("LOCK /b with the token of /a: status %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if ls.refreshed != 0 {
+		t.Errorf("%d locks refreshed, want 0", ls.refreshed)
+	}
+	if w := lock("/a", token); w.Code != http.StatusOK || ls.refreshed != 1 {
+		t.Errorf("LOCK /a with its token: status %d, %d locks refreshed; want %d, 1", w.Code, ls.refreshed, http.StatusOK)
+	}
+}
+
+// msdavextBody returns the extended body of the parts.
+func msdavextBody(parts ...string) string {
+	var b strings.Builder
+	for _, p := range parts {
+		fmt.Fprintf(&b, "%016x%s", len(p), p)
+	}
+	return b.String()
+}
+
+func TestMSDAVExt(t *testing.T) {
+	h := &Handler{FileSystem: NewMemFS(), LockSystem: NewMemLS(), OfficeCompatible: true}
+	do := func(method, body, ext string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/doc.docx", strings.NewReader(body))
+		r.Header.Set("X-MSDAVEXT", ext)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	const proppatch = `<?xml version="1.0" encoding="utf-8" ?>` +
+		`<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:">` +
+		`<D:set><D:prop><Z:Win32FileAttributes>00000020</Z:Win32FileAttributes></D:prop></D:set>` +
+		`</D:propertyupdate>`
+	w := do("PUT", msdavextBody(proppatch, "content"), "PROPPATCH")
+	if w.Code != StatusMulti {
+		t.Fatalf("extended PUT: status %d, want %d", w.Code, StatusMulti)
+	}
+	if !strings.Contains(w.Body.String(), "Win32FileAttributes") || !strings.Contains(w.Body.String(), "200 OK") {
+		t.Errorf("extended PUT: body %q, want the 200 propstat of Win32FileAttributes", w.Body.String())
+	}
+
+	w = do("GET", "", "PROPFIND")
+	if w.Code != http.StatusOK {
+		t.Fatalf("extended GET: status %d, want %d", w.Code, http.StatusOK)
+	}
+	b := w.Body.String()
+	n, err := strconv.ParseInt(b[:16], 16, 64)
+	if err != nil || int(n) > len(b)-32 {
+		t.Fatalf("extended GET: body %q, with no PROPFIND part", b)
+	}
+	ms, rest := b[16:16+n], b[16+n:]
+	if !strings.Contains(ms, "Win32FileAttributes") || !strings.Contains(ms, "getcontentlength") {
+		t.Errorf("extended GET: PROPFIND part %q, want the properties of the file", ms)
+	}
+	if want := fmt.Sprintf("%016x", len("content")) + "content"; rest != want {
+		t.Errorf("extended GET: contents part %q, want %q", rest, want)
+	}
+	if got, want := w.Header().Get("Content-Length"), strconv.Itoa(len(b)); got != want {
+		t.Errorf("extended GET: Content-Length %s, want %s", got, want)
+	}
+
+	if w := do("PUT", "0000000000000010short", "PROPPATCH"); w.Code != http.StatusBadRequest {
+		t.Errorf("truncated extended PUT: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do("GET", "", ""); w.Body.String() != "content" {
+		t.Errorf("GET: body %q, want %q", w.Body.String(), "content")
+	}
+}
+
+// quotaFS is a FileSystem whose root has a quota of limit bytes, shared
+// by all its collections but /unlimited.
+type quotaFS struct {
+	FileSystem
+	limit int64
+}
+
+func (fs *quotaFS) Quota(ctx context.Context, name string) (available, used int64, err error) {
+	if strings.HasPrefix(name, "/unlimited") {
+		return 0, 0, ErrNotImplemented
+	}
+	fi, err := fs.Stat(ctx, "/")
+	if err != nil {
+		return 0, 0, err
+	}
+	err = walkFS(ctx, fs, infiniteDepth, "/", fi, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			used += info.Size()
+		}
+		return nil
+	})
+	return fs.limit - used, used, err
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(&Handler{
+		FileSystem: &quotaFS{FileSystem: NewMemFS(), limit: 100},
+		LockSystem: NewMemLS(),
+	})
+	defer srv.Close()
+	c, err := NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := func(name string) map[string]string {
+		t.Helper()
+		rs, err := c.PropFind(ctx, name, 0, []xml.Name{quotaAvailableName, quotaUsedName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, ps := range rs[0].Propstats {
+			for _, p := range ps.Props {
+				if ps.Status == http.StatusOK {
+					got[p.XMLName.Local] = string(p.InnerXML)
+				}
+			}
+		}
+		return got
+	}
+
+	if err := c.Mkcol(ctx, "/dir"); err != nil {
+		t.Fatalf("Mkcol: %v", err)
+	}
+	if err := c.Put(ctx, "/dir/a", strings.NewReader(strings.Repeat("a", 60))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	want := map[string]string{"quota-available-bytes": "40", "quota-used-bytes": "60"}
+	if got := quota("/dir/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("quota of /dir/: got %v, want %v", got, want)
+	}
+	if got := quota("/dir/a"); len(got) != 0 {
+		t.Errorf("quota of the file /dir/a: got %v, want none", got)
+	}
+	if err := c.Mkcol(ctx, "/unlimited"); err != nil {
+		t.Fatalf("Mkcol: %v", err)
+	}
+	if got := quota("/unlimited/"); len(got) != 0 {
+		t.Errorf("quota of /unlimited/: got %v, want none", got)
+	}
+
+	if err := c.Put(ctx, "/dir/b", strings.NewReader(strings.Repeat("b", 50))); !isStatus(err, StatusInsufficientStorage) {
+		t.Errorf("Put exceeding the quota: %v, want a 507 StatusError", err)
+	}
+	// Replacing /dir/a frees its 60 bytes.
+	if err := c.Put(ctx, "/dir/a", strings.NewReader(strings.Repeat("a", 100))); err != nil {
+		t.Errorf("Put replacing a file within the quota: %v", err)
+	}
+	if err := c.Mkcol(ctx, "/dir/sub"); !isStatus(err, StatusInsufficientStorage) {
+		t.Errorf("Mkcol without quota available: %v, want a 507 StatusError", err)
+	}
+
+	pstats, err := c.PropPatch(ctx, "/dir/", []Proppatch{{
+		Props: []Property{{XMLName: quotaUsedName, InnerXML: []byte("0")}},
+	}})
+	if err != nil {
+		t.Fatalf("PropPatch: %v", err)
+	}
+	if len(pstats) != 1 || pstats[0].Status != http.StatusForbidden {
+		t.Errorf("PropPatch of a quota property: got %+v, want a 403 propstat", pstats)
+	}
+}
+
+// fullDirFS is a FileSystem whose collection /full has no storage left,
+// and the others all the storage they need.
+type fullDirFS struct {
+	FileSystem
+}
+
+func (fs fullDirFS) Quota(ctx context.Context, name string) (available, used int64, err error) {
+	if name == "/full" {
+		return 0, 0, nil
+	}
+	return 1 << 30, 0, nil
+}
+
+func TestQuotaOfParent(t *testing.T) {
+	fs := fullDirFS{NewMemFS()}
+	if err := fs.Mkdir(context.Background(), "/full", 0777); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{FileSystem: fs, LockSystem: NewMemLS()}
+	for _, target := range []string{"/full/sub", "/full/sub/"} {
+		r := httptest.NewRequest("MKCOL", target, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != StatusInsufficientStorage {
+			t.Errorf("MKCOL %s: status %d, want %d", target, w.Code, StatusInsufficientStorage)
+		}
+	}
+	r := httptest.NewRequest("MKCOL", "/other/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Errorf("MKCOL /other/: status %d, want %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestPartialPut(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	h := &Handler{FileSystem: fs, LockSystem: NewMemLS(), AllowPartialPut: true}
+	put := func(name, cr, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "http://example.com"+name, strings.NewReader(body))
+		if cr != "" {
+			req.Header.Set("Content-Range", cr)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	content := func(name string) string {
+		t.Helper()
+		f, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if rec := put("/a", "bytes 0-4/10", "hello"); rec.Code != http.StatusCreated {
+		t.Fatalf("first range: status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if rec := put("/a", "bytes 5-9/10", "world"); rec.Code != http.StatusNoContent || rec.Header().Get("ETag") == "" {
+		t.Fatalf("second range: status %d, ETag %q, want %d and an ETag", rec.Code, rec.Header().Get("ETag"), http.StatusNoContent)
+	}
+	if got := content("/a"); got != "helloworld" {
+		t.Fatalf("content %q, want %q", got, "helloworld")
+	}
+	if rec := put("/a", "bytes 1-3/*", "ELL"); rec.Code != http.StatusNoContent {
+		t.Fatalf("overwriting range: status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := content("/a"); got != "hELLoworld" {
+		t.Fatalf("content %q, want %q", got, "hELLoworld")
+	}
+
+	rec := put("/a", "bytes 20-24/*", "later")
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range past the end: status %d, want %d", rec.Code, http.StatusRequestedRangeNotSatisfiable)
+	}
+	if got, want := rec.Header().Get("Content-Range"), "bytes */10"; got != want {
+		t.Errorf("range past the end: Content-Range %q, want %q", got, want)
+	}
+	for _, cr := range []string{
+		"bytes 0-4",
+		"bytes 4-0/10",
+		"bytes 0-4/3",
+		"bytes -1-3/10",
+		"items 0-4/10",
+		"bytes 0-9/10", // longer than the body
+	} {
+		if rec := put("/a", cr, "12345"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Content-Range %q: status %d, want %d", cr, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if got := content("/a"); got != "hELLoworld" {
+		t.Errorf("content %q after the failed requests, want %q", got, "hELLoworld")
+	}
+
+	// Without AllowPartialPut, the range is ignored.
+	h.AllowPartialPut = false
+	if rec := put("/a", "bytes 0-1/*", "hi"); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT without AllowPartialPut: status %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if got := content("/a"); got != "hi" {
+		t.Errorf("content %q, want %q", got, "hi")
+	}
+}
+
+type flushCountingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushCountingRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestPropfindFlushInterval(t *testing.T) {
+	ctx := context.Background()
+	fs := NewMemFS()
+	// More entries than walkFS reads at a time.
+	const n = 2*walkReaddirCount + 10
+	for i := 0; i < n; i++ {
+		f, err := fs.OpenFile(ctx, fmt.Sprintf("/f%05d", i), os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	h := &Handler{FileSystem: fs, LockSystem: NewMemLS()}
+	propfind := func() *flushCountingRecorder {
+		t.Helper()
+		req := httptest.NewRequest("PROPFIND", "http://example.com/", nil)
+		req.Header.Set("Depth", "1")
+		rec := &flushCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ServeHTTP(rec, req)
+		if rec.Code != StatusMulti {
+			t.Fatalf("status %d, want %d", rec.Code, StatusMulti)
+		}
+		if got := strings.Count(rec.Body.String(), "<D:response>"); got != n+1 {
+			t.Fatalf("%d responses, want %d", got, n+1)
+		}
+		return rec
+	}
+
+	if rec := propfind(); rec.flushes != 0 {
+		t.Errorf("without PropfindFlushInterval: %d flushes, want 0", rec.flushes)
+	}
+	h.PropfindFlushInterval = time.Nanosecond
+	if rec := propfind(); rec.flushes == 0 {
+		t.Errorf("with PropfindFlushInterval: no flush")
+	}
+	h.PropfindFlushInterval = time.Hour
+	if rec := propfind(); rec.flushes != 1 {
+		t.Errorf("with a PropfindFlushInterval of an hour: %d flushes, want 1", rec.flushes)
+	}
+}
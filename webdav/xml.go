@@ -246,6 +246,8 @@ type propstat struct {
 	Status              string     `xml:"D:status"`
 	Error               *xmlError  `xml:"D:error"`
 	ResponseDescription string     `xml:"D:responsedescription,omitempty"`
+
+	code int // the status code of Status, for JSON
 }
 
 // ixmlPropstat is the same as the propstat type except it holds an ixml.Name
@@ -295,6 +297,8 @@ type response struct {
 	Status              string     `xml:"D:status,omitempty"`
 	Error               *xmlError  `xml:"D:error"`
 	ResponseDescription string     `xml:"D:responsedescription,omitempty"`
+
+	code int // the status code of Status, for JSON
 }
 
 // MultistatusWriter marshals one or more Responses into a XML
@@ -315,6 +319,18 @@ type multistatusWriter struct {
 
 	w   http.ResponseWriter
 	enc *ixml.Encoder
+
+	// json selects the JSON representation of the responses, written
+	// once jsonStarted. See Handler.JSONMultistatus.
+	json          bool
+	jsonStarted   bool
+	jsonResponses int
+
+	// flushInterval, if positive, is the interval at which the written
+	// responses are flushed to the client. See
+	// Handler.PropfindFlushInterval.
+	flushInterval time.Duration
+	lastFlush     time.Time
 }
 
 // Write validates and emits a DAV response as part of a multistatus response
@@ -342,13 +358,48 @@ func (w *multistatusWriter) write(r *response) error {
 	if err != nil {
 		return err
 	}
-	return w.enc.Encode(r)
+	if w.json {
+		err = w.writeJSON(r)
+	} else {
+		err = w.enc.Encode(r)
+	}
+	if err != nil {
+		return err
+	}
+	w.maybeFlush()
+	return nil
+}
+
+// maybeFlush flushes the responses written so far to the client if the
+// flush interval of w has elapsed since the last flush.
+func (w *multistatusWriter) maybeFlush() {
+	if w.flushInterval <= 0 {
+		return
+	}
+	f, ok := w.w.(http.Flusher)
+	if !ok {
+		return
+	}
+	if now := time.Now(); now.Sub(w.lastFlush) >= w.flushInterval {
+		f.Flush()
+		w.lastFlush = now
+	}
 }
 
 // writeHeader writes a XML multistatus start element on w's underlying
 // http.ResponseWriter and returns the result of the write operation.
 // After the first write attempt, writeHeader becomes a no-op.
 func (w *multistatusWriter) writeHeader() error {
+	if w.json {
+		if w.jsonStarted {
+			return nil
+		}
+		w.jsonStarted = true
+		w.w.Header().Add("Content-Type", "application/json")
+		w.w.WriteHeader(StatusMulti)
+		_, err := io.WriteString(w.w, `{"responses":[`)
+		return err
+	}
 	if w.enc != nil {
 		return nil
 	}
@@ -376,6 +427,9 @@ func (w *multistatusWriter) writeHeader() error {
 // return value and field enc of w are nil, then no multistatus response has
 // been written.
 func (w *multistatusWriter) close() error {
+	if w.json && w.jsonStarted {
+		return w.closeJSON()
+	}
 	if w.enc == nil {
 		return nil
 	}
@@ -452,6 +506,22 @@ type proppatchProps []Property
 // UnmarshalXML returns an error if start does not contain any properties or if
 // property values contain syntactically incorrect XML.
 func (ps *proppatchProps) UnmarshalXML(d *ixml.Decoder, start ixml.StartElement) error {
+	if err := (*propValues)(ps).UnmarshalXML(d, start); err != nil {
+		return err
+	}
+	if len(*ps) == 0 {
+		return fmt.Errorf("%s must not be empty", start.Name.Local)
+	}
+	return nil
+}
+
+// propValues is the properties of a prop element, which may be empty,
+// such as in a multistatus response.
+type propValues []Property
+
+// UnmarshalXML appends the property names and values enclosed within start
+// to ps, as proppatchProps does.
+func (ps *propValues) UnmarshalXML(d *ixml.Decoder, start ixml.StartElement) error {
 	lang := xmlLang(start, "")
 	for {
 		t, err := next(d)
@@ -460,9 +530,6 @@ func (ps *proppatchProps) UnmarshalXML(d *ixml.Decoder, start ixml.StartElement)
 		}
 		switch elem := t.(type) {
 		case ixml.EndElement:
-			if len(*ps) == 0 {
-				return fmt.Errorf("%s must not be empty", start.Name.Local)
-			}
 			return nil
 		case ixml.StartElement:
 			p := Property{
@@ -498,6 +565,11 @@ func readProppatch(r io.Reader) (patches []Proppatch, status int, err error) {
 	if err = ixml.NewDecoder(r).Decode(&pu); err != nil {
 		return nil, http.StatusBadRequest, err
 	}
+	return pu.patches()
+}
+
+// patches returns the changes of the properties of pu.
+func (pu *propertyupdate) patches() (patches []Proppatch, status int, err error) {
 	for _, op := range pu.SetRemove {
 		remove := false
 		switch op.XMLName {
@@ -22,6 +22,65 @@ func (e *DialError) Error() string {
 	return "websocket.Dial " + e.Config.Location.String() + ": " + e.Err.Error()
 }
 
+// redirectError is returned by the client handshake when the server
+// redirects it to location and Config.MaxRedirects is set.
+type redirectError struct {
+	location *url.URL
+}
+
+func (e *redirectError) Error() string {
+	return "websocket: redirected to " + e.location.String()
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// cookieURL returns the http or https URL under which the cookies for
+// the WebSocket location u are kept in a cookie jar.
+func cookieURL(u *url.URL) *url.URL {
+	v := *u
+	switch u.Scheme {
+	case "ws":
+		v.Scheme = "http"
+	case "wss":
+		v.Scheme = "https"
+	}
+	return &v
+}
+
+// redirect returns a copy of config for the location it was redirected
+// to. The credentials in the header are dropped if the host changes, or
+// if the location is not secure while config's was.
+func (config *Config) redirect(location *url.URL) *Config {
+	c := *config
+	u := *location
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	c.Location = &u
+	downgrade := config.Location.Scheme == "wss" && u.Scheme != "wss"
+	if (u.Hostname() != config.Location.Hostname() || downgrade) && config.Header != nil {
+		c.Header = make(http.Header)
+		for k, v := range config.Header {
+			switch http.CanonicalHeaderKey(k) {
+			case "Authorization", "Www-Authenticate", "Cookie", "Cookie2":
+			default:
+				c.Header[k] = v
+			}
+		}
+	}
+	return &c
+}
+
 // NewConfig creates a new WebSocket config for client connection.
 func NewConfig(server, origin string) (config *Config, err error) {
 	config = new(Config)
@@ -39,15 +98,25 @@ func NewConfig(server, origin string) (config *Config, err error) {
 }
 
 // NewClient creates a new WebSocket client connection over rwc.
+// It does not follow redirects.
 func NewClient(config *Config, rwc io.ReadWriteCloser) (ws *Conn, err error) {
+	ws, err = newClient(config, rwc)
+	if _, ok := err.(*redirectError); ok {
+		err = ErrBadStatus
+	}
+	return
+}
+
+func newClient(config *Config, rwc io.ReadWriteCloser) (ws *Conn, err error) {
 	br := bufio.NewReader(rwc)
 	bw := bufio.NewWriter(rwc)
-	err = hybiClientHandshake(config, br, bw)
+	resp, err := hybiClientHandshake(config, br, bw)
 	if err != nil {
 		return
 	}
 	buf := bufio.NewReadWriter(br, bw)
 	ws = newHybiClientConn(config, buf, rwc)
+	ws.response = resp
 	return
 }
 
@@ -78,6 +147,8 @@ func parseAuthority(location *url.URL) string {
 }
 
 // DialConfig opens a new client connection to a WebSocket with a config.
+// It follows up to config.MaxRedirects redirects, without modifying
+// config: the Config of the connection returned has the final location.
 func DialConfig(config *Config) (ws *Conn, err error) {
 	var client net.Conn
 	if config.Location == nil {
@@ -90,16 +161,26 @@ func DialConfig(config *Config) (ws *Conn, err error) {
 	if dialer == nil {
 		dialer = &net.Dialer{}
 	}
-	client, err = dialWithDialer(dialer, config)
-	if err != nil {
-		goto Error
-	}
-	ws, err = NewClient(config, client)
-	if err != nil {
+	for redirects := 0; ; redirects++ {
+		client, err = dialWithDialer(dialer, config)
+		if err != nil {
+			goto Error
+		}
+		ws, err = newClient(config, client)
+		if err == nil {
+			return
+		}
 		client.Close()
-		goto Error
+		redirect, ok := err.(*redirectError)
+		if !ok {
+			goto Error
+		}
+		if redirects == config.MaxRedirects {
+			err = ErrTooManyRedirects
+			goto Error
+		}
+		config = config.redirect(redirect.location)
 	}
-	return
 
 Error:
 	return nil, &DialError{config, err}
@@ -20,6 +20,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -36,6 +38,7 @@ const (
 	closeStatusPolicyViolation   = 1008
 	closeStatusTooBigData        = 1009
 	closeStatusExtensionMismatch = 1010
+	closeStatusInternalError     = 1011
 
 	maxControlFramePayloadLength = 125
 )
@@ -46,6 +49,7 @@ var (
 	ErrBadClosingStatus      = &ProtocolError{"bad closing status"}
 	ErrUnsupportedExtensions = &ProtocolError{"unsupported extensions"}
 	ErrNotImplemented        = &ProtocolError{"not implemented"}
+	ErrInvalidUTF8           = &ProtocolError{"invalid UTF-8 in text message"}
 
 	handshakeHeader = map[string]bool{
 		"Host":                   true,
@@ -77,6 +81,9 @@ type hybiFrameReader struct {
 	header hybiFrameHeader
 	pos    int64
 	length int
+
+	// text validates the payload as UTF-8 text, if non-nil.
+	text *hybiFrameHandler
 }
 
 func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
@@ -87,6 +94,11 @@ func (frame *hybiFrameReader) Read(msg []byte) (n int, err error) {
 			frame.pos++
 		}
 	}
+	if frame.text != nil {
+		if verr := frame.text.checkText(msg[:n], err == io.EOF && frame.header.Fin); verr != nil {
+			return 0, verr
+		}
+	}
 	return n, err
 }
 
@@ -122,7 +134,7 @@ func (buf hybiFrameReaderFactory) NewFrameReader() (frame frameReader, err error
 	// First byte. FIN/RSV1/RSV2/RSV3/OpCode(4bits)
 	b, err = buf.ReadByte()
 	if err != nil {
-		return
+		return nil, err
 	}
 	header = append(header, b)
 	hybiFrame.header.Fin = ((header[0] >> 7) & 1) != 0
@@ -182,9 +194,30 @@ type hybiFrameWriter struct {
 	writer *bufio.Writer
 
 	header *hybiFrameHeader
+	conn   *Conn // observing the frame, if non-nil
 }
 
 func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
+	if frame.conn != nil {
+		start := time.Now()
+		defer func() {
+			if err != nil {
+				return
+			}
+			f := FrameStat{
+				Written:   true,
+				OpCode:    frame.header.OpCode,
+				Fin:       frame.header.Fin,
+				Len:       int64(len(msg)),
+				HeaderLen: frameHeaderLen(len(msg), frame.header.MaskingKey != nil),
+				Duration:  time.Since(start),
+			}
+			if frame.header.OpCode == CloseFrame && len(msg) >= 2 {
+				f.CloseStatus = int(binary.BigEndian.Uint16(msg))
+			}
+			frame.conn.observe(f)
+		}()
+	}
 	var header []byte
 	var b byte
 	if frame.header.Fin {
@@ -243,6 +276,22 @@ func (frame *hybiFrameWriter) Write(msg []byte) (n int, err error) {
 
 func (frame *hybiFrameWriter) Close() error { return nil }
 
+// frameHeaderLen returns the length of the header of a frame with a
+// payload of length bytes.
+func frameHeaderLen(length int, masked bool) int {
+	n := 2
+	switch {
+	case length >= 65536:
+		n += 8
+	case length > 125:
+		n += 2
+	}
+	if masked {
+		n += 4
+	}
+	return n
+}
+
 type hybiFrameWriterFactory struct {
 	*bufio.Writer
 	needMaskingKey bool
@@ -262,18 +311,32 @@ func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameW
 type hybiFrameHandler struct {
 	conn        *Conn
 	payloadType byte
+
+	fragmented bool          // the message being read continues in the next frame
+	utf8       utf8Validator // state of the text message being read
+	err        error         // why the connection was failed, if it was
+	closeSent  bool          // a close frame was written; guarded by conn.wio
 }
 
 func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, error) {
+	if handler.err != nil {
+		return nil, handler.err
+	}
+	stat := readStat(frame.(*hybiFrameReader))
+	if stat.OpCode != CloseFrame {
+		handler.conn.observe(stat)
+	}
 	if handler.conn.IsServerConn() {
 		// The client MUST mask all frames sent to the server.
 		if frame.(*hybiFrameReader).header.MaskingKey == nil {
+			handler.drop(stat)
 			handler.WriteClose(closeStatusProtocolError)
 			return nil, io.EOF
 		}
 	} else {
 		// The server MUST NOT mask all frames.
 		if frame.(*hybiFrameReader).header.MaskingKey != nil {
+			handler.drop(stat)
 			handler.WriteClose(closeStatusProtocolError)
 			return nil, io.EOF
 		}
@@ -281,12 +344,43 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 	if header := frame.HeaderReader(); header != nil {
 		io.Copy(ioutil.Discard, header)
 	}
+	strict := handler.strict()
+	if strict {
+		if err := handler.checkFrame(&frame.(*hybiFrameReader).header); err != nil {
+			handler.drop(stat)
+			return nil, err
+		}
+	}
 	switch frame.PayloadType() {
-	case ContinuationFrame:
-		frame.(*hybiFrameReader).header.OpCode = handler.payloadType
-	case TextFrame, BinaryFrame:
-		handler.payloadType = frame.PayloadType()
+	case ContinuationFrame, TextFrame, BinaryFrame:
+		hf := frame.(*hybiFrameReader)
+		if hf.header.OpCode == ContinuationFrame {
+			hf.header.OpCode = handler.payloadType
+		} else {
+			handler.payloadType = hf.header.OpCode
+			handler.utf8.reset()
+		}
+		handler.fragmented = !hf.header.Fin
+		if strict && hf.header.OpCode == TextFrame {
+			hf.text = handler
+		}
 	case CloseFrame:
+		b := make([]byte, maxControlFramePayloadLength)
+		n, err := io.ReadFull(frame, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		b = b[:n]
+		if n >= 2 {
+			stat.CloseStatus = int(binary.BigEndian.Uint16(b))
+		}
+		if strict {
+			if err := handler.checkClose(b); err != nil {
+				handler.drop(stat)
+				return nil, err
+			}
+		}
+		handler.conn.observe(stat)
 		return nil, io.EOF
 	case PingFrame, PongFrame:
 		b := make([]byte, maxControlFramePayloadLength)
@@ -305,13 +399,109 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 	return frame, nil
 }
 
+// strict reports whether the frames received are validated.
+func (handler *hybiFrameHandler) strict() bool {
+	return handler.conn.config == nil || !handler.conn.config.DisableValidation
+}
+
+// checkFrame fails the connection with a protocol error if the frame
+// with header h is not valid.
+// See Section 5 Data Framing for detail.
+// http://tools.ietf.org/html/draft-ietf-hybi-thewebsocketprotocol-17#section-5
+func (handler *hybiFrameHandler) checkFrame(h *hybiFrameHeader) error {
+	switch {
+	case h.Rsv[0] || h.Rsv[1] || h.Rsv[2]:
+		// No extension defining the reserved bits is negotiated.
+	case h.OpCode == ContinuationFrame:
+		if handler.fragmented {
+			return nil
+		}
+	case h.OpCode == TextFrame || h.OpCode == BinaryFrame:
+		if !handler.fragmented {
+			return nil
+		}
+	case h.OpCode == CloseFrame || h.OpCode == PingFrame || h.OpCode == PongFrame:
+		// Control frames must not be fragmented.
+		if h.Fin && h.Length <= maxControlFramePayloadLength {
+			return nil
+		}
+	}
+	return handler.fail(closeStatusProtocolError, ErrBadFrame)
+}
+
+// checkClose fails the connection if the payload b of the close frame is
+// not a valid status code followed by a UTF-8 reason.
+func (handler *hybiFrameHandler) checkClose(b []byte) error {
+	switch n := len(b); {
+	case n == 0:
+		return nil
+	case n == 1 || !validCloseStatus(int(binary.BigEndian.Uint16(b))):
+		return handler.fail(closeStatusProtocolError, ErrBadClosingStatus)
+	case !utf8.Valid(b[2:]):
+		return handler.fail(closeStatusBadMessageData, ErrInvalidUTF8)
+	}
+	return nil
+}
+
+// validCloseStatus reports whether status may be sent in a close frame.
+func validCloseStatus(status int) bool {
+	switch {
+	case status >= closeStatusNormal && status <= closeStatusUnsupportedData,
+		status >= closeStatusBadMessageData && status <= closeStatusExtensionMismatch,
+		status == closeStatusInternalError,
+		status >= 3000 && status <= 4999: // Registered and private use
+		return true
+	}
+	return false
+}
+
+// checkText fails the connection if p does not continue the text message
+// being read as valid UTF-8. final reports whether p ends the message.
+func (handler *hybiFrameHandler) checkText(p []byte, final bool) error {
+	if handler.err != nil {
+		return handler.err
+	}
+	if !handler.utf8.write(p) || final && !handler.utf8.complete() {
+		return handler.fail(closeStatusBadMessageData, ErrInvalidUTF8)
+	}
+	return nil
+}
+
+// drop reports the frame read of stat as dropped, after reporting it as
+// read if it is a close frame, which is reported once its payload is read.
+func (handler *hybiFrameHandler) drop(stat FrameStat) {
+	if stat.OpCode == CloseFrame {
+		handler.conn.observe(stat)
+	}
+	stat.Dropped = true
+	handler.conn.observe(stat)
+}
+
+// fail fails the connection: it sends a close frame with status, and
+// makes err the result of all later reads.
+func (handler *hybiFrameHandler) fail(status int, err error) error {
+	handler.WriteClose(status)
+	handler.err = err
+	return err
+}
+
 func (handler *hybiFrameHandler) WriteClose(status int) (err error) {
+	if handler.err != nil {
+		// The close frame was sent when the connection failed.
+		return nil
+	}
 	handler.conn.wio.Lock()
 	defer handler.conn.wio.Unlock()
-	w, err := handler.conn.frameWriterFactory.NewFrameWriter(CloseFrame)
+	if handler.closeSent {
+		// Only one close frame may be sent, such as by Close after
+		// Server.Shutdown.
+		return nil
+	}
+	w, err := handler.conn.newFrameWriter(CloseFrame)
 	if err != nil {
 		return err
 	}
+	handler.closeSent = true
 	msg := make([]byte, 2)
 	binary.BigEndian.PutUint16(msg, uint16(status))
 	_, err = w.Write(msg)
@@ -322,7 +512,7 @@ func (handler *hybiFrameHandler) WriteClose(status int) (err error) {
 func (handler *hybiFrameHandler) WritePong(msg []byte) (n int, err error) {
 	handler.conn.wio.Lock()
 	defer handler.conn.wio.Unlock()
-	w, err := handler.conn.frameWriterFactory.NewFrameWriter(PongFrame)
+	w, err := handler.conn.newFrameWriter(PongFrame)
 	if err != nil {
 		return 0, err
 	}
@@ -331,6 +521,44 @@ func (handler *hybiFrameHandler) WritePong(msg []byte) (n int, err error) {
 	return n, err
 }
 
+// utf8Validator validates UTF-8 text written to it in pieces, which may
+// split runes.
+type utf8Validator struct {
+	rune [utf8.UTFMax]byte // start of a rune split by the last write
+	n    int
+}
+
+func (v *utf8Validator) reset() { v.n = 0 }
+
+// write reports whether p continues the text written so far as valid
+// UTF-8, assuming p may end with an incomplete rune.
+func (v *utf8Validator) write(p []byte) bool {
+	for v.n > 0 && len(p) > 0 {
+		v.rune[v.n] = p[0]
+		v.n++
+		p = p[1:]
+		if utf8.FullRune(v.rune[:v.n]) {
+			if r, size := utf8.DecodeRune(v.rune[:v.n]); r == utf8.RuneError && size == 1 {
+				return false
+			}
+			v.n = 0
+		}
+	}
+	i := len(p) - 1
+	for i > 0 && i > len(p)-utf8.UTFMax && !utf8.RuneStart(p[i]) {
+		i--
+	}
+	if i >= 0 && !utf8.FullRune(p[i:]) {
+		v.n = copy(v.rune[:], p[i:])
+		p = p[:i]
+	}
+	return utf8.Valid(p)
+}
+
+// complete reports whether the text written so far does not end with an
+// incomplete rune.
+func (v *utf8Validator) complete() bool { return v.n == 0 }
+
 // newHybiConn creates a new WebSocket connection speaking hybi draft protocol.
 func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser, request *http.Request) *Conn {
 	if buf == nil {
@@ -338,12 +566,17 @@ func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser,
 		bw := bufio.NewWriter(rwc)
 		buf = bufio.NewReadWriter(br, bw)
 	}
+	buf, readWait, writeWait := limitBuffer(config, buf)
 	ws := &Conn{config: config, request: request, buf: buf, rwc: rwc,
+		readWait: readWait, writeWait: writeWait,
 		frameReaderFactory: hybiFrameReaderFactory{buf.Reader},
 		frameWriterFactory: hybiFrameWriterFactory{
 			buf.Writer, request == nil},
 		PayloadType:        TextFrame,
 		defaultCloseStatus: closeStatusNormal}
+	if config != nil && config.Observer != nil {
+		ws.SetObserver(config.Observer)
+	}
 	ws.frameHandler = &hybiFrameHandler{conn: ws}
 	return ws
 }
@@ -402,7 +635,7 @@ func getNonceAccept(nonce []byte) (expected []byte, err error) {
 }
 
 // Client handshake described in draft-ietf-hybi-thewebsocket-protocol-17
-func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (err error) {
+func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (resp *http.Response, err error) {
 	bw.WriteString("GET " + config.Location.RequestURI() + " HTTP/1.1\r\n")
 
 	// According to RFC 6874, an HTTP client, proxy, or other
@@ -419,7 +652,7 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 	bw.WriteString("Origin: " + strings.ToLower(config.Origin.String()) + "\r\n")
 
 	if config.Version != ProtocolVersionHybi13 {
-		return ErrBadProtocolVersion
+		return nil, ErrBadProtocolVersion
 	}
 
 	bw.WriteString("Sec-WebSocket-Version: " + fmt.Sprintf("%d", config.Version) + "\r\n")
@@ -427,36 +660,61 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 		bw.WriteString("Sec-WebSocket-Protocol: " + strings.Join(config.Protocol, ", ") + "\r\n")
 	}
 	// TODO(ukai): send Sec-WebSocket-Extensions.
-	err = config.Header.WriteSubset(bw, handshakeHeader)
+	header := config.Header
+	if config.Jar != nil {
+		if cookies := config.Jar.Cookies(cookieURL(config.Location)); len(cookies) > 0 {
+			req := &http.Request{Header: make(http.Header)}
+			for k, v := range config.Header {
+				req.Header[k] = v
+			}
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			header = req.Header
+		}
+	}
+	err = header.WriteSubset(bw, handshakeHeader)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	bw.WriteString("\r\n")
 	if err = bw.Flush(); err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := http.ReadResponse(br, &http.Request{Method: "GET"})
+	resp, err = http.ReadResponse(br, &http.Request{Method: "GET"})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if config.Jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			config.Jar.SetCookies(cookieURL(config.Location), cookies)
+		}
 	}
 	if resp.StatusCode != 101 {
-		return ErrBadStatus
+		if loc := resp.Header.Get("Location"); loc != "" && config.MaxRedirects > 0 && isRedirect(resp.StatusCode) {
+			u, err := config.Location.Parse(loc)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &redirectError{u}
+		}
+		return nil, ErrBadStatus
 	}
 	if strings.ToLower(resp.Header.Get("Upgrade")) != "websocket" ||
 		strings.ToLower(resp.Header.Get("Connection")) != "upgrade" {
-		return ErrBadUpgrade
+		return nil, ErrBadUpgrade
 	}
 	expectedAccept, err := getNonceAccept(nonce)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.Header.Get("Sec-WebSocket-Accept") != string(expectedAccept) {
-		return ErrChallengeResponse
+		return nil, ErrChallengeResponse
 	}
 	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
-		return ErrUnsupportedExtensions
+		return nil, ErrUnsupportedExtensions
 	}
 	offeredProtocol := resp.Header.Get("Sec-WebSocket-Protocol")
 	if offeredProtocol != "" {
@@ -468,12 +726,12 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 			}
 		}
 		if !protocolMatched {
-			return ErrBadWebSocketProtocol
+			return nil, ErrBadWebSocketProtocol
 		}
 		config.Protocol = []string{offeredProtocol}
 	}
 
-	return nil
+	return resp, nil
 }
 
 // newHybiClientConn creates a client WebSocket connection after handshake.
@@ -68,7 +68,7 @@ Sec-WebSocket-Protocol: chat
 		config.handshakeData = map[string]string{
 			"key": "dGhlIHNhbXBsZSBub25jZQ==",
 		}
-		if err := hybiClientHandshake(&config, br, bw); err != nil {
+		if _, err := hybiClientHandshake(&config, br, bw); err != nil {
 			t.Fatal("handshake", err)
 		}
 		req, err := http.ReadRequest(bufio.NewReader(&b))
@@ -132,7 +132,7 @@ Sec-WebSocket-Protocol: chat
 	config.handshakeData = map[string]string{
 		"key": "dGhlIHNhbXBsZSBub25jZQ==",
 	}
-	err = hybiClientHandshake(config, br, bw)
+	_, err = hybiClientHandshake(config, br, bw)
 	if err != nil {
 		t.Errorf("handshake failed: %v", err)
 	}
@@ -558,6 +558,89 @@ func TestHybiClientReadWithMasking(t *testing.T) {
 	}
 }
 
+var hybiValidationTests = []struct {
+	name     string
+	wireData []byte
+	want     string
+	err      error
+	status   int // of the close frame sent, if any
+}{
+	{"fragmented text", []byte{0x01, 0x01, 0xce, 0x80, 0x01, 0xba}, "\u03ba", nil, 0},
+	{"ping between fragments", []byte{0x01, 0x01, 'a', 0x89, 0x00, 0x80, 0x01, 'b'}, "ab", nil, 0},
+	{"reserved bit", []byte{0xc1, 0x01, 'a'}, "", ErrBadFrame, closeStatusProtocolError},
+	{"unknown opcode", []byte{0x83, 0x01, 'a'}, "", ErrBadFrame, closeStatusProtocolError},
+	{"continuation without message", []byte{0x80, 0x01, 'a'}, "", ErrBadFrame, closeStatusProtocolError},
+	{"unfinished message", []byte{0x01, 0x01, 'a', 0x82, 0x01, 'b'}, "a", ErrBadFrame, closeStatusProtocolError},
+	{"fragmented ping", []byte{0x09, 0x00}, "", ErrBadFrame, closeStatusProtocolError},
+	{"long ping", append([]byte{0x89, 0x7e, 0x00, 0x7e}, make([]byte, 126)...), "", ErrBadFrame, closeStatusProtocolError},
+	{"invalid text", []byte{0x81, 0x02, 'a', 0xff}, "", ErrInvalidUTF8, closeStatusBadMessageData},
+	{"invalid text across fragments", []byte{0x01, 0x01, 0xce, 0x80, 0x01, 'a'}, "\xce", ErrInvalidUTF8, closeStatusBadMessageData},
+	{"truncated text", []byte{0x01, 0x01, 'a', 0x80, 0x01, 0xce}, "a\xce", ErrInvalidUTF8, closeStatusBadMessageData},
+	{"surrogate", []byte{0x81, 0x03, 0xed, 0xa0, 0x80}, "", ErrInvalidUTF8, closeStatusBadMessageData},
+	{"binary", []byte{0x82, 0x01, 0xff}, "\xff", nil, 0},
+	{"close", []byte{0x88, 0x04, 0x03, 0xe8, 'o', 'k'}, "", nil, 0},
+	{"close with bad status", []byte{0x88, 0x02, 0x03, 0xe7}, "", ErrBadClosingStatus, closeStatusProtocolError},
+	{"close with one byte", []byte{0x88, 0x01, 0x03}, "", ErrBadClosingStatus, closeStatusProtocolError},
+	{"close with invalid reason", []byte{0x88, 0x03, 0x03, 0xe8, 0xff}, "", ErrInvalidUTF8, closeStatusBadMessageData},
+}
+
+func TestHybiValidation(t *testing.T) {
+	for _, tt := range hybiValidationTests {
+		br := bufio.NewReader(bytes.NewBuffer(tt.wireData))
+		out := new(bytes.Buffer)
+		conn := newHybiConn(newConfig(t, "/"), bufio.NewReadWriter(br, bufio.NewWriter(out)), nil, nil)
+
+		var got []byte
+		msg := make([]byte, 512)
+		var err error
+		for {
+			var n int
+			n, err = conn.Read(msg)
+			got = append(got, msg[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		if string(got) != tt.want || err != tt.err {
+			t.Errorf("%s: read %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+
+		// Find the status of the close frame sent, skipping any pong.
+		status := 0
+		for fr := (hybiFrameReaderFactory{bufio.NewReader(out)}); ; {
+			frame, err := fr.NewFrameReader()
+			if err != nil {
+				break
+			}
+			payload, _ := io.ReadAll(frame)
+			if frame.PayloadType() == CloseFrame && len(payload) == 2 {
+				status = int(payload[0])<<8 | int(payload[1])
+			}
+		}
+		if status != tt.status {
+			t.Errorf("%s: sent close status %d; want %d", tt.name, status, tt.status)
+		}
+	}
+}
+
+func TestHybiValidationDisabled(t *testing.T) {
+	wireData := []byte{0xc1, 0x02, 'a', 0xff}
+	br := bufio.NewReader(bytes.NewBuffer(wireData))
+	bw := bufio.NewWriter(bytes.NewBuffer([]byte{}))
+	config := newConfig(t, "/")
+	config.DisableValidation = true
+	conn := newHybiConn(config, bufio.NewReadWriter(br, bw), nil, nil)
+
+	msg := make([]byte, 512)
+	n, err := conn.Read(msg)
+	if err != nil || string(msg[:n]) != "a\xff" {
+		t.Errorf("read %q, %v; want %q, nil", msg[:n], err, "a\xff")
+	}
+}
+
 // Test the hybiServerHandshaker supports firefox implementation and
 // checks Connection request header include (but it's not necessary
 // equal to) "upgrade"
@@ -606,3 +689,25 @@ Sec-WebSocket-Version: 13
 		t.Errorf("handshake expected %q but got %q", expectedResponse, b.String())
 	}
 }
+
+func TestHybiWriteAfterClose(t *testing.T) {
+	out := new(bytes.Buffer)
+	br := bufio.NewReader(strings.NewReader(""))
+	conn := newHybiConn(newConfig(t, "/"), bufio.NewReadWriter(br, bufio.NewWriter(out)), nil, new(http.Request))
+	if err := conn.frameHandler.WriteClose(closeStatusGoingAway); err != nil {
+		t.Fatalf("WriteClose: %v", err)
+	}
+	n := out.Len()
+	if _, err := conn.Write([]byte("hello")); err != ErrCloseSent {
+		t.Errorf("Write after close: %v; want %v", err, ErrCloseSent)
+	}
+	if err := Message.Send(conn, "hello"); err != ErrCloseSent {
+		t.Errorf("Send after close: %v; want %v", err, ErrCloseSent)
+	}
+	if err := conn.frameHandler.WriteClose(closeStatusNormal); err != nil {
+		t.Errorf("second WriteClose: %v", err)
+	}
+	if out.Len() != n {
+		t.Errorf("wrote %q after the close frame", out.Bytes()[n:])
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// A RateLimiter limits the rate of the bytes read from or written to
+// connections. See Config.ReadLimiter and Config.WriteLimiter.
+//
+// The waits of a TokenBucket end at the deadlines of the connection
+// waiting, and when it is closed; those of other RateLimiters do not.
+type RateLimiter interface {
+	// Take blocks until it allows the transfer of some of the next n
+	// bytes, and returns their number, between 1 and n. An error fails
+	// the read or write of the connection.
+	Take(n int) (int, error)
+}
+
+// A TokenBucket is a RateLimiter allowing a rate of bytes per second,
+// with bursts of at most its size. It may be shared by several
+// connections.
+type TokenBucket struct {
+	rate, size float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	now   func() time.Time    // for testing
+	sleep func(time.Duration) // for testing
+}
+
+// NewTokenBucket returns a full TokenBucket allowing rate bytes per
+// second, with bursts of size bytes, or one second's worth if size is
+// not positive.
+func NewTokenBucket(rate, size int) *TokenBucket {
+	if rate <= 0 {
+		panic("websocket: non-positive TokenBucket rate")
+	}
+	if size <= 0 {
+		size = rate
+	}
+	return &TokenBucket{
+		rate:   float64(rate),
+		size:   float64(size),
+		tokens: float64(size),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// Take implements RateLimiter, waiting until the bucket holds at least
+// one token.
+func (b *TokenBucket) Take(n int) (int, error) {
+	return b.take(n, func(d time.Duration) error {
+		b.sleep(d)
+		return nil
+	})
+}
+
+// take is like Take, waiting with wait, which may return early, or fail
+// the Take.
+func (b *TokenBucket) take(n int, wait func(time.Duration) error) (int, error) {
+	for {
+		b.mu.Lock()
+		now := b.now()
+		if !b.last.IsZero() {
+			b.tokens += now.Sub(b.last).Seconds() * b.rate
+			if b.tokens > b.size {
+				b.tokens = b.size
+			}
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			if t := int(b.tokens); t < n {
+				n = t
+			}
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return n, nil
+		}
+		d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		if err := wait(d); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// A rateWait interrupts the waits of the rate limiters of a connection,
+// in one direction, at its deadline and when it is closed.
+type rateWait struct {
+	mu       sync.Mutex
+	deadline time.Time
+	closed   bool
+	changed  chan struct{} // closed when deadline or closed change
+}
+
+func newRateWait() *rateWait {
+	return &rateWait{changed: make(chan struct{})}
+}
+
+func (w *rateWait) update(f func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f()
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+func (w *rateWait) setDeadline(t time.Time) {
+	w.update(func() { w.deadline = t })
+}
+
+func (w *rateWait) close() {
+	w.update(func() { w.closed = true })
+}
+
+// wait waits for d, or until the deadline or the closing of the
+// connection change, when it returns early so that the limiter checks
+// them again.
+func (w *rateWait) wait(d time.Duration) error {
+	w.mu.Lock()
+	deadline, closed, changed := w.deadline, w.closed, w.changed
+	w.mu.Unlock()
+	if closed {
+		return net.ErrClosed
+	}
+	if !deadline.IsZero() {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		if left < d {
+			d = left
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-changed:
+	}
+	return nil
+}
+
+// rateLimiters returns the limiters of the data read and written by a
+// connection with config, in the order they are taken from.
+func (config *Config) rateLimiters() (read, write []RateLimiter) {
+	if config.ReadRate > 0 {
+		read = append(read, NewTokenBucket(config.ReadRate, config.ReadBurst))
+	}
+	if config.ReadLimiter != nil {
+		read = append(read, config.ReadLimiter)
+	}
+	if config.WriteRate > 0 {
+		write = append(write, NewTokenBucket(config.WriteRate, config.WriteBurst))
+	}
+	if config.WriteLimiter != nil {
+		write = append(write, config.WriteLimiter)
+	}
+	return read, write
+}
+
+// take waits with w until limiters all allow the transfer of some of the
+// next n bytes, and returns their number: those allowed by the first
+// limiter, which the others then allow in full.
+func take(limiters []RateLimiter, w *rateWait, n int) (int, error) {
+	n, err := takeFrom(limiters[0], w, n)
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range limiters[1:] {
+		for left := n; left > 0; {
+			m, err := takeFrom(l, w, left)
+			if err != nil {
+				return 0, err
+			}
+			left -= m
+		}
+	}
+	return n, nil
+}
+
+func takeFrom(l RateLimiter, w *rateWait, n int) (int, error) {
+	if b, ok := l.(*TokenBucket); ok {
+		return b.take(n, w.wait)
+	}
+	return l.Take(n)
+}
+
+// limitBuffer returns buf, or a buffer over buf whose reads and writes
+// are limited according to config, with the rateWaits of each direction
+// limited, if any.
+func limitBuffer(config *Config, buf *bufio.ReadWriter) (_ *bufio.ReadWriter, rw, ww *rateWait) {
+	read, write := config.rateLimiters()
+	if read == nil && write == nil {
+		return buf, nil, nil
+	}
+	r, w := buf.Reader, buf.Writer
+	if read != nil {
+		rw = newRateWait()
+		r = bufio.NewReader(&limitedReader{r: r, limiters: read, wait: rw})
+	}
+	if write != nil {
+		ww = newRateWait()
+		w = bufio.NewWriter(&limitedWriter{w: w, limiters: write, wait: ww})
+	}
+	return bufio.NewReadWriter(r, w), rw, ww
+}
+
+// limitedReader waits after each read from r until its limiters allow the
+// bytes read, so that reads are delayed when over the rate.
+type limitedReader struct {
+	r        io.Reader
+	limiters []RateLimiter
+	wait     *rateWait
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for left := n; left > 0; {
+		m, terr := take(l.limiters, l.wait, left)
+		if terr != nil {
+			return n, terr
+		}
+		left -= m
+	}
+	return n, err
+}
+
+// limitedWriter writes to w, and flushes it, the bytes its limiters allow.
+type limitedWriter struct {
+	w        *bufio.Writer
+	limiters []RateLimiter
+	wait     *rateWait
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		m, err := take(l.limiters, l.wait, len(p))
+		if err != nil {
+			return written, err
+		}
+		n, err := l.w.Write(p[:m])
+		written += n
+		if err == nil {
+			err = l.w.Flush()
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[m:]
+	}
+	return written, nil
+}
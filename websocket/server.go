@@ -63,6 +63,8 @@ type Server struct {
 
 	// Handler handles a WebSocket connection.
 	Handler
+
+	shutdown *serverShutdown // set by RegisterOnShutdown
 }
 
 // ServeHTTP implements the http.Handler interface for a WebSocket
@@ -71,6 +73,11 @@ func (s Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func (s Server) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	sd := s.shutdown
+	if sd != nil && sd.isShutting() {
+		http.Error(w, "websocket: server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	rwc, buf, err := w.(http.Hijacker).Hijack()
 	if err != nil {
 		panic("Hijack failed: " + err.Error())
@@ -86,6 +93,13 @@ func (s Server) serveWebSocket(w http.ResponseWriter, req *http.Request) {
 	if conn == nil {
 		panic("unexpected nil conn")
 	}
+	if sd != nil {
+		if !sd.add(conn) {
+			conn.frameHandler.WriteClose(closeStatusGoingAway)
+			return
+		}
+		defer sd.remove(conn)
+	}
 	s.Handler(conn)
 }
 
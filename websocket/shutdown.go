@@ -0,0 +1,124 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shutdownMu guards the initialization of Server.shutdown by
+// RegisterOnShutdown.
+var shutdownMu sync.Mutex
+
+// serverShutdown tracks the connections of a Server, for Shutdown.
+type serverShutdown struct {
+	mu       sync.Mutex
+	conns    map[*Conn]struct{}
+	shutting bool
+	idle     chan struct{} // closed once shutting without connections
+}
+
+// RegisterOnShutdown makes s track the connections it serves, and
+// registers Shutdown to be called by the Shutdown method of hs, the
+// http.Server serving s, with the given timeout for the close handshakes.
+// It must be called before s serves connections, and s must then be
+// served by pointer, such as with http.Handle("/ws", s), for its copies to
+// share the connections tracked.
+//
+// The http.Server does not track the connections of WebSocket, which
+// are hijacked: its Shutdown method returns without waiting for them.
+func (s *Server) RegisterOnShutdown(hs *http.Server, timeout time.Duration) {
+	s.trackConns()
+	hs.RegisterOnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+}
+
+// trackConns makes s track the connections it serves.
+func (s *Server) trackConns() *serverShutdown {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	if s.shutdown == nil {
+		s.shutdown = &serverShutdown{conns: make(map[*Conn]struct{})}
+	}
+	return s.shutdown
+}
+
+// Shutdown gracefully shuts down the connections of s: it sends them a
+// close frame with the status 1001, going away, and waits for their close
+// handshakes, until their Handlers return. Once ctx is done, it closes the
+// connections left, and returns the error of ctx. The handshakes of new
+// connections then fail with a 503 Service Unavailable status.
+//
+// Only the connections of a Server on which RegisterOnShutdown was called
+// are tracked: Shutdown returns nil at once on any other Server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	shutdownMu.Lock()
+	sd := s.shutdown
+	shutdownMu.Unlock()
+	if sd == nil {
+		return nil
+	}
+	sd.mu.Lock()
+	sd.shutting = true
+	if sd.idle == nil {
+		sd.idle = make(chan struct{})
+		if len(sd.conns) == 0 {
+			close(sd.idle)
+		}
+	}
+	conns := make([]*Conn, 0, len(sd.conns))
+	for ws := range sd.conns {
+		conns = append(conns, ws)
+	}
+	sd.mu.Unlock()
+
+	for _, ws := range conns {
+		// The write blocks on a slow peer, or with a frame being written.
+		go ws.frameHandler.WriteClose(closeStatusGoingAway)
+	}
+	select {
+	case <-sd.idle:
+		return nil
+	case <-ctx.Done():
+	}
+	sd.mu.Lock()
+	for ws := range sd.conns {
+		ws.rwc.Close()
+	}
+	sd.mu.Unlock()
+	return ctx.Err()
+}
+
+// add tracks ws, reporting false if sd is shutting down.
+func (sd *serverShutdown) add(ws *Conn) bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.shutting {
+		return false
+	}
+	sd.conns[ws] = struct{}{}
+	return true
+}
+
+func (sd *serverShutdown) remove(ws *Conn) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	delete(sd.conns, ws)
+	if sd.shutting && len(sd.conns) == 0 {
+		close(sd.idle)
+	}
+}
+
+func (sd *serverShutdown) isShutting() bool {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return sd.shutting
+}
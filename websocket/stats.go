@@ -0,0 +1,176 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// A FrameStat describes a frame read or written by a Conn.
+type FrameStat struct {
+	// Written reports whether the frame was written, rather than read.
+	Written bool
+
+	// OpCode is the opcode of the frame, such as TextFrame or PingFrame.
+	// That of a continuation frame is ContinuationFrame.
+	OpCode byte
+
+	// Fin reports whether the frame is the last of its message.
+	Fin bool
+
+	// Len is the length of the payload of the frame, and HeaderLen that
+	// of its header.
+	Len       int64
+	HeaderLen int
+
+	// Duration is the time taken to write and flush a frame written.
+	Duration time.Duration
+
+	// CloseStatus is the status code of a close frame, or zero if it has
+	// none.
+	CloseStatus int
+
+	// Dropped reports that the frame read, already reported, is
+	// discarded: it fails the connection as not valid, or its payload
+	// exceeds the MaxPayloadBytes of Codec's Receive method.
+	Dropped bool
+}
+
+// An Observer observes the frames read and written by connections. See
+// Config.Observer and Conn.SetObserver.
+//
+// The package has no compression extension: the lengths of frames are
+// those on the wire.
+type Observer interface {
+	// ObserveFrame is called for each frame read, once its header is
+	// read, or its payload for a close frame, again if it is dropped, and
+	// for each frame written, once it is flushed. It is called with the
+	// read or write lock of ws held, so it must not block nor use ws.
+	ObserveFrame(ws *Conn, f FrameStat)
+}
+
+// Stats is an Observer aggregating the frames of the connections which
+// share it, such as those handled by a Server. The zero value is ready to
+// use.
+type Stats struct {
+	mu sync.Mutex
+	s  StatsSnapshot
+}
+
+// A StatsSnapshot holds the totals of a Stats.
+type StatsSnapshot struct {
+	// FramesRead and FramesWritten are the numbers of frames by opcode.
+	FramesRead, FramesWritten map[byte]int64
+
+	// BytesRead and BytesWritten are the lengths of the frames, headers
+	// included.
+	BytesRead, BytesWritten int64
+
+	// Dropped is the number of frames read which were discarded.
+	Dropped int64
+
+	// CloseStatusRead and CloseStatusWritten are the numbers of close
+	// frames by status code, zero for those without one.
+	CloseStatusRead, CloseStatusWritten map[int]int64
+
+	// WriteTime is the total time taken to write frames.
+	WriteTime time.Duration
+}
+
+// ObserveFrame implements Observer.
+func (s *Stats) ObserveFrame(ws *Conn, f FrameStat) {
+	n := f.Len + int64(f.HeaderLen)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Written {
+		s.s.FramesWritten = incOpCode(s.s.FramesWritten, f.OpCode)
+		s.s.BytesWritten += n
+		s.s.WriteTime += f.Duration
+		if f.OpCode == CloseFrame {
+			s.s.CloseStatusWritten = incStatus(s.s.CloseStatusWritten, f.CloseStatus)
+		}
+		return
+	}
+	if f.Dropped {
+		s.s.Dropped++
+		return
+	}
+	s.s.FramesRead = incOpCode(s.s.FramesRead, f.OpCode)
+	s.s.BytesRead += n
+	if f.OpCode == CloseFrame {
+		s.s.CloseStatusRead = incStatus(s.s.CloseStatusRead, f.CloseStatus)
+	}
+}
+
+// Snapshot returns the totals of s.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := s.s
+	snap.FramesRead = copyOpCodes(s.s.FramesRead)
+	snap.FramesWritten = copyOpCodes(s.s.FramesWritten)
+	snap.CloseStatusRead = copyStatuses(s.s.CloseStatusRead)
+	snap.CloseStatusWritten = copyStatuses(s.s.CloseStatusWritten)
+	return snap
+}
+
+func incOpCode(m map[byte]int64, op byte) map[byte]int64 {
+	if m == nil {
+		m = make(map[byte]int64)
+	}
+	m[op]++
+	return m
+}
+
+func incStatus(m map[int]int64, status int) map[int]int64 {
+	if m == nil {
+		m = make(map[int]int64)
+	}
+	m[status]++
+	return m
+}
+
+func copyOpCodes(m map[byte]int64) map[byte]int64 {
+	c := make(map[byte]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func copyStatuses(m map[int]int64) map[int]int64 {
+	c := make(map[int]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// SetObserver sets the Observer of the frames of ws, replacing that of its
+// Config. A nil o stops the observation.
+func (ws *Conn) SetObserver(o Observer) {
+	ws.observer.Store(observerValue{o})
+}
+
+// observerValue holds an Observer, which may be nil, in an atomic.Value.
+type observerValue struct{ o Observer }
+
+// observe reports f to the observer of ws, if any.
+func (ws *Conn) observe(f FrameStat) {
+	if v, _ := ws.observer.Load().(observerValue); v.o != nil {
+		v.o.ObserveFrame(ws, f)
+	}
+}
+
+// readStat returns the FrameStat of the frame read by frame.
+func readStat(frame *hybiFrameReader) FrameStat {
+	return FrameStat{
+		OpCode:    frame.header.OpCode,
+		Fin:       frame.header.Fin,
+		Len:       frame.header.Length,
+		HeaderLen: frame.length - int(frame.header.Length),
+	}
+}
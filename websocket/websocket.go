@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -63,12 +64,17 @@ var (
 	ErrNotWebSocket         = &ProtocolError{"not websocket protocol"}
 	ErrBadRequestMethod     = &ProtocolError{"bad method"}
 	ErrNotSupported         = &ProtocolError{"not supported"}
+	ErrTooManyRedirects     = &ProtocolError{"too many redirects"}
 )
 
 // ErrFrameTooLarge is returned by Codec's Receive method if payload size
 // exceeds limit set by Conn.MaxPayloadBytes
 var ErrFrameTooLarge = errors.New("websocket: frame payload size exceeds limit")
 
+// ErrCloseSent is returned by the writes of data frames on a connection
+// once a close frame was sent, such as by Server.Shutdown.
+var ErrCloseSent = errors.New("websocket: close frame sent")
+
 // Addr is an implementation of net.Addr for WebSocket.
 type Addr struct {
 	*url.URL
@@ -95,11 +101,49 @@ type Config struct {
 	TlsConfig *tls.Config
 
 	// Additional header fields to be sent in WebSocket opening handshake.
+	// The Authorization and Cookie fields are not sent after a redirect
+	// to another host, nor from wss to ws.
 	Header http.Header
 
+	// Jar specifies the cookie jar of the client. If non-nil, its cookies
+	// for the location are sent in the opening handshake, and the cookies
+	// set by the handshake responses are stored in it.
+	Jar http.CookieJar
+
+	// MaxRedirects is the number of redirect (3xx) responses to the
+	// opening handshake which DialConfig follows to the new location. If
+	// zero, the handshake fails on a redirect with ErrBadStatus.
+	MaxRedirects int
+
 	// Dialer used when opening websocket connections.
 	Dialer *net.Dialer
 
+	// DisableValidation turns off the validation of the frames received.
+	// By default, a frame with reserved bits set, an unknown opcode or a
+	// bad fragmentation, and a control frame too large, fail the
+	// connection with close status 1002 (protocol error), and a text
+	// message which is not valid UTF-8 with close status 1007. Set it to
+	// talk to legacy peers sending such frames.
+	DisableValidation bool
+
+	// ReadRate and WriteRate optionally limit the rate, in bytes per
+	// second, of the data each connection reads and writes, frame
+	// headers included, with a TokenBucket of ReadBurst and WriteBurst
+	// bytes, or one second's worth if zero. A connection reading over
+	// the rate waits, so that a flooding peer is slowed by TCP flow
+	// control.
+	ReadRate, ReadBurst   int
+	WriteRate, WriteBurst int
+
+	// ReadLimiter and WriteLimiter optionally limit the data read and
+	// written by all the connections sharing them, such as those handled
+	// by a Server, in addition to ReadRate and WriteRate.
+	ReadLimiter, WriteLimiter RateLimiter
+
+	// Observer optionally observes the frames of the connections, such as
+	// those handled by a Server when shared, for instance a *Stats.
+	Observer Observer
+
 	handshakeData map[string]string
 }
 
@@ -137,6 +181,8 @@ type frameReader interface {
 }
 
 // frameReaderFactory is an interface to creates new frame reader.
+// If NewFrameReader fails after reading part of the frame header, it
+// returns a non-nil frameReader along with the error.
 type frameReaderFactory interface {
 	NewFrameReader() (r frameReader, err error)
 }
@@ -161,15 +207,21 @@ type frameHandler interface {
 //
 // Multiple goroutines may invoke methods on a Conn simultaneously.
 type Conn struct {
-	config  *Config
-	request *http.Request
+	config   *Config
+	request  *http.Request
+	response *http.Response
 
 	buf *bufio.ReadWriter
 	rwc io.ReadWriteCloser
 
+	// readWait and writeWait interrupt the waits of the rate limiters,
+	// if any, of each direction.
+	readWait, writeWait *rateWait
+
 	rio sync.Mutex
 	frameReaderFactory
 	frameReader
+	rerr error // broke the framing of the frames read, if non-nil
 
 	wio sync.Mutex
 	frameWriterFactory
@@ -177,6 +229,7 @@ type Conn struct {
 	frameHandler
 	PayloadType        byte
 	defaultCloseStatus int
+	observer           atomic.Value // observerValue
 
 	// MaxPayloadBytes limits the size of frame payload received over Conn
 	// by Codec's Receive method. If zero, DefaultMaxPayloadBytes is used.
@@ -193,7 +246,7 @@ func (ws *Conn) Read(msg []byte) (n int, err error) {
 	defer ws.rio.Unlock()
 again:
 	if ws.frameReader == nil {
-		frame, err := ws.frameReaderFactory.NewFrameReader()
+		frame, err := ws.newFrameReader()
 		if err != nil {
 			return 0, err
 		}
@@ -216,12 +269,40 @@ again:
 	return n, err
 }
 
+// newFrameReader reads the header of the next frame. An error after part
+// of the header was read, such as a timeout, leaves the connection
+// within a frame: it is returned by all later reads. ws.rio must be held.
+func (ws *Conn) newFrameReader() (frameReader, error) {
+	if ws.rerr != nil {
+		return nil, ws.rerr
+	}
+	frame, err := ws.frameReaderFactory.NewFrameReader()
+	if err != nil && frame != nil {
+		ws.rerr = err
+	}
+	return frame, err
+}
+
+// newFrameWriter returns a writer of a frame of payloadType, observed by
+// the observer of ws. ws.wio must be held.
+func (ws *Conn) newFrameWriter(payloadType byte) (frameWriter, error) {
+	if h, ok := ws.frameHandler.(*hybiFrameHandler); ok && h.closeSent && payloadType < CloseFrame {
+		// No data frame may follow a close frame.
+		return nil, ErrCloseSent
+	}
+	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
+	if hw, ok := w.(*hybiFrameWriter); ok {
+		hw.conn = ws
+	}
+	return w, err
+}
+
 // Write implements the io.Writer interface:
 // it writes data as a frame to the WebSocket connection.
 func (ws *Conn) Write(msg []byte) (n int, err error) {
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
-	w, err := ws.frameWriterFactory.NewFrameWriter(ws.PayloadType)
+	w, err := ws.newFrameWriter(ws.PayloadType)
 	if err != nil {
 		return 0, err
 	}
@@ -232,6 +313,8 @@ func (ws *Conn) Write(msg []byte) (n int, err error) {
 
 // Close implements the io.Closer interface.
 func (ws *Conn) Close() error {
+	// The closing frame does not wait for the rate limiters either.
+	ws.setRateWaits(true, true, (*rateWait).close)
 	err := ws.frameHandler.WriteClose(ws.defaultCloseStatus)
 	err1 := ws.rwc.Close()
 	if err != nil {
@@ -266,25 +349,53 @@ func (ws *Conn) RemoteAddr() net.Addr {
 
 var errSetDeadline = errors.New("websocket: cannot set deadline: not using a net.Conn")
 
+var _ net.Conn = (*Conn)(nil)
+
 // SetDeadline sets the connection's network read & write deadlines.
+// See SetReadDeadline and SetWriteDeadline.
 func (ws *Conn) SetDeadline(t time.Time) error {
 	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.setRateWaits(true, true, func(w *rateWait) { w.setDeadline(t) })
 		return conn.SetDeadline(t)
 	}
 	return errSetDeadline
 }
 
+// setRateWaits calls f with the rateWaits of the directions read and
+// write which are rate limited.
+func (ws *Conn) setRateWaits(read, write bool, f func(*rateWait)) {
+	if read && ws.readWait != nil {
+		f(ws.readWait)
+	}
+	if write && ws.writeWait != nil {
+		f(ws.writeWait)
+	}
+}
+
 // SetReadDeadline sets the connection's network read deadline.
+//
+// A read which times out fails with an error whose Timeout method
+// returns true, and may be retried after extending the deadline: Read
+// resumes within the frame it was reading, and Codec's Receive discards
+// the rest of the message it was receiving before receiving the next
+// one. Only a timeout within the header of a frame fails all later
+// reads.
 func (ws *Conn) SetReadDeadline(t time.Time) error {
 	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.setRateWaits(true, false, func(w *rateWait) { w.setDeadline(t) })
 		return conn.SetReadDeadline(t)
 	}
 	return errSetDeadline
 }
 
 // SetWriteDeadline sets the connection's network write deadline.
+//
+// A write which times out fails with an error whose Timeout method
+// returns true. Since the frame may have been partially sent, all later
+// writes fail with the same error.
 func (ws *Conn) SetWriteDeadline(t time.Time) error {
 	if conn, ok := ws.rwc.(net.Conn); ok {
+		ws.setRateWaits(false, true, func(w *rateWait) { w.setDeadline(t) })
 		return conn.SetWriteDeadline(t)
 	}
 	return errSetDeadline
@@ -297,6 +408,35 @@ func (ws *Conn) Config() *Config { return ws.config }
 // It is nil for client side.
 func (ws *Conn) Request() *http.Request { return ws.request }
 
+// Response returns the http response of the server to the opening
+// handshake, whose body is empty. It is nil for server side.
+func (ws *Conn) Response() *http.Response { return ws.response }
+
+// Subprotocol returns the WebSocket subprotocol selected by the server
+// in the opening handshake, or "" if none was.
+func (ws *Conn) Subprotocol() string {
+	if ws.response != nil {
+		return ws.response.Header.Get("Sec-WebSocket-Protocol")
+	}
+	if ws.IsServerConn() && ws.config != nil && len(ws.config.Protocol) == 1 {
+		return ws.config.Protocol[0]
+	}
+	return ""
+}
+
+// ConnectionState returns the state of the TLS connection the WebSocket
+// runs over, or nil if it does not use TLS.
+func (ws *Conn) ConnectionState() *tls.ConnectionState {
+	if ws.request != nil {
+		return ws.request.TLS
+	}
+	if c, ok := ws.rwc.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := c.ConnectionState()
+		return &state
+	}
+	return nil
+}
+
 // Codec represents a symmetric pair of functions that implement a codec.
 type Codec struct {
 	Marshal   func(v interface{}) (data []byte, payloadType byte, err error)
@@ -311,7 +451,7 @@ func (cd Codec) Send(ws *Conn, v interface{}) (err error) {
 	}
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
-	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
+	w, err := ws.newFrameWriter(payloadType)
 	if err != nil {
 		return err
 	}
@@ -325,7 +465,8 @@ func (cd Codec) Send(ws *Conn, v interface{}) (err error) {
 // payload is defined by ws.MaxPayloadBytes. If frame payload size exceeds
 // limit, ErrFrameTooLarge is returned; in this case frame is not read off wire
 // completely. The next call to Receive would read and discard leftover data of
-// previous oversized frame before processing next frame.
+// previous oversized frame before processing next frame, as it does for a
+// frame whose payload could not be read, such as after a timeout.
 func (cd Codec) Receive(ws *Conn, v interface{}) (err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
@@ -337,7 +478,7 @@ func (cd Codec) Receive(ws *Conn, v interface{}) (err error) {
 		ws.frameReader = nil
 	}
 again:
-	frame, err := ws.frameReaderFactory.NewFrameReader()
+	frame, err := ws.newFrameReader()
 	if err != nil {
 		return err
 	}
@@ -359,11 +500,15 @@ again:
 		// the next call to this function can drain leftover
 		// data before processing the next frame
 		ws.frameReader = frame
+		f := readStat(hf)
+		f.Dropped = true
+		ws.observe(f)
 		return ErrFrameTooLarge
 	}
 	payloadType := frame.PayloadType()
 	data, err := ioutil.ReadAll(frame)
 	if err != nil {
+		ws.frameReader = frame
 		return err
 	}
 	return cd.Unmarshal(data, payloadType, v)
@@ -6,12 +6,16 @@ package websocket
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
@@ -663,3 +667,488 @@ func TestCodec_ReceiveLimited(t *testing.T) {
 	}
 	<-handlerDone
 }
+
+func TestDialRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		http.Redirect(w, r, server.URL+"/region", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusTemporaryRedirect)
+	})
+	mux.Handle("/region", Handler(func(ws *Conn) {
+		defer ws.Close()
+		c, _ := ws.Request().Cookie("session")
+		if c != nil {
+			io.WriteString(ws, c.Value+" "+ws.Request().Header.Get("X-Token"))
+		} else {
+			io.WriteString(ws, "no session")
+		}
+	}))
+	addr := server.Listener.Addr().String()
+
+	config := newConfig(t, "/login")
+	config.Location.Host = addr
+	jar, _ := cookiejar.New(nil)
+	config.Jar = jar
+	config.Header.Set("X-Token", "t1")
+	config.MaxRedirects = 1
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, 512)
+	n, err := ws.Read(msg)
+	ws.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(msg[:n]), "s1 t1"; got != want {
+		t.Errorf("read %q; want %q", got, want)
+	}
+	if got, want := ws.Config().Location.String(), "ws://"+addr+"/region"; got != want {
+		t.Errorf("location = %q; want %q", got, want)
+	}
+	if config.Location.Path != "/login" {
+		t.Errorf("location of the config dialed changed to %q", config.Location)
+	}
+
+	config = newConfig(t, "/loop")
+	config.Location.Host = addr
+	config.MaxRedirects = 2
+	if _, err := DialConfig(config); err == nil || err.(*DialError).Err != ErrTooManyRedirects {
+		t.Errorf("dial redirect loop: %v; want %v", err, ErrTooManyRedirects)
+	}
+	config.MaxRedirects = 0
+	if _, err := DialConfig(config); err == nil || err.(*DialError).Err != ErrBadStatus {
+		t.Errorf("dial redirect without MaxRedirects: %v; want %v", err, ErrBadStatus)
+	}
+}
+
+func TestConfigRedirectCredentials(t *testing.T) {
+	for _, tt := range []struct {
+		from, to string
+		keep     bool
+	}{
+		{"ws://example.com/a", "ws://example.com/b", true},
+		{"ws://example.com/a", "https://example.com/b", true},
+		{"wss://example.com/a", "wss://example.com:8443/b", true},
+		{"wss://example.com/a", "ws://example.com/b", false},
+		{"wss://example.com/a", "http://example.com/b", false},
+		{"ws://example.com/a", "ws://other.example.com/b", false},
+	} {
+		from, err := url.ParseRequestURI(tt.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, err := url.Parse(tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := &Config{Location: from, Header: http.Header{}}
+		config.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+		config.Header.Set("Cookie", "session=s1")
+		config.Header.Set("X-Token", "t1")
+		config.Header["cookie2"] = []string{"$Version=1"} // not canonicalized
+		c := config.redirect(to)
+		if got := c.Header.Get("Authorization") != "" && c.Header.Get("Cookie") != ""; got != tt.keep {
+			t.Errorf("redirect from %s to %s: credentials kept = %t; want %t", tt.from, tt.to, got, tt.keep)
+		}
+		if _, got := c.Header["cookie2"]; got != tt.keep {
+			t.Errorf("redirect from %s to %s: non-canonical cookie2 kept = %t; want %t", tt.from, tt.to, got, tt.keep)
+		}
+		if c.Header.Get("X-Token") != "t1" {
+			t.Errorf("redirect from %s to %s: X-Token dropped", tt.from, tt.to)
+		}
+		if config.Header.Get("Authorization") == "" {
+			t.Errorf("redirect from %s to %s: header of the config redirected changed", tt.from, tt.to)
+		}
+	}
+}
+
+func TestConnState(t *testing.T) {
+	type state struct {
+		subprotocol string
+		tls         bool
+	}
+	serverState := make(chan state, 1)
+	server := httptest.NewTLSServer(Server{
+		Handshake: subProtocolHandshake,
+		Handler: func(ws *Conn) {
+			serverState <- state{ws.Subprotocol(), ws.ConnectionState() != nil}
+			ws.Close()
+		},
+	})
+	defer server.Close()
+
+	config, err := NewConfig("wss://"+server.Listener.Addr().String()+"/", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Protocol = []string{"test", "chat"}
+	config.TlsConfig = &tls.Config{InsecureSkipVerify: true}
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if s := ws.Subprotocol(); s != "chat" {
+		t.Errorf("client Subprotocol() = %q; want %q", s, "chat")
+	}
+	if ws.ConnectionState() == nil {
+		t.Error("client ConnectionState() = nil")
+	}
+	if res := ws.Response(); res == nil || res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("client Response() = %v; want the 101 response", res)
+	}
+	if s := <-serverState; s != (state{"chat", true}) {
+		t.Errorf("server Subprotocol() = %q, has TLS state %v; want %q, true", s.subprotocol, s.tls, "chat")
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	ws := newHybiConn(newConfig(t, "/"), nil, c1, nil)
+
+	next := make(chan []byte)
+	go func() {
+		for b := range next {
+			c2.Write(b)
+		}
+	}()
+	defer close(next)
+
+	// A timeout within a message drops it.
+	next <- []byte("\x81\x05he")
+	ws.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	var msg string
+	if err := Message.Receive(ws, &msg); !isTimeout(err) {
+		t.Fatalf("Receive within a message: %v; want a timeout", err)
+	}
+	next <- []byte("llo\x81\x02ok")
+	ws.SetReadDeadline(time.Time{})
+	if err := Message.Receive(ws, &msg); err != nil || msg != "ok" {
+		t.Fatalf("Receive after a timeout = %q, %v; want %q", msg, err, "ok")
+	}
+
+	// A timeout within a frame header fails all later reads.
+	next <- []byte("\x81")
+	ws.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	b := make([]byte, 16)
+	if _, err := ws.Read(b); !isTimeout(err) {
+		t.Fatalf("Read within a frame header: %v; want a timeout", err)
+	}
+	ws.SetReadDeadline(time.Time{})
+	if _, err := ws.Read(b); !isTimeout(err) {
+		t.Fatalf("Read after a timeout within a frame header: %v; want the timeout", err)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// countingLimiter is a RateLimiter counting the bytes it allows, by
+// chunks of at most max bytes.
+type countingLimiter struct {
+	mu    sync.Mutex
+	max   int
+	bytes int
+}
+
+func (l *countingLimiter) Take(n int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.max {
+		n = l.max
+	}
+	l.bytes += n
+	return n, nil
+}
+
+func (l *countingLimiter) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bytes
+}
+
+func TestRateLimiters(t *testing.T) {
+	read := &countingLimiter{max: 100}
+	write := &countingLimiter{max: 7}
+	s := Server{
+		Config: Config{
+			ReadRate:     1 << 20,
+			ReadBurst:    10,
+			ReadLimiter:  read,
+			WriteLimiter: write,
+		},
+		Handler: func(ws *Conn) { io.Copy(ws, ws) },
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	ws, err := Dial("ws://"+server.Listener.Addr().String()+"/", "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	msg := strings.Repeat("x", 1000)
+	for i := 0; i < 2; i++ {
+		if _, err := ws.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if err := Message.Receive(ws, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != msg {
+			t.Fatalf("#%d: got %d bytes; want %d", i, len(got), len(msg))
+		}
+	}
+	// The masked frames of the client have a header of 8 bytes, and those
+	// of the server 4.
+	if got, want := read.count(), 2*(1000+8); got != want {
+		t.Errorf("ReadLimiter allowed %d bytes; want %d", got, want)
+	}
+	if got, want := write.count(), 2*(1000+4); got != want {
+		t.Errorf("WriteLimiter allowed %d bytes; want %d", got, want)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	b := NewTokenBucket(1000, 100)
+	b.now = func() time.Time { return now }
+	b.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	take := func(n, want int) {
+		t.Helper()
+		if got, err := b.Take(n); got != want || err != nil {
+			t.Fatalf("Take(%d) = %d, %v; want %d", n, got, err, want)
+		}
+	}
+	take(60, 60)
+	take(60, 40)
+	if slept != 0 {
+		t.Errorf("slept %v with tokens left", slept)
+	}
+	take(60, 1)
+	if slept != time.Millisecond {
+		t.Errorf("slept %v for a token; want 1ms", slept)
+	}
+	now = now.Add(time.Second)
+	take(200, 100)
+}
+
+func TestRateLimitedDeadlineAndClose(t *testing.T) {
+	s := Server{Handler: func(ws *Conn) {
+		ws.Write([]byte(strings.Repeat("x", 1000)))
+		io.Copy(io.Discard, ws)
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	config, err := NewConfig("ws://"+server.Listener.Addr().String()+"/", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ReadRate, config.ReadBurst = 10, 10
+	config.WriteRate, config.WriteBurst = 10, 10
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// The limiter would wait for about 100 seconds after reading the
+	// message. Its wait ends at the deadline, failing the next read.
+	ws.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	if _, err := io.ReadFull(ws, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Errorf("rate limited read past the deadline: %v; want a timeout", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("rate limited read timed out after %v", d)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ws.Write([]byte(strings.Repeat("x", 1000)))
+		errc <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	ws.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("rate limited write succeeded after Close")
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("rate limited write not interrupted by Close")
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var serverStats, clientStats Stats
+	done := make(chan struct{})
+	s := Server{
+		Config: Config{Observer: &serverStats},
+		Handler: func(ws *Conn) {
+			io.Copy(ws, ws)
+			ws.Close()
+			close(done)
+		},
+	}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	ws, err := Dial("ws://"+server.Listener.Addr().String()+"/", "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetObserver(&clientStats)
+	ws.MaxPayloadBytes = 100
+
+	if _, err := ws.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := Message.Receive(ws, &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Write([]byte(strings.Repeat("x", 1000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := Message.Receive(ws, &got); err != ErrFrameTooLarge {
+		t.Fatalf("Receive of a large frame: %v; want ErrFrameTooLarge", err)
+	}
+	if err := ws.frameHandler.WriteClose(closeStatusNormal); err != nil {
+		t.Fatal(err)
+	}
+	if err := Message.Receive(ws, &got); err != io.EOF {
+		t.Fatalf("Receive after close: %v; want EOF", err)
+	}
+	<-done
+	cli := clientStats.Snapshot()
+	ws.Close()
+
+	srv := serverStats.Snapshot()
+	if got, want := srv.FramesRead, map[byte]int64{TextFrame: 2, CloseFrame: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server FramesRead = %v; want %v", got, want)
+	}
+	if got, want := srv.FramesWritten, map[byte]int64{TextFrame: 2, CloseFrame: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server FramesWritten = %v; want %v", got, want)
+	}
+	if got, want := srv.CloseStatusRead, map[int]int64{closeStatusNormal: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("server CloseStatusRead = %v; want %v", got, want)
+	}
+	// The masked frames of the client have headers of 6 or 8 bytes.
+	if got, want := srv.BytesRead, int64((5+6)+(1000+8)+(2+6)); got != want {
+		t.Errorf("server BytesRead = %d; want %d", got, want)
+	}
+
+	if cli.BytesWritten != srv.BytesRead {
+		t.Errorf("client BytesWritten = %d; want %d, the server BytesRead", cli.BytesWritten, srv.BytesRead)
+	}
+	if got, want := cli.CloseStatusWritten, map[int]int64{closeStatusNormal: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("client CloseStatusWritten = %v; want %v", got, want)
+	}
+	if got, want := cli.FramesRead, map[byte]int64{TextFrame: 2, CloseFrame: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("client FramesRead = %v; want %v", got, want)
+	}
+	if cli.Dropped != 1 {
+		t.Errorf("client Dropped = %d; want 1", cli.Dropped)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := &Server{Handler: func(ws *Conn) {
+		io.Copy(ioutil.Discard, ws)
+		ws.Close()
+	}}
+	server := httptest.NewUnstartedServer(s)
+	s.RegisterOnShutdown(server.Config, time.Second)
+	server.Start()
+	defer server.Close()
+	url := "ws://" + server.Listener.Addr().String() + "/"
+
+	// A client completing the close handshake.
+	var stats Stats
+	ws, err := Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetObserver(&stats)
+	// A client ignoring the close frame.
+	stuck, err := Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stuck.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		done <- s.Shutdown(ctx)
+	}()
+	if _, err := ws.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read: %v; want io.EOF", err)
+	}
+	ws.Close()
+	if got := stats.Snapshot().CloseStatusRead[closeStatusGoingAway]; got != 1 {
+		t.Errorf("read %d close frames of status 1001; want 1", got)
+	}
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("Shutdown: %v; want context.DeadlineExceeded", err)
+	}
+	stuck.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// The close frame, and then the end of the connection, closed.
+	for i := 0; i < 2; i++ {
+		_, err := stuck.Read(make([]byte, 1))
+		if ne, ok := err.(net.Error); err == nil || ok && ne.Timeout() {
+			t.Fatalf("Read #%d: %v; want the connection closed", i, err)
+		}
+	}
+
+	if _, err := Dial(url, "", "http://localhost/"); err == nil {
+		t.Errorf("Dial after Shutdown succeeded")
+	}
+}
+
+func TestServerShutdownUnregistered(t *testing.T) {
+	s := &Server{Handler: func(ws *Conn) {
+		io.Copy(ioutil.Discard, ws)
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	url := "ws://" + server.Listener.Addr().String() + "/"
+
+	// Without RegisterOnShutdown, Shutdown leaves s.shutdown alone, which
+	// ServeHTTP reads concurrently.
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	ws, err := Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown: %v; want nil", err)
+	}
+	if _, err := Dial(url, "", "http://localhost/"); err != nil {
+		t.Errorf("Dial after Shutdown without RegisterOnShutdown: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xsrftoken
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultCookieName is the cookie name used by Middleware if
+	// CookieName is empty.
+	DefaultCookieName = "xsrf_token"
+
+	// DefaultHeaderName is the header name used by Middleware if
+	// HeaderName is empty.
+	DefaultHeaderName = "X-XSRF-Token"
+
+	// DefaultFormField is the form field name used by Middleware if
+	// FormField is empty.
+	DefaultFormField = "xsrf_token"
+)
+
+type tokenContextKey struct{}
+
+// Token returns the token issued by Middleware for r, for embedding in
+// forms or exposing to scripts. It returns the empty string if r was
+// not handled by Middleware.
+func Token(r *http.Request) string {
+	tok, _ := r.Context().Value(tokenContextKey{}).(string)
+	return tok
+}
+
+// Middleware protects HTTP handlers against cross-site request forgery
+// using the double-submit cookie pattern.
+//
+// Every response carries a token in a cookie, signed by Maker so that
+// it cannot be forged by a subdomain that is able to set cookies.
+// Requests with an unsafe method (anything other than GET, HEAD,
+// OPTIONS and TRACE) must echo the token in a header or form field,
+// which a cross-site attacker cannot do since it cannot read the
+// cookie.
+type Middleware struct {
+	// Maker generates and validates tokens. It must not be nil.
+	Maker *TokenMaker
+
+	// Nonce, if non-nil, returns the session nonce of the request,
+	// as for GenerateWithNonce.
+	Nonce func(r *http.Request) string
+
+	// UserID, if non-nil, returns the identifier of the user making
+	// the request.
+	UserID func(r *http.Request) string
+
+	// CookieName is the name of the cookie carrying the token.
+	// If empty, DefaultCookieName is used.
+	CookieName string
+
+	// CookiePath is the Path attribute of the cookie.
+	// If empty, "/" is used.
+	CookiePath string
+
+	// CookieDomain is the Domain attribute of the cookie.
+	CookieDomain string
+
+	// SameSite is the SameSite attribute of the cookie.
+	// If zero, http.SameSiteLaxMode is used. http.SameSiteNoneMode
+	// implies Secure, as browsers reject the cookie otherwise.
+	SameSite http.SameSite
+
+	// Secure sets the Secure attribute of the cookie.
+	Secure bool
+
+	// HTTPOnly sets the HttpOnly attribute of the cookie. Since
+	// scripts then cannot read the cookie, it is typically combined
+	// with ExposeHeader.
+	HTTPOnly bool
+
+	// HeaderName is the request header checked for the token on
+	// unsafe requests. If empty, DefaultHeaderName is used.
+	HeaderName string
+
+	// FormField is the form field checked for the token on unsafe
+	// requests that do not carry the header. If empty,
+	// DefaultFormField is used.
+	FormField string
+
+	// ExposeHeader makes every response carry the token in the
+	// HeaderName header as well as in the cookie.
+	ExposeHeader bool
+
+	// ExemptPaths lists request paths that are not checked. A path
+	// ending in "/" exempts all paths that it is a prefix of.
+	ExemptPaths []string
+
+	// ErrorHandler, if non-nil, serves requests that fail
+	// validation. Otherwise, they are answered with 403 Forbidden.
+	ErrorHandler http.Handler
+}
+
+// Wrap returns a handler that issues and validates tokens before
+// calling h.
+func (m *Middleware) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, userID := m.ids(r)
+		var tok string
+		if c, err := r.Cookie(m.cookieName()); err == nil && m.Maker.Valid(c.Value, nonce, userID, "") {
+			tok = c.Value
+		}
+
+		if !safeMethod(r.Method) && !m.exempt(r.URL.Path) {
+			if tok == "" || subtle.ConstantTimeCompare([]byte(m.submitted(r)), []byte(tok)) != 1 {
+				m.fail(w, r)
+				return
+			}
+		}
+
+		// A strict cookie is withheld on cross-site navigations, so
+		// its absence does not mean the client lacks a token.
+		// Replacing it would break pages already open on the site.
+		crossSite := r.Header.Get("Sec-Fetch-Site") == "cross-site"
+		if tok == "" && !(crossSite && m.sameSite() == http.SameSiteStrictMode) {
+			tok = m.Maker.Generate(nonce, userID, "")
+			http.SetCookie(w, m.cookie(tok))
+		}
+		if tok != "" && m.ExposeHeader {
+			w.Header().Set(m.headerName(), tok)
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, tok)))
+	})
+}
+
+func (m *Middleware) ids(r *http.Request) (nonce, userID string) {
+	if m.Nonce != nil {
+		nonce = m.Nonce(r)
+	}
+	if m.UserID != nil {
+		userID = m.UserID(r)
+	}
+	return nonce, userID
+}
+
+func (m *Middleware) submitted(r *http.Request) string {
+	if tok := r.Header.Get(m.headerName()); tok != "" {
+		return tok
+	}
+	field := m.FormField
+	if field == "" {
+		field = DefaultFormField
+	}
+	return r.PostFormValue(field)
+}
+
+func (m *Middleware) fail(w http.ResponseWriter, r *http.Request) {
+	if m.ErrorHandler != nil {
+		m.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "Forbidden - XSRF token invalid", http.StatusForbidden)
+}
+
+func (m *Middleware) exempt(path string) bool {
+	for _, p := range m.ExemptPaths {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Middleware) cookie(tok string) *http.Cookie {
+	path := m.CookiePath
+	if path == "" {
+		path = "/"
+	}
+	sameSite := m.sameSite()
+	return &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    tok,
+		Path:     path,
+		Domain:   m.CookieDomain,
+		MaxAge:   int(m.Maker.timeout().Seconds()),
+		Secure:   m.Secure || sameSite == http.SameSiteNoneMode,
+		HttpOnly: m.HTTPOnly,
+		SameSite: sameSite,
+	}
+}
+
+func (m *Middleware) cookieName() string {
+	if m.CookieName != "" {
+		return m.CookieName
+	}
+	return DefaultCookieName
+}
+
+func (m *Middleware) headerName() string {
+	if m.HeaderName != "" {
+		return m.HeaderName
+	}
+	return DefaultHeaderName
+}
+
+func (m *Middleware) sameSite() http.SameSite {
+	if m.SameSite != 0 {
+		return m.SameSite
+	}
+	return http.SameSiteLaxMode
+}
+
+// safeMethod reports whether method is safe as defined by RFC 9110,
+// Section 9.2.1, and therefore exempt from validation.
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xsrftoken
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newTestMiddleware() *Middleware {
+	return &Middleware{
+		Maker:       &TokenMaker{Keys: []string{key}},
+		ExemptPaths: []string{"/webhook/"},
+	}
+}
+
+func serve(m *Middleware, r *http.Request) (*httptest.ResponseRecorder, string) {
+	var seen string
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Token(r)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w, seen
+}
+
+func issuedCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultCookieName {
+			return c
+		}
+	}
+	t.Fatal("no token cookie issued")
+	return nil
+}
+
+func TestMiddlewareIssuesToken(t *testing.T) {
+	m := newTestMiddleware()
+	w, seen := serve(m, httptest.NewRequest("GET", "/", nil))
+	c := issuedCookie(t, w)
+	if seen != c.Value {
+		t.Errorf("Token(r) = %q; want cookie value %q", seen, c.Value)
+	}
+	if c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("SameSite = %v; want Lax", c.SameSite)
+	}
+
+	// A valid cookie is reused.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	w, seen = serve(m, r)
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected existing cookie to be reused")
+	}
+	if seen != c.Value {
+		t.Errorf("Token(r) = %q; want %q", seen, c.Value)
+	}
+}
+
+func TestMiddlewareValidatesUnsafeMethods(t *testing.T) {
+	m := newTestMiddleware()
+	w, _ := serve(m, httptest.NewRequest("GET", "/", nil))
+	c := issuedCookie(t, w)
+	forged := &http.Cookie{Name: DefaultCookieName, Value: generateTokenAtTime("other", "", "", now)}
+
+	newForm := func(tok string) *http.Request {
+		r := httptest.NewRequest("POST", "/submit", strings.NewReader(url.Values{DefaultFormField: {tok}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	tests := []struct {
+		name   string
+		req    func() *http.Request
+		status int
+	}{
+		{"Header", func() *http.Request {
+			r := httptest.NewRequest("POST", "/submit", nil)
+			r.AddCookie(c)
+			r.Header.Set(DefaultHeaderName, c.Value)
+			return r
+		}, http.StatusOK},
+		{"Form", func() *http.Request {
+			r := newForm(c.Value)
+			r.AddCookie(c)
+			return r
+		}, http.StatusOK},
+		{"Missing cookie", func() *http.Request {
+			r := httptest.NewRequest("POST", "/submit", nil)
+			r.Header.Set(DefaultHeaderName, c.Value)
+			return r
+		}, http.StatusForbidden},
+		{"Missing token", func() *http.Request {
+			r := httptest.NewRequest("DELETE", "/submit", nil)
+			r.AddCookie(c)
+			return r
+		}, http.StatusForbidden},
+		{"Mismatched token", func() *http.Request {
+			r := newForm(c.Value + "x")
+			r.AddCookie(c)
+			return r
+		}, http.StatusForbidden},
+		{"Forged cookie", func() *http.Request {
+			r := httptest.NewRequest("POST", "/submit", nil)
+			r.AddCookie(forged)
+			r.Header.Set(DefaultHeaderName, forged.Value)
+			return r
+		}, http.StatusForbidden},
+		{"Exempt path", func() *http.Request {
+			return httptest.NewRequest("POST", "/webhook/github", nil)
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w, _ := serve(m, tt.req())
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestMiddlewareSameSite(t *testing.T) {
+	m := newTestMiddleware()
+	m.SameSite = http.SameSiteNoneMode
+	w, _ := serve(m, httptest.NewRequest("GET", "/", nil))
+	if c := issuedCookie(t, w); !c.Secure {
+		t.Error("Expected SameSite=None cookie to be Secure")
+	}
+
+	m.SameSite = http.SameSiteStrictMode
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	w, seen := serve(m, r)
+	if len(w.Result().Cookies()) != 0 || seen != "" {
+		t.Error("Expected no strict cookie to be issued on cross-site navigation")
+	}
+}
+
+func TestMiddlewareExposeHeader(t *testing.T) {
+	m := newTestMiddleware()
+	m.ExposeHeader = true
+	m.HTTPOnly = true
+	w, _ := serve(m, httptest.NewRequest("GET", "/", nil))
+	c := issuedCookie(t, w)
+	if !c.HttpOnly {
+		t.Error("Expected HttpOnly cookie")
+	}
+	if got := w.Header().Get(DefaultHeaderName); got != c.Value {
+		t.Errorf("%s header = %q; want %q", DefaultHeaderName, got, c.Value)
+	}
+}
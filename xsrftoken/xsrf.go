@@ -34,8 +34,23 @@ func Generate(key, userID, actionID string) string {
 	return generateTokenAtTime(key, userID, actionID, time.Now())
 }
 
+// GenerateWithNonce is like Generate, but additionally binds the token
+// to nonce, an opaque value tied to the user's session.
+// Replacing the nonce when a session is invalidated (for example on
+// logout) invalidates all tokens issued for the session, even if they
+// have not yet expired.
+// An empty nonce yields the same token as Generate.
+func GenerateWithNonce(key, nonce, userID, actionID string) string {
+	return generateBoundTokenAtTime(key, nonce, userID, actionID, time.Now())
+}
+
 // generateTokenAtTime is like Generate, but returns a token that expires 24 hours from now.
 func generateTokenAtTime(key, userID, actionID string, now time.Time) string {
+	return generateBoundTokenAtTime(key, "", userID, actionID, now)
+}
+
+// generateBoundTokenAtTime is like GenerateWithNonce, but returns a token that expires 24 hours from now.
+func generateBoundTokenAtTime(key, nonce, userID, actionID string, now time.Time) string {
 	if len(key) == 0 {
 		panic("zero length xsrf secret key")
 	}
@@ -43,7 +58,13 @@ func generateTokenAtTime(key, userID, actionID string, now time.Time) string {
 	milliTime := (now.UnixNano() + 1e6 - 1) / 1e6
 
 	h := hmac.New(sha1.New, []byte(key))
-	fmt.Fprintf(h, "%s:%s:%d", clean(userID), clean(actionID), milliTime)
+	if nonce == "" {
+		fmt.Fprintf(h, "%s:%s:%d", clean(userID), clean(actionID), milliTime)
+	} else {
+		// The extra field keeps bound tokens distinct from unbound
+		// ones, since clean never leaves a single ":" in a field.
+		fmt.Fprintf(h, "%s:%s:%s:%d", clean(nonce), clean(userID), clean(actionID), milliTime)
+	}
 
 	// Get the padded base64 string then removing the padding.
 	tok := string(h.Sum(nil))
@@ -65,37 +86,113 @@ func ValidFor(token, key, userID, actionID string, timeout time.Duration) bool {
 	return validTokenAtTime(token, key, userID, actionID, time.Now(), timeout)
 }
 
+// ValidWithKeys reports whether a token is a valid, unexpired token
+// returned by Generate or GenerateWithNonce for any of keys, and nonce.
+// Listing both the current and the previous key allows keys to be
+// rotated without rejecting tokens issued just before the rotation.
+// The token is considered to be expired and invalid if it is older than the timeout duration.
+func ValidWithKeys(token string, keys []string, nonce, userID, actionID string, timeout time.Duration) bool {
+	return validBoundTokenAtTime(token, keys, nonce, userID, actionID, time.Now(), timeout)
+}
+
 // validTokenAtTime reports whether a token is valid at the given time.
 func validTokenAtTime(token, key, userID, actionID string, now time.Time, timeout time.Duration) bool {
-	if len(key) == 0 {
-		panic("zero length xsrf secret key")
+	return validBoundTokenAtTime(token, []string{key}, "", userID, actionID, now, timeout)
+}
+
+// validBoundTokenAtTime reports whether a token is valid for any of keys at the given time.
+func validBoundTokenAtTime(token string, keys []string, nonce, userID, actionID string, now time.Time, timeout time.Duration) bool {
+	if len(keys) == 0 {
+		panic("no xsrf secret keys")
 	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			panic("zero length xsrf secret key")
+		}
+	}
+	// Malformed and expired tokens are rejected only after doing the
+	// same work as for well-formed ones, so that the time taken does
+	// not reveal why a token was rejected.
+	ok := 1
+
 	// Extract the issue time of the token.
 	sep := strings.LastIndex(token, ":")
-	if sep < 0 {
-		return false
-	}
 	millis, err := strconv.ParseInt(token[sep+1:], 10, 64)
-	if err != nil {
-		return false
+	if sep < 0 || err != nil {
+		ok = 0
+		millis = 0
 	}
 	issueTime := time.Unix(0, millis*1e6)
 
 	// Check that the token is not expired.
 	if now.Sub(issueTime) >= timeout {
-		return false
+		ok = 0
 	}
 
 	// Check that the token is not from the future.
 	// Allow 1 minute grace period in case the token is being verified on a
 	// machine whose clock is behind the machine that issued the token.
 	if issueTime.After(now.Add(1 * time.Minute)) {
-		return false
+		ok = 0
 	}
 
-	expected := generateTokenAtTime(key, userID, actionID, issueTime)
+	// Check that the token matches the expected value for some key.
+	// Use constant time comparison and check every key to avoid timing attacks.
+	match := 0
+	for _, key := range keys {
+		expected := generateBoundTokenAtTime(key, nonce, userID, actionID, issueTime)
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(expected))
+	}
+	return ok&match == 1
+}
+
+// A TokenMaker generates and validates XSRF tokens using a set of keys
+// and a validity window of its own.
+//
+// It is safe to use a TokenMaker concurrently once it is configured.
+type TokenMaker struct {
+	// Keys are the secret keys of the application; there must be at
+	// least one and none may be empty. Tokens are generated with the
+	// first key and accepted if they match any key, which allows
+	// keys to be rotated by prepending the new key and dropping the
+	// old one once its tokens have expired.
+	Keys []string
+
+	// Timeout is the duration for which tokens are valid.
+	// If zero, the package-level Timeout is used.
+	Timeout time.Duration
+
+	// Now returns the current time. If nil, time.Now is used.
+	// It is typically replaced in tests.
+	Now func() time.Time
+}
+
+func (m *TokenMaker) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *TokenMaker) timeout() time.Duration {
+	if m.Timeout != 0 {
+		return m.Timeout
+	}
+	return Timeout
+}
+
+// Generate returns a URL-safe secure XSRF token bound to nonce, which
+// may be empty, and expires after m.Timeout.
+// userID and actionID are as for the package-level Generate.
+func (m *TokenMaker) Generate(nonce, userID, actionID string) string {
+	if len(m.Keys) == 0 {
+		panic("no xsrf secret keys")
+	}
+	return generateBoundTokenAtTime(m.Keys[0], nonce, userID, actionID, m.now())
+}
 
-	// Check that the token matches the expected value.
-	// Use constant time comparison to avoid timing attacks.
-	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+// Valid reports whether a token is a valid, unexpired token returned by
+// Generate for any of m.Keys and the given nonce, userID and actionID.
+func (m *TokenMaker) Valid(token, nonce, userID, actionID string) bool {
+	return validBoundTokenAtTime(token, m.Keys, nonce, userID, actionID, m.now(), m.timeout())
 }
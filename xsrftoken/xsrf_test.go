@@ -114,3 +114,83 @@ func TestValidateBadData(t *testing.T) {
 		}
 	}
 }
+
+func TestNonceBinding(t *testing.T) {
+	const nonce = "session-1"
+	tok := generateBoundTokenAtTime(key, nonce, userID, actionID, now)
+	if tok == generateTokenAtTime(key, userID, actionID, now) {
+		t.Error("Expected bound token to differ from unbound token")
+	}
+	if !validBoundTokenAtTime(tok, []string{key}, nonce, userID, actionID, oneMinuteFromNow, Timeout) {
+		t.Error("Expected token to be valid with the same nonce")
+	}
+	for _, n := range []string{"", "session-2", "session-1:"} {
+		if validBoundTokenAtTime(tok, []string{key}, n, userID, actionID, oneMinuteFromNow, Timeout) {
+			t.Errorf("Nonce %q: Expected token to be invalid", n)
+		}
+	}
+	if generateBoundTokenAtTime(key, "", userID, actionID, now) != generateTokenAtTime(key, userID, actionID, now) {
+		t.Error("Expected empty nonce to yield an unbound token")
+	}
+	if generateBoundTokenAtTime(key, "a", "b:c", actionID, now) == generateBoundTokenAtTime(key, "a:b", "c", actionID, now) {
+		t.Error("Expected separator in nonce to be escaped")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	const oldKey, newKey = "old", "new"
+	oldTok := generateTokenAtTime(oldKey, userID, actionID, now)
+	newTok := generateTokenAtTime(newKey, userID, actionID, now)
+	keys := []string{newKey, oldKey}
+	for _, tok := range []string{oldTok, newTok} {
+		if !validBoundTokenAtTime(tok, keys, "", userID, actionID, oneMinuteFromNow, Timeout) {
+			t.Errorf("Expected token %q to be valid with rotated keys", tok)
+		}
+	}
+	if validBoundTokenAtTime(oldTok, []string{newKey}, "", userID, actionID, oneMinuteFromNow, Timeout) {
+		t.Error("Expected token signed with retired key to be invalid")
+	}
+}
+
+func TestTokenMaker(t *testing.T) {
+	clock := now
+	m := &TokenMaker{
+		Keys:    []string{key},
+		Timeout: time.Hour,
+		Now:     func() time.Time { return clock },
+	}
+	tok := m.Generate("nonce", userID, actionID)
+	if tok != generateBoundTokenAtTime(key, "nonce", userID, actionID, now) {
+		t.Error("Expected token to be generated at the injected time")
+	}
+	clock = now.Add(time.Hour - time.Millisecond)
+	if !m.Valid(tok, "nonce", userID, actionID) {
+		t.Error("Just before timeout: Expected token to be valid")
+	}
+	clock = now.Add(time.Hour + time.Millisecond)
+	if m.Valid(tok, "nonce", userID, actionID) {
+		t.Error("After timeout: Expected token to be invalid")
+	}
+
+	m.Timeout = 0
+	if !m.Valid(tok, "nonce", userID, actionID) {
+		t.Error("Default timeout: Expected token to be valid")
+	}
+
+	m.Keys = []string{"new", key}
+	if !m.Valid(tok, "nonce", userID, actionID) {
+		t.Error("After rotation: Expected token to be valid")
+	}
+	if m.Generate("nonce", userID, actionID) == tok {
+		t.Error("After rotation: Expected tokens to be generated with the new key")
+	}
+}
+
+func TestTokenMakerBadData(t *testing.T) {
+	m := &TokenMaker{Keys: []string{key}, Now: func() time.Time { return oneMinuteFromNow }}
+	for _, tok := range []string{"", ":", "abc:", "abc:-1", ":1", "abc:99999999999999999999"} {
+		if m.Valid(tok, "", userID, actionID) {
+			t.Errorf("%q: Expected token to be invalid", tok)
+		}
+	}
+}